@@ -95,7 +95,7 @@ func DefaultAppConfig() AppConfig {
 		RuntimeFile:        "config.runtime.json",
 		DataDir:            config.DataDir,
 		SettingsFile:       config.AppSettingsFile,
-		AppRulesFile:       config.DataDir + "/app_rules.json",
+		AppRulesFile:       config.AppRulesFile,
 		APIAddress:         config.APIAddress,
 		WebUIURL:           "http://127.0.0.1:8080",
 		ProxyGuardInterval: 5 * time.Second, // B-2: проверка каждые 5 секунд
@@ -199,6 +199,9 @@ func (a *App) buildXRayCfg() xray.Config {
 		// ровно столько, сколько нужно wintun. При чистом завершении (RecordCleanShutdown)
 		// PollUntilFree возвращается мгновенно, задержка возникает только при крашах.
 		BeforeRestart: func(ctx context.Context, log logger.Logger) error {
+			if a.proxyOnly() {
+				return nil
+			}
 			// СР-3: проверяем CleanShutdownFile ДО RecordStop, который его удаляет.
 			// Если sing-box остановился чисто — пропускаем RemoveStaleTunAdapter (~3-5с).
 			_, cleanErr := os.Stat(wintun.CleanShutdownFile)
@@ -232,6 +235,12 @@ func (a *App) buildXRayCfg() xray.Config {
 	}
 }
 
+// proxyOnly — включён ли режим без TUN. Читается из routing.json при каждом
+// вызове: режим меняется через API без перезапуска приложения.
+func (a *App) proxyOnly() bool {
+	return config.ProxyOnlyEnabled(a.cfg.DataDir + "/routing.json")
+}
+
 // handleCrash обрабатывает неожиданное падение sing-box.
 // Вынесен из замыкания — теперь тестируем и читаем как самостоятельный метод.
 func (a *App) handleCrash(crashErr error, crashedManager xray.Manager) {
@@ -342,11 +351,13 @@ func (a *App) handleCrash(crashErr error, crashedManager xray.Manager) {
 		// Решение: RecordStop + RemoveStaleTunAdapterCtx + PollUntilFree ПЕРЕД стартом.
 		// Аналогично TUN-conflict пути, но без увеличения adaptive gap
 		// (cache-timeout ≠ slow TUN — gap трогать не нужно).
-		a.mainLogger.Info("sing-box: cache-timeout recovery — очистка wintun перед перезапуском...")
-		wintun.RecordStop()
-		wintun.RemoveStaleTunAdapterCtx(a.lifecycleCtx, a.mainLogger)
-		a.apiServer.SetRestarting(wintun.EstimateReadyAt())
-		wintun.PollUntilFree(a.lifecycleCtx, a.mainLogger, config.TunInterfaceName)
+		if !a.proxyOnly() {
+			a.mainLogger.Info("sing-box: cache-timeout recovery — очистка wintun перед перезапуском...")
+			wintun.RecordStop()
+			wintun.RemoveStaleTunAdapterCtx(a.lifecycleCtx, a.mainLogger)
+			a.apiServer.SetRestarting(wintun.EstimateReadyAt())
+			wintun.PollUntilFree(a.lifecycleCtx, a.mainLogger, config.TunInterfaceName)
+		}
 
 		// Шаг 5: перезапуск sing-box с чистым кэшем (cleanup выполнен выше вручную).
 		if a.apiServer.GetXRayManager() != currentMgr {
@@ -552,6 +563,11 @@ func (a *App) finalizeStartup() {
 			a.mainLogger.Info("B-10: GeoAutoUpdater запущен (интервал: %d дней)", a.cfg.GeoAutoUpdateIntervalDays)
 		}
 	}
+	// Удалённые rule-set'ы обновляются независимо от настроек geosite:
+	// без копии правила ruleset: просто не попадают в конфиг.
+	ruleSetUpdater := api.NewRuleSetUpdater(a.mainLogger)
+	a.apiServer.SetRuleSetUpdater(ruleSetUpdater)
+	ruleSetUpdater.Start(a.lifecycleCtx)
 
 	if mgr := a.apiServer.GetXRayManager(); mgr != nil {
 		mgr.SetHealthAlertFn(func() {
@@ -716,7 +732,7 @@ func (a *App) runLatencyHistory() {
 			OK        bool   `json:"ok"`
 		} `json:"results"`
 	}
-	client := &http.Client{Timeout: 20 * time.Second}
+	client := a.apiServer.LocalClient(20 * time.Second)
 	for {
 		select {
 		case <-a.lifecycleCtx.Done():
@@ -854,6 +870,11 @@ func (a *App) startBackground(xrayCfg xray.Config, proxyConfig proxy.Config, api
 			notification.Send("SafeSky", "sing-box.exe загружен ✓")
 		}
 
+		if a.proxyOnly() {
+			a.mainLogger.Info("Фоновая инициализация: режим без TUN — wintun cleanup не нужен")
+			sendWintunReady(startupPrepResult{})
+			return
+		}
 		a.mainLogger.Info("Фоновая инициализация: wintun cleanup...")
 
 		if _, err := os.Stat(a.cfg.ConfigPath + ".pending"); err == nil {
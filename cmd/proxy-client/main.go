@@ -27,20 +27,22 @@ import (
 	"golang.org/x/sys/windows"
 
 	"proxyclient/internal/api"
+	"proxyclient/internal/apiauth"
 	"proxyclient/internal/apprules"
 	"proxyclient/internal/autorun"
 	"proxyclient/internal/clipboard"
 	"proxyclient/internal/config"
 	"proxyclient/internal/crashreport"
 	"proxyclient/internal/eventlog"
+	"proxyclient/internal/historydb"
 	"proxyclient/internal/hotkeys"
 	"proxyclient/internal/i18n"
 	"proxyclient/internal/netutil"
 	"proxyclient/internal/notification"
 	"proxyclient/internal/power"
 	"proxyclient/internal/process"
-	"proxyclient/internal/proxy"
 	"proxyclient/internal/telemetry"
+	"proxyclient/internal/trafficdb"
 	"proxyclient/internal/tray"
 	"proxyclient/internal/version"
 	"proxyclient/internal/window"
@@ -154,7 +156,9 @@ func main() {
 	}
 	defer func() { _ = syscall.CloseHandle(mutex) }()
 
-	if !isRunningAsAdmin() {
+	// В режиме без TUN хватает прав пользователя: системный прокси
+	// настраивается в HKCU, драйвер wintun не нужен.
+	if !isRunningAsAdmin() && !config.ProxyOnlyEnabled(config.DataDir+"/routing.json") {
 		exePath, _ := os.Executable()
 		cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-Command", "Start-Process -FilePath $env:SAFESKY_ELEVATE_EXE -Verb RunAs")
 		cmd.Env = append(os.Environ(), "SAFESKY_ELEVATE_EXE="+exePath)
@@ -376,6 +380,14 @@ func run(output io.Writer) error {
 		orphanCh <- orphanResult{killed}
 	}()
 
+	// Process-правила routing.json переезжают в app_rules.json синхронно:
+	// и engine, и API-сервер должны прочитать уже перенесённые файлы.
+	if n, err := config.MigrateProcessRules(cfg.DataDir+"/routing.json", cfg.AppRulesFile); err != nil {
+		app.mainLogger.Warn("Не удалось перенести process-правила в правила приложений: %v", err)
+	} else if n > 0 {
+		app.mainLogger.Info("Process-правила перенесены в правила приложений: %d", n)
+	}
+
 	// Загружаем app rules параллельно (I/O, не зависит от wintun).
 	type appRulesResult struct {
 		engine apprules.Engine
@@ -409,7 +421,8 @@ func run(output io.Writer) error {
 	// они стартуют локальный HTTP-сервер на случайном порту, браузер (с системным прокси)
 	// должен добраться до него без прокси — иначе редирект http://localhost:PORT/callback
 	// идёт через sing-box и может падать при перезапуске TUN.
-	proxyConfig := proxy.Config{Address: config.ProxyAddr, Override: api.DefaultProxyOverride}
+	// В режиме PAC (settings.proxy_auto_config) Windows получает AutoConfigURL.
+	proxyConfig := api.SystemProxyConfig()
 
 	// API сервер создаётся БЕЗ xrayManager (nil) — он будет установлен фоновой горутиной.
 	// /api/status возвращает warming=true пока менеджер не установлен.
@@ -447,6 +460,26 @@ func run(output io.Writer) error {
 	}()
 
 	app.quit = make(chan struct{})
+	authStore, err := apiauth.Open(apiauth.DefaultFile)
+	if err != nil {
+		app.mainLogger.Error("Токены API недоступны, авторизация API отключена: %v", err)
+		authStore = nil
+	}
+	historyStore, err := historydb.Open(historydb.DefaultFile)
+	if err != nil {
+		app.mainLogger.Error("История задержек недоступна: %v", err)
+		historyStore = nil
+	} else {
+		historyStore.SetRetentionDays(appSettings.History.RetentionDays)
+		historyStore.Start(app.lifecycleCtx, app.mainLogger)
+	}
+	trafficStore, err := trafficdb.Open(trafficdb.DefaultFile)
+	if err != nil {
+		app.mainLogger.Error("Учёт трафика недоступен: %v", err)
+		trafficStore = nil
+	} else {
+		trafficStore.Start(app.lifecycleCtx, app.mainLogger)
+	}
 	app.apiServer = api.NewServer(api.Config{
 		ListenAddress: cfg.APIAddress,
 		XRayManager:   nil,
@@ -456,6 +489,9 @@ func run(output io.Writer) error {
 		Logger:        app.mainLogger,
 		EventLog:      app.evLog,
 		QuitChan:      app.quit,
+		AuthStore:     authStore,
+		History:       historyStore,
+		TrafficDB:     trafficStore,
 		// Мгновенно обновляем список серверов в трее при смене сервера через UI.
 		SecretKeyUpdatedFn: func() {
 			go app.refreshTrayServers(cfg.APIAddress)
@@ -529,7 +565,7 @@ func run(output io.Writer) error {
 		app.mainLogger.Info("Трей готов, ожидаем API сервер...")
 		<-apiReady
 		app.mainLogger.Info("Открываем панель управления: %s", cfg.WebUIURL)
-		window.Open(cfg.WebUIURL)
+		window.Open(app.apiServer.UILaunchURL(cfg.WebUIURL))
 	}()
 
 	go func() {
@@ -570,7 +606,7 @@ func run(output io.Writer) error {
 
 	tray.SetProxyAddr(proxyConfig.Address)
 	// Регистрируем callback для переноса окна на передний план (двойной клик по трею).
-	tray.SetBringToFront(func() { window.BringToFront(cfg.WebUIURL) })
+	tray.SetBringToFront(func() { window.BringToFront(app.apiServer.UILaunchURL(cfg.WebUIURL)) })
 	if settings, err := config.LoadAppSettings(config.AppSettingsFile); err == nil {
 		for _, conflict := range tray.SetHotkeys(hotkeySettingsFromConfig(settings.Hotkeys)) {
 			app.mainLogger.Warn("Hotkey %s (%s) не зарегистрирован: %s", conflict.Action, conflict.Accelerator, conflict.Error)
@@ -583,7 +619,7 @@ func run(output io.Writer) error {
 	// → close(уже закрытого канала) → panic: close of closed channel.
 	var trayQuitOnce sync.Once
 	tray.Run(tray.Callbacks{
-		OnOpen: func() { window.BringToFront(cfg.WebUIURL) },
+		OnOpen: func() { window.BringToFront(app.apiServer.UILaunchURL(cfg.WebUIURL)) },
 		OnCopyAddr: func(addr string) {
 			if addr == "" {
 				return
@@ -595,7 +631,7 @@ func run(output io.Writer) error {
 				notification.Send("SafeSky", "Инициализация... подождите")
 				return
 			}
-			if err := app.proxyManager.Enable(proxyConfig); err != nil {
+			if err := app.proxyManager.Enable(api.SystemProxyConfig()); err != nil {
 				app.mainLogger.Error("Ошибка включения прокси: %v", err)
 				tray.Notify("SafeSky", "Failed to connect: "+err.Error(), tray.NotificationError)
 				telemetryMgr.Record(telemetry.Event{Type: "connect_failed", Code: "PROXY_ENABLE_FAILED", Stage: "proxy"})
@@ -681,7 +717,7 @@ func (a *App) refreshTrayServers(apiAddress string) {
 	}
 
 	url := apiBaseURL(apiAddress) + "/api/servers"
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := a.apiServer.LocalClient(5 * time.Second)
 	resp, err := client.Get(url)
 	if err != nil {
 		a.mainLogger.Warn("Не удалось получить список серверов из API: %v", err)
@@ -725,7 +761,7 @@ func (a *App) refreshTrayServers(apiAddress string) {
 }
 
 func (a *App) refreshTrayProfiles(apiAddress string) {
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := a.apiServer.LocalClient(5 * time.Second)
 	resp, err := client.Get(apiBaseURL(apiAddress) + "/api/profiles")
 	if err != nil {
 		a.mainLogger.Warn("Не удалось получить профили из API: %v", err)
@@ -762,7 +798,7 @@ func (a *App) refreshTrayTrafficSpeed(apiAddress string) {
 	if err != nil {
 		return
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := a.apiServer.LocalClient(0).Do(req)
 	if err != nil {
 		return
 	}
@@ -845,7 +881,7 @@ func (a *App) connectTrayServer(apiAddress, serverID string) error {
 	if err != nil {
 		return err
 	}
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := a.apiServer.LocalClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
@@ -858,7 +894,7 @@ func (a *App) connectTrayServer(apiAddress, serverID string) error {
 }
 
 func (a *App) connectNextTrayServer(apiAddress string) error {
-	list, activeID, err := fetchTrayServers(apiAddress)
+	list, activeID, err := fetchTrayServers(a.apiServer.LocalClient(5*time.Second), apiAddress)
 	if err != nil {
 		return err
 	}
@@ -880,7 +916,7 @@ func (a *App) applyProfileByIndex(apiAddress string, index int) error {
 		return fmt.Errorf("invalid profile index %d", index)
 	}
 	reqURL := apiBaseURL(apiAddress) + "/api/profiles"
-	client := &http.Client{Timeout: 5 * time.Second}
+	client := a.apiServer.LocalClient(5 * time.Second)
 	resp, err := client.Get(reqURL)
 	if err != nil {
 		return err
@@ -927,12 +963,11 @@ type trayServerSummary struct {
 	URL  string
 }
 
-func fetchTrayServers(apiAddress string) ([]trayServerSummary, string, error) {
+func fetchTrayServers(client *http.Client, apiAddress string) ([]trayServerSummary, string, error) {
 	var body struct {
 		Servers  []trayServerSummary `json:"servers"`
 		ActiveID string              `json:"active_id"`
 	}
-	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Get(apiBaseURL(apiAddress) + "/api/servers")
 	if err != nil {
 		return nil, "", err
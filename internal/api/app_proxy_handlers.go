@@ -3,11 +3,13 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 
 	"proxyclient/internal/apprules"
+	"proxyclient/internal/config"
 	"proxyclient/internal/process"
 
 	"github.com/gorilla/mux"
@@ -31,6 +33,7 @@ func (s *Server) SetupAppProxyRoutes(engine apprules.Engine, monitor process.Mon
 		launcher: launcher,
 		server:   s,
 	}
+	s.appRules = engine
 	api := s.router.PathPrefix("/api").Subrouter()
 
 	// Rules management
@@ -66,6 +69,12 @@ type CreateRuleRequest struct {
 	ProxyAddr string          `json:"proxy_addr,omitempty"`
 	Priority  int             `json:"priority"`
 	Enabled   bool            `json:"enabled"`
+	// InboundPort, Server, Group — выделенный порт правила PROXY и его маршрут.
+	InboundPort int    `json:"inbound_port,omitempty"`
+	Server      string `json:"server,omitempty"`
+	Group       string `json:"group,omitempty"`
+	// Exact — имя совпадает только целиком (см. apprules.Rule.Exact).
+	Exact bool `json:"exact,omitempty"`
 }
 
 type LaunchRequest struct {
@@ -91,6 +100,47 @@ type MatchResponse struct {
 	Rule    *apprules.Rule `json:"rule,omitempty"`
 }
 
+// validateTarget проверяет выделенный порт и цель правила по состоянию
+// клиента: порт не должен совпадать с собственными портами, а сервер и
+// группа — существовать. Остальное проверяет apprules.
+func (h *AppProxyHandlers) validateTarget(rule apprules.Rule) error {
+	if rule.InboundPort == 0 && rule.Server == "" && rule.Group == "" {
+		return nil
+	}
+	var routing *config.RoutingConfig
+	if th := h.server.tunHandlers; th != nil {
+		th.mu.RLock()
+		routing = cloneRoutingConfig(th.routing)
+		th.mu.RUnlock()
+	}
+	if rule.InboundPort != 0 && config.IsReservedLocalPort(rule.InboundPort, routing) {
+		return fmt.Errorf("порт %d занят самим клиентом", rule.InboundPort)
+	}
+	if rule.Group != "" {
+		found := false
+		if routing != nil {
+			_, found = routing.FindGroup(rule.Group)
+		}
+		if !found {
+			return fmt.Errorf("группа %q не найдена", rule.Group)
+		}
+	}
+	return validateRuleServer(config.ActionProxy, rule.Server)
+}
+
+// applyRules перегенерирует конфиг sing-box после изменения правил: каждое
+// правило приложения — process-правило route, а PROXY-правила с портом ещё
+// и inbound'ы. Всё это берётся из app_rules.json.
+func (h *AppProxyHandlers) applyRules() {
+	th := h.server.tunHandlers
+	if th == nil {
+		return
+	}
+	if err := th.TriggerApply(); err != nil {
+		h.server.logger.Warn("App rules: не удалось применить правила приложений: %v", err)
+	}
+}
+
 // Rules handlers
 
 func (h *AppProxyHandlers) handleListRules(w http.ResponseWriter, r *http.Request) {
@@ -119,12 +169,20 @@ func (h *AppProxyHandlers) handleCreateRule(w http.ResponseWriter, r *http.Reque
 	}
 
 	rule := apprules.Rule{
-		Name:      req.Name,
-		Pattern:   req.Pattern,
-		Action:    req.Action,
-		ProxyAddr: req.ProxyAddr,
-		Priority:  req.Priority,
-		Enabled:   req.Enabled,
+		Name:        req.Name,
+		Pattern:     req.Pattern,
+		Action:      req.Action,
+		ProxyAddr:   req.ProxyAddr,
+		Priority:    req.Priority,
+		Enabled:     req.Enabled,
+		InboundPort: req.InboundPort,
+		Server:      req.Server,
+		Group:       req.Group,
+		Exact:       req.Exact,
+	}
+	if err := h.validateTarget(rule); err != nil {
+		h.server.respondError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	created, err := h.engine.AddRule(rule)
@@ -132,6 +190,7 @@ func (h *AppProxyHandlers) handleCreateRule(w http.ResponseWriter, r *http.Reque
 		h.server.respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	h.applyRules()
 
 	h.server.respondJSON(w, http.StatusCreated, created)
 }
@@ -171,12 +230,20 @@ func (h *AppProxyHandlers) handleUpdateRule(w http.ResponseWriter, r *http.Reque
 	}
 
 	rule := apprules.Rule{
-		Name:      req.Name,
-		Pattern:   req.Pattern,
-		Action:    req.Action,
-		ProxyAddr: req.ProxyAddr,
-		Priority:  req.Priority,
-		Enabled:   req.Enabled,
+		Name:        req.Name,
+		Pattern:     req.Pattern,
+		Action:      req.Action,
+		ProxyAddr:   req.ProxyAddr,
+		Priority:    req.Priority,
+		Enabled:     req.Enabled,
+		InboundPort: req.InboundPort,
+		Server:      req.Server,
+		Group:       req.Group,
+		Exact:       req.Exact,
+	}
+	if err := h.validateTarget(rule); err != nil {
+		h.server.respondError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	updated, err := h.engine.UpdateRule(id, rule)
@@ -184,6 +251,7 @@ func (h *AppProxyHandlers) handleUpdateRule(w http.ResponseWriter, r *http.Reque
 		h.server.respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	h.applyRules()
 
 	h.server.respondJSON(w, http.StatusOK, updated)
 }
@@ -196,6 +264,7 @@ func (h *AppProxyHandlers) handleDeleteRule(w http.ResponseWriter, r *http.Reque
 		h.server.respondError(w, http.StatusNotFound, err.Error())
 		return
 	}
+	h.applyRules()
 
 	h.server.respondJSON(w, http.StatusOK, MessageResponse{
 		Message: "Rule deleted successfully",
@@ -210,6 +279,7 @@ func (h *AppProxyHandlers) handleEnableRule(w http.ResponseWriter, r *http.Reque
 		h.server.respondError(w, http.StatusNotFound, err.Error())
 		return
 	}
+	h.applyRules()
 
 	h.server.respondJSON(w, http.StatusOK, MessageResponse{
 		Message: "Rule enabled successfully",
@@ -224,6 +294,7 @@ func (h *AppProxyHandlers) handleDisableRule(w http.ResponseWriter, r *http.Requ
 		h.server.respondError(w, http.StatusNotFound, err.Error())
 		return
 	}
+	h.applyRules()
 
 	h.server.respondJSON(w, http.StatusOK, MessageResponse{
 		Message: "Rule disabled successfully",
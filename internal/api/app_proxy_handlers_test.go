@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 
+	"proxyclient/internal/apprules"
+	"proxyclient/internal/config"
 	"proxyclient/internal/logger"
 )
 
@@ -111,3 +113,35 @@ func TestHandleMatchRuleRejectsOversizedBody(t *testing.T) {
 		t.Fatalf("status=%d body=%s, want 400", w.Code, w.Body.String())
 	}
 }
+
+func TestHandleCreateRuleValidatesInboundPort(t *testing.T) {
+	srv, th, cleanup := buildTunServer(t)
+	defer cleanup()
+	th.mu.Lock()
+	th.routing.Groups = []config.ServerGroup{{ID: "auto", Name: "Auto", Type: config.GroupTypeURLTest}}
+	th.mu.Unlock()
+	h := &AppProxyHandlers{server: srv, engine: apprules.NewEngine()}
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.handleCreateRule(w, httptest.NewRequest(http.MethodPost, "/api/apps/rules", strings.NewReader(body)))
+		return w
+	}
+	for _, body := range []string{
+		`{"name":"a","pattern":"a.exe","action":"PROXY","enabled":true,"inbound_port":10807}`,
+		`{"name":"a","pattern":"a.exe","action":"PROXY","enabled":true,"inbound_port":10820,"group":"missing"}`,
+		`{"name":"a","pattern":"a.exe","action":"PROXY","enabled":true,"inbound_port":10820,"server":"missing"}`,
+	} {
+		if w := create(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d, want 400", body, w.Code)
+		}
+	}
+	w := create(`{"name":"a","pattern":"a.exe","action":"PROXY","enabled":true,"inbound_port":10820,"group":"auto"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status=%d body=%s, want 201", w.Code, w.Body.String())
+	}
+	rules := h.engine.ListRules()
+	if len(rules) != 1 || rules[0].InboundPort != 10820 || rules[0].Group != "auto" || rules[0].LaunchProxyAddr() != "127.0.0.1:10820" {
+		t.Fatalf("rules = %+v", rules)
+	}
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"proxyclient/internal/apiauth"
+)
+
+// Авторизация API опциональна: пока она выключена, middleware пропускает всё,
+// как раньше. Встроенный UI получает токен через cookie: окно приложения
+// открывается по одноразовой ссылке /?auth=<nonce>, которую знает только
+// процесс SafeSky. Трей и прочие внутренние вызовы используют LocalClient.
+
+const (
+	apiAuthCookie  = "safesky_api"
+	uiLaunchParam  = "auth"
+	uiLaunchTTL    = 2 * time.Minute
+	maxTokenName   = 64
+	maxAuthReqBody = 4 << 10
+)
+
+// uiLaunchNonces — одноразовые ссылки запуска окна UI.
+type uiLaunchNonces struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func (n *uiLaunchNonces) issue() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := hex.EncodeToString(b)
+	now := time.Now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.nonces == nil {
+		n.nonces = make(map[string]time.Time)
+	}
+	for k, exp := range n.nonces {
+		if now.After(exp) {
+			delete(n.nonces, k)
+		}
+	}
+	n.nonces[nonce] = now.Add(uiLaunchTTL)
+	return nonce, nil
+}
+
+func (n *uiLaunchNonces) consume(nonce string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	exp, ok := n.nonces[nonce]
+	if !ok {
+		return false
+	}
+	delete(n.nonces, nonce)
+	return time.Now().Before(exp)
+}
+
+// requiredScope возвращает уровень доступа, нужный для запроса.
+// false — запрос не требует токена (статика UI, health, статус авторизации).
+func requiredScope(method, path string) (apiauth.Scope, bool) {
+	switch {
+	case path == "/api/health" || path == "/api/auth/status":
+		return "", false
+	case strings.HasPrefix(path, "/api/auth/"),
+		path == "/api/backup" || strings.HasPrefix(path, "/api/backup/"),
+		strings.HasPrefix(path, "/debug/"):
+		// Токены, резервные копии (содержат ключи серверов) и pprof — только admin.
+		return apiauth.ScopeAdmin, true
+	case !strings.HasPrefix(path, "/api/"):
+		return "", false
+	case (method == http.MethodGet || method == http.MethodHead) && exposesCredentials(path):
+		return apiauth.ScopeAdmin, true
+	case method == http.MethodGet || method == http.MethodHead:
+		return apiauth.ScopeRead, true
+	default:
+		return apiauth.ScopeMutate, true
+	}
+}
+
+// exposesCredentials — GET-эндпоинты, ответ которых содержит URI серверов с
+// ключами или пароли: список серверов и QR, профили и их экспорт, конфиг
+// sing-box, ссылка из буфера обмена, правила с логинами раздачи в LAN и их
+// экспорт. Read-токену они недоступны.
+func exposesCredentials(path string) bool {
+	switch path {
+	case "/api/servers", "/api/singbox-config", "/api/clipboard/vless",
+		"/api/tun/rules", "/api/tun/export":
+		return true
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/servers/"); ok {
+		return strings.HasSuffix(rest, "/qr")
+	}
+	if rest, ok := strings.CutPrefix(path, "/api/profiles/"); ok {
+		name, sub, nested := strings.Cut(rest, "/")
+		return name != "builtins" && (!nested || sub == "export")
+	}
+	return false
+}
+
+// requestToken достаёт токен из Authorization: Bearer или из cookie UI.
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+			return strings.TrimSpace(h[7:])
+		}
+		return ""
+	}
+	if c, err := r.Cookie(apiAuthCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// authMiddleware проверяет токен и его scope, если авторизация включена.
+// Стоит до rateLimitMiddleware: запросы без токена не расходуют общий лимит.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store := s.config.AuthStore
+		if store == nil || !store.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		need, ok := requiredScope(r.Method, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tok, ok := store.Authenticate(requestToken(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="safesky"`)
+			s.respondError(w, http.StatusUnauthorized, "требуется токен API")
+			return
+		}
+		if !tok.Scope.Allows(need) {
+			s.respondError(w, http.StatusForbidden, "недостаточно прав токена: нужен scope "+string(need))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UILaunchURL возвращает адрес для открытия окна UI. Если хранилище токенов
+// подключено, к адресу добавляется одноразовый nonce, который при первом
+// открытии обменивается на cookie с токеном UI.
+func (s *Server) UILaunchURL(base string) string {
+	if s.config.AuthStore == nil {
+		return base
+	}
+	nonce, err := s.uiLaunch.issue()
+	if err != nil {
+		s.logger.Warn("UILaunchURL: %v", err)
+		return base
+	}
+	return strings.TrimRight(base, "/") + "/?" + uiLaunchParam + "=" + nonce
+}
+
+// uiLaunchHandler обменивает nonce из UILaunchURL на cookie и убирает его из адреса.
+// Cookie ставится и при выключенной авторизации — чтобы её включение из UI
+// не отрезало уже открытое окно.
+func (s *Server) uiLaunchHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := r.URL.Query().Get(uiLaunchParam)
+		if nonce == "" || r.URL.Path != "/" || s.config.AuthStore == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.uiLaunch.consume(nonce) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     apiAuthCookie,
+				Value:    s.config.AuthStore.UIToken(),
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+		} else {
+			s.logger.Warn("UI: недействительная ссылка запуска")
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+}
+
+// authTransport добавляет токен UI ко всем запросам внутреннего клиента.
+type authTransport struct {
+	base  http.RoundTripper
+	token func() string
+}
+
+func (t *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if tok := t.token(); tok != "" {
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "Bearer "+tok)
+	}
+	return t.base.RoundTrip(r)
+}
+
+// LocalClient возвращает HTTP-клиент для вызовов собственного API из процесса
+// приложения (трей, фоновые задачи). Запросы подписываются токеном UI.
+func (s *Server) LocalClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &authTransport{
+			base: http.DefaultTransport,
+			token: func() string {
+				if s.config.AuthStore == nil {
+					return ""
+				}
+				return s.config.AuthStore.UIToken()
+			},
+		},
+	}
+}
+
+// SetupAuthRoutes регистрирует управление токенами. Без хранилища токенов
+// (Config.AuthStore == nil) маршруты не регистрируются.
+func SetupAuthRoutes(s *Server) {
+	if s.config.AuthStore == nil {
+		return
+	}
+	api := s.router.PathPrefix("/api/auth").Subrouter()
+	api.HandleFunc("/status", s.handleAuthStatus).Methods("GET", "OPTIONS")
+	api.HandleFunc("/enabled", s.handleAuthSetEnabled).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/tokens", s.handleAuthListTokens).Methods("GET", "OPTIONS")
+	api.HandleFunc("/tokens", s.handleAuthCreateToken).Methods("POST", "OPTIONS")
+	api.HandleFunc("/tokens/{id}", s.handleAuthRevokeToken).Methods("DELETE", "OPTIONS")
+}
+
+// handleAuthStatus GET /api/auth/status — доступен без токена, чтобы клиент
+// мог узнать, нужен ли он, и проверить свой.
+func (s *Server) handleAuthStatus(w http.ResponseWriter, r *http.Request) {
+	store := s.config.AuthStore
+	resp := map[string]interface{}{"enabled": store.Enabled()}
+	if tok, ok := store.Authenticate(requestToken(r)); ok {
+		resp["authenticated"] = true
+		resp["scope"] = tok.Scope
+		resp["token_id"] = tok.ID
+	} else {
+		resp["authenticated"] = false
+	}
+	s.respondJSON(w, http.StatusOK, resp)
+}
+
+// handleAuthSetEnabled PUT /api/auth/enabled
+func (s *Server) handleAuthSetEnabled(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if !s.decodeAuthRequest(w, r, &req) {
+		return
+	}
+	if err := s.config.AuthStore.SetEnabled(req.Enabled); err != nil {
+		s.logger.Error("handleAuthSetEnabled: %v", err)
+		s.respondError(w, http.StatusInternalServerError, "не удалось сохранить настройку")
+		return
+	}
+	s.respondJSON(w, http.StatusOK, map[string]bool{"enabled": req.Enabled})
+}
+
+// handleAuthListTokens GET /api/auth/tokens
+func (s *Server) handleAuthListTokens(w http.ResponseWriter, _ *http.Request) {
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"tokens": s.config.AuthStore.List()})
+}
+
+// handleAuthCreateToken POST /api/auth/tokens — секрет возвращается один раз.
+func (s *Server) handleAuthCreateToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name  string        `json:"name"`
+		Scope apiauth.Scope `json:"scope"`
+	}
+	if !s.decodeAuthRequest(w, r, &req) {
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxTokenName {
+		s.respondError(w, http.StatusBadRequest, "name: от 1 до 64 символов")
+		return
+	}
+	if !apiauth.IsValidScope(req.Scope) {
+		s.respondError(w, http.StatusBadRequest, "scope: read | mutate | admin")
+		return
+	}
+	tok, secret, err := s.config.AuthStore.Create(name, req.Scope)
+	if err != nil {
+		s.logger.Error("handleAuthCreateToken: %v", err)
+		s.respondError(w, http.StatusInternalServerError, "не удалось создать токен")
+		return
+	}
+	s.respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"token":  tok,
+		"secret": secret,
+	})
+}
+
+// handleAuthRevokeToken DELETE /api/auth/tokens/{id}
+func (s *Server) handleAuthRevokeToken(w http.ResponseWriter, r *http.Request) {
+	err := s.config.AuthStore.Revoke(mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, apiauth.ErrNotFound):
+		s.respondError(w, http.StatusNotFound, "токен не найден")
+	case errors.Is(err, apiauth.ErrUIToken):
+		s.respondError(w, http.StatusConflict, "токен UI нельзя отозвать")
+	case err != nil:
+		s.logger.Error("handleAuthRevokeToken: %v", err)
+		s.respondError(w, http.StatusInternalServerError, "не удалось отозвать токен")
+	default:
+		s.respondJSON(w, http.StatusOK, MessageResponse{Success: true, Message: "токен отозван"})
+	}
+}
+
+// decodeAuthRequest разбирает JSON-тело строго: неизвестные поля и мусор после
+// объекта — 400.
+func (s *Server) decodeAuthRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAuthReqBody)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid body")
+		return false
+	}
+	var extra struct{}
+	if err := dec.Decode(&extra); !errors.Is(err, io.EOF) {
+		s.respondError(w, http.StatusBadRequest, "invalid body")
+		return false
+	}
+	return true
+}
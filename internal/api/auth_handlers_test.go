@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"proxyclient/internal/apiauth"
+	"proxyclient/internal/logger"
+)
+
+func newAuthServer(t *testing.T) (*Server, *apiauth.Store) {
+	t.Helper()
+	store, err := apiauth.Open(filepath.Join(t.TempDir(), "api_auth.json"))
+	if err != nil {
+		t.Fatalf("apiauth.Open: %v", err)
+	}
+	s := NewServer(Config{Logger: &logger.NoOpLogger{}, AuthStore: store}, context.Background())
+	s.FinalizeRoutes()
+	return s, store
+}
+
+func serveWithToken(s *Server, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthMiddleware_DisabledPassesThrough(t *testing.T) {
+	s, _ := newAuthServer(t)
+	if rec := serveWithToken(s, http.MethodPost, "/api/events/clear", ""); rec.Code != http.StatusOK {
+		t.Fatalf("disabled auth: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestAuthMiddleware_EnforcesScopes(t *testing.T) {
+	s, store := newAuthServer(t)
+	if err := store.SetEnabled(true); err != nil {
+		t.Fatalf("SetEnabled: %v", err)
+	}
+	_, readSecret, err := store.Create("monitor", apiauth.ScopeRead)
+	if err != nil {
+		t.Fatalf("Create read: %v", err)
+	}
+	_, mutateSecret, err := store.Create("script", apiauth.ScopeMutate)
+	if err != nil {
+		t.Fatalf("Create mutate: %v", err)
+	}
+
+	cases := []struct {
+		name, method, path, token string
+		want                      int
+	}{
+		{"no token", http.MethodGet, "/api/events", "", http.StatusUnauthorized},
+		{"bad token", http.MethodGet, "/api/events", "sst_nope", http.StatusUnauthorized},
+		{"health is public", http.MethodGet, "/api/health", "", http.StatusOK},
+		{"auth status is public", http.MethodGet, "/api/auth/status", "", http.StatusOK},
+		{"read GET", http.MethodGet, "/api/events", readSecret, http.StatusOK},
+		{"read POST", http.MethodPost, "/api/events/clear", readSecret, http.StatusForbidden},
+		{"mutate POST", http.MethodPost, "/api/events/clear", mutateSecret, http.StatusOK},
+		{"mutate tokens", http.MethodGet, "/api/auth/tokens", mutateSecret, http.StatusForbidden},
+		{"ui tokens", http.MethodGet, "/api/auth/tokens", store.UIToken(), http.StatusOK},
+		{"read servers", http.MethodGet, "/api/servers", readSecret, http.StatusForbidden},
+		{"mutate servers", http.MethodGet, "/api/servers", mutateSecret, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if rec := serveWithToken(s, c.method, c.path, c.token); rec.Code != c.want {
+				t.Errorf("%s %s: status = %d, want %d (%s)", c.method, c.path, rec.Code, c.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+// GET-ответы с URI серверов требуют admin, остальное чтение — read.
+func TestRequiredScope_CredentialsNeedAdmin(t *testing.T) {
+	cases := []struct {
+		method, path string
+		want         apiauth.Scope
+	}{
+		{http.MethodGet, "/api/servers", apiauth.ScopeAdmin},
+		{http.MethodHead, "/api/servers", apiauth.ScopeAdmin},
+		{http.MethodGet, "/api/servers/abc/qr", apiauth.ScopeAdmin},
+		{http.MethodGet, "/api/profiles/work", apiauth.ScopeAdmin},
+		{http.MethodGet, "/api/profiles/work/export", apiauth.ScopeAdmin},
+		{http.MethodGet, "/api/singbox-config", apiauth.ScopeAdmin},
+		{http.MethodGet, "/api/clipboard/vless", apiauth.ScopeAdmin},
+		{http.MethodGet, "/api/tun/rules", apiauth.ScopeAdmin},
+		{http.MethodGet, "/api/tun/export", apiauth.ScopeAdmin},
+		{http.MethodGet, "/api/tun/rules/analyze", apiauth.ScopeRead},
+		{http.MethodGet, "/api/servers/health", apiauth.ScopeRead},
+		{http.MethodGet, "/api/servers/abc/ping", apiauth.ScopeRead},
+		{http.MethodGet, "/api/profiles", apiauth.ScopeRead},
+		{http.MethodGet, "/api/profiles/builtins", apiauth.ScopeRead},
+		{http.MethodPost, "/api/servers", apiauth.ScopeMutate},
+	}
+	for _, c := range cases {
+		if got, ok := requiredScope(c.method, c.path); !ok || got != c.want {
+			t.Errorf("requiredScope(%s %s) = %q, %v; want %q", c.method, c.path, got, ok, c.want)
+		}
+	}
+}
+
+func TestUILaunchURL_ExchangesNonceForCookie(t *testing.T) {
+	s, store := newAuthServer(t)
+	if err := store.SetEnabled(true); err != nil {
+		t.Fatalf("SetEnabled: %v", err)
+	}
+	launch := s.UILaunchURL("http://127.0.0.1:8080")
+	u, err := url.Parse(launch)
+	if err != nil || u.Query().Get(uiLaunchParam) == "" {
+		t.Fatalf("UILaunchURL = %q", launch)
+	}
+
+	rec := serveWithToken(s, http.MethodGet, u.RequestURI(), "")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("launch: status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != apiAuthCookie || !cookies[0].HttpOnly {
+		t.Fatalf("launch cookies = %+v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/events", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("cookie auth: status = %d, want 200", rec.Code)
+	}
+
+	// Nonce одноразовый: повторное открытие ссылки cookie не выдаёт.
+	rec = serveWithToken(s, http.MethodGet, u.RequestURI(), "")
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("reused launch nonce must not set a cookie")
+	}
+}
+
+func TestAuthTokenEndpoints(t *testing.T) {
+	s, store := newAuthServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/tokens", strings.NewReader(`{"name":"backup","scope":"read"}`))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Token  apiauth.Token `json:"token"`
+		Secret string        `json:"secret"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode create: %v", err)
+	}
+	if created.Secret == "" || created.Token.Scope != apiauth.ScopeRead {
+		t.Fatalf("created = %+v", created)
+	}
+
+	rec = serveWithToken(s, http.MethodGet, "/api/auth/tokens", "")
+	if strings.Contains(rec.Body.String(), created.Secret) {
+		t.Error("token list must not expose secrets")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/tokens", strings.NewReader(`{"name":"x","scope":"root"}`))
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid scope: status = %d, want 400", rec.Code)
+	}
+
+	ui, _ := store.Authenticate(store.UIToken())
+	if rec := serveWithToken(s, http.MethodDelete, "/api/auth/tokens/"+ui.ID, ""); rec.Code != http.StatusConflict {
+		t.Errorf("revoke UI token: status = %d, want 409", rec.Code)
+	}
+	if rec := serveWithToken(s, http.MethodDelete, "/api/auth/tokens/"+created.Token.ID, ""); rec.Code != http.StatusOK {
+		t.Errorf("revoke: status = %d, want 200", rec.Code)
+	}
+	if _, ok := store.Authenticate(created.Secret); ok {
+		t.Error("revoked token still authenticates")
+	}
+}
+
+func TestLocalClient_SendsUIToken(t *testing.T) {
+	s, store := newAuthServer(t)
+	if err := store.SetEnabled(true); err != nil {
+		t.Fatalf("SetEnabled: %v", err)
+	}
+	ts := httptest.NewServer(s.router)
+	defer ts.Close()
+
+	resp, err := s.LocalClient(0).Get(ts.URL + "/api/events")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("LocalClient status = %d, want 200", resp.StatusCode)
+	}
+}
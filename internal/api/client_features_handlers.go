@@ -19,6 +19,7 @@ import (
 	"sync"
 	"time"
 
+	"proxyclient/internal/apprules"
 	"proxyclient/internal/config"
 	"proxyclient/internal/connhistory"
 	"proxyclient/internal/netwatch"
@@ -122,7 +123,7 @@ func (s *Server) mutateRoutingSnapshot(mutator func(*config.RoutingConfig) (bool
 
 func (s *Server) handleRuleAnalyze(w http.ResponseWriter, _ *http.Request) {
 	routing := s.currentRoutingSnapshot()
-	findings := analyzeRoutingRules(routing)
+	findings := analyzeRoutingRules(routing, s.currentAppRules())
 	s.respondJSON(w, http.StatusOK, map[string]interface{}{
 		"ok":       len(findings) == 0,
 		"count":    len(findings),
@@ -149,11 +150,35 @@ func (s *Server) handleRuleAnalyzeFix(w http.ResponseWriter, _ *http.Request) {
 	})
 }
 
-func analyzeRoutingRules(routing *config.RoutingConfig) []clientRuleFinding {
+// currentAppRules — правила приложений: из движка SetupAppProxyRoutes, а без
+// него из app_rules.json. Нечитаемый файл — пустой список.
+func (s *Server) currentAppRules() []apprules.Rule {
+	if s.appRules != nil {
+		return s.appRules.ListRules()
+	}
+	rules, err := apprules.NewFileStorage(config.AppRulesFile).Load()
+	if err != nil {
+		return nil
+	}
+	return rules
+}
+
+// analyzeRoutingRules проверяет правила routing.json; appRules нужны для
+// needs_tun: process-правила живут в правилах приложений.
+func analyzeRoutingRules(routing *config.RoutingConfig, appRules []apprules.Rule) []clientRuleFinding {
 	if routing == nil {
 		return nil
 	}
 	var findings []clientRuleFinding
+	if routing.ProxyOnly {
+		// Правило с выделенным портом работает и без TUN: приложение ходит
+		// через свой inbound, определять процесс не нужно.
+		for _, r := range appRules {
+			if r.Enabled && r.Pattern != "" && !r.HasDedicatedInbound() {
+				findings = append(findings, clientRuleFinding{Severity: "warn", Code: "needs_tun", Value: r.Pattern, Message: "правило приложения не работает без TUN"})
+			}
+		}
+	}
 	seen := map[string]int{}
 	processBeforeDirect := false
 	for i, rule := range routing.Rules {
@@ -186,9 +211,31 @@ func analyzeRoutingRules(routing *config.RoutingConfig) []clientRuleFinding {
 				findings = append(findings, clientRuleFinding{Severity: "warn", Code: "missing_geosite", Index: i, Value: rule.Value, Message: "geosite база не скачана"})
 			}
 		}
-		if rule.Type == config.RuleTypeProcess {
+		if rule.Type == config.RuleTypeGeoIP {
+			code := strings.TrimPrefix(value, "geoip:")
+			if _, err := os.Stat(filepath.Join(config.DataDir, "geoip-"+code+".bin")); code != "" && os.IsNotExist(err) {
+				findings = append(findings, clientRuleFinding{Severity: "warn", Code: "missing_geoip", Index: i, Value: rule.Value, Message: "geoip база не скачана"})
+			}
+		}
+		if rule.Type == config.RuleTypeRuleSet {
+			if rs, ok := routing.FindRuleSet(strings.TrimPrefix(value, "ruleset:")); !ok {
+				findings = append(findings, clientRuleFinding{Severity: "error", Code: "unknown_ruleset", Index: i, Value: rule.Value, Message: "rule-set не объявлен"})
+			} else if !config.RemoteRuleSetUsable(rs) {
+				findings = append(findings, clientRuleFinding{Severity: "warn", Code: "missing_ruleset", Index: i, Value: rule.Value, Message: "rule-set ещё не скачан"})
+			}
+		}
+		if config.IsProcessRuleType(rule.Type) {
 			processBeforeDirect = true
 		}
+		if routing.ProxyOnly {
+			// Без TUN приложение определяется только у соединений через локальный
+			// прокси, а UDP приходит лишь от приложений с SOCKS5 (mixed inbound).
+			if config.IsProcessRuleType(rule.Type) {
+				findings = append(findings, clientRuleFinding{Severity: "warn", Code: "needs_tun", Index: i, Value: rule.Value, Message: "process-правило не работает без TUN"})
+			} else if rule.Type == config.RuleTypeNetwork && value == "network:udp" {
+				findings = append(findings, clientRuleFinding{Severity: "warn", Code: "needs_tun", Index: i, Value: rule.Value, Message: "UDP без TUN проходит только через SOCKS5"})
+			}
+		}
 		if processBeforeDirect && rule.Type == config.RuleTypeDomain && rule.Action == config.ActionDirect {
 			findings = append(findings, clientRuleFinding{
 				Severity: "warn", Code: "shadowed_direct", Index: i, Value: rule.Value, Fixable: true,
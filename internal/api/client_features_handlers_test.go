@@ -4,12 +4,15 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 
+	"proxyclient/internal/apprules"
+	"proxyclient/internal/config"
 	"proxyclient/internal/logger"
 )
 
@@ -103,3 +106,82 @@ func TestNetworkChangeTrackerConcurrentNoRace(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+// --- analyzeRoutingRules ---
+
+func TestAnalyzeRoutingRulesReportsTunOnlyRulesInProxyOnlyMode(t *testing.T) {
+	routing := &config.RoutingConfig{
+		DefaultAction: config.ActionProxy,
+		Rules: []config.RoutingRule{
+			{Value: "telegram.exe", Type: config.RuleTypeProcess, Action: config.ActionProxy},
+			{Value: "network:udp", Type: config.RuleTypeNetwork, Action: config.ActionDirect},
+			{Value: "network:tcp", Type: config.RuleTypeNetwork, Action: config.ActionDirect},
+		},
+	}
+	needsTun := func() []int {
+		var idx []int
+		for _, f := range analyzeRoutingRules(routing, nil) {
+			if f.Code == "needs_tun" {
+				idx = append(idx, f.Index)
+			}
+		}
+		return idx
+	}
+	if got := needsTun(); len(got) != 0 {
+		t.Fatalf("TUN mode reported %v", got)
+	}
+	routing.ProxyOnly = true
+	if got := needsTun(); len(got) != 2 || got[0] != 0 || got[1] != 1 {
+		t.Fatalf("proxy-only findings = %v, want [0 1]", got)
+	}
+}
+
+func TestAnalyzeRoutingRulesReportsMigratedProcessRulesInProxyOnlyMode(t *testing.T) {
+	dir := t.TempDir()
+	routingPath := filepath.Join(dir, "routing.json")
+	appRulesPath := filepath.Join(dir, "app_rules.json")
+	routing := &config.RoutingConfig{
+		DefaultAction: config.ActionProxy,
+		ProxyOnly:     true,
+		Rules: []config.RoutingRule{
+			{Value: "telegram.exe", Type: config.RuleTypeProcess, Action: config.ActionProxy},
+			{Value: "example.com", Type: config.RuleTypeDomain, Action: config.ActionDirect},
+		},
+	}
+	if err := config.SaveRoutingConfig(routingPath, routing); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := config.MigrateProcessRules(routingPath, appRulesPath); err != nil || n != 1 {
+		t.Fatalf("MigrateProcessRules = %d, %v", n, err)
+	}
+	migrated, err := config.LoadRoutingConfig(routingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appRules, err := apprules.NewFileStorage(appRulesPath).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Выключенное правило и правило с выделенным портом TUN не требуют.
+	appRules = append(appRules,
+		apprules.Rule{Pattern: "steam.exe", Action: apprules.ActionDirect},
+		apprules.Rule{Pattern: "firefox.exe", Action: apprules.ActionProxy, Enabled: true, InboundPort: 10820},
+	)
+
+	var got []string
+	for _, f := range analyzeRoutingRules(migrated, appRules) {
+		if f.Code == "needs_tun" {
+			got = append(got, f.Value)
+		}
+	}
+	if len(got) != 1 || got[0] != "telegram.exe" {
+		t.Fatalf("needs_tun = %v, want [telegram.exe]", got)
+	}
+
+	migrated.ProxyOnly = false
+	for _, f := range analyzeRoutingRules(migrated, appRules) {
+		if f.Code == "needs_tun" {
+			t.Errorf("TUN mode reported %+v", f)
+		}
+	}
+}
@@ -59,11 +59,21 @@ func (h *DiagHandlers) start(ctx context.Context) {
 // SetupDiagRoutes регистрирует маршруты диагностики и запускает сборщики данных.
 func SetupDiagRoutes(s *Server, ctx context.Context) {
 	h := newDiagHandlers()
+	h.traffic.onSnapshot = func(snap trafficSnapshot) {
+		s.stream.publish(streamTypeTraffic, snap)
+	}
+	if store := s.config.TrafficDB; store != nil {
+		h.conns.onConns = func(snap clashConnections) {
+			store.Observe(trafficDBSnapshot(snap))
+		}
+	}
 	h.start(ctx)
 	s.router.HandleFunc("/api/stats", h.handleStats).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/debug/stats", h.handleDebugStats).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/connections", h.handleConnections).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/traffic/by-process", h.handleTrafficByProcess).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/api/traffic/usage", s.handleTrafficUsage).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/api/traffic/usage/export.csv", s.handleTrafficUsageCSV).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/diagnostics/test", handleDiagTest).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/diagnostics/ports", handlePortStatus).Methods("GET", "OPTIONS") // БАГ #2B
 	s.router.HandleFunc("/api/diagnose", s.handleDiagnose).Methods("POST", "OPTIONS")
@@ -87,6 +97,8 @@ type trafficStore struct {
 	sessionUpB    int64
 	sessionDnB    int64
 	sessionStart  time.Time
+	// onSnapshot — получатель каждого снапшота (SSE /api/stream); задаётся до run().
+	onSnapshot func(trafficSnapshot)
 }
 
 func (ts *trafficStore) run(ctx context.Context) {
@@ -142,6 +154,9 @@ func (ts *trafficStore) connect(ctx context.Context) {
 		ts.sessionDnB += snap.Down
 		ts.mu.Unlock()
 		trafficstats.AddSession(snap.Down, snap.Up)
+		if ts.onSnapshot != nil {
+			ts.onSnapshot(snap)
+		}
 	}
 }
 
@@ -185,6 +200,9 @@ type connSpeedTracker struct {
 	// Ранее fetchConnectionsData создавал новый http.Client каждые 2с — каждый раз
 	// новый TCP handshake к localhost:9090. Теперь один клиент на весь lifecycle.
 	client http.Client
+	// onConns — получатель каждого успешного снимка соединений (учёт трафика);
+	// задаётся до run().
+	onConns func(clashConnections)
 }
 
 func (ct *connSpeedTracker) run(ctx context.Context) {
@@ -199,7 +217,8 @@ func (ct *connSpeedTracker) run(ctx context.Context) {
 }
 
 func (ct *connSpeedTracker) tick(ctx context.Context) {
-	conns, err := ct.fetchConnectionsData(ctx)
+	snap, err := ct.fetchSnapshot(ctx)
+	conns := snap.Connections
 	// BUG FIX #16: сначала фиксируем доступность API, затем обновляем счётчик.
 	// Так можно отличить "API недоступен" от "0 активных соединений" на стороне UI.
 	if err != nil {
@@ -214,6 +233,9 @@ func (ct *connSpeedTracker) tick(ctx context.Context) {
 	}
 	ct.apiAvailable.Store(true)
 	ct.active.Store(int64(len(conns)))
+	if ct.onConns != nil {
+		ct.onConns(snap)
+	}
 	if len(conns) == 0 {
 		ct.mu.Lock()
 		for k := range ct.speeds {
@@ -342,6 +364,9 @@ type clashConn struct {
 		DestinationIP string `json:"destinationIP"`
 		Network       string `json:"network"`
 		ProcessPath   string `json:"processPath"`
+		SourceIP      string `json:"sourceIP"`
+		// Type — "<тип inbound>/<тег>", например "mixed/lan-in".
+		Type string `json:"type"`
 	} `json:"metadata"`
 	Rule        string `json:"rule"`
 	RulePayload string `json:"rulePayload"`
@@ -357,32 +382,43 @@ func (c *clashConn) effectiveOutbound() string {
 	return ""
 }
 
+// clashConnections — ответ /connections: активные соединения и общие
+// счётчики байт sing-box с его запуска.
+type clashConnections struct {
+	UploadTotal   int64       `json:"uploadTotal"`
+	DownloadTotal int64       `json:"downloadTotal"`
+	Connections   []clashConn `json:"connections"`
+}
+
 func (ct *connSpeedTracker) fetchConnectionsData(ctx context.Context) ([]clashConn, error) {
+	snap, err := ct.fetchSnapshot(ctx)
+	return snap.Connections, err
+}
+
+func (ct *connSpeedTracker) fetchSnapshot(ctx context.Context) (clashConnections, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.ClashAPIBase+"/connections", nil)
 	if err != nil {
-		return nil, err
+		return clashConnections{}, err
 	}
 	req.Header.Set("Authorization", "Bearer "+config.ClashAPISecret())
 	r, err := ct.client.Do(req)
 	if err != nil {
-		return nil, err
+		return clashConnections{}, err
 	}
 	defer r.Body.Close()
-	var cr struct {
-		Connections []clashConn `json:"connections"`
-	}
+	var cr clashConnections
 	const maxBody = 4 << 20
 	data, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
 	if err != nil {
-		return nil, err
+		return clashConnections{}, err
 	}
 	if int64(len(data)) > maxBody {
-		return nil, fmt.Errorf("connections response too large")
+		return clashConnections{}, fmt.Errorf("connections response too large")
 	}
 	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&cr); err != nil {
-		return nil, err
+		return clashConnections{}, err
 	}
-	return cr.Connections, nil
+	return cr, nil
 }
 
 func (h *DiagHandlers) handleTrafficByProcess(w http.ResponseWriter, r *http.Request) {
@@ -68,11 +68,9 @@ func (h *ServersHandlers) handleFailoverStatus(w http.ResponseWriter, r *http.Re
 	scores := make([]score, len(list))
 	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
 	defer cancel()
+	method := probeMethod()
 	for i, srv := range list {
-		ms, _, _, ok := pingServerWithProbes(ctx, srv.URL, 1)
-		if h.health != nil {
-			h.health.Record(srv.ID, time.Duration(ms)*time.Millisecond, ok)
-		}
+		ms, ok := h.probeServer(ctx, method, list, srv)
 		scores[i] = score{ID: srv.ID, Name: srv.Name, Active: srv.ID == activeID, LatencyMs: ms, OK: ok}
 	}
 	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -81,6 +79,16 @@ func (h *ServersHandlers) handleFailoverStatus(w http.ResponseWriter, r *http.Re
 	})
 }
 
+// failoverStreamEvent — решение smart failover для /api/stream.
+type failoverStreamEvent struct {
+	Time        time.Time `json:"time"`
+	ActiveID    string    `json:"active_id"`
+	Failover    bool      `json:"failover"`
+	Reason      string    `json:"reason,omitempty"`
+	ConnectedID string    `json:"connected_id,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
 func (h *ServersHandlers) StartSmartFailover(ctx context.Context) {
 	go func() {
 		var lastSwitch time.Time
@@ -101,38 +109,57 @@ func (h *ServersHandlers) StartSmartFailover(ctx context.Context) {
 			if !settings.SmartFailover.Enabled || time.Since(lastSwitch) < 5*time.Minute {
 				continue
 			}
-			if h.shouldFailover(ctx, settings.SmartFailover, lastSwitch) {
-				resp, _, err := h.doAutoConnect(ctx)
-				if err != nil {
-					h.server.logger.Warn("SmartFailover: %v", err)
-					continue
-				}
-				if changed, _ := resp["changed"].(bool); changed {
-					lastSwitch = time.Now()
-					serverID, _ := resp["connected_id"].(string)
-					connhistory.Global.Add(connhistory.Event{
-						Time:   time.Now(),
-						Kind:   connhistory.EventFailover,
-						Server: serverID,
-						Reason: "smart failover",
-					})
+			should, reason, activeID := h.failoverDecision(ctx, settings.SmartFailover, lastSwitch)
+			decision := failoverStreamEvent{Time: time.Now(), ActiveID: activeID, Failover: should, Reason: reason}
+			if !should {
+				// Решение «остаёмся» приходит на каждой проверке: в backlog попадают
+				// только переключения и ошибки. Без причины (меньше двух серверов)
+				// публиковать нечего.
+				if reason != "" {
+					h.server.stream.publishTransient(streamTypeFailover, decision)
 				}
+				continue
+			}
+			resp, _, err := h.doAutoConnect(ctx)
+			if err != nil {
+				h.server.logger.Warn("SmartFailover: %v", err)
+				decision.Error = err.Error()
+				h.server.stream.publish(streamTypeFailover, decision)
+				continue
+			}
+			decision.ConnectedID, _ = resp["connected_id"].(string)
+			h.server.stream.publish(streamTypeFailover, decision)
+			if changed, _ := resp["changed"].(bool); changed {
+				lastSwitch = time.Now()
+				connhistory.Global.Add(connhistory.Event{
+					Time:   time.Now(),
+					Kind:   connhistory.EventFailover,
+					Server: decision.ConnectedID,
+					Reason: "smart failover",
+				})
 			}
 		}
 	}()
 }
 
 func (h *ServersHandlers) shouldFailover(ctx context.Context, settings config.SmartFailoverSettings, lastSwitch time.Time) bool {
+	should, _, _ := h.failoverDecision(ctx, settings, lastSwitch)
+	return should
+}
+
+// failoverDecision решает, нужно ли уходить с активного сервера, и объясняет почему.
+// Причина и активный сервер публикуются в /api/stream.
+func (h *ServersHandlers) failoverDecision(ctx context.Context, settings config.SmartFailoverSettings, lastSwitch time.Time) (should bool, reason, activeID string) {
 	h.mu.RLock()
 	list, err := loadServers()
 	h.mu.RUnlock()
 	list = visibleServers(list)
 	if err != nil || len(list) < 2 {
-		return false
+		return false, "", ""
 	}
-	activeID := h.activeServerIDFromList(list)
+	activeID = h.activeServerIDFromList(list)
 	if activeID == "" {
-		return true
+		return true, "no active server", ""
 	}
 	if h.health != nil {
 		current, ok := h.health.Get(activeID)
@@ -143,8 +170,8 @@ func (h *ServersHandlers) shouldFailover(ctx context.Context, settings config.Sm
 				if decision.MaxLatency <= 0 {
 					decision.MaxLatency = 500 * time.Millisecond
 				}
-				should, _ := healthmonitor.ShouldFailover(current, best, lastSwitch, decision, time.Now())
-				return should
+				should, reason = healthmonitor.ShouldFailover(current, best, lastSwitch, decision, time.Now())
+				return should, reason, activeID
 			}
 		}
 	}
@@ -152,13 +179,22 @@ func (h *ServersHandlers) shouldFailover(ctx context.Context, settings config.Sm
 		if srv.ID != activeID {
 			continue
 		}
-		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		ms, _, _, ok := pingServerWithProbes(pingCtx, srv.URL, 1)
+		timeout := 5 * time.Second
+		if settings.ProbeMethod == config.ProbeMethodURL {
+			// Запуск sing-box и HTTP-запрос через туннель дольше TCP-пробы.
+			timeout = 15 * time.Second
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		ms, ok := h.probeServer(pingCtx, settings.ProbeMethod, list, srv)
 		cancel()
-		if h.health != nil {
-			h.health.Record(srv.ID, time.Duration(ms)*time.Millisecond, ok)
+		switch {
+		case !ok:
+			return true, "probe failed", activeID
+		case settings.MaxLatencyMs > 0 && ms > int64(settings.MaxLatencyMs):
+			return true, "high latency", activeID
+		default:
+			return false, "", activeID
 		}
-		return !ok || (settings.MaxLatencyMs > 0 && ms > int64(settings.MaxLatencyMs))
 	}
-	return true
+	return true, "active server not found", activeID
 }
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/fileutil"
+	"proxyclient/internal/srs"
+)
+
+// customGeositePrefix — категории, собранные из пользовательских списков.
+// Их нет ни в одном источнике geositeSources, поэтому они не скачиваются.
+const customGeositePrefix = "custom-"
+
+const (
+	maxGeositeCompileRequestBytes = 4 << 20
+	// maxGeositeContentsItems ограничивает каждый список в ответе /contents:
+	// geosite-cn содержит сотни тысяч доменов, UI столько не покажет.
+	maxGeositeContentsItems = 5000
+)
+
+// geositeSetCache хранит разобранные geosite-*.bin, чтобы /lookup не
+// распаковывал все файлы на каждый запрос. Запись сбрасывается при смене
+// размера или mtime файла.
+var geositeSetCache = struct {
+	sync.Mutex
+	entries map[string]cachedGeositeSet
+}{entries: map[string]cachedGeositeSet{}}
+
+type cachedGeositeSet struct {
+	size    int64
+	modTime time.Time
+	rs      *srs.RuleSet
+}
+
+func loadGeositeSet(path string) (*srs.RuleSet, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	geositeSetCache.Lock()
+	e, ok := geositeSetCache.entries[path]
+	geositeSetCache.Unlock()
+	if ok && e.size == fi.Size() && e.modTime.Equal(fi.ModTime()) {
+		return e.rs, nil
+	}
+	rs, err := srs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	geositeSetCache.Lock()
+	geositeSetCache.entries[path] = cachedGeositeSet{size: fi.Size(), modTime: fi.ModTime(), rs: rs}
+	geositeSetCache.Unlock()
+	return rs, nil
+}
+
+func geositePath(name string) string {
+	return filepath.Join(config.DataDir, "geosite-"+name+".bin")
+}
+
+// GeositeLookupResponse — ответ GET /api/geosite/lookup.
+type GeositeLookupResponse struct {
+	Query   string   `json:"query"`
+	Matches []string `json:"matches"`
+	// Unreadable — файлы, которые не удалось разобрать (битые или чужой формат).
+	Unreadable []string `json:"unreadable,omitempty"`
+}
+
+// handleGeositeLookup GET /api/geosite/lookup?domain=example.com — в каких
+// локальных geosite категориях есть домен (или IP-адрес).
+func (s *Server) handleGeositeLookup(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(r.URL.Query().Get("domain"))), ".")
+	if query == "" {
+		s.respondError(w, http.StatusBadRequest, "параметр domain обязателен")
+		return
+	}
+	var meta srs.Metadata
+	if ip, err := netip.ParseAddr(query); err == nil {
+		meta.IP = ip
+	} else if strings.ContainsAny(query, "/: ") {
+		s.respondError(w, http.StatusBadRequest, "некорректный домен")
+		return
+	} else {
+		meta.Domain = query
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(config.DataDir, "geosite-*.bin"))
+	sort.Strings(paths)
+	resp := GeositeLookupResponse{Query: query, Matches: []string{}}
+	for _, path := range paths {
+		name := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(path), ".bin"), "geosite-")
+		rs, err := loadGeositeSet(path)
+		if err != nil {
+			resp.Unreadable = append(resp.Unreadable, name)
+			continue
+		}
+		if rs.Match(meta) {
+			resp.Matches = append(resp.Matches, name)
+		}
+	}
+	s.respondJSON(w, http.StatusOK, resp)
+}
+
+// GeositeContents — содержимое категории для просмотра в UI.
+type GeositeContents struct {
+	Name          string   `json:"name"`
+	Domain        []string `json:"domain"`
+	DomainSuffix  []string `json:"domain_suffix"`
+	DomainKeyword []string `json:"domain_keyword"`
+	DomainRegex   []string `json:"domain_regex"`
+	IPCIDR        []string `json:"ip_cidr"`
+	// Total — полный размер каждого списка до обрезки по maxGeositeContentsItems.
+	Total     map[string]int `json:"total"`
+	Truncated bool           `json:"truncated"`
+	// SkippedRules — логические и инвертированные правила, которые не
+	// раскладываются в плоские списки.
+	SkippedRules int `json:"skipped_rules,omitempty"`
+}
+
+// handleGeositeContents GET /api/geosite/{name}/contents
+func (s *Server) handleGeositeContents(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(mux.Vars(r)["name"])
+	if !isValidGeositeName(name) {
+		s.respondError(w, http.StatusBadRequest, "некорректное имя geosite")
+		return
+	}
+	rs, err := loadGeositeSet(geositePath(name))
+	if os.IsNotExist(err) {
+		s.respondError(w, http.StatusNotFound, "geosite не скачан: "+name)
+		return
+	}
+	if err != nil {
+		s.respondError(w, http.StatusUnprocessableEntity, "не удалось прочитать geosite: "+err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, geositeContents(name, rs))
+}
+
+func geositeContents(name string, rs *srs.RuleSet) GeositeContents {
+	out := GeositeContents{Name: name, Total: map[string]int{}}
+	for _, rule := range rs.Rules {
+		if rule.Type != srs.RuleDefault || rule.Invert {
+			out.SkippedRules++
+			continue
+		}
+		if rule.Domain != nil {
+			domains, suffixes := rule.Domain.Domains()
+			out.Domain = append(out.Domain, domains...)
+			out.DomainSuffix = append(out.DomainSuffix, suffixes...)
+		}
+		out.DomainKeyword = append(out.DomainKeyword, rule.DomainKeyword...)
+		out.DomainRegex = append(out.DomainRegex, rule.DomainRegex...)
+		for _, ipr := range rule.IPCIDR {
+			for _, p := range ipr.Prefixes() {
+				out.IPCIDR = append(out.IPCIDR, p.String())
+			}
+		}
+	}
+	for key, list := range map[string]*[]string{
+		"domain":         &out.Domain,
+		"domain_suffix":  &out.DomainSuffix,
+		"domain_keyword": &out.DomainKeyword,
+		"domain_regex":   &out.DomainRegex,
+		"ip_cidr":        &out.IPCIDR,
+	} {
+		out.Total[key] = len(*list)
+		if *list == nil {
+			*list = []string{}
+		}
+		if len(*list) > maxGeositeContentsItems {
+			*list = (*list)[:maxGeositeContentsItems]
+			out.Truncated = true
+		}
+	}
+	return out
+}
+
+// GeositeCompileRequest — тело POST /api/geosite/custom.
+type GeositeCompileRequest struct {
+	Name string `json:"name"`
+	// Text — список в формате srs.ParseTextList: домен на строку,
+	// префиксы full:/keyword:/regexp:, подсети.
+	Text  string `json:"text"`
+	Apply *bool  `json:"apply,omitempty"`
+}
+
+// handleGeositeCompile POST /api/geosite/custom — собирает из текстового
+// списка data/geosite-custom-<name>.bin. Категория используется в правилах
+// как geosite:custom-<name>, как и скачанные.
+func (s *Server) handleGeositeCompile(w http.ResponseWriter, r *http.Request) {
+	var req GeositeCompileRequest
+	if !decodeStrictJSON(w, r, &req, maxGeositeCompileRequestBytes) {
+		return
+	}
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	name = strings.TrimPrefix(name, customGeositePrefix)
+	if name == "" || !isValidGeositeName(customGeositePrefix+name) {
+		s.respondError(w, http.StatusBadRequest, "некорректное имя списка")
+		return
+	}
+	rule, err := srs.ParseTextList(strings.NewReader(req.Text))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "ошибка в списке: "+err.Error())
+		return
+	}
+	data, err := srs.Marshal(&srs.RuleSet{Rules: []srs.Rule{*rule}})
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "не удалось собрать rule-set: "+err.Error())
+		return
+	}
+	name = customGeositePrefix + name
+	if err := os.MkdirAll(config.DataDir, 0755); err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := fileutil.WriteAtomic(geositePath(name), data, 0644); err != nil {
+		s.respondError(w, http.StatusInternalServerError, "не удалось сохранить rule-set: "+err.Error())
+		return
+	}
+
+	applyErr := ""
+	if (req.Apply == nil || *req.Apply) && s.tunHandlers != nil {
+		if err := s.tunHandlers.TriggerApply(); err != nil {
+			s.logger.Warn("handleGeositeCompile: TriggerApply: %v", err)
+			applyErr = err.Error()
+		}
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":          true,
+		"name":        name,
+		"rule":        "geosite:" + name,
+		"size":        len(data),
+		"apply_error": applyErr,
+	})
+}
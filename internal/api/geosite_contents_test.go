@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"proxyclient/internal/config"
+)
+
+func TestGeositeCustomCompileLookupContents(t *testing.T) {
+	srv, _, cleanup := buildTunServer(t)
+	defer cleanup()
+	router := mux.NewRouter()
+	router.HandleFunc("/api/geosite/lookup", srv.handleGeositeLookup)
+	router.HandleFunc("/api/geosite/custom", srv.handleGeositeCompile)
+	router.HandleFunc("/api/geosite/{name}/contents", srv.handleGeositeContents)
+
+	noApply := false
+	w := postJSON(t, router, "/api/geosite/custom", GeositeCompileRequest{
+		Name:  "Work",
+		Text:  "# корпоративные домены\ncorp.example\nfull:vpn.example\n10.10.0.0/16\n",
+		Apply: &noApply,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("compile = %d, body=%s", w.Code, w.Body.String())
+	}
+	path := filepath.Join(config.DataDir, "geosite-custom-work.bin")
+	if !config.IsSingBoxRuleSetFile(path) {
+		t.Fatalf("%s is not a rule-set", path)
+	}
+	// Заглушка с верным заголовком, но без данных — попадает в unreadable.
+	if err := os.WriteFile(filepath.Join(config.DataDir, "geosite-broken.bin"), validTestSRS(64), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w = postJSON(t, router, "/api/geosite/custom", GeositeCompileRequest{Name: "bad", Text: "include:google\n", Apply: &noApply})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("compile invalid list = %d, want 400", w.Code)
+	}
+
+	for query, want := range map[string][]string{
+		"git.corp.example": {"custom-work"},
+		"vpn.example":      {"custom-work"},
+		"www.vpn.example":  {},
+		"10.10.1.1":        {"custom-work"},
+	} {
+		w = getJSON(t, router, "/api/geosite/lookup?domain="+query)
+		var resp GeositeLookupResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(resp.Matches, want) || !slices.Equal(resp.Unreadable, []string{"broken"}) {
+			t.Errorf("lookup %s = %+v, want matches %v", query, resp, want)
+		}
+	}
+
+	w = getJSON(t, router, "/api/geosite/custom-work/contents")
+	var contents GeositeContents
+	if err := json.NewDecoder(w.Body).Decode(&contents); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(contents.Domain, []string{"vpn.example"}) ||
+		!slices.Equal(contents.DomainSuffix, []string{"corp.example"}) ||
+		!slices.Equal(contents.IPCIDR, []string{"10.10.0.0/16"}) || contents.Truncated {
+		t.Errorf("contents = %+v", contents)
+	}
+	if w := getJSON(t, router, "/api/geosite/missing/contents"); w.Code != http.StatusNotFound {
+		t.Errorf("contents of missing geosite = %d, want 404", w.Code)
+	}
+
+	// Собранные локально категории не уходят в автообновление.
+	names := geositeRuleNamesFromConfig(&config.RoutingConfig{Rules: []config.RoutingRule{
+		{Value: "geosite:custom-work", Type: config.RuleTypeGeosite},
+		{Value: "geosite:youtube", Type: config.RuleTypeGeosite},
+	}})
+	if !slices.Equal(names, []string{"youtube"}) {
+		t.Errorf("geositeRuleNamesFromConfig = %v", names)
+	}
+}
@@ -152,7 +152,8 @@ func geositeRuleNamesFromConfig(routing *config.RoutingConfig) []string {
 			continue
 		}
 		name := strings.TrimPrefix(val, "geosite:")
-		if !isValidGeositeName(name) || seen[name] {
+		// custom-* собираются локально из списков — скачивать их неоткуда.
+		if !isValidGeositeName(name) || strings.HasPrefix(name, customGeositePrefix) || seen[name] {
 			continue
 		}
 		seen[name] = true
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"proxyclient/internal/config"
+)
+
+// Группы серверов (urltest/selector) живут в routing.json рядом с правилами:
+// правила и default_group ссылаются на них по ID, а builder разворачивает их
+// в outbounds sing-box. Переключение внутри группы делает сам sing-box —
+// без перезаписи secret.key и без пересоздания TUN.
+
+// GroupRequest тело PUT /api/tun/groups/{id}
+type GroupRequest struct {
+	Name           string           `json:"name"`
+	Type           config.GroupType `json:"type"`
+	SubscriptionID string           `json:"subscription_id,omitempty"`
+	Servers        []string         `json:"servers,omitempty"`
+}
+
+// GroupResponse — группа вместе с актуальным составом из servers.json.
+type GroupResponse struct {
+	config.ServerGroup
+	Members []string `json:"members"`
+}
+
+func (h *TunHandlers) setupGroupRoutes() {
+	r := h.server.router
+	r.HandleFunc("/api/tun/groups", h.handleListGroups).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/tun/groups/{id}", h.handlePutGroup).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/tun/groups/{id}", h.handleDeleteGroup).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/api/tun/groups/{id}/select", h.handleSelectGroupServer).Methods("POST", "OPTIONS")
+}
+
+// handleListGroups GET /api/tun/groups
+func (h *TunHandlers) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	groups := append([]config.ServerGroup(nil), h.routing.Groups...)
+	defaultGroup := h.routing.DefaultGroup
+	h.mu.RUnlock()
+
+	saved, err := config.LoadSavedServers(config.ServersFile)
+	if err != nil {
+		h.server.logger.Warn("handleListGroups: %v", err)
+	}
+	out := make([]GroupResponse, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, GroupResponse{ServerGroup: g, Members: config.GroupMemberIDs(g, saved)})
+	}
+	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"groups":        out,
+		"default_group": defaultGroup,
+	})
+}
+
+// handlePutGroup PUT /api/tun/groups/{id} — создаёт или заменяет группу.
+func (h *TunHandlers) handlePutGroup(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !config.IsValidGroupID(id) {
+		h.server.respondError(w, http.StatusBadRequest, "id группы: только a-z, 0-9, '-' и '_'")
+		return
+	}
+	var req GroupRequest
+	if !h.decodeRequest(w, r, &req, maxTunSmallRequestBytes) {
+		return
+	}
+	if !config.IsValidGroupType(req.Type) {
+		h.server.respondError(w, http.StatusBadRequest, "type: urltest | selector")
+		return
+	}
+	var servers []string
+	seen := map[string]bool{}
+	for _, sid := range req.Servers {
+		sid = strings.TrimSpace(sid)
+		if sid != "" && !seen[sid] {
+			seen[sid] = true
+			servers = append(servers, sid)
+		}
+	}
+	group := config.ServerGroup{
+		ID:             id,
+		Name:           strings.TrimSpace(req.Name),
+		Type:           req.Type,
+		SubscriptionID: strings.TrimSpace(req.SubscriptionID),
+		Servers:        servers,
+	}
+	if group.SubscriptionID == "" && len(group.Servers) == 0 {
+		h.server.respondError(w, http.StatusBadRequest, "группа должна содержать servers или subscription_id")
+		return
+	}
+
+	h.server.routingOpMu.Lock()
+	defer h.server.routingOpMu.Unlock()
+
+	h.mu.Lock()
+	oldGroups := h.routing.Groups
+	groups := make([]config.ServerGroup, 0, len(oldGroups)+1)
+	replaced := false
+	for _, g := range oldGroups {
+		if g.ID == id {
+			groups = append(groups, group)
+			replaced = true
+			continue
+		}
+		groups = append(groups, g)
+	}
+	if !replaced {
+		groups = append(groups, group)
+	}
+	h.routing.Groups = groups
+	// FIX Bug7: освобождаем мьютекс до I/O.
+	routingCopy := cloneRoutingConfig(h.routing)
+	h.mu.Unlock()
+
+	if err := config.SaveRoutingConfig(routingConfigPath, routingCopy); err != nil {
+		h.mu.Lock()
+		h.routing.Groups = oldGroups // откат
+		h.mu.Unlock()
+		h.server.logger.Error("Не удалось сохранить routing config: %v", err)
+		h.server.respondError(w, http.StatusInternalServerError, "не удалось сохранить группу")
+		return
+	}
+
+	applyErr := ""
+	if err := h.TriggerApply(); err != nil {
+		h.server.logger.Warn("handlePutGroup: TriggerApply: %v", err)
+		applyErr = err.Error()
+	}
+	status := http.StatusOK
+	if !replaced {
+		status = http.StatusCreated
+	}
+	h.server.respondJSON(w, status, map[string]interface{}{
+		"message":     "группа сохранена",
+		"group":       group,
+		"apply_error": applyErr,
+	})
+}
+
+// handleDeleteGroup DELETE /api/tun/groups/{id}
+// Группу, на которую ссылаются правила или default_group, удалить нельзя —
+// иначе трафик молча уйдёт на proxy-out.
+func (h *TunHandlers) handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	h.server.routingOpMu.Lock()
+	defer h.server.routingOpMu.Unlock()
+
+	h.mu.Lock()
+	if _, ok := h.routing.FindGroup(id); !ok {
+		h.mu.Unlock()
+		h.server.respondError(w, http.StatusNotFound, "группа не найдена")
+		return
+	}
+	if groupInUse(h.routing, id) {
+		h.mu.Unlock()
+		h.server.respondError(w, http.StatusConflict, "группа используется в правилах или как default_group")
+		return
+	}
+	oldGroups := h.routing.Groups
+	groups := make([]config.ServerGroup, 0, len(oldGroups))
+	for _, g := range oldGroups {
+		if g.ID != id {
+			groups = append(groups, g)
+		}
+	}
+	h.routing.Groups = groups
+	routingCopy := cloneRoutingConfig(h.routing)
+	h.mu.Unlock()
+
+	if err := config.SaveRoutingConfig(routingConfigPath, routingCopy); err != nil {
+		h.mu.Lock()
+		h.routing.Groups = oldGroups // откат
+		h.mu.Unlock()
+		h.server.logger.Error("Не удалось сохранить routing config: %v", err)
+		h.server.respondError(w, http.StatusInternalServerError, "не удалось сохранить изменения")
+		return
+	}
+
+	// Неиспользуемая группа не попадает в конфиг sing-box — перезапуск не нужен.
+	h.server.respondJSON(w, http.StatusOK, MessageResponse{Success: true, Message: "группа удалена"})
+}
+
+// handleSelectGroupServer POST /api/tun/groups/{id}/select — переключает selector-группу
+// на другой сервер через Clash API, без перегенерации конфига и перезапуска.
+// Выбор не пишется в routing.json: после перегенерации конфига группа стартует с default.
+func (h *TunHandlers) handleSelectGroupServer(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req struct {
+		Server string `json:"server"`
+	}
+	if !h.decodeRequest(w, r, &req, maxTunSmallRequestBytes) {
+		return
+	}
+
+	h.mu.RLock()
+	group, ok := h.routing.FindGroup(id)
+	h.mu.RUnlock()
+	if !ok {
+		h.server.respondError(w, http.StatusNotFound, "группа не найдена")
+		return
+	}
+	if group.Type != config.GroupTypeSelector {
+		h.server.respondError(w, http.StatusBadRequest, "переключение доступно только для selector-групп")
+		return
+	}
+	saved, err := config.LoadSavedServers(config.ServersFile)
+	if err != nil {
+		h.server.respondError(w, http.StatusInternalServerError, "не удалось прочитать список серверов")
+		return
+	}
+	member := false
+	for _, sid := range config.GroupMemberIDs(group, saved) {
+		if sid == req.Server {
+			member = true
+			break
+		}
+	}
+	if !member {
+		h.server.respondError(w, http.StatusBadRequest, "сервер не входит в группу")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+	if err := selectClashProxy(ctx, config.GroupOutboundTag(id), config.ServerOutboundTag(req.Server)); err != nil {
+		h.server.logger.Warn("handleSelectGroupServer: %v", err)
+		h.server.respondError(w, http.StatusBadGateway, "sing-box не принял переключение: "+err.Error())
+		return
+	}
+	h.server.respondJSON(w, http.StatusOK, MessageResponse{Success: true, Message: "сервер группы переключён"})
+}
+
+// selectClashProxy выбирает outbound member внутри selector-группы group через Clash API.
+func selectClashProxy(ctx context.Context, group, member string) error {
+	body, err := json.Marshal(map[string]string{"name": member})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
+		clashAPIBaseURL+"/proxies/"+url.PathEscape(group), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+config.ClashAPISecret())
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("clash api select status %d: %s", resp.StatusCode, b)
+	}
+	return nil
+}
+
+// groupInUse сообщает, ссылаются ли на группу правила или default_group.
+func groupInUse(cfg *config.RoutingConfig, id string) bool {
+	if cfg.DefaultGroup == id {
+		return true
+	}
+	for _, rule := range cfg.Rules {
+		if rule.Group == id {
+			return true
+		}
+	}
+	return false
+}
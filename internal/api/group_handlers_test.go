@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"proxyclient/internal/config"
+)
+
+func TestGroupHandlers_PutListDelete(t *testing.T) {
+	srv, h, cleanup := buildTunServer(t)
+	defer cleanup()
+
+	if err := os.WriteFile(serversFile, []byte(`[
+		{"id":"a","url":"vless://u@a.example:443","subscription_id":"sub1"},
+		{"id":"b","url":"vless://u@b.example:443","subscription_id":"sub1"},
+		{"id":"c","url":"vless://u@c.example:443"}
+	]`), 0644); err != nil {
+		t.Fatalf("WriteFile servers.json: %v", err)
+	}
+
+	w := putJSON(t, srv.router, "/api/tun/groups/auto", GroupRequest{Type: config.GroupTypeURLTest, SubscriptionID: "sub1", Servers: []string{"c"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("PUT group = %d, body=%s", w.Code, w.Body.String())
+	}
+	if w := putJSON(t, srv.router, "/api/tun/groups/Bad!", GroupRequest{Type: config.GroupTypeURLTest, Servers: []string{"c"}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("PUT invalid id = %d, want 400", w.Code)
+	}
+
+	w = getJSON(t, srv.router, "/api/tun/groups")
+	var resp struct {
+		Groups []GroupResponse `json:"groups"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Groups) != 1 || strings.Join(resp.Groups[0].Members, ",") != "c,a,b" {
+		t.Fatalf("groups = %+v, want auto with members c,a,b", resp.Groups)
+	}
+
+	h.mu.Lock()
+	h.routing.Rules = append(h.routing.Rules, config.RoutingRule{Value: "netflix.com", Type: config.RuleTypeDomain, Action: config.ActionProxy, Group: "auto"})
+	h.mu.Unlock()
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/tun/groups/auto", nil)
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("DELETE group in use = %d, want 409", rec.Code)
+	}
+
+	h.mu.Lock()
+	h.routing.Rules = nil
+	h.mu.Unlock()
+	rec = httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/tun/groups/auto", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("DELETE group = %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if len(h.routing.Groups) != 0 {
+		t.Fatalf("groups after delete = %+v", h.routing.Groups)
+	}
+}
+
+func TestGroupHandlers_SelectUsesClashAPI(t *testing.T) {
+	srv, h, cleanup := buildTunServer(t)
+	defer cleanup()
+
+	if err := os.WriteFile(serversFile, []byte(`[{"id":"a","url":"vless://u@a.example:443"},{"id":"b","url":"vless://u@b.example:443"}]`), 0644); err != nil {
+		t.Fatalf("WriteFile servers.json: %v", err)
+	}
+	h.routing.Groups = []config.ServerGroup{{ID: "manual", Type: config.GroupTypeSelector, Servers: []string{"a", "b"}}}
+
+	var gotPath, gotBody string
+	clashMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		b := new(strings.Builder)
+		_, _ = io.Copy(b, r.Body)
+		gotBody = b.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer clashMock.Close()
+	origURL := clashAPIBaseURL
+	clashAPIBaseURL = clashMock.URL
+	defer func() { clashAPIBaseURL = origURL }()
+
+	w := postJSON(t, srv.router, "/api/tun/groups/manual/select", map[string]string{"server": "b"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("select = %d, body=%s", w.Code, w.Body.String())
+	}
+	if gotPath != "/proxies/group-manual" || !strings.Contains(gotBody, `"server-b"`) {
+		t.Fatalf("clash request path=%q body=%q", gotPath, gotBody)
+	}
+
+	if w := postJSON(t, srv.router, "/api/tun/groups/manual/select", map[string]string{"server": "zzz"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("select non-member = %d, want 400", w.Code)
+	}
+}
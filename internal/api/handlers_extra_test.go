@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"proxyclient/internal/apprules"
 	"proxyclient/internal/config"
 	"proxyclient/internal/eventlog"
 	"proxyclient/internal/logger"
@@ -261,8 +262,12 @@ func TestTunImport_ValidJSON_Returns200(t *testing.T) {
 	if resp.DefaultAction != "direct" {
 		t.Errorf("default_action после import = %q, want direct", resp.DefaultAction)
 	}
-	if len(resp.Rules) != 2 {
-		t.Errorf("rules count после import = %d, want 2", len(resp.Rules))
+	// telegram.exe уходит в правила приложений.
+	if len(resp.Rules) != 1 {
+		t.Errorf("rules count после import = %d, want 1", len(resp.Rules))
+	}
+	if rules := srv.appRules.ListRules(); len(rules) != 1 || rules[0].Pattern != "telegram.exe" || rules[0].Action != apprules.ActionDirect {
+		t.Errorf("app rules после import = %+v, want direct telegram.exe", rules)
 	}
 }
 
@@ -847,8 +852,12 @@ func TestBulkReplaceExportRoundTrip(t *testing.T) {
 	if exported.DefaultAction != "direct" {
 		t.Errorf("exported default_action = %q, want direct", exported.DefaultAction)
 	}
-	if len(exported.Rules) != 4 {
-		t.Errorf("exported rules count = %d, want 4", len(exported.Rules))
+	// telegram.exe ушёл в правила приложений.
+	if len(exported.Rules) != 3 {
+		t.Errorf("exported rules count = %d, want 3", len(exported.Rules))
+	}
+	if rules := srv.appRules.ListRules(); len(rules) != 1 || rules[0].Pattern != "telegram.exe" {
+		t.Errorf("app rules = %+v, want telegram.exe", rules)
 	}
 
 	// 4. Импортируем обратно на чистый сервер
@@ -865,8 +874,8 @@ func TestBulkReplaceExportRoundTrip(t *testing.T) {
 	if err := json.NewDecoder(wGet.Body).Decode(&result); err != nil {
 		t.Fatalf("decode rules response: %v", err)
 	}
-	if len(result.Rules) != 4 {
-		t.Errorf("rules после import = %d, want 4", len(result.Rules))
+	if len(result.Rules) != 3 {
+		t.Errorf("rules после import = %d, want 3", len(result.Rules))
 	}
 }
 
@@ -1073,3 +1082,39 @@ func TestXrayConfig_DefaultValues(t *testing.T) {
 		t.Error("ConfigPath не должен быть пустым")
 	}
 }
+
+func TestHandleAddRule_RichTypes(t *testing.T) {
+	srv, h, cleanup := buildTunServer(t)
+	defer cleanup()
+
+	for _, value := range []string{`Regex:^CDN\d+\.`, "port:8000:9000", "GeoIP:RU", `C:\Games\Steam\Steam.exe`} {
+		if w := postJSON(t, srv.router, "/api/tun/rules", map[string]string{"value": value, "action": "direct"}); w.Code != http.StatusCreated {
+			t.Fatalf("POST %q = %d (body: %s)", value, w.Code, w.Body)
+		}
+	}
+	if w := postJSON(t, srv.router, "/api/tun/rules", map[string]string{"value": "port:0", "action": "direct"}); w.Code != http.StatusBadRequest {
+		t.Errorf("POST port:0 = %d, want 400", w.Code)
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	got := map[string]config.RuleType{}
+	for _, rule := range h.routing.Rules {
+		got[rule.Value] = rule.Type
+	}
+	// regex сохраняет регистр, диапазон портов приводится к виду "from-to".
+	want := map[string]config.RuleType{
+		`regex:^CDN\d+\.`: config.RuleTypeRegex,
+		"port:8000-9000":  config.RuleTypePort,
+		"geoip:ru":        config.RuleTypeGeoIP,
+	}
+	for value, typ := range want {
+		if got[value] != typ {
+			t.Errorf("rule %q: type %q, want %q (all: %v)", value, got[value], typ, got)
+		}
+	}
+	// Путь процесса уходит в правила приложений точным паттерном.
+	if rules := srv.appRules.ListRules(); len(rules) != 1 || rules[0].Pattern != "c:/games/steam/steam.exe" || !rules[0].Exact {
+		t.Errorf("app rules = %+v, want exact c:/games/steam/steam.exe", rules)
+	}
+}
@@ -15,7 +15,9 @@ import (
 	"testing"
 	"time"
 
+	"proxyclient/internal/apprules"
 	"proxyclient/internal/config"
+	"proxyclient/internal/leaktest"
 	"proxyclient/internal/logger"
 	"proxyclient/internal/proxy"
 	"proxyclient/internal/xray"
@@ -89,6 +91,12 @@ func buildTunServer(t *testing.T) (*Server, *TunHandlers, func()) {
 	}, context.Background())
 	// xray.Config нужен TunHandlers только для doApply; в unit-тестах правил не вызываем.
 	h := srv.SetupTunRoutes(xray.Config{})
+	// Как в main: process-правила из /api/tun/rules уходят в правила приложений.
+	srv.appRules = apprules.NewEngine()
+	// Проверка IPv6 после apply не должна ходить в сеть из тестов.
+	h.ipv6ProbeFn = func(context.Context, config.IPv6Mode) (*leaktest.IPv6Report, error) {
+		return &leaktest.IPv6Report{Status: "unavailable"}, nil
+	}
 	// Регистрируем все feature-роуты чтобы тесты покрывали реальный набор эндпоинтов
 	SetupProfileRoutes(srv)
 	SetupSettingsRoutes(srv)
@@ -338,9 +346,43 @@ func TestTunAddRule_Process_DetectsType(t *testing.T) {
 	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
 		t.Fatalf("decode add rule response: %v", err)
 	}
-	rule := result["rule"].(map[string]interface{})
-	if rule["type"] != "process" {
-		t.Errorf("Type = %q, want process", rule["type"])
+	// Процесс попадает в правила приложений, а не в routing.json.
+	rule := result["app_rule"].(map[string]interface{})
+	if rule["pattern"] != "discord.exe" || rule["exact"] != true || rule["action"] != string(apprules.ActionProxy) {
+		t.Errorf("app_rule = %v, want exact proxy Discord.exe", rule)
+	}
+	if got := len(srv.appRules.ListRules()); got != 1 {
+		t.Errorf("app rules = %d, want 1", got)
+	}
+	if w := getJSON(t, srv.router, "/api/tun/rules"); strings.Contains(w.Body.String(), "Discord.exe") {
+		t.Errorf("process-правило осталось в routing.json: %s", w.Body)
+	}
+	// Повтор (без учёта регистра) — конфликт.
+	if w := postJSON(t, srv.router, "/api/tun/rules", AddRuleRequest{Value: "discord.exe", Action: config.ActionDirect}); w.Code != http.StatusConflict {
+		t.Errorf("POST discord.exe повторно = %d, want 409", w.Code)
+	}
+}
+
+func TestTunAddRule_ProcessWithoutAppRulesRejected(t *testing.T) {
+	srv, h, cleanup := buildTunServer(t)
+	defer cleanup()
+	srv.appRules = nil
+
+	w := postJSON(t, srv.router, "/api/tun/rules", AddRuleRequest{Value: "Discord.exe", Action: config.ActionProxy})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("POST Discord.exe без движка правил приложений = %d, want 400", w.Code)
+	}
+	w = putJSON(t, srv.router, "/api/tun/rules", map[string]interface{}{
+		"default_action": "direct",
+		"rules":          []config.RoutingRule{{Value: "Discord.exe", Type: config.RuleTypeProcess, Action: config.ActionProxy}},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("PUT с process-правилом без движка = %d, want 400", w.Code)
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.routing.Rules) != 0 {
+		t.Errorf("routing rules = %v, want пусто", h.routing.Rules)
 	}
 }
 
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/connhistory"
+	"proxyclient/internal/latency"
+)
+
+const (
+	defaultHistoryDays   = 7
+	defaultHistoryEvents = 200
+	maxHistoryEvents     = 5000
+)
+
+// SetupHistoryRoutes — запросы к сохранённой истории задержек и подключений (data/history.db).
+func SetupHistoryRoutes(s *Server) {
+	api := s.router.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/history/latency", s.handleHistoryLatency).Methods("GET", "OPTIONS")
+	api.HandleFunc("/history/uptime", s.handleHistoryUptime).Methods("GET", "OPTIONS")
+	api.HandleFunc("/history/events", s.handleHistoryEvents).Methods("GET", "OPTIONS")
+}
+
+// subscribeHistorySources пишет ping-замеры и события подключения в историю на
+// время жизни сервера. Проверки healthmonitor подключает StartHealthMonitor.
+func (s *Server) subscribeHistorySources() {
+	store := s.config.History
+	if store == nil {
+		return
+	}
+	cancels := []func(){
+		latency.Global.Subscribe(store.RecordPing),
+		connhistory.Global.Subscribe(store.RecordEvent),
+	}
+	context.AfterFunc(s.lifecycleCtx, func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	})
+}
+
+// historySince разбирает ?days=N (по умолчанию 7, не больше срока хранения).
+func (s *Server) historySince(r *http.Request) (time.Time, int, bool) {
+	days := defaultHistoryDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > config.MaxHistoryRetentionDays {
+			return time.Time{}, 0, false
+		}
+		days = n
+	}
+	return time.Now().AddDate(0, 0, -days), days, true
+}
+
+func (s *Server) historyAvailable(w http.ResponseWriter) bool {
+	if s.config.History == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "история недоступна")
+		return false
+	}
+	return true
+}
+
+// handleHistoryLatency GET /api/history/latency?days=7 — p50/p95 задержки по серверам.
+func (s *Server) handleHistoryLatency(w http.ResponseWriter, r *http.Request) {
+	if !s.historyAvailable(w) {
+		return
+	}
+	since, days, ok := s.historySince(r)
+	if !ok {
+		s.respondError(w, http.StatusBadRequest, "days: 1..365")
+		return
+	}
+	stats, err := s.config.History.LatencyStats(r.Context(), since)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"days": days, "servers": stats})
+}
+
+// handleHistoryUptime GET /api/history/uptime?days=7 — процент успешных проверок по серверам.
+func (s *Server) handleHistoryUptime(w http.ResponseWriter, r *http.Request) {
+	if !s.historyAvailable(w) {
+		return
+	}
+	since, days, ok := s.historySince(r)
+	if !ok {
+		s.respondError(w, http.StatusBadRequest, "days: 1..365")
+		return
+	}
+	stats, err := s.config.History.Uptime(r.Context(), since)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"days": days, "servers": stats})
+}
+
+// handleHistoryEvents GET /api/history/events?days=7[&kind=failover][&limit=200]
+func (s *Server) handleHistoryEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.historyAvailable(w) {
+		return
+	}
+	since, days, ok := s.historySince(r)
+	if !ok {
+		s.respondError(w, http.StatusBadRequest, "days: 1..365")
+		return
+	}
+	kind := connhistory.EventKind(r.URL.Query().Get("kind"))
+	switch kind {
+	case "", connhistory.EventConnect, connhistory.EventDisconnect, connhistory.EventFailover,
+		connhistory.EventReconnect, connhistory.EventNetChange:
+	default:
+		s.respondError(w, http.StatusBadRequest, "неизвестный тип события: "+string(kind))
+		return
+	}
+	limit := defaultHistoryEvents
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryEvents {
+			s.respondError(w, http.StatusBadRequest, "limit: 1..5000")
+			return
+		}
+		limit = n
+	}
+	events, err := s.config.History.Events(r.Context(), since, kind, limit)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"days":           days,
+		"retention_days": s.config.History.RetentionDays(),
+		"events":         events,
+	})
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"proxyclient/internal/connhistory"
+	"proxyclient/internal/historydb"
+	"proxyclient/internal/latency"
+	"proxyclient/internal/logger"
+)
+
+func TestHistoryEndpoints_RecordFromGlobalSources(t *testing.T) {
+	store, err := historydb.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("historydb.Open: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store.Start(ctx, nil)
+	s := NewServer(Config{Logger: &logger.NoOpLogger{}, History: store}, ctx)
+	SetupHistoryRoutes(s)
+
+	latency.Global.Record("hist-a", 40)
+	latency.Global.Record("hist-a", 60)
+	latency.Global.Record("hist-a", -1)
+	connhistory.Global.Add(connhistory.Event{Time: time.Now(), Kind: connhistory.EventFailover, Server: "hist-a", Reason: "test"})
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := store.Flush(flushCtx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	get := func(path string, dst interface{}) int {
+		w := httptest.NewRecorder()
+		s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code == http.StatusOK && dst != nil {
+			if err := json.Unmarshal(w.Body.Bytes(), dst); err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+		}
+		return w.Code
+	}
+
+	var lat struct {
+		Servers []historydb.LatencyStat `json:"servers"`
+	}
+	if code := get("/api/history/latency?days=7", &lat); code != http.StatusOK {
+		t.Fatalf("latency = %d", code)
+	}
+	if len(lat.Servers) != 1 || lat.Servers[0].ServerID != "hist-a" || lat.Servers[0].P50Ms != 40 || lat.Servers[0].P95Ms != 60 {
+		t.Errorf("latency servers = %+v", lat.Servers)
+	}
+
+	var up struct {
+		Servers []historydb.UptimeStat `json:"servers"`
+	}
+	if code := get("/api/history/uptime", &up); code != http.StatusOK {
+		t.Fatalf("uptime = %d", code)
+	}
+	if len(up.Servers) != 1 || up.Servers[0].Checks != 3 || up.Servers[0].UptimePct != 66.67 {
+		t.Errorf("uptime servers = %+v", up.Servers)
+	}
+
+	var ev struct {
+		Events []connhistory.Event `json:"events"`
+	}
+	if code := get("/api/history/events?kind=failover&limit=10", &ev); code != http.StatusOK {
+		t.Fatalf("events = %d", code)
+	}
+	if len(ev.Events) != 1 || ev.Events[0].Server != "hist-a" {
+		t.Errorf("events = %+v", ev.Events)
+	}
+
+	for _, path := range []string{"/api/history/latency?days=0", "/api/history/events?kind=bogus", "/api/history/events?limit=-1"} {
+		if code := get(path, nil); code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", path, code)
+		}
+	}
+}
+
+func TestHistoryEndpoints_UnavailableWithoutStore(t *testing.T) {
+	s := NewServer(Config{Logger: &logger.NoOpLogger{}}, context.Background())
+	SetupHistoryRoutes(s)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history/uptime", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("uptime without store = %d, want 503", w.Code)
+	}
+}
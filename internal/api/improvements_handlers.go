@@ -54,6 +54,7 @@ func SetupImprovementRoutes(s *Server) {
 	api.HandleFunc("/diagnostics/crashes", s.handleCrashReports).Methods("GET", "OPTIONS")
 	api.HandleFunc("/connections/history", s.handleConnectionHistory).Methods("GET", "OPTIONS")
 	api.HandleFunc("/settings/lan-info", s.handleLANInfo).Methods("GET", "OPTIONS")
+	api.HandleFunc("/lan/clients", s.handleLANClients).Methods("GET", "OPTIONS")
 	api.HandleFunc("/backup/export", s.handleExportConfig).Methods("GET", "OPTIONS")
 	api.HandleFunc("/backup/import", s.handleImportConfig).Methods("POST", "OPTIONS")
 	api.HandleFunc("/tun/rules/import", s.handleImportRules).Methods("POST", "OPTIONS")
@@ -124,10 +125,17 @@ func (s *Server) handleConnectionHistory(w http.ResponseWriter, _ *http.Request)
 }
 
 func (s *Server) handleLANInfo(w http.ResponseWriter, _ *http.Request) {
-	port := 10808
+	port := config.DefaultLANSharePort
+	auth, restricted, policy := false, false, config.LANPolicyRules
 	if cfg, err := config.LoadRoutingConfig(filepath.Join(config.DataDir, "routing.json")); err == nil {
 		config.SanitizeRoutingConfig(cfg)
-		port = cfg.LANSharePort
+		if cfg.LANSharePort != 0 {
+			port = cfg.LANSharePort
+		}
+		auth, restricted = len(cfg.LANUsers) > 0, len(cfg.LANAllowCIDRs) > 0
+		if cfg.LANPolicy != "" {
+			policy = cfg.LANPolicy
+		}
 	}
 	var ips []string
 	ifaces, _ := net.Interfaces()
@@ -149,7 +157,9 @@ func (s *Server) handleLANInfo(w http.ResponseWriter, _ *http.Request) {
 			}
 		}
 	}
-	s.respondJSON(w, http.StatusOK, map[string]interface{}{"ips": ips, "port": port})
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"ips": ips, "port": port, "auth": auth, "restricted": restricted, "policy": policy,
+	})
 }
 
 func (s *Server) handleBuiltinProfiles(w http.ResponseWriter, _ *http.Request) {
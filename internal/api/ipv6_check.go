@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/ipv6mitigation"
+	"proxyclient/internal/leaktest"
+)
+
+// IPv6ModeCheck — результат автоматической проверки IPv6 после apply.
+type IPv6ModeCheck struct {
+	Mode   config.IPv6Mode      `json:"mode"`
+	Report *leaktest.IPv6Report `json:"report,omitempty"`
+	Error  string               `json:"error,omitempty"`
+	// Mitigation — что сделано с отключением IPv6 на адаптере:
+	// "restored" (включён обратно для режимов с IPv6), "disabled" (выключен
+	// после утечки в ipv4-only) или пусто.
+	Mitigation      string    `json:"mitigation,omitempty"`
+	MitigationError string    `json:"mitigation_error,omitempty"`
+	CheckedAt       time.Time `json:"checked_at"`
+}
+
+// ipv6CheckState хранит последний результат и сериализует проверки:
+// два apply подряд не должны параллельно дёргать netsh.
+type ipv6CheckState struct {
+	mu   sync.Mutex
+	run  sync.Mutex
+	last *IPv6ModeCheck
+}
+
+// ipv6Restore и ipv6Disable — netsh-операции ipv6mitigation; тесты подменяют их,
+// чтобы не трогать настоящие адаптеры.
+var (
+	ipv6Restore = ipv6mitigation.Restore
+	ipv6Disable = ipv6mitigation.Disable
+)
+
+// probeIPv6 выполняет проверку под режим: для ipv4-only любой IPv6 — утечка,
+// для режимов с IPv6 — только выход с адреса локального адаптера.
+func (h *TunHandlers) probeIPv6(ctx context.Context, mode config.IPv6Mode) (*leaktest.IPv6Report, error) {
+	if h.ipv6ProbeFn != nil {
+		return h.ipv6ProbeFn(ctx, mode)
+	}
+	if mode.IPv6Enabled() {
+		return leaktest.RunIPv6TunnelTest(ctx, nil)
+	}
+	return leaktest.RunIPv6LeakTest(ctx, nil)
+}
+
+// scheduleIPv6Check запускает проверку выбранного IPv6-режима в фоне после
+// успешного apply. Выключается вместе с остальными проверками утечек
+// (settings.leak_test.enabled).
+func (h *TunHandlers) scheduleIPv6Check(mode config.IPv6Mode) {
+	settings, err := config.LoadAppSettings(config.AppSettingsFile)
+	if err != nil {
+		settings = config.DefaultAppSettings()
+	}
+	if !settings.LeakTest.Enabled {
+		return
+	}
+	go h.runIPv6Check(h.server.lifecycleCtx, mode, settings.LeakTest.DisableIPv6OnTunnel)
+}
+
+func (h *TunHandlers) runIPv6Check(parent context.Context, mode config.IPv6Mode, disableOnLeak bool) *IPv6ModeCheck {
+	h.ipv6Check.run.Lock()
+	defer h.ipv6Check.run.Unlock()
+
+	mode = config.NormalizeIPv6Mode(mode)
+	check := &IPv6ModeCheck{Mode: mode}
+	statePath := ipv6StatePath()
+
+	// IPv6, выключенный на адаптере прошлой проверкой, сделал бы режимы
+	// prefer-ipv4 и dual-stack бесполезными — включаем его до замера.
+	if mode.IPv6Enabled() {
+		if st, err := ipv6mitigation.LoadState(statePath); err == nil && st.Active {
+			if err := ipv6Restore(parent, statePath); err != nil {
+				check.MitigationError = err.Error()
+			} else {
+				check.Mitigation = "restored"
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(parent, leakTestTimeout)
+	report, err := h.probeIPv6(ctx, mode)
+	cancel()
+	check.Report = report
+	if err != nil {
+		check.Error = err.Error()
+	}
+
+	if report != nil && report.Leaked {
+		h.server.logger.Warn("IPv6: утечка в режиме %s: адрес %s, интерфейс %q", mode, report.Address, report.Interface)
+		if !mode.IPv6Enabled() && disableOnLeak {
+			if report.Interface == "" {
+				check.MitigationError = "интерфейс с адресом " + report.Address + " не найден"
+			} else if err := ipv6Disable(parent, statePath, report.Interface); err != nil {
+				check.MitigationError = err.Error()
+			} else {
+				check.Mitigation = "disabled"
+				h.server.logger.Info("IPv6: отключён на интерфейсе %q", report.Interface)
+			}
+		}
+	}
+	if check.MitigationError != "" {
+		h.server.logger.Warn("IPv6: mitigation: %s", check.MitigationError)
+	}
+
+	check.CheckedAt = time.Now().UTC()
+	h.ipv6Check.mu.Lock()
+	h.ipv6Check.last = check
+	h.ipv6Check.mu.Unlock()
+	return check
+}
+
+// handleIPv6Check GET /api/tun/ipv6/check — результат последней автоматической
+// проверки; POST — запустить проверку текущего режима сейчас.
+func (h *TunHandlers) handleIPv6Check(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		settings, err := config.LoadAppSettings(config.AppSettingsFile)
+		if err != nil {
+			settings = config.DefaultAppSettings()
+		}
+		h.mu.RLock()
+		mode := h.routing.IPv6Mode
+		h.mu.RUnlock()
+		h.server.respondJSON(w, http.StatusOK, h.runIPv6Check(r.Context(), mode, settings.LeakTest.DisableIPv6OnTunnel))
+		return
+	}
+	h.ipv6Check.mu.Lock()
+	last := h.ipv6Check.last
+	h.ipv6Check.mu.Unlock()
+	if last == nil {
+		h.server.respondError(w, http.StatusNotFound, "проверка IPv6 ещё не выполнялась")
+		return
+	}
+	h.server.respondJSON(w, http.StatusOK, last)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/ipv6mitigation"
+	"proxyclient/internal/leaktest"
+)
+
+func TestIPv6ModeSettingAndCheck(t *testing.T) {
+	srv, h, cleanup := buildTunServer(t)
+	defer cleanup()
+
+	if w := putJSON(t, srv.router, "/api/tun/rules", map[string]interface{}{"rules": []config.RoutingRule{}, "ipv6_mode": "ipv6-only"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid ipv6_mode = %d, want 400", w.Code)
+	}
+	if w := putJSON(t, srv.router, "/api/tun/rules", map[string]interface{}{"rules": []config.RoutingRule{}, "ipv6_mode": "dual-stack"}); w.Code != http.StatusOK {
+		t.Fatalf("PUT rules = %d, body=%s", w.Code, w.Body.String())
+	}
+	var rules RulesResponse
+	if err := json.NewDecoder(getJSON(t, srv.router, "/api/tun/rules").Body).Decode(&rules); err != nil {
+		t.Fatal(err)
+	}
+	if rules.IPv6Mode != config.IPv6ModeDualStack {
+		t.Fatalf("ipv6_mode = %q", rules.IPv6Mode)
+	}
+	if diff := computeRoutingDiff(config.DefaultRoutingConfig(), h.routing); !diff.IPv6ModeChanged {
+		t.Error("mode change must force a full restart")
+	}
+
+	if w := getJSON(t, srv.router, "/api/tun/ipv6/check"); w.Code != http.StatusNotFound {
+		t.Errorf("check before first run = %d, want 404", w.Code)
+	}
+
+	// Прошлая утечка в ipv4-only выключила IPv6 на адаптере — в dual-stack
+	// его нужно вернуть до замера.
+	if err := ipv6mitigation.SaveState(ipv6StatePath(), ipv6mitigation.State{Active: true, Interface: "Ethernet"}); err != nil {
+		t.Fatal(err)
+	}
+	origRestore, origDisable := ipv6Restore, ipv6Disable
+	defer func() { ipv6Restore, ipv6Disable = origRestore, origDisable }()
+	var restored, disabled int
+	ipv6Restore = func(context.Context, string) error { restored++; return nil }
+	ipv6Disable = func(context.Context, string, string) error { disabled++; return nil }
+	var probedMode config.IPv6Mode
+	h.ipv6ProbeFn = func(_ context.Context, mode config.IPv6Mode) (*leaktest.IPv6Report, error) {
+		probedMode = mode
+		return &leaktest.IPv6Report{Available: true, Address: "2001:db8::10", Interface: "Ethernet", Leaked: true, Status: "ipv6_direct"}, nil
+	}
+	w := postJSON(t, srv.router, "/api/tun/ipv6/check", nil)
+	var check IPv6ModeCheck
+	if err := json.NewDecoder(w.Body).Decode(&check); err != nil {
+		t.Fatal(err)
+	}
+	if probedMode != config.IPv6ModeDualStack || check.Mode != config.IPv6ModeDualStack {
+		t.Errorf("probe mode = %q, check = %+v", probedMode, check)
+	}
+	if check.Mitigation != "restored" || restored != 1 || check.Report == nil || !check.Report.Leaked {
+		t.Errorf("check = %+v, restored = %d", check, restored)
+	}
+
+	// В ipv4-only с disable_ipv6_on_tunnel утечка выключает IPv6 на адаптере.
+	check = *h.runIPv6Check(context.Background(), config.IPv6ModeIPv4Only, true)
+	if check.Mitigation != "disabled" || disabled != 1 || restored != 1 {
+		t.Errorf("ipv4-only check = %+v, disabled = %d", check, disabled)
+	}
+	if w := getJSON(t, srv.router, "/api/tun/ipv6/check"); w.Code != http.StatusOK {
+		t.Errorf("last check = %d, want 200", w.Code)
+	}
+}
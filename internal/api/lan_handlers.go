@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"proxyclient/internal/config"
+)
+
+// maxLANClientHosts — сколько адресов назначения показывать на клиента.
+const maxLANClientHosts = 10
+
+// lanClient — активные соединения одного устройства локальной сети.
+type lanClient struct {
+	IP          string   `json:"ip"`
+	Connections int      `json:"connections"`
+	Upload      int64    `json:"upload"`
+	Download    int64    `json:"download"`
+	Hosts       []string `json:"hosts"`
+	Outbounds   []string `json:"outbounds"`
+}
+
+// lanClientsFromConns группирует соединения LAN-inbound'а по адресу клиента.
+// Клиенты отсортированы по объёму трафика.
+func lanClientsFromConns(conns []clashConn) []lanClient {
+	byIP := map[string]*lanClient{}
+	for _, c := range conns {
+		if !strings.HasSuffix(c.Metadata.Type, "/"+config.LANInboundTag) {
+			continue
+		}
+		ip := c.Metadata.SourceIP
+		if ip == "" {
+			ip = "unknown"
+		}
+		cl := byIP[ip]
+		if cl == nil {
+			cl = &lanClient{IP: ip, Hosts: []string{}, Outbounds: []string{}}
+			byIP[ip] = cl
+		}
+		cl.Connections++
+		cl.Upload += c.Upload
+		cl.Download += c.Download
+		target := c.Metadata.Host
+		if target == "" {
+			target = c.Metadata.DestinationIP
+		}
+		if target != "" && len(cl.Hosts) < maxLANClientHosts && !slices.Contains(cl.Hosts, target) {
+			cl.Hosts = append(cl.Hosts, target)
+		}
+		if out := c.effectiveOutbound(); out != "" && !slices.Contains(cl.Outbounds, out) {
+			cl.Outbounds = append(cl.Outbounds, out)
+		}
+	}
+	clients := make([]lanClient, 0, len(byIP))
+	for _, cl := range byIP {
+		clients = append(clients, *cl)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		ti, tj := clients[i].Upload+clients[i].Download, clients[j].Upload+clients[j].Download
+		if ti != tj {
+			return ti > tj
+		}
+		return clients[i].IP < clients[j].IP
+	})
+	return clients
+}
+
+// handleLANClients GET /api/lan/clients — устройства локальной сети, которые
+// сейчас ходят через раздачу, по активным соединениям Clash API.
+func (s *Server) handleLANClients(w http.ResponseWriter, r *http.Request) {
+	conns, err := fetchClashConnections(r.Context())
+	if err != nil {
+		s.respondJSON(w, http.StatusOK, map[string]interface{}{"clients": []lanClient{}, "error": err.Error()})
+		return
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"clients": lanClientsFromConns(conns)})
+}
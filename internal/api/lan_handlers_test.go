@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"proxyclient/internal/config"
+)
+
+func TestLANShareSettingsAndClients(t *testing.T) {
+	srv, h, cleanup := buildTunServer(t)
+	defer cleanup()
+
+	for _, body := range []map[string]interface{}{
+		{"lan_users": []config.LANUser{{Username: "a:b", Password: "x"}}},
+		{"lan_allow_cidrs": []string{"192.168.1.0/33"}},
+		{"lan_policy": "direct"},
+	} {
+		body["rules"] = []config.RoutingRule{}
+		if w := putJSON(t, srv.router, "/api/tun/rules", body); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %v = %d, want 400", body, w.Code)
+		}
+	}
+	w := putJSON(t, srv.router, "/api/tun/rules", map[string]interface{}{
+		"rules":             []config.RoutingRule{},
+		"lan_share_enabled": true,
+		"lan_users":         []config.LANUser{{Username: "guest", Password: "pw"}},
+		"lan_allow_cidrs":   []string{"192.168.1.0/24", "10.0.0.7"},
+		"lan_policy":        "proxy",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT rules = %d, body=%s", w.Code, w.Body.String())
+	}
+	var rules RulesResponse
+	if err := json.NewDecoder(getJSON(t, srv.router, "/api/tun/rules").Body).Decode(&rules); err != nil {
+		t.Fatal(err)
+	}
+	if rules.LANPolicy != config.LANPolicyProxy || len(rules.LANUsers) != 1 ||
+		!slices.Equal(rules.LANAllowCIDRs, []string{"192.168.1.0/24", "10.0.0.7/32"}) {
+		t.Fatalf("rules = %+v", rules)
+	}
+	// Omitted LAN fields keep their values.
+	if w := putJSON(t, srv.router, "/api/tun/rules", map[string]interface{}{"rules": []config.RoutingRule{}}); w.Code != http.StatusOK {
+		t.Fatalf("PUT rules = %d", w.Code)
+	}
+	if h.routing.LANPolicy != config.LANPolicyProxy || len(h.routing.LANAllowCIDRs) != 2 {
+		t.Fatalf("routing after partial PUT = %+v", h.routing)
+	}
+
+	clashMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"connections":[
+			{"id":"1","chains":["proxy-out"],"upload":10,"download":100,"metadata":{"type":"mixed/lan-in","sourceIP":"192.168.1.20","host":"example.com"}},
+			{"id":"2","chains":["proxy-out"],"upload":5,"download":5,"metadata":{"type":"mixed/lan-in","sourceIP":"192.168.1.20","host":"example.com"}},
+			{"id":"3","chains":["proxy-out"],"upload":1,"download":1,"metadata":{"type":"mixed/lan-in","sourceIP":"10.0.0.7","destinationIP":"1.1.1.1"}},
+			{"id":"4","chains":["direct"],"upload":999,"download":999,"metadata":{"type":"tun/tun-in","sourceIP":"172.19.0.1","host":"local.example"}}
+		]}`))
+	}))
+	defer clashMock.Close()
+	origURL := clashAPIBaseURL
+	clashAPIBaseURL = clashMock.URL
+	defer func() { clashAPIBaseURL = origURL }()
+
+	var resp struct {
+		Clients []lanClient `json:"clients"`
+	}
+	// setupRoutes registers the route on Start; call the handler directly.
+	w = httptest.NewRecorder()
+	srv.handleLANClients(w, httptest.NewRequest(http.MethodGet, "/api/lan/clients", nil))
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("%v: %d %s", err, w.Code, w.Body.String())
+	}
+	if len(resp.Clients) != 2 {
+		t.Fatalf("clients = %+v", resp.Clients)
+	}
+	first, second := resp.Clients[0], resp.Clients[1]
+	if first.IP != "192.168.1.20" || first.Connections != 2 || first.Download != 105 ||
+		!slices.Equal(first.Hosts, []string{"example.com"}) || !slices.Equal(first.Outbounds, []string{"proxy-out"}) {
+		t.Errorf("first client = %+v", first)
+	}
+	if second.IP != "10.0.0.7" || !slices.Equal(second.Hosts, []string{"1.1.1.1"}) {
+		t.Errorf("second client = %+v", second)
+	}
+}
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/fileutil"
+	"proxyclient/internal/proxy"
+	"proxyclient/internal/srs"
+)
+
+// PACPath — адрес PAC-файла на HTTP API. Путь вне /api: браузеры и WinINet
+// запрашивают его без токена.
+const PACPath = "/proxy.pac"
+
+// PACURL — значение AutoConfigURL для Windows в режиме PAC.
+var PACURL = fmt.Sprintf("http://127.0.0.1:%d%s", config.APIPort, PACPath)
+
+// pacFile — последний PAC, собранный при успешном apply.
+var pacFile = filepath.Join(config.DataDir, "proxy.pac")
+
+// maxPACSetEntries ограничивает разворачивание одной geosite/geoip категории:
+// geosite-cn содержит сотни тысяч доменов, такой PAC браузер не переварит.
+const maxPACSetEntries = 20000
+
+// SystemProxyConfig возвращает конфигурацию системного прокси по настройкам:
+// фиксированный ProxyServer или PAC (settings.proxy_auto_config).
+func SystemProxyConfig() proxy.Config {
+	cfg := proxy.Config{Address: DefaultProxyAddress, Override: DefaultProxyOverride}
+	if settings, err := config.LoadAppSettings(config.AppSettingsFile); err == nil && settings.ProxyAutoConfig {
+		cfg.AutoConfigURL = PACURL
+	}
+	return cfg
+}
+
+// pacRule — условия одного результата PAC в порядке проверки.
+type pacRule struct {
+	result   string
+	exact    map[string]bool
+	suffix   map[string]bool
+	keywords []string
+	ranges   [][2]uint32
+	// sets — категории, развёрнутые в это правило, для комментария в файле.
+	sets []string
+}
+
+func newPACRule(result string) *pacRule {
+	return &pacRule{result: result, exact: map[string]bool{}, suffix: map[string]bool{}}
+}
+
+func (r *pacRule) empty() bool {
+	return len(r.exact)+len(r.suffix)+len(r.keywords)+len(r.ranges) == 0
+}
+
+func (r *pacRule) addCIDR(cidr string) {
+	p, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(cidr)
+		if addrErr != nil {
+			return
+		}
+		p = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	if !p.Addr().Is4() {
+		return // IPv6 в PAC проверяется только расширениями IE — пропускаем.
+	}
+	p = p.Masked()
+	from := binary.BigEndian.Uint32(p.Addr().AsSlice())
+	to := from | uint32(1<<(32-p.Bits())-1)
+	r.ranges = append(r.ranges, [2]uint32{from, to})
+}
+
+// addRuleValue добавляет domain/keyword/IP правило. Домен без точки в начале,
+// как и в sing-box конфиге, покрывает сам домен и поддомены.
+func (r *pacRule) addRuleValue(rule config.RoutingRule) bool {
+	switch rule.Type {
+	case config.RuleTypeDomain:
+		r.suffix[strings.TrimPrefix(rule.Value, ".")] = true
+	case config.RuleTypeKeyword:
+		r.keywords = append(r.keywords, strings.TrimPrefix(rule.Value, "keyword:"))
+	case config.RuleTypeIP:
+		r.addCIDR(rule.Value)
+	default:
+		return false
+	}
+	return true
+}
+
+// addSet разворачивает локальный rule-set. Логические, инвертированные и
+// regex-условия в PAC не переносятся.
+func (r *pacRule) addSet(name string, rs *srs.RuleSet) bool {
+	n := 0
+	for _, rule := range rs.Rules {
+		if rule.Type != srs.RuleDefault || rule.Invert {
+			continue
+		}
+		domains, suffixes := rule.Domain.Domains()
+		n += len(domains) + len(suffixes) + len(rule.DomainKeyword) + len(rule.IPCIDR)
+		if n > maxPACSetEntries {
+			return false
+		}
+	}
+	for _, rule := range rs.Rules {
+		if rule.Type != srs.RuleDefault || rule.Invert {
+			continue
+		}
+		domains, suffixes := rule.Domain.Domains()
+		for _, d := range domains {
+			r.exact[d] = true
+		}
+		for _, s := range suffixes {
+			r.suffix[strings.TrimPrefix(s, ".")] = true
+		}
+		r.keywords = append(r.keywords, rule.DomainKeyword...)
+		for _, ipr := range rule.IPCIDR {
+			for _, p := range ipr.Prefixes() {
+				r.addCIDR(p.String())
+			}
+		}
+	}
+	r.sets = append(r.sets, name)
+	return true
+}
+
+// pacSetPath — локальный файл для geosite:, geoip: или ruleset: правила.
+// "" — файла нет или он не в бинарном формате sing-box.
+func pacSetPath(routing *config.RoutingConfig, value string) string {
+	if tag, ok := strings.CutPrefix(value, "ruleset:"); ok {
+		rs, found := routing.FindRuleSet(tag)
+		if !found || rs.Format != config.RuleSetFormatBinary {
+			return ""
+		}
+		return config.RemoteRuleSetPath(rs)
+	}
+	if code, ok := strings.CutPrefix(value, "geoip:"); ok {
+		return filepath.Join(config.DataDir, "geoip-"+code+".bin")
+	}
+	return geositePath(strings.TrimPrefix(value, "geosite:"))
+}
+
+// buildPAC собирает PAC из правил маршрутизации. Порядок повторяет sing-box:
+// block, затем конкретные домены и IP (direct раньше proxy), затем
+// geosite/geoip/rule-set. Block отправляется в прокси — sing-box сам отклонит
+// соединение. Process, port и network правила в PAC не выражаются и
+// перечисляются в skipped.
+func buildPAC(routing *config.RoutingConfig, proxyAddr string) (pac []byte, skipped []string) {
+	if routing == nil {
+		routing = config.DefaultRoutingConfig()
+	}
+	proxyResult := "PROXY " + proxyAddr
+	local := newPACRule("DIRECT")
+	local.suffix["localhost"] = true
+	for _, cidr := range []string{"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16"} {
+		local.addCIDR(cidr)
+	}
+	rules := []*pacRule{local}
+
+	defaultResult := proxyResult
+	if routing.DefaultAction == config.ActionDirect && !routing.BypassEnabled {
+		defaultResult = "DIRECT"
+	}
+
+	if !routing.BypassEnabled {
+		blockVals, directVals, proxyVals := newPACRule(proxyResult), newPACRule("DIRECT"), newPACRule(proxyResult)
+		blockSets, directSets, proxySets := newPACRule(proxyResult), newPACRule("DIRECT"), newPACRule(proxyResult)
+		for _, rule := range routing.Rules {
+			vals, sets := proxyVals, proxySets
+			switch rule.Action {
+			case config.ActionDirect:
+				vals, sets = directVals, directSets
+			case config.ActionBlock:
+				vals, sets = blockVals, blockSets
+			}
+			switch rule.Type {
+			case config.RuleTypeGeosite, config.RuleTypeGeoIP, config.RuleTypeRuleSet:
+				path := pacSetPath(routing, rule.Value)
+				rs, err := loadGeositeSet(path)
+				if path == "" || err != nil || !sets.addSet(rule.Value, rs) {
+					skipped = append(skipped, rule.Value)
+				}
+			default:
+				if !vals.addRuleValue(rule) {
+					skipped = append(skipped, rule.Value)
+				}
+			}
+		}
+		// Block объединяется с остальными в порядке sing-box: все block-условия
+		// раньше любых direct.
+		for _, r := range []*pacRule{blockVals, blockSets, directVals, proxyVals, directSets, proxySets} {
+			if !r.empty() {
+				rules = append(rules, r)
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// SafeSky PAC, собран %s из routing.json. Не редактируйте: файл\n", time.Now().UTC().Format(time.RFC3339))
+	b.WriteString("// перезаписывается при каждом применении правил.\n")
+	for _, v := range skipped {
+		fmt.Fprintf(&b, "// не перенесено в PAC: %s\n", v)
+	}
+	b.WriteString("var rules = [\n")
+	for _, r := range rules {
+		if len(r.sets) > 0 {
+			fmt.Fprintf(&b, "  // %s\n", strings.Join(r.sets, ", "))
+		}
+		fmt.Fprintf(&b, "  [%s, %s, %s, %s, %s],\n",
+			pacJSON(r.result), pacJSON(r.exact), pacJSON(r.suffix), pacJSON(r.keywords), pacJSON(r.ranges))
+	}
+	b.WriteString("];\n")
+	fmt.Fprintf(&b, "var fallback = %s;\n", pacJSON(defaultResult))
+	b.WriteString(pacFunctions)
+	return []byte(b.String()), skipped
+}
+
+func pacJSON(v any) string {
+	switch x := v.(type) {
+	case []string:
+		if x == nil {
+			v = []string{}
+		}
+	case [][2]uint32:
+		if x == nil {
+			v = [][2]uint32{}
+		}
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+const pacFunctions = `
+function ipv4(host) {
+  var p = host.split(".");
+  if (p.length !== 4) return -1;
+  var n = 0;
+  for (var i = 0; i < 4; i++) {
+    if (!/^\d{1,3}$/.test(p[i]) || +p[i] > 255) return -1;
+    n = n * 256 + +p[i];
+  }
+  return n;
+}
+
+function matches(r, host, ip) {
+  if (r[1].hasOwnProperty(host)) return true;
+  for (var h = host; ; h = h.substring(h.indexOf(".") + 1)) {
+    if (r[2].hasOwnProperty(h)) return true;
+    if (h.indexOf(".") < 0) break;
+  }
+  for (var i = 0; i < r[3].length; i++) {
+    if (host.indexOf(r[3][i]) >= 0) return true;
+  }
+  if (ip >= 0) {
+    for (var j = 0; j < r[4].length; j++) {
+      if (ip >= r[4][j][0] && ip <= r[4][j][1]) return true;
+    }
+  }
+  return false;
+}
+
+function FindProxyForURL(url, host) {
+  host = host.toLowerCase().replace(/\.$/, "");
+  if (isPlainHostName(host)) return "DIRECT";
+  var ip = ipv4(host);
+  for (var i = 0; i < rules.length; i++) {
+    if (matches(rules[i], host, ip)) return rules[i][0];
+  }
+  return fallback;
+}
+`
+
+// writePAC пересобирает data/proxy.pac после успешного apply.
+func (h *TunHandlers) writePAC(routing *config.RoutingConfig) {
+	pac, skipped := buildPAC(routing, config.ProxyAddr)
+	if err := fileutil.WriteAtomic(pacFile, pac, 0644); err != nil {
+		h.server.logger.Warn("PAC: не удалось записать %s: %v", pacFile, err)
+		return
+	}
+	if len(skipped) > 0 {
+		h.server.logger.Debug("PAC: %d правил не перенесено (process/port/network или нет локального файла)", len(skipped))
+	}
+}
+
+// handlePAC GET /proxy.pac — PAC последнего apply. До первого apply файл
+// собирается из текущих правил.
+func (s *Server) handlePAC(w http.ResponseWriter, _ *http.Request) {
+	data, err := os.ReadFile(pacFile)
+	if err != nil {
+		var routing *config.RoutingConfig
+		if s.tunHandlers != nil {
+			s.tunHandlers.mu.RLock()
+			routing = cloneRoutingConfig(s.tunHandlers.routing)
+			s.tunHandlers.mu.RUnlock()
+		}
+		data, _ = buildPAC(routing, config.ProxyAddr)
+	}
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/srs"
+)
+
+func TestBuildPACOrdersRulesAndExpandsGeosite(t *testing.T) {
+	srv, h, cleanup := buildTunServer(t)
+	defer cleanup()
+
+	rule, err := srs.ParseTextList(strings.NewReader("full:vpn.corp\ncorp.example\n10.20.0.0/16\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := srs.Marshal(&srs.RuleSet{Rules: []srs.Rule{*rule}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config.DataDir, "geosite-work.bin"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	routing := &config.RoutingConfig{
+		DefaultAction: config.ActionDirect,
+		Rules: []config.RoutingRule{
+			{Value: "youtube.com", Type: config.RuleTypeDomain, Action: config.ActionProxy},
+			{Value: "ads.example", Type: config.RuleTypeDomain, Action: config.ActionBlock},
+			{Value: "geosite:work", Type: config.RuleTypeGeosite, Action: config.ActionDirect},
+			{Value: "geosite:missing", Type: config.RuleTypeGeosite, Action: config.ActionProxy},
+			{Value: "telegram.exe", Type: config.RuleTypeProcess, Action: config.ActionProxy},
+			{Value: "1.2.3.0/24", Type: config.RuleTypeIP, Action: config.ActionDirect},
+		},
+	}
+	pac, skipped := buildPAC(routing, config.ProxyAddr)
+	if strings.Join(skipped, ",") != "geosite:missing,telegram.exe" {
+		t.Errorf("skipped = %v", skipped)
+	}
+	text := string(pac)
+	proxyLine := `["PROXY 127.0.0.1:10807"`
+	block := strings.Index(text, `{"ads.example":true}`)
+	direct := strings.Index(text, `[16909056,16909311]`)
+	proxied := strings.Index(text, `{"youtube.com":true}`)
+	work := strings.Index(text, `{"vpn.corp":true}`)
+	if block < 0 || direct < 0 || proxied < 0 || work < 0 {
+		t.Fatalf("PAC is missing rules:\n%s", text)
+	}
+	if !(block < direct && direct < proxied && proxied < work) {
+		t.Errorf("rule order block=%d direct=%d proxy=%d geosite=%d", block, direct, proxied, work)
+	}
+	if !strings.Contains(text, `{"corp.example":true}`) || !strings.Contains(text, `var fallback = "DIRECT";`) ||
+		strings.Count(text, proxyLine) != 2 || !strings.Contains(text, "function FindProxyForURL(url, host)") {
+		t.Errorf("unexpected PAC:\n%s", text)
+	}
+
+	// Apply writes data/proxy.pac; /proxy.pac serves it without a token.
+	h.writePAC(routing)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, PACPath, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ns-proxy-autoconfig" ||
+		!strings.Contains(w.Body.String(), `{"youtube.com":true}`) {
+		t.Fatalf("GET %s = %d %q", PACPath, w.Code, w.Body.String())
+	}
+}
+
+func TestSystemProxyConfigFollowsSettings(t *testing.T) {
+	_, _, cleanup := buildTunServer(t)
+	defer cleanup()
+
+	if cfg := SystemProxyConfig(); cfg.AutoConfigURL != "" || cfg.Address != DefaultProxyAddress {
+		t.Fatalf("default config = %+v", cfg)
+	}
+	settings := config.DefaultAppSettings()
+	settings.ProxyAutoConfig = true
+	if err := config.SaveAppSettings(config.AppSettingsFile, settings); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := SystemProxyConfig(); cfg.AutoConfigURL != "http://127.0.0.1:8080/proxy.pac" {
+		t.Fatalf("PAC config = %+v", cfg)
+	}
+}
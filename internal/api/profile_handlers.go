@@ -83,6 +83,7 @@ func SetupProfileRoutes(s *Server) {
 		metaCache: make(map[string]profileMeta),
 	}
 	_ = os.MkdirAll(profilesDir, 0755)
+	s.profileHandlers = h
 
 	s.router.HandleFunc("/api/profiles", h.handleList).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/profiles", h.handleSave).Methods("POST", "OPTIONS")
@@ -508,22 +509,45 @@ func (h *ProfileHandlers) handleExport(w http.ResponseWriter, r *http.Request) {
 
 // handleApply POST /api/profiles/{name}/apply — применяет профиль к текущему routing.
 func (h *ProfileHandlers) handleApply(w http.ResponseWriter, r *http.Request) {
-	name := mux.Vars(r)["name"]
-	if !reValidName.MatchString(name) {
-		h.server.respondError(w, http.StatusBadRequest, "недопустимое имя профиля")
+	res, status, err := h.applyProfile(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		h.server.respondError(w, status, err.Error())
 		return
 	}
+	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":           fmt.Sprintf("профиль %q применён", res.Profile.Name),
+		"count":             res.Count,
+		"apply_error":       res.ApplyError,
+		"app_rules_applied": res.AppRulesApplied,
+		"connected_id":      res.ConnectedID,
+	})
+}
+
+// profileApplyResult — итог applyProfile.
+type profileApplyResult struct {
+	Profile         *Profile
+	Count           int
+	ApplyError      string
+	AppRulesApplied bool
+	ConnectedID     string
+}
+
+// applyProfile применяет профиль name: routing, app rules и выбор сервера.
+// Возвращает HTTP-статус для ошибки — профиль применяют и из UI, и
+// автоматически (исчерпание квоты подписки).
+func (h *ProfileHandlers) applyProfile(ctx context.Context, name string) (*profileApplyResult, int, error) {
+	if !reValidName.MatchString(name) {
+		return nil, http.StatusBadRequest, errors.New("недопустимое имя профиля")
+	}
 	if h.server.tunHandlers == nil {
-		h.server.respondError(w, http.StatusServiceUnavailable, "TUN routing не инициализирован")
-		return
+		return nil, http.StatusServiceUnavailable, errors.New("TUN routing не инициализирован")
 	}
 
 	h.mu.RLock()
 	p, err := loadProfile(sanitizeFilename(name) + ".json")
 	h.mu.RUnlock()
 	if err != nil {
-		h.server.respondError(w, http.StatusNotFound, "профиль не найден")
-		return
+		return nil, http.StatusNotFound, errors.New("профиль не найден")
 	}
 
 	count, applyErr, err := h.server.tunHandlers.replaceRoutingAndApply(p.Routing)
@@ -533,33 +557,25 @@ func (h *ProfileHandlers) handleApply(w http.ResponseWriter, r *http.Request) {
 			status = http.StatusInternalServerError
 			h.server.logger.Error("handleApplyProfile: не удалось сохранить routing config: %v", err)
 		}
-		h.server.respondError(w, status, err.Error())
-		return
+		return nil, status, err
 	}
 	if applyErr != "" {
 		h.server.logger.Warn("handleApplyProfile: TriggerApply: %v", applyErr)
 	}
-	appRulesApplied := false
+	res := &profileApplyResult{Profile: p, Count: count, ApplyError: applyErr}
 	if len(p.AppRules) > 0 {
-		storage := apprules.NewFileStorage(filepath.Join(config.DataDir, "app_rules.json"))
+		storage := apprules.NewFileStorage(config.AppRulesFile)
 		if err := storage.Save(p.AppRules); err != nil {
-			h.server.respondError(w, http.StatusInternalServerError, "app rules: "+err.Error())
-			return
+			return nil, http.StatusInternalServerError, fmt.Errorf("app rules: %w", err)
 		}
-		appRulesApplied = true
+		res.AppRulesApplied = true
 	}
-	connectedID, connectErr := h.applyProfileServerSelector(r.Context(), p)
+	connectedID, connectErr := h.applyProfileServerSelector(ctx, p)
 	if connectErr != nil {
-		h.server.respondError(w, http.StatusConflict, connectErr.Error())
-		return
+		return nil, http.StatusConflict, connectErr
 	}
-	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
-		"message":           fmt.Sprintf("профиль %q применён", p.Name),
-		"count":             count,
-		"apply_error":       applyErr,
-		"app_rules_applied": appRulesApplied,
-		"connected_id":      connectedID,
-	})
+	res.ConnectedID = connectedID
+	return res, http.StatusOK, nil
 }
 
 func (h *ProfileHandlers) applyProfileServerSelector(ctx context.Context, p *Profile) (string, error) {
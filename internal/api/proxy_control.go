@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"proxyclient/internal/config"
+	"proxyclient/internal/connhistory"
 	"proxyclient/internal/logger"
 	"proxyclient/internal/proxy"
 )
@@ -22,10 +23,7 @@ type clashModeRequest struct {
 }
 
 func defaultProxyConfig() proxy.Config {
-	return proxy.Config{
-		Address:  DefaultProxyAddress,
-		Override: DefaultProxyOverride,
-	}
+	return SystemProxyConfig()
 }
 
 func (s *Server) markProxyEnabledAt(t time.Time) {
@@ -49,12 +47,26 @@ func (s *Server) enableSystemProxy() error {
 	return nil
 }
 
+// reapplySystemProxy переключает включённый системный прокси между
+// ProxyServer и PAC после смены настройки.
+func (s *Server) reapplySystemProxy() {
+	s.proxyOpMu.Lock()
+	defer s.proxyOpMu.Unlock()
+	if s.config.ProxyManager == nil || !s.config.ProxyManager.IsEnabled() {
+		return
+	}
+	if err := s.config.ProxyManager.Enable(defaultProxyConfig()); err != nil {
+		s.logger.Warn("Не удалось переключить режим системного прокси: %v", err)
+	}
+}
+
 func (s *Server) disableSystemProxy() error {
 	s.config.ProxyManager.PauseGuard(3 * time.Second)
 	if err := s.config.ProxyManager.Disable(); err != nil {
 		return err
 	}
 	s.clearProxyEnabledAt()
+	connhistory.Global.Add(connhistory.Event{Time: time.Now(), Kind: connhistory.EventDisconnect, Reason: "system proxy disabled"})
 	return nil
 }
 
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"strconv"
+	"os"
 	"strings"
 
 	"proxyclient/internal/config"
@@ -35,6 +35,7 @@ func SetupRoutingVisualRoutes(s *Server) {
 	api.HandleFunc("/routing/visual/conflicts", s.handleVisualRoutingConflicts).Methods("GET", "OPTIONS")
 	api.HandleFunc("/routing/visual/conflicts", s.handleVisualRoutingCheckConflicts).Methods("POST", "OPTIONS")
 	api.HandleFunc("/routing/visual/test", s.handleVisualRoutingTest).Methods("POST", "OPTIONS")
+	api.HandleFunc("/routing/dry-run", s.handleRoutingDryRun).Methods("POST", "OPTIONS")
 }
 
 func (s *Server) handleVisualRoutingGet(w http.ResponseWriter, _ *http.Request) {
@@ -142,6 +143,37 @@ func (s *Server) handleVisualRoutingTest(w http.ResponseWriter, r *http.Request)
 	s.respondJSON(w, http.StatusOK, result)
 }
 
+// handleRoutingDryRun POST /api/routing/dry-run {"domain":"www.youtube.com","port":443,"process":"chrome.exe"}
+// — какое правило сгенерированного config.singbox.json сработает для соединения.
+// В отличие от /routing/visual/test учитывает порядок buildRoute, служебные
+// правила (LAN, Telegram, STUN, IPv6, QUIC) и содержимое geosite-файлов.
+func (s *Server) handleRoutingDryRun(w http.ResponseWriter, r *http.Request) {
+	var req routing.Conn
+	if !decodeStrictJSON(w, r, &req, maxRoutingVisualRequestBytes) {
+		return
+	}
+	data, err := os.ReadFile(s.config.ConfigPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.respondError(w, http.StatusConflict, "config.singbox.json ещё не сгенерирован — примените правила")
+			return
+		}
+		s.respondError(w, http.StatusInternalServerError, "не удалось прочитать config.singbox.json: "+err.Error())
+		return
+	}
+	engine, err := routing.ParseDryRunConfig(data, nil)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result, err := engine.Evaluate(req)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, result)
+}
+
 func visualRulesFromConfig(cfg *config.RoutingConfig) []routing.RoutingRule {
 	if cfg == nil {
 		return nil
@@ -163,6 +195,7 @@ func visualRulesFromConfig(cfg *config.RoutingConfig) []routing.RoutingRule {
 				Values: []string{visualRuleValue(matchType, value)},
 			},
 			Action: string(rule.Action),
+			Server: rule.Server,
 		})
 	}
 	return out
@@ -176,8 +209,8 @@ func visualRulesToConfig(rules []routing.RoutingRule) ([]config.RoutingRule, err
 		if !rule.Enabled {
 			continue
 		}
-		if rule.Server != "" {
-			return nil, fmt.Errorf("rule %q uses per-server routing, which is not supported by current routing config", visualRuleLabel(rule))
+		if rule.Server != "" && normalizeVisualAction(rule.Action) != string(config.ActionProxy) {
+			return nil, fmt.Errorf("rule %q: server is only allowed for proxy action", visualRuleLabel(rule))
 		}
 		if rule.Match.Inverse {
 			return nil, fmt.Errorf("rule %q uses inverse match, which is not supported by current routing config", visualRuleLabel(rule))
@@ -194,11 +227,16 @@ func visualRulesToConfig(rules []routing.RoutingRule) ([]config.RoutingRule, err
 			if value == "" {
 				continue
 			}
+			valueType := ruleType
+			if detected := config.DetectRuleType(value); config.IsProcessRuleType(ruleType) && config.IsProcessRuleType(detected) {
+				valueType = detected
+			}
 			out = append(out, config.RoutingRule{
 				Value:  value,
-				Type:   ruleType,
+				Type:   valueType,
 				Action: config.RuleAction(normalizeVisualAction(rule.Action)),
 				Note:   visualRuleLabel(rule),
+				Server: strings.TrimSpace(rule.Server),
 			})
 		}
 	}
@@ -215,7 +253,7 @@ func sortVisualRules(rules []routing.RoutingRule) {
 
 func visualMatchType(t config.RuleType, value string) string {
 	switch t {
-	case config.RuleTypeProcess:
+	case config.RuleTypeProcess, config.RuleTypeProcessPath:
 		return "process"
 	case config.RuleTypeIP:
 		if strings.Contains(value, "/") {
@@ -224,18 +262,37 @@ func visualMatchType(t config.RuleType, value string) string {
 		return "ip"
 	case config.RuleTypeGeosite:
 		return "geosite"
+	case config.RuleTypeGeoIP:
+		return "geoip"
+	case config.RuleTypeKeyword:
+		return "domain_keyword"
+	case config.RuleTypeRegex:
+		return "domain_regex"
+	case config.RuleTypePort:
+		return "port"
+	case config.RuleTypeNetwork:
+		return "network"
 	default:
 		return "domain_suffix"
 	}
 }
 
+// visualValuePrefixes — префикс значения в routing.json для типов визуального
+// редактора, которые хранят значение без него.
+var visualValuePrefixes = map[string]string{
+	"geosite":        "geosite:",
+	"geoip":          "geoip:",
+	"domain_keyword": "keyword:",
+	"domain_regex":   "regex:",
+	"port":           "port:",
+	"network":        "network:",
+}
+
 func visualRuleValue(matchType, value string) string {
-	switch matchType {
-	case "geosite":
-		return strings.TrimPrefix(value, "geosite:")
-	default:
-		return value
+	if prefix, ok := visualValuePrefixes[matchType]; ok {
+		return strings.TrimPrefix(value, prefix)
 	}
+	return value
 }
 
 func visualRuleName(rule config.RoutingRule, value string) string {
@@ -250,15 +307,22 @@ func configTypeForVisualMatch(matchType string) (config.RuleType, error) {
 	case "domain", "domain_suffix":
 		return config.RuleTypeDomain, nil
 	case "domain_keyword":
-		return "", fmt.Errorf("domain_keyword persistence requires sing-box route builder support")
+		return config.RuleTypeKeyword, nil
+	case "domain_regex":
+		return config.RuleTypeRegex, nil
 	case "ip", "ip_cidr":
 		return config.RuleTypeIP, nil
 	case "process":
+		// Полный путь visualRulesToConfig сохраняет как process_path.
 		return config.RuleTypeProcess, nil
 	case "geosite":
 		return config.RuleTypeGeosite, nil
-	case "geoip", "port":
-		return "", fmt.Errorf("%s persistence requires sing-box route builder support", matchType)
+	case "geoip":
+		return config.RuleTypeGeoIP, nil
+	case "port":
+		return config.RuleTypePort, nil
+	case "network":
+		return config.RuleTypeNetwork, nil
 	default:
 		return "", fmt.Errorf("unsupported match type %q", matchType)
 	}
@@ -286,11 +350,12 @@ func normalizeVisualRuleValue(matchType, raw string) string {
 			return network.String()
 		}
 		return config.NormalizeRuleValue(value)
-	case "port":
-		if n, err := strconv.Atoi(value); err == nil && n > 0 && n <= 65535 {
-			return strconv.Itoa(n)
+	case "geoip", "domain_keyword", "domain_regex", "port", "network":
+		prefix := visualValuePrefixes[matchType]
+		if strings.HasPrefix(strings.ToLower(value), prefix) {
+			value = value[len(prefix):]
 		}
-		return ""
+		return config.NormalizeRuleValue(prefix + value)
 	default:
 		return config.NormalizeRuleValue(value)
 	}
@@ -315,7 +380,7 @@ func visualOutbound(rule routing.RoutingRule) string {
 		return "block"
 	default:
 		if rule.Server != "" {
-			return rule.Server
+			return config.ServerOutboundTag(rule.Server)
 		}
 		return "proxy-out"
 	}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"os"
 	"testing"
 
 	"proxyclient/internal/config"
@@ -80,7 +81,7 @@ func TestVisualRoutingPutRejectsUnsupportedPersistentTypes(t *testing.T) {
 	req := visualRoutingResponse{
 		DefaultAction: config.ActionProxy,
 		Rules: []routing.RoutingRule{
-			{ID: "ports", Name: "Ports", Enabled: true, Priority: 1, Action: "block", Match: routing.RuleMatch{Type: "port", Values: []string{"25"}}},
+			{ID: "wifi", Name: "Wi-Fi", Enabled: true, Priority: 1, Action: "block", Match: routing.RuleMatch{Type: "wifi_ssid", Values: []string{"Office"}}},
 		},
 	}
 	w := putJSON(t, srv.router, "/api/routing/visual", req)
@@ -89,6 +90,43 @@ func TestVisualRoutingPutRejectsUnsupportedPersistentTypes(t *testing.T) {
 	}
 }
 
+func TestVisualRoutingPutPersistsRichTypes(t *testing.T) {
+	srv, h, cleanup := buildTunServer(t)
+	defer cleanup()
+
+	req := visualRoutingResponse{
+		DefaultAction: config.ActionProxy,
+		Rules: []routing.RoutingRule{
+			{ID: "smtp", Name: "SMTP", Enabled: true, Priority: 1, Action: "block", Match: routing.RuleMatch{Type: "port", Values: []string{"25", "8000-9000"}}},
+			{ID: "ru", Name: "RU", Enabled: true, Priority: 2, Action: "direct", Match: routing.RuleMatch{Type: "geoip", Values: []string{"RU"}}},
+			{ID: "ads", Name: "Ads", Enabled: true, Priority: 3, Action: "block", Match: routing.RuleMatch{Type: "domain_keyword", Values: []string{"AdServer"}}},
+			{ID: "steam", Name: "Steam", Enabled: true, Priority: 4, Action: "direct", Match: routing.RuleMatch{Type: "process", Values: []string{`C:\Games\Steam\Steam.exe`}}},
+		},
+	}
+	w := putJSON(t, srv.router, "/api/routing/visual", req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT rich types = %d, body=%s", w.Code, w.Body.String())
+	}
+	h.mu.RLock()
+	got := map[string]config.RuleType{}
+	for _, rule := range h.routing.Rules {
+		got[rule.Value] = rule.Type
+	}
+	h.mu.RUnlock()
+	want := map[string]config.RuleType{
+		"port:25":                  config.RuleTypePort,
+		"port:8000-9000":           config.RuleTypePort,
+		"geoip:ru":                 config.RuleTypeGeoIP,
+		"keyword:adserver":         config.RuleTypeKeyword,
+		`C:\Games\Steam\Steam.exe`: config.RuleTypeProcessPath,
+	}
+	for value, typ := range want {
+		if got[value] != typ {
+			t.Errorf("rule %q: type %q, want %q (all: %v)", value, got[value], typ, got)
+		}
+	}
+}
+
 func TestVisualRoutingTestRule(t *testing.T) {
 	srv, _, cleanup := buildTunServer(t)
 	defer cleanup()
@@ -180,3 +218,42 @@ func TestVisualRoutingImportPreset(t *testing.T) {
 		t.Fatalf("developer preset did not persist github.com direct rule: %+v", h.routing.Rules)
 	}
 }
+
+func TestRoutingDryRunUsesRuntimeConfig(t *testing.T) {
+	srv, _, cleanup := buildTunServer(t)
+	defer cleanup()
+	srv.config.ConfigPath = "config.singbox.json"
+
+	conn := routing.Conn{Domain: "gql.twitch.tv", Process: "chrome.exe"}
+	if w := postJSON(t, srv.router, "/api/routing/dry-run", conn); w.Code != http.StatusConflict {
+		t.Fatalf("dry-run without config = %d, want 409", w.Code)
+	}
+
+	cfg := config.SingBoxConfig{Route: config.SBRoute{
+		Rules: []config.SBRouteRule{
+			{Action: "sniff"},
+			{IPCIDR: []string{"10.0.0.0/8"}, Outbound: "direct"},
+			{Domain: []string{"twitch.tv"}, DomainSuffix: []string{"twitch.tv"}, Outbound: "direct"},
+		},
+		Final: "proxy-out",
+	}}
+	data, _ := json.Marshal(cfg)
+	if err := os.WriteFile(srv.config.ConfigPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := postJSON(t, srv.router, "/api/routing/dry-run", conn)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/routing/dry-run = %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp routing.DryRunResult
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.RuleIndex != 2 || resp.Action != routing.DryRunRoute || resp.Outbound != "direct" || len(resp.Explanation) != 3 {
+		t.Fatalf("dry-run response = %+v", resp)
+	}
+
+	if w := postJSON(t, srv.router, "/api/routing/dry-run", routing.Conn{Port: 443}); w.Code != http.StatusBadRequest {
+		t.Errorf("dry-run without destination = %d, want 400", w.Code)
+	}
+}
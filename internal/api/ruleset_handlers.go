@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"proxyclient/internal/config"
+)
+
+// Удалённые rule-set'ы живут в routing.json рядом с правилами: правило
+// "ruleset:<tag>" ссылается на rule-set по тегу. sing-box получает только
+// проверенную локальную копию, поэтому недоступный URL не мешает запуску.
+
+// RuleSetRequest тело PUT /api/tun/rulesets/{tag}
+type RuleSetRequest struct {
+	URL                 string `json:"url"`
+	Format              string `json:"format,omitempty"`
+	UpdateIntervalHours int    `json:"update_interval_hours,omitempty"`
+	DownloadDetour      string `json:"download_detour,omitempty"`
+}
+
+// RuleSetStatus — rule-set вместе с состоянием закэшированной копии.
+type RuleSetStatus struct {
+	config.RemoteRuleSet
+	// Cached — копия прошла проверку и попадёт в конфиг sing-box.
+	Cached bool                     `json:"cached"`
+	InUse  bool                     `json:"in_use"`
+	Status config.RemoteRuleSetMeta `json:"status"`
+}
+
+// ruleSetDownloadTimeout ограничивает синхронную загрузку из API.
+const ruleSetDownloadTimeout = time.Minute
+
+func (h *TunHandlers) setupRuleSetRoutes() {
+	r := h.server.router
+	r.HandleFunc("/api/tun/rulesets", h.handleListRuleSets).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/tun/rulesets/{tag}", h.handlePutRuleSet).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/tun/rulesets/{tag}", h.handleDeleteRuleSet).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/api/tun/rulesets/{tag}/refresh", h.handleRefreshRuleSet).Methods("POST", "OPTIONS")
+}
+
+func ruleSetStatus(cfg *config.RoutingConfig, rs config.RemoteRuleSet) RuleSetStatus {
+	return RuleSetStatus{
+		RemoteRuleSet: rs,
+		Cached:        config.RemoteRuleSetUsable(rs),
+		InUse:         ruleSetInUse(cfg, rs.Tag),
+		Status:        config.LoadRemoteRuleSetMeta(rs.Tag),
+	}
+}
+
+// ruleSetInUse сообщает, ссылаются ли на rule-set правила маршрутизации.
+func ruleSetInUse(cfg *config.RoutingConfig, tag string) bool {
+	for _, rule := range cfg.Rules {
+		if rule.Type == config.RuleTypeRuleSet && rule.Value == "ruleset:"+tag {
+			return true
+		}
+	}
+	return false
+}
+
+// handleListRuleSets GET /api/tun/rulesets
+func (h *TunHandlers) handleListRuleSets(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	snapshot := cloneRoutingConfig(h.routing)
+	h.mu.RUnlock()
+
+	out := make([]RuleSetStatus, 0, len(snapshot.RuleSets))
+	for _, rs := range snapshot.RuleSets {
+		out = append(out, ruleSetStatus(snapshot, rs))
+	}
+	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{"rulesets": out})
+}
+
+// handlePutRuleSet PUT /api/tun/rulesets/{tag} — создаёт или заменяет rule-set
+// и сразу скачивает его. Неудачная загрузка не отменяет сохранение: правило
+// просто не попадёт в конфиг, пока RuleSetUpdater не скачает копию.
+func (h *TunHandlers) handlePutRuleSet(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	var req RuleSetRequest
+	if !h.decodeRequest(w, r, &req, maxTunSmallRequestBytes) {
+		return
+	}
+	rs := config.NormalizeRemoteRuleSet(config.RemoteRuleSet{
+		Tag:                 tag,
+		URL:                 req.URL,
+		Format:              req.Format,
+		UpdateIntervalHours: req.UpdateIntervalHours,
+		DownloadDetour:      req.DownloadDetour,
+	})
+	if err := config.ValidateRemoteRuleSet(rs); err != nil {
+		h.server.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// routingOpMu держим только на время сохранения: загрузка может занять минуту.
+	h.server.routingOpMu.Lock()
+	h.mu.Lock()
+	oldSets := h.routing.RuleSets
+	sets := make([]config.RemoteRuleSet, 0, len(oldSets)+1)
+	replaced := false
+	for _, existing := range oldSets {
+		if existing.Tag == tag {
+			sets = append(sets, rs)
+			replaced = true
+			continue
+		}
+		sets = append(sets, existing)
+	}
+	if !replaced {
+		sets = append(sets, rs)
+	}
+	h.routing.RuleSets = sets
+	routingCopy := cloneRoutingConfig(h.routing)
+	h.mu.Unlock()
+
+	if err := config.SaveRoutingConfig(routingConfigPath, routingCopy); err != nil {
+		h.mu.Lock()
+		h.routing.RuleSets = oldSets // откат
+		h.mu.Unlock()
+		h.server.routingOpMu.Unlock()
+		h.server.logger.Error("Не удалось сохранить routing config: %v", err)
+		h.server.respondError(w, http.StatusInternalServerError, "не удалось сохранить rule-set")
+		return
+	}
+	h.server.routingOpMu.Unlock()
+
+	downloadErr := ""
+	ctx, cancel := context.WithTimeout(r.Context(), ruleSetDownloadTimeout)
+	defer cancel()
+	if err := downloadRemoteRuleSet(ctx, rs); err != nil {
+		h.server.logger.Warn("handlePutRuleSet: %v", err)
+		downloadErr = err.Error()
+	}
+	// Применяем даже при неудачной загрузке: при смене URL старая копия
+	// больше не годится, и правило должно выпасть из конфига.
+	applyErr := ""
+	if ruleSetInUse(routingCopy, tag) {
+		if err := h.TriggerApply(); err != nil {
+			h.server.logger.Warn("handlePutRuleSet: TriggerApply: %v", err)
+			applyErr = err.Error()
+		}
+	}
+	status := http.StatusOK
+	if !replaced {
+		status = http.StatusCreated
+	}
+	h.server.respondJSON(w, status, map[string]interface{}{
+		"message":        "rule-set сохранён",
+		"ruleset":        ruleSetStatus(routingCopy, rs),
+		"download_error": downloadErr,
+		"apply_error":    applyErr,
+	})
+}
+
+// handleDeleteRuleSet DELETE /api/tun/rulesets/{tag}
+// Rule-set, на который ссылаются правила, удалить нельзя — правила молча
+// перестали бы работать.
+func (h *TunHandlers) handleDeleteRuleSet(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+
+	h.server.routingOpMu.Lock()
+	defer h.server.routingOpMu.Unlock()
+
+	h.mu.Lock()
+	if _, ok := h.routing.FindRuleSet(tag); !ok {
+		h.mu.Unlock()
+		h.server.respondError(w, http.StatusNotFound, "rule-set не найден")
+		return
+	}
+	if ruleSetInUse(h.routing, tag) {
+		h.mu.Unlock()
+		h.server.respondError(w, http.StatusConflict, "rule-set используется в правилах")
+		return
+	}
+	oldSets := h.routing.RuleSets
+	sets := make([]config.RemoteRuleSet, 0, len(oldSets))
+	for _, rs := range oldSets {
+		if rs.Tag != tag {
+			sets = append(sets, rs)
+		}
+	}
+	h.routing.RuleSets = sets
+	routingCopy := cloneRoutingConfig(h.routing)
+	h.mu.Unlock()
+
+	if err := config.SaveRoutingConfig(routingConfigPath, routingCopy); err != nil {
+		h.mu.Lock()
+		h.routing.RuleSets = oldSets // откат
+		h.mu.Unlock()
+		h.server.logger.Error("Не удалось сохранить routing config: %v", err)
+		h.server.respondError(w, http.StatusInternalServerError, "не удалось сохранить изменения")
+		return
+	}
+	config.RemoveRemoteRuleSetCache(tag)
+
+	// Неиспользуемый rule-set не попадает в конфиг sing-box — перезапуск не нужен.
+	h.server.respondJSON(w, http.StatusOK, MessageResponse{Success: true, Message: "rule-set удалён"})
+}
+
+// handleRefreshRuleSet POST /api/tun/rulesets/{tag}/refresh — скачивает rule-set
+// вне расписания. sing-box перезапускается, только если копия изменилась.
+func (h *TunHandlers) handleRefreshRuleSet(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	h.mu.RLock()
+	snapshot := cloneRoutingConfig(h.routing)
+	h.mu.RUnlock()
+	rs, ok := snapshot.FindRuleSet(tag)
+	if !ok {
+		h.server.respondError(w, http.StatusNotFound, "rule-set не найден")
+		return
+	}
+
+	before := config.LoadRemoteRuleSetMeta(tag).SHA256
+	ctx, cancel := context.WithTimeout(r.Context(), ruleSetDownloadTimeout)
+	defer cancel()
+	if err := downloadRemoteRuleSet(ctx, rs); err != nil {
+		h.server.logger.Warn("handleRefreshRuleSet: %v", err)
+		h.server.respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	changed := config.LoadRemoteRuleSetMeta(tag).SHA256 != before
+	applyErr := ""
+	if changed && ruleSetInUse(snapshot, tag) {
+		if err := h.TriggerApply(); err != nil {
+			h.server.logger.Warn("handleRefreshRuleSet: TriggerApply: %v", err)
+			applyErr = err.Error()
+		}
+	}
+	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"ruleset":     ruleSetStatus(snapshot, rs),
+		"changed":     changed,
+		"apply_error": applyErr,
+	})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/logger"
+)
+
+func TestRuleSetHandlers_PutRefreshDelete(t *testing.T) {
+	srv, h, cleanup := buildTunServer(t)
+	defer cleanup()
+
+	var body atomic.Value
+	body.Store(`{"version":2,"rules":[{"domain_suffix":["ads.example"]}]}`)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body.Load().(string)))
+	}))
+	defer upstream.Close()
+
+	w := putJSON(t, srv.router, "/api/tun/rulesets/ads", RuleSetRequest{URL: upstream.URL + "/ads.json", DownloadDetour: config.RuleSetDetourDirect})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("PUT ruleset = %d, body=%s", w.Code, w.Body.String())
+	}
+	var put struct {
+		RuleSet       RuleSetStatus `json:"ruleset"`
+		DownloadError string        `json:"download_error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&put); err != nil {
+		t.Fatal(err)
+	}
+	if !put.RuleSet.Cached || put.RuleSet.Format != config.RuleSetFormatSource || put.DownloadError != "" {
+		t.Fatalf("PUT response = %+v", put)
+	}
+	if w := putJSON(t, srv.router, "/api/tun/rulesets/ads", RuleSetRequest{URL: "file:///etc/passwd"}); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT non-http URL = %d, want 400", w.Code)
+	}
+
+	// Сломанный ответ при обновлении: 502, но прежняя копия остаётся в силе.
+	body.Store(`<html>captive portal</html>`)
+	w = postJSON(t, srv.router, "/api/tun/rulesets/ads/refresh", nil)
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("refresh with broken body = %d, want 502", w.Code)
+	}
+	w = getJSON(t, srv.router, "/api/tun/rulesets")
+	var list struct {
+		RuleSets []RuleSetStatus `json:"rulesets"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.RuleSets) != 1 || !list.RuleSets[0].Cached || list.RuleSets[0].Status.LastError == "" {
+		t.Fatalf("list = %+v, want cached copy with last error", list.RuleSets)
+	}
+
+	h.mu.Lock()
+	h.routing.Rules = append(h.routing.Rules, config.RoutingRule{Value: "ruleset:ads", Type: config.RuleTypeRuleSet, Action: config.ActionBlock})
+	h.mu.Unlock()
+	if w := deleteJSON(t, srv.router, "/api/tun/rulesets/ads"); w.Code != http.StatusConflict {
+		t.Fatalf("DELETE ruleset in use = %d, want 409", w.Code)
+	}
+	h.mu.Lock()
+	h.routing.Rules = nil
+	h.mu.Unlock()
+	if w := deleteJSON(t, srv.router, "/api/tun/rulesets/ads"); w.Code != http.StatusOK {
+		t.Fatalf("DELETE ruleset = %d, body=%s", w.Code, w.Body.String())
+	}
+	if m := config.LoadRemoteRuleSetMeta("ads"); m.URL != "" {
+		t.Errorf("cache meta after delete = %+v", m)
+	}
+}
+
+func TestRuleSetDue(t *testing.T) {
+	now := time.Now()
+	rs := config.RemoteRuleSet{Tag: "ads", URL: "https://example.com/ads.srs", Format: config.RuleSetFormatBinary, UpdateIntervalHours: 24}
+	fresh := config.RemoteRuleSetMeta{URL: rs.URL, Format: rs.Format, SHA256: "x", CheckedAt: now.Add(-time.Hour)}
+	if ruleSetDue(rs, fresh, true, now) {
+		t.Error("fresh copy must not be due")
+	}
+	if !ruleSetDue(rs, fresh, false, now) {
+		t.Error("unusable copy must be retried after ruleSetRetryDelay")
+	}
+	moved := rs
+	moved.URL = "https://mirror.example/ads.srs"
+	if !ruleSetDue(moved, fresh, true, now) {
+		t.Error("URL change must trigger download")
+	}
+	if !ruleSetDue(rs, fresh, true, now.Add(24*time.Hour)) {
+		t.Error("stale copy must be due")
+	}
+}
+
+func TestRuleSetUpdater_AppliesOnlyOnChange(t *testing.T) {
+	t.Chdir(t.TempDir())
+	rs := config.NormalizeRemoteRuleSet(config.RemoteRuleSet{Tag: "ads", URL: "https://example.com/ads.json"})
+	var downloads, applies int
+	u := NewRuleSetUpdater(&logger.NoOpLogger{})
+	u.ruleSetsFn = func() []config.RemoteRuleSet { return []config.RemoteRuleSet{rs} }
+	u.downloadFn = func(_ context.Context, rs config.RemoteRuleSet) error {
+		downloads++
+		return config.StoreRemoteRuleSet(rs, []byte(`{"version":2,"rules":[]}`))
+	}
+	u.SetOnUpdated(func() { applies++ })
+	u.ctx = context.Background()
+
+	u.checkAndUpdate()
+	if downloads != 1 || applies != 1 {
+		t.Fatalf("first check: downloads=%d applies=%d", downloads, applies)
+	}
+	// Копия свежая — повторная проверка ничего не качает.
+	u.checkAndUpdate()
+	if downloads != 1 || applies != 1 {
+		t.Fatalf("second check: downloads=%d applies=%d", downloads, applies)
+	}
+}
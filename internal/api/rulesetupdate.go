@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/logger"
+)
+
+const (
+	// maxRuleSetBytes — предел размера скачиваемого rule-set'а.
+	maxRuleSetBytes = 32 << 20
+	// ruleSetRetryDelay — пауза перед повтором после неудачной загрузки,
+	// если она короче интервала обновления.
+	ruleSetRetryDelay = 15 * time.Minute
+	// ruleSetTickInterval — как часто проверять, не пора ли обновить rule-set'ы.
+	ruleSetTickInterval = 10 * time.Minute
+)
+
+// ruleSetHTTPClient выбирает клиента по download_detour. Через прокси rule-set
+// качается даже тогда, когда сам URL заблокирован у провайдера.
+func ruleSetHTTPClient(rs config.RemoteRuleSet) *http.Client {
+	if rs.DownloadDetour == config.RuleSetDetourDirect {
+		return geositeDirectHTTPClient
+	}
+	return geositeProxyHTTPClient(geositeProxyAddr)
+}
+
+// downloadRemoteRuleSet скачивает rule-set и заменяет им закэшированную копию.
+// Любая ошибка записывается в метаданные; последняя удачная копия остаётся.
+func downloadRemoteRuleSet(ctx context.Context, rs config.RemoteRuleSet) error {
+	data, err := fetchRemoteRuleSet(ctx, rs)
+	if err != nil {
+		err = fmt.Errorf("rule-set %s: %w", rs.Tag, err)
+		config.RecordRemoteRuleSetError(rs, err)
+		return err
+	}
+	return config.StoreRemoteRuleSet(rs, data)
+}
+
+func fetchRemoteRuleSet(ctx context.Context, rs config.RemoteRuleSet) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rs.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ruleSetHTTPClient(rs).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rs.DownloadDetour, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRuleSetBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRuleSetBytes {
+		return nil, fmt.Errorf("больше %d МБ", maxRuleSetBytes>>20)
+	}
+	return data, nil
+}
+
+// ruleSetDue сообщает, пора ли скачивать rule-set: URL сменился, интервал
+// обновления истёк, либо прошлая попытка не удалась и прошёл ruleSetRetryDelay.
+func ruleSetDue(rs config.RemoteRuleSet, meta config.RemoteRuleSetMeta, usable bool, now time.Time) bool {
+	if meta.URL != rs.URL || meta.Format != rs.Format {
+		return true
+	}
+	wait := rs.UpdateInterval()
+	if meta.LastError != "" || !usable {
+		wait = min(wait, ruleSetRetryDelay)
+	}
+	return now.Sub(meta.CheckedAt) >= wait
+}
+
+// RuleSetUpdater периодически обновляет удалённые rule-set'ы из routing.json.
+// Устроен как GeoAutoUpdater, но у каждого rule-set'а свой интервал.
+type RuleSetUpdater struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running bool
+	doneCh  chan struct{}
+	log     logger.Logger
+	// triggerCh — буферизованный (cap=1) сигнал TriggerNow.
+	triggerCh chan struct{}
+	// startupDelay — XRay может ещё перезапускаться и не слушать порт прокси.
+	startupDelay time.Duration
+	tick         time.Duration
+	// onUpdated вызывается после обновления хотя бы одного rule-set'а.
+	onUpdated func()
+
+	// downloadFn и ruleSetsFn подменяются в тестах.
+	downloadFn func(ctx context.Context, rs config.RemoteRuleSet) error
+	ruleSetsFn func() []config.RemoteRuleSet
+}
+
+// NewRuleSetUpdater создаёт updater, который читает rule-set'ы из routing.json.
+func NewRuleSetUpdater(log logger.Logger) *RuleSetUpdater {
+	return &RuleSetUpdater{
+		log:          log,
+		triggerCh:    make(chan struct{}, 1),
+		startupDelay: 30 * time.Second,
+		tick:         ruleSetTickInterval,
+		downloadFn:   downloadRemoteRuleSet,
+		ruleSetsFn: func() []config.RemoteRuleSet {
+			routing, err := config.LoadRoutingConfig(filepath.Join(config.DataDir, "routing.json"))
+			if err != nil {
+				return nil
+			}
+			return routing.RuleSets
+		},
+	}
+}
+
+// SetOnUpdated регистрирует callback после успешного обновления. Безопасно до Start().
+func (u *RuleSetUpdater) SetOnUpdated(fn func()) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.onUpdated = fn
+}
+
+// Start запускает фоновую проверку. Повторный вызов без Stop ничего не делает.
+func (u *RuleSetUpdater) Start(ctx context.Context) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.running {
+		return
+	}
+	u.ctx, u.cancel = context.WithCancel(ctx)
+	u.running = true
+	u.doneCh = make(chan struct{})
+	go func() {
+		defer close(u.doneCh)
+		defer func() {
+			u.mu.Lock()
+			u.running = false
+			u.mu.Unlock()
+		}()
+		u.loop()
+	}()
+}
+
+// Stop останавливает updater и ждёт завершения горутины.
+func (u *RuleSetUpdater) Stop() {
+	u.mu.Lock()
+	if !u.running {
+		u.mu.Unlock()
+		return
+	}
+	u.cancel()
+	done := u.doneCh
+	u.mu.Unlock()
+	<-done
+}
+
+// IsRunning возвращает true если updater запущен.
+func (u *RuleSetUpdater) IsRunning() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.running
+}
+
+// TriggerNow запускает проверку без ожидания тика. Не блокируется.
+func (u *RuleSetUpdater) TriggerNow() {
+	select {
+	case u.triggerCh <- struct{}{}:
+	default:
+	}
+}
+
+func (u *RuleSetUpdater) loop() {
+	select {
+	case <-time.After(u.startupDelay):
+	case <-u.triggerCh:
+	case <-u.ctx.Done():
+		return
+	}
+	u.checkAndUpdate()
+
+	ticker := time.NewTicker(u.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-u.ctx.Done():
+			return
+		case <-ticker.C:
+			u.checkAndUpdate()
+		case <-u.triggerCh:
+			u.checkAndUpdate()
+		}
+	}
+}
+
+// checkAndUpdate скачивает rule-set'ы, которым пора обновиться.
+func (u *RuleSetUpdater) checkAndUpdate() {
+	if u.ctx == nil {
+		return
+	}
+	updated := false
+	now := time.Now()
+	for _, rs := range u.ruleSetsFn() {
+		if u.ctx.Err() != nil {
+			return
+		}
+		meta := config.LoadRemoteRuleSetMeta(rs.Tag)
+		if !ruleSetDue(rs, meta, config.RemoteRuleSetUsable(rs), now) {
+			continue
+		}
+		if err := u.downloadFn(u.ctx, rs); err != nil {
+			u.log.Warn("rule-set %s: обновление не удалось, остаётся прежняя копия: %v", rs.Tag, err)
+			continue
+		}
+		// Перезапуск sing-box нужен только если содержимое действительно изменилось.
+		if config.LoadRemoteRuleSetMeta(rs.Tag).SHA256 != meta.SHA256 {
+			u.log.Info("rule-set %s обновлён ✓", rs.Tag)
+			updated = true
+		}
+	}
+	if updated {
+		u.mu.Lock()
+		cb := u.onUpdated
+		u.mu.Unlock()
+		if cb != nil {
+			cb()
+		}
+	}
+}
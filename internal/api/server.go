@@ -16,12 +16,16 @@ import (
 	"sync"
 	"time"
 
+	"proxyclient/internal/apiauth"
+	"proxyclient/internal/apprules"
 	"proxyclient/internal/config"
 	"proxyclient/internal/eventlog"
+	"proxyclient/internal/historydb"
 	"proxyclient/internal/hotkeys"
 	"proxyclient/internal/logger"
 	"proxyclient/internal/proxy"
 	"proxyclient/internal/subscription"
+	"proxyclient/internal/trafficdb"
 	"proxyclient/internal/wintun"
 	"proxyclient/internal/xray"
 
@@ -93,6 +97,14 @@ type Config struct {
 	EventLog      *eventlog.Log // может быть nil — тогда /api/events недоступен
 	QuitChan      chan struct{} // закрывается при вызове POST /api/quit
 	SilentPaths   []string      // дополнительные пути, которые не нужно логировать
+	// AuthStore — токены API. nil — авторизация не поддерживается (тесты, headless).
+	AuthStore *apiauth.Store
+	// History — SQLite-история задержек и подключений. nil — история не пишется,
+	// /api/history/* отвечают 503.
+	History *historydb.Store
+	// TrafficDB — учёт трафика по процессам и доменам. nil — учёт не ведётся,
+	// /api/traffic/usage* отвечают 503.
+	TrafficDB *trafficdb.Store
 
 	SecretKeyUpdatedFn func()
 	CloseToTrayFn      func(bool)
@@ -113,6 +125,10 @@ type Server struct {
 	lifecycleCtx context.Context
 	// rateLimiter — ограничитель частоты мутирующих запросов (POST/PUT/DELETE/PATCH).
 	rateLimiter *tokenBucket
+	// uiLaunch — одноразовые nonce ссылок запуска окна UI (см. UILaunchURL).
+	uiLaunch uiLaunchNonces
+	// stream — события для GET /api/stream (SSE).
+	stream *streamHub
 
 	restartMu      sync.RWMutex
 	restarting     bool
@@ -124,6 +140,10 @@ type Server struct {
 	silentCache     map[string]bool
 	tunHandlers     *TunHandlers
 	serversHandlers *ServersHandlers
+	profileHandlers *ProfileHandlers
+	// appRules — движок правил приложений (SetupAppProxyRoutes); туда уходят
+	// process-правила, пришедшие через /api/tun/rules.
+	appRules        apprules.Engine
 	subscriptionsMu sync.RWMutex
 	subscriptions   *subscription.Manager
 	reconnectMu     sync.Mutex
@@ -142,6 +162,8 @@ type Server struct {
 	// startBackground (SetGeoAutoUpdater) и HTTP-обработчиками (GetGeoAutoUpdater).
 	geoUpdaterMu sync.RWMutex
 	geoUpdater   *GeoAutoUpdater
+	// ruleSetUpdater обновляет удалённые rule-set'ы; защищён geoUpdaterMu.
+	ruleSetUpdater *RuleSetUpdater
 }
 
 // StatusResponse ответ для /api/status
@@ -238,6 +260,34 @@ func (s *Server) GetGeoAutoUpdater() *GeoAutoUpdater {
 	return s.geoUpdater
 }
 
+// SetRuleSetUpdater регистрирует updater удалённых rule-set'ов. После обновления
+// конфиг sing-box перегенерируется. Предыдущий updater останавливается.
+func (s *Server) SetRuleSetUpdater(u *RuleSetUpdater) {
+	s.geoUpdaterMu.Lock()
+	if u != nil {
+		u.SetOnUpdated(func() {
+			if s.tunHandlers != nil {
+				if err := s.tunHandlers.TriggerApply(); err != nil {
+					s.logger.Warn("RuleSetUpdater: TriggerApply после обновления rule-set: %v", err)
+				}
+			}
+		})
+	}
+	old := s.ruleSetUpdater
+	s.ruleSetUpdater = u
+	s.geoUpdaterMu.Unlock()
+	if old != nil && old != u && old.IsRunning() {
+		old.Stop()
+	}
+}
+
+// GetRuleSetUpdater возвращает текущий updater rule-set'ов (может быть nil).
+func (s *Server) GetRuleSetUpdater() *RuleSetUpdater {
+	s.geoUpdaterMu.RLock()
+	defer s.geoUpdaterMu.RUnlock()
+	return s.ruleSetUpdater
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
@@ -259,7 +309,10 @@ func NewServer(cfg Config, lifecycleCtx context.Context) *Server {
 		router:       mux.NewRouter(),
 		lifecycleCtx: lifecycleCtx,
 		rateLimiter:  newTokenBucket(defaultMutationRatePerSecond),
+		stream:       newStreamHub(),
 	}
+	s.subscribeStreamSources()
+	s.subscribeHistorySources()
 	s.setupRoutes()
 	return s
 }
@@ -288,6 +341,7 @@ func (s *Server) setupRoutes() {
 	s.router.Use(s.corsMiddleware)
 	s.router.Use(s.loggingMiddleware)
 	s.router.Use(s.recoveryMiddleware)
+	s.router.Use(s.authMiddleware)
 	s.router.Use(s.rateLimitMiddleware)
 	s.router.Use(s.maxBodyMiddleware)
 
@@ -300,6 +354,9 @@ func (s *Server) setupRoutes() {
 	api.HandleFunc("/quit", s.handleQuit).Methods("POST", "OPTIONS")
 	api.HandleFunc("/events", s.handleEvents).Methods("GET", "OPTIONS")
 	api.HandleFunc("/events/clear", s.handleEventsClear).Methods("POST", "OPTIONS")
+	api.HandleFunc("/stream", s.handleStream).Methods("GET", "OPTIONS")
+	s.router.HandleFunc(PACPath, s.handlePAC).Methods("GET", "HEAD")
+	SetupAuthRoutes(s)
 }
 
 func (s *Server) SetupFeatureRoutes(ctx context.Context) {
@@ -315,6 +372,7 @@ func (s *Server) SetupFeatureRoutes(ctx context.Context) {
 	SetupUpdateRoutes(s)
 	SetupTelemetryRoutes(s)
 	SetupLeakTestRoutes(s)
+	SetupHistoryRoutes(s)
 	if apiDebugEnabled() {
 		SetupDebugRoutes(s)
 	}
@@ -333,6 +391,9 @@ func (s *Server) SetupFeatureRoutes(ctx context.Context) {
 	api := s.router.PathPrefix("/api").Subrouter()
 	api.HandleFunc("/geosite", s.handleGeositeList).Methods("GET", "OPTIONS")
 	api.HandleFunc("/geosite/download", s.handleGeositeDownload).Methods("POST", "OPTIONS")
+	api.HandleFunc("/geosite/lookup", s.handleGeositeLookup).Methods("GET", "OPTIONS")
+	api.HandleFunc("/geosite/custom", s.handleGeositeCompile).Methods("POST", "OPTIONS")
+	api.HandleFunc("/geosite/{name}/contents", s.handleGeositeContents).Methods("GET", "OPTIONS")
 	api.HandleFunc("/singbox-config", s.handleGetSingBoxConfig).Methods("GET", "OPTIONS")
 	api.HandleFunc("/singbox-config", s.handleSetSingBoxConfig).Methods("POST", "OPTIONS")
 	api.HandleFunc("/security/status", s.handleSecurityStatus).Methods("GET", "OPTIONS")
@@ -352,6 +413,7 @@ func (s *Server) SetupFeatureRoutes(ctx context.Context) {
 	s.addSilentPath("/api/stats/total")
 	s.addSilentPath("/api/connections/history")
 	s.addSilentPath("/api/connections/inspect")
+	s.addSilentPath("/api/lan/clients")
 	s.addSilentPath("/api/security/dns-guard/check")
 	s.addSilentPath("/api/security/status")
 	s.addSilentPath("/api/security/network")
@@ -364,10 +426,14 @@ func (s *Server) SetupFeatureRoutes(ctx context.Context) {
 
 func (s *Server) startSubscriptions(ctx context.Context) {
 	mgr, err := subscription.NewManager(subscription.Options{
-		Dir:          filepath.Join(config.DataDir, "subscriptions"),
-		Client:       newManagedSubscriptionHTTPClient(),
-		IsSupported:  isSupportedServerURI,
-		ApplyServers: s.serversHandlers.applySubscriptionServers,
+		Dir:           filepath.Join(config.DataDir, "subscriptions"),
+		Client:        newManagedSubscriptionHTTPClient(),
+		TunnelClient:  newManagedSubscriptionTunnelClient(),
+		IsSupported:   isSupportedServerURI,
+		ValidateURL:   validateSubscriptionURL,
+		ApplyServers:  s.serversHandlers.applySubscriptionServers,
+		ManualServers: s.serversHandlers.manualServerURIs,
+		OnAlert:       s.handleSubscriptionAlert,
 	})
 	if err != nil {
 		s.logger.Warn("subscriptions disabled: %v", err)
@@ -409,7 +475,7 @@ func SetupDebugRoutes(s *Server) {
 }
 
 func (s *Server) FinalizeRoutes() {
-	s.router.PathPrefix("/").Handler(staticHandler())
+	s.router.PathPrefix("/").Handler(s.uiLaunchHandler(staticHandler()))
 }
 
 func (s *Server) newHTTPServer() *http.Server {
@@ -861,3 +927,9 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.wroteHeader = true
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap даёт http.ResponseController доступ к Flush и SetWriteDeadline
+// исходного writer'а — без этого /api/stream не может отдавать события.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
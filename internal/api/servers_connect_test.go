@@ -252,3 +252,41 @@ func TestHandleConnect_APIContract_RestartRequiredField(t *testing.T) {
 	}
 	t.Logf("API контракт OK: restart_required=%v, message=%q", resp["restart_required"], resp["message"])
 }
+
+func TestHandleAdd_SingBoxJSONAddsEachOutbound(t *testing.T) {
+	srv, secretKeyPath, cleanup := buildServersServer(t)
+	defer cleanup()
+
+	body := `{"outbounds":[` +
+		`{"type":"vless","tag":"nl","server":"nl.example.com","server_port":443,"uuid":"00000000-0000-0000-0000-000000000001",` +
+		`"multiplex":{"enabled":true,"protocol":"h2mux"}},` +
+		`{"type":"trojan","tag":"de","server":"de.example.com","server_port":443,"password":"p"},` +
+		`{"type":"block","tag":"block"}]}`
+	w := postJSON(t, srv.router, "/api/servers", map[string]string{"url": body})
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /api/servers = %d: %s", w.Code, w.Body.String())
+	}
+	list, err := loadServers()
+	if err != nil {
+		t.Fatalf("loadServers: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "nl" || list[1].Name != "de" || list[0].ID == list[1].ID {
+		t.Fatalf("servers = %+v", list)
+	}
+	parsed, err := config.ParseServerContent(list[0].URL)
+	if err != nil || parsed.Outbound.Multiplex == nil || parsed.Outbound.Multiplex.Protocol != "h2mux" {
+		t.Fatalf("stored outbound lost fields: %+v, err=%v", parsed, err)
+	}
+	if active, err := config.ReadSecretKey(secretKeyPath); err != nil || active != list[0].URL {
+		t.Errorf("first imported server must be activated: %q, err=%v", active, err)
+	}
+
+	w = postJSON(t, srv.router, "/api/servers", map[string]string{"url": body})
+	if w.Code != http.StatusConflict {
+		t.Errorf("re-import = %d, want 409", w.Code)
+	}
+	w = postJSON(t, srv.router, "/api/servers", map[string]string{"url": `{"outbounds":[{"type":"direct","tag":"d"}]}`})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("config without proxies = %d, want 400", w.Code)
+	}
+}
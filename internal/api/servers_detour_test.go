@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHandleSetDetour_RejectsCycle(t *testing.T) {
+	srv, _, cleanup := buildServersServer(t)
+	defer cleanup()
+
+	idA := addServer(t, srv, "A", "vless://uuid-aaa@server-a.test:443?sni=a.test&pbk=k-a&sid=s-a", "DE")
+	idB := addServer(t, srv, "B", "vless://uuid-bbb@server-b.test:443?sni=b.test&pbk=k-b&sid=s-b", "NL")
+
+	if w := putJSON(t, srv.router, "/api/servers/"+idA+"/detour", map[string]string{"detour": idB}); w.Code != http.StatusOK {
+		t.Fatalf("PUT detour A→B = %d, body=%s", w.Code, w.Body.String())
+	}
+	w := putJSON(t, srv.router, "/api/servers/"+idB+"/detour", map[string]string{"detour": idA})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "цикл") {
+		t.Fatalf("PUT detour B→A = %d, body=%s, want 400 cycle", w.Code, w.Body.String())
+	}
+
+	// Relay нельзя удалить, пока через него идёт другой сервер.
+	req := httptest.NewRequest(http.MethodDelete, "/api/servers/"+idB, nil)
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("DELETE relay = %d, want 409", rec.Code)
+	}
+}
+
+func TestHandleConnect_BrokenDetourChain(t *testing.T) {
+	srv, secretKeyPath, cleanup := buildServersServer(t)
+	defer cleanup()
+
+	// Цепочку с нераспознаваемым relay через API не собрать — пишем servers.json напрямую,
+	// как после ручной правки файла или обновления подписки.
+	if err := os.WriteFile(serversFile, []byte(`[
+		{"id":"exit","name":"Exit","url":"vless://uuid-aaa@exit.test:443?sni=a.test&pbk=k&sid=s","detour":"relay"},
+		{"id":"relay","name":"Relay","url":"garbage://relay"}
+	]`), 0644); err != nil {
+		t.Fatalf("WriteFile servers.json: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/servers/exit/connect", nil)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("connect = %d, body=%s, want 422", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "Relay") {
+		t.Errorf("error must name the broken chain member: %s", w.Body.String())
+	}
+	if _, err := os.Stat(secretKeyPath); !os.IsNotExist(err) {
+		t.Error("secret.key must not be written when the chain is broken")
+	}
+}
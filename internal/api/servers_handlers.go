@@ -16,9 +16,11 @@ import (
 	"time"
 
 	"proxyclient/internal/config"
+	"proxyclient/internal/connhistory"
 	"proxyclient/internal/fileutil"
 	"proxyclient/internal/healthmonitor"
 	"proxyclient/internal/latency"
+	"proxyclient/internal/urltest"
 
 	qrcode "github.com/skip2/go-qrcode"
 
@@ -77,7 +79,7 @@ func (h *ServersHandlers) Shutdown() {
 }
 
 const (
-	serversFile            = "servers.json"
+	serversFile            = config.ServersFile
 	maxServersRequestBytes = 64 << 10
 )
 
@@ -110,6 +112,7 @@ type ServerEntry struct {
 	SubscriptionURL string `json:"subscription_url,omitempty"` // C-5: URL субскрипции для /refresh
 	SubscriptionID  string `json:"subscription_id,omitempty"`
 	SubscriptionKey string `json:"subscription_key,omitempty"`
+	Detour          string `json:"detour,omitempty"` // ID сервера-relay: этот сервер набирается через него
 	Deleted         bool   `json:"deleted,omitempty"`
 }
 
@@ -120,6 +123,10 @@ type ServersHandlers struct {
 	secretKey  string                              // путь до active secret.key
 	fetchURLFn func(rawURL string) (string, error) // C-5: инъекция для тестов (nil → fetchServerURIFromURL)
 	health     *healthmonitor.Monitor
+
+	// urlTest — Runner URL-тестов; создаётся лениво в urlTestRunner, тесты подставляют свой.
+	urlTest     *urltest.Runner
+	urlTestOnce sync.Once
 }
 
 // SetupServerRoutes регистрирует маршруты менеджера серверов.
@@ -131,11 +138,13 @@ func SetupServerRoutes(s *Server, secretKeyPath string) *ServersHandlers {
 	api.HandleFunc("/servers", h.handleAdd).Methods("POST", "OPTIONS")
 	api.HandleFunc("/servers/{id}", h.handleDelete).Methods("DELETE", "OPTIONS")
 	api.HandleFunc("/servers/{id}/connect", h.handleConnect).Methods("POST", "OPTIONS")
+	api.HandleFunc("/servers/{id}/detour", h.handleSetDetour).Methods("PUT", "OPTIONS")
 	api.HandleFunc("/servers/{id}/ping", h.handlePing).Methods("GET", "OPTIONS")
 	api.HandleFunc("/servers/{id}/real-ping", h.handleRealPing).Methods("GET", "OPTIONS") // B-3
 	api.HandleFunc("/servers/{id}/qr", h.handleQR).Methods("GET", "OPTIONS")
 	api.HandleFunc("/servers/{id}/latency-history", h.handleLatencyHistory).Methods("GET", "OPTIONS")
 	api.HandleFunc("/servers/ping-all", h.handlePingAll).Methods("GET", "OPTIONS")
+	api.HandleFunc("/servers/url-test", h.handleURLTest).Methods("POST", "OPTIONS")
 	api.HandleFunc("/servers/health", h.handleHealth).Methods("GET", "OPTIONS")
 	api.HandleFunc("/servers/auto-connect", h.handleAutoConnect).Methods("POST", "OPTIONS") // B-4
 	api.HandleFunc("/servers/failover", h.handleFailoverStatus).Methods("GET", "OPTIONS")
@@ -152,6 +161,20 @@ func (h *ServersHandlers) StartHealthMonitor(ctx context.Context) {
 		Interval: 30 * time.Second,
 		Targets:  h.healthTargets,
 		Probe: func(ctx context.Context, target healthmonitor.ServerTarget) (time.Duration, error) {
+			if probeMethod() == config.ProbeMethodURL {
+				if runner := h.urlTestRunner(); runner != nil {
+					h.mu.RLock()
+					list, _ := loadServers()
+					h.mu.RUnlock()
+					// Монитор сам записывает результат пробы; здесь — только история задержек.
+					res := runURLTest(ctx, runner, visibleServers(list), target.ID)
+					recordURLTestLatency(res)
+					if !res.OK {
+						return 0, fmt.Errorf("url test failed: %s", res.Error)
+					}
+					return time.Duration(res.LatencyMs) * time.Millisecond, nil
+				}
+			}
 			ms, _, _, ok := pingServerWithProbes(ctx, target.URL, 1)
 			if !ok {
 				return 0, fmt.Errorf("tcp probe failed")
@@ -159,6 +182,9 @@ func (h *ServersHandlers) StartHealthMonitor(ctx context.Context) {
 			return time.Duration(ms) * time.Millisecond, nil
 		},
 	})
+	if store := h.server.config.History; store != nil {
+		context.AfterFunc(ctx, h.health.Subscribe(store.RecordHealth))
+	}
 	go h.health.Start(ctx)
 }
 
@@ -265,6 +291,25 @@ func visibleServers(list []ServerEntry) []ServerEntry {
 	return out
 }
 
+// savedServersFromEntries переводит видимые записи servers.json в представление
+// пакета config — для проверки detour-цепочек той же логикой, что и у builder'а.
+func savedServersFromEntries(list []ServerEntry) []config.SavedServer {
+	out := make([]config.SavedServer, 0, len(list))
+	for _, s := range list {
+		if s.Deleted {
+			continue
+		}
+		out = append(out, config.SavedServer{
+			ID:             s.ID,
+			Name:           s.Name,
+			URL:            s.URL,
+			SubscriptionID: s.SubscriptionID,
+			Detour:         s.Detour,
+		})
+	}
+	return out
+}
+
 // activeServerIDFromList возвращает ID активного сервера из уже загруженного списка.
 // FIX 40: избегает двойного чтения servers.json (loadServers вызывается вызывающей стороной).
 func (h *ServersHandlers) activeServerIDFromList(list []ServerEntry) string {
@@ -302,6 +347,8 @@ func (h *ServersHandlers) handleList(w http.ResponseWriter, _ *http.Request) {
 }
 
 // POST /api/servers  body: {name, url, country_code}
+// url — share-ссылка или sing-box JSON (конфиг, массив outbounds или один outbound):
+// из JSON добавляется каждый proxy outbound, name при этом берётся из тегов.
 func (h *ServersHandlers) handleAdd(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name        string `json:"name"`
@@ -312,16 +359,36 @@ func (h *ServersHandlers) handleAdd(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	req.URL = strings.TrimSpace(strings.TrimPrefix(req.URL, "\xef\xbb\xbf"))
-	parsed, err := config.ParseServerContent(req.URL)
-	if err != nil {
-		h.server.respondError(w, http.StatusBadRequest, "неподдерживаемый или невалидный URL: "+err.Error())
-		return
-	}
-	if req.Name == "" {
-		req.Name = parsed.DisplayName
-		if req.Name == "" {
-			req.Name = "Сервер"
+	type candidate struct{ name, url string }
+	var candidates []candidate
+	var warnings []string
+	if strings.HasPrefix(req.URL, "{") || strings.HasPrefix(req.URL, "[") {
+		servers, warns, err := config.ParseSingBoxOutbounds([]byte(req.URL))
+		if err != nil {
+			h.server.respondError(w, http.StatusBadRequest, "невалидный sing-box JSON: "+err.Error())
+			return
+		}
+		if len(servers) == 0 {
+			h.server.respondJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":    "в sing-box JSON нет поддерживаемых outbound'ов",
+				"warnings": warns,
+			})
+			return
 		}
+		for _, sb := range servers {
+			candidates = append(candidates, candidate{name: sb.Name, url: sb.Content})
+		}
+		warnings = warns
+	} else {
+		parsed, err := config.ParseServerContent(req.URL)
+		if err != nil {
+			h.server.respondError(w, http.StatusBadRequest, "неподдерживаемый или невалидный URL: "+err.Error())
+			return
+		}
+		candidates = append(candidates, candidate{name: parsed.DisplayName, url: req.URL})
+	}
+	if len(candidates) == 1 && req.Name != "" {
+		candidates[0].name = req.Name
 	}
 	if req.CountryCode == "" {
 		req.CountryCode = "??"
@@ -335,22 +402,36 @@ func (h *ServersHandlers) handleAdd(w http.ResponseWriter, r *http.Request) {
 		h.server.respondError(w, http.StatusInternalServerError, "ошибка чтения списка серверов")
 		return
 	}
-	// Проверка дублей
+	existing := make(map[string]bool, len(list))
 	for _, s := range list {
-		if s.URL == req.URL {
-			h.server.respondError(w, http.StatusConflict, "сервер с таким URL уже существует")
-			return
+		existing[s.URL] = true
+	}
+	wasEmpty := len(list) == 0
+	now := time.Now()
+	var added []ServerEntry
+	for i, c := range candidates {
+		// Проверка дублей
+		if existing[c.url] {
+			continue
 		}
+		existing[c.url] = true
+		name := c.name
+		if name == "" {
+			name = "Сервер"
+		}
+		added = append(added, ServerEntry{
+			ID:          fmt.Sprintf("%d", now.UnixNano()+int64(i)),
+			Name:        name,
+			URL:         c.url,
+			CountryCode: strings.ToUpper(req.CountryCode),
+			AddedAt:     now.Unix(),
+		})
+	}
+	if len(added) == 0 {
+		h.server.respondError(w, http.StatusConflict, "сервер с таким URL уже существует")
+		return
 	}
-
-	entry := ServerEntry{
-		ID:          fmt.Sprintf("%d", time.Now().UnixNano()),
-		Name:        req.Name,
-		URL:         req.URL,
-		CountryCode: strings.ToUpper(req.CountryCode),
-		AddedAt:     time.Now().Unix(),
-	}
-	list = append(list, entry)
+	list = append(list, added...)
 	if err := saveServers(list); err != nil {
 		h.server.respondError(w, http.StatusInternalServerError, "ошибка записи: "+err.Error())
 		return
@@ -358,18 +439,26 @@ func (h *ServersHandlers) handleAdd(w http.ResponseWriter, r *http.Request) {
 	// Если это первый сервер и secret.key не существует — активируем автоматически
 	// BUG FIX: используем fileutil.WriteAtomic — secret.key критичен, его повреждение
 	// делает приложение неработоспособным.
-	if len(list) == 1 {
-		_ = config.WriteSecretKey(h.secretKey, entry.URL)
+	if wasEmpty {
+		_ = config.WriteSecretKey(h.secretKey, added[0].URL)
 		config.InvalidateVLESSCache()
 		// FIX 19: уведомляем о смене secret.key.
 		if h.server.config.SecretKeyUpdatedFn != nil {
 			h.server.config.SecretKeyUpdatedFn()
 		}
 	}
-	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
+	resp := map[string]interface{}{
 		"success": true,
-		"server":  entry,
-	})
+		"server":  added[0],
+	}
+	if len(candidates) > 1 {
+		resp["servers"] = added
+		resp["skipped"] = len(candidates) - len(added)
+	}
+	if len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+	h.server.respondJSON(w, http.StatusOK, resp)
 }
 
 // DELETE /api/servers/{id}
@@ -384,6 +473,12 @@ func (h *ServersHandlers) handleDelete(w http.ResponseWriter, r *http.Request) {
 		h.server.respondError(w, http.StatusInternalServerError, "ошибка чтения")
 		return
 	}
+	for _, s := range list {
+		if !s.Deleted && s.Detour == id {
+			h.server.respondError(w, http.StatusConflict, fmt.Sprintf("сервер используется как промежуточный для %q", s.Name))
+			return
+		}
+	}
 	newList := make([]ServerEntry, 0, len(list))
 	found := false
 	var deletedURL string
@@ -442,6 +537,12 @@ func (h *ServersHandlers) handleConnect(w http.ResponseWriter, r *http.Request)
 		h.server.respondError(w, http.StatusNotFound, "сервер не найден")
 		return
 	}
+	// Проверяем detour-цепочку ДО записи secret.key: иначе GenerateSingBoxConfig
+	// упадёт уже в фоне, а активным останется сервер, к которому не подключиться.
+	if err := config.ValidateDetour(savedServersFromEntries(list), target.ID, target.Detour); err != nil {
+		h.server.respondError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
 
 	// Записываем URL в secret.key атомарно.
 	// BUG FIX: os.WriteFile не атомарен — при крэше secret.key будет повреждён
@@ -480,6 +581,7 @@ func (h *ServersHandlers) handleConnect(w http.ResponseWriter, r *http.Request)
 		applyMsg = fmt.Sprintf("активен %q — перезапустите прокси чтобы применить", target.Name)
 		restartRequired = true
 	}
+	connhistory.Global.Add(connhistory.Event{Time: time.Now(), Kind: connhistory.EventConnect, Server: target.ID})
 
 	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success":          true,
@@ -488,6 +590,69 @@ func (h *ServersHandlers) handleConnect(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// PUT /api/servers/{id}/detour  body: {detour} — подключаться к серверу через другой
+// сохранённый сервер (цепочка прокси). Пустой detour снимает цепочку.
+func (h *ServersHandlers) handleSetDetour(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req struct {
+		Detour string `json:"detour"`
+	}
+	if !h.decodeRequest(w, r, &req) {
+		return
+	}
+	req.Detour = strings.TrimSpace(req.Detour)
+
+	h.mu.Lock()
+	list, err := loadServers()
+	if err != nil {
+		h.mu.Unlock()
+		h.server.respondError(w, http.StatusInternalServerError, "ошибка чтения")
+		return
+	}
+	idx := -1
+	for i := range list {
+		if list[i].ID == id && !list[i].Deleted {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		h.mu.Unlock()
+		h.server.respondError(w, http.StatusNotFound, "сервер не найден")
+		return
+	}
+	if err := config.ValidateDetour(savedServersFromEntries(list), id, req.Detour); err != nil {
+		h.mu.Unlock()
+		h.server.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	list[idx].Detour = req.Detour
+	if err := saveServers(list); err != nil {
+		h.mu.Unlock()
+		h.server.respondError(w, http.StatusInternalServerError, "ошибка записи")
+		return
+	}
+	activeID := h.activeServerIDFromList(list)
+	h.mu.Unlock()
+
+	// Цепочка могла измениться у активного сервера или у сервера из правил —
+	// перегенерируем конфиг. Вызывается после h.mu.Unlock: держать мьютекс
+	// servers.json на время apply незачем.
+	applyErr := ""
+	if h.server.tunHandlers != nil {
+		if err := h.server.tunHandlers.TriggerApply(); err != nil {
+			h.server.logger.Warn("handleSetDetour: TriggerApply: %v", err)
+			applyErr = err.Error()
+		}
+	}
+	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"server":      list[idx],
+		"active":      activeID == id,
+		"apply_error": applyErr,
+	})
+}
+
 // GET /api/servers/{id}/ping — TCP + TLS latency к серверу
 func (h *ServersHandlers) handlePing(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
@@ -525,7 +690,7 @@ func (h *ServersHandlers) handlePing(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// B-3: handleRealPing GET /api/servers/{id}/real-ping — HTTP тест через прокси
+// B-3: handleRealPing GET /api/servers/{id}/real-ping — HTTP тест через сервер {id}
 func (h *ServersHandlers) handleRealPing(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
@@ -545,11 +710,27 @@ func (h *ServersHandlers) handleRealPing(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	activeID := h.activeServerIDFromList(list)
+	// Если sing-box доступен — меряем именно {id} через отдельный экземпляр,
+	// не трогая активное подключение.
+	if runner := h.urlTestRunner(); runner != nil {
+		res := h.urlTestServer(r.Context(), runner, visibleServers(list), *target)
+		h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
+			"id":               target.ID,
+			"latency_ms":       res.LatencyMs,
+			"ok":               res.OK,
+			"error":            res.Error,
+			"method":           "url-test",
+			"active_server_id": activeID,
+			"measures_active":  true,
+		})
+		return
+	}
+
 	// Тестируем через локальный прокси (127.0.0.1:10807)
 	ms, ok := pingThroughProxy(config.ProxyAddr, 10*time.Second)
 	// FIX 41: сообщаем через какой сервер фактически идёт тест.
-	// real-ping всегда идёт через активный прокси — не обязательно через {id}.
-	activeID := h.activeServerIDFromList(list)
+	// Без sing-box real-ping идёт через активный прокси — не обязательно через {id}.
 	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
 		"id":               target.ID,
 		"latency_ms":       ms,
@@ -592,16 +773,14 @@ func (h *ServersHandlers) doAutoConnect(ctx context.Context) (map[string]interfa
 		ok      bool
 	}
 	results := make([]pingResult, len(list))
+	method := probeMethod()
 	var wg sync.WaitGroup
 	for i, srv := range list {
 		wg.Add(1)
 		go func(i int, srv ServerEntry) {
 			defer wg.Done()
 			// B-5: для auto-connect используем 1 пробу (приоритет скорость)
-			ms, _, _, ok := pingServerWithProbes(pingCtx, srv.URL, 1)
-			if h.health != nil {
-				h.health.Record(srv.ID, time.Duration(ms)*time.Millisecond, ok)
-			}
+			ms, ok := h.probeServer(pingCtx, method, list, srv)
 			results[i] = pingResult{id: srv.ID, latency: ms, ok: ok}
 		}(i, srv)
 	}
@@ -684,6 +863,9 @@ func (h *ServersHandlers) doAutoConnect(ctx context.Context) (map[string]interfa
 	if bestServer == nil {
 		return nil, http.StatusInternalServerError, fmt.Errorf("внутренняя ошибка: сервер не найден")
 	}
+	if err := config.ValidateDetour(savedServersFromEntries(list), bestServer.ID, bestServer.Detour); err != nil {
+		return nil, http.StatusUnprocessableEntity, err
+	}
 
 	if err := config.WriteSecretKey(h.secretKey, bestServer.URL); err != nil {
 		return nil, http.StatusInternalServerError, fmt.Errorf("не удалось обновить secret.key: %w", err)
@@ -1066,7 +1248,8 @@ func isSupportedServerURI(line string) bool {
 		strings.HasPrefix(line, "hy2://") ||
 		strings.HasPrefix(line, "tuic://") ||
 		strings.HasPrefix(line, "wireguard://") ||
-		strings.HasPrefix(line, "vmess://")
+		strings.HasPrefix(line, "vmess://") ||
+		config.IsSingBoxOutboundContent(line)
 }
 
 // base64DecodeSubscription пробует несколько вариантов Base64 (std, URL, raw).
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/latency"
+	"proxyclient/internal/logger"
+	"proxyclient/internal/urltest"
+)
+
+// fakeSingBox — экземпляр "sing-box" для URL-теста: HTTP-сервер на порту mixed inbound.
+type fakeSingBox struct {
+	srv  *http.Server
+	done chan struct{}
+}
+
+func (f *fakeSingBox) Done() <-chan struct{} { return f.done }
+func (f *fakeSingBox) Stop() string          { _ = f.srv.Close(); return "" }
+
+// fakeURLTestLauncher поднимает fakeSingBox и запоминает outbounds каждого конфига по route.final.
+func fakeURLTestLauncher(mu *sync.Mutex, seen map[string][]config.SBOutbound) urltest.Launcher {
+	return func(_ context.Context, path string) (urltest.Instance, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var cfg struct {
+			Inbounds  []config.SBInbound  `json:"inbounds"`
+			Outbounds []config.SBOutbound `json:"outbounds"`
+			Route     config.SBRoute      `json:"route"`
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		seen[cfg.Route.Final] = cfg.Outbounds
+		mu.Unlock()
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(cfg.Inbounds[0].ListenPort)))
+		if err != nil {
+			return nil, err
+		}
+		inst := &fakeSingBox{done: make(chan struct{})}
+		inst.srv = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})}
+		go func() { _ = inst.srv.Serve(l) }()
+		return inst, nil
+	}
+}
+
+func TestHandleURLTest_MeasuresEachServerThroughOwnChain(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(config.DataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(serversFile, []byte(`[
+		{"id":"exit","name":"Exit","url":"vless://uuid-aaa@exit.test:443?sni=a.test&pbk=k&sid=s","detour":"relay"},
+		{"id":"relay","name":"Relay","url":"vless://uuid-bbb@relay.test:443?sni=b.test&pbk=k&sid=s"},
+		{"id":"broken","name":"Broken","url":"garbage://broken"}
+	]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(Config{
+		XRayManager:  &stubXray{},
+		ProxyManager: &stubProxy{},
+		Logger:       &logger.NoOpLogger{},
+	}, context.Background())
+	h := SetupServerRoutes(srv, "secret.key")
+	var mu sync.Mutex
+	seen := map[string][]config.SBOutbound{}
+	h.urlTest = &urltest.Runner{URL: "http://probe.invalid/", WorkDir: t.TempDir(), Launch: fakeURLTestLauncher(&mu, seen)}
+	srv.FinalizeRoutes()
+
+	w := postJSON(t, srv.router, "/api/servers/url-test", map[string]any{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("url-test = %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Results []urltest.Result `json:"results"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	for _, res := range resp.Results {
+		switch res.ID {
+		case "exit", "relay":
+			if !res.OK || res.LatencyMs <= 0 {
+				t.Errorf("%s = %+v, want ok", res.ID, res)
+			}
+		case "broken":
+			if res.OK || !strings.Contains(res.Error, "Broken") {
+				t.Errorf("broken = %+v, want chain error", res)
+			}
+		}
+	}
+	// Сервер с detour тестируется вместе со своим relay.
+	chain := seen[config.ServerOutboundTag("exit")]
+	if len(chain) != 2 || chain[0].Detour != config.ServerOutboundTag("relay") || chain[1].Tag != config.ServerOutboundTag("relay") {
+		t.Errorf("exit test outbounds = %+v", chain)
+	}
+	if pts := latency.Global.Get("broken"); len(pts) == 0 || pts[len(pts)-1].Ms != -1 {
+		t.Errorf("broken latency history = %+v, want failure recorded", pts)
+	}
+
+	w = postJSON(t, srv.router, "/api/servers/url-test", map[string]any{"ids": []string{"missing"}})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown id = %d, want 404", w.Code)
+	}
+
+	w = getJSON(t, srv.router, "/api/servers/relay/real-ping")
+	var rp map[string]any
+	_ = json.NewDecoder(w.Body).Decode(&rp)
+	if rp["method"] != "url-test" || rp["ok"] != true || rp["measures_active"] != true {
+		t.Errorf("real-ping = %v, want url-test of the server itself", rp)
+	}
+}
+
+func TestHandleURLTest_UnavailableWithoutSingBox(t *testing.T) {
+	srv, cleanup := buildServerRoutesServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/servers/url-test", nil)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("url-test without sing-box = %d, want 503", w.Code)
+	}
+}
+
+func TestHandleURLTest_CanceledRequestLeavesServersNotTested(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(config.DataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(serversFile, []byte(`[
+		{"id":"queued-a","name":"A","url":"vless://uuid-aaa@a.test:443?sni=a.test&pbk=k&sid=s"},
+		{"id":"queued-b","name":"B","url":"vless://uuid-bbb@b.test:443?sni=b.test&pbk=k&sid=s"}
+	]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(Config{
+		XRayManager:  &stubXray{},
+		ProxyManager: &stubProxy{},
+		Logger:       &logger.NoOpLogger{},
+	}, context.Background())
+	h := SetupServerRoutes(srv, "secret.key")
+	var mu sync.Mutex
+	h.urlTest = &urltest.Runner{WorkDir: t.TempDir(), Launch: fakeURLTestLauncher(&mu, map[string][]config.SBOutbound{})}
+	srv.FinalizeRoutes()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/api/servers/url-test", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("url-test = %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Results []urltest.Result `json:"results"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	// Непротестированный сервер — не отказ: в историю задержек он не попадает.
+	for _, res := range resp.Results {
+		if res.OK || !res.Skipped {
+			t.Errorf("%s = %+v, want skipped", res.ID, res)
+		}
+		if pts := latency.Global.Get(res.ID); len(pts) != 0 {
+			t.Errorf("%s latency history = %+v, want empty", res.ID, pts)
+		}
+	}
+}
@@ -93,6 +93,8 @@ func (h *SettingsHandlers) handleSetSettings(w http.ResponseWriter, r *http.Requ
 		Telemetry            *config.TelemetrySettings         `json:"telemetry"`
 		LeakTest             *config.LeakTestSettings          `json:"leak_test"`
 		Hotkeys              *config.HotkeySettings            `json:"hotkeys"`
+		History              *config.HistorySettings           `json:"history"`
+		ProxyAutoConfig      *bool                             `json:"proxy_auto_config"`
 	}
 	if !h.decodeRequest(w, r, &body, maxSettingsRequestBytes, "invalid body", false) {
 		return
@@ -177,6 +179,16 @@ func (h *SettingsHandlers) handleSetSettings(w http.ResponseWriter, r *http.Requ
 		}
 		settings.Hotkeys = normalized
 	}
+	if body.History != nil {
+		if body.History.RetentionDays < 1 || body.History.RetentionDays > config.MaxHistoryRetentionDays {
+			h.server.respondError(w, http.StatusBadRequest, "history.retention_days: 1..365")
+			return
+		}
+		settings.History = *body.History
+	}
+	if body.ProxyAutoConfig != nil {
+		settings.ProxyAutoConfig = *body.ProxyAutoConfig
+	}
 	hotkeysChanged := body.Hotkeys != nil
 	if err := config.SaveAppSettings(config.AppSettingsFile, settings); err != nil {
 		h.server.respondError(w, http.StatusInternalServerError, err.Error())
@@ -191,6 +203,12 @@ func (h *SettingsHandlers) handleSetSettings(w http.ResponseWriter, r *http.Requ
 	if h.server.config.CloseToTrayFn != nil {
 		h.server.config.CloseToTrayFn(settings.CloseToTray)
 	}
+	if h.server.config.History != nil {
+		h.server.config.History.SetRetentionDays(settings.History.RetentionDays)
+	}
+	if body.ProxyAutoConfig != nil {
+		h.server.reapplySystemProxy()
+	}
 	if body.Language != nil {
 		tray.SetLanguage(settings.Language)
 		notification.SetLanguage(settings.Language)
@@ -229,6 +247,8 @@ type SettingsResponse struct {
 	Telemetry            config.TelemetrySettings         `json:"telemetry"`
 	LeakTest             config.LeakTestSettings          `json:"leak_test"`
 	Hotkeys              config.HotkeySettings            `json:"hotkeys"`
+	History              config.HistorySettings           `json:"history"`
+	ProxyAutoConfig      bool                             `json:"proxy_auto_config"`
 	HotkeyConflicts      []hotkeys.Conflict               `json:"hotkey_conflicts,omitempty"`
 }
 
@@ -260,6 +280,8 @@ func (h *SettingsHandlers) handleGetSettings(w http.ResponseWriter, _ *http.Requ
 		Telemetry:            appSettings.Telemetry,
 		LeakTest:             appSettings.LeakTest,
 		Hotkeys:              appSettings.Hotkeys,
+		History:              appSettings.History,
+		ProxyAutoConfig:      appSettings.ProxyAutoConfig,
 		HotkeyConflicts:      h.currentHotkeyConflicts(appSettings.Hotkeys, false),
 	})
 }
@@ -417,17 +439,43 @@ func (h *SettingsHandlers) handleGetDNS(w http.ResponseWriter, _ *http.Request)
 		"remote_dns":          dnsConfig.RemoteDNS,
 		"direct_dns":          dnsConfig.DirectDNS,
 		"remote_dns_fallback": dnsConfig.RemoteDNSFallback,
+		"fakeip":              fakeIPOrDefault(dnsConfig.FakeIP),
+		"overrides":           dnsConfig.Overrides,
+		"hosts":               dnsConfig.Hosts,
 	})
 }
 
+// fakeIPOrDefault возвращает FakeIP-настройки для ответа API: выключенный
+// режим отдаётся со значениями по умолчанию, чтобы UI было что показать.
+func fakeIPOrDefault(f *config.FakeIPConfig) config.FakeIPConfig {
+	out := config.FakeIPConfig{Inet4Range: config.DefaultFakeIPRange, Exclude: config.DefaultFakeIPExclude}
+	if f == nil {
+		return out
+	}
+	out.Enabled = f.Enabled
+	if f.Inet4Range != "" {
+		out.Inet4Range = f.Inet4Range
+	}
+	if len(f.Exclude) > 0 {
+		out.Exclude = f.Exclude
+	}
+	return out
+}
+
 // B-7: handleSetDNS POST /api/settings/dns — обновить DNS конфигурацию
 // Body: {"remote_dns": "https://1.1.1.1/dns-query", "direct_dns": "udp://8.8.8.8"}
 // Разрешённые схемы: https://, tls://, udp://, tcp://, quic://
+// Необязательные "fakeip": {"enabled", "inet4_range", "exclude"},
+// "overrides": [{"domains", "server"}] и "hosts": {"домен": ["IP"]}; отсутствующее
+// поле оставляет текущие настройки без изменений.
 func (h *SettingsHandlers) handleSetDNS(w http.ResponseWriter, r *http.Request) {
 	var body struct {
-		RemoteDNS         string   `json:"remote_dns"`
-		DirectDNS         string   `json:"direct_dns"`
-		RemoteDNSFallback []string `json:"remote_dns_fallback"`
+		RemoteDNS         string                `json:"remote_dns"`
+		DirectDNS         string                `json:"direct_dns"`
+		RemoteDNSFallback []string              `json:"remote_dns_fallback"`
+		FakeIP            *config.FakeIPConfig  `json:"fakeip"`
+		Overrides         *[]config.DNSOverride `json:"overrides"`
+		Hosts             *map[string][]string  `json:"hosts"`
 	}
 	if !h.decodeRequest(w, r, &body, maxSettingsRequestBytes, "неверный JSON", true) {
 		return
@@ -442,12 +490,44 @@ func (h *SettingsHandlers) handleSetDNS(w http.ResponseWriter, r *http.Request)
 		h.server.respondError(w, http.StatusBadRequest, "невалидный Direct DNS: "+err.Error())
 		return
 	}
+	if body.FakeIP != nil && body.FakeIP.Inet4Range != "" {
+		if err := config.ValidateFakeIPRange(body.FakeIP.Inet4Range); err != nil {
+			h.server.respondError(w, http.StatusBadRequest, "невалидный FakeIP: "+err.Error())
+			return
+		}
+	}
 
 	routingConfigPath := config.DataDir + "/routing.json"
 	newDNS := &config.DNSConfig{
 		RemoteDNS:         body.RemoteDNS,
 		DirectDNS:         body.DirectDNS,
 		RemoteDNSFallback: body.RemoteDNSFallback,
+		FakeIP:            body.FakeIP,
+	}
+	if body.Overrides != nil {
+		newDNS.Overrides = *body.Overrides
+	}
+	if body.Hosts != nil {
+		newDNS.Hosts = *body.Hosts
+	}
+	if err := config.ValidateSplitDNS(newDNS); err != nil {
+		h.server.respondError(w, http.StatusBadRequest, "невалидный split DNS: "+err.Error())
+		return
+	}
+	// keepUnset переносит из текущей конфигурации поля, которых нет в запросе.
+	keepUnset := func(current *config.DNSConfig) {
+		if current == nil {
+			return
+		}
+		if body.FakeIP == nil {
+			newDNS.FakeIP = current.FakeIP
+		}
+		if body.Overrides == nil {
+			newDNS.Overrides = current.Overrides
+		}
+		if body.Hosts == nil {
+			newDNS.Hosts = current.Hosts
+		}
 	}
 	// Если клиент передал пустую строку — используем значение по умолчанию.
 	defaultDNS := config.DefaultDNSConfig()
@@ -467,6 +547,7 @@ func (h *SettingsHandlers) handleSetDNS(w http.ResponseWriter, r *http.Request)
 		// Без routingOpMu конкурентные handleAddRule/import/bulk replace могли сохранить
 		// снимок без нового DNS или, наоборот, handleSetDNS мог потерять только что добавленные правила.
 		if err := h.server.mutateRoutingSnapshot(func(routing *config.RoutingConfig) (bool, error) {
+			keepUnset(routing.DNS)
 			routing.DNS = newDNS
 			return true, nil
 		}); err != nil {
@@ -484,6 +565,7 @@ func (h *SettingsHandlers) handleSetDNS(w http.ResponseWriter, r *http.Request)
 			h.server.respondError(w, http.StatusInternalServerError, "ошибка чтения конфигурации: "+err.Error())
 			return
 		}
+		keepUnset(cfg.DNS)
 		cfg.DNS = newDNS
 		if err := config.SaveRoutingConfig(routingConfigPath, cfg); err != nil {
 			h.server.routingOpMu.Unlock()
@@ -498,6 +580,9 @@ func (h *SettingsHandlers) handleSetDNS(w http.ResponseWriter, r *http.Request)
 		"remote_dns":          newDNS.RemoteDNS,
 		"direct_dns":          newDNS.DirectDNS,
 		"remote_dns_fallback": newDNS.RemoteDNSFallback,
+		"fakeip":              fakeIPOrDefault(newDNS.FakeIP),
+		"overrides":           newDNS.Overrides,
+		"hosts":               newDNS.Hosts,
 	})
 
 	// Применяем новый DNS сразу — sing-box должен использовать новые серверы.
@@ -141,6 +141,113 @@ func TestHandleSetDNS_InvalidJSON(t *testing.T) {
 	}
 }
 
+// TestHandleSetDNS_SplitDNS проверяет сохранение переопределений и hosts.
+func TestHandleSetDNS_SplitDNS(t *testing.T) {
+	srv, cleanup := buildDNSTestServer(t)
+	defer cleanup()
+
+	post := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/settings/dns", bytes.NewReader(data))
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+	w := post(map[string]interface{}{
+		"overrides": []map[string]interface{}{{"domains": []string{"corp.local"}, "server": "10.0.0.53"}},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("override without scheme = %d, ожидалось 400", w.Code)
+	}
+	w = post(map[string]interface{}{
+		"overrides": []map[string]interface{}{{"domains": []string{"corp.local"}, "server": "udp://10.0.0.53"}},
+		"hosts":     map[string][]string{"nas.lan": {"192.168.1.10"}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST overrides = %d: %s", w.Code, w.Body.String())
+	}
+	// Запрос без overrides/hosts не должен их стирать.
+	if w = post(map[string]interface{}{"remote_dns": "tls://dns.google"}); w.Code != http.StatusOK {
+		t.Fatalf("POST remote_dns = %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/settings/dns", nil)
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	var resp struct {
+		Overrides []struct {
+			Domains []string `json:"domains"`
+			Server  string   `json:"server"`
+		} `json:"overrides"`
+		Hosts map[string][]string `json:"hosts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("ошибка парсинга ответа: %v", err)
+	}
+	if len(resp.Overrides) != 1 || resp.Overrides[0].Server != "udp://10.0.0.53" {
+		t.Errorf("overrides = %+v", resp.Overrides)
+	}
+	if ips := resp.Hosts["nas.lan"]; len(ips) != 1 || ips[0] != "192.168.1.10" {
+		t.Errorf("hosts = %+v", resp.Hosts)
+	}
+}
+
+// TestHandleSetDNS_FakeIP проверяет включение FakeIP и что запрос без "fakeip"
+// не сбрасывает ранее сохранённые настройки.
+func TestHandleSetDNS_FakeIP(t *testing.T) {
+	srv, cleanup := buildDNSTestServer(t)
+	defer cleanup()
+
+	post := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/settings/dns", bytes.NewReader(data))
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, req)
+		return w
+	}
+	w := post(map[string]interface{}{
+		"remote_dns": "https://1.1.1.1/dns-query",
+		"direct_dns": "udp://8.8.8.8",
+		"fakeip":     map[string]interface{}{"enabled": true, "inet4_range": "10.0.0.0/16"},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("FakeIP range inside LAN = %d, ожидалось 400", w.Code)
+	}
+	w = post(map[string]interface{}{
+		"remote_dns": "https://1.1.1.1/dns-query",
+		"direct_dns": "udp://8.8.8.8",
+		"fakeip":     map[string]interface{}{"enabled": true, "exclude": []string{"Corp.Example"}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST fakeip = %d: %s", w.Code, w.Body.String())
+	}
+	w = post(map[string]interface{}{"remote_dns": "tls://dns.google", "direct_dns": "udp://8.8.8.8"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST without fakeip = %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/settings/dns", nil)
+	w = httptest.NewRecorder()
+	srv.router.ServeHTTP(w, req)
+	var resp struct {
+		RemoteDNS string `json:"remote_dns"`
+		FakeIP    struct {
+			Enabled    bool     `json:"enabled"`
+			Inet4Range string   `json:"inet4_range"`
+			Exclude    []string `json:"exclude"`
+		} `json:"fakeip"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("ошибка парсинга ответа: %v", err)
+	}
+	if resp.RemoteDNS != "tls://dns.google" || !resp.FakeIP.Enabled || resp.FakeIP.Inet4Range != "198.18.0.0/15" {
+		t.Errorf("GET /api/settings/dns = %+v", resp)
+	}
+	if len(resp.FakeIP.Exclude) != 1 || resp.FakeIP.Exclude[0] != "corp.example" {
+		t.Errorf("fakeip.exclude = %q, ожидалось [corp.example]", resp.FakeIP.Exclude)
+	}
+}
+
 // buildDNSTestServer создаёт тестовый сервер с DNS endpoints
 func buildDNSTestServer(t *testing.T) (*Server, func()) {
 	t.Helper()
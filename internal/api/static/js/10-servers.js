@@ -289,7 +289,8 @@ async function importSrvUrlFromPanel() {
   const inp = $id('srvPanelUrlInp');
   const url = inp ? inp.value.trim() : '';
   if (!url) { showToast('Вставьте server URI', 'warn'); return; }
-  if (!isSupportedServerURI(url)) { showToast('Поддерживаются vless, trojan, ss, hysteria2, tuic, wireguard, vmess', 'warn'); return; }
+  const isJSON = /^[\[{]/.test(url);
+  if (!isJSON && !isSupportedServerURI(url)) { showToast('Поддерживаются vless, trojan, ss, hysteria2, tuic, wireguard, vmess или sing-box JSON', 'warn'); return; }
   try {
     const r = await fetch(API + '/servers', {
       method:'POST',
@@ -302,8 +303,11 @@ async function importSrvUrlFromPanel() {
       return;
     }
     if (!r.ok) throw new Error(await r.text());
+    const d = await r.json().catch(() => ({}));
     if (inp) inp.value = '';
-    showToast('Сервер добавлен', 'on');
+    const count = Array.isArray(d.servers) ? d.servers.length : 1;
+    const warn = (d.warnings || []).length ? ' (предупреждений: ' + d.warnings.length + ')' : '';
+    showToast((count > 1 ? 'Добавлено серверов: ' + count : 'Сервер добавлен') + warn, warn ? 'warn' : 'on');
     loadServers();
   } catch(e) {
     showToast('Ошибка: ' + e.message, 'off');
@@ -391,6 +395,28 @@ async function pingAll() {
   }
 }
 
+// URL-тест: HTTP-запрос через каждый сервер в отдельном экземпляре sing-box.
+async function urlTestAll() {
+  if (_pingAllRunning) return;
+  _pingAllRunning = true;
+  const spin = $id('pingSpin');
+  spin?.classList.add('vis');
+  try {
+    const r = await fetch(API + '/servers/url-test', { method: 'POST' });
+    if (!r.ok) throw new Error((await r.json().catch(() => ({}))).error || r.status);
+    const data = await r.json();
+    (data.results || []).forEach(p => { state.pings[p.id] = p.ok ? p.latency_ms : -1; });
+    await loadServerHealth(false);
+    renderServerList();
+    updateServerPill();
+  } catch (e) {
+    showToast('URL-тест: ' + e.message, 'off');
+  } finally {
+    spin?.classList.remove('vis');
+    _pingAllRunning = false;
+  }
+}
+
 async function connectServer(id, evt) {
   const item = evt.currentTarget;
   item.classList.add('connecting');
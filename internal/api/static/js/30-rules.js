@@ -850,6 +850,48 @@ async function testVisualRule() {
   }
 }
 
+// parseDryRunTarget: "example.com", "1.2.3.4:3478", "[2001:db8::1]:443" → {domain|ip, port}.
+function parseDryRunTarget(raw) {
+  let host = raw, port = 0;
+  const v6 = raw.match(/^\[([^\]]+)\](?::(\d+))?$/);
+  if (v6) { host = v6[1]; port = +(v6[2] || 0); }
+  else if ((raw.match(/:/g) || []).length === 1) { [host, port] = [raw.split(':')[0], +raw.split(':')[1]]; }
+  const isIP = /^[\d.]+$/.test(host) || host.includes(':');
+  return Object.assign(isIP ? { ip: host } : { domain: host }, port ? { port } : {});
+}
+
+async function runRouteDryRun() {
+  const result = $id('dryRunResult'), explain = $id('dryRunExplain');
+  const target = ($id('dryRunTarget')?.value || '').trim();
+  if (!target) {
+    showToast('Введите домен или IP', 'warn');
+    return;
+  }
+  const body = parseDryRunTarget(target);
+  const process = ($id('dryRunProcess')?.value || '').trim();
+  if (process) body.process = process;
+  if ($id('dryRunUDP')?.checked) body.network = 'udp';
+  result.style.display = '';
+  try {
+    const r = await fetch(API + '/routing/dry-run', {
+      method: 'POST',
+      headers: {'Content-Type': 'application/json'},
+      body: JSON.stringify(body)
+    });
+    const d = await r.json();
+    if (!r.ok) throw new Error(d.error || 'HTTP ' + r.status);
+    const where = d.rule_index < 0 ? 'final' : 'правило #' + d.rule_index;
+    result.textContent = d.action === 'route' ? `${where} → ${d.outbound || 'первый outbound'}` : `${where} → ${d.action}`;
+    result.className = 'visual-test-result ' + (d.action === 'reject' ? 'miss' : 'ok');
+    explain.textContent = (d.explanation || []).join('\n');
+    explain.style.display = '';
+  } catch(e) {
+    result.textContent = e.message;
+    result.className = 'visual-test-result err';
+    explain.style.display = 'none';
+  }
+}
+
 function quickVisualRule(kind) {
   const value = prompt(kind === 'direct-app' ? 'process.exe' : 'domain.com');
   if (!value) return;
@@ -1,4 +1,4 @@
-// LOGS PAGE  →  GET /api/events  (SSE или polling)
+// LOGS PAGE  →  GET /api/stream (SSE) или polling /api/events
 // ═══════════════════════════════════════════════════
 let logLines = [];
 let logStreaming = false;
@@ -97,17 +97,23 @@ function startLogStream() {
     }
   };
   try {
-    logSSE = new EventSource(API + '/events');
+    // /api/stream сам переподключается с Last-Event-ID; resync — события потеряны,
+    // дочитываем их через /api/events?since.
+    logSSE = new EventSource(API + '/stream?types=event');
     logSSE.onopen = () => setLogStreamState('SSE');
-    logSSE.onmessage = e => {
+    logSSE.addEventListener('event', e => {
       if (!logStreaming) return;
       try {
         const ev = JSON.parse(e.data);
-        pushLog(ev.time || new Date().toISOString(), ev.level || 'I', ev.message || e.data);
+        if (ev.id != null && ev.id > lastLogId) lastLogId = ev.id;
+        pushLog(ev.ts || new Date().toISOString(), ev.level || 'I', ev.message || e.data);
       } catch(_) {
         pushLog(new Date().toISOString(), 'I', e.data);
       }
-    };
+    });
+    logSSE.addEventListener('resync', () => {
+      if (logStreaming) pollLogs().then(() => { if (logSSE) setLogStreamState('SSE'); });
+    });
     logSSE.onerror = () => {
       if (!logStreaming) return;
       logSSE?.close();
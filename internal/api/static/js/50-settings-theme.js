@@ -387,11 +387,13 @@ function applyLifecycleControls(d) {
   if ($id('keepaliveIntervalInp')) $id('keepaliveIntervalInp').value = _appSettingsCache.keepalive_interval_sec || 120;
   if ($id('reconnectIntervalInp')) $id('reconnectIntervalInp').value = _appSettingsCache.reconnect_interval_min || 0;
   if ($id('memoryLimitInp')) $id('memoryLimitInp').value = _appSettingsCache.memory_limit_mb || 0;
+  if ($id('historyRetentionInp')) $id('historyRetentionInp').value = (_appSettingsCache.history && _appSettingsCache.history.retention_days) || 30;
   if ($id('scheduleOnInp')) $id('scheduleOnInp').value = (_appSettingsCache.schedule && _appSettingsCache.schedule.proxy_on) || '09:00';
   if ($id('scheduleOffInp')) $id('scheduleOffInp').value = (_appSettingsCache.schedule && _appSettingsCache.schedule.proxy_off) || '18:00';
   const sf = _appSettingsCache.smart_failover || {};
   if ($id('failoverMaxLatencyInp')) $id('failoverMaxLatencyInp').value = sf.max_latency_ms || 800;
   if ($id('failoverIntervalInp')) $id('failoverIntervalInp').value = sf.check_interval_sec || 60;
+  if ($id('failoverProbeMethodInp')) $id('failoverProbeMethodInp').value = sf.probe_method === 'url' ? 'url' : 'tcp';
   const dg = _appSettingsCache.dns_guard || {};
   setDNSGuardMode(dg.mode || 'warn', false);
   const tb = _appSettingsCache.traffic_budget || {};
@@ -435,12 +437,16 @@ async function saveLifecycleSettings() {
     close_to_tray: $id('closeToTrayToggle')?.classList.contains('on') !== false,
     language: $id('languageInp')?.value || _appSettingsCache.language || 'system',
     memory_limit_mb: Number($id('memoryLimitInp')?.value || 0),
+    history: {
+      retention_days: Number($id('historyRetentionInp')?.value || 30)
+    },
     manual_singbox_config: !!$id('manualConfigToggle')?.classList.contains('on'),
     smart_failover: {
       enabled: !!$id('smartFailoverToggle')?.classList.contains('on'),
       max_latency_ms: Number($id('failoverMaxLatencyInp')?.value || 800),
       check_interval_sec: Number($id('failoverIntervalInp')?.value || 60),
-      min_improvement_ms: 50
+      min_improvement_ms: 50,
+      probe_method: $id('failoverProbeMethodInp')?.value || 'tcp'
     },
     dns_guard: {
       enabled: !!$id('dnsGuardToggle')?.classList.contains('on'),
@@ -1043,6 +1049,7 @@ async function addSubscription() {
   const url = ($id('subUrlInp')?.value || '').trim();
   const update_every = $id('subIntervalInp')?.value || 'manual';
   const user_agent = ($id('subUserAgentInp')?.value || '').trim();
+  const import_routing = !!$id('subImportRoutingInp')?.checked;
   if (!url) { showToast('Введите URL подписки', 'warn'); return; }
   if (!/^https:\/\//i.test(url)) { showToast('Subscription URL должен быть HTTPS', 'warn'); return; }
   if (btn) btn.disabled = true;
@@ -1051,7 +1058,7 @@ async function addSubscription() {
       method: 'POST',
       headers: {'Content-Type':'application/json'},
       timeoutMs: 45000,
-      body: JSON.stringify({name, url, update_every, user_agent})
+      body: JSON.stringify({name, url, update_every, user_agent, import_routing})
     });
     const d = await r.json().catch(() => ({}));
     if (!r.ok && r.status !== 202) throw new Error(d.error || await r.text());
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"proxyclient/internal/connhistory"
+	"proxyclient/internal/eventlog"
+)
+
+// GET /api/stream — Server-Sent Events вместо опроса /api/events, /api/stats
+// и /api/tun/apply/status. Все источники публикуют в один streamHub; клиент
+// возобновляет поток по Last-Event-ID из кольца последних событий.
+
+// Типы событий потока (поле "event:" SSE).
+const (
+	streamTypeEvent       = "event"       // eventlog.Event
+	streamTypeTraffic     = "traffic"     // trafficSnapshot, раз в секунду
+	streamTypeApply       = "apply"       // то же, что GET /api/tun/apply/status
+	streamTypeFailover    = "failover"    // решение smart failover
+	streamTypeConnHistory = "connhistory" // connhistory.Event
+	// streamTypeResync — возобновить поток без потерь нельзя: клиент должен
+	// перечитать состояние через REST.
+	streamTypeResync = "resync"
+)
+
+var streamTypes = map[string]bool{
+	streamTypeEvent:       true,
+	streamTypeTraffic:     true,
+	streamTypeApply:       true,
+	streamTypeFailover:    true,
+	streamTypeConnHistory: true,
+}
+
+const (
+	streamBacklogSize  = 512
+	streamClientBuffer = 128
+	streamKeepAlive    = 15 * time.Second
+	streamRetryMs      = 3000
+)
+
+type streamEvent struct {
+	Seq  int64
+	Type string
+	Data []byte
+}
+
+type streamSub struct {
+	ch    chan streamEvent
+	types map[string]bool // nil — все типы
+}
+
+func (s *streamSub) wants(typ string) bool {
+	return s.types == nil || s.types[typ]
+}
+
+// streamHub раздаёт события подписчикам /api/stream.
+// ID события — "<epoch>-<seq>": epoch меняется при каждом запуске процесса,
+// поэтому Last-Event-ID от прошлого запуска распознаётся и даёт resync,
+// а не молчаливый пропуск событий.
+type streamHub struct {
+	epoch   string
+	mu      sync.Mutex
+	seq     int64
+	evicted int64 // seq последнего вытесненного из backlog события
+	backlog []streamEvent
+	subs    map[*streamSub]struct{}
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		subs:  make(map[*streamSub]struct{}),
+	}
+}
+
+func (h *streamHub) eventID(seq int64) string {
+	return h.epoch + "-" + strconv.FormatInt(seq, 10)
+}
+
+// parseEventID разбирает Last-Event-ID. ok=false — ID от другого запуска или мусор.
+func (h *streamHub) parseEventID(id string) (int64, bool) {
+	epoch, seqStr, found := strings.Cut(id, "-")
+	if !found || epoch != h.epoch {
+		return 0, false
+	}
+	seq, err := strconv.ParseInt(seqStr, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, false
+	}
+	return seq, true
+}
+
+// publish отправляет событие подписчикам. Трафик не попадает в backlog:
+// старые снапшоты скорости при возобновлении бесполезны, и без подписчиков
+// он даже не сериализуется. Клиент, не успевающий читать, отключается —
+// он переподключится с Last-Event-ID и дочитает пропущенное из backlog.
+func (h *streamHub) publish(typ string, v interface{}) {
+	h.send(typ, v, typ == streamTypeTraffic)
+}
+
+// publishTransient — событие только для текущих подписчиков, без backlog:
+// рутинные решения не должны вытеснять из кольца события, нужные при
+// возобновлении потока.
+func (h *streamHub) publishTransient(typ string, v interface{}) {
+	h.send(typ, v, true)
+}
+
+func (h *streamHub) send(typ string, v interface{}, transient bool) {
+	if h == nil {
+		return
+	}
+	if transient {
+		h.mu.Lock()
+		idle := len(h.subs) == 0
+		h.mu.Unlock()
+		if idle {
+			return
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev := streamEvent{Seq: h.seq, Type: typ, Data: data}
+	if !transient {
+		h.backlog = append(h.backlog, ev)
+		if len(h.backlog) > streamBacklogSize {
+			drop := len(h.backlog) - streamBacklogSize
+			h.evicted = h.backlog[drop-1].Seq
+			h.backlog = append([]streamEvent(nil), h.backlog[drop:]...)
+		}
+	}
+	for sub := range h.subs {
+		if !sub.wants(typ) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// subscribe регистрирует подписчика и возвращает события из backlog после lastID.
+// resync=true — часть событий после lastID уже потеряна (или ID чужой).
+func (h *streamHub) subscribe(lastID string, types map[string]bool) (sub *streamSub, replay []streamEvent, resync bool) {
+	sub = &streamSub{ch: make(chan streamEvent, streamClientBuffer), types: types}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if lastID != "" {
+		seq, ok := h.parseEventID(lastID)
+		switch {
+		case !ok || seq > h.seq:
+			resync = true
+			seq = 0
+		case seq < h.evicted:
+			resync = true
+		}
+		for _, ev := range h.backlog {
+			if ev.Seq > seq && sub.wants(ev.Type) {
+				replay = append(replay, ev)
+			}
+		}
+	}
+	h.subs[sub] = struct{}{}
+	return sub, replay, resync
+}
+
+func (h *streamHub) unsubscribe(sub *streamSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// parseStreamTypes разбирает ?types=event,apply. Пустое значение — все типы.
+func parseStreamTypes(raw string) (map[string]bool, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	types := make(map[string]bool)
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !streamTypes[t] {
+			return nil, fmt.Errorf("неизвестный тип события %q", t)
+		}
+		types[t] = true
+	}
+	if len(types) == 0 {
+		return nil, nil
+	}
+	return types, nil
+}
+
+// subscribeStreamSources подключает eventlog и connhistory к hub'у на время
+// жизни сервера. Трафик, apply и failover публикуются своими владельцами.
+func (s *Server) subscribeStreamSources() {
+	var cancels []func()
+	if s.config.EventLog != nil {
+		cancels = append(cancels, s.config.EventLog.Subscribe(func(e eventlog.Event) {
+			s.stream.publish(streamTypeEvent, e)
+		}))
+	}
+	cancels = append(cancels, connhistory.Global.Subscribe(func(e connhistory.Event) {
+		s.stream.publish(streamTypeConnHistory, e)
+	}))
+	// AfterFunc не держит горутину, пока контекст жив.
+	context.AfterFunc(s.lifecycleCtx, func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	})
+}
+
+// handleStream GET /api/stream[?types=a,b][&last_event_id=ID]
+// last_event_id — для первого подключения: EventSource и curl не могут задать
+// заголовок Last-Event-ID до переподключения.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	types, err := parseStreamTypes(r.URL.Query().Get("types"))
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	rc := http.NewResponseController(w)
+	// Поток живёт дольше WriteTimeout сервера — снимаем дедлайн для этого ответа.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		s.respondError(w, http.StatusInternalServerError, "streaming не поддерживается")
+		return
+	}
+
+	sub, replay, resync := s.stream.subscribe(lastID, types)
+	defer s.stream.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetryMs)
+	if resync {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", streamTypeResync)
+	}
+	for _, ev := range replay {
+		s.writeStreamEvent(w, ev)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.lifecycleCtx.Done():
+			return
+		case ev, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+			s.writeStreamEvent(w, ev)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) writeStreamEvent(w http.ResponseWriter, ev streamEvent) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", s.stream.eventID(ev.Seq), ev.Type, ev.Data)
+}
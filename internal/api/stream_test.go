@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"proxyclient/internal/eventlog"
+	"proxyclient/internal/logger"
+)
+
+func TestStreamHub_ResumeFromLastEventID(t *testing.T) {
+	h := newStreamHub()
+	h.publish(streamTypeEvent, map[string]int{"n": 1})
+	h.publish(streamTypeApply, map[string]int{"n": 2})
+	h.publish(streamTypeEvent, map[string]int{"n": 3})
+
+	sub, replay, resync := h.subscribe(h.eventID(1), nil)
+	defer h.unsubscribe(sub)
+	if resync {
+		t.Fatal("resume inside backlog must not resync")
+	}
+	if len(replay) != 2 || replay[0].Seq != 2 || replay[1].Seq != 3 {
+		t.Fatalf("replay = %+v, want seq 2 and 3", replay)
+	}
+
+	filtered, replay, _ := h.subscribe(h.eventID(1), map[string]bool{streamTypeEvent: true})
+	defer h.unsubscribe(filtered)
+	if len(replay) != 1 || replay[0].Seq != 3 {
+		t.Fatalf("filtered replay = %+v, want only seq 3", replay)
+	}
+}
+
+func TestStreamHub_ResyncOnForeignOrEvictedID(t *testing.T) {
+	h := newStreamHub()
+	for i := 0; i < streamBacklogSize+10; i++ {
+		h.publish(streamTypeEvent, i)
+	}
+
+	sub, _, resync := h.subscribe(h.eventID(3), nil)
+	h.unsubscribe(sub)
+	if !resync {
+		t.Error("evicted Last-Event-ID must resync")
+	}
+
+	other := newStreamHub()
+	other.epoch = "previous-run"
+	sub, replay, resync := h.subscribe(other.eventID(5), nil)
+	h.unsubscribe(sub)
+	if !resync {
+		t.Error("Last-Event-ID from another run must resync")
+	}
+	if len(replay) != streamBacklogSize {
+		t.Errorf("foreign ID replay = %d events, want full backlog %d", len(replay), streamBacklogSize)
+	}
+}
+
+func TestStreamHub_TrafficIsLiveOnly(t *testing.T) {
+	h := newStreamHub()
+	h.publish(streamTypeTraffic, trafficSnapshot{Up: 1})
+	if h.seq != 0 {
+		t.Fatal("traffic without subscribers must be dropped")
+	}
+
+	sub, _, _ := h.subscribe("", nil)
+	defer h.unsubscribe(sub)
+	h.publish(streamTypeTraffic, trafficSnapshot{Up: 2})
+	select {
+	case ev := <-sub.ch:
+		if ev.Type != streamTypeTraffic {
+			t.Errorf("event type = %q", ev.Type)
+		}
+	default:
+		t.Fatal("subscriber did not receive traffic")
+	}
+	if len(h.backlog) != 0 {
+		t.Error("traffic must not be kept in backlog")
+	}
+}
+
+func TestStreamHub_RoutineFailoverDecisionsSkipBacklog(t *testing.T) {
+	h := newStreamHub()
+	sub, _, _ := h.subscribe("", nil)
+	defer h.unsubscribe(sub)
+	for i := 0; i < 3; i++ {
+		h.publishTransient(streamTypeFailover, failoverStreamEvent{Reason: "active server is healthy"})
+		<-sub.ch
+	}
+	h.publish(streamTypeFailover, failoverStreamEvent{Failover: true, Reason: "probe failed"})
+	<-sub.ch
+	if len(h.backlog) != 1 || !strings.Contains(string(h.backlog[0].Data), "probe failed") {
+		t.Errorf("backlog = %d events, want only the switch", len(h.backlog))
+	}
+}
+
+func TestStreamHub_SlowSubscriberIsDropped(t *testing.T) {
+	h := newStreamHub()
+	sub, _, _ := h.subscribe("", nil)
+	for i := 0; i < streamClientBuffer+1; i++ {
+		h.publish(streamTypeEvent, i)
+	}
+	n := 0
+	for range sub.ch {
+		n++
+	}
+	if n != streamClientBuffer {
+		t.Errorf("slow subscriber got %d events before disconnect, want %d", n, streamClientBuffer)
+	}
+	h.unsubscribe(sub) // повторная отписка не должна паниковать
+}
+
+func TestHandleStream_PushesEventLogAndResumes(t *testing.T) {
+	evLog := eventlog.New(100)
+	s := NewServer(Config{Logger: &logger.NoOpLogger{}, EventLog: evLog}, context.Background())
+	ts := httptest.NewServer(s.router)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/stream?types=event", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	evLog.Add(eventlog.LevelWarn, "test", "first")
+	id, data := readStreamEvent(t, bufio.NewReader(resp.Body), streamTypeEvent)
+	if !strings.Contains(data, `"first"`) {
+		t.Fatalf("data = %s", data)
+	}
+	resp.Body.Close()
+
+	evLog.Add(eventlog.LevelInfo, "test", "second")
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/stream?types=event", nil)
+	req.Header.Set("Last-Event-ID", id)
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	defer resp2.Body.Close()
+	_, data = readStreamEvent(t, bufio.NewReader(resp2.Body), streamTypeEvent)
+	if !strings.Contains(data, `"second"`) {
+		t.Fatalf("resumed data = %s, want second event", data)
+	}
+}
+
+func TestHandleStream_RejectsUnknownType(t *testing.T) {
+	s := NewServer(Config{Logger: &logger.NoOpLogger{}}, context.Background())
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stream?types=bogus", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+// readStreamEvent читает поток до первого события типа typ и возвращает его id и data.
+func readStreamEvent(t *testing.T, r *bufio.Reader, typ string) (id, data string) {
+	t.Helper()
+	var evType string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			evType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			if evType == typ {
+				return id, data
+			}
+			id, evType, data = "", "", ""
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/connhistory"
+	"proxyclient/internal/eventlog"
+	"proxyclient/internal/healthmonitor"
+	"proxyclient/internal/notification"
+	"proxyclient/internal/subscription"
+)
+
+// subscriptionActionTimeout ограничивает действие при исчерпании квоты:
+// применение профиля может перезапускать sing-box.
+const subscriptionActionTimeout = 2 * time.Minute
+
+// handleSubscriptionAlert — OnAlert менеджера подписок: пишет в журнал
+// событий, показывает уведомление, добавляет запись в историю подключений и
+// выполняет настроенное действие при исчерпании трафика или срока.
+func (s *Server) handleSubscriptionAlert(sub subscription.Subscription, alert subscription.Alert) {
+	msg := subscriptionAlertMessage(sub, alert)
+	if s.config.EventLog != nil {
+		s.config.EventLog.Add(eventlog.LevelWarn, "subscription", "%s", msg)
+	} else {
+		s.logger.Warn("%s", msg)
+	}
+	notification.Send("SafeSky — подписка", msg)
+	connhistory.Global.Add(connhistory.Event{Time: time.Now(), Kind: connhistory.EventQuota, Reason: msg})
+
+	if alert.Kind != subscription.AlertExhausted && alert.Kind != subscription.AlertExpired {
+		return
+	}
+	ctx, cancel := context.WithTimeout(s.lifecycleCtx, subscriptionActionTimeout)
+	defer cancel()
+	if err := s.runExhaustedAction(ctx, sub, alert); err != nil {
+		s.logger.Warn("Подписка %q: действие %s не выполнено: %v", sub.Name, alert.Action, err)
+	}
+}
+
+func (s *Server) runExhaustedAction(ctx context.Context, sub subscription.Subscription, alert subscription.Alert) error {
+	switch alert.Action {
+	case subscription.ExhaustedSwitchProfile:
+		if s.profileHandlers == nil {
+			return errors.New("профили не инициализированы")
+		}
+		if _, _, err := s.profileHandlers.applyProfile(ctx, alert.Profile); err != nil {
+			return err
+		}
+		s.logger.Info("Подписка %q: применён профиль %q", sub.Name, alert.Profile)
+	case subscription.ExhaustedFailover:
+		if s.serversHandlers == nil {
+			return errors.New("менеджер серверов не инициализирован")
+		}
+		id, err := s.serversHandlers.failoverFromSubscription(sub.ID)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			s.logger.Info("Подписка %q: переключено на сервер %s", sub.Name, id)
+		}
+	case subscription.ExhaustedPauseUpdates:
+		s.logger.Info("Подписка %q: автообновление приостановлено", sub.Name)
+	}
+	return nil
+}
+
+func subscriptionAlertMessage(sub subscription.Subscription, alert subscription.Alert) string {
+	q := alert.Quota
+	switch alert.Kind {
+	case subscription.AlertUsage:
+		return fmt.Sprintf("Подписка %q: израсходовано %d%% трафика (%s из %s)",
+			sub.Name, alert.Threshold, formatQuotaBytes(q.Used()), formatQuotaBytes(q.Total))
+	case subscription.AlertExpiry:
+		return fmt.Sprintf("Подписка %q истекает %s (осталось меньше %d дн.)",
+			sub.Name, q.ExpiresAt.Local().Format("02.01.2006 15:04"), alert.Threshold)
+	case subscription.AlertExhausted:
+		return fmt.Sprintf("Подписка %q: трафик исчерпан (%s из %s)",
+			sub.Name, formatQuotaBytes(q.Used()), formatQuotaBytes(q.Total))
+	case subscription.AlertExpired:
+		return fmt.Sprintf("Подписка %q: срок действия истёк %s",
+			sub.Name, q.ExpiresAt.Local().Format("02.01.2006 15:04"))
+	}
+	return fmt.Sprintf("Подписка %q: %s", sub.Name, alert.Kind)
+}
+
+func formatQuotaBytes(b int64) string {
+	const gib = 1 << 30
+	if b >= gib {
+		return fmt.Sprintf("%.1f ГБ", float64(b)/gib)
+	}
+	return fmt.Sprintf("%.0f МБ", float64(b)/(1<<20))
+}
+
+// failoverFromSubscription переключает активный сервер на сервер другой
+// подписки, если сейчас активен сервер подписки subID. Среди кандидатов
+// выбирается лучший по данным health monitor, без них — первый в списке.
+// Возвращает ID нового сервера или "", если переключать не нужно.
+func (h *ServersHandlers) failoverFromSubscription(subID string) (string, error) {
+	h.mu.RLock()
+	list, err := loadServers()
+	h.mu.RUnlock()
+	if err != nil {
+		return "", err
+	}
+	list = visibleServers(list)
+	activeID := h.activeServerIDFromList(list)
+	var candidates []ServerEntry
+	activeFromSub := false
+	for _, srv := range list {
+		if srv.ID == activeID {
+			activeFromSub = srv.SubscriptionID == subID
+		}
+		if srv.SubscriptionID != "" && srv.SubscriptionID != subID {
+			candidates = append(candidates, srv)
+		}
+	}
+	if !activeFromSub {
+		return "", nil
+	}
+	if len(candidates) == 0 {
+		return "", errors.New("нет серверов других подписок")
+	}
+
+	target := candidates[0]
+	if h.health != nil {
+		ids := make(map[string]bool, len(candidates))
+		for _, c := range candidates {
+			ids[c.ID] = true
+		}
+		var snaps []healthmonitor.Snapshot
+		for _, snap := range h.health.Snapshot() {
+			if ids[snap.ID] {
+				snaps = append(snaps, snap)
+			}
+		}
+		if best, ok := healthmonitor.Best(snaps); ok {
+			for _, c := range candidates {
+				if c.ID == best.ID {
+					target = c
+				}
+			}
+		}
+	}
+
+	if err := config.ValidateDetour(savedServersFromEntries(list), target.ID, target.Detour); err != nil {
+		return "", err
+	}
+	if err := config.WriteSecretKey(h.secretKey, target.URL); err != nil {
+		return "", fmt.Errorf("не удалось обновить secret.key: %w", err)
+	}
+	config.InvalidateVLESSCache()
+	if h.server.config.SecretKeyUpdatedFn != nil {
+		h.server.config.SecretKeyUpdatedFn()
+	}
+	if h.server.tunHandlers != nil {
+		if err := h.server.tunHandlers.TriggerApplyFull(); err != nil {
+			h.server.logger.Warn("failoverFromSubscription: TriggerApplyFull: %v", err)
+		}
+	}
+	connhistory.Global.Add(connhistory.Event{
+		Time:   time.Now(),
+		Kind:   connhistory.EventFailover,
+		Server: target.ID,
+		Reason: "subscription quota exhausted",
+	})
+	return target.ID, nil
+}
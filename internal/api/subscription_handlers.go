@@ -8,34 +8,96 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"proxyclient/internal/config"
+	"proxyclient/internal/fileutil"
 	"proxyclient/internal/subscription"
 
 	"github.com/gorilla/mux"
 )
 
+// subscriptionProxyAddr — HTTP inbound sing-box для загрузки подписок через
+// туннель; тесты подменяют его.
+var subscriptionProxyAddr = config.ProxyAddr
+
 func newManagedSubscriptionHTTPClient() *http.Client {
 	return &http.Client{
-		Timeout:   20 * time.Second,
-		Transport: noProxyTransport,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 10 {
-				return fmt.Errorf("too many redirects")
-			}
-			if req.URL.Scheme != "https" {
-				return fmt.Errorf("subscription redirect must use https")
-			}
-			if err := validateSubscriptionURL(req.URL.String()); err != nil {
-				return fmt.Errorf("redirect denied: %w", err)
-			}
-			return nil
+		Timeout:       20 * time.Second,
+		Transport:     noProxyTransport,
+		CheckRedirect: checkSubscriptionRedirect,
+	}
+}
+
+// newManagedSubscriptionTunnelClient — клиент для fetch_route tunnel: запросы
+// идут через HTTP inbound sing-box, поэтому проходят и к заблокированным
+// доменам провайдера.
+func newManagedSubscriptionTunnelClient() *http.Client {
+	proxyURL := &url.URL{Scheme: "http", Host: subscriptionProxyAddr}
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:               subscriptionTunnelProxy(proxyURL),
+			DisableCompression:  true,
+			TLSHandshakeTimeout: 10 * time.Second,
 		},
+		CheckRedirect: checkSubscriptionRedirect,
+	}
+}
+
+// subscriptionTunnelProxy проверяет адрес назначения перед каждым запросом
+// через туннель: соединение набирает sing-box, а не safeSubscriptionDialContext,
+// и приватные сети он отправляет в direct. Без проверки подписка или зеркало
+// на 127.0.0.1 или 192.168.x.x загружались бы с локальной сети.
+func subscriptionTunnelProxy(proxyURL *url.URL) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		ips, err := net.DefaultResolver.LookupIPAddr(req.Context(), req.URL.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		for _, resolved := range ips {
+			if isPrivateOrLoopback(resolved.IP) {
+				return nil, fmt.Errorf("subscription host resolved to private/local address %s", resolved.IP)
+			}
+		}
+		return proxyURL, nil
+	}
+}
+
+// validateSubscriptionURLs — validateSubscriptionURL для адреса подписки
+// (пустой пропускается) и всех зеркал.
+func validateSubscriptionURLs(rawURL string, mirrors []string) error {
+	if rawURL != "" {
+		if err := validateSubscriptionURL(rawURL); err != nil {
+			return err
+		}
 	}
+	for i, mirror := range mirrors {
+		if err := validateSubscriptionURL(strings.TrimSpace(mirror)); err != nil {
+			return fmt.Errorf("mirrors[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func checkSubscriptionRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("too many redirects")
+	}
+	if req.URL.Scheme != "https" {
+		return fmt.Errorf("subscription redirect must use https")
+	}
+	if err := validateSubscriptionURL(req.URL.String()); err != nil {
+		return fmt.Errorf("redirect denied: %w", err)
+	}
+	return nil
 }
 
 func SetupSubscriptionRoutes(s *Server) {
@@ -43,6 +105,10 @@ func SetupSubscriptionRoutes(s *Server) {
 	api.HandleFunc("/subscriptions", s.handleSubscriptionsList).Methods("GET", "OPTIONS")
 	api.HandleFunc("/subscriptions", s.handleSubscriptionsAdd).Methods("POST", "OPTIONS")
 	api.HandleFunc("/subscriptions/{id}/update", s.handleSubscriptionUpdate).Methods("POST", "OPTIONS")
+	api.HandleFunc("/subscriptions/{id}/filters", s.handleSubscriptionFilters).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/subscriptions/{id}/alerts", s.handleSubscriptionAlerts).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/subscriptions/{id}/fetch", s.handleSubscriptionFetchOptions).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/subscriptions/{id}/quota", s.handleSubscriptionQuota).Methods("GET", "OPTIONS")
 	api.HandleFunc("/subscriptions/{id}", s.handleSubscriptionRemove).Methods("DELETE", "OPTIONS")
 }
 
@@ -53,8 +119,8 @@ func (s *Server) handleSubscriptionsList(w http.ResponseWriter, _ *http.Request)
 		return
 	}
 	list := mgr.List()
-	for _, sub := range list {
-		sub.URL = maskSubscriptionURL(sub.URL)
+	for i, sub := range list {
+		list[i] = maskSubscription(sub)
 	}
 	s.respondJSON(w, http.StatusOK, map[string]any{"subscriptions": list})
 }
@@ -66,25 +132,39 @@ func (s *Server) handleSubscriptionsAdd(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	var req struct {
-		Name          string `json:"name"`
-		URL           string `json:"url"`
-		UpdateEvery   string `json:"update_every"`
-		UpdateEveryMs int64  `json:"update_every_ms"`
-		UserAgent     string `json:"user_agent"`
+		Name          string                   `json:"name"`
+		URL           string                   `json:"url"`
+		Mirrors       []string                 `json:"mirrors"`
+		FetchRoute    subscription.FetchRoute  `json:"fetch_route"`
+		UpdateEvery   string                   `json:"update_every"`
+		UpdateEveryMs int64                    `json:"update_every_ms"`
+		UserAgent     string                   `json:"user_agent"`
+		ImportRouting bool                     `json:"import_routing"`
+		Filters       subscription.Filters     `json:"filters"`
+		Alerts        subscription.QuotaAlerts `json:"alerts"`
 	}
 	if !decodeStrictJSON(w, r, &req, maxServersRequestBytes) {
 		return
 	}
+	if err := validateSubscriptionURLs(strings.TrimSpace(req.URL), req.Mirrors); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	interval, err := parseSubscriptionInterval(req.UpdateEvery, req.UpdateEveryMs)
 	if err != nil {
 		s.respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 	sub := &subscription.Subscription{
-		Name:        strings.TrimSpace(req.Name),
-		URL:         strings.TrimSpace(req.URL),
-		UpdateEvery: interval,
-		UserAgent:   strings.TrimSpace(req.UserAgent),
+		Name:          strings.TrimSpace(req.Name),
+		URL:           strings.TrimSpace(req.URL),
+		Mirrors:       req.Mirrors,
+		FetchRoute:    req.FetchRoute,
+		UpdateEvery:   interval,
+		UserAgent:     strings.TrimSpace(req.UserAgent),
+		ImportRouting: req.ImportRouting,
+		Filters:       req.Filters,
+		Alerts:        req.Alerts,
 	}
 	if err := mgr.Add(sub); err != nil {
 		s.respondError(w, http.StatusBadRequest, err.Error())
@@ -121,6 +201,105 @@ func (s *Server) handleSubscriptionUpdate(w http.ResponseWriter, r *http.Request
 	s.respondJSON(w, http.StatusOK, map[string]any{"success": true, "result": result})
 }
 
+// handleSubscriptionFilters PUT /api/subscriptions/{id}/filters — заменяет
+// фильтры и сразу обновляет подписку: ответ провайдера не хранится, без
+// загрузки новые фильтры применить не к чему.
+func (s *Server) handleSubscriptionFilters(w http.ResponseWriter, r *http.Request) {
+	mgr := s.subscriptionManager()
+	if mgr == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "subscriptions are not available")
+		return
+	}
+	var filters subscription.Filters
+	if !decodeStrictJSON(w, r, &filters, maxServersRequestBytes) {
+		return
+	}
+	if err := filters.Validate(); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if err := mgr.SetFilters(id, filters); err != nil {
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	result, err := mgr.UpdateNow(r.Context(), id)
+	if err != nil {
+		s.respondJSON(w, http.StatusAccepted, map[string]any{"success": false, "result": result, "error": err.Error()})
+		return
+	}
+	s.respondJSON(w, http.StatusOK, map[string]any{"success": true, "result": result})
+}
+
+// handleSubscriptionAlerts PUT /api/subscriptions/{id}/alerts — пороги
+// уведомлений о трафике и сроке и действие при исчерпании.
+func (s *Server) handleSubscriptionAlerts(w http.ResponseWriter, r *http.Request) {
+	mgr := s.subscriptionManager()
+	if mgr == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "subscriptions are not available")
+		return
+	}
+	var alerts subscription.QuotaAlerts
+	if !decodeStrictJSON(w, r, &alerts, maxServersRequestBytes) {
+		return
+	}
+	if err := alerts.Validate(); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := mgr.SetAlerts(mux.Vars(r)["id"], alerts); err != nil {
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, map[string]any{"success": true, "alerts": alerts})
+}
+
+// handleSubscriptionQuota GET /api/subscriptions/{id}/quota — квота и прогноз
+// её исчерпания по расходу между обновлениями.
+func (s *Server) handleSubscriptionQuota(w http.ResponseWriter, r *http.Request) {
+	mgr := s.subscriptionManager()
+	if mgr == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "subscriptions are not available")
+		return
+	}
+	projection, err := mgr.Projection(mux.Vars(r)["id"])
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, projection)
+}
+
+// handleSubscriptionFetchOptions PUT /api/subscriptions/{id}/fetch — зеркала
+// и маршрут загрузки (direct, tunnel, direct_then_tunnel).
+func (s *Server) handleSubscriptionFetchOptions(w http.ResponseWriter, r *http.Request) {
+	mgr := s.subscriptionManager()
+	if mgr == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "subscriptions are not available")
+		return
+	}
+	var req struct {
+		Mirrors []string                `json:"mirrors"`
+		Route   subscription.FetchRoute `json:"route"`
+	}
+	if !decodeStrictJSON(w, r, &req, maxServersRequestBytes) {
+		return
+	}
+	if err := subscription.ValidateFetchOptions(req.Mirrors, req.Route); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateSubscriptionURLs("", req.Mirrors); err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := mgr.SetFetchOptions(mux.Vars(r)["id"], req.Mirrors, req.Route); err != nil {
+		s.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.respondJSON(w, http.StatusOK, MessageResponse{Success: true, Message: "fetch options updated"})
+}
+
 func (s *Server) handleSubscriptionRemove(w http.ResponseWriter, r *http.Request) {
 	mgr := s.subscriptionManager()
 	if mgr == nil {
@@ -141,6 +320,24 @@ func (s *Server) handleSubscriptionRemove(w http.ResponseWriter, r *http.Request
 	s.respondJSON(w, http.StatusOK, MessageResponse{Success: true, Message: "subscription removed"})
 }
 
+// manualServerURIs — URI серверов из servers.json, добавленных не подписками.
+// Менеджер подписок не добавляет их повторно.
+func (h *ServersHandlers) manualServerURIs() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	list, err := loadServers()
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, server := range list {
+		if server.SubscriptionID == "" && !server.Deleted {
+			out = append(out, server.URL)
+		}
+	}
+	return out
+}
+
 func (h *ServersHandlers) applySubscriptionServers(ctx context.Context, sub subscription.Subscription, result subscription.UpdateResult) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -177,17 +374,24 @@ func (h *ServersHandlers) applySubscriptionServers(ctx context.Context, sub subs
 		if name == "" {
 			name = "Сервер"
 		}
+		country := "??"
+		if incoming.Country != "" {
+			country = incoming.Country
+		}
 		if idx, ok := existing[key]; ok {
 			list[idx].Name = name
 			list[idx].URL = incoming.URI
 			list[idx].Deleted = false
+			if incoming.Country != "" {
+				list[idx].CountryCode = country
+			}
 			continue
 		}
 		list = append(list, ServerEntry{
 			ID:              subscriptionServerID(sub.ID, key),
 			Name:            name,
 			URL:             incoming.URI,
-			CountryCode:     "??",
+			CountryCode:     country,
 			AddedAt:         now,
 			SubscriptionID:  sub.ID,
 			SubscriptionKey: key,
@@ -201,6 +405,11 @@ func (h *ServersHandlers) applySubscriptionServers(ctx context.Context, sub subs
 	if err := saveServers(list); err != nil {
 		return fmt.Errorf("write servers: %w", err)
 	}
+	if sub.ImportRouting && result.Routing != nil {
+		if err := saveClashDraftProfile(sub, result); err != nil {
+			return fmt.Errorf("write clash profile: %w", err)
+		}
+	}
 	if len(visibleServers(list)) == len(result.Servers) && len(result.Servers) > 0 {
 		active, readErr := config.ReadSecretKey(h.secretKey)
 		if readErr != nil || strings.TrimSpace(active) == "" {
@@ -214,6 +423,111 @@ func (h *ServersHandlers) applySubscriptionServers(ctx context.Context, sub subs
 	return nil
 }
 
+// clashDraftProfile собирает профиль маршрутизации из proxy-groups и rules
+// Clash-подписки. Имена прокси Clash заменяются ID серверов подписки, группы
+// получают стабильные ID, чтобы повторное обновление не плодило дубликаты.
+func clashDraftProfile(sub subscription.Subscription, result subscription.UpdateResult) *Profile {
+	serverIDs := map[string]string{}
+	for _, entry := range result.Servers {
+		if key := subscriptionServerKey(entry.URI); key != "" && entry.Name != "" {
+			serverIDs[entry.Name] = subscriptionServerID(sub.ID, key)
+		}
+	}
+	groupIDs := map[string]string{}
+	routing := config.RoutingConfig{DefaultAction: config.ActionProxy, Rules: []config.RoutingRule{}, BlockQUIC: true}
+	for _, g := range result.Routing.Groups {
+		group := config.ServerGroup{ID: clashGroupID(sub.ID, g.Name), Name: g.Name, Type: g.Type}
+		for _, name := range g.Proxies {
+			if id, ok := serverIDs[name]; ok {
+				group.Servers = append(group.Servers, id)
+			}
+		}
+		if len(group.Servers) == 0 {
+			continue
+		}
+		groupIDs[g.Name] = group.ID
+		routing.Groups = append(routing.Groups, group)
+	}
+	// target переводит цель Clash в действие и сервер/группу правила.
+	target := func(name string) (action config.RuleAction, server, group string, ok bool) {
+		switch name {
+		case subscription.ClashTargetDirect:
+			return config.ActionDirect, "", "", true
+		case subscription.ClashTargetReject:
+			return config.ActionBlock, "", "", true
+		}
+		if id, found := groupIDs[name]; found {
+			return config.ActionProxy, "", id, true
+		}
+		if id, found := serverIDs[name]; found {
+			return config.ActionProxy, id, "", true
+		}
+		return "", "", "", false
+	}
+	for _, r := range result.Routing.Rules {
+		action, server, group, ok := target(r.Target)
+		if !ok {
+			continue
+		}
+		routing.Rules = append(routing.Rules, config.RoutingRule{
+			Value:  r.Value,
+			Type:   r.Type,
+			Action: action,
+			Note:   "clash: " + r.Target,
+			Server: server,
+			Group:  group,
+		})
+	}
+	if action, _, group, ok := target(result.Routing.Final); ok {
+		routing.DefaultAction = action
+		routing.DefaultGroup = group
+	}
+	config.SanitizeRoutingConfig(&routing)
+
+	name := strings.TrimSpace(sub.Name) + " Clash"
+	if !reValidName.MatchString(name) {
+		name = "Clash " + sub.ID
+	}
+	now := time.Now()
+	p := &Profile{
+		Name:           name,
+		Description:    "Черновик из Clash-подписки, перезаписывается при её обновлении",
+		ServerSelector: ServerSelector{Mode: "subscription_auto", SubID: sub.ID},
+		Routing:        routing,
+		RoutingRules:   routing.Rules,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	normalizeProfile(p)
+	return p
+}
+
+// saveClashDraftProfile пишет черновик в каталог профилей. Применяет его
+// пользователь сам — как любой импортированный профиль.
+func saveClashDraftProfile(sub subscription.Subscription, result subscription.UpdateResult) error {
+	p := clashDraftProfile(sub, result)
+	path, err := profilePath(sanitizeFilename(p.Name) + ".json")
+	if err != nil {
+		return err
+	}
+	if prev, err := loadProfile(filepath.Base(path)); err == nil && !prev.CreatedAt.IsZero() {
+		p.CreatedAt = prev.CreatedAt
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(profilesDir, 0755); err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(path, data, 0644)
+}
+
+func clashGroupID(subID, name string) string {
+	sum := sha256.Sum256([]byte(subID + "\x00" + name))
+	return "clash-" + hex.EncodeToString(sum[:6])
+}
+
 func (h *ServersHandlers) removeSubscriptionServers(id string) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -275,6 +589,10 @@ func decodeStrictJSON(w http.ResponseWriter, r *http.Request, dst any, limit int
 func maskSubscription(sub *subscription.Subscription) *subscription.Subscription {
 	cp := *sub
 	cp.URL = maskSubscriptionURL(cp.URL)
+	cp.Mirrors = make([]string, len(sub.Mirrors))
+	for i, mirror := range sub.Mirrors {
+		cp.Mirrors[i] = maskSubscriptionURL(mirror)
+	}
 	return &cp
 }
 
@@ -287,6 +605,15 @@ func maskSubscriptionURL(raw string) string {
 }
 
 func subscriptionServerKey(raw string) string {
+	// Outbound sing-box: ключ из тех же частей, что у URI, — иначе любое
+	// изменение второстепенного поля (tag, tls) меняло бы ID сервера.
+	if config.IsSingBoxOutboundContent(raw) {
+		if parsed, err := config.ParseServerContent(raw); err == nil {
+			ob := parsed.Outbound
+			user := firstNonEmptyAPI(ob.UUID, ob.Password, ob.PrivateKey)
+			return strings.ToLower(ob.Type + "://" + user + "@" + net.JoinHostPort(ob.Server, strconv.Itoa(ob.ServerPort)))
+		}
+	}
 	parsed, err := url.Parse(raw)
 	if err != nil || parsed.Host == "" {
 		return raw
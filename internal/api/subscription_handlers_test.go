@@ -5,9 +5,11 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -75,6 +77,58 @@ func TestApplySubscriptionServersKeepsManualAndMarksDeleted(t *testing.T) {
 	}
 }
 
+func TestApplySubscriptionServersWritesClashDraftProfile(t *testing.T) {
+	srv, _, cleanup := buildServersServer(t)
+	defer cleanup()
+	h := &ServersHandlers{server: srv, secretKey: "secret.key"}
+
+	const nl = "vless://00000000-0000-0000-0000-000000000001@nl.example.com:443?encryption=none"
+	const de = "vless://00000000-0000-0000-0000-000000000002@de.example.com:443?encryption=none"
+	result := subscription.UpdateResult{
+		Servers: []subscription.ServerEntry{{Name: "nl", URI: nl}, {Name: "de", URI: de}},
+		Routing: &subscription.RoutingDraft{
+			Groups: []subscription.DraftGroup{{Name: "Auto", Type: config.GroupTypeURLTest, Proxies: []string{"nl", "de"}}},
+			Rules: []subscription.DraftRule{
+				{Type: config.RuleTypeDomain, Value: "google.com", Target: "Auto"},
+				{Type: config.RuleTypeDomain, Value: "example.de", Target: "de"},
+				{Type: config.RuleTypeIP, Value: "10.0.0.0/8", Target: subscription.ClashTargetDirect},
+			},
+			Final: "Auto",
+		},
+	}
+	sub := subscription.Subscription{ID: "sub1", Name: "Provider", ImportRouting: true}
+	if err := h.applySubscriptionServers(context.Background(), sub, result); err != nil {
+		t.Fatalf("applySubscriptionServers: %v", err)
+	}
+	p, err := loadProfile("Provider_Clash.json")
+	if err != nil {
+		t.Fatalf("draft profile not written: %v", err)
+	}
+	if len(p.Routing.Groups) != 1 || len(p.Routing.Groups[0].Servers) != 2 {
+		t.Fatalf("groups = %+v", p.Routing.Groups)
+	}
+	groupID := p.Routing.Groups[0].ID
+	if p.Routing.DefaultAction != config.ActionProxy || p.Routing.DefaultGroup != groupID {
+		t.Errorf("default = %s/%s, want proxy/%s", p.Routing.DefaultAction, p.Routing.DefaultGroup, groupID)
+	}
+	rules := p.Routing.Rules
+	if len(rules) != 3 {
+		t.Fatalf("rules = %+v", rules)
+	}
+	if rules[0].Group != groupID || rules[1].Server != subscriptionServerID("sub1", subscriptionServerKey(de)) || rules[2].Action != config.ActionDirect {
+		t.Errorf("rules = %+v", rules)
+	}
+
+	sub.ImportRouting = false
+	sub.Name = "Other"
+	if err := h.applySubscriptionServers(context.Background(), sub, result); err != nil {
+		t.Fatalf("applySubscriptionServers: %v", err)
+	}
+	if _, err := loadProfile("Other_Clash.json"); err == nil {
+		t.Error("draft profile must not be written without import_routing")
+	}
+}
+
 func TestSubscriptionHandlersAddUpdatesServers(t *testing.T) {
 	dir := t.TempDir()
 	if err := os.MkdirAll(dir+"/"+config.DataDir, 0755); err != nil {
@@ -101,11 +155,18 @@ func TestSubscriptionHandlersAddUpdatesServers(t *testing.T) {
 	}))
 	defer ts.Close()
 	client := ts.Client()
-	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // nosec G402: local httptest TLS certificate.
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // nosec G402: local httptest TLS certificate.
+	// Адрес 127.0.0.1 подписке запрещён: публичное имя ведёт на тестовый сервер.
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+	}
+	subURL := "https://subscription.example/sub"
 	mgr, err := subscription.NewManager(subscription.Options{
 		Dir:          t.TempDir(),
 		Client:       client,
 		IsSupported:  isSupportedServerURI,
+		ValidateURL:  validateSubscriptionURL,
 		ApplyServers: h.applySubscriptionServers,
 	})
 	if err != nil {
@@ -114,9 +175,24 @@ func TestSubscriptionHandlersAddUpdatesServers(t *testing.T) {
 	srv.subscriptions = mgr
 	SetupSubscriptionRoutes(srv)
 
+	for _, bad := range []string{
+		`{"url":"https://127.0.0.1:9090/sub"}`,
+		`{"url":"https://provider.example/sub","mirrors":["https://192.168.1.1/sub"]}`,
+	} {
+		// Напрямую, мимо ограничителя частоты запросов.
+		w := httptest.NewRecorder()
+		srv.handleSubscriptionsAdd(w, httptest.NewRequest(http.MethodPost, "/api/subscriptions", strings.NewReader(bad)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("POST /api/subscriptions %s = %d, want 400", bad, w.Code)
+		}
+	}
+	if err := mgr.Add(&subscription.Subscription{URL: "https://10.0.0.1/sub"}); err == nil {
+		t.Error("Manager.Add accepted a private subscription URL")
+	}
+
 	body, _ := json.Marshal(map[string]string{
 		"name":         "Sub",
-		"url":          ts.URL,
+		"url":          subURL,
 		"update_every": "1h",
 	})
 	w := httptest.NewRecorder()
@@ -135,6 +211,21 @@ func TestSubscriptionHandlersAddUpdatesServers(t *testing.T) {
 	if raw, err := os.ReadFile(secretKeyPath); err != nil || len(raw) == 0 {
 		t.Fatalf("secret key was not auto-activated: len=%d err=%v", len(raw), err)
 	}
+
+	path := "/api/subscriptions/" + mgr.List()[0].ID + "/filters"
+	for body, want := range map[string]int{
+		`{"include":{"name":"("}}`:               http.StatusBadRequest,
+		`{"exclude":{"protocol":"vless"}}`:       http.StatusAccepted,
+		`{"rename":{"template":"{sub} {name}"}}`: http.StatusOK,
+		`{"unknown":true}`:                       http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, path, strings.NewReader(body)))
+		if w.Code != want {
+			t.Errorf("PUT filters %s = %d, want %d, body=%s", body, w.Code, want, w.Body.String())
+		}
+	}
+
 }
 
 func TestManagedSubscriptionHTTPClientRejectsHTTPRedirect(t *testing.T) {
@@ -166,3 +257,94 @@ func TestSubscriptionListAvailableWhileManagerLoads(t *testing.T) {
 		t.Fatalf("subscriptions = %d, want 0", len(body.Subscriptions))
 	}
 }
+
+func TestSubscriptionAlertFailsOverToAnotherSubscription(t *testing.T) {
+	srv, secretKeyPath, cleanup := buildServersServer(t)
+	defer cleanup()
+	srv.serversHandlers = &ServersHandlers{server: srv, secretKey: secretKeyPath}
+
+	const exhausted = "vless://00000000-0000-0000-0000-000000000001@a.example.com:443?encryption=none"
+	const other = "vless://00000000-0000-0000-0000-000000000002@b.example.com:443?encryption=none"
+	if err := saveServers([]ServerEntry{
+		{ID: "manual", Name: "Manual", URL: "vless://00000000-0000-0000-0000-000000000003@m.example.com:443?encryption=none", CountryCode: "??"},
+		{ID: "a", Name: "A", URL: exhausted, CountryCode: "??", SubscriptionID: "sub1"},
+		{ID: "b", Name: "B", URL: other, CountryCode: "??", SubscriptionID: "sub2"},
+	}); err != nil {
+		t.Fatalf("saveServers: %v", err)
+	}
+	if err := config.WriteSecretKey(secretKeyPath, exhausted); err != nil {
+		t.Fatalf("WriteSecretKey: %v", err)
+	}
+
+	sub := subscription.Subscription{ID: "sub1", Name: "Provider"}
+	alert := subscription.Alert{
+		Kind:   subscription.AlertExhausted,
+		Quota:  subscription.Quota{Download: 10 << 30, Total: 10 << 30},
+		Action: subscription.ExhaustedFailover,
+	}
+	if msg := subscriptionAlertMessage(sub, alert); !strings.Contains(msg, "исчерпан") || !strings.Contains(msg, "10.0 ГБ") {
+		t.Errorf("message = %q", msg)
+	}
+	srv.handleSubscriptionAlert(sub, alert)
+	active, err := config.ReadSecretKey(secretKeyPath)
+	if err != nil || active != other {
+		t.Fatalf("active = %q, %v; want server of the other subscription", active, err)
+	}
+
+	// The active server no longer belongs to sub1: nothing to switch.
+	if id, err := srv.serversHandlers.failoverFromSubscription("sub1"); id != "" || err != nil {
+		t.Errorf("second failover = %q, %v", id, err)
+	}
+}
+
+func TestManagedSubscriptionTunnelClientRejectsPrivateHosts(t *testing.T) {
+	client := newManagedSubscriptionTunnelClient()
+	for _, target := range []string{"https://127.0.0.1:9090/sub", "https://localhost/sub", "https://192.168.1.1/sub"} {
+		resp, err := client.Get(target)
+		if err == nil {
+			_ = resp.Body.Close()
+			t.Errorf("tunnel client fetched %s", target)
+		} else if !strings.Contains(err.Error(), "private/local") {
+			t.Errorf("GET %s: %v", target, err)
+		}
+	}
+}
+
+func TestSubscriptionFetchOptionsMasksMirrors(t *testing.T) {
+	srv := NewServer(Config{
+		ListenAddress: ":0",
+		XRayManager:   &stubXray{running: false},
+		ProxyManager:  &stubProxy{},
+		Logger:        &logger.NoOpLogger{},
+	}, context.Background())
+	mgr, err := subscription.NewManager(subscription.Options{Dir: t.TempDir(), IsSupported: isSupportedServerURI})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if err := mgr.Add(&subscription.Subscription{ID: "sub1", Name: "Sub", URL: "https://provider.example/sub"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	srv.subscriptions = mgr
+	SetupSubscriptionRoutes(srv)
+
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{`{"route":"proxy"}`, http.StatusBadRequest},
+		{`{"mirrors":["http://mirror.example"]}`, http.StatusBadRequest},
+		{`{"mirrors":["https://127.0.0.1:9090/"]}`, http.StatusBadRequest},
+		{`{"mirrors":["https://[fe80::1]/sub"]}`, http.StatusBadRequest},
+		{`{"mirrors":["https://mirror.example/sub?token=secret"],"route":"direct_then_tunnel"}`, http.StatusOK},
+	} {
+		w := putJSON(t, srv.router, "/api/subscriptions/sub1/fetch", json.RawMessage(tc.body))
+		if w.Code != tc.want {
+			t.Errorf("PUT fetch %s = %d, want %d, body=%s", tc.body, w.Code, tc.want, w.Body.String())
+		}
+	}
+	w := getJSON(t, srv.router, "/api/subscriptions")
+	body := w.Body.String()
+	if strings.Contains(body, "token=secret") || !strings.Contains(body, "https://mirror.example/...") || !strings.Contains(body, `"fetch_route":"direct_then_tunnel"`) {
+		t.Errorf("list = %s", body)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"proxyclient/internal/trafficdb"
+)
+
+const monthLayout = "2006-01"
+
+// trafficDBSnapshot переводит снимок Clash API в снимок для учёта трафика.
+// Имена процессов и цели совпадают с /api/traffic/by-process и /api/connections/inspect.
+func trafficDBSnapshot(snap clashConnections) trafficdb.Snapshot {
+	out := make([]trafficdb.Conn, 0, len(snap.Connections))
+	for _, c := range snap.Connections {
+		proc := filepath.Base(c.Metadata.ProcessPath)
+		if proc == "" || proc == "." {
+			proc = trafficdb.UnattributedProcess
+		}
+		host := c.Metadata.Host
+		if host == "" {
+			host = c.Metadata.DestinationIP
+		}
+		out = append(out, trafficdb.Conn{
+			ID:       c.ID,
+			Process:  proc,
+			Host:     host,
+			Outbound: c.effectiveOutbound(),
+			Upload:   c.Upload,
+			Download: c.Download,
+		})
+	}
+	return trafficdb.Snapshot{Conns: out, UploadTotal: snap.UploadTotal, DownloadTotal: snap.DownloadTotal}
+}
+
+// trafficUsageRange разбирает ?period=day|month&date=... в диапазон дней.
+// По умолчанию — текущий месяц; date для day — YYYY-MM-DD, для month — YYYY-MM.
+func trafficUsageRange(r *http.Request, now time.Time) (period, from, to string, err error) {
+	q := r.URL.Query()
+	period = q.Get("period")
+	if period == "" {
+		period = "month"
+	}
+	date := q.Get("date")
+	switch period {
+	case "day":
+		day := now
+		if date != "" {
+			if day, err = time.ParseInLocation(trafficdb.DayLayout, date, time.Local); err != nil {
+				return "", "", "", fmt.Errorf("date: ожидается YYYY-MM-DD")
+			}
+		}
+		from = day.Format(trafficdb.DayLayout)
+		return period, from, from, nil
+	case "month":
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+		if date != "" {
+			if month, err = time.ParseInLocation(monthLayout, date, time.Local); err != nil {
+				return "", "", "", fmt.Errorf("date: ожидается YYYY-MM")
+			}
+		}
+		return period, month.Format(trafficdb.DayLayout), month.AddDate(0, 1, -1).Format(trafficdb.DayLayout), nil
+	default:
+		return "", "", "", fmt.Errorf("period: day | month")
+	}
+}
+
+func (s *Server) trafficDBAvailable(w http.ResponseWriter) bool {
+	if s.config.TrafficDB == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "учёт трафика недоступен")
+		return false
+	}
+	return true
+}
+
+// handleTrafficUsage GET /api/traffic/usage?period=month&date=2026-10&by=process&limit=20
+// — какие процессы (домены, outbound'ы, дни) израсходовали трафик за период.
+func (s *Server) handleTrafficUsage(w http.ResponseWriter, r *http.Request) {
+	if !s.trafficDBAvailable(w) {
+		return
+	}
+	period, from, to, err := trafficUsageRange(r, time.Now())
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	by := trafficdb.Dimension(r.URL.Query().Get("by"))
+	if by == "" {
+		by = trafficdb.ByProcess
+	}
+	if !trafficdb.ValidDimension(by) {
+		s.respondError(w, http.StatusBadRequest, "by: process | host | outbound | day")
+		return
+	}
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			s.respondError(w, http.StatusBadRequest, "limit должен быть > 0")
+			return
+		}
+	}
+	rows, err := s.config.TrafficDB.Breakdown(r.Context(), from, to, by, 0)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Итог считается по всем строкам, limit обрезает только список.
+	var total trafficdb.Usage
+	for _, row := range rows {
+		total.Upload += row.Upload
+		total.Download += row.Download
+		total.Connections += row.Connections
+	}
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"period": period,
+		"from":   from,
+		"to":     to,
+		"by":     by,
+		"total":  total,
+		"rows":   rows,
+	})
+}
+
+// handleTrafficUsageCSV GET /api/traffic/usage/export.csv?period=month&date=2026-10
+// — все строки учёта за период: день, процесс, хост, outbound, байты, соединения.
+func (s *Server) handleTrafficUsageCSV(w http.ResponseWriter, r *http.Request) {
+	if !s.trafficDBAvailable(w) {
+		return
+	}
+	_, from, to, err := trafficUsageRange(r, time.Now())
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	records, err := s.config.TrafficDB.Records(r.Context(), from, to)
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="safesky-traffic-%s_%s.csv"`, from, to))
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"day", "process", "host", "outbound", "upload_bytes", "download_bytes", "connections"})
+	for _, rec := range records {
+		_ = cw.Write([]string{
+			rec.Day, rec.Process, rec.Host, rec.Outbound,
+			strconv.FormatInt(rec.Upload, 10),
+			strconv.FormatInt(rec.Download, 10),
+			strconv.FormatInt(rec.Connections, 10),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		s.logger.Warn("handleTrafficUsageCSV: write response: %v", err)
+	}
+}
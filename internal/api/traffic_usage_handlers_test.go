@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"proxyclient/internal/logger"
+	"proxyclient/internal/trafficdb"
+)
+
+func TestTrafficUsageRange(t *testing.T) {
+	now := time.Date(2026, 2, 14, 12, 0, 0, 0, time.Local)
+	cases := []struct {
+		query, from, to string
+	}{
+		{"", "2026-02-01", "2026-02-28"},
+		{"period=month&date=2024-02", "2024-02-01", "2024-02-29"},
+		{"period=day", "2026-02-14", "2026-02-14"},
+		{"period=day&date=2026-01-03", "2026-01-03", "2026-01-03"},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/api/traffic/usage?"+tc.query, nil)
+		_, from, to, err := trafficUsageRange(r, now)
+		if err != nil || from != tc.from || to != tc.to {
+			t.Errorf("%q: got %s..%s err=%v, want %s..%s", tc.query, from, to, err, tc.from, tc.to)
+		}
+	}
+	for _, q := range []string{"period=week", "period=month&date=2026-13", "period=day&date=14.02.2026"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/traffic/usage?"+q, nil)
+		if _, _, _, err := trafficUsageRange(r, now); err == nil {
+			t.Errorf("%q: expected error", q)
+		}
+	}
+}
+
+func TestTrafficUsageEndpoints(t *testing.T) {
+	store, err := trafficdb.Open(filepath.Join(t.TempDir(), "traffic.db"))
+	if err != nil {
+		t.Fatalf("trafficdb.Open: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store.Start(ctx, nil)
+	s := NewServer(Config{Logger: &logger.NoOpLogger{}, TrafficDB: store}, ctx)
+	s.router.HandleFunc("/api/traffic/usage", s.handleTrafficUsage)
+	s.router.HandleFunc("/api/traffic/usage/export.csv", s.handleTrafficUsageCSV)
+
+	var conns []clashConn
+	for i, spec := range []struct{ proc, host string }{
+		{filepath.Join("Program Files", "Google", "Chrome", "chrome.exe"), "video.example.com"},
+		{filepath.Join("Apps", "Telegram.exe"), ""},
+		{"", "cdn.example.com"},
+	} {
+		c := clashConn{ID: string(rune('a' + i)), Outbound: "proxy-out", Upload: int64(10 * (i + 1)), Download: int64(1000 * (3 - i))}
+		c.Metadata.ProcessPath = spec.proc
+		c.Metadata.Host = spec.host
+		c.Metadata.DestinationIP = "149.154.167.51"
+		conns = append(conns, c)
+	}
+	store.Observe(trafficDBSnapshot(clashConnections{Connections: conns}))
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/traffic/usage?by=process&limit=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("usage = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Total trafficdb.Usage `json:"total"`
+		Rows  []trafficdb.Row `json:"rows"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total.Download != 6000 || resp.Total.Connections != 3 {
+		t.Errorf("total = %+v", resp.Total)
+	}
+	if len(resp.Rows) != 2 || resp.Rows[0].Key != "chrome.exe" || resp.Rows[1].Key != "Telegram.exe" {
+		t.Errorf("rows = %+v", resp.Rows)
+	}
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/traffic/usage/export.csv?period=day", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("csv = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	if len(records) != 4 || records[0][0] != "day" {
+		t.Fatalf("csv records = %v", records)
+	}
+	if records[2][1] != "Telegram.exe" || records[2][2] != "149.154.167.51" || records[3][1] != "unknown" {
+		t.Errorf("csv rows = %v", records[1:])
+	}
+
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/traffic/usage?by=country", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("by=country = %d, want 400", w.Code)
+	}
+}
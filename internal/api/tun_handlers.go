@@ -10,13 +10,16 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"proxyclient/internal/apprules"
 	"proxyclient/internal/config"
 	"proxyclient/internal/engine"
+	"proxyclient/internal/leaktest"
 	"proxyclient/internal/logger"
 	"proxyclient/internal/proxy"
 	"proxyclient/internal/wintun"
@@ -27,6 +30,7 @@ import (
 
 var routingConfigPath = config.DataDir + "/routing.json"
 var errSaveRoutingConfig = errors.New("не удалось сохранить правила")
+var errProcessRulesNeedApps = errors.New("process-правила задаются в /api/apps/rules")
 
 const (
 	maxTunSmallRequestBytes = 4 << 10
@@ -200,6 +204,10 @@ type routingDiff struct {
 	RulesTotal           int  `json:"rules_total"`
 	DefaultActionChanged bool `json:"default_action_changed"`
 	ProcessRulesChanged  bool `json:"process_rules_changed"` // BUG FIX: при изменении process-правил нужен полный перезапуск
+	// IPv6ModeChanged — меняются адреса TUN, hot-reload их не применит.
+	IPv6ModeChanged bool `json:"ipv6_mode_changed"`
+	// ProxyOnlyChanged — появляется или пропадает TUN inbound.
+	ProxyOnlyChanged bool `json:"proxy_only_changed"`
 }
 
 // hasProcessRules проверяет есть ли в конфиге process-правила
@@ -208,7 +216,7 @@ func hasProcessRules(cfg *config.RoutingConfig) bool {
 		return false
 	}
 	for _, rule := range cfg.Rules {
-		if rule.Type == config.RuleTypeProcess {
+		if config.IsProcessRuleType(rule.Type) {
 			return true
 		}
 	}
@@ -226,12 +234,52 @@ func cloneRoutingConfig(src *config.RoutingConfig) *config.RoutingConfig {
 		BlockTelemetry:  src.BlockTelemetry,
 		LANShareEnabled: src.LANShareEnabled,
 		LANSharePort:    src.LANSharePort,
+		LANPolicy:       src.LANPolicy,
+		DefaultGroup:    src.DefaultGroup,
+		IPv6Mode:        src.IPv6Mode,
+		ProxyOnly:       src.ProxyOnly,
 	}
 	if src.Rules != nil {
 		dst.Rules = append([]config.RoutingRule(nil), src.Rules...)
 	}
+	if src.Groups != nil {
+		dst.Groups = make([]config.ServerGroup, len(src.Groups))
+		for i, g := range src.Groups {
+			g.Servers = append([]string(nil), g.Servers...)
+			dst.Groups[i] = g
+		}
+	}
+	if src.RuleSets != nil {
+		dst.RuleSets = append([]config.RemoteRuleSet(nil), src.RuleSets...)
+	}
+	if src.LANUsers != nil {
+		dst.LANUsers = append([]config.LANUser(nil), src.LANUsers...)
+	}
+	if src.LANAllowCIDRs != nil {
+		dst.LANAllowCIDRs = append([]string(nil), src.LANAllowCIDRs...)
+	}
 	if src.DNS != nil {
 		dns := *src.DNS
+		// SanitizeRoutingConfig правит FakeIP, Overrides и Hosts на месте —
+		// копия не должна делить их с исходным снимком.
+		if src.DNS.FakeIP != nil {
+			fake := *src.DNS.FakeIP
+			fake.Exclude = append([]string(nil), fake.Exclude...)
+			dns.FakeIP = &fake
+		}
+		if src.DNS.Overrides != nil {
+			dns.Overrides = make([]config.DNSOverride, len(src.DNS.Overrides))
+			for i, o := range src.DNS.Overrides {
+				o.Domains = append([]string(nil), o.Domains...)
+				dns.Overrides[i] = o
+			}
+		}
+		if src.DNS.Hosts != nil {
+			dns.Hosts = make(map[string][]string, len(src.DNS.Hosts))
+			for domain, ips := range src.DNS.Hosts {
+				dns.Hosts[domain] = append([]string(nil), ips...)
+			}
+		}
 		dst.DNS = &dns
 	}
 	return dst
@@ -245,23 +293,28 @@ func computeRoutingDiff(old, newCfg *config.RoutingConfig) routingDiff {
 			RulesAdded:          len(newCfg.Rules),
 			RulesTotal:          len(newCfg.Rules),
 			ProcessRulesChanged: hasProcessRules(newCfg),
+			IPv6ModeChanged:     newCfg.IPv6Mode.IPv6Enabled(),
+			ProxyOnlyChanged:    newCfg.ProxyOnly,
 		}
 	}
 
 	// FIX 21: используем составной ключ {Value, Action, Type} вместо только Value.
 	// Без Type/Action изменение action существующего правила не обнаруживалось как diff.
+	// Server входит в ключ: перенос правила на другой сервер — тоже изменение.
 	type ruleKey struct {
 		Value  string
 		Action config.RuleAction
 		Type   config.RuleType
+		Server string
+		Group  string
 	}
 	oldSet := make(map[ruleKey]struct{}, len(old.Rules))
 	for _, r := range old.Rules {
-		oldSet[ruleKey{r.Value, r.Action, r.Type}] = struct{}{}
+		oldSet[ruleKey{r.Value, r.Action, r.Type, r.Server, r.Group}] = struct{}{}
 	}
 	newSet := make(map[ruleKey]struct{}, len(newCfg.Rules))
 	for _, r := range newCfg.Rules {
-		newSet[ruleKey{r.Value, r.Action, r.Type}] = struct{}{}
+		newSet[ruleKey{r.Value, r.Action, r.Type, r.Server, r.Group}] = struct{}{}
 	}
 
 	added := 0
@@ -290,6 +343,8 @@ func computeRoutingDiff(old, newCfg *config.RoutingConfig) routingDiff {
 		RulesTotal:           len(newCfg.Rules),
 		DefaultActionChanged: old.DefaultAction != newCfg.DefaultAction,
 		ProcessRulesChanged:  processRulesChanged,
+		IPv6ModeChanged:      config.NormalizeIPv6Mode(old.IPv6Mode) != config.NormalizeIPv6Mode(newCfg.IPv6Mode),
+		ProxyOnlyChanged:     old.ProxyOnly != newCfg.ProxyOnly,
 	}
 }
 
@@ -305,6 +360,10 @@ type TunHandlers struct {
 	// newManagerFn — фабрика xray.Manager. nil → xray.NewManager (продакшн).
 	// Тесты подменяют это поле чтобы запускать mock вместо реального sing-box.
 	newManagerFn func(cfg xray.Config, ctx context.Context) (xray.Manager, error)
+	// ipv6Check — последняя проверка IPv6-режима после apply.
+	ipv6Check ipv6CheckState
+	// ipv6ProbeFn — замер IPv6 для проверки. nil → leaktest (продакшн).
+	ipv6ProbeFn func(ctx context.Context, mode config.IPv6Mode) (*leaktest.IPv6Report, error)
 }
 
 // SetupTunRoutes регистрирует маршруты
@@ -342,6 +401,9 @@ func (s *Server) SetupTunRoutes(xrayCfg xray.Config) *TunHandlers {
 	s.router.HandleFunc("/api/tun/apply/status", h.handleApplyStatus).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/tun/export", h.handleExport).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/api/tun/import", h.handleImport).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/api/tun/ipv6/check", h.handleIPv6Check).Methods("GET", "POST", "OPTIONS")
+	h.setupGroupRoutes()
+	h.setupRuleSetRoutes()
 
 	// Сохраняем ссылку чтобы handleConnect мог вызвать TriggerApply при смене сервера.
 	s.tunHandlers = h
@@ -377,6 +439,7 @@ func (h *TunHandlers) queueApply(forceRestart, withCurrentConfig bool, source st
 	h.apply.mu.Lock()
 	h.markPendingApplyLocked(forceRestart, withCurrentConfig)
 	h.apply.mu.Unlock()
+	h.publishApplyStatus()
 	h.logQueuedApply(forceRestart, withCurrentConfig, source)
 }
 
@@ -443,6 +506,7 @@ func (h *TunHandlers) TriggerApplyWithConfig() error {
 		// FIX: аналогично TriggerApply — ставим pendingApply вместо ошибки.
 		h.markPendingApplyLocked(false, true)
 		h.apply.mu.Unlock()
+		h.publishApplyStatus()
 		h.logQueuedApply(false, true, "TriggerApplyWithConfig")
 		return nil
 	}
@@ -455,6 +519,7 @@ func (h *TunHandlers) TriggerApplyWithConfig() error {
 	h.apply.startedAt = time.Now()
 	h.apply.estimatedDone = time.Now().Add(5 * time.Second)
 	h.apply.mu.Unlock()
+	h.publishApplyStatus()
 
 	h.mu.RLock()
 	snapshot := cloneRoutingConfig(h.routing)
@@ -476,6 +541,13 @@ type RulesResponse struct {
 	BlockTelemetry  bool                 `json:"block_telemetry,omitempty"`
 	LANShareEnabled bool                 `json:"lan_share_enabled,omitempty"`
 	LANSharePort    int                  `json:"lan_share_port,omitempty"`
+	LANUsers        []config.LANUser     `json:"lan_users,omitempty"`
+	LANAllowCIDRs   []string             `json:"lan_allow_cidrs,omitempty"`
+	LANPolicy       config.LANPolicy     `json:"lan_policy"`
+	DefaultGroup    string               `json:"default_group,omitempty"`
+	Groups          []config.ServerGroup `json:"groups,omitempty"`
+	IPv6Mode        config.IPv6Mode      `json:"ipv6_mode"`
+	ProxyOnly       bool                 `json:"proxy_only"`
 }
 
 // handleListRules GET /api/tun/rules
@@ -492,10 +564,20 @@ func (h *TunHandlers) handleListRules(w http.ResponseWriter, r *http.Request) {
 		BlockTelemetry:  h.routing.BlockTelemetry,
 		LANShareEnabled: h.routing.LANShareEnabled,
 		LANSharePort:    h.routing.LANSharePort,
+		LANUsers:        h.routing.LANUsers,
+		LANAllowCIDRs:   h.routing.LANAllowCIDRs,
+		LANPolicy:       h.routing.LANPolicy,
+		DefaultGroup:    h.routing.DefaultGroup,
+		Groups:          h.routing.Groups,
+		IPv6Mode:        config.NormalizeIPv6Mode(h.routing.IPv6Mode),
+		ProxyOnly:       h.routing.ProxyOnly,
 	}
 	if resp.Rules == nil {
 		resp.Rules = []config.RoutingRule{}
 	}
+	if resp.LANPolicy == "" {
+		resp.LANPolicy = config.LANPolicyRules
+	}
 	h.server.respondJSON(w, http.StatusOK, resp)
 }
 
@@ -504,6 +586,8 @@ type AddRuleRequest struct {
 	Value  string            `json:"value"`
 	Action config.RuleAction `json:"action"`
 	Note   string            `json:"note"`
+	Server string            `json:"server,omitempty"` // ID сервера из servers.json; только для action=proxy
+	Group  string            `json:"group,omitempty"`  // ID группы серверов; только для action=proxy
 }
 
 // handleAddRule POST /api/tun/rules
@@ -526,8 +610,8 @@ func (h *TunHandlers) handleAddRule(w http.ResponseWriter, r *http.Request) {
 
 	// FIX: process rules сохраняем в оригинальном регистре.
 	// sing-box матчит process_name с учётом регистра на Windows — "telegram.exe" не совпадёт
-	// с реальным процессом "Telegram.exe". Домены и IP приводим к lowercase, .exe — нет.
-	if ruleType != config.RuleTypeProcess {
+	// с реальным процессом "Telegram.exe". Домены и IP приводим к lowercase, .exe и regex — нет.
+	if !config.KeepsRuleValueCase(ruleType) {
 		val = strings.ToLower(val)
 	}
 
@@ -535,17 +619,47 @@ func (h *TunHandlers) handleAddRule(w http.ResponseWriter, r *http.Request) {
 		h.server.respondError(w, http.StatusBadRequest, "action: proxy | direct | block")
 		return
 	}
+	req.Server = strings.TrimSpace(req.Server)
+	req.Group = strings.TrimSpace(req.Group)
+	if req.Server != "" && req.Group != "" {
+		h.server.respondError(w, http.StatusBadRequest, "укажите server или group, но не оба")
+		return
+	}
+	if err := validateRuleServer(req.Action, req.Server); err != nil {
+		h.server.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Group != "" && req.Action != config.ActionProxy {
+		h.server.respondError(w, http.StatusBadRequest, "group допустим только для action=proxy")
+		return
+	}
+
+	// Процессы хранятся только в правилах приложений (см. config.MigrateProcessRules).
+	if config.IsProcessRuleType(ruleType) {
+		h.addProcessRuleAsApp(w, config.RoutingRule{
+			Value: val, Type: ruleType, Action: req.Action, Note: req.Note, Server: req.Server, Group: req.Group,
+		})
+		return
+	}
 
 	h.server.routingOpMu.Lock()
 	defer h.server.routingOpMu.Unlock()
 
 	h.mu.Lock()
 
+	if req.Group != "" {
+		if _, ok := h.routing.FindGroup(req.Group); !ok {
+			h.mu.Unlock()
+			h.server.respondError(w, http.StatusBadRequest, fmt.Sprintf("группа %q не найдена", req.Group))
+			return
+		}
+	}
+
 	for _, rule := range h.routing.Rules {
 		// FIX 25: для process-правил сравниваем без учёта регистра (Windows нечувствителен к регистру).
 		// Без этого "telegram.exe" и "Telegram.exe" добавлялись как два разных правила.
 		dup := false
-		if ruleType == config.RuleTypeProcess {
+		if config.IsProcessRuleType(ruleType) {
 			dup = strings.EqualFold(rule.Value, val)
 		} else {
 			dup = rule.Value == val
@@ -562,6 +676,8 @@ func (h *TunHandlers) handleAddRule(w http.ResponseWriter, r *http.Request) {
 		Type:   ruleType,
 		Action: req.Action,
 		Note:   req.Note,
+		Server: req.Server,
+		Group:  req.Group,
 	}
 	h.routing.Rules = append(h.routing.Rules, newRule)
 	smartSortRoutingRules(h.routing.Rules)
@@ -602,6 +718,75 @@ func (h *TunHandlers) handleAddRule(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// addProcessRuleAsApp добавляет process-правило из POST /api/tun/rules в
+// правила приложений вместо routing.json.
+func (h *TunHandlers) addProcessRuleAsApp(w http.ResponseWriter, rule config.RoutingRule) {
+	if rule.Group != "" {
+		h.mu.RLock()
+		_, ok := h.routing.FindGroup(rule.Group)
+		h.mu.RUnlock()
+		if !ok {
+			h.server.respondError(w, http.StatusBadRequest, fmt.Sprintf("группа %q не найдена", rule.Group))
+			return
+		}
+	}
+	added, err := h.moveProcessRules([]config.RoutingRule{rule})
+	if err != nil {
+		h.server.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(added) == 0 {
+		h.server.respondError(w, http.StatusConflict, "правило уже существует")
+		return
+	}
+	applyErr := ""
+	if err := h.TriggerApply(); err != nil {
+		h.server.logger.Warn("handleAddRule: TriggerApply: %v", err)
+		applyErr = err.Error()
+	}
+	h.server.respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":     "правило добавлено в правила приложений",
+		"app_rule":    added[0],
+		"apply_error": applyErr,
+	})
+}
+
+// moveProcessRules переносит process- и process_path-правила из rules в
+// движок правил приложений: routing.json процессы больше не хранит.
+// Возвращает созданные правила приложений; правила с уже известным
+// паттерном пропускаются. Без движка (не вызван SetupAppProxyRoutes)
+// process-правила отклоняются.
+func (h *TunHandlers) moveProcessRules(rules []config.RoutingRule) ([]*apprules.Rule, error) {
+	if !slices.ContainsFunc(rules, func(r config.RoutingRule) bool { return config.IsProcessRuleType(r.Type) }) {
+		return nil, nil
+	}
+	engine := h.server.appRules
+	if engine == nil {
+		return nil, errProcessRulesNeedApps
+	}
+	_, add := config.ProcessRulesToAppRules(rules, engine.ListRules())
+	if batch, ok := engine.(interface {
+		AddRuleBatch([]apprules.Rule) ([]*apprules.Rule, error)
+	}); ok {
+		if len(add) == 0 {
+			return nil, nil
+		}
+		return batch.AddRuleBatch(add)
+	}
+	var created []*apprules.Rule
+	for _, r := range add {
+		c, err := engine.AddRule(r)
+		if err != nil {
+			for _, prev := range created {
+				_ = engine.DeleteRule(prev.ID)
+			}
+			return nil, fmt.Errorf("правило %q: %w", r.Name, err)
+		}
+		created = append(created, c)
+	}
+	return created, nil
+}
+
 // handleBulkReplaceRules тело PUT /api/tun/rules
 type BulkReplaceRequest struct {
 	DefaultAction   config.RuleAction    `json:"default_action"`
@@ -612,6 +797,11 @@ type BulkReplaceRequest struct {
 	BlockTelemetry  *bool                `json:"block_telemetry,omitempty"`
 	LANShareEnabled *bool                `json:"lan_share_enabled,omitempty"`
 	LANSharePort    *int                 `json:"lan_share_port,omitempty"`
+	LANUsers        *[]config.LANUser    `json:"lan_users,omitempty"`
+	LANAllowCIDRs   *[]string            `json:"lan_allow_cidrs,omitempty"`
+	LANPolicy       *config.LANPolicy    `json:"lan_policy,omitempty"`
+	IPv6Mode        *config.IPv6Mode     `json:"ipv6_mode,omitempty"`
+	ProxyOnly       *bool                `json:"proxy_only,omitempty"`
 }
 
 func normalizeRoutingRules(rules []config.RoutingRule) error {
@@ -631,10 +821,15 @@ func normalizeRoutingRules(rules []config.RoutingRule) error {
 		if !isValidAction(rule.Action) {
 			return fmt.Errorf("правило #%d: неверный action (proxy|direct|block)", i+1)
 		}
+		rules[i].Server = strings.TrimSpace(rule.Server)
+		rules[i].Group = strings.TrimSpace(rule.Group)
+		if (rules[i].Server != "" || rules[i].Group != "") && rule.Action != config.ActionProxy {
+			return fmt.Errorf("правило #%d: server/group допустимы только для action=proxy", i+1)
+		}
 		ruleType := config.DetectRuleType(strings.ToLower(val))
 		// FIX: process rules сохраняем в оригинальном регистре (Windows process_name чувствителен).
 		// Домены и IP приводим к lowercase.
-		if ruleType != config.RuleTypeProcess {
+		if !config.KeepsRuleValueCase(ruleType) {
 			val = strings.ToLower(val)
 		}
 		rules[i].Value = val
@@ -644,6 +839,27 @@ func normalizeRoutingRules(rules []config.RoutingRule) error {
 	return nil
 }
 
+// validateRuleServer проверяет целевой сервер правила: только для proxy
+// и только среди сохранённых (не удалённых) серверов.
+func validateRuleServer(action config.RuleAction, serverID string) error {
+	if serverID == "" {
+		return nil
+	}
+	if action != config.ActionProxy {
+		return fmt.Errorf("server допустим только для action=proxy")
+	}
+	saved, err := config.LoadSavedServers(config.ServersFile)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать список серверов: %w", err)
+	}
+	for _, s := range saved {
+		if s.ID == serverID {
+			return nil
+		}
+	}
+	return fmt.Errorf("сервер %q не найден", serverID)
+}
+
 func smartSortRoutingRules(rules []config.RoutingRule) {
 	actionRank := func(a config.RuleAction) int {
 		switch a {
@@ -663,12 +879,16 @@ func smartSortRoutingRules(rules []config.RoutingRule) {
 			return 0
 		case config.RuleTypeDomain:
 			return 1
-		case config.RuleTypeProcess:
+		case config.RuleTypeKeyword, config.RuleTypeRegex:
 			return 2
-		case config.RuleTypeGeosite:
+		case config.RuleTypeProcess, config.RuleTypeProcessPath:
 			return 3
-		default:
+		case config.RuleTypePort, config.RuleTypeNetwork:
 			return 4
+		case config.RuleTypeGeosite, config.RuleTypeRuleSet, config.RuleTypeGeoIP:
+			return 5
+		default:
+			return 6
 		}
 	}
 	sort.SliceStable(rules, func(i, j int) bool {
@@ -694,6 +914,11 @@ func (h *TunHandlers) replaceRoutingAndApply(incoming config.RoutingConfig) (int
 	if err := normalizeRoutingRules(incoming.Rules); err != nil {
 		return 0, "", err
 	}
+	moved, err := h.moveProcessRules(incoming.Rules)
+	if err != nil {
+		return 0, "", err
+	}
+	incoming.Rules = slices.DeleteFunc(incoming.Rules, func(r config.RoutingRule) bool { return config.IsProcessRuleType(r.Type) })
 
 	h.server.routingOpMu.Lock()
 	defer h.server.routingOpMu.Unlock()
@@ -710,6 +935,11 @@ func (h *TunHandlers) replaceRoutingAndApply(incoming config.RoutingConfig) (int
 	h.routing.BlockTelemetry = incoming.BlockTelemetry
 	h.routing.LANShareEnabled = incoming.LANShareEnabled
 	h.routing.LANSharePort = incoming.LANSharePort
+	h.routing.LANUsers = incoming.LANUsers
+	h.routing.LANAllowCIDRs = incoming.LANAllowCIDRs
+	h.routing.LANPolicy = incoming.LANPolicy
+	h.routing.IPv6Mode = incoming.IPv6Mode
+	h.routing.ProxyOnly = incoming.ProxyOnly
 
 	// FIX Bug7: освобождаем мьютекс до I/O.
 	routingCopy := cloneRoutingConfig(h.routing)
@@ -727,7 +957,7 @@ func (h *TunHandlers) replaceRoutingAndApply(incoming config.RoutingConfig) (int
 	if err := h.TriggerApply(); err != nil {
 		applyErr = err.Error()
 	}
-	return len(incoming.Rules), applyErr, nil
+	return len(incoming.Rules) + len(moved), applyErr, nil
 }
 
 // handleBulkReplaceRules PUT /api/tun/rules — атомарно заменяет весь список правил.
@@ -755,6 +985,11 @@ func (h *TunHandlers) handleBulkReplaceRules(w http.ResponseWriter, r *http.Requ
 		BlockTelemetry:  h.routing.BlockTelemetry,
 		LANShareEnabled: h.routing.LANShareEnabled,
 		LANSharePort:    h.routing.LANSharePort,
+		LANUsers:        h.routing.LANUsers,
+		LANAllowCIDRs:   h.routing.LANAllowCIDRs,
+		LANPolicy:       h.routing.LANPolicy,
+		IPv6Mode:        h.routing.IPv6Mode,
+		ProxyOnly:       h.routing.ProxyOnly,
 	}
 	h.mu.RUnlock()
 	if req.DefaultAction != "" {
@@ -776,8 +1011,47 @@ func (h *TunHandlers) handleBulkReplaceRules(w http.ResponseWriter, r *http.Requ
 		incoming.LANShareEnabled = *req.LANShareEnabled
 	}
 	if req.LANSharePort != nil {
+		if *req.LANSharePort < 0 || *req.LANSharePort > 65535 {
+			h.server.respondError(w, http.StatusBadRequest, "lan_share_port: 1-65535")
+			return
+		}
 		incoming.LANSharePort = *req.LANSharePort
 	}
+	if req.LANUsers != nil {
+		for _, u := range *req.LANUsers {
+			if !config.ValidLANUsername(strings.TrimSpace(u.Username)) || len(u.Password) > 255 {
+				h.server.respondError(w, http.StatusBadRequest, fmt.Sprintf("lan_users: неверный логин %q (без ':', до 255 байт)", u.Username))
+				return
+			}
+		}
+		incoming.LANUsers = append([]config.LANUser(nil), *req.LANUsers...)
+	}
+	if req.LANAllowCIDRs != nil {
+		for _, v := range *req.LANAllowCIDRs {
+			if _, ok := config.NormalizeLANAllowCIDR(v); !ok {
+				h.server.respondError(w, http.StatusBadRequest, fmt.Sprintf("lan_allow_cidrs: %q не IP и не CIDR", v))
+				return
+			}
+		}
+		incoming.LANAllowCIDRs = append([]string(nil), *req.LANAllowCIDRs...)
+	}
+	if req.LANPolicy != nil {
+		if !config.IsValidLANPolicy(*req.LANPolicy) {
+			h.server.respondError(w, http.StatusBadRequest, "lan_policy: rules | proxy")
+			return
+		}
+		incoming.LANPolicy = *req.LANPolicy
+	}
+	if req.IPv6Mode != nil {
+		if !config.IsValidIPv6Mode(*req.IPv6Mode) {
+			h.server.respondError(w, http.StatusBadRequest, "ipv6_mode: ipv4-only | prefer-ipv4 | dual-stack")
+			return
+		}
+		incoming.IPv6Mode = *req.IPv6Mode
+	}
+	if req.ProxyOnly != nil {
+		incoming.ProxyOnly = *req.ProxyOnly
+	}
 
 	count, applyErr, err := h.replaceRoutingAndApply(incoming)
 	if err != nil {
@@ -858,6 +1132,8 @@ func (h *TunHandlers) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
 func (h *TunHandlers) handleSetDefault(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Action config.RuleAction `json:"action"`
+		// Group — группа серверов для трафика по умолчанию (только action=proxy).
+		Group string `json:"group,omitempty"`
 	}
 	if !h.decodeRequest(w, r, &req, maxTunSmallRequestBytes) {
 		return
@@ -866,13 +1142,27 @@ func (h *TunHandlers) handleSetDefault(w http.ResponseWriter, r *http.Request) {
 		h.server.respondError(w, http.StatusBadRequest, "action: proxy | direct | block")
 		return
 	}
+	req.Group = strings.TrimSpace(req.Group)
+	if req.Group != "" && req.Action != config.ActionProxy {
+		h.server.respondError(w, http.StatusBadRequest, "group допустим только для action=proxy")
+		return
+	}
 
 	h.server.routingOpMu.Lock()
 	defer h.server.routingOpMu.Unlock()
 
 	h.mu.Lock()
+	if req.Group != "" {
+		if _, ok := h.routing.FindGroup(req.Group); !ok {
+			h.mu.Unlock()
+			h.server.respondError(w, http.StatusBadRequest, fmt.Sprintf("группа %q не найдена", req.Group))
+			return
+		}
+	}
 	oldAction := h.routing.DefaultAction
+	oldGroup := h.routing.DefaultGroup
 	h.routing.DefaultAction = req.Action
+	h.routing.DefaultGroup = req.Group
 	// FIX Bug7: освобождаем мьютекс до I/O.
 	routingCopy := cloneRoutingConfig(h.routing)
 	h.mu.Unlock()
@@ -880,6 +1170,7 @@ func (h *TunHandlers) handleSetDefault(w http.ResponseWriter, r *http.Request) {
 	if err := config.SaveRoutingConfig(routingConfigPath, routingCopy); err != nil {
 		h.mu.Lock()
 		h.routing.DefaultAction = oldAction // откат
+		h.routing.DefaultGroup = oldGroup
 		h.mu.Unlock()
 		h.server.logger.Error("Не удалось сохранить routing config: %v", err)
 		h.server.respondError(w, http.StatusInternalServerError, "не удалось сохранить изменения")
@@ -930,6 +1221,7 @@ func (h *TunHandlers) handleApply(w http.ResponseWriter, r *http.Request) {
 		// не применялись до ручного перезапуска.
 		h.markPendingApplyLocked(true, false)
 		h.apply.mu.Unlock()
+		h.publishApplyStatus()
 		h.logQueuedApply(true, false, "handleApply")
 		h.server.respondJSON(w, http.StatusAccepted, map[string]interface{}{
 			"message": "применение поставлено в очередь",
@@ -947,6 +1239,7 @@ func (h *TunHandlers) handleApply(w http.ResponseWriter, r *http.Request) {
 	h.apply.startedAt = time.Now()
 	h.apply.estimatedDone = time.Now().Add(5 * time.Second) // минимальный буфер; готовность через Clash API probe
 	h.apply.mu.Unlock()
+	h.publishApplyStatus()
 
 	h.mu.RLock()
 	snapshot := cloneRoutingConfig(h.routing)
@@ -975,6 +1268,7 @@ func (h *TunHandlers) handleApply(w http.ResponseWriter, r *http.Request) {
 		h.apply.lastErr = err.Error()
 		h.apply.validationError = err.Error()
 		h.apply.mu.Unlock()
+		h.publishApplyStatus()
 		h.server.logger.Error("Не удалось сгенерировать конфиг sing-box: %v", err)
 		h.server.respondError(w, http.StatusBadRequest, "не удалось сгенерировать конфиг: "+err.Error())
 		return
@@ -1036,6 +1330,7 @@ func (h *TunHandlers) TriggerApplyFull() error {
 		// FIX: аналогично TriggerApply — ставим pendingApply вместо ошибки.
 		h.markPendingApplyLocked(true, false)
 		h.apply.mu.Unlock()
+		h.publishApplyStatus()
 		h.logQueuedApply(true, false, "TriggerApplyFull")
 		return nil
 	}
@@ -1048,6 +1343,7 @@ func (h *TunHandlers) TriggerApplyFull() error {
 	h.apply.startedAt = time.Now()
 	h.apply.estimatedDone = time.Now().Add(5 * time.Second)
 	h.apply.mu.Unlock()
+	h.publishApplyStatus()
 
 	h.mu.RLock()
 	snapshot := cloneRoutingConfig(h.routing)
@@ -1060,6 +1356,7 @@ func (h *TunHandlers) TriggerApplyFull() error {
 		h.apply.running = false
 		h.apply.lastErr = err.Error()
 		h.apply.mu.Unlock()
+		h.publishApplyStatus()
 		return fmt.Errorf("GenerateSingBoxConfig: %w", err)
 	}
 
@@ -1092,6 +1389,7 @@ func (h *TunHandlers) doApply(snapshot *config.RoutingConfig, tmpConfigPath stri
 		h.apply.pendingWithFile = false
 		h.apply.running = false
 		h.apply.mu.Unlock()
+		h.publishApplyStatus()
 
 		// FIX: если за время выполнения apply были изменения правил (pendingApply=true),
 		// запускаем повторный apply с актуальным состоянием. Это решает проблему когда
@@ -1141,12 +1439,16 @@ func (h *TunHandlers) doApply(snapshot *config.RoutingConfig, tmpConfigPath stri
 		hotMgr := h.server.config.XRayManager
 		h.server.configMu.RUnlock()
 
-		skipHotReload := diff.ProcessRulesChanged || forceRestart
+		skipHotReload := diff.ProcessRulesChanged || diff.IPv6ModeChanged || diff.ProxyOnlyChanged || forceRestart
 		if forceRestart {
 			h.server.logger.Info("Apply: полный перезапуск sing-box (hot-reload отключён)")
 		} else if diff.ProcessRulesChanged {
 			h.server.logger.Info("Process-правила изменились (старые: %v, новые: %v) — пропускаем hot-reload",
 				hasProcessRules(lastApplied), hasProcessRules(snapshot))
+		} else if diff.IPv6ModeChanged {
+			h.server.logger.Info("IPv6-режим изменился на %s — пропускаем hot-reload", config.NormalizeIPv6Mode(snapshot.IPv6Mode))
+		} else if diff.ProxyOnlyChanged {
+			h.server.logger.Info("Режим без TUN: %v — пропускаем hot-reload", snapshot.ProxyOnly)
 		}
 
 		if tmpConfigPath != "" && hotMgr != nil && hotMgr.IsRunning() && !skipHotReload {
@@ -1189,6 +1491,8 @@ func (h *TunHandlers) doApply(snapshot *config.RoutingConfig, tmpConfigPath stri
 				h.apply.reloadMode = "hotreload" // B-11
 				h.apply.mu.Unlock()
 				h.server.ClearRestarting()
+				h.writePAC(snapshot)
+				h.scheduleIPv6Check(snapshot.IPv6Mode)
 				return
 			} else {
 				h.server.logger.Info("Hot reload недоступен (%v), выполняем полный перезапуск", err)
@@ -1269,7 +1573,11 @@ func (h *TunHandlers) doApply(snapshot *config.RoutingConfig, tmpConfigPath stri
 	// BUG FIX #4: сообщаем UI что идёт перезапуск (wintun cleanup ≈ 30с).
 	// Без этого /api/status возвращает running=false, warming=false — пользователь
 	// не понимает что происходит. ClearRestarting вызывается через defer.
-	readyAt := wintun.EstimateReadyAt()
+	// Без TUN ждать освобождения адаптера не нужно.
+	readyAt := time.Now().Add(5 * time.Second)
+	if !snapshot.ProxyOnly {
+		readyAt = wintun.EstimateReadyAt()
+	}
 	h.server.SetRestarting(readyAt)
 	defer h.server.ClearRestarting()
 
@@ -1280,6 +1588,7 @@ func (h *TunHandlers) doApply(snapshot *config.RoutingConfig, tmpConfigPath stri
 	h.apply.mu.Lock()
 	h.apply.estimatedDone = readyAt
 	h.apply.mu.Unlock()
+	h.publishApplyStatus()
 
 	// BeforeRestart выполняет wintun cleanup (RecordStop + RemoveStaleTunAdapter + PollUntilFree).
 	// Инъектируется через xray.Config.BeforeRestart из main.go —
@@ -1372,6 +1681,7 @@ func (h *TunHandlers) doApply(snapshot *config.RoutingConfig, tmpConfigPath stri
 	h.apply.mu.Lock()
 	h.apply.lastPID = newManager.GetPID()
 	h.apply.mu.Unlock()
+	h.publishApplyStatus()
 
 	// Вместо фиксированного ожидания — опрашиваем Clash API каждые 200ms.
 	// BUG FIX: добавляем быстрый выход если sing-box умер во время ожидания.
@@ -1437,10 +1747,13 @@ func (h *TunHandlers) doApply(snapshot *config.RoutingConfig, tmpConfigPath stri
 		}
 	}
 	skipProxyRestore = true
+	h.writePAC(snapshot)
+	h.scheduleIPv6Check(snapshot.IPv6Mode)
 }
 
-// handleApplyStatus GET /api/tun/apply/status — состояние последнего применения
-func (h *TunHandlers) handleApplyStatus(w http.ResponseWriter, r *http.Request) {
+// applyStatus возвращает состояние последнего применения — тело
+// GET /api/tun/apply/status и событий "apply" в /api/stream.
+func (h *TunHandlers) applyStatus() map[string]interface{} {
 	// BUG FIX: startedAt и estimatedDone читаются под мьютексом — они записываются
 	// в handleApply под тем же мьютексом; чтение вне мьютекса было data race.
 	h.apply.mu.Lock()
@@ -1468,7 +1781,7 @@ func (h *TunHandlers) handleApplyStatus(w http.ResponseWriter, r *http.Request)
 		}
 		estimatedRemainMs = remaining
 	}
-	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{
+	return map[string]interface{}{
 		"running":             running,
 		"pending_apply":       pendingApply, // FIX: клиент видит что есть отложенный apply
 		"pending_full":        pendingFull,
@@ -1480,7 +1793,19 @@ func (h *TunHandlers) handleApplyStatus(w http.ResponseWriter, r *http.Request)
 		"estimated_remain_ms": estimatedRemainMs,
 		"estimated_total_ms":  5000,
 		"reload_mode":         reloadMode, // B-11: "hotreload" | "restart" | ""
-	})
+	}
+}
+
+// publishApplyStatus отправляет текущее состояние apply в /api/stream.
+// Вызывается после каждого перехода (очередь, старт, ETA, PID, завершение) —
+// короткие состояния, которые опрос раз в секунду пропускал, видны клиенту.
+func (h *TunHandlers) publishApplyStatus() {
+	h.server.stream.publish(streamTypeApply, h.applyStatus())
+}
+
+// handleApplyStatus GET /api/tun/apply/status — состояние последнего применения
+func (h *TunHandlers) handleApplyStatus(w http.ResponseWriter, r *http.Request) {
+	h.server.respondJSON(w, http.StatusOK, h.applyStatus())
 }
 
 // handleExport GET /api/tun/export — скачивает routing.json как файл
@@ -1497,6 +1822,13 @@ func (h *TunHandlers) handleExport(w http.ResponseWriter, r *http.Request) {
 		BlockTelemetry:  h.routing.BlockTelemetry,
 		LANShareEnabled: h.routing.LANShareEnabled,
 		LANSharePort:    h.routing.LANSharePort,
+		LANUsers:        h.routing.LANUsers,
+		LANAllowCIDRs:   h.routing.LANAllowCIDRs,
+		LANPolicy:       h.routing.LANPolicy,
+		Groups:          h.routing.Groups,
+		DefaultGroup:    h.routing.DefaultGroup,
+		IPv6Mode:        h.routing.IPv6Mode,
+		ProxyOnly:       h.routing.ProxyOnly,
 	}, "", "  ")
 	if err != nil {
 		h.server.respondError(w, http.StatusInternalServerError, "marshal error")
@@ -1569,6 +1901,12 @@ func (h *TunHandlers) handleImport(w http.ResponseWriter, r *http.Request) {
 		h.server.respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	moved, err := h.moveProcessRules(incoming.Rules)
+	if err != nil {
+		h.server.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	incoming.Rules = slices.DeleteFunc(incoming.Rules, func(r config.RoutingRule) bool { return config.IsProcessRuleType(r.Type) })
 	config.SanitizeRoutingConfig(&incoming)
 
 	// ВЫС-5: валидируем что импортированный конфиг генерирует корректный sing-box конфиг.
@@ -1601,7 +1939,7 @@ func (h *TunHandlers) handleImport(w http.ResponseWriter, r *http.Request) {
 
 	h.server.respondJSON(w, http.StatusOK, MessageResponse{
 		Success: true,
-		Message: fmt.Sprintf("imported %d rules", len(incoming.Rules)),
+		Message: fmt.Sprintf("imported %d rules", len(incoming.Rules)+len(moved)),
 	})
 
 	// FIX 22: применяем импортированные правила — без TriggerApply sing-box работает
@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 )
@@ -137,3 +138,32 @@ func TestTunHandlersRejectTrailingData(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleAddRuleServerTarget(t *testing.T) {
+	_, h, cleanup := buildTunServer(t)
+	defer cleanup()
+
+	if err := os.WriteFile(serversFile, []byte(`[{"id":"us-1","name":"US","url":"vless://u@us.example:443"}]`), 0644); err != nil {
+		t.Fatalf("WriteFile servers.json: %v", err)
+	}
+
+	cases := []struct {
+		body string
+		want int
+	}{
+		{`{"value":"netflix.com","action":"proxy","server":"us-1"}`, http.StatusCreated},
+		{`{"value":"hulu.com","action":"proxy","server":"missing"}`, http.StatusBadRequest},
+		{`{"value":"local.example","action":"direct","server":"us-1"}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/tun/rules", strings.NewReader(tc.body))
+		w := httptest.NewRecorder()
+		h.handleAddRule(w, req)
+		if w.Code != tc.want {
+			t.Fatalf("body %s: status=%d resp=%s, want %d", tc.body, w.Code, w.Body.String(), tc.want)
+		}
+	}
+	if len(h.routing.Rules) != 1 || h.routing.Rules[0].Server != "us-1" {
+		t.Fatalf("rules = %+v, want single netflix.com rule on us-1", h.routing.Rules)
+	}
+}
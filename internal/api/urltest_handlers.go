@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/latency"
+	"proxyclient/internal/urltest"
+)
+
+const maxURLTestRequestBytes = 16 << 10
+
+// urlTestRunner возвращает общий Runner URL-тестов. nil — sing-box недоступен
+// (TUN-обработчики не инициализированы или путь к exe не задан).
+func (h *ServersHandlers) urlTestRunner() *urltest.Runner {
+	h.urlTestOnce.Do(func() {
+		if h.urlTest != nil || h.server.tunHandlers == nil {
+			return
+		}
+		if exe := h.server.tunHandlers.xrayConfig.ExecutablePath; exe != "" {
+			h.urlTest = &urltest.Runner{ExecPath: exe}
+		}
+	})
+	return h.urlTest
+}
+
+// runURLTest измеряет сервер id URL-тестом через отдельный экземпляр sing-box.
+// list нужен для detour-цепочки: сервер тестируется вместе со своими relay.
+func runURLTest(ctx context.Context, runner *urltest.Runner, list []ServerEntry, id string) urltest.Result {
+	outbounds, err := config.ServerChainOutbounds(savedServersFromEntries(list), id)
+	if err != nil {
+		return urltest.Result{ID: id, Error: err.Error()}
+	}
+	return runner.Test(ctx, urltest.Target{ID: id, Outbounds: outbounds})
+}
+
+// urlTestServer — runURLTest с записью результата в историю и монитор здоровья.
+// Непротестированный сервер (Skipped) не записывается: это не отказ.
+func (h *ServersHandlers) urlTestServer(ctx context.Context, runner *urltest.Runner, list []ServerEntry, srv ServerEntry) urltest.Result {
+	res := runURLTest(ctx, runner, list, srv.ID)
+	if !res.Skipped {
+		h.recordURLTest(res)
+	}
+	return res
+}
+
+// recordURLTest сохраняет результат в историю задержек и монитор здоровья.
+func (h *ServersHandlers) recordURLTest(res urltest.Result) {
+	recordURLTestLatency(res)
+	if h.health != nil {
+		h.health.Record(res.ID, time.Duration(res.LatencyMs)*time.Millisecond, res.OK)
+	}
+}
+
+func recordURLTestLatency(res urltest.Result) {
+	if res.OK {
+		latency.Global.Record(res.ID, res.LatencyMs)
+	} else {
+		latency.Global.Record(res.ID, -1)
+	}
+}
+
+// probeMethod — текущий способ замера для failover и автоподключения.
+func probeMethod() string {
+	settings, _ := config.LoadAppSettings(config.AppSettingsFile)
+	return settings.SmartFailover.ProbeMethod
+}
+
+// probeServer измеряет задержку сервера для решений failover/автоподключения:
+// URL-тестом, если он выбран в настройках и sing-box доступен, иначе TCP-пробой.
+// Результат записывается в монитор здоровья.
+func (h *ServersHandlers) probeServer(ctx context.Context, method string, list []ServerEntry, srv ServerEntry) (int64, bool) {
+	if method == config.ProbeMethodURL {
+		if runner := h.urlTestRunner(); runner != nil {
+			res := h.urlTestServer(ctx, runner, list, srv)
+			return res.LatencyMs, res.OK
+		}
+	}
+	ms, _, _, ok := pingServerWithProbes(ctx, srv.URL, 1)
+	if h.health != nil {
+		h.health.Record(srv.ID, time.Duration(ms)*time.Millisecond, ok)
+	}
+	return ms, ok
+}
+
+// POST /api/servers/url-test — URL-тест серверов через отдельные экземпляры sing-box.
+// Тело {"ids": [...]} необязательно: без него тестируются все серверы.
+func (h *ServersHandlers) handleURLTest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if r.ContentLength != 0 {
+		if !decodeStrictJSON(w, r, &req, maxURLTestRequestBytes) {
+			return
+		}
+	}
+	runner := h.urlTestRunner()
+	if runner == nil {
+		h.server.respondError(w, http.StatusServiceUnavailable, "sing-box недоступен для URL-теста")
+		return
+	}
+
+	h.mu.RLock()
+	list, err := loadServers()
+	h.mu.RUnlock()
+	if err != nil {
+		h.server.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	list = visibleServers(list)
+	targets := list
+	if len(req.IDs) > 0 {
+		byID := make(map[string]ServerEntry, len(list))
+		for _, srv := range list {
+			byID[srv.ID] = srv
+		}
+		targets = make([]ServerEntry, 0, len(req.IDs))
+		for _, id := range req.IDs {
+			srv, ok := byID[id]
+			if !ok {
+				h.server.respondError(w, http.StatusNotFound, fmt.Sprintf("сервер %q не найден", id))
+				return
+			}
+			targets = append(targets, srv)
+		}
+	}
+
+	// Общего срока нет: каждый сервер ограничен своим таймаутом в Runner,
+	// поэтому длинный список не превращает хвост очереди в отказы. Отмена
+	// запроса оставляет ждущие серверы непротестированными (skipped).
+	ctx := r.Context()
+	results := make([]urltest.Result, len(targets))
+	var wg sync.WaitGroup
+	for i, srv := range targets {
+		wg.Add(1)
+		go func(i int, srv ServerEntry) {
+			defer wg.Done()
+			results[i] = h.urlTestServer(ctx, runner, list, srv)
+		}(i, srv)
+	}
+	wg.Wait()
+	h.server.respondJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
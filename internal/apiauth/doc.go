@@ -0,0 +1,4 @@
+// Package apiauth stores bearer tokens for the local REST API: the token of the
+// embedded UI and revocable per-client tokens with scopes. Secrets are kept on
+// disk encrypted with Windows DPAPI.
+package apiauth
@@ -0,0 +1,331 @@
+package apiauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/dpapi"
+	"proxyclient/internal/fileutil"
+)
+
+// DefaultFile — файл токенов рядом с остальными данными приложения.
+const DefaultFile = config.DataDir + "/api_auth.json"
+
+const (
+	// secretMagic — тот же формат, что у secret.key: "DPAPI:" + base64.
+	secretMagic = "DPAPI:"
+	tokenPrefix = "sst_"
+	uiTokenName = "SafeSky UI"
+)
+
+var (
+	ErrNotFound     = errors.New("token not found")
+	ErrUIToken      = errors.New("the UI token cannot be revoked")
+	ErrInvalidScope = errors.New("invalid token scope")
+)
+
+// Scope — уровень доступа токена. Уровни вложены: admin ⊃ mutate ⊃ read.
+type Scope string
+
+const (
+	// ScopeRead — только GET/HEAD, кроме ответов с ключами серверов.
+	ScopeRead Scope = "read"
+	// ScopeMutate — любые запросы, кроме управления токенами, backup и
+	// ответов с ключами серверов.
+	ScopeMutate Scope = "mutate"
+	// ScopeAdmin — полный доступ; такой токен у встроенного UI.
+	ScopeAdmin Scope = "admin"
+)
+
+func (s Scope) rank() int {
+	switch s {
+	case ScopeRead:
+		return 1
+	case ScopeMutate:
+		return 2
+	case ScopeAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// IsValidScope сообщает, известен ли scope.
+func IsValidScope(s Scope) bool { return s.rank() > 0 }
+
+// Allows сообщает, достаточно ли scope s для запроса, требующего required.
+func (s Scope) Allows(required Scope) bool {
+	return s.rank() > 0 && s.rank() >= required.rank()
+}
+
+// Token — публичные сведения о токене; сам секрет наружу не отдаётся.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scope     Scope     `json:"scope"`
+	UI        bool      `json:"ui,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type storedToken struct {
+	Token
+	Secret string `json:"secret"`
+}
+
+type fileData struct {
+	Enabled bool          `json:"enabled"`
+	Tokens  []storedToken `json:"tokens"`
+}
+
+type entry struct {
+	token  Token
+	secret string // открытый текст, только в памяти
+	stored string // зашифрованная форма для записи на диск
+}
+
+// Store — потокобезопасное хранилище токенов API.
+type Store struct {
+	path    string
+	mu      sync.RWMutex
+	enabled bool
+	entries []entry
+}
+
+// Open загружает хранилище из path и при необходимости создаёт токен UI.
+// Отсутствующий файл — пустое хранилище с выключенной проверкой. Токены, которые
+// не удалось расшифровать (файл скопирован из другой учётной записи Windows),
+// отбрасываются: DPAPI привязан к пользователю, восстановить их нельзя.
+func Open(path string) (*Store, error) {
+	if path == "" {
+		path = DefaultFile
+	}
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read api tokens: %w", err)
+	}
+	dirty := false
+	if err == nil {
+		var fd fileData
+		if err := json.Unmarshal(data, &fd); err != nil {
+			return nil, fmt.Errorf("parse api tokens: %w", err)
+		}
+		s.enabled = fd.Enabled
+		for _, st := range fd.Tokens {
+			secret, err := decryptSecret(st.Secret)
+			if err != nil || st.ID == "" || !IsValidScope(st.Scope) {
+				dirty = true
+				continue
+			}
+			s.entries = append(s.entries, entry{token: st.Token, secret: secret, stored: st.Secret})
+		}
+	}
+	if _, ok := s.uiEntry(); !ok {
+		e, err := newEntry(uiTokenName, ScopeAdmin)
+		if err != nil {
+			return nil, err
+		}
+		e.token.UI = true
+		s.entries = append([]entry{e}, s.entries...)
+		dirty = true
+	}
+	if dirty {
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Enabled сообщает, требует ли API токен.
+func (s *Store) Enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enabled
+}
+
+// SetEnabled включает или выключает проверку токенов и сохраняет выбор.
+func (s *Store) SetEnabled(enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.enabled
+	s.enabled = enabled
+	if err := s.save(); err != nil {
+		s.enabled = old
+		return err
+	}
+	return nil
+}
+
+// UIToken возвращает секрет токена встроенного UI.
+func (s *Store) UIToken() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, _ := s.uiEntry()
+	return e.secret
+}
+
+// List возвращает токены в порядке создания; токен UI — первым.
+func (s *Store) List() []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Token, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, e.token)
+	}
+	return out
+}
+
+// Create выпускает новый токен. Секрет возвращается только здесь — на диске
+// он хранится зашифрованным и через List не отдаётся.
+func (s *Store) Create(name string, scope Scope) (Token, string, error) {
+	if !IsValidScope(scope) {
+		return Token{}, "", ErrInvalidScope
+	}
+	e, err := newEntry(strings.TrimSpace(name), scope)
+	if err != nil {
+		return Token{}, "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.entries
+	s.entries = append(append([]entry(nil), old...), e)
+	if err := s.save(); err != nil {
+		s.entries = old
+		return Token{}, "", err
+	}
+	return e.token, e.secret, nil
+}
+
+// Revoke удаляет токен. Токен UI отозвать нельзя — иначе окно приложения
+// потеряет доступ к собственному API.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := -1
+	for i, e := range s.entries {
+		if e.token.ID == id {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return ErrNotFound
+	}
+	if s.entries[idx].token.UI {
+		return ErrUIToken
+	}
+	old := s.entries
+	s.entries = append(append([]entry(nil), old[:idx]...), old[idx+1:]...)
+	if err := s.save(); err != nil {
+		s.entries = old
+		return err
+	}
+	return nil
+}
+
+// Authenticate ищет токен по секрету. Сравнение — за постоянное время.
+func (s *Store) Authenticate(secret string) (Token, bool) {
+	if secret == "" {
+		return Token{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.entries {
+		if subtle.ConstantTimeCompare([]byte(e.secret), []byte(secret)) == 1 {
+			return e.token, true
+		}
+	}
+	return Token{}, false
+}
+
+func (s *Store) uiEntry() (entry, bool) {
+	for _, e := range s.entries {
+		if e.token.UI {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// save пишет файл атомарно с правами 0600. Вызывается под s.mu.
+func (s *Store) save() error {
+	fd := fileData{Enabled: s.enabled, Tokens: make([]storedToken, 0, len(s.entries))}
+	for _, e := range s.entries {
+		fd.Tokens = append(fd.Tokens, storedToken{Token: e.token, Secret: e.stored})
+	}
+	data, err := json.MarshalIndent(fd, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal api tokens: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("create api tokens dir: %w", err)
+	}
+	if err := fileutil.WriteAtomic(s.path, data, 0600); err != nil {
+		return fmt.Errorf("write api tokens: %w", err)
+	}
+	return nil
+}
+
+func newEntry(name string, scope Scope) (entry, error) {
+	id, err := randomHex(6)
+	if err != nil {
+		return entry{}, err
+	}
+	raw, err := randomHex(32)
+	if err != nil {
+		return entry{}, err
+	}
+	secret := tokenPrefix + raw
+	stored, err := encryptSecret(secret)
+	if err != nil {
+		return entry{}, err
+	}
+	return entry{
+		token:  Token{ID: id, Name: name, Scope: scope, CreatedAt: time.Now().UTC()},
+		secret: secret,
+		stored: stored,
+	}, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func encryptSecret(secret string) (string, error) {
+	enc, err := dpapi.Encrypt([]byte(secret))
+	if err != nil {
+		return "", fmt.Errorf("encrypt api token: %w", err)
+	}
+	return secretMagic + base64.StdEncoding.EncodeToString(enc), nil
+}
+
+func decryptSecret(stored string) (string, error) {
+	if !strings.HasPrefix(stored, secretMagic) {
+		return "", fmt.Errorf("api token is not DPAPI-encrypted")
+	}
+	enc, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, secretMagic))
+	if err != nil {
+		return "", fmt.Errorf("decode api token: %w", err)
+	}
+	plain, err := dpapi.Decrypt(enc)
+	if err != nil {
+		return "", fmt.Errorf("decrypt api token: %w", err)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,130 @@
+package apiauth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenCreatesUIToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_auth.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if s.Enabled() {
+		t.Error("auth must be disabled by default")
+	}
+	ui := s.UIToken()
+	if !strings.HasPrefix(ui, tokenPrefix) {
+		t.Fatalf("UIToken = %q", ui)
+	}
+	tok, ok := s.Authenticate(ui)
+	if !ok || !tok.UI || tok.Scope != ScopeAdmin {
+		t.Fatalf("Authenticate(ui) = %+v, %v", tok, ok)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if strings.Contains(string(data), ui) {
+		t.Error("token secret must not be stored in plain text")
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open again: %v", err)
+	}
+	if reopened.UIToken() != ui {
+		t.Error("UI token must survive restart")
+	}
+}
+
+func TestCreateRevokeAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_auth.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	tok, secret, err := s.Create("backup script", ScopeRead)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if got, ok := s.Authenticate(secret); !ok || got.ID != tok.ID || got.Scope != ScopeRead {
+		t.Fatalf("Authenticate = %+v, %v", got, ok)
+	}
+	if _, ok := s.Authenticate(secret + "x"); ok {
+		t.Error("wrong secret must not authenticate")
+	}
+	if _, _, err := s.Create("bad", Scope("root")); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Create invalid scope err = %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open again: %v", err)
+	}
+	if _, ok := reopened.Authenticate(secret); !ok {
+		t.Error("created token must survive restart")
+	}
+
+	if err := s.Revoke(tok.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, ok := s.Authenticate(secret); ok {
+		t.Error("revoked token must not authenticate")
+	}
+	if err := s.Revoke(tok.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Revoke twice err = %v", err)
+	}
+	ui, _ := s.Authenticate(s.UIToken())
+	if err := s.Revoke(ui.ID); !errors.Is(err, ErrUIToken) {
+		t.Errorf("Revoke UI token err = %v", err)
+	}
+}
+
+func TestOpenDropsUndecryptableTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_auth.json")
+	if err := os.WriteFile(path, []byte(`{"enabled":true,"tokens":[
+		{"id":"a1","name":"old","scope":"read","secret":"plain-text"}
+	]}`), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !s.Enabled() {
+		t.Error("enabled flag must be preserved")
+	}
+	for _, tok := range s.List() {
+		if tok.ID == "a1" {
+			t.Error("token without DPAPI envelope must be dropped")
+		}
+	}
+	if s.UIToken() == "" {
+		t.Error("UI token must be recreated")
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	cases := []struct {
+		have, need Scope
+		want       bool
+	}{
+		{ScopeRead, ScopeRead, true},
+		{ScopeRead, ScopeMutate, false},
+		{ScopeMutate, ScopeRead, true},
+		{ScopeMutate, ScopeAdmin, false},
+		{ScopeAdmin, ScopeAdmin, true},
+		{Scope(""), ScopeRead, false},
+	}
+	for _, c := range cases {
+		if got := c.have.Allows(c.need); got != c.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", c.have, c.need, got, c.want)
+		}
+	}
+}
@@ -46,11 +46,37 @@ func (e *engine) rebuildSorted() {
 		}
 	}
 	sort.Slice(s, func(i, j int) bool {
-		return s[i].Priority > s[j].Priority
+		return rulePrecedes(s[i], s[j])
 	})
 	e.sorted = s
 }
 
+// actionRank — порядок правил с равным приоритетом: BLOCK, DIRECT, PROXY.
+// Так же их упорядочивал route sing-box до переноса process-правил сюда.
+var actionRank = map[Action]int{ActionBlock: 0, ActionDirect: 1, ActionProxy: 2}
+
+// rulePrecedes — a проверяется раньше b: выше приоритет, при равном —
+// по действию, затем по паттерну и ID, чтобы порядок не зависел от map.
+func rulePrecedes(a, b *Rule) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if actionRank[a.Action] != actionRank[b.Action] {
+		return actionRank[a.Action] < actionRank[b.Action]
+	}
+	if a.Pattern != b.Pattern {
+		return a.Pattern < b.Pattern
+	}
+	return a.ID < b.ID
+}
+
+// SortRules упорядочивает правила так же, как Match их проверяет.
+func SortRules(rules []Rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rulePrecedes(&rules[i], &rules[j])
+	})
+}
+
 // NewEngine создаёт новый engine
 func NewEngine() Engine {
 	return &engine{
@@ -80,6 +106,9 @@ func (e *engine) AddRule(rule Rule) (*Rule, error) {
 	if err := validateNewRule(rule); err != nil {
 		return nil, fmt.Errorf("invalid rule: %w", err)
 	}
+	if err := e.checkInboundPort(rule, ""); err != nil {
+		return nil, fmt.Errorf("invalid rule: %w", err)
+	}
 
 	now := time.Now()
 	id, err := newID()
@@ -145,6 +174,9 @@ func (e *engine) UpdateRule(id string, rule Rule) (*Rule, error) {
 	if err := validateRule(rule); err != nil {
 		return nil, fmt.Errorf("invalid rule: %w", err)
 	}
+	if err := e.checkInboundPort(rule, id); err != nil {
+		return nil, fmt.Errorf("invalid rule: %w", err)
+	}
 
 	rule.ID = id
 	rule.CreatedAt = existing.CreatedAt
@@ -245,7 +277,7 @@ func (e *engine) Match(processName string) RuleMatch {
 	defer e.mu.RUnlock()
 
 	for _, rule := range e.sorted {
-		if e.matcher.Match(rule.Pattern, processName) {
+		if e.matches(rule, processName) {
 			ruleCopy := *rule
 			return RuleMatch{Matched: true, Rule: &ruleCopy}
 		}
@@ -254,6 +286,14 @@ func (e *engine) Match(processName string) RuleMatch {
 	return RuleMatch{Matched: false}
 }
 
+// matches проверяет процесс против правила с учётом Exact.
+func (e *engine) matches(rule *Rule, processName string) bool {
+	if rule.Exact {
+		return MatchExact(rule.Pattern, processName)
+	}
+	return e.matcher.Match(rule.Pattern, processName)
+}
+
 // validateRule проверяет правило на корректность
 func validateRule(rule Rule) error {
 	if rule.Pattern == "" {
@@ -262,6 +302,32 @@ func validateRule(rule Rule) error {
 	if !rule.Action.IsValid() {
 		return fmt.Errorf("invalid action: %s", rule.Action)
 	}
+	if rule.InboundPort < 0 || rule.InboundPort > 65535 {
+		return fmt.Errorf("invalid inbound port: %d", rule.InboundPort)
+	}
+	if rule.InboundPort > 0 && rule.Action != ActionProxy {
+		return fmt.Errorf("inbound port requires %s action", ActionProxy)
+	}
+	if rule.Server != "" && rule.Group != "" {
+		return fmt.Errorf("server and group are mutually exclusive")
+	}
+	if (rule.Server != "" || rule.Group != "") && rule.Action != ActionProxy {
+		return fmt.Errorf("server and group require %s action", ActionProxy)
+	}
+	return nil
+}
+
+// checkInboundPort проверяет, что выделенный порт не занят другим правилом.
+// ВАЖНО: должен вызываться под e.mu.Lock().
+func (e *engine) checkInboundPort(rule Rule, id string) error {
+	if rule.InboundPort == 0 {
+		return nil
+	}
+	for _, other := range e.rules {
+		if other.ID != id && other.InboundPort == rule.InboundPort {
+			return fmt.Errorf("inbound port %d is already used by rule %q", rule.InboundPort, other.Name)
+		}
+	}
 	return nil
 }
 
@@ -244,3 +244,40 @@ func TestEngine_GetRule_ReturnsCopy(t *testing.T) {
 		t.Error("GetRule должен возвращать копию — мутация не должна влиять на engine")
 	}
 }
+
+// ── InboundPort: выделенный порт правила PROXY ───────────────────────────
+
+func TestEngine_InboundPort_Validation(t *testing.T) {
+	e := NewEngine()
+	rule := newTestRule("app.exe", ActionProxy, 10)
+	rule.InboundPort = 10820
+	rule.Group = "auto"
+	first, err := e.AddRule(rule)
+	if err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	if !first.HasDedicatedInbound() || first.LaunchProxyAddr() != "127.0.0.1:10820" || first.InboundTag() != "app-"+first.ID {
+		t.Errorf("rule = %+v, addr %q", first, first.LaunchProxyAddr())
+	}
+
+	bad := []Rule{
+		{Pattern: "a.exe", Action: ActionDirect, InboundPort: 10821},
+		{Pattern: "a.exe", Action: ActionProxy, InboundPort: 70000},
+		{Pattern: "a.exe", Action: ActionProxy, InboundPort: 10821, Server: "s", Group: "g"},
+		{Pattern: "a.exe", Action: ActionDirect, Server: "s"},
+		{Pattern: "a.exe", Action: ActionProxy, InboundPort: 10820},
+	}
+	for _, r := range bad {
+		if _, err := e.AddRule(r); err == nil {
+			t.Errorf("AddRule(%+v) accepted an invalid rule", r)
+		}
+	}
+	// Сервер без порта — цель process-правила в TUN.
+	if _, err := e.AddRule(Rule{Pattern: "b.exe", Action: ActionProxy, Server: "s"}); err != nil {
+		t.Errorf("AddRule with server and no port: %v", err)
+	}
+	// Правило может сохранить свой же порт при обновлении.
+	if _, err := e.UpdateRule(first.ID, *first); err != nil {
+		t.Errorf("UpdateRule with own port: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package apprules
 
 import (
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -151,6 +152,17 @@ func (m *matcher) Match(pattern string, value string) bool {
 	return false
 }
 
+// MatchExact — Match для правил с Exact: паттерн с разделителем сравнивается
+// с полным путём, без разделителя — с именем файла, и часть имени не подходит.
+func MatchExact(pattern, value string) bool {
+	normPattern := NormalizePattern(pattern)
+	normValue := toSlash(strings.ToLower(value))
+	if strings.Contains(normPattern, "/") {
+		return matchWildcard(normPattern, normValue)
+	}
+	return matchWildcard(normPattern, filepath.Base(normValue))
+}
+
 // MatchAny проверяет соответствие хотя бы одному паттерну
 func MatchAny(matcher Matcher, patterns []string, value string) bool {
 	for _, pattern := range patterns {
@@ -160,3 +172,59 @@ func MatchAny(matcher Matcher, patterns []string, value string) bool {
 	}
 	return false
 }
+
+// pathSepClass — оба разделителя пути: sing-box отдаёт путь Windows с '\',
+// паттерны хранятся с '/'.
+const pathSepClass = `[\\/]`
+
+// PatternRegex переводит паттерн правила в process_path_regex для sing-box.
+// sing-box сравнивает имя и путь процесса с учётом регистра, а паттерны
+// хранятся в нижнем регистре — поэтому всегда регулярное выражение с (?i).
+// Паттерн с разделителем сравнивается с полным путём целиком (в отличие от
+// Match, одноимённый файл в другой папке не подходит); без разделителя — с
+// именем файла, и имя без wildcard может быть его частью, как в Match.
+func PatternRegex(pattern string) string {
+	p := toSlash(pattern)
+	var b strings.Builder
+	b.WriteString("(?i)")
+	switch {
+	case strings.Contains(p, "/"):
+		b.WriteString("^")
+		writeGlob(&b, p, ".*", ".")
+	case strings.ContainsAny(p, "*?["):
+		b.WriteString("(^|" + pathSepClass + ")")
+		writeGlob(&b, p, `[^\\/]*`, `[^\\/]`)
+	default:
+		b.WriteString(regexp.QuoteMeta(p))
+		b.WriteString(`[^\\/]*`)
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// ExactPatternRegex — PatternRegex для правил с Exact: имя без wildcard
+// должно совпасть с именем файла целиком.
+func ExactPatternRegex(pattern string) string {
+	p := toSlash(pattern)
+	if strings.ContainsAny(p, "/*?[") {
+		return PatternRegex(p)
+	}
+	return "(?i)(^|" + pathSepClass + ")" + regexp.QuoteMeta(p) + "$"
+}
+
+// writeGlob пишет wildcard-паттерн как регулярное выражение: '*' и '?'
+// заменяются на star и one, '/' — на любой разделитель.
+func writeGlob(b *strings.Builder, pattern, star, one string) {
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(star)
+		case '?':
+			b.WriteString(one)
+		case '/':
+			b.WriteString(pathSepClass)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+}
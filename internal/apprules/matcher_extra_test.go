@@ -1,6 +1,7 @@
 package apprules
 
 import (
+	"regexp"
 	"testing"
 )
 
@@ -342,3 +343,78 @@ func TestValidateRule_ValidRules(t *testing.T) {
 		}
 	}
 }
+
+// ─── PatternRegex ──────────────────────────────────────────────────────────
+
+// TestPatternRegex_AgreesWithMatch — регулярное выражение для sing-box
+// совпадает с теми же путями процессов, что и Match.
+func TestPatternRegex_AgreesWithMatch(t *testing.T) {
+	m := NewMatcher()
+	cases := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"telegram.exe", `C:\Users\me\AppData\Roaming\Telegram Desktop\Telegram.exe`, true},
+		{"chrome", `C:\Program Files\Google\Chrome\Application\chrome.exe`, true},
+		{"chrome.exe", `C:\Apps\chrome.exe.bak\other.exe`, false},
+		{"chrome*", `C:\Apps\chromedriver.exe`, true},
+		{"chrome*", `C:\chrome\app.exe`, false},
+		{"app?.exe", `D:\bin\app1.exe`, true},
+		{"app?.exe", `D:\bin\app12.exe`, false},
+		{"c:/program files/app.exe", `C:\Program Files\App.exe`, true},
+		{"c:/program files/*/game.exe", `C:\Program Files\Steam\game.exe`, true},
+		{"a+b.exe", `C:\aab.exe`, false},
+	}
+	for _, tc := range cases {
+		re := regexp.MustCompile(PatternRegex(NormalizePattern(tc.pattern)))
+		if got := re.MatchString(tc.path); got != tc.want {
+			t.Errorf("PatternRegex(%q) = %s on %q: %v, want %v", tc.pattern, re, tc.path, got, tc.want)
+		}
+		if got := m.Match(NormalizePattern(tc.pattern), tc.path); got != tc.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
+
+// TestExactPatternRegex_AgreesWithMatchExact — точное имя не совпадает с
+// более длинным именем файла ни в regex для sing-box, ни в MatchExact.
+func TestExactPatternRegex_AgreesWithMatchExact(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"ssh.exe", `C:\Windows\System32\OpenSSH\SSH.exe`, true},
+		{"ssh.exe", `ssh.exe`, true},
+		{"ssh.exe", `C:\Tools\myssh.exe`, false},
+		{"ssh.exe", `C:\Tools\ssh.exe.bak`, false},
+		{"chrome*", `C:\Apps\chromedriver.exe`, true},
+		{"c:/tools/ssh.exe", `C:\Tools\ssh.exe`, true},
+		{"c:/tools/ssh.exe", `D:\Tools\ssh.exe`, false},
+	}
+	for _, tc := range cases {
+		re := regexp.MustCompile(ExactPatternRegex(NormalizePattern(tc.pattern)))
+		if got := re.MatchString(tc.path); got != tc.want {
+			t.Errorf("ExactPatternRegex(%q) = %s on %q: %v, want %v", tc.pattern, re, tc.path, got, tc.want)
+		}
+		if got := MatchExact(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("MatchExact(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+
+	e := NewEngine()
+	if _, err := e.AddRule(Rule{Pattern: "ssh.exe", Action: ActionProxy, Enabled: true, Exact: true}); err != nil {
+		t.Fatal(err)
+	}
+	if e.Match(`C:\Tools\myssh.exe`).Matched || !e.Match(`C:\Tools\ssh.exe`).Matched {
+		t.Error("engine ignores Exact")
+	}
+}
+
+// Полный путь в PatternRegex не совпадает с одноимённым файлом в другом месте,
+// хотя Match сравнивает и имена файлов.
+func TestPatternRegex_FullPathIsExact(t *testing.T) {
+	re := regexp.MustCompile(PatternRegex("c:/program files/*/game.exe"))
+	if re.MatchString(`D:\Program Files\Steam\game.exe`) || re.MatchString(`game.exe`) {
+		t.Errorf("%s matched a path outside c:/program files", re)
+	}
+}
@@ -1,6 +1,9 @@
 package apprules
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Action тип действия для правила
 type Action string
@@ -32,6 +35,41 @@ type Rule struct {
 	Enabled   bool      `json:"enabled"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// InboundPort — выделенный локальный порт правила PROXY: sing-box поднимает
+	// на нём отдельный HTTP inbound, launcher передаёт его приложению.
+	// 0 — общий http-in.
+	InboundPort int `json:"inbound_port,omitempty"`
+	// Server / Group — сохранённый сервер или группа для трафика выделенного
+	// порта. Пусто — маршрут по умолчанию.
+	Server string `json:"server,omitempty"`
+	Group  string `json:"group,omitempty"`
+	// Exact — имя без wildcard совпадает только с именем файла целиком, а не
+	// с его частью (так работали process-правила routing.json).
+	Exact bool `json:"exact,omitempty"`
+}
+
+// InboundTagPrefix — префикс тегов выделенных inbound'ов в конфиге sing-box.
+const InboundTagPrefix = "app-"
+
+// HasDedicatedInbound — правило PROXY со своим локальным портом.
+func (r Rule) HasDedicatedInbound() bool {
+	return r.Action == ActionProxy && r.InboundPort > 0
+}
+
+// InboundTag — тег выделенного inbound'а правила; по нему соединения
+// приложения видны в Clash API.
+func (r Rule) InboundTag() string {
+	return InboundTagPrefix + r.ID
+}
+
+// LaunchProxyAddr — адрес прокси для запускаемого приложения: выделенный
+// порт, если он есть, иначе ProxyAddr.
+func (r Rule) LaunchProxyAddr() string {
+	if r.HasDedicatedInbound() {
+		return fmt.Sprintf("127.0.0.1:%d", r.InboundPort)
+	}
+	return r.ProxyAddr
 }
 
 // ProcessInfo информация о процессе
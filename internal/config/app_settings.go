@@ -29,6 +29,10 @@ type AppSettings struct {
 	Telemetry            TelemetrySettings         `json:"telemetry"`
 	LeakTest             LeakTestSettings          `json:"leak_test"`
 	Hotkeys              HotkeySettings            `json:"hotkeys"`
+	History              HistorySettings           `json:"history"`
+	// ProxyAutoConfig — системный прокси через PAC (/proxy.pac) вместо
+	// фиксированного ProxyServer: direct-правила обходят sing-box в браузере.
+	ProxyAutoConfig bool `json:"proxy_auto_config"`
 }
 
 func DefaultAppSettings() AppSettings {
@@ -42,6 +46,7 @@ func DefaultAppSettings() AppSettings {
 			MaxLatencyMs:     800,
 			CheckIntervalSec: 60,
 			MinImprovementMs: 50,
+			ProbeMethod:      ProbeMethodTCP,
 		},
 		DNSGuard: DNSGuardSettings{
 			Mode:             "warn",
@@ -75,6 +80,9 @@ func DefaultAppSettings() AppSettings {
 			DisableIPv6OnTunnel: false,
 		},
 		Hotkeys: DefaultHotkeySettings(),
+		History: HistorySettings{
+			RetentionDays: DefaultHistoryRetentionDays,
+		},
 	}
 }
 
@@ -90,8 +98,17 @@ type SmartFailoverSettings struct {
 	MaxLatencyMs     int  `json:"max_latency_ms"`
 	CheckIntervalSec int  `json:"check_interval_sec"`
 	MinImprovementMs int  `json:"min_improvement_ms"`
+	// ProbeMethod — чем мерить серверы для failover и автоподключения:
+	// ProbeMethodTCP (время TCP-соединения) или ProbeMethodURL (HTTP-запрос
+	// через отдельный экземпляр sing-box).
+	ProbeMethod string `json:"probe_method"`
 }
 
+const (
+	ProbeMethodTCP = "tcp"
+	ProbeMethodURL = "url"
+)
+
 type DNSGuardSettings struct {
 	Enabled          bool   `json:"enabled"`
 	Mode             string `json:"mode"`
@@ -135,6 +152,18 @@ type LeakTestSettings struct {
 	DisableIPv6OnTunnel bool     `json:"disable_ipv6_on_tunnel"`
 }
 
+// HistorySettings — хранение истории задержек и событий подключения (data/history.db).
+type HistorySettings struct {
+	// RetentionDays — сколько дней хранить замеры и события; более старые удаляются.
+	RetentionDays int `json:"retention_days"`
+}
+
+// DefaultHistoryRetentionDays и MaxHistoryRetentionDays — границы RetentionDays.
+const (
+	DefaultHistoryRetentionDays = 30
+	MaxHistoryRetentionDays     = 365
+)
+
 type HotkeySettings struct {
 	Enabled  bool            `json:"enabled"`
 	Bindings []HotkeyBinding `json:"bindings"`
@@ -194,6 +223,8 @@ func LoadAppSettings(path string) (AppSettings, error) {
 		Telemetry            *TelemetrySettings         `json:"telemetry"`
 		LeakTest             *LeakTestSettings          `json:"leak_test"`
 		Hotkeys              *HotkeySettings            `json:"hotkeys"`
+		History              *HistorySettings           `json:"history"`
+		ProxyAutoConfig      *bool                      `json:"proxy_auto_config"`
 	}
 	if err := json.Unmarshal(data, &raw); err != nil {
 		return settings, fmt.Errorf("неверный формат настроек: %w", err)
@@ -249,6 +280,12 @@ func LoadAppSettings(path string) (AppSettings, error) {
 	if raw.Hotkeys != nil {
 		settings.Hotkeys = *raw.Hotkeys
 	}
+	if raw.History != nil {
+		settings.History = *raw.History
+	}
+	if raw.ProxyAutoConfig != nil {
+		settings.ProxyAutoConfig = *raw.ProxyAutoConfig
+	}
 	if settings.KeepaliveIntervalSec <= 0 {
 		settings.KeepaliveIntervalSec = 120
 	}
@@ -266,6 +303,9 @@ func normalizeAppSettings(settings *AppSettings) {
 	if settings.SmartFailover.MinImprovementMs < 0 {
 		settings.SmartFailover.MinImprovementMs = 50
 	}
+	if settings.SmartFailover.ProbeMethod != ProbeMethodURL {
+		settings.SmartFailover.ProbeMethod = ProbeMethodTCP
+	}
 	if settings.DNSGuard.Mode != "strict" {
 		settings.DNSGuard.Mode = "warn"
 	}
@@ -308,6 +348,12 @@ func normalizeAppSettings(settings *AppSettings) {
 	if len(settings.Hotkeys.Bindings) == 0 {
 		settings.Hotkeys = DefaultHotkeySettings()
 	}
+	if settings.History.RetentionDays <= 0 {
+		settings.History.RetentionDays = DefaultHistoryRetentionDays
+	}
+	if settings.History.RetentionDays > MaxHistoryRetentionDays {
+		settings.History.RetentionDays = MaxHistoryRetentionDays
+	}
 }
 
 func SaveAppSettings(path string, settings AppSettings) error {
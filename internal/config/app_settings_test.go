@@ -109,6 +109,7 @@ func TestSaveAppSettings_NormalizesBeforeWriting(t *testing.T) {
 			CheckIntervalSec: 1,
 			MaxLatencyMs:     -1,
 			MinImprovementMs: -1,
+			ProbeMethod:      "icmp",
 		},
 	}
 	if err := SaveAppSettings(path, settings); err != nil {
@@ -130,4 +131,21 @@ func TestSaveAppSettings_NormalizesBeforeWriting(t *testing.T) {
 	if got.SmartFailover.MinImprovementMs != 50 {
 		t.Fatalf("MinImprovementMs = %d, want 50", got.SmartFailover.MinImprovementMs)
 	}
+	if got.SmartFailover.ProbeMethod != ProbeMethodTCP {
+		t.Fatalf("ProbeMethod = %q, want %q", got.SmartFailover.ProbeMethod, ProbeMethodTCP)
+	}
+}
+
+func TestLoadAppSettings_ClampsHistoryRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(path, []byte(`{"history":{"retention_days":9999}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := LoadAppSettings(path)
+	if err != nil {
+		t.Fatalf("LoadAppSettings returned error: %v", err)
+	}
+	if settings.History.RetentionDays != MaxHistoryRetentionDays {
+		t.Fatalf("RetentionDays=%d, want %d", settings.History.RetentionDays, MaxHistoryRetentionDays)
+	}
 }
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"slices"
+
+	"proxyclient/internal/apprules"
+)
+
+// AppRulesFile — правила приложений. Каждое включённое правило становится
+// process-правилом route, PROXY-правила с inbound_port дают ещё и выделенные
+// inbound'ы в конфиге sing-box.
+const AppRulesFile = DataDir + "/app_rules.json"
+
+// AppInbound — выделенный локальный порт правила приложения. Трафик с него
+// маршрутизируется по тегу inbound'а, без определения процесса через TUN.
+type AppInbound struct {
+	Tag    string
+	Port   int
+	Server string
+	Group  string
+}
+
+// AppProcessRule — правило приложения для соединений, процесс которых
+// sing-box определяет сам (find_process): трафик из TUN и общих inbound'ов.
+type AppProcessRule struct {
+	// Regex — process_path_regex, см. apprules.PatternRegex.
+	Regex  string
+	Action RuleAction
+	Server string
+	Group  string
+}
+
+// appRuleActions — действия apprules в терминах routing.json.
+var appRuleActions = map[apprules.Action]RuleAction{
+	apprules.ActionProxy:  ActionProxy,
+	apprules.ActionDirect: ActionDirect,
+	apprules.ActionBlock:  ActionBlock,
+}
+
+// MigrateProcessRules переносит process- и process_path-правила из
+// routing.json в правила приложений: у процессов одно хранилище с
+// приоритетами и wildcard'ами apprules. Перенесённые правила точные (Exact),
+// как process_name и process_path, а приоритеты сохраняют порядок, в котором
+// их проверял route (см. legacyProcessOrder). Правило, паттерн которого уже
+// есть в appRulesPath, просто убирается из routing.json. Возвращает число
+// перенесённых правил. Нечитаемый app_rules.json — ошибка, routing.json
+// тогда не меняется.
+func MigrateProcessRules(routingPath, appRulesPath string) (int, error) {
+	routing, err := LoadRoutingConfig(routingPath)
+	if err != nil {
+		return 0, err
+	}
+	if !slices.ContainsFunc(routing.Rules, func(r RoutingRule) bool { return IsProcessRuleType(r.Type) }) {
+		return 0, nil
+	}
+	engine, err := apprules.NewPersistentEngine(apprules.NewFileStorage(appRulesPath))
+	if err != nil {
+		return 0, err
+	}
+	keep, add := ProcessRulesToAppRules(routing.Rules, engine.ListRules())
+	if len(add) > 0 {
+		if _, err := engine.AddRuleBatch(add); err != nil {
+			return 0, err
+		}
+	}
+	routing.Rules = keep
+	if err := SaveRoutingConfig(routingPath, routing); err != nil {
+		return len(add), err
+	}
+	return len(add), nil
+}
+
+// ProcessRulesToAppRules отделяет process- и process_path-правила routing.json
+// от остальных (keep) и превращает их в правила приложений (add) по тем же
+// соглашениям, что и MigrateProcessRules. Правила, паттерн которых уже есть
+// в existing, в add не попадают.
+func ProcessRulesToAppRules(all []RoutingRule, existing []apprules.Rule) (keep []RoutingRule, add []apprules.Rule) {
+	keep = make([]RoutingRule, 0, len(all))
+	var moved []RoutingRule
+	for _, r := range all {
+		if IsProcessRuleType(r.Type) {
+			moved = append(moved, r)
+		} else {
+			keep = append(keep, r)
+		}
+	}
+	seen := map[string]bool{}
+	for _, r := range existing {
+		seen[r.Pattern] = true
+	}
+	for _, r := range legacyProcessOrder(all, moved) {
+		pattern := apprules.NormalizePattern(r.Value)
+		if seen[pattern] {
+			continue
+		}
+		seen[pattern] = true
+		rule := apprules.Rule{Name: r.Note, Pattern: r.Value, Enabled: true, Exact: true}
+		if rule.Name == "" {
+			rule.Name = r.Value
+		}
+		for action, ra := range appRuleActions {
+			if ra == r.Action {
+				rule.Action = action
+			}
+		}
+		if rule.Action == apprules.ActionProxy {
+			rule.ProxyAddr = ProxyAddr
+			rule.Server, rule.Group = r.Server, r.Group
+		}
+		add = append(add, rule)
+	}
+	for i := range add {
+		add[i].Priority = len(add) - i
+	}
+	return keep, add
+}
+
+// legacyProcessOrder упорядочивает process-правила так, как их проверял route
+// до переноса: BLOCK, DIRECT, PROXY с сервером или группой (цели в порядке
+// первого появления среди всех правил), затем обычный PROXY; внутри цели
+// имена раньше путей.
+func legacyProcessOrder(all, procs []RoutingRule) []RoutingRule {
+	targets := map[string]int{}
+	for _, r := range all {
+		if r.Action != ActionProxy || (r.Server == "" && r.Group == "") {
+			continue
+		}
+		if _, ok := targets[ruleOutboundTag(r)]; !ok {
+			targets[ruleOutboundTag(r)] = len(targets)
+		}
+	}
+	rank := func(r RoutingRule) int {
+		stage := 0
+		switch {
+		case r.Action == ActionBlock:
+		case r.Action == ActionDirect:
+			stage = 1
+		case r.Server != "" || r.Group != "":
+			stage = 2 + targets[ruleOutboundTag(r)]
+		default:
+			stage = 2 + len(targets)
+		}
+		stage *= 2
+		if r.Type == RuleTypeProcessPath {
+			stage++
+		}
+		return stage
+	}
+	out := slices.Clone(procs)
+	slices.SortStableFunc(out, func(a, b RoutingRule) int { return rank(a) - rank(b) })
+	return out
+}
+
+// LoadAppRules читает включённые правила приложений: выделенные порты
+// PROXY-правил и process-правила в порядке приоритета, как их проверяет
+// apprules.Engine.
+func LoadAppRules(path string) ([]AppInbound, []AppProcessRule, error) {
+	rules, err := apprules.NewFileStorage(path).Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	apprules.SortRules(rules)
+	var inbounds []AppInbound
+	var procs []AppProcessRule
+	for _, r := range rules {
+		action, ok := appRuleActions[r.Action]
+		if !r.Enabled || !ok || r.Pattern == "" {
+			continue
+		}
+		if r.HasDedicatedInbound() && r.ID != "" {
+			inbounds = append(inbounds, AppInbound{Tag: r.InboundTag(), Port: r.InboundPort, Server: r.Server, Group: r.Group})
+		}
+		regex := apprules.PatternRegex(apprules.NormalizePattern(r.Pattern))
+		if r.Exact {
+			regex = apprules.ExactPatternRegex(apprules.NormalizePattern(r.Pattern))
+		}
+		proc := AppProcessRule{Regex: regex, Action: action}
+		if action == ActionProxy {
+			proc.Server, proc.Group = r.Server, r.Group
+		}
+		procs = append(procs, proc)
+	}
+	return inbounds, procs, nil
+}
+
+// IsReservedLocalPort — порт занят самим клиентом: API, Clash API, http-in,
+// mixed-in или раздача в LAN. routingCfg == nil — порт LAN по умолчанию.
+func IsReservedLocalPort(port int, routingCfg *RoutingConfig) bool {
+	lanPort := DefaultLANSharePort
+	if routingCfg != nil && routingCfg.LANSharePort != 0 {
+		lanPort = routingCfg.LANSharePort
+	}
+	switch port {
+	case APIPort, ClashAPIPort, ProxyPort, MixedPort, lanPort:
+		return true
+	}
+	return false
+}
+
+// usableAppInbounds отбрасывает inbound'ы на занятых портах и повторы порта:
+// sing-box с двумя inbound'ами на одном порту не запустится.
+func usableAppInbounds(routingCfg *RoutingConfig) []AppInbound {
+	var out []AppInbound
+	seen := map[int]bool{}
+	for _, in := range routingCfg.AppInbounds {
+		if in.Port <= 0 || in.Port > 65535 || seen[in.Port] || IsReservedLocalPort(in.Port, routingCfg) {
+			continue
+		}
+		seen[in.Port] = true
+		out = append(out, in)
+	}
+	return out
+}
+
+// appRuleOutbound — outbound правила приложения: группа, сервер или proxyFinal.
+func appRuleOutbound(server, group, proxyFinal string) string {
+	switch {
+	case group != "":
+		return GroupOutboundTag(group)
+	case server != "":
+		return ServerOutboundTag(server)
+	default:
+		return proxyFinal
+	}
+}
+
+// appRouteRules направляет трафик выделенных портов в выбранные outbound'ы.
+func appRouteRules(routingCfg *RoutingConfig, proxyFinal string) []SBRouteRule {
+	var rules []SBRouteRule
+	for _, in := range usableAppInbounds(routingCfg) {
+		rules = append(rules, SBRouteRule{Inbound: []string{in.Tag}, Outbound: appRuleOutbound(in.Server, in.Group, proxyFinal)})
+	}
+	return rules
+}
+
+// appProcessRouteRules — process-правила приложений в порядке приоритета.
+// Подряд идущие правила с одной целью сливаются в одно (process_path_regex
+// проверяется через ИЛИ). head — ведущие BLOCK-правила: их никакое правило
+// приложения не перекрывает, и они встают к остальным блокировкам в начало
+// route; rest — всё остальное, на место process-правил routing.json.
+func appProcessRouteRules(routingCfg *RoutingConfig, proxyFinal string) (head, rest []SBRouteRule) {
+	procs := routingCfg.AppProcessRules
+	n := 0
+	for n < len(procs) && procs[n].Action == ActionBlock {
+		n++
+	}
+	return mergeAppProcessRules(procs[:n], proxyFinal), mergeAppProcessRules(procs[n:], proxyFinal)
+}
+
+func mergeAppProcessRules(procs []AppProcessRule, proxyFinal string) []SBRouteRule {
+	var rules []SBRouteRule
+	for _, p := range procs {
+		var r SBRouteRule
+		switch p.Action {
+		case ActionBlock:
+			r.Action = "reject"
+		case ActionDirect:
+			r.Outbound = "direct"
+		default:
+			r.Outbound = appRuleOutbound(p.Server, p.Group, proxyFinal)
+		}
+		if last := len(rules) - 1; last >= 0 && rules[last].Action == r.Action && rules[last].Outbound == r.Outbound {
+			if !slices.Contains(rules[last].ProcessPathRegex, p.Regex) {
+				rules[last].ProcessPathRegex = append(rules[last].ProcessPathRegex, p.Regex)
+			}
+			continue
+		}
+		r.ProcessPathRegex = []string{p.Regex}
+		rules = append(rules, r)
+	}
+	return rules
+}
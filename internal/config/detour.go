@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDetourDepth — предел длины цепочки. Больше двух-трёх хопов на практике
+// не встречается; предел защищает от случайно собранных длинных цепочек.
+const maxDetourDepth = 8
+
+// DetourChain возвращает серверы, через которые подключается сервер id,
+// от ближайшего к id до последнего хопа (его sing-box набирает напрямую).
+// Сам id в результат не входит. Ошибка — если член цепочки не найден
+// или цепочка замыкается.
+func DetourChain(servers []SavedServer, id string) ([]SavedServer, error) {
+	byID := make(map[string]SavedServer, len(servers))
+	for _, s := range servers {
+		byID[s.ID] = s
+	}
+	cur, ok := byID[id]
+	if !ok {
+		return nil, fmt.Errorf("сервер %q не найден", id)
+	}
+	visited := map[string]bool{id: true}
+	var chain []SavedServer
+	for cur.Detour != "" {
+		next, ok := byID[cur.Detour]
+		if !ok {
+			return nil, fmt.Errorf("цепочка серверов: промежуточный сервер %q для %q не найден", cur.Detour, cur.ID)
+		}
+		if visited[next.ID] {
+			return nil, fmt.Errorf("цепочка серверов: цикл через %q", next.ID)
+		}
+		if len(chain) >= maxDetourDepth {
+			return nil, fmt.Errorf("цепочка серверов длиннее %d", maxDetourDepth)
+		}
+		visited[next.ID] = true
+		chain = append(chain, next)
+		cur = next
+	}
+	return chain, nil
+}
+
+// ValidateDetour проверяет, что сервер id можно пустить через detour:
+// detour существует, не образует цикла, и каждый член цепочки парсится.
+// servers — список без учёта предлагаемого изменения; оно применяется здесь.
+func ValidateDetour(servers []SavedServer, id, detour string) error {
+	if detour == "" {
+		return nil
+	}
+	if detour == id {
+		return fmt.Errorf("сервер не может быть промежуточным сам для себя")
+	}
+	candidate := make([]SavedServer, len(servers))
+	copy(candidate, servers)
+	found := false
+	for i := range candidate {
+		if candidate[i].ID == id {
+			candidate[i].Detour = detour
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("сервер %q не найден", id)
+	}
+	chain, err := DetourChain(candidate, id)
+	if err != nil {
+		return err
+	}
+	_, _, err = buildDetourOutbounds(chain)
+	return err
+}
+
+// ServerChainOutbounds собирает outbound сервера id (тег ServerOutboundTag(id))
+// вместе с outbounds его detour-цепочки — всё, что нужно, чтобы подключиться
+// к серверу отдельно от активного конфига (например, для URL-теста).
+func ServerChainOutbounds(servers []SavedServer, id string) ([]SBOutbound, error) {
+	var self SavedServer
+	found := false
+	for _, s := range servers {
+		if s.ID == id {
+			self, found = s, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("сервер %q не найден", id)
+	}
+	chain, err := DetourChain(servers, id)
+	if err != nil {
+		return nil, err
+	}
+	outs, _, err := buildDetourOutbounds(append([]SavedServer{self}, chain...))
+	return outs, err
+}
+
+// buildDetourOutbounds превращает цепочку в outbounds server-<id>, каждый из которых
+// (кроме последнего) набирается через следующий. Возвращает также адрес последнего
+// хопа — именно к нему sing-box подключается напрямую (нужен для TUN exclude).
+func buildDetourOutbounds(chain []SavedServer) ([]SBOutbound, string, error) {
+	outs := make([]SBOutbound, 0, len(chain))
+	lastAddr := ""
+	for i, s := range chain {
+		parsed, err := ParseServerContent(strings.TrimSpace(s.URL))
+		if err != nil {
+			return nil, "", fmt.Errorf("цепочка серверов: сервер %q (%s) не распознан: %w", s.Name, s.ID, err)
+		}
+		ob := parsed.Outbound
+		ob.Tag = ServerOutboundTag(s.ID)
+		if i+1 < len(chain) {
+			ob.Detour = ServerOutboundTag(chain[i+1].ID)
+		}
+		outs = append(outs, ob)
+		lastAddr = parsed.Address
+	}
+	return outs, lastAddr, nil
+}
+
+// findSavedServerByURL ищет сохранённый сервер, URL которого совпадает с content
+// (содержимым secret.key) — так определяется активный сервер и его цепочка.
+func findSavedServerByURL(servers []SavedServer, content string) (SavedServer, bool) {
+	content = strings.TrimSpace(content)
+	for _, s := range servers {
+		if strings.TrimSpace(s.URL) == content {
+			return s, true
+		}
+	}
+	return SavedServer{}, false
+}
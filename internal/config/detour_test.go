@@ -0,0 +1,111 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetourChain(t *testing.T) {
+	servers := []SavedServer{
+		{ID: "a", Detour: "b"},
+		{ID: "b", Detour: "c"},
+		{ID: "c"},
+		{ID: "x", Detour: "y"},
+		{ID: "y", Detour: "x"},
+		{ID: "m", Detour: "missing"},
+	}
+	chain, err := DetourChain(servers, "a")
+	if err != nil {
+		t.Fatalf("DetourChain(a): %v", err)
+	}
+	if len(chain) != 2 || chain[0].ID != "b" || chain[1].ID != "c" {
+		t.Fatalf("chain = %+v, want b, c", chain)
+	}
+	if _, err := DetourChain(servers, "x"); err == nil || !strings.Contains(err.Error(), "цикл") {
+		t.Errorf("DetourChain(x) err = %v, want cycle error", err)
+	}
+	if _, err := DetourChain(servers, "m"); err == nil {
+		t.Error("DetourChain(m) must fail on missing relay")
+	}
+}
+
+func TestGenerateSingBoxConfig_ActiveServerDetour(t *testing.T) {
+	dir := t.TempDir()
+	const exitURL = "vless://12345678-1234-1234-1234-123456789abc@exit.example.com:443?sni=www.google.com&pbk=testkey&sid=abc"
+	secretPath := filepath.Join(dir, "secret.key")
+	mustWriteFile(t, secretPath, []byte(exitURL))
+
+	old, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd: %v", err)
+	}
+	mustChdir(t, dir)
+	defer mustChdir(t, old)
+
+	mustWriteFile(t, ServersFile, []byte(`[
+		{"id":"exit","name":"Exit","url":"`+exitURL+`","detour":"relay"},
+		{"id":"relay","name":"Relay","url":"trojan://pass@203.0.113.7:443"}
+	]`))
+
+	outputPath := filepath.Join(dir, "out.json")
+	if err := GenerateSingBoxConfig(secretPath, outputPath, DefaultRoutingConfig()); err != nil {
+		t.Fatalf("GenerateSingBoxConfig: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile out.json: %v", err)
+	}
+	var out SingBoxConfig
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal out.json: %v", err)
+	}
+	if out.Outbounds[0].Tag != "proxy-out" || out.Outbounds[0].Detour != "server-relay" {
+		t.Fatalf("proxy-out = %+v, want detour server-relay", out.Outbounds[0])
+	}
+	if out.Outbounds[1].Tag != "server-relay" || out.Outbounds[1].Detour != "" {
+		t.Fatalf("relay outbound = %+v", out.Outbounds[1])
+	}
+	// Напрямую набирается relay — его адрес и исключается из TUN.
+	var tun *SBInbound
+	for i := range out.Inbounds {
+		if out.Inbounds[i].Type == "tun" {
+			tun = &out.Inbounds[i]
+		}
+	}
+	if tun == nil || !strings.Contains(strings.Join(tun.RouteExcludeAddress, ","), "203.0.113.7") {
+		t.Errorf("TUN route_exclude_address must contain relay IP, got %+v", tun)
+	}
+
+	// Сломанный relay — явная ошибка, а не тихое прямое подключение.
+	mustWriteFile(t, ServersFile, []byte(`[
+		{"id":"exit","name":"Exit","url":"`+exitURL+`","detour":"relay"},
+		{"id":"relay","name":"Relay","url":"garbage://relay"}
+	]`))
+	if err := GenerateSingBoxConfig(secretPath, outputPath, DefaultRoutingConfig()); err == nil {
+		t.Fatal("GenerateSingBoxConfig must fail on unparseable chain member")
+	}
+}
+
+func TestServerChainOutbounds(t *testing.T) {
+	const vless = "vless://12345678-1234-1234-1234-123456789abc@%s:443?sni=www.google.com&pbk=testkey&sid=abc"
+	servers := []SavedServer{
+		{ID: "exit", URL: strings.Replace(vless, "%s", "exit.example.com", 1), Detour: "relay"},
+		{ID: "relay", URL: strings.Replace(vless, "%s", "relay.example.com", 1)},
+	}
+	outs, err := ServerChainOutbounds(servers, "exit")
+	if err != nil {
+		t.Fatalf("ServerChainOutbounds: %v", err)
+	}
+	if len(outs) != 2 || outs[0].Tag != ServerOutboundTag("exit") || outs[0].Detour != ServerOutboundTag("relay") || outs[1].Detour != "" {
+		t.Fatalf("outbounds = %+v", outs)
+	}
+	if outs, err := ServerChainOutbounds(servers, "relay"); err != nil || len(outs) != 1 {
+		t.Errorf("relay outbounds = %+v, err = %v", outs, err)
+	}
+	if _, err := ServerChainOutbounds(servers, "missing"); err == nil {
+		t.Error("missing server must fail")
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// DefaultFakeIPRange — диапазон RFC 2544 (benchmarking): в интернете не
+// маршрутизируется и не пересекается с домашними сетями.
+const DefaultFakeIPRange = "198.18.0.0/15"
+
+// fakeIPDNSTag — тег fakeip-сервера в dns.servers.
+const fakeIPDNSTag = "fakeip"
+
+// FakeIPConfig включает FakeIP для TUN: на A-запросы приложений sing-box сразу
+// отвечает адресом из Inet4Range, а настоящий домен восстанавливает при
+// подключении. Приложение не ждёт DoH round-trip через прокси.
+type FakeIPConfig struct {
+	Enabled bool `json:"enabled"`
+	// Inet4Range — IPv4-подсеть фейковых адресов. Пусто — DefaultFakeIPRange.
+	Inet4Range string `json:"inet4_range,omitempty"`
+	// Exclude — домены (вместе с поддоменами), которым нужны настоящие IP:
+	// LAN-имена, NTP, игры с проверкой адреса. Пусто — DefaultFakeIPExclude.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// DefaultFakeIPExclude — домены, которые ломаются с фейковыми адресами.
+var DefaultFakeIPExclude = []string{
+	// LAN и mDNS
+	"local", "lan", "home.arpa", "localdomain",
+	// NTP: Windows Time сверяет адрес ответа
+	"time.windows.com", "pool.ntp.org", "time.google.com", "time.apple.com",
+	// Проверка подключения Windows (NCSI) сравнивает полученный IP с эталоном
+	"msftconnecttest.com", "msftncsi.com",
+	// STUN и игровые сервисы, которые передают свой IP внутри протокола
+	"stun.l.google.com", "xboxlive.com", "steamserver.net",
+}
+
+// fakeIPActive сообщает, нужно ли генерировать FakeIP. Фейковые адреса
+// выдаются только запросам из TUN: в режиме без TUN (ProxyOnly) нет ни
+// tun-in, ни приложений, которые получали бы такие адреса.
+func fakeIPActive(routingCfg *RoutingConfig) bool {
+	if routingCfg == nil || routingCfg.ProxyOnly {
+		return false
+	}
+	dnsCfg := routingCfg.DNS
+	return dnsCfg != nil && dnsCfg.FakeIP != nil && dnsCfg.FakeIP.Enabled
+}
+
+// ValidateFakeIPRange проверяет подсеть фейковых адресов: IPv4, не уже /24 и
+// без пересечения с локальными диапазонами, которые всегда идут напрямую.
+func ValidateFakeIPRange(s string) error {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("неверная подсеть %q: %w", s, err)
+	}
+	if !prefix.Addr().Is4() {
+		return fmt.Errorf("подсеть %q: поддерживается только IPv4", s)
+	}
+	if prefix.Bits() > 24 {
+		return fmt.Errorf("подсеть %q слишком мала: нужна /24 или шире", s)
+	}
+	for _, private := range privateIPRanges {
+		p, err := netip.ParsePrefix(private)
+		if err == nil && p.Addr().Is4() && p.Overlaps(prefix) {
+			return fmt.Errorf("подсеть %q пересекается с локальной сетью %s", s, private)
+		}
+	}
+	return nil
+}
+
+// sanitizeFakeIP приводит FakeIP-настройки к виду, который можно отдать sing-box:
+// невалидная подсеть заменяется на DefaultFakeIPRange, исключения нормализуются.
+func sanitizeFakeIP(f *FakeIPConfig) {
+	if f == nil {
+		return
+	}
+	f.Inet4Range = strings.TrimSpace(f.Inet4Range)
+	if f.Inet4Range == "" || ValidateFakeIPRange(f.Inet4Range) != nil {
+		f.Inet4Range = DefaultFakeIPRange
+	} else {
+		f.Inet4Range = netip.MustParsePrefix(f.Inet4Range).Masked().String()
+	}
+	seen := make(map[string]bool, len(f.Exclude))
+	exclude := f.Exclude[:0]
+	for _, d := range f.Exclude {
+		d = strings.TrimPrefix(strings.ToLower(NormalizeRuleValue(d)), ".")
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		exclude = append(exclude, d)
+	}
+	f.Exclude = exclude
+}
+
+// fakeIPExclude возвращает исключения с учётом значений по умолчанию.
+func fakeIPExclude(f *FakeIPConfig) []string {
+	if len(f.Exclude) > 0 {
+		return f.Exclude
+	}
+	return DefaultFakeIPExclude
+}
+
+// fakeIPRange возвращает подсеть с учётом значения по умолчанию.
+func fakeIPRange(f *FakeIPConfig) string {
+	if f.Inet4Range == "" {
+		return DefaultFakeIPRange
+	}
+	return f.Inet4Range
+}
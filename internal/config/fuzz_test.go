@@ -129,6 +129,9 @@ func FuzzDetectRuleType(f *testing.F) {
 		"[::1]", "256.256.256.256", "not-an-ip",
 		"TELEGRAM.EXE", "Telegram.Exe",
 		"geosite:YOUTUBE",
+		"ruleset:Ads",
+		`C:\Program Files\App\App.exe`,
+		"geoip:RU", "keyword:CDN", `regex:^Ads?\d+\.`, "port:8000-9000", "port:0", "network:UDP",
 		"192.168.1.1:8080",
 		"https://google.com",
 		strings.Repeat("x", 500),
@@ -138,10 +141,17 @@ func FuzzDetectRuleType(f *testing.F) {
 	}
 
 	validTypes := map[RuleType]bool{
-		RuleTypeProcess: true,
-		RuleTypeDomain:  true,
-		RuleTypeIP:      true,
-		RuleTypeGeosite: true,
+		RuleTypeProcess:     true,
+		RuleTypeDomain:      true,
+		RuleTypeIP:          true,
+		RuleTypeGeosite:     true,
+		RuleTypeRuleSet:     true,
+		RuleTypeProcessPath: true,
+		RuleTypeGeoIP:       true,
+		RuleTypeKeyword:     true,
+		RuleTypeRegex:       true,
+		RuleTypePort:        true,
+		RuleTypeNetwork:     true,
 	}
 
 	f.Fuzz(func(t *testing.T, input string) {
@@ -153,9 +163,9 @@ func FuzzDetectRuleType(f *testing.F) {
 			t.Errorf("DetectRuleType(%q) = %q — недопустимый тип", input, rt)
 		}
 
-		// Инвариант 3: .exe → process
+		// Инвариант 3: .exe → process (по имени или по полному пути)
 		if strings.HasSuffix(strings.ToLower(strings.TrimSpace(input)), ".exe") {
-			if rt != RuleTypeProcess {
+			if !IsProcessRuleType(rt) {
 				t.Errorf("DetectRuleType(%q) = %q, ожидали RuleTypeProcess", input, rt)
 			}
 		}
@@ -176,7 +186,7 @@ func FuzzDetectRuleType(f *testing.F) {
 			// Например "192.168.1.0/24" → NormalizeRuleValue может обрезать до "192.168.1.0"
 			// и тип изменится с IP на Domain — это допустимо.
 			// Но geosite: → geosite и .exe → process должны оставаться.
-			if rt == RuleTypeProcess && rt2 != RuleTypeProcess {
+			if IsProcessRuleType(rt) && rt2 != rt {
 				t.Errorf("нормализация изменила тип process: input=%q → %q, DetectRuleType: %q → %q",
 					input, normalized, rt, rt2)
 			}
@@ -184,6 +194,14 @@ func FuzzDetectRuleType(f *testing.F) {
 				t.Errorf("нормализация изменила тип geosite: input=%q → %q, DetectRuleType: %q → %q",
 					input, normalized, rt, rt2)
 			}
+			if rt == RuleTypeRuleSet && rt2 != RuleTypeRuleSet {
+				t.Errorf("нормализация изменила тип ruleset: input=%q → %q, DetectRuleType: %q → %q",
+					input, normalized, rt, rt2)
+			}
+			if typedRulePrefixes[string(rt)] && rt2 != rt {
+				t.Errorf("нормализация изменила тип %s: input=%q → %q, DetectRuleType: %q → %q",
+					rt, input, normalized, rt, rt2)
+			}
 		}
 	})
 }
@@ -393,7 +411,9 @@ func FuzzSanitizeRoutingConfig(f *testing.F) {
 		// После санитизации все не-пустые правила должны иметь валидный тип
 		validTypes := map[RuleType]bool{
 			RuleTypeProcess: true, RuleTypeDomain: true,
-			RuleTypeIP: true, RuleTypeGeosite: true,
+			RuleTypeIP: true, RuleTypeGeosite: true, RuleTypeRuleSet: true,
+			RuleTypeProcessPath: true, RuleTypeGeoIP: true, RuleTypeKeyword: true,
+			RuleTypeRegex: true, RuleTypePort: true, RuleTypeNetwork: true,
 		}
 		for i, rule := range cfg.Rules {
 			if rule.Value != "" && !validTypes[rule.Type] {
@@ -0,0 +1,196 @@
+package config
+
+import "strings"
+
+// GroupType — тип группы серверов, соответствует типу outbound'а sing-box.
+type GroupType string
+
+const (
+	// GroupTypeURLTest — sing-box сам выбирает сервер с лучшей задержкой
+	// и переключается без перезапуска при деградации текущего.
+	GroupTypeURLTest GroupType = "urltest"
+	// GroupTypeSelector — ручной выбор сервера через Clash API (PUT /proxies/{tag}).
+	GroupTypeSelector GroupType = "selector"
+)
+
+const (
+	groupOutboundPrefix = "group-"
+	// Параметры urltest совпадают с дефолтами sing-box; задаём явно, чтобы
+	// поведение группы не менялось вместе с версией ядра.
+	groupURLTestURL       = "https://www.gstatic.com/generate_204"
+	groupURLTestInterval  = "3m"
+	groupURLTestTolerance = 50
+)
+
+// ServerGroup — группа сохранённых серверов (urltest или selector).
+// Состав: явный список Servers плюс все серверы подписки SubscriptionID.
+type ServerGroup struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name,omitempty"`
+	Type           GroupType `json:"type"`
+	SubscriptionID string    `json:"subscription_id,omitempty"`
+	Servers        []string  `json:"servers,omitempty"`
+}
+
+// GroupOutboundTag возвращает тег outbound'а группы с данным ID.
+func GroupOutboundTag(id string) string {
+	return groupOutboundPrefix + id
+}
+
+// IsValidGroupType сообщает, поддерживается ли тип группы.
+func IsValidGroupType(t GroupType) bool {
+	return t == GroupTypeURLTest || t == GroupTypeSelector
+}
+
+// IsValidGroupID проверяет ID группы: он попадает в тег outbound'а и в URL API,
+// поэтому допускаются только [a-z0-9_-].
+func IsValidGroupID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// FindGroup возвращает группу по ID.
+func (cfg *RoutingConfig) FindGroup(id string) (ServerGroup, bool) {
+	if cfg == nil {
+		return ServerGroup{}, false
+	}
+	for _, g := range cfg.Groups {
+		if g.ID == id {
+			return g, true
+		}
+	}
+	return ServerGroup{}, false
+}
+
+// sanitizeServerGroups отбрасывает группы с невалидным ID/типом и дубликаты,
+// чистит список серверов от пустых и повторяющихся ID.
+func sanitizeServerGroups(groups []ServerGroup) []ServerGroup {
+	if len(groups) == 0 {
+		return nil
+	}
+	out := make([]ServerGroup, 0, len(groups))
+	seen := map[string]bool{}
+	for _, g := range groups {
+		g.ID = strings.TrimSpace(g.ID)
+		g.SubscriptionID = strings.TrimSpace(g.SubscriptionID)
+		if !IsValidGroupID(g.ID) || !IsValidGroupType(g.Type) || seen[g.ID] {
+			continue
+		}
+		seen[g.ID] = true
+		var servers []string
+		seenServer := map[string]bool{}
+		for _, id := range g.Servers {
+			id = strings.TrimSpace(id)
+			if id == "" || seenServer[id] {
+				continue
+			}
+			seenServer[id] = true
+			servers = append(servers, id)
+		}
+		g.Servers = servers
+		out = append(out, g)
+	}
+	return out
+}
+
+// GroupMemberIDs возвращает ID серверов группы в порядке: явный список, затем
+// серверы подписки в порядке servers.json. Несуществующие ID отбрасываются.
+func GroupMemberIDs(g ServerGroup, servers []SavedServer) []string {
+	known := make(map[string]bool, len(servers))
+	for _, s := range servers {
+		known[s.ID] = true
+	}
+	var ids []string
+	seen := map[string]bool{}
+	for _, id := range g.Servers {
+		if known[id] && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if g.SubscriptionID != "" {
+		for _, s := range servers {
+			if s.SubscriptionID == g.SubscriptionID && !seen[s.ID] {
+				seen[s.ID] = true
+				ids = append(ids, s.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// buildGroupOutbound собирает urltest/selector outbound над уже построенными членами.
+func buildGroupOutbound(g ServerGroup, memberTags []string) SBOutbound {
+	ob := SBOutbound{
+		Type:      string(g.Type),
+		Tag:       GroupOutboundTag(g.ID),
+		Outbounds: memberTags,
+		// Переключение рвёт старые соединения: иначе долгие TCP-сессии
+		// продолжают висеть на упавшем сервере.
+		InterruptExistConnections: true,
+	}
+	switch g.Type {
+	case GroupTypeURLTest:
+		ob.URL = groupURLTestURL
+		ob.Interval = groupURLTestInterval
+		ob.Tolerance = groupURLTestTolerance
+	case GroupTypeSelector:
+		ob.Default = memberTags[0]
+	}
+	return ob
+}
+
+// buildTargetOutbounds строит outbounds сохранённых серверов и групп, на которые
+// ссылается routingCfg. Группа без единого рабочего члена не создаётся —
+// её правила откатываются на proxy-out в resolveServerRules.
+func buildTargetOutbounds(servers []SavedServer, routingCfg *RoutingConfig) []SBOutbound {
+	serverIDs, groupIDs := referencedTargets(routingCfg)
+
+	var groups []ServerGroup
+	members := map[string][]string{}
+	ids := append([]string(nil), serverIDs...)
+	seen := map[string]bool{}
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, gid := range groupIDs {
+		g, ok := routingCfg.FindGroup(gid)
+		if !ok {
+			continue
+		}
+		groups = append(groups, g)
+		members[g.ID] = GroupMemberIDs(g, servers)
+		for _, id := range members[g.ID] {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	outs := buildServerOutbounds(servers, ids)
+	built := make(map[string]bool, len(outs))
+	for _, ob := range outs {
+		built[ob.Tag] = true
+	}
+	for _, g := range groups {
+		var tags []string
+		for _, id := range members[g.ID] {
+			if tag := ServerOutboundTag(id); built[tag] {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			continue
+		}
+		outs = append(outs, buildGroupOutbound(g, tags))
+	}
+	return outs
+}
@@ -0,0 +1,88 @@
+package config
+
+import "testing"
+
+func TestBuildTargetOutbounds_Groups(t *testing.T) {
+	servers := []SavedServer{
+		{ID: "a", URL: "trojan://p@a.example.com:443", SubscriptionID: "sub1"},
+		{ID: "b", URL: "not-a-link", SubscriptionID: "sub1"},
+		{ID: "c", URL: "trojan://p@c.example.com:443"},
+	}
+	cfg := &RoutingConfig{
+		DefaultAction: ActionProxy,
+		DefaultGroup:  "auto",
+		Groups: []ServerGroup{
+			{ID: "auto", Type: GroupTypeURLTest, SubscriptionID: "sub1"},
+			{ID: "manual", Type: GroupTypeSelector, Servers: []string{"c", "a"}},
+			{ID: "empty", Type: GroupTypeSelector, Servers: []string{"missing"}},
+		},
+		Rules: []RoutingRule{
+			{Value: "netflix.com", Type: RuleTypeDomain, Action: ActionProxy, Group: "manual"},
+			{Value: "hulu.com", Type: RuleTypeDomain, Action: ActionProxy, Group: "empty"},
+		},
+	}
+
+	outs := buildTargetOutbounds(servers, cfg)
+	byTag := map[string]SBOutbound{}
+	for _, ob := range outs {
+		byTag[ob.Tag] = ob
+	}
+	if _, ok := byTag["server-b"]; ok {
+		t.Error("unparseable server b must be skipped")
+	}
+	auto, ok := byTag["group-auto"]
+	if !ok || auto.Type != "urltest" || len(auto.Outbounds) != 1 || auto.Outbounds[0] != "server-a" {
+		t.Fatalf("group-auto = %+v", auto)
+	}
+	manual, ok := byTag["group-manual"]
+	if !ok || manual.Type != "selector" || manual.Default != "server-c" || len(manual.Outbounds) != 2 {
+		t.Fatalf("group-manual = %+v", manual)
+	}
+	if _, ok := byTag["group-empty"]; ok {
+		t.Error("group without members must not be emitted")
+	}
+
+	resolved := resolveServerRules(cfg, outs)
+	if resolved.Rules[1].Group != "" {
+		t.Errorf("rule on empty group must fall back to proxy-out, got group %q", resolved.Rules[1].Group)
+	}
+	route := buildRoute(resolved, "")
+	if route.Final != "group-auto" {
+		t.Errorf("Final = %q, want group-auto", route.Final)
+	}
+	found := false
+	for _, r := range route.Rules {
+		if r.Outbound == "group-manual" && len(r.Domain) == 1 && r.Domain[0] == "netflix.com" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("netflix.com rule not routed to group-manual: %+v", route.Rules)
+	}
+}
+
+func TestSanitizeRoutingConfig_Groups(t *testing.T) {
+	cfg := &RoutingConfig{
+		DefaultAction: ActionDirect,
+		DefaultGroup:  "auto",
+		Groups: []ServerGroup{
+			{ID: "auto", Type: GroupTypeURLTest, Servers: []string{"a", " a ", ""}},
+			{ID: "auto", Type: GroupTypeSelector},
+			{ID: "Bad ID", Type: GroupTypeSelector},
+			{ID: "x", Type: "fallback"},
+		},
+		Rules: []RoutingRule{
+			{Value: "example.com", Type: RuleTypeDomain, Action: ActionProxy, Group: "auto", Server: "a"},
+		},
+	}
+	SanitizeRoutingConfig(cfg)
+	if len(cfg.Groups) != 1 || len(cfg.Groups[0].Servers) != 1 {
+		t.Fatalf("groups = %+v, want single auto group with one server", cfg.Groups)
+	}
+	if cfg.DefaultGroup != "" {
+		t.Errorf("DefaultGroup = %q, want empty for direct default", cfg.DefaultGroup)
+	}
+	if cfg.Rules[0].Server != "" || cfg.Rules[0].Group != "auto" {
+		t.Errorf("rule = %+v, want group kept and server cleared", cfg.Rules[0])
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import "strings"
+
+// IPv6Mode — как клиент обращается с IPv6 в туннеле.
+type IPv6Mode string
+
+const (
+	// IPv6ModeIPv4Only — поведение по умолчанию: AAAA не запрашиваются,
+	// IPv6-соединения отклоняются. Пустое значение означает то же самое.
+	IPv6ModeIPv4Only IPv6Mode = "ipv4-only"
+	// IPv6ModePreferIPv4 — IPv6 проходит через TUN, но при наличии обоих
+	// адресов DNS отдаёт приоритет IPv4.
+	IPv6ModePreferIPv4 IPv6Mode = "prefer-ipv4"
+	// IPv6ModeDualStack — полноценный dual-stack: записи A и AAAA как есть.
+	IPv6ModeDualStack IPv6Mode = "dual-stack"
+)
+
+// tunIPv6Address — ULA-адрес TUN-интерфейса в режимах с IPv6. Входит в
+// fc00::/7 из privateIPRanges, поэтому сам не проксируется.
+const tunIPv6Address = "fdfe:dcba:9876::1/126"
+
+// NormalizeIPv6Mode приводит значение к одной из констант. Пустое и
+// неизвестное значения — IPv6ModeIPv4Only.
+func NormalizeIPv6Mode(mode IPv6Mode) IPv6Mode {
+	switch m := IPv6Mode(strings.ToLower(strings.TrimSpace(string(mode)))); m {
+	case IPv6ModePreferIPv4, IPv6ModeDualStack:
+		return m
+	}
+	return IPv6ModeIPv4Only
+}
+
+// IsValidIPv6Mode — одно из значений IPv6Mode или пустая строка.
+func IsValidIPv6Mode(mode IPv6Mode) bool {
+	switch mode {
+	case "", IPv6ModeIPv4Only, IPv6ModePreferIPv4, IPv6ModeDualStack:
+		return true
+	}
+	return false
+}
+
+// IPv6Enabled сообщает, пропускает ли режим IPv6-трафик через туннель.
+func (m IPv6Mode) IPv6Enabled() bool {
+	return NormalizeIPv6Mode(m) != IPv6ModeIPv4Only
+}
+
+// dnsStrategy — значение dns.strategy sing-box для режима.
+// Для dual-stack стратегия не задаётся: sing-box возвращает ответы как есть.
+func (m IPv6Mode) dnsStrategy() string {
+	switch NormalizeIPv6Mode(m) {
+	case IPv6ModePreferIPv4:
+		return "prefer_ipv4"
+	case IPv6ModeDualStack:
+		return ""
+	}
+	return "ipv4_only"
+}
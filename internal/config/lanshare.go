@@ -0,0 +1,181 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"proxyclient/internal/dpapi"
+)
+
+// LANInboundTag — тег inbound'а раздачи в локальную сеть. По нему route
+// выделяет трафик клиентов LAN, а /api/lan/clients — их соединения.
+const LANInboundTag = "lan-in"
+
+// DefaultLANSharePort — порт раздачи, если lan_share_port не задан.
+const DefaultLANSharePort = 10808
+
+// LANUser — учётная запись клиента LAN: HTTP Basic и SOCKS5 username/password.
+type LANUser struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LANPolicy — маршрутизация соединений, пришедших из локальной сети.
+type LANPolicy string
+
+const (
+	// LANPolicyRules — те же правила, что и для трафика этого компьютера.
+	// Пустое значение означает то же самое.
+	LANPolicyRules LANPolicy = "rules"
+	// LANPolicyProxy — весь трафик клиентов LAN через прокси: ни direct, ни
+	// block-правила к нему не применяются, выхода в интернет с адреса этого
+	// компьютера у клиентов нет.
+	LANPolicyProxy LANPolicy = "proxy"
+)
+
+// IsValidLANPolicy — одно из значений LANPolicy или пустая строка.
+func IsValidLANPolicy(policy LANPolicy) bool {
+	switch policy {
+	case "", LANPolicyRules, LANPolicyProxy:
+		return true
+	}
+	return false
+}
+
+// NormalizeLANAllowCIDR приводит адрес или подсеть к каноническому CIDR:
+// одиночный IP становится /32 или /128.
+func NormalizeLANAllowCIDR(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if p, err := netip.ParsePrefix(value); err == nil {
+		return p.Masked().String(), true
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()).String(), true
+}
+
+// ValidLANUsername — имя без ':' (разделитель в HTTP Basic) и не длиннее
+// 255 байт (предел SOCKS5).
+func ValidLANUsername(name string) bool {
+	return name != "" && len(name) <= 255 && !strings.Contains(name, ":")
+}
+
+// protectLANUsers — копия users для routing.json: пароли зашифрованы DPAPI
+// и хранятся как в secret.key, "DPAPI:" + base64.
+func protectLANUsers(users []LANUser) ([]LANUser, error) {
+	if len(users) == 0 {
+		return users, nil
+	}
+	out := make([]LANUser, len(users))
+	for i, u := range users {
+		if u.Password != "" {
+			enc, err := dpapi.Encrypt([]byte(u.Password))
+			if err != nil {
+				return nil, fmt.Errorf("пароль LAN %q: %w", u.Username, err)
+			}
+			u.Password = dpapiMagic + base64.StdEncoding.EncodeToString(enc)
+		}
+		out[i] = u
+	}
+	return out, nil
+}
+
+// unprotectLANUsers расшифровывает пароли, прочитанные из routing.json.
+// Пароль без префикса — файл старой версии, он зашифруется при следующем
+// сохранении.
+func unprotectLANUsers(users []LANUser) error {
+	for i, u := range users {
+		if !strings.HasPrefix(u.Password, dpapiMagic) {
+			continue
+		}
+		enc, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(u.Password, dpapiMagic))
+		if err != nil {
+			return fmt.Errorf("пароль LAN %q: %w", u.Username, err)
+		}
+		plain, err := dpapi.Decrypt(enc)
+		if err != nil {
+			return fmt.Errorf("пароль LAN %q: %w", u.Username, err)
+		}
+		users[i].Password = string(plain)
+	}
+	return nil
+}
+
+func sanitizeLANShare(cfg *RoutingConfig) {
+	if cfg.LANSharePort < 0 || cfg.LANSharePort > 65535 {
+		cfg.LANSharePort = 0
+	}
+	seen := map[string]bool{}
+	// Новые срезы, а не фильтрация на месте: cfg может делить их со снимком.
+	var cidrs []string
+	for _, v := range cfg.LANAllowCIDRs {
+		if cidr, ok := NormalizeLANAllowCIDR(v); ok && !seen[cidr] {
+			seen[cidr] = true
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	cfg.LANAllowCIDRs = cidrs
+	names := map[string]bool{}
+	var users []LANUser
+	for _, u := range cfg.LANUsers {
+		u.Username = strings.TrimSpace(u.Username)
+		if ValidLANUsername(u.Username) && len(u.Password) <= 255 && !names[u.Username] {
+			names[u.Username] = true
+			users = append(users, u)
+		}
+	}
+	cfg.LANUsers = users
+	// rules — значение по умолчанию, в routing.json его не пишем.
+	if !IsValidLANPolicy(cfg.LANPolicy) || cfg.LANPolicy == LANPolicyRules {
+		cfg.LANPolicy = ""
+	}
+}
+
+// buildLANInbound — mixed inbound (HTTP + SOCKS5) на всех интерфейсах.
+// Без пользователей вход открыт, ограничить его можно LANAllowCIDRs.
+func buildLANInbound(routingCfg *RoutingConfig) SBInbound {
+	port := routingCfg.LANSharePort
+	if port == 0 {
+		port = DefaultLANSharePort
+	}
+	in := SBInbound{
+		Type:       "mixed",
+		Tag:        LANInboundTag,
+		Listen:     "0.0.0.0",
+		ListenPort: port,
+	}
+	for _, u := range routingCfg.LANUsers {
+		in.Users = append(in.Users, SBInboundUser{Username: u.Username, Password: u.Password})
+	}
+	return in
+}
+
+// lanRouteRules — правила для клиентов LAN, стоят раньше всех остальных:
+// соединения с адресов вне LANAllowCIDRs отклоняются, а при LANPolicyProxy
+// оставшиеся сразу уходят в proxyFinal, минуя direct для локальных сетей.
+func lanRouteRules(routingCfg *RoutingConfig, proxyFinal string) []SBRouteRule {
+	if !routingCfg.LANShareEnabled {
+		return nil
+	}
+	var rules []SBRouteRule
+	if len(routingCfg.LANAllowCIDRs) > 0 {
+		rules = append(rules, SBRouteRule{
+			Type: "logical",
+			Mode: "and",
+			Rules: []SBRouteRule{
+				{Inbound: []string{LANInboundTag}},
+				{SourceIPCIDR: routingCfg.LANAllowCIDRs, Invert: true},
+			},
+			Action: "reject",
+		})
+	}
+	if routingCfg.LANPolicy == LANPolicyProxy {
+		rules = append(rules, SBRouteRule{Inbound: []string{LANInboundTag}, Outbound: proxyFinal})
+	}
+	return rules
+}
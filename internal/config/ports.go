@@ -2,13 +2,18 @@ package config
 
 // Адреса и порты всех компонентов приложения.
 //
-// Все три порта определены здесь — единственное место для изменения.
+// Все порты определены здесь — единственное место для изменения.
 // Менять в одном месте: при конфликте порта достаточно обновить одну константу.
 const (
 	// ProxyPort — HTTP inbound порт sing-box. Системный прокси Windows указывает сюда.
 	ProxyPort = 10807
 	// ProxyAddr — полный адрес HTTP inbound sing-box.
 	ProxyAddr = "127.0.0.1:10807"
+	// MixedPort — mixed (HTTP + SOCKS5) inbound sing-box в режиме без TUN:
+	// для приложений, которым нужен SOCKS5 или UDP.
+	MixedPort = 10809
+	// MixedAddr — полный адрес mixed inbound sing-box.
+	MixedAddr = "127.0.0.1:10809"
 
 	// ClashAPIPort — порт Clash-совместимого API sing-box (статистика, соединения).
 	ClashAPIPort = 9090
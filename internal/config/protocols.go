@@ -52,6 +52,8 @@ func ParseServerContent(content string) (*ParsedServer, error) {
 		return parseWireGuardURL(content)
 	case strings.HasPrefix(content, "vmess://"):
 		return parseVMessURL(content)
+	case strings.HasPrefix(content, "{"):
+		return parseSingBoxOutbound(content)
 	case strings.Contains(content, "[Interface]") && strings.Contains(content, "[Peer]"):
 		return parseWireGuardConf(content)
 	default:
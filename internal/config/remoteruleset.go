@@ -0,0 +1,322 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"proxyclient/internal/fileutil"
+	"proxyclient/internal/srs"
+)
+
+// Форматы удалённого rule-set'а — те же, что у sing-box.
+const (
+	RuleSetFormatBinary = "binary" // скомпилированный .srs
+	RuleSetFormatSource = "source" // JSON {"version": N, "rules": [...]}
+)
+
+// Через что скачивать удалённый rule-set.
+const (
+	RuleSetDetourProxy  = "proxy"
+	RuleSetDetourDirect = "direct"
+)
+
+// DefaultRuleSetUpdateHours — интервал обновления, если он не задан.
+const DefaultRuleSetUpdateHours = 24
+
+// remoteRuleSetTagPrefix — префикс тега в route.rule_set; у geosite — "geosite-".
+const remoteRuleSetTagPrefix = "ruleset-"
+
+// RuleSetsDir — кэш скачанных rule-set'ов: последняя удачная копия и её метаданные.
+var RuleSetsDir = filepath.Join(DataDir, "rulesets")
+
+// RemoteRuleSet — rule-set, который скачивается по URL и периодически обновляется.
+// Правила маршрутизации ссылаются на него значением "ruleset:<tag>".
+// sing-box получает только локальную копию: его собственная загрузка remote
+// rule-set'ов при старте блокировала бы запуск, если URL недоступен.
+type RemoteRuleSet struct {
+	// Tag — имя rule-set'а: a-z, 0-9, '-' и '_'.
+	Tag string `json:"tag"`
+	URL string `json:"url"`
+	// Format — RuleSetFormatBinary или RuleSetFormatSource. Пусто — по расширению URL.
+	Format string `json:"format"`
+	// UpdateIntervalHours — как часто перекачивать. 0 — DefaultRuleSetUpdateHours.
+	UpdateIntervalHours int `json:"update_interval_hours,omitempty"`
+	// DownloadDetour — RuleSetDetourProxy (по умолчанию) или RuleSetDetourDirect.
+	DownloadDetour string `json:"download_detour,omitempty"`
+}
+
+// RemoteRuleSetMeta — состояние закэшированной копии rule-set'а.
+type RemoteRuleSetMeta struct {
+	// URL и Format — откуда и в каком формате скачана копия. Копия с другим
+	// URL принадлежит другому списку и в конфиг не попадает.
+	URL    string `json:"url"`
+	Format string `json:"format"`
+	// SHA256 — контрольная сумма копии на момент записи.
+	SHA256    string    `json:"sha256,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CheckedAt time.Time `json:"checked_at"`
+	// LastError — ошибка последней попытки; последняя удачная копия при этом остаётся.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// UpdateInterval возвращает интервал обновления с учётом значения по умолчанию.
+func (rs RemoteRuleSet) UpdateInterval() time.Duration {
+	hours := rs.UpdateIntervalHours
+	if hours <= 0 {
+		hours = DefaultRuleSetUpdateHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// IsValidRuleSetTag проверяет тег: он попадает в имя файла кэша и в URL API,
+// поэтому ограничения те же, что у ID группы.
+func IsValidRuleSetTag(tag string) bool {
+	return IsValidGroupID(tag)
+}
+
+// ValidateRemoteRuleSet проверяет rule-set перед сохранением в routing.json.
+func ValidateRemoteRuleSet(rs RemoteRuleSet) error {
+	if !IsValidRuleSetTag(rs.Tag) {
+		return fmt.Errorf("tag %q: только a-z, 0-9, '-' и '_'", rs.Tag)
+	}
+	u, err := url.Parse(rs.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("rule-set %s: нужен http(s) URL", rs.Tag)
+	}
+	switch rs.Format {
+	case "", RuleSetFormatBinary, RuleSetFormatSource:
+	default:
+		return fmt.Errorf("rule-set %s: format: binary | source", rs.Tag)
+	}
+	switch rs.DownloadDetour {
+	case "", RuleSetDetourProxy, RuleSetDetourDirect:
+	default:
+		return fmt.Errorf("rule-set %s: download_detour: proxy | direct", rs.Tag)
+	}
+	if rs.UpdateIntervalHours < 0 {
+		return fmt.Errorf("rule-set %s: отрицательный интервал обновления", rs.Tag)
+	}
+	return nil
+}
+
+// NormalizeRemoteRuleSet заполняет формат и detour по умолчанию.
+// Формат без явного указания определяется по расширению URL: .json — source.
+func NormalizeRemoteRuleSet(rs RemoteRuleSet) RemoteRuleSet {
+	rs.Tag = strings.TrimSpace(rs.Tag)
+	rs.URL = strings.TrimSpace(rs.URL)
+	if rs.Format == "" {
+		rs.Format = RuleSetFormatBinary
+		if u, err := url.Parse(rs.URL); err == nil && strings.HasSuffix(strings.ToLower(u.Path), ".json") {
+			rs.Format = RuleSetFormatSource
+		}
+	}
+	if rs.DownloadDetour == "" {
+		rs.DownloadDetour = RuleSetDetourProxy
+	}
+	if rs.UpdateIntervalHours < 0 {
+		rs.UpdateIntervalHours = 0
+	}
+	return rs
+}
+
+// sanitizeRemoteRuleSets отбрасывает невалидные rule-set'ы и повторяющиеся теги.
+func sanitizeRemoteRuleSets(sets []RemoteRuleSet) []RemoteRuleSet {
+	if len(sets) == 0 {
+		return nil
+	}
+	out := make([]RemoteRuleSet, 0, len(sets))
+	seen := map[string]bool{}
+	for _, rs := range sets {
+		rs = NormalizeRemoteRuleSet(rs)
+		if ValidateRemoteRuleSet(rs) != nil || seen[rs.Tag] {
+			continue
+		}
+		seen[rs.Tag] = true
+		out = append(out, rs)
+	}
+	return out
+}
+
+// FindRuleSet ищет удалённый rule-set по тегу.
+func (cfg *RoutingConfig) FindRuleSet(tag string) (RemoteRuleSet, bool) {
+	if cfg == nil {
+		return RemoteRuleSet{}, false
+	}
+	for _, rs := range cfg.RuleSets {
+		if rs.Tag == tag {
+			return rs, true
+		}
+	}
+	return RemoteRuleSet{}, false
+}
+
+// RemoteRuleSetPath — путь к закэшированной копии.
+func RemoteRuleSetPath(rs RemoteRuleSet) string {
+	ext := ".srs"
+	if rs.Format == RuleSetFormatSource {
+		ext = ".json"
+	}
+	return filepath.Join(RuleSetsDir, rs.Tag+ext)
+}
+
+func remoteRuleSetMetaPath(tag string) string {
+	return filepath.Join(RuleSetsDir, tag+".meta.json")
+}
+
+// LoadRemoteRuleSetMeta читает метаданные копии. Нет файла — нулевая структура.
+func LoadRemoteRuleSetMeta(tag string) RemoteRuleSetMeta {
+	var m RemoteRuleSetMeta
+	data, err := os.ReadFile(remoteRuleSetMetaPath(tag))
+	if err == nil {
+		_ = json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+func saveRemoteRuleSetMeta(tag string, m RemoteRuleSetMeta) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(remoteRuleSetMetaPath(tag), data, 0644)
+}
+
+// ValidateRuleSetData проверяет, что sing-box примет содержимое rule-set'а:
+// binary разбирается целиком (вместе с контрольной суммой zlib), у source
+// проверяется структура JSON.
+func ValidateRuleSetData(format string, data []byte) error {
+	if format == RuleSetFormatSource {
+		var src struct {
+			Version int               `json:"version"`
+			Rules   []json.RawMessage `json:"rules"`
+		}
+		if err := json.Unmarshal(data, &src); err != nil {
+			return fmt.Errorf("неверный JSON rule-set: %w", err)
+		}
+		if src.Version < 1 || src.Version > srs.MaxVersion {
+			return fmt.Errorf("неподдерживаемая версия rule-set %d", src.Version)
+		}
+		if src.Rules == nil {
+			return errors.New("в rule-set нет поля rules")
+		}
+		for i, raw := range src.Rules {
+			if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+				return fmt.Errorf("правило %d: ожидался объект", i+1)
+			}
+		}
+		return nil
+	}
+	_, err := srs.Read(bytes.NewReader(data))
+	return err
+}
+
+// StoreRemoteRuleSet проверяет скачанные данные и атомарно заменяет ими копию.
+// Невалидные данные не записываются: остаётся последняя удачная копия,
+// а ошибка попадает в метаданные.
+func StoreRemoteRuleSet(rs RemoteRuleSet, data []byte) error {
+	if err := ValidateRuleSetData(rs.Format, data); err != nil {
+		err = fmt.Errorf("rule-set %s: %w", rs.Tag, err)
+		RecordRemoteRuleSetError(rs, err)
+		return err
+	}
+	if err := os.MkdirAll(RuleSetsDir, 0755); err != nil {
+		return err
+	}
+	if err := fileutil.WriteAtomic(RemoteRuleSetPath(rs), data, 0644); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	now := time.Now()
+	return saveRemoteRuleSetMeta(rs.Tag, RemoteRuleSetMeta{
+		URL:       rs.URL,
+		Format:    rs.Format,
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      int64(len(data)),
+		UpdatedAt: now,
+		CheckedAt: now,
+	})
+}
+
+// RecordRemoteRuleSetError запоминает неудачную попытку обновления.
+// Если копия скачана с другого URL или в другом формате, она сбрасывается:
+// для нового списка она не «последняя удачная».
+func RecordRemoteRuleSetError(rs RemoteRuleSet, cause error) {
+	if err := os.MkdirAll(RuleSetsDir, 0755); err != nil {
+		return
+	}
+	m := LoadRemoteRuleSetMeta(rs.Tag)
+	if m.URL != rs.URL || m.Format != rs.Format {
+		m = RemoteRuleSetMeta{URL: rs.URL, Format: rs.Format}
+	}
+	m.CheckedAt = time.Now()
+	m.LastError = cause.Error()
+	_ = saveRemoteRuleSetMeta(rs.Tag, m)
+}
+
+// RemoteRuleSetUsable сообщает, можно ли отдать копию sing-box: она скачана
+// с текущего URL, в текущем формате и не изменилась с момента записи.
+func RemoteRuleSetUsable(rs RemoteRuleSet) bool {
+	m := LoadRemoteRuleSetMeta(rs.Tag)
+	if m.SHA256 == "" || m.URL != rs.URL || m.Format != rs.Format {
+		return false
+	}
+	data, err := os.ReadFile(RemoteRuleSetPath(rs))
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) == m.SHA256
+}
+
+// RemoveRemoteRuleSetCache удаляет копии во всех форматах и метаданные.
+func RemoveRemoteRuleSetCache(tag string) {
+	for _, format := range []string{RuleSetFormatBinary, RuleSetFormatSource} {
+		_ = os.Remove(RemoteRuleSetPath(RemoteRuleSet{Tag: tag, Format: format}))
+	}
+	_ = os.Remove(remoteRuleSetMetaPath(tag))
+}
+
+// ruleSetTag превращает значение geosite/geoip/ruleset-правила в тег route.rule_set.
+func ruleSetTag(value string) string {
+	if name, ok := strings.CutPrefix(value, "ruleset:"); ok {
+		return remoteRuleSetTagPrefix + name
+	}
+	if code, ok := strings.CutPrefix(value, "geoip:"); ok {
+		return "geoip-" + code
+	}
+	return "geosite-" + strings.TrimPrefix(value, "geosite:")
+}
+
+// localRuleSet описывает локальный файл rule-set'а с тегом tag: geosite и geoip лежат
+// в data/, удалённые rule-set'ы — в RuleSetsDir.
+func localRuleSet(routingCfg *RoutingConfig, tag string) SBRuleSet {
+	if name, ok := strings.CutPrefix(tag, remoteRuleSetTagPrefix); ok {
+		rs, found := routingCfg.FindRuleSet(name)
+		if !found {
+			// Правило ссылается на необъявленный rule-set — файла нет,
+			// GenerateSingBoxConfig выбросит его вместе с правилом.
+			rs = RemoteRuleSet{Tag: name, Format: RuleSetFormatBinary}
+		}
+		return SBRuleSet{Type: "local", Tag: tag, Format: rs.Format, Path: RemoteRuleSetPath(rs)}
+	}
+	return SBRuleSet{Type: "local", Tag: tag, Format: "binary", Path: DataDir + "/" + tag + ".bin"}
+}
+
+// ruleSetFileUsable проверяет файл rule-set'а перед записью в конфиг sing-box.
+func ruleSetFileUsable(routingCfg *RoutingConfig, rs SBRuleSet) bool {
+	if name, ok := strings.CutPrefix(rs.Tag, remoteRuleSetTagPrefix); ok {
+		remote, found := routingCfg.FindRuleSet(name)
+		return found && RemoteRuleSetUsable(remote)
+	}
+	return IsSingBoxRuleSetFile(rs.Path)
+}
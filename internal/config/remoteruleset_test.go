@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// emptySRS — минимальный валидный binary rule-set без правил.
+func emptySRS(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("SRS\x01")
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write([]byte{0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStoreRemoteRuleSet_KeepsLastGoodCopy(t *testing.T) {
+	t.Chdir(t.TempDir())
+	rs := NormalizeRemoteRuleSet(RemoteRuleSet{Tag: "ads", URL: "https://example.com/ads.srs"})
+	if rs.Format != RuleSetFormatBinary || rs.DownloadDetour != RuleSetDetourProxy {
+		t.Fatalf("defaults = %+v", rs)
+	}
+	good := emptySRS(t)
+	if err := StoreRemoteRuleSet(rs, good); err != nil {
+		t.Fatalf("StoreRemoteRuleSet: %v", err)
+	}
+	if !RemoteRuleSetUsable(rs) {
+		t.Fatal("valid copy must be usable")
+	}
+
+	// Обрезанный файл: заголовок верный, zlib-поток сломан.
+	if err := StoreRemoteRuleSet(rs, good[:len(good)-2]); err == nil {
+		t.Fatal("truncated rule-set must be rejected")
+	}
+	if data, _ := os.ReadFile(RemoteRuleSetPath(rs)); !bytes.Equal(data, good) {
+		t.Error("last good copy was overwritten")
+	}
+	if m := LoadRemoteRuleSetMeta("ads"); m.LastError == "" || !RemoteRuleSetUsable(rs) {
+		t.Errorf("meta after failed update = %+v", m)
+	}
+
+	// Копия, изменённая на диске в обход StoreRemoteRuleSet, не проходит проверку.
+	mustWriteFile(t, RemoteRuleSetPath(rs), emptySRS(t)[:6])
+	if RemoteRuleSetUsable(rs) {
+		t.Error("tampered copy must not be usable")
+	}
+
+	// Смена URL: старая копия принадлежит другому списку.
+	mustWriteFile(t, RemoteRuleSetPath(rs), good)
+	moved := rs
+	moved.URL = "https://mirror.example/ads.srs"
+	if RemoteRuleSetUsable(moved) {
+		t.Error("copy from another URL must not be usable")
+	}
+	RecordRemoteRuleSetError(moved, errors.New("timeout"))
+	if RemoteRuleSetUsable(rs) {
+		t.Error("failed download from the new URL must reset the old copy")
+	}
+}
+
+func TestValidateRuleSetData_Source(t *testing.T) {
+	cases := map[string]bool{
+		`{"version":2,"rules":[{"domain_suffix":["example.com"]}]}`: true,
+		`{"version":2,"rules":[]}`:                                  true,
+		`{"version":9,"rules":[]}`:                                  false,
+		`{"version":2}`:                                             false,
+		`{"version":2,"rules":["example.com"]}`:                     false,
+		`<html>blocked</html>`:                                      false,
+	}
+	for data, ok := range cases {
+		if err := ValidateRuleSetData(RuleSetFormatSource, []byte(data)); (err == nil) != ok {
+			t.Errorf("ValidateRuleSetData(%s) = %v, want ok=%v", data, err, ok)
+		}
+	}
+}
+
+func TestSanitizeRoutingConfig_RemoteRuleSets(t *testing.T) {
+	cfg := &RoutingConfig{
+		Rules: []RoutingRule{{Value: " RuleSet:Ads ", Action: ActionBlock}},
+		RuleSets: []RemoteRuleSet{
+			{Tag: "ads", URL: "https://example.com/ads.json"},
+			{Tag: "ads", URL: "https://example.com/dup.srs"},
+			{Tag: "Bad!", URL: "https://example.com/x.srs"},
+			{Tag: "ftp", URL: "ftp://example.com/x.srs"},
+		},
+	}
+	SanitizeRoutingConfig(cfg)
+	if r := cfg.Rules[0]; r.Value != "ruleset:ads" || r.Type != RuleTypeRuleSet {
+		t.Errorf("rule = %+v", r)
+	}
+	if len(cfg.RuleSets) != 1 || cfg.RuleSets[0].Format != RuleSetFormatSource {
+		t.Errorf("rule_sets = %+v", cfg.RuleSets)
+	}
+}
+
+func TestGenerateSingBoxConfig_RemoteRuleSets(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret.key")
+	mustWriteFile(t, secretPath, []byte(
+		"vless://12345678-1234-1234-1234-123456789abc@example.com:443?sni=www.google.com&pbk=testkey&sid=abc",
+	))
+	t.Chdir(dir)
+
+	ads := NormalizeRemoteRuleSet(RemoteRuleSet{Tag: "ads", URL: "https://example.com/ads.srs"})
+	streaming := NormalizeRemoteRuleSet(RemoteRuleSet{Tag: "streaming", URL: "https://example.com/streaming.json"})
+	pending := NormalizeRemoteRuleSet(RemoteRuleSet{Tag: "pending", URL: "https://example.com/pending.srs"})
+	if err := StoreRemoteRuleSet(ads, emptySRS(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := StoreRemoteRuleSet(streaming, []byte(`{"version":2,"rules":[{"domain_suffix":["netflix.com"]}]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &RoutingConfig{
+		DefaultAction: ActionDirect,
+		RuleSets:      []RemoteRuleSet{ads, streaming, pending},
+		Rules: []RoutingRule{
+			{Value: "ruleset:ads", Type: RuleTypeRuleSet, Action: ActionBlock},
+			{Value: "ruleset:streaming", Type: RuleTypeRuleSet, Action: ActionProxy},
+			{Value: "ruleset:pending", Type: RuleTypeRuleSet, Action: ActionProxy},
+			{Value: "ruleset:undeclared", Type: RuleTypeRuleSet, Action: ActionDirect},
+		},
+	}
+	outputPath := filepath.Join(dir, "out.json")
+	if err := GenerateSingBoxConfig(secretPath, outputPath, cfg); err != nil {
+		t.Fatalf("GenerateSingBoxConfig: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out SingBoxConfig
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	sets := map[string]SBRuleSet{}
+	for _, rs := range out.Route.RuleSet {
+		sets[rs.Tag] = rs
+	}
+	if len(sets) != 2 {
+		t.Fatalf("route.rule_set = %+v, want only cached copies", out.Route.RuleSet)
+	}
+	if rs := sets["ruleset-streaming"]; rs.Format != RuleSetFormatSource || rs.Path != RemoteRuleSetPath(streaming) {
+		t.Errorf("streaming = %+v", rs)
+	}
+	var blocked, proxied []string
+	for _, r := range out.Route.Rules {
+		switch {
+		case r.Action == "reject" && len(r.RuleSet) > 0:
+			blocked = append(blocked, r.RuleSet...)
+		case r.Outbound == "proxy-out":
+			proxied = append(proxied, r.RuleSet...)
+		case len(r.RuleSet) > 0:
+			t.Errorf("unexpected rule %+v", r)
+		}
+	}
+	if !slices.Equal(blocked, []string{"ruleset-ads"}) || !slices.Equal(proxied, []string{"ruleset-streaming"}) {
+		t.Errorf("blocked = %v, proxied = %v", blocked, proxied)
+	}
+}
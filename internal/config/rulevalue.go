@@ -0,0 +1,86 @@
+package config
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// typedRulePrefixes — префиксы типов, у которых значение после ":" имеет свой
+// синтаксис и проверяется normalizeTypedRuleValue.
+var typedRulePrefixes = map[string]bool{
+	string(RuleTypeKeyword): true,
+	string(RuleTypeRegex):   true,
+	string(RuleTypePort):    true,
+	string(RuleTypeNetwork): true,
+}
+
+// normalizeTypedRuleValue приводит значение с префиксом kind к каноническому
+// виду. Невалидное значение — пустая строка: такое правило API отклоняет.
+func normalizeTypedRuleValue(kind, rest string) string {
+	switch RuleType(kind) {
+	case RuleTypeKeyword:
+		if rest == "" {
+			return ""
+		}
+		return kind + ":" + strings.ToLower(rest)
+	case RuleTypeRegex:
+		if rest == "" {
+			return ""
+		}
+		if _, err := regexp.Compile(rest); err != nil {
+			return ""
+		}
+		return kind + ":" + rest
+	case RuleTypePort:
+		from, to, ok := ParsePortRule(kind + ":" + rest)
+		if !ok {
+			return ""
+		}
+		if from == to {
+			return kind + ":" + strconv.Itoa(int(from))
+		}
+		return kind + ":" + strconv.Itoa(int(from)) + "-" + strconv.Itoa(int(to))
+	case RuleTypeNetwork:
+		switch n := strings.ToLower(rest); n {
+		case "tcp", "udp":
+			return kind + ":" + n
+		}
+		return ""
+	}
+	return ""
+}
+
+// ParsePortRule разбирает "port:443" или "port:8000-9000" (допускается и
+// "8000:9000", как в sing-box). Для одиночного порта from == to.
+func ParsePortRule(value string) (from, to uint16, ok bool) {
+	rest, found := strings.CutPrefix(strings.ToLower(value), "port:")
+	if !found {
+		return 0, 0, false
+	}
+	lo, hi, isRange := strings.Cut(rest, "-")
+	if !isRange {
+		lo, hi, isRange = strings.Cut(rest, ":")
+	}
+	if !isRange {
+		hi = lo
+	}
+	a, errA := strconv.ParseUint(lo, 10, 16)
+	b, errB := strconv.ParseUint(hi, 10, 16)
+	if errA != nil || errB != nil || a == 0 || a > b {
+		return 0, 0, false
+	}
+	return uint16(a), uint16(b), true
+}
+
+// IsProcessRuleType — правило по процессу: по имени или по полному пути.
+func IsProcessRuleType(t RuleType) bool {
+	return t == RuleTypeProcess || t == RuleTypeProcessPath
+}
+
+// KeepsRuleValueCase сообщает, что значение правила хранится в исходном
+// регистре: имена и пути процессов на Windows и регулярные выражения.
+// Остальные значения приводятся к нижнему регистру.
+func KeepsRuleValueCase(t RuleType) bool {
+	return IsProcessRuleType(t) || t == RuleTypeRegex
+}
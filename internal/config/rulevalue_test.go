@@ -0,0 +1,115 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeRuleValue_TypedPrefixes(t *testing.T) {
+	cases := map[string]string{
+		"GeoIP:RU":                `geoip:ru`,
+		" keyword:CDN # реклама ": `keyword:cdn`,
+		`regex:^Ads?\d+\.`:        `regex:^Ads?\d+\.`,
+		"regex:(":                 "",
+		"port:443":                "port:443",
+		"PORT:08000:9000":         "port:8000-9000",
+		"port:9000-8000":          "",
+		"port:0":                  "",
+		"port:70000":              "",
+		"network:UDP":             "network:udp",
+		"network:icmp":            "",
+		"keyword:":                "",
+	}
+	for in, want := range cases {
+		if got := NormalizeRuleValue(in); got != want {
+			t.Errorf("NormalizeRuleValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDetectRuleType_RichTypes(t *testing.T) {
+	cases := map[string]RuleType{
+		"geoip:ru":                 RuleTypeGeoIP,
+		"keyword:cdn":              RuleTypeKeyword,
+		`regex:^ads?\d+\.`:         RuleTypeRegex,
+		"port:8000-9000":           RuleTypePort,
+		"network:udp":              RuleTypeNetwork,
+		"steam.exe":                RuleTypeProcess,
+		`C:\Games\Steam\steam.exe`: RuleTypeProcessPath,
+		"/opt/app/bin/app.exe":     RuleTypeProcessPath,
+		"keywordless.example.com":  RuleTypeDomain,
+		"[2001:db8::1]:443":        RuleTypeDomain,
+		"2001:db8::/32":            RuleTypeIP,
+		"geosite:category-ads-all": RuleTypeGeosite,
+		"ruleset:ads":              RuleTypeRuleSet,
+	}
+	for in, want := range cases {
+		if got := DetectRuleType(in); got != want {
+			t.Errorf("DetectRuleType(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSanitizeRoutingConfig_ProcessPath(t *testing.T) {
+	cfg := &RoutingConfig{Rules: []RoutingRule{
+		// Старое правило: полный путь под типом process никогда не совпадал.
+		{Value: `C:\Games\Steam\steam.exe`, Type: RuleTypeProcess, Action: ActionDirect},
+		{Value: "steam.exe", Type: RuleTypeProcessPath, Action: ActionDirect},
+	}}
+	SanitizeRoutingConfig(cfg)
+	if cfg.Rules[0].Type != RuleTypeProcessPath || cfg.Rules[1].Type != RuleTypeProcess {
+		t.Errorf("rules = %+v", cfg.Rules)
+	}
+}
+
+func TestBuildRoute_RichRuleTypesOrder(t *testing.T) {
+	cfg := &RoutingConfig{
+		DefaultAction: ActionProxy,
+		Rules: []RoutingRule{
+			{Value: "geoip:ru", Type: RuleTypeGeoIP, Action: ActionDirect},
+			{Value: "network:udp", Type: RuleTypeNetwork, Action: ActionDirect},
+			{Value: "port:27000-27100", Type: RuleTypePort, Action: ActionDirect},
+			{Value: "port:22", Type: RuleTypePort, Action: ActionDirect},
+			{Value: `C:\Games\Steam\steam.exe`, Type: RuleTypeProcessPath, Action: ActionDirect},
+			{Value: "steam.exe", Type: RuleTypeProcess, Action: ActionProxy},
+			{Value: `regex:^cdn\d+\.example\.org$`, Type: RuleTypeRegex, Action: ActionDirect},
+			{Value: "regex:(", Type: RuleTypeRegex, Action: ActionDirect},
+			{Value: "keyword:tracker", Type: RuleTypeKeyword, Action: ActionBlock},
+			{Value: "port:bad", Type: RuleTypePort, Action: ActionBlock},
+		},
+	}
+	route := buildRoute(cfg, "1.2.3.4")
+
+	index := func(match func(SBRouteRule) bool) int {
+		return slices.IndexFunc(route.Rules, match)
+	}
+	keyword := index(func(r SBRouteRule) bool {
+		return slices.Equal(r.DomainKeyword, []string{"tracker"}) && r.Action == "reject"
+	})
+	regex := index(func(r SBRouteRule) bool {
+		return slices.Equal(r.DomainRegex, []string{`^cdn\d+\.example\.org$`}) && r.Outbound == "direct"
+	})
+	procPath := index(func(r SBRouteRule) bool { return len(r.ProcessPath) == 1 && len(r.ProcessName) == 0 })
+	procName := index(func(r SBRouteRule) bool { return slices.Equal(r.ProcessName, []string{"steam.exe"}) })
+	ports := index(func(r SBRouteRule) bool {
+		return slices.Equal(r.Port, []uint16{22}) && slices.Equal(r.PortRange, []string{"27000:27100"}) && len(r.DomainSuffix) == 0
+	})
+	network := index(func(r SBRouteRule) bool { return r.Network == "udp" && r.Outbound == "direct" && len(r.Port) == 0 })
+	geoip := index(func(r SBRouteRule) bool { return slices.Equal(r.RuleSet, []string{"geoip-ru"}) })
+
+	for name, idx := range map[string]int{"keyword": keyword, "regex": regex, "process_path": procPath, "process_name": procName, "ports": ports, "network": network, "geoip": geoip} {
+		if idx < 0 {
+			t.Fatalf("%s rule not found in %+v", name, route.Rules)
+		}
+	}
+	if !(keyword < regex && regex < procPath && procPath < procName && procName < ports && ports < network && network < geoip) {
+		t.Errorf("order keyword=%d regex=%d process_path=%d process_name=%d ports=%d network=%d geoip=%d",
+			keyword, regex, procPath, procName, ports, network, geoip)
+	}
+	if !route.FindProcess {
+		t.Error("process_path rule must enable find_process")
+	}
+	if len(route.RuleSet) != 1 || route.RuleSet[0].Path != DataDir+"/geoip-ru.bin" {
+		t.Errorf("rule_set = %+v", route.RuleSet)
+	}
+}
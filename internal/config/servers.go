@@ -0,0 +1,194 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ServersFile — список сохранённых серверов (относительно рабочей директории, как secret.key).
+// Формат файла принадлежит пакету api; здесь читаются только поля, нужные для outbounds.
+const ServersFile = "servers.json"
+
+// serverOutboundPrefix — префикс тегов outbound'ов сохранённых серверов.
+// Основной сервер из secret.key по-прежнему называется "proxy-out".
+const serverOutboundPrefix = "server-"
+
+// SavedServer — минимальное представление записи servers.json.
+type SavedServer struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	SubscriptionID string `json:"subscription_id,omitempty"`
+	// Detour — ID сервера, через который набирается этот (цепочка прокси).
+	Detour  string `json:"detour,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// LoadSavedServers читает servers.json. Отсутствующий файл — пустой список, не ошибка.
+// Tombstone-записи подписок (Deleted) отфильтровываются.
+func LoadSavedServers(path string) ([]SavedServer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var list []SavedServer
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("servers.json: %w", err)
+	}
+	out := list[:0]
+	for _, s := range list {
+		if s.Deleted || strings.TrimSpace(s.ID) == "" {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// ServerOutboundTag возвращает тег outbound'а для сохранённого сервера с данным ID.
+func ServerOutboundTag(id string) string {
+	return serverOutboundPrefix + id
+}
+
+// referencedTargets возвращает ID серверов и групп, на которые ссылаются
+// proxy-правила и DefaultGroup, в порядке первого появления.
+func referencedTargets(cfg *RoutingConfig) (serverIDs, groupIDs []string) {
+	if cfg == nil {
+		return nil, nil
+	}
+	seenServer := map[string]bool{}
+	seenGroup := map[string]bool{}
+	addGroup := func(id string) {
+		if id != "" && !seenGroup[id] {
+			seenGroup[id] = true
+			groupIDs = append(groupIDs, id)
+		}
+	}
+	for _, rule := range cfg.Rules {
+		if rule.Action != ActionProxy {
+			continue
+		}
+		if rule.Group != "" {
+			addGroup(rule.Group)
+			continue
+		}
+		if rule.Server != "" && !seenServer[rule.Server] {
+			seenServer[rule.Server] = true
+			serverIDs = append(serverIDs, rule.Server)
+		}
+	}
+	if cfg.DefaultAction == ActionProxy {
+		addGroup(cfg.DefaultGroup)
+	}
+	addAppTarget := func(server, group string) {
+		addGroup(group)
+		if server != "" && !seenServer[server] {
+			seenServer[server] = true
+			serverIDs = append(serverIDs, server)
+		}
+	}
+	for _, in := range cfg.AppInbounds {
+		addAppTarget(in.Server, in.Group)
+	}
+	for _, p := range cfg.AppProcessRules {
+		addAppTarget(p.Server, p.Group)
+	}
+	return serverIDs, groupIDs
+}
+
+// buildServerOutbounds строит outbounds для перечисленных ID из списка серверов,
+// вместе с их detour-цепочками. Сервер, которого нет в списке, чей URL не парсится
+// или чья цепочка сломана, пропускается — правила на него откатываются на
+// proxy-out (см. resolveServerRules).
+func buildServerOutbounds(servers []SavedServer, ids []string) []SBOutbound {
+	byID := make(map[string]SavedServer, len(servers))
+	for _, s := range servers {
+		byID[s.ID] = s
+	}
+	var outs []SBOutbound
+	built := map[string]bool{}
+	for _, id := range ids {
+		s, ok := byID[id]
+		if !ok {
+			continue
+		}
+		chain, err := DetourChain(servers, id)
+		if err != nil {
+			continue
+		}
+		chainOuts, _, err := buildDetourOutbounds(append([]SavedServer{s}, chain...))
+		if err != nil {
+			continue
+		}
+		for _, ob := range chainOuts {
+			if !built[ob.Tag] {
+				built[ob.Tag] = true
+				outs = append(outs, ob)
+			}
+		}
+	}
+	return outs
+}
+
+// resolveServerRules возвращает копию cfg, в которой Server/Group очищены у правил,
+// ссылающихся на цель без outbound'а. Один удалённый сервер или пустая группа
+// не должны блокировать генерацию конфига — такие правила идут через proxy-out.
+func resolveServerRules(cfg *RoutingConfig, outbounds []SBOutbound) *RoutingConfig {
+	available := make(map[string]bool, len(outbounds))
+	for _, ob := range outbounds {
+		available[ob.Tag] = true
+	}
+	resolved := *cfg
+	resolved.Rules = append([]RoutingRule(nil), cfg.Rules...)
+	for i := range resolved.Rules {
+		rule := &resolved.Rules[i]
+		if rule.Group != "" && !available[GroupOutboundTag(rule.Group)] {
+			rule.Group = ""
+			rule.Server = ""
+		}
+		if rule.Server != "" && !available[ServerOutboundTag(rule.Server)] {
+			rule.Server = ""
+		}
+	}
+	if resolved.DefaultGroup != "" && !available[GroupOutboundTag(resolved.DefaultGroup)] {
+		resolved.DefaultGroup = ""
+	}
+	resolved.AppInbounds = append([]AppInbound(nil), cfg.AppInbounds...)
+	for i := range resolved.AppInbounds {
+		in := &resolved.AppInbounds[i]
+		if in.Group != "" && !available[GroupOutboundTag(in.Group)] {
+			in.Group = ""
+		}
+		if in.Server != "" && !available[ServerOutboundTag(in.Server)] {
+			in.Server = ""
+		}
+	}
+	resolved.AppProcessRules = append([]AppProcessRule(nil), cfg.AppProcessRules...)
+	for i := range resolved.AppProcessRules {
+		p := &resolved.AppProcessRules[i]
+		if p.Group != "" && !available[GroupOutboundTag(p.Group)] {
+			p.Group = ""
+		}
+		if p.Server != "" && !available[ServerOutboundTag(p.Server)] {
+			p.Server = ""
+		}
+	}
+	return &resolved
+}
+
+// ruleOutboundTag возвращает тег outbound'а proxy-правила: группа, сервер или proxy-out.
+func ruleOutboundTag(rule RoutingRule) string {
+	switch {
+	case rule.Group != "":
+		return GroupOutboundTag(rule.Group)
+	case rule.Server != "":
+		return ServerOutboundTag(rule.Server)
+	default:
+		return "proxy-out"
+	}
+}
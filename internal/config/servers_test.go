@@ -0,0 +1,130 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildRoute_ServerRuleUsesServerOutbound(t *testing.T) {
+	cfg := &RoutingConfig{
+		DefaultAction: ActionDirect,
+		Rules: []RoutingRule{
+			{Value: "netflix.com", Type: RuleTypeDomain, Action: ActionProxy, Server: "us-1"},
+			{Value: "youtube.com", Type: RuleTypeDomain, Action: ActionProxy},
+			{Value: "steam.exe", Type: RuleTypeProcess, Action: ActionProxy, Server: "us-1"},
+		},
+	}
+	route := buildRoute(cfg, "1.2.3.4")
+
+	serverDomIdx, proxyDomIdx, serverProcIdx := -1, -1, -1
+	for i, r := range route.Rules {
+		switch {
+		case r.Outbound == "server-us-1" && len(r.Domain) > 0 && r.Domain[0] == "netflix.com":
+			serverDomIdx = i
+		case r.Outbound == "proxy-out" && len(r.Domain) > 0 && r.Domain[0] == "youtube.com":
+			proxyDomIdx = i
+		case r.Outbound == "server-us-1" && len(r.ProcessName) > 0 && r.ProcessName[0] == "steam.exe":
+			serverProcIdx = i
+		}
+	}
+	if serverDomIdx < 0 || proxyDomIdx < 0 || serverProcIdx < 0 {
+		t.Fatalf("rules not split by server: %+v", route.Rules)
+	}
+	if serverDomIdx > proxyDomIdx {
+		t.Errorf("server rule index=%d must precede proxy-out rule index=%d", serverDomIdx, proxyDomIdx)
+	}
+	if !route.FindProcess {
+		t.Error("FindProcess must be enabled for server-targeted process rules")
+	}
+}
+
+func TestGenerateSingBoxConfig_ServerOutbounds(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret.key")
+	mustWriteFile(t, secretPath, []byte(
+		"vless://12345678-1234-1234-1234-123456789abc@example.com:443?sni=www.google.com&pbk=testkey&sid=abc",
+	))
+
+	old, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd: %v", err)
+	}
+	mustChdir(t, dir)
+	defer mustChdir(t, old)
+
+	mustWriteFile(t, ServersFile, []byte(`[
+		{"id":"us-1","name":"US","url":"trojan://pass@us.example.com:443?sni=us.example.com"},
+		{"id":"gone","name":"Gone","url":"trojan://pass@gone.example.com:443","deleted":true}
+	]`))
+
+	cfg := &RoutingConfig{
+		DefaultAction: ActionProxy,
+		Rules: []RoutingRule{
+			{Value: "netflix.com", Type: RuleTypeDomain, Action: ActionProxy, Server: "us-1"},
+			{Value: "hulu.com", Type: RuleTypeDomain, Action: ActionProxy, Server: "gone"},
+		},
+	}
+	outputPath := filepath.Join(dir, "out.json")
+	if err := GenerateSingBoxConfig(secretPath, outputPath, cfg); err != nil {
+		t.Fatalf("GenerateSingBoxConfig: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("ReadFile out.json: %v", err)
+	}
+	var out SingBoxConfig
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal out.json: %v", err)
+	}
+
+	var tags []string
+	for _, ob := range out.Outbounds {
+		tags = append(tags, ob.Tag)
+	}
+	want := []string{"proxy-out", "server-us-1", "direct", "block"}
+	if len(tags) != len(want) {
+		t.Fatalf("outbound tags = %v, want %v", tags, want)
+	}
+	for i := range want {
+		if tags[i] != want[i] {
+			t.Fatalf("outbound tags = %v, want %v", tags, want)
+		}
+	}
+	if out.Outbounds[1].Type != "trojan" || out.Outbounds[1].Server != "us.example.com" {
+		t.Errorf("server outbound = %+v", out.Outbounds[1])
+	}
+
+	// Правило на удалённый сервер откатывается на proxy-out, а не ломает конфиг.
+	for _, r := range out.Route.Rules {
+		for _, d := range r.Domain {
+			if d == "hulu.com" && r.Outbound != "proxy-out" {
+				t.Errorf("hulu.com outbound = %q, want proxy-out", r.Outbound)
+			}
+			if d == "netflix.com" && r.Outbound != "server-us-1" {
+				t.Errorf("netflix.com outbound = %q, want server-us-1", r.Outbound)
+			}
+		}
+	}
+	if cfg.Rules[1].Server != "gone" {
+		t.Error("GenerateSingBoxConfig must not mutate the caller's routing config")
+	}
+}
+
+func TestSanitizeRoutingConfig_DropsServerForNonProxy(t *testing.T) {
+	cfg := &RoutingConfig{
+		DefaultAction: ActionProxy,
+		Rules: []RoutingRule{
+			{Value: "example.com", Type: RuleTypeDomain, Action: ActionDirect, Server: "us-1"},
+			{Value: "netflix.com", Type: RuleTypeDomain, Action: ActionProxy, Server: " us-1 "},
+		},
+	}
+	SanitizeRoutingConfig(cfg)
+	if cfg.Rules[0].Server != "" {
+		t.Errorf("direct rule Server = %q, want empty", cfg.Rules[0].Server)
+	}
+	if cfg.Rules[1].Server != "us-1" {
+		t.Errorf("proxy rule Server = %q, want us-1", cfg.Rules[1].Server)
+	}
+}
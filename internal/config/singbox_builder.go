@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/netip"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -174,8 +177,9 @@ func buildTransport(params *VLESSParams) *SBTransport {
 }
 
 // buildDNSConfig создаёт DNS конфигурацию для sing-box на основе DNSConfig.
-// Если dnsCfg == nil, использует значения по умолчанию.
-func buildDNSConfig(dnsCfg *DNSConfig) SBDNS {
+// Если dnsCfg == nil, использует значения по умолчанию. fakeIP — результат
+// fakeIPActive для всего routing-конфига.
+func buildDNSConfig(dnsCfg *DNSConfig, fakeIP bool) SBDNS {
 	if dnsCfg == nil {
 		dnsCfg = DefaultDNSConfig()
 	}
@@ -189,8 +193,9 @@ func buildDNSConfig(dnsCfg *DNSConfig) SBDNS {
 	directServer, directPort, directType := parseDNSURLWithPort(dnsCfg.DirectDNS)
 
 	servers := []SBDNSServer{
-		// ipv4_only: не возвращать AAAA записи — IPv6 недоступен на большинстве машин — подключение к IPv6-адресам
-		// завершается "The requested address is not valid in its context".
+		// Strategy по умолчанию ipv4_only: не возвращать AAAA записи — IPv6 недоступен на большинстве машин —
+		// подключение к IPv6-адресам завершается "The requested address is not valid in its context".
+		// Режимы prefer-ipv4 и dual-stack переопределяют её в buildSingBoxConfig.
 		// Remote DNS идёт через прокси-туннель (detour: proxy-out).
 		// Это предотвращает DNS leak: DNS-запросы не видны провайдеру.
 		{Tag: "remote", Type: remoteType, Server: remoteServer, Path: remotePath, Detour: "proxy-out"},
@@ -207,13 +212,26 @@ func buildDNSConfig(dnsCfg *DNSConfig) SBDNS {
 			Detour: "proxy-out",
 		})
 	}
+	overrideServers, rules := buildDNSOverrides(dnsCfg)
+	servers = append(servers, overrideServers...)
+	rules = append(rules, SBDNSRule{Inbound: []string{"http-in"}, Server: "direct-dns"})
+	if fakeIP {
+		// FakeIP только для A-запросов из TUN: http-in получает домены от приложений
+		// сам. AAAA при ipv4_only пустые, а в режимах с IPv6 резолвятся обычным
+		// DNS. Исключения тоже резолвятся по-настоящему и должны стоять раньше
+		// fakeip-правила. Это LAN-имена, NTP и проверка подключения Windows —
+		// их резолвит direct-dns: удалённый DoH за прокси LAN-имён не знает.
+		servers = append(servers, SBDNSServer{Tag: fakeIPDNSTag, Type: "fakeip", Inet4Range: fakeIPRange(dnsCfg.FakeIP)})
+		rules = append(rules,
+			SBDNSRule{DomainSuffix: fakeIPExclude(dnsCfg.FakeIP), Server: "direct-dns"},
+			SBDNSRule{Inbound: []string{"tun-in"}, QueryType: []string{"A"}, Server: fakeIPDNSTag},
+		)
+	}
 	return SBDNS{
 		Strategy: "ipv4_only",
 		Servers:  servers,
-		Rules: []SBDNSRule{
-			{Inbound: []string{"http-in"}, Server: "direct-dns"},
-		},
-		Final: "remote",
+		Rules:    rules,
+		Final:    "remote",
 	}
 }
 
@@ -316,13 +334,16 @@ func buildSingBoxConfig(outbound SBOutbound, tunExcludeAddr string, routingCfg *
 			// При рестарте sing-box не делает холодные DNS запросы —
 			// отвечает из кэша пока резолвит в фоне. Ускоряет первые
 			// соединения после перезапуска на 50-200мс.
+			// StoreFakeIP сохраняет выданные фейковые адреса: после рестарта
+			// соединения приложений к ним восстанавливаются в домены.
 			CacheFile: &SBCacheFile{
-				Enabled: true,
-				Path:    DNSCacheFile,
-				CacheID: DNSCacheID,
+				Enabled:     true,
+				Path:        DNSCacheFile,
+				CacheID:     DNSCacheID,
+				StoreFakeIP: fakeIPActive(routingCfg),
 			},
 		},
-		DNS: buildDNSConfig(routingCfg.DNS),
+		DNS: buildDNSConfig(routingCfg.DNS, fakeIPActive(routingCfg)),
 		Inbounds: []SBInbound{
 			{
 				Type:       "http",
@@ -332,7 +353,6 @@ func buildSingBoxConfig(outbound SBOutbound, tunExcludeAddr string, routingCfg *
 				// sniff_override_destination намеренно не указан: поле удалено в sing-box 1.13.
 				// Action "sniff" в route rules теперь всегда переопределяет destination.
 			},
-			buildTUN(tunExcludeAddr),
 		},
 		Outbounds: []SBOutbound{
 			outbound,
@@ -344,17 +364,38 @@ func buildSingBoxConfig(outbound SBOutbound, tunExcludeAddr string, routingCfg *
 		},
 		Route: buildRoute(routingCfg, tunExcludeAddr),
 	}
-	if routingCfg.LANShareEnabled {
-		lanPort := routingCfg.LANSharePort
-		if lanPort == 0 {
-			lanPort = 10808
-		}
+	if routingCfg.ProxyOnly {
+		// Без TUN SOCKS5 и UDP доступны только через mixed inbound.
 		cfg.Inbounds = append(cfg.Inbounds, SBInbound{
-			Type:       "http",
-			Tag:        "http-lan",
-			Listen:     "0.0.0.0",
-			ListenPort: lanPort,
+			Type:       "mixed",
+			Tag:        "mixed-in",
+			Listen:     "127.0.0.1",
+			ListenPort: MixedPort,
 		})
+	} else {
+		cfg.Inbounds = append(cfg.Inbounds, buildTUN(tunExcludeAddr, routingCfg.IPv6Mode))
+	}
+	cfg.DNS.Strategy = routingCfg.IPv6Mode.dnsStrategy()
+	cfg.DNS.Rules = append(cfg.DNS.Rules, buildSplitDNSRules(routingCfg)...)
+	// geosite из DNS-переопределений может не встречаться в правилах маршрутизации —
+	// rule_set у sing-box общий для route и dns, объявляем недостающие.
+	declared := make(map[string]bool, len(cfg.Route.RuleSet))
+	for _, rs := range cfg.Route.RuleSet {
+		declared[rs.Tag] = true
+	}
+	for _, rule := range cfg.DNS.Rules {
+		for _, tag := range rule.RuleSet {
+			if !declared[tag] {
+				declared[tag] = true
+				cfg.Route.RuleSet = append(cfg.Route.RuleSet, localRuleSet(routingCfg, tag))
+			}
+		}
+	}
+	if routingCfg.LANShareEnabled {
+		cfg.Inbounds = append(cfg.Inbounds, buildLANInbound(routingCfg))
+	}
+	for _, in := range usableAppInbounds(routingCfg) {
+		cfg.Inbounds = append(cfg.Inbounds, SBInbound{Type: "http", Tag: in.Tag, Listen: "127.0.0.1", ListenPort: in.Port})
 	}
 	return cfg
 }
@@ -381,11 +422,74 @@ func GenerateSingBoxConfig(secretPath, outputPath string, routingCfg *RoutingCon
 	if err != nil {
 		return fmt.Errorf("ошибка парсинга ключа сервера: %w", err)
 	}
+	// Повреждённый app_rules.json не должен блокировать запуск: правила
+	// приложений и выделенные порты просто не появятся, а в лог уйдёт
+	// предупреждение.
+	if apps, procs, err := LoadAppRules(AppRulesFile); err != nil {
+		warnConfig("правила приложений из %s пропущены: %v", AppRulesFile, err)
+	} else if len(apps)+len(procs) > 0 {
+		withApps := *routingCfg
+		withApps.AppInbounds = apps
+		withApps.AppProcessRules = procs
+		routingCfg = &withApps
+	}
+	// servers.json нужен для detour-цепочки активного сервера и для правил
+	// с Server/Group. Ошибка чтения фатальна только во втором случае.
+	saved, savedErr := LoadSavedServers(ServersFile)
+
+	// Активный сервер с detour: proxy-out набирается через цепочку сохранённых
+	// серверов. Сломанная цепочка — ошибка: молча подключиться напрямую нельзя,
+	// exit-сервер может быть доступен только через relay.
+	var serverOutbounds []SBOutbound
+	dialAddr := server.Address
+	if savedErr == nil {
+		if active, ok := findSavedServerByURL(saved, content); ok && active.Detour != "" {
+			chain, err := DetourChain(saved, active.ID)
+			if err != nil {
+				return fmt.Errorf("сервер %q: %w", active.Name, err)
+			}
+			chainOuts, lastAddr, err := buildDetourOutbounds(chain)
+			if err != nil {
+				return fmt.Errorf("сервер %q: %w", active.Name, err)
+			}
+			server.Outbound.Detour = ServerOutboundTag(chain[0].ID)
+			serverOutbounds = chainOuts
+			// Напрямую sing-box подключается к последнему хопу — его и исключаем из TUN.
+			dialAddr = lastAddr
+		}
+	}
+
 	// Если адрес сервера — hostname (не IP), передаём пустую строку в buildSingBoxConfig.
 	// buildTUN и buildRoute пропустят exclude-запись: hostname/32 — невалидный CIDR,
 	// sing-box падает с "parse cidr: hostname/32: invalid CIDR address".
-	tunExclude := ipOrEmpty(server.Address)
+	tunExclude := ipOrEmpty(dialAddr)
+
+	// Правила с Server/Group маршрутизируются через outbounds сохранённых серверов и групп.
+	if serverIDs, groupIDs := referencedTargets(routingCfg); len(serverIDs)+len(groupIDs) > 0 {
+		if savedErr != nil {
+			return fmt.Errorf("не удалось прочитать список серверов: %w", savedErr)
+		}
+		built := make(map[string]bool, len(serverOutbounds))
+		for _, ob := range serverOutbounds {
+			built[ob.Tag] = true
+		}
+		for _, ob := range buildTargetOutbounds(saved, routingCfg) {
+			if !built[ob.Tag] {
+				built[ob.Tag] = true
+				serverOutbounds = append(serverOutbounds, ob)
+			}
+		}
+		routingCfg = resolveServerRules(routingCfg, serverOutbounds)
+	}
+
 	cfg := buildSingBoxConfig(server.Outbound, tunExclude, routingCfg)
+	if len(serverOutbounds) > 0 {
+		// Вставляем сразу после proxy-out: direct/block остаются в конце списка.
+		outs := make([]SBOutbound, 0, len(cfg.Outbounds)+len(serverOutbounds))
+		outs = append(outs, cfg.Outbounds[0])
+		outs = append(outs, serverOutbounds...)
+		cfg.Outbounds = append(outs, cfg.Outbounds[1:]...)
+	}
 
 	// BUG-2 FIX: вместо fatal error при отсутствии/повреждении geosite файла —
 	// пропускаем его и убираем ссылающиеся правила. Один плохой файл не должен
@@ -399,8 +503,9 @@ func GenerateSingBoxConfig(secretPath, outputPath string, routingCfg *RoutingCon
 			skippedTags[rs.Tag] = true
 			continue
 		}
-		if statErr != nil || !IsSingBoxRuleSetFile(rs.Path) {
-			// Файл повреждён или не является binary SRS — пропускаем.
+		if statErr != nil || !ruleSetFileUsable(routingCfg, rs) {
+			// Файл повреждён, не является binary SRS или копия удалённого
+			// rule-set'а не прошла проверку целостности — пропускаем.
 			skippedTags[rs.Tag] = true
 			continue
 		}
@@ -428,6 +533,25 @@ func GenerateSingBoxConfig(secretPath, outputPath string, routingCfg *RoutingCon
 			}
 		}
 		cfg.Route.Rules = validRouteRules
+
+		validDNSRules := cfg.DNS.Rules[:0]
+		for _, rule := range cfg.DNS.Rules {
+			if len(rule.RuleSet) == 0 {
+				validDNSRules = append(validDNSRules, rule)
+				continue
+			}
+			filteredRuleSets := rule.RuleSet[:0]
+			for _, tag := range rule.RuleSet {
+				if !skippedTags[tag] {
+					filteredRuleSets = append(filteredRuleSets, tag)
+				}
+			}
+			if len(filteredRuleSets) > 0 {
+				rule.RuleSet = filteredRuleSets
+				validDNSRules = append(validDNSRules, rule)
+			}
+		}
+		cfg.DNS.Rules = validDNSRules
 	}
 
 	data, err := json.MarshalIndent(cfg, "", "  ")
@@ -442,12 +566,18 @@ func GenerateSingBoxConfig(secretPath, outputPath string, routingCfg *RoutingCon
 	return nil
 }
 
-func buildTUN(serverAddr string) SBInbound {
+func buildTUN(serverAddr string, ipv6Mode IPv6Mode) SBInbound {
+	address := []string{"172.20.0.1/30"}
+	if ipv6Mode.IPv6Enabled() {
+		// Без IPv6-адреса на TUN auto_route не ставит маршрут ::/0 и IPv6
+		// уходит мимо туннеля через физический интерфейс.
+		address = append(address, tunIPv6Address)
+	}
 	return SBInbound{
 		Type:          "tun",
 		Tag:           "tun-in",
 		InterfaceName: TunInterfaceName,
-		Address:       []string{"172.20.0.1/30"},
+		Address:       address,
 		// MTU 1500 вместо 9000 (jumbo frames):
 		// Jumbo frames требуют поддержки по всей цепочке (TUN → VPN сервер).
 		// Большинство VPS и провайдеров не поддерживают jumbo frames на WAN.
@@ -477,6 +607,7 @@ func buildTUN(serverAddr string) SBInbound {
 		// физический интерфейс благодаря auto_detect_interface: true.
 		// Если serverAddr пустой (hostname, не IP) — exclude-запись не добавляем:
 		// hostname/32 — невалидный CIDR, sing-box упадёт с parse cidr error.
+		// IPv6-адрес сервера исключается как /128.
 		//
 		// 127.0.0.0/8 и ::1/128 исключаются на уровне ОС (не только route-правила):
 		// strict_route=true + WFP иногда перехватывает loopback трафик на Windows 11,
@@ -485,14 +616,23 @@ func buildTUN(serverAddr string) SBInbound {
 		// RouteExcludeAddress гарантирует что loopback никогда не попадёт в TUN pipe.
 		RouteExcludeAddress: func() []string {
 			exclude := []string{"127.0.0.0/8", "::1/128"}
-			if serverAddr != "" {
-				exclude = append(exclude, serverAddr+"/32")
+			if prefix := hostPrefix(serverAddr); prefix != "" {
+				exclude = append(exclude, prefix)
 			}
 			return exclude
 		}(),
 	}
 }
 
+// hostPrefix возвращает addr/32 для IPv4 и addr/128 для IPv6, "" — если addr не IP.
+func hostPrefix(addr string) string {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return ""
+	}
+	return netip.PrefixFrom(ip, ip.BitLen()).String()
+}
+
 // privateIPRanges — локальные и служебные диапазоны которые никогда не должны
 // проксироваться. Аналог bypass-list в Clash Verge, Hiddify, Mihomo Party.
 // Без этого: LAN-устройства недоступны, локальный DNS ломается.
@@ -542,6 +682,75 @@ var windowsTelemetryDomains = []string{
 	"telecommand.telemetry.microsoft.com",
 }
 
+// routeBucket собирает значения правил с одним действием и outbound: каждый
+// вид условий уходит в sing-box одним общим правилом.
+type routeBucket struct {
+	procs, procPaths         []string
+	dom, suf, keyword, regex []string
+	ip                       []string
+	ports                    []uint16
+	portRanges               []string
+	networks                 []string
+	sets                     []string
+}
+
+func (b *routeBucket) add(rule RoutingRule) {
+	val := rule.Value
+	switch rule.Type {
+	case RuleTypeProcess:
+		b.procs = append(b.procs, val)
+	case RuleTypeProcessPath:
+		b.procPaths = append(b.procPaths, val)
+	case RuleTypeIP:
+		b.ip = append(b.ip, val)
+	case RuleTypeDomain:
+		if strings.HasPrefix(val, ".") {
+			b.suf = append(b.suf, strings.TrimPrefix(val, "."))
+		} else {
+			// BUG FIX: ранее plain-домен (без точки) попадал ТОЛЬКО в Domain["twitch.tv"],
+			// что в sing-box матчит ТОЛЬКО точное совпадение.
+			// Субдомены ("gql.twitch.tv", "video-edge-47127a.twitch.tv" и др.) —
+			// не матчились → продолжали идти через прокси даже при правиле direct.
+			// Исправление: добавляем также в DomainSuffix — покрывает и сам домен,
+			// и все поддомены одновременно.
+			b.dom = append(b.dom, val)
+			b.suf = append(b.suf, val)
+		}
+	case RuleTypeKeyword:
+		if kw := strings.TrimPrefix(val, "keyword:"); kw != "" && kw != val {
+			b.keyword = append(b.keyword, kw)
+		}
+	case RuleTypeRegex:
+		// Невалидное выражение sing-box не запустит — такое правило пропускаем.
+		if re := strings.TrimPrefix(val, "regex:"); re != "" && re != val {
+			if _, err := regexp.Compile(re); err == nil {
+				b.regex = append(b.regex, re)
+			}
+		}
+	case RuleTypePort:
+		if from, to, ok := ParsePortRule(val); ok {
+			if from == to {
+				b.ports = append(b.ports, from)
+			} else {
+				b.portRanges = append(b.portRanges, fmt.Sprintf("%d:%d", from, to))
+			}
+		}
+	case RuleTypeNetwork:
+		network := strings.TrimPrefix(val, "network:")
+		if (network == "tcp" || network == "udp") && !slices.Contains(b.networks, network) {
+			b.networks = append(b.networks, network)
+		}
+	case RuleTypeGeosite, RuleTypeRuleSet, RuleTypeGeoIP:
+		// Удалённые rule-set'ы и geoip по смыслу те же geosite: широкие списки,
+		// которые проверяются после конкретных domain/IP/process правил.
+		b.sets = append(b.sets, ruleSetTag(val))
+	}
+}
+
+func (b *routeBucket) hasProcesses() bool {
+	return len(b.procs)+len(b.procPaths) > 0
+}
+
 func buildRoute(routingCfg *RoutingConfig, serverAddr string) SBRoute {
 	if routingCfg == nil {
 		routingCfg = DefaultRoutingConfig()
@@ -553,21 +762,34 @@ func buildRoute(routingCfg *RoutingConfig, serverAddr string) SBRoute {
 	// Если serverAddr пустой (hostname) — не добавляем "/32": невалидный CIDR.
 	directCIDR := make([]string, len(privateIPRanges), len(privateIPRanges)+1)
 	copy(directCIDR, privateIPRanges)
-	if serverAddr != "" {
-		directCIDR = append(directCIDR, serverAddr+"/32")
+	if prefix := hostPrefix(serverAddr); prefix != "" {
+		directCIDR = append(directCIDR, prefix)
 	}
 	rules := []SBRouteRule{
 		// Sniff: извлекаем domain из TLS SNI до применения routing rules.
 		// Необходим для корректного domain/geosite matching через TUN.
 		{Action: "sniff"},
 		{Protocol: "dns", Action: "hijack-dns"},
+	}
+	// proxyFinal — куда идёт трафик по умолчанию при DefaultAction == proxy.
+	proxyFinal := "proxy-out"
+	if routingCfg.DefaultGroup != "" {
+		proxyFinal = GroupOutboundTag(routingCfg.DefaultGroup)
+	}
+	// ACL и политика клиентов LAN — до direct для локальных адресов: при
+	// LANPolicyProxy клиенту не должен открываться даже доступ к сети этого компьютера.
+	rules = append(rules, lanRouteRules(routingCfg, proxyFinal)...)
+	rules = append(rules,
 		// Локальные адреса и IP прокси-сервера всегда напрямую — ПЕРВЫМ приоритетом.
 		// serverAddr исключён явно: TUN с auto_route перехватывает весь трафик включая
 		// собственные соединения sing-box к серверу → routing loop без этого правила.
 		// ПОРЯДОК ВАЖЕН: это правило должно быть раньше любых proxy-out правил,
 		// чтобы приватные IP (192.168.x.x, 10.x.x.x, 127.x.x.x) не попали в прокси.
-		{IPCIDR: directCIDR, Outbound: "direct"},
-	}
+		SBRouteRule{IPCIDR: directCIDR, Outbound: "direct"},
+	)
+	// Выделенные порты приложений: маршрут задан правилом приложения, общие
+	// правила к ним не применяются. Локальные адреса выше всё равно идут напрямую.
+	rules = append(rules, appRouteRules(routingCfg, proxyFinal)...)
 	rules = append(rules,
 		// Telegram часто обращается к DC по IP, а не по домену. Это правило должно
 		// быть до blanket IPv6 reject, иначе IPv6 Telegram DC будут отброшены.
@@ -589,19 +811,30 @@ func buildRoute(routingCfg *RoutingConfig, serverAddr string) SBRoute {
 			DomainSuffix: []string{"stun.l.google.com", "stun.cloudflare.com"},
 			Action:       "reject",
 		},
-		// IPv6 глобальный unicast: DNS strategy=ipv4_only предотвращает новые AAAA lookup,
-		// но приложения с hardcoded IPv6 адресами (Telegram DC: 2001:b28:f23d::/48 и др.)
-		// всё равно пытаются подключиться напрямую к IPv6 адресам.
-		// На машинах без IPv6 это приводит к flood ошибок в логах:
-		//   "The requested address is not valid in its context" каждые несколько секунд.
-		// Отклоняем все IPv6 глобальные unicast соединения принудительно:
-		//   - Приложения (Telegram, Firefox, Chrome) переключатся на IPv4
-		//   - IPv4 трафик нормально проходит через правила ниже
-		// Исключения уже обработаны правилом directCIDR выше:
-		//   ::1/128 (loopback), fc00::/7 (ULA), fe80::/10 (link-local) → direct
-		// ::/0 матчит всё оставшееся IPv6 (включая 2000::/3 global unicast).
-		SBRouteRule{IPCIDR: []string{"::/0"}, Action: "reject"},
 	)
+	if !routingCfg.IPv6Mode.IPv6Enabled() {
+		rules = append(rules,
+			// IPv6 глобальный unicast: DNS strategy=ipv4_only предотвращает новые AAAA lookup,
+			// но приложения с hardcoded IPv6 адресами (Telegram DC: 2001:b28:f23d::/48 и др.)
+			// всё равно пытаются подключиться напрямую к IPv6 адресам.
+			// На машинах без IPv6 это приводит к flood ошибок в логах:
+			//   "The requested address is not valid in its context" каждые несколько секунд.
+			// Отклоняем все IPv6 глобальные unicast соединения принудительно:
+			//   - Приложения (Telegram, Firefox, Chrome) переключатся на IPv4
+			//   - IPv4 трафик нормально проходит через правила ниже
+			// Исключения уже обработаны правилом directCIDR выше:
+			//   ::1/128 (loopback), fc00::/7 (ULA), fe80::/10 (link-local) → direct
+			// ::/0 матчит всё оставшееся IPv6 (включая 2000::/3 global unicast).
+			// В режимах prefer-ipv4 и dual-stack IPv6 идёт по общим правилам.
+			SBRouteRule{IPCIDR: []string{"::/0"}, Action: "reject"},
+		)
+	}
+	if fakeIPActive(routingCfg) {
+		// Соединения к фейковым адресам sing-box переводит обратно в домены ещё до
+		// правил. Сюда доходят только адреса, для которых домена нет (кэш потерян),
+		// — их нельзя отправлять ни в прокси, ни напрямую.
+		rules = append(rules, SBRouteRule{IPCIDR: []string{fakeIPRange(routingCfg.DNS.FakeIP)}, Action: "reject"})
+	}
 	if routingCfg.BlockTelemetry {
 		rules = append(rules, SBRouteRule{Domain: windowsTelemetryDomains, Action: "reject"})
 	}
@@ -609,7 +842,7 @@ func buildRoute(routingCfg *RoutingConfig, serverAddr string) SBRoute {
 	if routingCfg.BypassEnabled {
 		return SBRoute{
 			Rules:                 rules,
-			Final:                 "proxy-out",
+			Final:                 proxyFinal,
 			AutoDetectInterface:   true,
 			DefaultDomainResolver: "direct-dns",
 		}
@@ -638,73 +871,34 @@ func buildRoute(routingCfg *RoutingConfig, serverAddr string) SBRoute {
 		)
 	}
 
-	var proxyProcs, directProcs, blockProcs []string
-	var proxyDom, directDom, blockDom []string
-	var proxySuf, directSuf, blockSuf []string
-	var proxyIP, directIP, blockIP []string
-	var proxyGeosite, directGeosite, blockGeosite []string
+	block, direct, proxy := &routeBucket{}, &routeBucket{}, &routeBucket{}
+
+	// Proxy-правила с Server/Group идут в outbound сохранённого сервера или группы.
+	// Порядок тегов — порядок первого появления, чтобы конфиг был детерминированным.
+	var serverTags []string
+	serverBuckets := map[string]*routeBucket{}
+	bucketFor := func(tag string) *routeBucket {
+		b, ok := serverBuckets[tag]
+		if !ok {
+			b = &routeBucket{}
+			serverBuckets[tag] = b
+			serverTags = append(serverTags, tag)
+		}
+		return b
+	}
 
 	for _, rule := range routingCfg.Rules {
-		val := rule.Value
-		switch rule.Type {
-		case RuleTypeProcess:
-			switch rule.Action {
-			case ActionProxy:
-				proxyProcs = append(proxyProcs, val)
-			case ActionDirect:
-				directProcs = append(directProcs, val)
-			case ActionBlock:
-				blockProcs = append(blockProcs, val)
-			}
-		case RuleTypeIP:
-			switch rule.Action {
-			case ActionProxy:
-				proxyIP = append(proxyIP, val)
-			case ActionDirect:
-				directIP = append(directIP, val)
-			case ActionBlock:
-				blockIP = append(blockIP, val)
-			}
-		case RuleTypeDomain:
-			if strings.HasPrefix(val, ".") {
-				sfx := strings.TrimPrefix(val, ".")
-				switch rule.Action {
-				case ActionProxy:
-					proxySuf = append(proxySuf, sfx)
-				case ActionDirect:
-					directSuf = append(directSuf, sfx)
-				case ActionBlock:
-					blockSuf = append(blockSuf, sfx)
-				}
-			} else {
-				// BUG FIX: ранее plain-домен (без точки) попадал ТОЛЬКО в Domain["twitch.tv"],
-				// что в sing-box матчит ТОЛЬКО точное совпадение.
-				// Субдомены ("gql.twitch.tv", "video-edge-47127a.twitch.tv" и др.) —
-				// не матчились → продолжали идти через прокси даже при правиле direct.
-				// Исправление: добавляем также в DomainSuffix — покрывает и сам домен,
-				// и все поддомены одновременно.
-				switch rule.Action {
-				case ActionProxy:
-					proxyDom = append(proxyDom, val)
-					proxySuf = append(proxySuf, val)
-				case ActionDirect:
-					directDom = append(directDom, val)
-					directSuf = append(directSuf, val)
-				case ActionBlock:
-					blockDom = append(blockDom, val)
-					blockSuf = append(blockSuf, val)
-				}
-			}
-		case RuleTypeGeosite:
-			tag := strings.TrimPrefix(val, "geosite:")
-			switch rule.Action {
-			case ActionProxy:
-				proxyGeosite = append(proxyGeosite, "geosite-"+tag)
-			case ActionDirect:
-				directGeosite = append(directGeosite, "geosite-"+tag)
-			case ActionBlock:
-				blockGeosite = append(blockGeosite, "geosite-"+tag)
-			}
+		if (rule.Server != "" || rule.Group != "") && rule.Action == ActionProxy {
+			bucketFor(ruleOutboundTag(rule)).add(rule)
+			continue
+		}
+		switch rule.Action {
+		case ActionProxy:
+			proxy.add(rule)
+		case ActionDirect:
+			direct.add(rule)
+		case ActionBlock:
+			block.add(rule)
 		}
 	}
 
@@ -712,45 +906,76 @@ func buildRoute(routingCfg *RoutingConfig, serverAddr string) SBRoute {
 	// BUG FIX: append(proxyGeosite, directGeosite...) мутирует proxyGeosite
 	// если у слайса есть свободная ёмкость (cap > len) — данные для addRule портятся.
 	// Собираем allTags в отдельный слайс с явным cap чтобы избежать алиасинга.
-	allTags := make([]string, 0, len(proxyGeosite)+len(directGeosite)+len(blockGeosite))
-	allTags = append(allTags, proxyGeosite...)
-	allTags = append(allTags, directGeosite...)
-	allTags = append(allTags, blockGeosite...)
+	allTags := make([]string, 0, len(proxy.sets)+len(direct.sets)+len(block.sets))
+	allTags = append(allTags, proxy.sets...)
+	allTags = append(allTags, direct.sets...)
+	allTags = append(allTags, block.sets...)
+	for _, tag := range serverTags {
+		allTags = append(allTags, serverBuckets[tag].sets...)
+	}
 	seen := map[string]bool{}
 	for _, tag := range allTags {
 		if !seen[tag] {
 			seen[tag] = true
-			path := DataDir + "/" + tag + ".bin"
-			ruleSets = append(ruleSets, SBRuleSet{
-				Type:   "local",
-				Tag:    tag,
-				Format: "binary",
-				Path:   path,
-			})
+			ruleSets = append(ruleSets, localRuleSet(routingCfg, tag))
 		}
 	}
 
+	// target — заготовка правила: outbound, если он задан, иначе action.
+	target := func(out, action string) SBRouteRule {
+		if out != "" {
+			return SBRouteRule{Outbound: out}
+		}
+		return SBRouteRule{Action: action}
+	}
 	// addDomainRule добавляет одно правило только по домен/IP/суффикс критериям.
-	addDomainRule := func(out, action string, doms, sufs, ips []string) {
-		if len(doms)+len(sufs)+len(ips) == 0 {
+	addDomainRule := func(out, action string, b *routeBucket) {
+		if len(b.dom)+len(b.suf)+len(b.keyword)+len(b.regex)+len(b.ip) == 0 {
 			return
 		}
-		r := SBRouteRule{}
-		if out != "" {
-			r.Outbound = out
-		} else {
-			r.Action = action
+		r := target(out, action)
+		r.Domain = b.dom
+		r.DomainSuffix = b.suf
+		r.DomainKeyword = b.keyword
+		r.DomainRegex = b.regex
+		r.IPCIDR = b.ip
+		rules = append(rules, r)
+	}
+	// process_name и process_path sing-box проверяет через И — путь идёт
+	// отдельным правилом.
+	addProcessRules := func(out, action string, b *routeBucket) {
+		if len(b.procs) > 0 {
+			r := target(out, action)
+			r.ProcessName = b.procs
+			rules = append(rules, r)
 		}
-		if len(doms) > 0 {
-			r.Domain = doms
+		if len(b.procPaths) > 0 {
+			r := target(out, action)
+			r.ProcessPath = b.procPaths
+			rules = append(rules, r)
 		}
-		if len(sufs) > 0 {
-			r.DomainSuffix = sufs
+	}
+	// Порт и транспорт — самостоятельные условия: в правиле с адресом они
+	// сужали бы его через И, поэтому у каждого своё правило.
+	addPortRules := func(out, action string, b *routeBucket) {
+		if len(b.ports)+len(b.portRanges) > 0 {
+			r := target(out, action)
+			r.Port = b.ports
+			r.PortRange = b.portRanges
+			rules = append(rules, r)
 		}
-		if len(ips) > 0 {
-			r.IPCIDR = ips
+		for _, network := range b.networks {
+			r := target(out, action)
+			r.Network = network
+			rules = append(rules, r)
+		}
+	}
+	addSetRule := func(out, action string, b *routeBucket) {
+		if len(b.sets) > 0 {
+			r := target(out, action)
+			r.RuleSet = b.sets
+			rules = append(rules, r)
 		}
-		rules = append(rules, r)
 	}
 
 	// ── Умная сортировка правил (Smart Rule Priority) ──────────────────────────
@@ -766,60 +991,77 @@ func buildRoute(routingCfg *RoutingConfig, serverAddr string) SBRoute {
 	//   firefox→youtube: нет proxy:proc → нет proxy:dom (оба в одном правиле)... зависит от порядка
 	//
 	// Правильный порядок по специфичности:
-	//   1. BLOCK всё (процессы, домены, geosite) — безопасность прежде всего
-	//   2. Конкретные domain/IP правила (direct И proxy) — переопределяют process-правила
+	//   1. BLOCK всё (процессы, домены, порты, geosite) — безопасность прежде всего
+	//   2. Конкретные domain/keyword/regex/IP правила (direct И proxy) — переопределяют process-правила
 	//      Пример: google.com→direct перекрывает chrome.exe→proxy для google.com ✓
 	//              youtube.com→proxy перекрывает default=direct для всех процессов ✓
-	//   3. Process правила (direct и proxy) — широкие правила по источнику
-	//   4. Geosite правила — самые широкие паттерны
+	//   3. Process правила (имя и полный путь, direct и proxy) — широкие правила по источнику
+	//   4. Port/network правила — весь трафик данного вида, от любого процесса к любому адресу
+	//   5. Geosite/geoip/rule-set правила — самые широкие паттерны
 	//
 	// Итог: domain/IP правила всегда применяются раньше process-правил,
 	// что соответствует интуитивному ожиданию пользователя.
 
-	// Шаг 1: BLOCK — процессы
-	if len(blockProcs) > 0 {
-		rules = append(rules, SBRouteRule{ProcessName: blockProcs, Action: "reject"})
-	}
-	// BLOCK — домены/IP
-	addDomainRule("", "reject", blockDom, blockSuf, blockIP)
-	// BLOCK — geosite
-	if len(blockGeosite) > 0 {
-		rules = append(rules, SBRouteRule{RuleSet: blockGeosite, Action: "reject"})
-	}
+	// Правила приложений (app_rules.json) идут по приоритету, ведущие BLOCK —
+	// вместе с остальными блокировками, прочие — на место process-правил.
+	appHead, appRest := appProcessRouteRules(routingCfg, proxyFinal)
+
+	// Шаг 1: BLOCK — процессы, домены/IP, порты, geosite
+	rules = append(rules, appHead...)
+	addProcessRules("", "reject", block)
+	addDomainRule("", "reject", block)
+	addPortRules("", "reject", block)
+	addSetRule("", "reject", block)
 
 	// Шаг 2: Конкретные domain/IP правила (оба действия — direct и proxy)
 	// direct domain/IP: например google.com→direct при default=proxy
-	addDomainRule("direct", "", directDom, directSuf, directIP)
+	addDomainRule("direct", "", direct)
+	// proxy domain/IP через конкретный сервер — раньше общего proxy-out внутри шага.
+	for _, tag := range serverTags {
+		addDomainRule(tag, "", serverBuckets[tag])
+	}
 	// proxy domain/IP: например youtube.com→proxy при default=direct
-	addDomainRule("proxy-out", "", proxyDom, proxySuf, proxyIP)
+	addDomainRule("proxy-out", "", proxy)
 
 	// Шаг 3: Process правила
-	if len(directProcs) > 0 {
-		rules = append(rules, SBRouteRule{ProcessName: directProcs, Outbound: "direct"})
-	}
-	if len(proxyProcs) > 0 {
-		rules = append(rules, SBRouteRule{ProcessName: proxyProcs, Outbound: "proxy-out"})
+	rules = append(rules, appRest...)
+	addProcessRules("direct", "", direct)
+	for _, tag := range serverTags {
+		addProcessRules(tag, "", serverBuckets[tag])
 	}
+	addProcessRules("proxy-out", "", proxy)
 
-	// Шаг 4: Geosite правила (самые широкие)
-	if len(directGeosite) > 0 {
-		rules = append(rules, SBRouteRule{RuleSet: directGeosite, Outbound: "direct"})
+	// Шаг 4: Port/network правила
+	addPortRules("direct", "", direct)
+	for _, tag := range serverTags {
+		addPortRules(tag, "", serverBuckets[tag])
 	}
-	if len(proxyGeosite) > 0 {
-		rules = append(rules, SBRouteRule{RuleSet: proxyGeosite, Outbound: "proxy-out"})
+	addPortRules("proxy-out", "", proxy)
+
+	// Шаг 5: Geosite/geoip правила (самые широкие)
+	addSetRule("direct", "", direct)
+	for _, tag := range serverTags {
+		addSetRule(tag, "", serverBuckets[tag])
 	}
+	addSetRule("proxy-out", "", proxy)
 
-	final := "proxy-out"
+	final := proxyFinal
 	if routingCfg.DefaultAction == ActionDirect {
 		final = "direct"
 	} else if routingCfg.DefaultAction == ActionBlock {
 		final = "block"
 	}
 
-	// FindProcess: включаем только если есть process_name правила.
+	// FindProcess: включаем только если есть process_name/process_path правила.
 	// Детектирование процесса добавляет syscall на каждое новое соединение —
 	// включаем только когда реально нужно, чтобы не добавлять накладные расходы зря.
-	hasProcessRules := len(proxyProcs)+len(directProcs)+len(blockProcs) > 0
+	hasProcessRules := block.hasProcesses() || direct.hasProcesses() || proxy.hasProcesses() ||
+		len(routingCfg.AppProcessRules) > 0
+	for _, tag := range serverTags {
+		if serverBuckets[tag].hasProcesses() {
+			hasProcessRules = true
+		}
+	}
 
 	return SBRoute{
 		Rules:   rules,
@@ -2,10 +2,15 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
+
+	"proxyclient/internal/apprules"
 )
 
 // ── parseDNSURL: DoH URL разбивается на host и path ──────────────────────
@@ -48,7 +53,7 @@ func TestBuildDNSConfig_DoH_PathSetSeparately(t *testing.T) {
 		RemoteDNS: "https://1.1.1.1/dns-query",
 		DirectDNS: "udp://8.8.8.8:53",
 	}
-	dns := buildDNSConfig(cfg)
+	dns := buildDNSConfig(cfg, false)
 
 	if len(dns.Servers) == 0 {
 		t.Fatal("buildDNSConfig вернул пустой список серверов")
@@ -101,7 +106,7 @@ func TestBuildDNSConfig_RemoteFallbacks(t *testing.T) {
 			"https://9.9.9.9/dns-query",
 			"quic://dns.adguard.com",
 		},
-	})
+	}, false)
 	want := map[string]struct {
 		server string
 		path   string
@@ -125,6 +130,143 @@ func TestBuildDNSConfig_RemoteFallbacks(t *testing.T) {
 	}
 }
 
+func TestBuildSingBoxConfig_FakeIP(t *testing.T) {
+	routing := DefaultRoutingConfig()
+	routing.DNS = DefaultDNSConfig()
+
+	cfg := buildSingBoxConfig(SBOutbound{Type: "vless", Tag: "proxy-out"}, "1.2.3.4", routing)
+	for _, srv := range cfg.DNS.Servers {
+		if srv.Type == "fakeip" {
+			t.Fatal("fakeip server must be opt-in")
+		}
+	}
+	if cfg.Experimental.CacheFile.StoreFakeIP {
+		t.Fatal("store_fakeip without FakeIP")
+	}
+
+	routing.DNS.FakeIP = &FakeIPConfig{Enabled: true, Inet4Range: "198.18.0.0/16", Exclude: []string{"corp.example"}}
+	cfg = buildSingBoxConfig(SBOutbound{Type: "vless", Tag: "proxy-out"}, "1.2.3.4", routing)
+	var fake *SBDNSServer
+	for i := range cfg.DNS.Servers {
+		if cfg.DNS.Servers[i].Type == "fakeip" {
+			fake = &cfg.DNS.Servers[i]
+		}
+	}
+	if fake == nil || fake.Inet4Range != "198.18.0.0/16" {
+		t.Fatalf("fakeip server = %+v", fake)
+	}
+	rules := cfg.DNS.Rules
+	if len(rules) != 3 || rules[0].Server != "direct-dns" {
+		t.Fatalf("dns rules = %+v", rules)
+	}
+	// Исключения — раньше fakeip-правила, иначе им достанется фейковый адрес.
+	if rules[1].Server != "direct-dns" || len(rules[1].DomainSuffix) != 1 || rules[1].DomainSuffix[0] != "corp.example" {
+		t.Errorf("exclude rule = %+v", rules[1])
+	}
+	if rules[2].Server != fake.Tag || rules[2].Inbound[0] != "tun-in" || rules[2].QueryType[0] != "A" {
+		t.Errorf("fakeip rule = %+v", rules[2])
+	}
+	if cfg.DNS.Final != "remote" {
+		t.Errorf("dns.final = %q", cfg.DNS.Final)
+	}
+	if !cfg.Experimental.CacheFile.StoreFakeIP {
+		t.Error("fakeip addresses must persist in cache_file")
+	}
+	rejected := false
+	for _, r := range cfg.Route.Rules {
+		if len(r.IPCIDR) == 1 && r.IPCIDR[0] == "198.18.0.0/16" && r.Action == "reject" {
+			rejected = true
+		}
+	}
+	if !rejected {
+		t.Error("unrestorable fake addresses must be rejected")
+	}
+}
+
+// Исключения по умолчанию — LAN-имена и проверка подключения Windows:
+// их резолвит локальный DNS, а не DoH через прокси.
+func TestBuildSingBoxConfig_FakeIPExcludeUsesDirectDNS(t *testing.T) {
+	routing := DefaultRoutingConfig()
+	routing.DNS = DefaultDNSConfig()
+	routing.DNS.FakeIP = &FakeIPConfig{Enabled: true}
+
+	cfg := buildSingBoxConfig(SBOutbound{Type: "vless", Tag: "proxy-out"}, "1.2.3.4", routing)
+	var exclude *SBDNSRule
+	for i, r := range cfg.DNS.Rules {
+		if slices.Contains(r.DomainSuffix, "home.arpa") {
+			exclude = &cfg.DNS.Rules[i]
+		}
+	}
+	if exclude == nil || !slices.Contains(exclude.DomainSuffix, "msftconnecttest.com") {
+		t.Fatalf("dns rules = %+v", cfg.DNS.Rules)
+	}
+	if exclude.Server != "direct-dns" {
+		t.Errorf("fakeip exclude server = %q, want direct-dns", exclude.Server)
+	}
+	direct := false
+	for _, srv := range cfg.DNS.Servers {
+		if srv.Tag == exclude.Server && srv.Detour == "" {
+			direct = true
+		}
+	}
+	if !direct {
+		t.Errorf("server %q is missing or goes through a detour", exclude.Server)
+	}
+}
+
+// Без TUN фейковые адреса некому выдавать: ни fakeip-сервера, ни правил,
+// ссылающихся на несуществующий tun-in.
+func TestBuildSingBoxConfig_FakeIPProxyOnly(t *testing.T) {
+	routing := DefaultRoutingConfig()
+	routing.ProxyOnly = true
+	routing.DNS = DefaultDNSConfig()
+	routing.DNS.FakeIP = &FakeIPConfig{Enabled: true, Inet4Range: DefaultFakeIPRange}
+	cfg := buildSingBoxConfig(SBOutbound{Type: "vless", Tag: "proxy-out"}, "1.2.3.4", routing)
+	for _, srv := range cfg.DNS.Servers {
+		if srv.Type == "fakeip" {
+			t.Errorf("proxy-only config has a fakeip server: %+v", srv)
+		}
+	}
+	for _, r := range cfg.DNS.Rules {
+		if slices.Contains(r.Inbound, "tun-in") || r.Server == fakeIPDNSTag {
+			t.Errorf("proxy-only DNS rule = %+v", r)
+		}
+	}
+	for _, r := range cfg.Route.Rules {
+		if slices.Contains(r.IPCIDR, DefaultFakeIPRange) {
+			t.Errorf("proxy-only route rule = %+v", r)
+		}
+	}
+	if cfg.Experimental.CacheFile.StoreFakeIP {
+		t.Error("store_fakeip in proxy-only config")
+	}
+}
+
+func TestSanitizeRoutingConfig_FakeIP(t *testing.T) {
+	cfg := &RoutingConfig{DNS: &DNSConfig{FakeIP: &FakeIPConfig{
+		Enabled:    true,
+		Inet4Range: "192.168.0.0/16",
+		Exclude:    []string{" .Local ", "local", "", "https://NTP.example/"},
+	}}}
+	SanitizeRoutingConfig(cfg)
+	f := cfg.DNS.FakeIP
+	if f.Inet4Range != DefaultFakeIPRange {
+		t.Errorf("range overlapping LAN = %q, want default", f.Inet4Range)
+	}
+	if len(f.Exclude) != 2 || f.Exclude[0] != "local" || f.Exclude[1] != "ntp.example" {
+		t.Errorf("exclude = %q", f.Exclude)
+	}
+
+	for _, bad := range []string{"fd00::/8", "10.1.0.0/16", "198.18.0.0/28", "nope"} {
+		if ValidateFakeIPRange(bad) == nil {
+			t.Errorf("ValidateFakeIPRange(%q) = nil", bad)
+		}
+	}
+	if err := ValidateFakeIPRange("100.64.0.0/10"); err != nil {
+		t.Errorf("ValidateFakeIPRange(CGNAT) = %v", err)
+	}
+}
+
 // ── buildRoute: domain-suffix правила ─────────────────────────────────────
 
 // BUG-РИСК: правило с доменом начинающимся на "." должно попасть в
@@ -568,6 +710,30 @@ func TestGenerateSingBoxConfig_NilRouting_NoPanic(t *testing.T) {
 	_ = GenerateSingBoxConfig(secretPath, outputPath, nil)
 }
 
+// Нечитаемый app_rules.json не мешает собрать конфиг, но попадает в лог.
+func TestGenerateSingBoxConfig_BrokenAppRulesWarns(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret.key")
+	mustWriteFile(t, secretPath, []byte(
+		"vless://12345678-1234-1234-1234-123456789abc@example.com:443?sni=www.google.com&pbk=testkey&sid=abc",
+	))
+	t.Chdir(dir)
+	if err := os.MkdirAll(DataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mustWriteFile(t, AppRulesFile, []byte("{not json"))
+	log := &captureVLESSLogger{}
+	defer setVLESSLoggerForTest(log)()
+
+	outputPath := filepath.Join(dir, "out.json")
+	if err := GenerateSingBoxConfig(secretPath, outputPath, &RoutingConfig{DefaultAction: ActionProxy}); err != nil {
+		t.Fatalf("GenerateSingBoxConfig: %v", err)
+	}
+	if !log.contains("app_rules.json") {
+		t.Errorf("warnings = %v, want app_rules.json error", log.warnings)
+	}
+}
+
 // ── GenerateSingBoxConfig: выходной JSON валиден ─────────────────────────
 
 // BUG-РИСК: атомарная запись или сериализация не должна обрезать файл.
@@ -723,3 +889,340 @@ func TestValidateVLESSParams_WhitespaceUUID_ShouldError(t *testing.T) {
 		t.Error("validateVLESSParams должен отклонять пробельный UUID")
 	}
 }
+
+func TestBuildSingBoxConfig_IPv6Modes(t *testing.T) {
+	cases := []struct {
+		mode     IPv6Mode
+		strategy string
+		tunIPv6  bool
+		rejectV6 bool
+	}{
+		{"", "ipv4_only", false, true},
+		{IPv6ModeIPv4Only, "ipv4_only", false, true},
+		{IPv6ModePreferIPv4, "prefer_ipv4", true, false},
+		{IPv6ModeDualStack, "", true, false},
+	}
+	for _, tc := range cases {
+		routing := DefaultRoutingConfig()
+		routing.IPv6Mode = tc.mode
+		cfg := buildSingBoxConfig(SBOutbound{Type: "vless", Tag: "proxy-out"}, "2001:db8::5", routing)
+
+		if cfg.DNS.Strategy != tc.strategy {
+			t.Errorf("%q: dns.strategy = %q, want %q", tc.mode, cfg.DNS.Strategy, tc.strategy)
+		}
+		var tun SBInbound
+		for _, in := range cfg.Inbounds {
+			if in.Tag == "tun-in" {
+				tun = in
+			}
+		}
+		if got := slices.Contains(tun.Address, tunIPv6Address); got != tc.tunIPv6 {
+			t.Errorf("%q: tun address = %v", tc.mode, tun.Address)
+		}
+		if !slices.Contains(tun.RouteExcludeAddress, "2001:db8::5/128") {
+			t.Errorf("%q: IPv6 server must be excluded as /128: %v", tc.mode, tun.RouteExcludeAddress)
+		}
+		rejected := slices.ContainsFunc(cfg.Route.Rules, func(r SBRouteRule) bool {
+			return r.Action == "reject" && slices.Equal(r.IPCIDR, []string{"::/0"})
+		})
+		if rejected != tc.rejectV6 {
+			t.Errorf("%q: ::/0 reject = %v, want %v", tc.mode, rejected, tc.rejectV6)
+		}
+	}
+
+	routing := &RoutingConfig{IPv6Mode: " Dual-Stack "}
+	SanitizeRoutingConfig(routing)
+	if routing.IPv6Mode != IPv6ModeDualStack {
+		t.Errorf("sanitized mode = %q", routing.IPv6Mode)
+	}
+	for _, mode := range []IPv6Mode{IPv6ModeIPv4Only, "ipv6-only"} {
+		routing.IPv6Mode = mode
+		SanitizeRoutingConfig(routing)
+		if routing.IPv6Mode != "" {
+			t.Errorf("%q: sanitized mode = %q, want default", mode, routing.IPv6Mode)
+		}
+	}
+}
+
+func TestBuildSingBoxConfigProxyOnly(t *testing.T) {
+	routing := DefaultRoutingConfig()
+	routing.ProxyOnly = true
+	routing.LANShareEnabled = true
+	cfg := buildSingBoxConfig(SBOutbound{Type: "vless", Tag: "proxy-out"}, "1.2.3.4", routing)
+
+	var tags []string
+	for _, in := range cfg.Inbounds {
+		tags = append(tags, in.Tag)
+		if in.Type == "tun" {
+			t.Errorf("proxy-only config has a TUN inbound: %+v", in)
+		}
+		if in.Tag == "mixed-in" && (in.Type != "mixed" || in.Listen != "127.0.0.1" || in.ListenPort != MixedPort) {
+			t.Errorf("mixed inbound = %+v", in)
+		}
+	}
+	if !slices.Equal(tags, []string{"http-in", "mixed-in", LANInboundTag}) {
+		t.Errorf("inbounds = %v", tags)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "routing.json")
+	if ProxyOnlyEnabled(path) {
+		t.Error("missing routing.json must mean TUN mode")
+	}
+	if err := SaveRoutingConfig(path, routing); err != nil {
+		t.Fatal(err)
+	}
+	if !ProxyOnlyEnabled(path) {
+		t.Error("ProxyOnlyEnabled = false after save")
+	}
+}
+
+func TestBuildSingBoxConfigLANShare(t *testing.T) {
+	routing := DefaultRoutingConfig()
+	routing.LANShareEnabled = true
+	routing.LANUsers = []LANUser{{Username: " guest ", Password: "pw"}, {Username: "a:b"}, {Username: "guest", Password: "dup"}}
+	routing.LANAllowCIDRs = []string{"192.168.1.0/24", "10.0.0.7", "bogus", "192.168.1.9/24"}
+	routing.LANPolicy = LANPolicyProxy
+	routing.DefaultGroup = "auto"
+	SanitizeRoutingConfig(routing)
+	if len(routing.LANUsers) != 1 || routing.LANUsers[0].Username != "guest" || routing.LANUsers[0].Password != "pw" {
+		t.Errorf("sanitized users = %+v", routing.LANUsers)
+	}
+	if !slices.Equal(routing.LANAllowCIDRs, []string{"192.168.1.0/24", "10.0.0.7/32"}) {
+		t.Errorf("sanitized CIDRs = %v", routing.LANAllowCIDRs)
+	}
+
+	cfg := buildSingBoxConfig(SBOutbound{Type: "vless", Tag: "proxy-out"}, "1.2.3.4", routing)
+	lan := cfg.Inbounds[len(cfg.Inbounds)-1]
+	if lan.Type != "mixed" || lan.Tag != LANInboundTag || lan.Listen != "0.0.0.0" || lan.ListenPort != DefaultLANSharePort ||
+		len(lan.Users) != 1 || lan.Users[0].Username != "guest" {
+		t.Errorf("LAN inbound = %+v", lan)
+	}
+
+	data, err := json.Marshal(cfg.Route.Rules[2:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"action":"reject","type":"logical","mode":"and","rules":[{"inbound":["lan-in"]},{"source_ip_cidr":["192.168.1.0/24","10.0.0.7/32"],"invert":true}]},` +
+		`{"inbound":["lan-in"],"outbound":"` + GroupOutboundTag("auto") + `"}]`
+	if string(data) != want {
+		t.Errorf("LAN rules:\n got %s\nwant %s", data, want)
+	}
+	if !slices.Equal(cfg.Route.Rules[4].IPCIDR[:len(privateIPRanges)], privateIPRanges) {
+		t.Errorf("LAN rules must precede local direct, rule 4 = %+v", cfg.Route.Rules[4])
+	}
+
+	// Общие правила и вход без ограничений — отдельных LAN-правил нет.
+	routing.LANPolicy = LANPolicyRules
+	routing.LANAllowCIDRs = nil
+	SanitizeRoutingConfig(routing)
+	if routing.LANPolicy != "" {
+		t.Errorf("default policy stored as %q", routing.LANPolicy)
+	}
+	if rules := lanRouteRules(routing, "proxy-out"); len(rules) != 0 {
+		t.Errorf("unexpected LAN rules %+v", rules)
+	}
+}
+
+// Пароли LAN в routing.json хранятся зашифрованными, как secret.key;
+// файл старой версии с открытым паролем читается как раньше.
+func TestSaveRoutingConfigProtectsLANPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routing.json")
+	routing := DefaultRoutingConfig()
+	routing.LANUsers = []LANUser{{Username: "guest", Password: "s3cret-pass"}}
+	if err := SaveRoutingConfig(path, routing); err != nil {
+		t.Fatal(err)
+	}
+	if routing.LANUsers[0].Password != "s3cret-pass" {
+		t.Errorf("SaveRoutingConfig changed caller's password: %q", routing.LANUsers[0].Password)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret-pass") || !strings.Contains(string(data), dpapiMagic) {
+		t.Errorf("routing.json stores LAN password in plaintext: %s", data)
+	}
+	loaded, err := LoadRoutingConfig(path)
+	if err != nil || len(loaded.LANUsers) != 1 || loaded.LANUsers[0].Password != "s3cret-pass" {
+		t.Fatalf("LoadRoutingConfig = %+v, %v", loaded, err)
+	}
+
+	mustWriteFile(t, path, []byte(`{"default_action":"proxy","lan_users":[{"username":"old","password":"plain"}]}`))
+	if loaded, err := LoadRoutingConfig(path); err != nil || loaded.LANUsers[0].Password != "plain" {
+		t.Errorf("legacy LoadRoutingConfig = %+v, %v", loaded, err)
+	}
+}
+
+func TestBuildSingBoxConfigAppInbounds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app_rules.json")
+	storage := apprules.NewFileStorage(path)
+	if err := storage.Save([]apprules.Rule{
+		{ID: "a", Pattern: "a.exe", Action: apprules.ActionProxy, Enabled: true, InboundPort: 10820, Group: "auto"},
+		{ID: "b", Pattern: "b.exe", Action: apprules.ActionProxy, Enabled: true, InboundPort: 10821},
+		{ID: "c", Pattern: "c.exe", Action: apprules.ActionProxy, Enabled: false, InboundPort: 10822},
+		{ID: "d", Pattern: "d.exe", Action: apprules.ActionProxy, Enabled: true, ProxyAddr: ProxyAddr},
+		{ID: "e", Pattern: "e.exe", Action: apprules.ActionProxy, Enabled: true, InboundPort: ProxyPort},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	apps, procs, err := LoadAppRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 3 || apps[0].Tag != "app-a" || apps[0].Group != "auto" {
+		t.Fatalf("LoadAppRules inbounds = %+v", apps)
+	}
+	if len(procs) != 4 || procs[0].Group != "auto" || procs[3].Regex != apprules.PatternRegex("e.exe") {
+		t.Fatalf("LoadAppRules process rules = %+v", procs)
+	}
+
+	routing := DefaultRoutingConfig()
+	routing.AppInbounds = apps
+	routing.AppProcessRules = procs
+	cfg := buildSingBoxConfig(SBOutbound{Type: "vless", Tag: "proxy-out"}, "1.2.3.4", routing)
+	var ports []int
+	for _, in := range cfg.Inbounds {
+		if strings.HasPrefix(in.Tag, apprules.InboundTagPrefix) {
+			if in.Type != "http" || in.Listen != "127.0.0.1" {
+				t.Errorf("app inbound = %+v", in)
+			}
+			ports = append(ports, in.ListenPort)
+		}
+	}
+	if !slices.Equal(ports, []int{10820, 10821}) {
+		t.Errorf("app inbound ports = %v (reserved port must be skipped)", ports)
+	}
+	var routes []string
+	for i, rule := range cfg.Route.Rules {
+		if len(rule.Inbound) == 1 && strings.HasPrefix(rule.Inbound[0], apprules.InboundTagPrefix) {
+			if rule.IPCIDR != nil || i < 3 {
+				t.Errorf("app rule #%d = %+v", i, rule)
+			}
+			routes = append(routes, rule.Inbound[0]+"→"+rule.Outbound)
+		}
+	}
+	if want := []string{"app-a→" + GroupOutboundTag("auto"), "app-b→proxy-out"}; !slices.Equal(routes, want) {
+		t.Errorf("app routes = %v, want %v", routes, want)
+	}
+
+	// Process-правила подряд с одной целью сливаются в одно правило route.
+	var procRoutes []string
+	for _, rule := range cfg.Route.Rules {
+		if len(rule.ProcessPathRegex) > 0 {
+			procRoutes = append(procRoutes, fmt.Sprintf("%d→%s", len(rule.ProcessPathRegex), rule.Outbound))
+		}
+	}
+	if want := []string{"1→" + GroupOutboundTag("auto"), "3→proxy-out"}; !slices.Equal(procRoutes, want) || !cfg.Route.FindProcess {
+		t.Errorf("app process routes = %v, want %v (find_process %v)", procRoutes, want, cfg.Route.FindProcess)
+	}
+
+	// Группы нет среди outbound'ов — правило уходит в маршрут по умолчанию.
+	resolved := resolveServerRules(routing, nil)
+	if resolved.AppInbounds[0].Group != "" || routing.AppInbounds[0].Group != "auto" {
+		t.Errorf("resolved = %+v, original = %+v", resolved.AppInbounds, routing.AppInbounds)
+	}
+	if resolved.AppProcessRules[0].Group != "" || routing.AppProcessRules[0].Group != "auto" {
+		t.Errorf("resolved = %+v, original = %+v", resolved.AppProcessRules, routing.AppProcessRules)
+	}
+	if _, groups := referencedTargets(routing); !slices.Equal(groups, []string{"auto"}) {
+		t.Errorf("referenced groups = %v", groups)
+	}
+}
+
+func TestMigrateProcessRules(t *testing.T) {
+	dir := t.TempDir()
+	routingPath := filepath.Join(dir, "routing.json")
+	appPath := filepath.Join(dir, "app_rules.json")
+	if err := apprules.NewFileStorage(appPath).Save([]apprules.Rule{
+		{ID: "x", Name: "Discord", Pattern: "discord.exe", Action: apprules.ActionDirect, Enabled: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	routing := DefaultRoutingConfig()
+	routing.Rules = []RoutingRule{
+		{Value: "Telegram.exe", Type: RuleTypeProcess, Action: ActionProxy, Server: "srv"},
+		{Value: "youtube.com", Type: RuleTypeDomain, Action: ActionProxy},
+		{Value: `C:\Tools\miner.exe`, Type: RuleTypeProcessPath, Action: ActionBlock, Note: "Майнер"},
+		{Value: "Discord.exe", Type: RuleTypeProcess, Action: ActionProxy},
+	}
+	if err := SaveRoutingConfig(routingPath, routing); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := MigrateProcessRules(routingPath, appPath)
+	if err != nil || n != 2 {
+		t.Fatalf("MigrateProcessRules = %d, %v", n, err)
+	}
+	migrated, err := LoadRoutingConfig(routingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrated.Rules) != 1 || migrated.Rules[0].Value != "youtube.com" {
+		t.Errorf("routing rules after migration = %+v", migrated.Rules)
+	}
+	rules, err := apprules.NewFileStorage(appPath).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPattern := map[string]apprules.Rule{}
+	for _, r := range rules {
+		byPattern[r.Pattern] = r
+	}
+	tg, miner := byPattern["telegram.exe"], byPattern["c:/tools/miner.exe"]
+	if len(rules) != 3 || byPattern["discord.exe"].Action != apprules.ActionDirect ||
+		tg.Action != apprules.ActionProxy || tg.Server != "srv" || tg.ProxyAddr != ProxyAddr || !tg.Enabled || tg.ID == "" ||
+		miner.Action != apprules.ActionBlock || miner.Name != "Майнер" || !tg.Exact || !miner.Exact {
+		t.Errorf("app rules after migration = %+v", rules)
+	}
+
+	// Повторный запуск ничего не меняет.
+	if n, err := MigrateProcessRules(routingPath, appPath); err != nil || n != 0 {
+		t.Errorf("second MigrateProcessRules = %d, %v", n, err)
+	}
+}
+
+// Перенесённые правила сохраняют прежний порядок проверки в route и не
+// совпадают с более длинными именами, как process_name.
+func TestMigrateProcessRules_KeepsOrderAndExactNames(t *testing.T) {
+	dir := t.TempDir()
+	routingPath := filepath.Join(dir, "routing.json")
+	appPath := filepath.Join(dir, "app_rules.json")
+	routing := DefaultRoutingConfig()
+	routing.Rules = []RoutingRule{
+		{Value: "ssh.exe", Type: RuleTypeProcess, Action: ActionProxy},
+		{Value: `C:\Tools\ssh.exe`, Type: RuleTypeProcessPath, Action: ActionDirect},
+		{Value: "tg.exe", Type: RuleTypeProcess, Action: ActionProxy, Group: "auto"},
+		{Value: "git.exe", Type: RuleTypeProcess, Action: ActionDirect},
+		{Value: "bad.exe", Type: RuleTypeProcess, Action: ActionBlock},
+	}
+	if err := SaveRoutingConfig(routingPath, routing); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := MigrateProcessRules(routingPath, appPath); err != nil || n != 5 {
+		t.Fatalf("MigrateProcessRules = %d, %v", n, err)
+	}
+
+	rules, err := apprules.NewFileStorage(appPath).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	apprules.SortRules(rules)
+	var order []string
+	for _, r := range rules {
+		order = append(order, r.Pattern)
+	}
+	want := []string{"bad.exe", "git.exe", "c:/tools/ssh.exe", "tg.exe", "ssh.exe"}
+	if !slices.Equal(order, want) {
+		t.Errorf("migrated order = %v, want %v", order, want)
+	}
+
+	_, procs, err := LoadAppRules(appPath)
+	if err != nil || len(procs) != 5 {
+		t.Fatalf("LoadAppRules = %+v, %v", procs, err)
+	}
+	ssh := regexp.MustCompile(procs[4].Regex)
+	if ssh.MatchString(`C:\Tools\myssh.exe`) || !ssh.MatchString(`C:\Windows\System32\OpenSSH\ssh.exe`) {
+		t.Errorf("migrated ssh.exe regex %s", ssh)
+	}
+}
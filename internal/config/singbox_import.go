@@ -0,0 +1,267 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Импорт готовых outbound'ов sing-box: панели раздают полный конфиг или массив
+// outbounds вместо share-ссылок. Каждый proxy outbound сохраняется как
+// компактный JSON-объект — эту строку ParseServerContent принимает наравне
+// с URI, поэтому servers.json, secret.key и detour-цепочки работают без
+// изменений, а поля, которых нет в VLESSParams, не теряются.
+
+// SingBoxServer — proxy outbound, извлечённый из sing-box JSON.
+type SingBoxServer struct {
+	// Name — тег outbound'а в исходном конфиге.
+	Name string
+	// Content — компактный JSON outbound'а, пригодный для ParseServerContent.
+	Content string
+}
+
+// singBoxProxyTypes — типы outbound'ов, которые импортируются как серверы.
+var singBoxProxyTypes = map[string]bool{
+	"vless": true, "vmess": true, "trojan": true, "shadowsocks": true,
+	"hysteria2": true, "tuic": true, "wireguard": true,
+}
+
+// singBoxServiceTypes — служебные outbound'ы, которые пропускаются молча.
+var singBoxServiceTypes = map[string]bool{
+	"direct": true, "block": true, "dns": true, "selector": true, "urltest": true,
+}
+
+type singBoxDocument struct {
+	Outbounds []json.RawMessage `json:"outbounds"`
+	Endpoints []json.RawMessage `json:"endpoints"`
+}
+
+type singBoxWireGuardEndpoint struct {
+	Type       string   `json:"type"`
+	Tag        string   `json:"tag"`
+	Address    []string `json:"address"`
+	PrivateKey string   `json:"private_key"`
+	MTU        int      `json:"mtu"`
+	Peers      []struct {
+		Address      string `json:"address"`
+		Port         int    `json:"port"`
+		PublicKey    string `json:"public_key"`
+		PreSharedKey string `json:"pre_shared_key"`
+		Reserved     []int  `json:"reserved"`
+	} `json:"peers"`
+}
+
+// IsSingBoxOutboundContent сообщает, что строка — JSON-объект outbound'а
+// поддерживаемого типа (то, что хранится вместо URI для импортированных серверов).
+func IsSingBoxOutboundContent(content string) bool {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "{") {
+		return false
+	}
+	var head struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal([]byte(content), &head) == nil && singBoxProxyTypes[head.Type]
+}
+
+// ParseSingBoxOutbounds извлекает proxy outbound'ы из sing-box JSON: полного
+// конфига (outbounds и endpoints), массива outbound'ов или одного outbound'а.
+// Ошибка — данные не похожи на sing-box JSON; пропущенные outbound'ы и
+// неизвестные поля попадают в warnings.
+func ParseSingBoxOutbounds(data []byte) ([]SingBoxServer, []string, error) {
+	raws, endpoints, err := splitSingBoxDocument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var servers []SingBoxServer
+	var warnings []string
+	add := func(out SBOutbound, unknown []string) {
+		name := firstNonEmpty(out.Tag, out.Server)
+		for _, field := range unknown {
+			warnings = append(warnings, fmt.Sprintf("sing-box %s %q: field %q ignored", out.Type, name, field))
+		}
+		if out.Detour != "" {
+			warnings = append(warnings, fmt.Sprintf("sing-box %s %q: detour %q ignored, use server detour instead", out.Type, name, out.Detour))
+			out.Detour = ""
+		}
+		if _, err := validateSingBoxOutbound(out); err != nil {
+			warnings = append(warnings, fmt.Sprintf("sing-box %s %q skipped: %v", out.Type, name, err))
+			return
+		}
+		content, err := json.Marshal(out)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("sing-box %s %q skipped: %v", out.Type, name, err))
+			return
+		}
+		servers = append(servers, SingBoxServer{Name: name, Content: string(content)})
+	}
+
+	for _, raw := range raws {
+		var head struct {
+			Type string `json:"type"`
+			Tag  string `json:"tag"`
+		}
+		if err := json.Unmarshal(raw, &head); err != nil {
+			warnings = append(warnings, "sing-box outbound skipped: not an object")
+			continue
+		}
+		switch {
+		case singBoxServiceTypes[head.Type]:
+			continue
+		case !singBoxProxyTypes[head.Type]:
+			warnings = append(warnings, fmt.Sprintf("sing-box outbound %q skipped: type %q is not supported", head.Tag, head.Type))
+			continue
+		}
+		var out SBOutbound
+		if err := json.Unmarshal(raw, &out); err != nil {
+			warnings = append(warnings, fmt.Sprintf("sing-box outbound %q skipped: %v", head.Tag, err))
+			continue
+		}
+		add(out, unknownOutboundFields(raw))
+	}
+	for _, raw := range endpoints {
+		var ep singBoxWireGuardEndpoint
+		if err := json.Unmarshal(raw, &ep); err != nil || ep.Type != "wireguard" {
+			warnings = append(warnings, fmt.Sprintf("sing-box endpoint %q skipped: only wireguard is supported", ep.Tag))
+			continue
+		}
+		out, err := wireGuardEndpointOutbound(ep)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("sing-box endpoint %q skipped: %v", ep.Tag, err))
+			continue
+		}
+		add(out, nil)
+	}
+	return servers, warnings, nil
+}
+
+// splitSingBoxDocument разбирает три формы sing-box JSON в списки сырых outbound'ов и endpoint'ов.
+func splitSingBoxDocument(data []byte) (outbounds, endpoints []json.RawMessage, err error) {
+	trimmed := strings.TrimSpace(strings.TrimPrefix(string(data), "\ufeff"))
+	switch {
+	case strings.HasPrefix(trimmed, "["):
+		if err := json.Unmarshal([]byte(trimmed), &outbounds); err != nil {
+			return nil, nil, fmt.Errorf("sing-box outbounds: %w", err)
+		}
+		return outbounds, nil, nil
+	case strings.HasPrefix(trimmed, "{"):
+		var doc singBoxDocument
+		if err := json.Unmarshal([]byte(trimmed), &doc); err != nil {
+			return nil, nil, fmt.Errorf("sing-box config: %w", err)
+		}
+		if len(doc.Outbounds) > 0 || len(doc.Endpoints) > 0 {
+			return doc.Outbounds, doc.Endpoints, nil
+		}
+		var head struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal([]byte(trimmed), &head) == nil && head.Type != "" {
+			return []json.RawMessage{json.RawMessage(trimmed)}, nil, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("not a sing-box config, outbound array or outbound")
+}
+
+func wireGuardEndpointOutbound(ep singBoxWireGuardEndpoint) (SBOutbound, error) {
+	if len(ep.Peers) == 0 {
+		return SBOutbound{}, fmt.Errorf("wireguard endpoint has no peers")
+	}
+	peer := ep.Peers[0]
+	return SBOutbound{
+		Type:            "wireguard",
+		Tag:             ep.Tag,
+		Server:          peer.Address,
+		ServerPort:      peer.Port,
+		SystemInterface: ptrBool(false),
+		InterfaceName:   "wg0",
+		LocalAddress:    ep.Address,
+		PrivateKey:      ep.PrivateKey,
+		PeerPublicKey:   peer.PublicKey,
+		PreSharedKey:    peer.PreSharedKey,
+		MTU:             ep.MTU,
+		Reserved:        peer.Reserved,
+	}, nil
+}
+
+// parseSingBoxOutbound — ParseServerContent для JSON-объекта outbound'а.
+func parseSingBoxOutbound(content string) (*ParsedServer, error) {
+	var out SBOutbound
+	if err := json.Unmarshal([]byte(content), &out); err != nil {
+		return nil, fmt.Errorf("sing-box outbound: %w", err)
+	}
+	proto, err := validateSingBoxOutbound(out)
+	if err != nil {
+		return nil, err
+	}
+	name := firstNonEmpty(out.Tag, out.Server)
+	out.Tag = "proxy-out"
+	out.Detour = ""
+	return &ParsedServer{Proto: proto, DisplayName: name, Address: out.Server, Port: out.ServerPort, Outbound: out}, nil
+}
+
+// validateSingBoxOutbound проверяет обязательные поля outbound'а и возвращает протокол.
+func validateSingBoxOutbound(out SBOutbound) (string, error) {
+	if !singBoxProxyTypes[out.Type] {
+		return "", fmt.Errorf("unsupported sing-box outbound type %q", out.Type)
+	}
+	if strings.TrimSpace(out.Server) == "" {
+		return "", fmt.Errorf("%s server is required", out.Type)
+	}
+	if out.ServerPort <= 0 || out.ServerPort > 65535 {
+		return "", fmt.Errorf("%s server_port is invalid", out.Type)
+	}
+	switch out.Type {
+	case "vless", "vmess":
+		if out.UUID == "" {
+			return "", fmt.Errorf("%s uuid is required", out.Type)
+		}
+	case "trojan", "hysteria2":
+		if out.Password == "" {
+			return "", fmt.Errorf("%s password is required", out.Type)
+		}
+	case "shadowsocks":
+		if out.Password == "" || !supportedSSMethod(out.Method) {
+			return "", fmt.Errorf("shadowsocks method %q or password is invalid", out.Method)
+		}
+	case "tuic":
+		if out.UUID == "" || out.Password == "" {
+			return "", fmt.Errorf("tuic uuid and password are required")
+		}
+	case "wireguard":
+		if out.PrivateKey == "" || out.PeerPublicKey == "" || len(out.LocalAddress) == 0 {
+			return "", fmt.Errorf("wireguard private_key, peer_public_key and local_address are required")
+		}
+	}
+	return out.Type, nil
+}
+
+// sbOutboundFields — JSON-имена полей SBOutbound.
+var sbOutboundFields = func() map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(SBOutbound{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// unknownOutboundFields возвращает поля верхнего уровня, которых нет в SBOutbound.
+func unknownOutboundFields(raw json.RawMessage) []string {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil
+	}
+	var unknown []string
+	for key := range obj {
+		if !sbOutboundFields[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const singBoxFullConfig = `{
+  "log": {"level": "warn"},
+  "outbounds": [
+    {"type": "selector", "tag": "proxy", "outbounds": ["nl-reality", "de-hy2"]},
+    {"type": "vless", "tag": "nl-reality", "server": "nl.example.com", "server_port": 443,
+     "uuid": "00000000-0000-0000-0000-000000000001", "flow": "xtls-rprx-vision",
+     "packet_encoding": "xudp",
+     "tls": {"enabled": true, "server_name": "www.microsoft.com",
+             "utls": {"enabled": true, "fingerprint": "chrome"},
+             "reality": {"enabled": true, "public_key": "pbk", "short_id": "ab"}},
+     "multiplex": {"enabled": true, "protocol": "h2mux", "max_streams": 8}},
+    {"type": "hysteria2", "tag": "de-hy2", "server": "de.example.com", "server_port": 8443,
+     "password": "secret", "up_mbps": 30, "down_mbps": 150,
+     "obfs": {"type": "salamander", "password": "o"}, "detour": "nl-reality"},
+    {"type": "shadowsocks", "tag": "bad-ss", "server": "ss.example.com", "server_port": 8388,
+     "method": "rc4", "password": "x"},
+    {"type": "shadowtls", "tag": "stls", "server": "st.example.com", "server_port": 443},
+    {"type": "direct", "tag": "direct"}
+  ],
+  "endpoints": [
+    {"type": "wireguard", "tag": "wg", "address": ["10.0.0.2/32"], "private_key": "priv", "mtu": 1280,
+     "peers": [{"address": "wg.example.com", "port": 51820, "public_key": "pub", "reserved": [1, 2, 3]}]}
+  ]
+}`
+
+func TestParseSingBoxOutbounds_FullConfig(t *testing.T) {
+	servers, warnings, err := ParseSingBoxOutbounds([]byte(singBoxFullConfig))
+	if err != nil {
+		t.Fatalf("ParseSingBoxOutbounds: %v", err)
+	}
+	names := make([]string, 0, len(servers))
+	for _, s := range servers {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "nl-reality,de-hy2,wg" {
+		t.Fatalf("servers = %v, warnings = %v", names, warnings)
+	}
+	joined := strings.Join(warnings, "\n")
+	for _, want := range []string{`field "packet_encoding" ignored`, `detour "nl-reality" ignored`, `"bad-ss" skipped`, `"stls" skipped`} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("warnings missing %q:\n%s", want, joined)
+		}
+	}
+
+	vless, err := ParseServerContent(servers[0].Content)
+	if err != nil {
+		t.Fatalf("ParseServerContent(vless): %v", err)
+	}
+	ob := vless.Outbound
+	if vless.Proto != "vless" || vless.DisplayName != "nl-reality" || ob.Tag != "proxy-out" {
+		t.Errorf("parsed = %+v", vless)
+	}
+	// Поля, которых нет в VLESSParams (multiplex h2mux, max_streams), сохраняются.
+	if ob.Multiplex == nil || ob.Multiplex.Protocol != "h2mux" || ob.Multiplex.MaxStreams != 8 {
+		t.Errorf("multiplex lost: %+v", ob.Multiplex)
+	}
+	if ob.TLS == nil || ob.TLS.Reality == nil || ob.TLS.Reality.PublicKey != "pbk" {
+		t.Errorf("reality lost: %+v", ob.TLS)
+	}
+
+	hy2, err := ParseServerContent(servers[1].Content)
+	if err != nil {
+		t.Fatalf("ParseServerContent(hy2): %v", err)
+	}
+	if hy2.Outbound.Detour != "" || hy2.Outbound.UpMbps != 30 || hy2.Outbound.Obfs == nil {
+		t.Errorf("hysteria2 outbound = %+v", hy2.Outbound)
+	}
+
+	wg, err := ParseServerContent(servers[2].Content)
+	if err != nil {
+		t.Fatalf("ParseServerContent(wg): %v", err)
+	}
+	if wg.Address != "wg.example.com" || wg.Port != 51820 || wg.Outbound.PeerPublicKey != "pub" || len(wg.Outbound.Reserved) != 3 {
+		t.Errorf("wireguard endpoint = %+v", wg.Outbound)
+	}
+}
+
+func TestParseSingBoxOutbounds_ArrayAndSingle(t *testing.T) {
+	arr := `[{"type":"trojan","tag":"t","server":"t.example.com","server_port":443,"password":"p"}]`
+	servers, _, err := ParseSingBoxOutbounds([]byte(arr))
+	if err != nil || len(servers) != 1 {
+		t.Fatalf("array: servers=%v err=%v", servers, err)
+	}
+	single := `{"type":"tuic","tag":"tu","server":"tu.example.com","server_port":443,"uuid":"u","password":"p"}`
+	servers, _, err = ParseSingBoxOutbounds([]byte(single))
+	if err != nil || len(servers) != 1 || servers[0].Name != "tu" {
+		t.Fatalf("single: servers=%v err=%v", servers, err)
+	}
+	if !IsSingBoxOutboundContent(servers[0].Content) {
+		t.Error("stored content must be recognised as sing-box outbound")
+	}
+
+	if _, _, err := ParseSingBoxOutbounds([]byte(`{"version":1,"servers":[]}`)); err == nil {
+		t.Error("SIP008 document must not parse as sing-box")
+	}
+	if _, err := ParseServerContent(`{"type":"vmess","server":"v.example.com","server_port":443}`); err == nil {
+		t.Error("vmess outbound without uuid must be rejected")
+	}
+}
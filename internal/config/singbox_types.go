@@ -51,11 +51,19 @@ type SBDNSServer struct {
 	// и строит невалидный URL "https://1.1.1.1%2Fdns-query/dns-query".
 	Path   string `json:"path,omitempty"`
 	Detour string `json:"detour,omitempty"` // маршрутизировать DNS через указанный outbound
+	// Inet4Range — подсеть фейковых адресов для type: fakeip.
+	Inet4Range string `json:"inet4_range,omitempty"`
+	// Predefined — статические записи для type: hosts.
+	Predefined map[string][]string `json:"predefined,omitempty"`
 }
 
 type SBDNSRule struct {
-	Inbound []string `json:"inbound,omitempty"`
-	Server  string   `json:"server"`
+	Inbound      []string `json:"inbound,omitempty"`
+	QueryType    []string `json:"query_type,omitempty"`
+	Domain       []string `json:"domain,omitempty"`
+	DomainSuffix []string `json:"domain_suffix,omitempty"`
+	RuleSet      []string `json:"rule_set,omitempty"`
+	Server       string   `json:"server"`
 }
 
 type SBInbound struct {
@@ -73,10 +81,17 @@ type SBInbound struct {
 	// Критично: без этого sing-box перехватывает собственные соединения к прокси-серверу
 	// → routing loop (тысячи соединений по 500-600 байт на один IP).
 	RouteExcludeAddress []string `json:"route_exclude_address,omitempty"`
+	// Users — учётные записи mixed/http/socks inbound; пусто — без авторизации.
+	Users []SBInboundUser `json:"users,omitempty"`
 	// Sniff и SniffOverrideDestination удалены: legacy inbound fields, deprecated в 1.11,
 	// removed в 1.13. Sniffing настраивается через route rule {Action: "sniff"}.
 }
 
+type SBInboundUser struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
 // SBMultiplex конфигурация мультиплексирования соединений.
 // Multiplex позволяет нескольким потокам данных использовать одно TLS соединение,
 // устраняя overhead нового TLS хендшейка (~50-100мс) для каждого соединения.
@@ -123,6 +138,15 @@ type SBOutbound struct {
 	TCPFastOpen  *bool          `json:"tcp_fast_open,omitempty"`
 	TCPMultiPath bool           `json:"tcp_multi_path,omitempty"`
 	TLSFragment  *SBTLSFragment `json:"-"`
+	// Detour — тег outbound'а, через который набирается этот (цепочка прокси).
+	Detour string `json:"detour,omitempty"`
+	// Поля групп (type: urltest / selector): список членов и параметры проверки.
+	Outbounds                 []string `json:"outbounds,omitempty"`
+	URL                       string   `json:"url,omitempty"`
+	Interval                  string   `json:"interval,omitempty"`
+	Tolerance                 int      `json:"tolerance,omitempty"`
+	Default                   string   `json:"default,omitempty"`
+	InterruptExistConnections bool     `json:"interrupt_exist_connections,omitempty"`
 }
 
 type SBObfs struct {
@@ -211,15 +235,28 @@ type SBRoute struct {
 }
 
 type SBRouteRule struct {
-	Protocol     string   `json:"protocol,omitempty"`
-	Network      string   `json:"network,omitempty"` // "tcp" | "udp"
-	Port         []uint16 `json:"port,omitempty"`    // порты для матчинга
-	ProcessName  []string `json:"process_name,omitempty"`
-	Domain       []string `json:"domain,omitempty"`
-	DomainSuffix []string `json:"domain_suffix,omitempty"`
-	IPCIDR       []string `json:"ip_cidr,omitempty"`
-	Inbound      []string `json:"inbound,omitempty"`
-	Action       string   `json:"action,omitempty"`
-	Outbound     string   `json:"outbound,omitempty"`
-	RuleSet      []string `json:"rule_set,omitempty"`
+	Protocol      string   `json:"protocol,omitempty"`
+	Network       string   `json:"network,omitempty"`    // "tcp" | "udp"
+	Port          []uint16 `json:"port,omitempty"`       // порты для матчинга
+	PortRange     []string `json:"port_range,omitempty"` // "8000:9000"
+	ProcessName   []string `json:"process_name,omitempty"`
+	ProcessPath   []string `json:"process_path,omitempty"`
+	Domain        []string `json:"domain,omitempty"`
+	DomainSuffix  []string `json:"domain_suffix,omitempty"`
+	DomainKeyword []string `json:"domain_keyword,omitempty"`
+	DomainRegex   []string `json:"domain_regex,omitempty"`
+	IPCIDR        []string `json:"ip_cidr,omitempty"`
+	Inbound       []string `json:"inbound,omitempty"`
+	Action        string   `json:"action,omitempty"`
+	Outbound      string   `json:"outbound,omitempty"`
+	RuleSet       []string `json:"rule_set,omitempty"`
+	SourceIPCIDR  []string `json:"source_ip_cidr,omitempty"`
+	Invert        bool     `json:"invert,omitempty"`
+	// Type "logical" объединяет вложенные Rules по Mode ("and" | "or").
+	Type  string        `json:"type,omitempty"`
+	Mode  string        `json:"mode,omitempty"`
+	Rules []SBRouteRule `json:"rules,omitempty"`
+
+	// ProcessPathRegex — правила приложений: паттерны apprules без учёта регистра.
+	ProcessPathRegex []string `json:"process_path_regex,omitempty"`
 }
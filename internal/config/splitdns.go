@@ -0,0 +1,218 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Встроенные DNS-серверы, на которые может ссылаться DNSOverride.Server.
+const (
+	DNSServerRemote = "remote"
+	DNSServerDirect = "direct"
+)
+
+// hostsDNSTag — тег сервера со статическими записями DNSConfig.Hosts.
+const hostsDNSTag = "hosts"
+
+// DNSOverride отправляет запросы к Domains на конкретный DNS-сервер.
+// Пример: {"domains": ["corp.local"], "server": "udp://10.0.0.53"} — офисный резолвер.
+type DNSOverride struct {
+	// Domains — домены (вместе с поддоменами) или "geosite:<категория>".
+	Domains []string `json:"domains"`
+	// Server — DNSServerRemote, DNSServerDirect или URL сервера
+	// (udp://, tcp://, tls://, https://, quic://). URL-серверы запрашиваются напрямую.
+	Server string `json:"server"`
+}
+
+var dnsURLSchemes = []string{"https://", "tls://", "udp://", "tcp://", "quic://"}
+
+// ValidateSplitDNS проверяет явные DNS-переопределения и статические hosts.
+func ValidateSplitDNS(cfg *DNSConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	for i, o := range cfg.Overrides {
+		if len(o.Domains) == 0 {
+			return fmt.Errorf("переопределение %d: не указаны домены", i+1)
+		}
+		switch o.Server {
+		case DNSServerRemote, DNSServerDirect:
+		default:
+			if !slices.ContainsFunc(dnsURLSchemes, func(s string) bool { return strings.HasPrefix(o.Server, s) }) {
+				return fmt.Errorf("переопределение %d: сервер %q — нужен remote, direct или URL со схемой %s",
+					i+1, o.Server, strings.Join(dnsURLSchemes, ", "))
+			}
+		}
+	}
+	for domain, ips := range cfg.Hosts {
+		if strings.TrimSpace(domain) == "" || len(ips) == 0 {
+			return fmt.Errorf("hosts: пустая запись %q", domain)
+		}
+		for _, ip := range ips {
+			if _, err := netip.ParseAddr(strings.TrimSpace(ip)); err != nil {
+				return fmt.Errorf("hosts: %s: неверный IP %q", domain, ip)
+			}
+		}
+	}
+	return nil
+}
+
+// sanitizeSplitDNS нормализует домены переопределений и hosts, отбрасывая
+// записи, которые sing-box не примет.
+func sanitizeSplitDNS(cfg *DNSConfig) {
+	overrides := cfg.Overrides[:0]
+	for _, o := range cfg.Overrides {
+		o.Server = strings.TrimSpace(o.Server)
+		o.Domains = normalizeDNSDomains(o.Domains)
+		if len(o.Domains) == 0 || o.Server == "" {
+			continue
+		}
+		overrides = append(overrides, o)
+	}
+	cfg.Overrides = overrides
+	if len(cfg.Hosts) == 0 {
+		return
+	}
+	hosts := make(map[string][]string, len(cfg.Hosts))
+	for domain, ips := range cfg.Hosts {
+		domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		var valid []string
+		for _, ip := range ips {
+			if addr, err := netip.ParseAddr(strings.TrimSpace(ip)); err == nil {
+				valid = append(valid, addr.String())
+			}
+		}
+		if domain != "" && len(valid) > 0 {
+			hosts[domain] = valid
+		}
+	}
+	cfg.Hosts = hosts
+}
+
+func normalizeDNSDomains(domains []string) []string {
+	seen := make(map[string]bool, len(domains))
+	out := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.TrimSpace(d)
+		if !strings.HasPrefix(d, "geosite:") {
+			d = strings.TrimPrefix(strings.ToLower(NormalizeRuleValue(d)), ".")
+		}
+		if d == "" || d == "geosite:" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		out = append(out, d)
+	}
+	return out
+}
+
+// splitDomains делит домены переопределения на суффиксы и теги geosite rule-set'ов.
+func splitDomains(domains []string) (suffixes, ruleSets []string) {
+	for _, d := range domains {
+		if name, ok := strings.CutPrefix(d, "geosite:"); ok {
+			ruleSets = append(ruleSets, "geosite-"+name)
+		} else {
+			suffixes = append(suffixes, d)
+		}
+	}
+	return suffixes, ruleSets
+}
+
+// dnsServerFromURL превращает URL DNS-сервера в запись dns.servers.
+func dnsServerFromURL(tag, url string) SBDNSServer {
+	if strings.HasPrefix(url, "udp://") || strings.HasPrefix(url, "tcp://") {
+		server, port, typ := parseDNSURLWithPort(url)
+		return SBDNSServer{Tag: tag, Type: typ, Server: server, ServerPort: port}
+	}
+	server, path, typ := parseDNSURL(url)
+	return SBDNSServer{Tag: tag, Type: typ, Server: server, Path: path}
+}
+
+// buildDNSOverrides собирает сервер hosts, серверы переопределений и их правила.
+// Правила должны стоять раньше остальных: явная настройка пользователя важнее
+// автоматического split DNS и FakeIP.
+func buildDNSOverrides(dnsCfg *DNSConfig) ([]SBDNSServer, []SBDNSRule) {
+	var servers []SBDNSServer
+	var rules []SBDNSRule
+	if len(dnsCfg.Hosts) > 0 {
+		domains := make([]string, 0, len(dnsCfg.Hosts))
+		for d := range dnsCfg.Hosts {
+			domains = append(domains, d)
+		}
+		slices.Sort(domains)
+		servers = append(servers, SBDNSServer{Tag: hostsDNSTag, Type: "hosts", Predefined: dnsCfg.Hosts})
+		rules = append(rules, SBDNSRule{Domain: domains, Server: hostsDNSTag})
+	}
+	tags := map[string]string{}
+	for _, o := range dnsCfg.Overrides {
+		tag := o.Server
+		switch o.Server {
+		case DNSServerRemote:
+		case DNSServerDirect:
+			tag = "direct-dns"
+		default:
+			var ok bool
+			if tag, ok = tags[o.Server]; !ok {
+				tag = fmt.Sprintf("dns-override%d", len(tags)+1)
+				tags[o.Server] = tag
+				servers = append(servers, dnsServerFromURL(tag, o.Server))
+			}
+		}
+		suffixes, ruleSets := splitDomains(o.Domains)
+		if len(suffixes) > 0 {
+			rules = append(rules, SBDNSRule{DomainSuffix: suffixes, Server: tag})
+		}
+		if len(ruleSets) > 0 {
+			rules = append(rules, SBDNSRule{RuleSet: ruleSets, Server: tag})
+		}
+	}
+	return servers, rules
+}
+
+// buildSplitDNSRules выводит DNS-правила из правил маршрутизации: домены,
+// которые идут напрямую, резолвятся через direct-dns (CDN отдаёт ближайший к
+// пользователю узел), проксируемые — через remote. Порядок повторяет buildRoute:
+// сначала домены, потом geosite, direct раньше proxy. Остальное уходит в final
+// (remote) даже при DefaultAction == direct: трафик process-правил может идти
+// через прокси, а DNS-запрос по процессу надёжно не сопоставить.
+// Удалённые rule-set'ы (ruleset:) и geoip: не участвуют: в них бывают ip_cidr, а в
+// DNS-правилах sing-box сверяет их с адресами ответа, а не с запросом.
+func buildSplitDNSRules(routingCfg *RoutingConfig) []SBDNSRule {
+	if routingCfg == nil || routingCfg.BypassEnabled {
+		return nil
+	}
+	var directSuf, proxySuf, directSets, proxySets []string
+	for _, rule := range routingCfg.Rules {
+		var suf, sets *[]string
+		switch rule.Action {
+		case ActionDirect:
+			suf, sets = &directSuf, &directSets
+		case ActionProxy:
+			suf, sets = &proxySuf, &proxySets
+		default:
+			continue
+		}
+		switch rule.Type {
+		case RuleTypeDomain:
+			*suf = append(*suf, strings.TrimPrefix(rule.Value, "."))
+		case RuleTypeGeosite:
+			*sets = append(*sets, "geosite-"+strings.TrimPrefix(rule.Value, "geosite:"))
+		}
+	}
+	var rules []SBDNSRule
+	if len(directSuf) > 0 {
+		rules = append(rules, SBDNSRule{DomainSuffix: directSuf, Server: "direct-dns"})
+	}
+	if len(proxySuf) > 0 {
+		rules = append(rules, SBDNSRule{DomainSuffix: proxySuf, Server: "remote"})
+	}
+	if len(directSets) > 0 {
+		rules = append(rules, SBDNSRule{RuleSet: directSets, Server: "direct-dns"})
+	}
+	if len(proxySets) > 0 {
+		rules = append(rules, SBDNSRule{RuleSet: proxySets, Server: "remote"})
+	}
+	return rules
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestGenerateSingBoxConfig_SplitDNS(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "secret.key")
+	mustWriteFile(t, secretPath, []byte(
+		"vless://12345678-1234-1234-1234-123456789abc@example.com:443?sni=www.google.com&pbk=testkey&sid=abc",
+	))
+	t.Chdir(dir)
+	if err := os.MkdirAll(DataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mustWriteFile(t, filepath.Join(DataDir, "geosite-ru.bin"), []byte("SRS\x01"))
+	mustWriteFile(t, filepath.Join(DataDir, "geosite-corp.bin"), []byte("SRS\x01"))
+
+	dns := DefaultDNSConfig()
+	dns.Overrides = []DNSOverride{
+		{Domains: []string{".Corp.Local", "geosite:corp"}, Server: "udp://10.0.0.53"},
+		{Domains: []string{"intranet.example"}, Server: "udp://10.0.0.53"},
+		{Domains: []string{"geosite:missing"}, Server: DNSServerDirect},
+	}
+	dns.Hosts = map[string][]string{"NAS.lan": {"192.168.1.10", "bogus"}}
+	cfg := &RoutingConfig{
+		DefaultAction: ActionProxy,
+		DNS:           dns,
+		Rules: []RoutingRule{
+			{Value: "yandex.ru", Type: RuleTypeDomain, Action: ActionDirect},
+			{Value: "youtube.com", Type: RuleTypeDomain, Action: ActionProxy},
+			{Value: "ads.example", Type: RuleTypeDomain, Action: ActionBlock},
+			{Value: "geosite:ru", Type: RuleTypeGeosite, Action: ActionDirect},
+			{Value: "chrome.exe", Type: RuleTypeProcess, Action: ActionProxy},
+		},
+	}
+	SanitizeRoutingConfig(cfg)
+	outputPath := filepath.Join(dir, "out.json")
+	if err := GenerateSingBoxConfig(secretPath, outputPath, cfg); err != nil {
+		t.Fatalf("GenerateSingBoxConfig: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out SingBoxConfig
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	servers := map[string]SBDNSServer{}
+	for _, s := range out.DNS.Servers {
+		servers[s.Tag] = s
+	}
+	if s := servers["dns-override1"]; s.Type != "udp" || s.Server != "10.0.0.53" || s.ServerPort != 53 || s.Detour != "" {
+		t.Errorf("office resolver = %+v", s)
+	}
+	if _, ok := servers["dns-override2"]; ok {
+		t.Error("one server per distinct URL expected")
+	}
+	if ips := servers["hosts"].Predefined["nas.lan"]; len(ips) != 1 || ips[0] != "192.168.1.10" {
+		t.Errorf("hosts = %+v", servers["hosts"])
+	}
+
+	type rule struct {
+		server string
+		match  []string
+	}
+	var got []rule
+	for _, r := range out.DNS.Rules {
+		match := slices.Concat(r.Inbound, r.Domain, r.DomainSuffix, r.RuleSet)
+		got = append(got, rule{r.Server, match})
+	}
+	want := []rule{
+		{"hosts", []string{"nas.lan"}},
+		{"dns-override1", []string{"corp.local"}},
+		{"dns-override1", []string{"geosite-corp"}},
+		{"dns-override1", []string{"intranet.example"}},
+		// geosite:missing без файла — правило выброшено вместе с rule-set'ом.
+		{"direct-dns", []string{"http-in"}},
+		{"direct-dns", []string{"yandex.ru"}},
+		{"remote", []string{"youtube.com"}},
+		{"direct-dns", []string{"geosite-ru"}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("dns rules = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].server != want[i].server || !slices.Equal(got[i].match, want[i].match) {
+			t.Errorf("dns rule %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if out.DNS.Final != "remote" {
+		t.Errorf("dns.final = %q, want remote", out.DNS.Final)
+	}
+
+	var declared []string
+	for _, rs := range out.Route.RuleSet {
+		declared = append(declared, rs.Tag)
+	}
+	if !slices.Contains(declared, "geosite-corp") || slices.Contains(declared, "geosite-missing") {
+		t.Errorf("route.rule_set = %v", declared)
+	}
+}
+
+func TestValidateSplitDNS(t *testing.T) {
+	bad := []*DNSConfig{
+		{Overrides: []DNSOverride{{Server: "remote"}}},
+		{Overrides: []DNSOverride{{Domains: []string{"corp.local"}, Server: "10.0.0.53"}}},
+		{Hosts: map[string][]string{"nas.lan": {"not-an-ip"}}},
+		{Hosts: map[string][]string{"": {"192.168.1.1"}}},
+	}
+	for i, cfg := range bad {
+		if ValidateSplitDNS(cfg) == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+	ok := &DNSConfig{
+		Overrides: []DNSOverride{
+			{Domains: []string{"corp.local"}, Server: "tls://10.0.0.53"},
+			{Domains: []string{"geosite:cn"}, Server: DNSServerDirect},
+		},
+		Hosts: map[string][]string{"nas.lan": {"192.168.1.10", "fd00::10"}},
+	}
+	if err := ValidateSplitDNS(ok); err != nil {
+		t.Errorf("ValidateSplitDNS: %v", err)
+	}
+}
+
+func TestBuildSplitDNSRules_Bypass(t *testing.T) {
+	cfg := &RoutingConfig{
+		BypassEnabled: true,
+		Rules:         []RoutingRule{{Value: "yandex.ru", Type: RuleTypeDomain, Action: ActionDirect}},
+	}
+	if rules := buildSplitDNSRules(cfg); len(rules) != 0 {
+		t.Errorf("bypass mode ignores routing rules, got %+v", rules)
+	}
+}
@@ -18,6 +18,20 @@ const (
 	RuleTypeDomain  RuleType = "domain"
 	RuleTypeIP      RuleType = "ip"
 	RuleTypeGeosite RuleType = "geosite"
+	// RuleTypeRuleSet — ссылка на удалённый rule-set: "ruleset:<tag>".
+	RuleTypeRuleSet RuleType = "ruleset"
+	// RuleTypeProcessPath — полный путь к исполняемому файлу: "C:\Apps\app.exe".
+	RuleTypeProcessPath RuleType = "process_path"
+	// RuleTypeGeoIP — страна по IP назначения: "geoip:ru" (файл data/geoip-ru.bin).
+	RuleTypeGeoIP RuleType = "geoip"
+	// RuleTypeKeyword — подстрока в домене: "keyword:cdn".
+	RuleTypeKeyword RuleType = "keyword"
+	// RuleTypeRegex — регулярное выражение для домена: "regex:^ads?\d+\.".
+	RuleTypeRegex RuleType = "regex"
+	// RuleTypePort — порт или диапазон портов назначения: "port:443", "port:8000-9000".
+	RuleTypePort RuleType = "port"
+	// RuleTypeNetwork — транспорт: "network:tcp" или "network:udp".
+	RuleTypeNetwork RuleType = "network"
 )
 
 // RuleAction действие
@@ -35,6 +49,11 @@ type RoutingRule struct {
 	Type   RuleType   `json:"type"`
 	Action RuleAction `json:"action"`
 	Note   string     `json:"note,omitempty"`
+	// Server — ID сохранённого сервера (servers.json), через который идёт proxy-правило.
+	// Пусто — основной сервер (proxy-out). Для direct/block не используется.
+	Server string `json:"server,omitempty"`
+	// Group — ID группы серверов (RoutingConfig.Groups). Имеет приоритет над Server.
+	Group string `json:"group,omitempty"`
 }
 
 // B-7: DNSConfig конфигурирует DNS для sing-box.
@@ -44,6 +63,12 @@ type DNSConfig struct {
 	RemoteDNS         string   `json:"remote_dns"` // Default: "https://1.1.1.1/dns-query"
 	DirectDNS         string   `json:"direct_dns"` // Default: "udp://8.8.8.8"
 	RemoteDNSFallback []string `json:"remote_dns_fallback,omitempty"`
+	// FakeIP — opt-in режим FakeIP для TUN. nil — выключен.
+	FakeIP *FakeIPConfig `json:"fakeip,omitempty"`
+	// Overrides — явные DNS-серверы для доменов; важнее правил, выведенных из маршрутизации.
+	Overrides []DNSOverride `json:"overrides,omitempty"`
+	// Hosts — статические записи: домен → IP-адреса.
+	Hosts map[string][]string `json:"hosts,omitempty"`
 }
 
 // B-7: DefaultDNSConfig возвращает конфиг DNS по умолчанию
@@ -74,6 +99,31 @@ type RoutingConfig struct {
 	BlockTelemetry  bool       `json:"block_telemetry,omitempty"`
 	LANShareEnabled bool       `json:"lan_share_enabled,omitempty"`
 	LANSharePort    int        `json:"lan_share_port,omitempty"`
+	// LANUsers — логины для раздачи в LAN; пусто — вход без пароля.
+	LANUsers []LANUser `json:"lan_users,omitempty"`
+	// LANAllowCIDRs — адреса клиентов LAN, которым разрешён вход; пусто — любые.
+	LANAllowCIDRs []string `json:"lan_allow_cidrs,omitempty"`
+	// LANPolicy — маршрутизация клиентов LAN: общие правила или всё через прокси.
+	LANPolicy LANPolicy `json:"lan_policy,omitempty"`
+	// Groups — группы серверов (urltest/selector), на которые могут ссылаться правила.
+	Groups []ServerGroup `json:"groups,omitempty"`
+	// DefaultGroup — группа для трафика по умолчанию при DefaultAction == proxy.
+	// Пусто — основной сервер (proxy-out).
+	DefaultGroup string `json:"default_group,omitempty"`
+	// RuleSets — удалённые rule-set'ы, на которые ссылаются правила "ruleset:<tag>".
+	RuleSets []RemoteRuleSet `json:"rule_sets,omitempty"`
+	// IPv6Mode — обработка IPv6: ipv4-only (по умолчанию), prefer-ipv4, dual-stack.
+	IPv6Mode IPv6Mode `json:"ipv6_mode,omitempty"`
+	// ProxyOnly — режим без TUN: только локальные inbound'ы (HTTP и mixed),
+	// трафик попадает в sing-box через системный прокси. Не нужны права
+	// администратора и драйвер wintun.
+	ProxyOnly bool `json:"proxy_only,omitempty"`
+	// AppInbounds — выделенные порты правил приложений. Не хранится в
+	// routing.json: GenerateSingBoxConfig читает их из AppRulesFile.
+	AppInbounds []AppInbound `json:"-"`
+	// AppProcessRules — включённые правила приложений в порядке приоритета.
+	// Тоже читаются из AppRulesFile.
+	AppProcessRules []AppProcessRule `json:"-"`
 }
 
 func DefaultRoutingConfig() *RoutingConfig {
@@ -102,17 +152,29 @@ func LoadRoutingConfig(path string) (*RoutingConfig, error) {
 	if !strings.Contains(string(data), `"block_quic"`) {
 		cfg.BlockQUIC = true
 	}
+	if err := unprotectLANUsers(cfg.LANUsers); err != nil {
+		return nil, fmt.Errorf("неверный формат routing config: %w", err)
+	}
 	SanitizeRoutingConfig(&cfg)
 	return &cfg, nil
 }
 
+// ProxyOnlyEnabled сообщает, включён ли в routing.json режим без TUN.
+// Нечитаемый файл — обычный режим с TUN.
+func ProxyOnlyEnabled(path string) bool {
+	cfg, err := LoadRoutingConfig(path)
+	return err == nil && cfg.ProxyOnly
+}
+
 // NormalizeRuleValue канонизирует значение правила:
 // убирает URL-схему (https://, http://), query-параметры, fragment, порт и trailing slash.
 // Например: "https://2ip.ru/" → "2ip.ru"
 //
 //	"http://example.com:8080/path?q=1" → "example.com"
 //
-// Процессы (.exe) и geosite: префиксы не затрагиваются.
+// Процессы (.exe), geosite: и ruleset: префиксы не затрагиваются.
+// Значения с префиксом типа (geoip:, keyword:, regex:, port:, network:)
+// приводятся к каноническому виду; невалидные — к пустой строке.
 func NormalizeRuleValue(val string) string {
 	val = strings.TrimSpace(val)
 
@@ -168,9 +230,14 @@ func NormalizeRuleValue(val string) string {
 	}
 
 	lower := strings.ToLower(val)
-	if strings.HasPrefix(lower, "geosite:") {
+	if strings.HasPrefix(lower, "geosite:") || strings.HasPrefix(lower, "ruleset:") || strings.HasPrefix(lower, "geoip:") {
 		return lower
 	}
+	if kind, _, ok := strings.Cut(lower, ":"); ok && typedRulePrefixes[kind] {
+		// regex: сохраняет регистр — \D и \d в выражении не одно и то же.
+		_, rest, _ := strings.Cut(val, ":")
+		return normalizeTypedRuleValue(kind, rest)
+	}
 
 	lower = strings.ToLower(val)
 	switch {
@@ -225,7 +292,9 @@ func SanitizeRoutingConfig(cfg *RoutingConfig) {
 	}
 	validTypes := map[RuleType]bool{
 		RuleTypeProcess: true, RuleTypeDomain: true,
-		RuleTypeIP: true, RuleTypeGeosite: true,
+		RuleTypeIP: true, RuleTypeGeosite: true, RuleTypeRuleSet: true,
+		RuleTypeProcessPath: true, RuleTypeGeoIP: true, RuleTypeKeyword: true,
+		RuleTypeRegex: true, RuleTypePort: true, RuleTypeNetwork: true,
 	}
 	if !IsValidRuleAction(cfg.DefaultAction) {
 		cfg.DefaultAction = ActionProxy
@@ -254,13 +323,43 @@ func SanitizeRoutingConfig(cfg *RoutingConfig) {
 		}
 		// Специальный случай: geosite-правило классифицировано как process (редко,
 		// но возможно при старых форматах данных)
-		if rule.Type == RuleTypeGeosite && detectedFromOriginal == RuleTypeProcess {
+		if (rule.Type == RuleTypeGeosite || rule.Type == RuleTypeRuleSet) && detectedFromOriginal == RuleTypeProcess {
 			rule.Type = RuleTypeProcess
 		}
+		// Полный путь в process-правиле никогда не совпадал с process_name —
+		// такие правила становятся process_path, и наоборот.
+		if IsProcessRuleType(rule.Type) && IsProcessRuleType(detectedFromOriginal) {
+			rule.Type = detectedFromOriginal
+		}
 		if !IsValidRuleAction(rule.Action) {
 			rule.Action = ActionProxy
 		}
+		rule.Server = strings.TrimSpace(rule.Server)
+		rule.Group = strings.TrimSpace(rule.Group)
+		if rule.Action != ActionProxy {
+			rule.Server = ""
+			rule.Group = ""
+		}
+		if rule.Group != "" {
+			rule.Server = ""
+		}
 	}
+	if cfg.DNS != nil {
+		sanitizeFakeIP(cfg.DNS.FakeIP)
+		sanitizeSplitDNS(cfg.DNS)
+	}
+	cfg.Groups = sanitizeServerGroups(cfg.Groups)
+	cfg.RuleSets = sanitizeRemoteRuleSets(cfg.RuleSets)
+	cfg.DefaultGroup = strings.TrimSpace(cfg.DefaultGroup)
+	if cfg.DefaultAction != ActionProxy {
+		cfg.DefaultGroup = ""
+	}
+	// ipv4-only — значение по умолчанию, в routing.json его не пишем.
+	cfg.IPv6Mode = NormalizeIPv6Mode(cfg.IPv6Mode)
+	if cfg.IPv6Mode == IPv6ModeIPv4Only {
+		cfg.IPv6Mode = ""
+	}
+	sanitizeLANShare(cfg)
 }
 
 func IsValidRuleAction(action RuleAction) bool {
@@ -277,6 +376,14 @@ func IsValidRuleAction(action RuleAction) bool {
 func SaveRoutingConfig(path string, cfg *RoutingConfig) error {
 	if cfg != nil {
 		SanitizeRoutingConfig(cfg)
+		// Пароли LAN пишутся зашифрованными, cfg остаётся с открытыми.
+		users, err := protectLANUsers(cfg.LANUsers)
+		if err != nil {
+			return fmt.Errorf("не удалось сохранить routing config: %w", err)
+		}
+		stored := *cfg
+		stored.LANUsers = users
+		cfg = &stored
 	}
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
@@ -292,15 +399,28 @@ func SaveRoutingConfig(path string, cfg *RoutingConfig) error {
 // Работает с raw значением (без strip комментариев) — инвариант фаззера:
 // если TrimSpace(ToLower(input)) заканчивается на ".exe", должен вернуть process.
 // NormalizeRuleValue тоже проверяет .exe до strip комментариев, поэтому
-// DetectRuleType(input) == DetectRuleType(NormalizeRuleValue(input)) для process/geosite.
+// DetectRuleType(input) == DetectRuleType(NormalizeRuleValue(input)) для process/geosite/ruleset.
+// .exe с разделителем пути — process_path, без него — process.
 func DetectRuleType(value string) RuleType {
 	v := strings.ToLower(strings.TrimSpace(value))
 	if strings.HasSuffix(v, ".exe") {
+		if strings.ContainsAny(v, `\/`) {
+			return RuleTypeProcessPath
+		}
 		return RuleTypeProcess
 	}
 	if strings.HasPrefix(v, "geosite:") {
 		return RuleTypeGeosite
 	}
+	if strings.HasPrefix(v, "ruleset:") {
+		return RuleTypeRuleSet
+	}
+	if strings.HasPrefix(v, "geoip:") {
+		return RuleTypeGeoIP
+	}
+	if kind, _, ok := strings.Cut(v, ":"); ok && typedRulePrefixes[kind] {
+		return RuleType(kind)
+	}
 	if isIPOrCIDR(v) {
 		return RuleTypeIP
 	}
@@ -49,11 +49,17 @@ var (
 )
 
 func warnVLESS(format string, args ...interface{}) {
+	warnConfig("vless: "+format, args...)
+}
+
+// warnConfig — предупреждение при разборе ключей и сборке конфига, которое
+// не должно прерывать запуск.
+func warnConfig(format string, args ...interface{}) {
 	vlessLoggerMu.Lock()
 	log := vlessLogger
 	vlessLoggerMu.Unlock()
 	if log != nil {
-		log.Warn("vless: "+format, args...)
+		log.Warn(format, args...)
 	}
 }
 
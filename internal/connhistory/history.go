@@ -13,6 +13,8 @@ const (
 	EventFailover   EventKind = "failover"
 	EventReconnect  EventKind = "reconnect"
 	EventNetChange  EventKind = "net_change"
+	// EventQuota — сработал порог трафика или срока подписки.
+	EventQuota EventKind = "quota"
 )
 
 type Event struct {
@@ -24,8 +26,10 @@ type Event struct {
 }
 
 type History struct {
-	mu     sync.RWMutex
-	events []Event
+	mu      sync.RWMutex
+	events  []Event
+	subs    map[int]func(Event)
+	nextSub int
 }
 
 var Global = &History{}
@@ -37,6 +41,27 @@ func (h *History) Add(e Event) {
 	if len(h.events) > 100 {
 		h.events = h.events[len(h.events)-100:]
 	}
+	for _, fn := range h.subs {
+		fn(e)
+	}
+}
+
+// Subscribe регистрирует fn для новых событий. fn вызывается под мьютексом
+// истории и не должна обращаться к её методам. Возвращает функцию отписки.
+func (h *History) Subscribe(fn func(Event)) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[int]func(Event))
+	}
+	id := h.nextSub
+	h.nextSub++
+	h.subs[id] = fn
+	return func() {
+		h.mu.Lock()
+		delete(h.subs, id)
+		h.mu.Unlock()
+	}
 }
 
 func (h *History) All() []Event {
@@ -38,6 +38,9 @@ type Log struct {
 	head int
 	// size — текущее число заполненных слотов
 	size int
+	// subs — подписчики на новые события (SSE /api/stream).
+	subs    map[int]func(Event)
+	nextSub int
 }
 
 // New создаёт буфер на maxSize событий
@@ -79,6 +82,29 @@ func (l *Log) Add(level Level, source, format string, args ...interface{}) {
 		l.events[l.head] = e
 		l.head = (l.head + 1) % l.maxSize
 	}
+	for _, fn := range l.subs {
+		fn(e)
+	}
+}
+
+// Subscribe регистрирует fn, вызываемую для каждого нового события.
+// fn вызывается под мьютексом буфера — так подписчик видит события в порядке ID;
+// она должна быть быстрой и не обращаться к методам Log.
+// Возвращает функцию отписки.
+func (l *Log) Subscribe(fn func(Event)) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subs == nil {
+		l.subs = make(map[int]func(Event))
+	}
+	id := l.nextSub
+	l.nextSub++
+	l.subs[id] = fn
+	return func() {
+		l.mu.Lock()
+		delete(l.subs, id)
+		l.mu.Unlock()
+	}
 }
 
 // GetSince возвращает события с ID > since в хронологическом порядке.
@@ -485,3 +485,27 @@ func TestLog_ConcurrentClearAndAdd(t *testing.T) {
 		}
 	}
 }
+
+// ─── Подписка ──────────────────────────────────────────────────────────────
+
+func TestLog_Subscribe_ReceivesNewEventsUntilCancelled(t *testing.T) {
+	l := New(10)
+	l.Add(LevelInfo, "test", "before")
+
+	var got []Event
+	cancel := l.Subscribe(func(e Event) { got = append(got, e) })
+	l.Add(LevelWarn, "test", "first")
+	l.Add(LevelError, "test", "second")
+	cancel()
+	l.Add(LevelInfo, "test", "after")
+
+	if len(got) != 2 {
+		t.Fatalf("subscriber got %d events, want 2", len(got))
+	}
+	if got[0].Message != "first" || got[1].Message != "second" {
+		t.Errorf("subscriber events = %+v", got)
+	}
+	if got[0].ID >= got[1].ID {
+		t.Errorf("events out of order: %d, %d", got[0].ID, got[1].ID)
+	}
+}
@@ -43,9 +43,20 @@ var DefaultWeights = Weights{Latency: 0.5, Loss: 0.3, Success: 0.2}
 
 type ProbeFunc func(ctx context.Context, target ServerTarget) (time.Duration, error)
 
+// Observation — результат одной проверки сервера вместе с пересчитанным score.
+type Observation struct {
+	ID      string
+	Time    time.Time
+	Latency time.Duration
+	OK      bool
+	Score   float64
+}
+
 type Monitor struct {
 	mu        sync.RWMutex
 	health    map[string]*state
+	subs      map[int]func(Observation)
+	nextSub   int
 	now       func() time.Time
 	probe     ProbeFunc
 	targetsFn func() []ServerTarget
@@ -152,6 +163,31 @@ func (m *Monitor) Record(id string, latency time.Duration, ok bool) {
 	}
 	h.PacketLoss = float64(h.failures) / float64(h.checks)
 	h.Uptime = float64(h.success) / float64(h.checks)
+	if len(m.subs) == 0 {
+		return
+	}
+	obs := Observation{ID: id, Time: now, Latency: latency, OK: ok, Score: Score(h.ServerHealth, m.weights, now)}
+	for _, fn := range m.subs {
+		fn(obs)
+	}
+}
+
+// Subscribe регистрирует fn для каждой записанной проверки. fn вызывается под
+// мьютексом монитора и не должна обращаться к его методам. Возвращает функцию отписки.
+func (m *Monitor) Subscribe(fn func(Observation)) func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.subs == nil {
+		m.subs = make(map[int]func(Observation))
+	}
+	id := m.nextSub
+	m.nextSub++
+	m.subs[id] = fn
+	return func() {
+		m.mu.Lock()
+		delete(m.subs, id)
+		m.mu.Unlock()
+	}
 }
 
 func (m *Monitor) MarkFailure(id string) {
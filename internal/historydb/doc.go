@@ -0,0 +1,4 @@
+// Package historydb persists per-server latency samples, health scores and
+// connection lifecycle events in a local SQLite database so that latency
+// percentiles and availability survive restarts.
+package historydb
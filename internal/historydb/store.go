@@ -0,0 +1,481 @@
+package historydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/connhistory"
+	"proxyclient/internal/healthmonitor"
+	"proxyclient/internal/latency"
+	"proxyclient/internal/logger"
+)
+
+// DefaultFile — база истории рядом с остальными данными приложения.
+const DefaultFile = config.DataDir + "/history.db"
+
+const (
+	// queueSize — буфер записей; при переполнении замеры отбрасываются, а не
+	// блокируют источник (Record* вызываются под мьютексами трекеров).
+	queueSize     = 1024
+	maxBatch      = 256
+	pruneInterval = time.Hour
+)
+
+// ErrClosed — писатель истории остановлен.
+var ErrClosed = errors.New("history store is closed")
+
+// SampleKind — источник замера задержки.
+type SampleKind string
+
+const (
+	// SamplePing — периодический ping-all (latency.Tracker).
+	SamplePing SampleKind = "ping"
+	// SampleHealth — проверка healthmonitor, вместе со score.
+	SampleHealth SampleKind = "health"
+)
+
+type sample struct {
+	ts        int64
+	serverID  string
+	kind      SampleKind
+	latencyMs int64
+	ok        bool
+	score     sql.NullFloat64
+}
+
+// record — элемент очереди писателя. flushed != nil — маркер Flush.
+type record struct {
+	sample  *sample
+	event   *connhistory.Event
+	flushed chan struct{}
+}
+
+// Store — SQLite-история замеров и событий подключения. Запись асинхронная:
+// Record* только ставят данные в очередь, пишет их горутина Start.
+type Store struct {
+	db        *sql.DB
+	queue     chan record
+	done      chan struct{}
+	startOnce sync.Once
+	retention atomic.Int64
+	dropped   atomic.Int64
+	now       func() time.Time
+}
+
+// Open открывает (создаёт) базу истории по пути path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("history db dir: %w", err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// Одно соединение: писатель и запросы API не конкурируют за блокировку файла.
+	db.SetMaxOpenConns(1)
+	if err := initSchema(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	s := &Store{
+		db:    db,
+		queue: make(chan record, queueSize),
+		done:  make(chan struct{}),
+		now:   time.Now,
+	}
+	s.SetRetentionDays(config.DefaultHistoryRetentionDays)
+	return s, nil
+}
+
+func initSchema(db *sql.DB) error {
+	stmts := []string{
+		`PRAGMA journal_mode=WAL`,
+		`PRAGMA busy_timeout=5000`,
+		`CREATE TABLE IF NOT EXISTS samples (
+			ts INTEGER NOT NULL,
+			server_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			latency_ms INTEGER NOT NULL,
+			ok INTEGER NOT NULL,
+			score REAL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_samples_ts ON samples(ts)`,
+		`CREATE INDEX IF NOT EXISTS idx_samples_server_ts ON samples(server_id, ts)`,
+		`CREATE TABLE IF NOT EXISTS events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ts INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			server TEXT NOT NULL DEFAULT '',
+			latency_ms INTEGER NOT NULL DEFAULT 0,
+			reason TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_events_ts ON events(ts)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("history db schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetRetentionDays задаёт срок хранения; значение приводится к
+// [1, config.MaxHistoryRetentionDays]. Применяется при следующей очистке.
+func (s *Store) SetRetentionDays(days int) {
+	if days <= 0 {
+		days = config.DefaultHistoryRetentionDays
+	}
+	if days > config.MaxHistoryRetentionDays {
+		days = config.MaxHistoryRetentionDays
+	}
+	s.retention.Store(int64(days))
+}
+
+// RetentionDays возвращает текущий срок хранения.
+func (s *Store) RetentionDays() int {
+	return int(s.retention.Load())
+}
+
+// Start запускает писателя. Когда ctx завершается, писатель дописывает
+// очередь и закрывает базу. Повторные вызовы ничего не делают.
+func (s *Store) Start(ctx context.Context, log logger.Logger) {
+	if log == nil {
+		log = logger.NewNop()
+	}
+	s.startOnce.Do(func() {
+		go s.run(ctx, log)
+	})
+}
+
+func (s *Store) run(ctx context.Context, log logger.Logger) {
+	defer close(s.done)
+	defer func() {
+		if err := s.db.Close(); err != nil {
+			log.Warn("history db close: %v", err)
+		}
+	}()
+	s.pruneAndLog(log)
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				batch := s.collect(nil)
+				if len(batch) == 0 {
+					return
+				}
+				s.writeAndLog(batch, log)
+			}
+		case r := <-s.queue:
+			s.writeAndLog(s.collect([]record{r}), log)
+		case <-ticker.C:
+			s.pruneAndLog(log)
+		}
+	}
+}
+
+// collect добирает из очереди всё, что уже лежит в ней, не больше maxBatch.
+func (s *Store) collect(batch []record) []record {
+	for len(batch) < maxBatch {
+		select {
+		case r := <-s.queue:
+			batch = append(batch, r)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (s *Store) writeAndLog(batch []record, log logger.Logger) {
+	if err := s.write(batch); err != nil {
+		log.Warn("history db write: %v", err)
+	}
+	for _, r := range batch {
+		if r.flushed != nil {
+			close(r.flushed)
+		}
+	}
+}
+
+func (s *Store) pruneAndLog(log logger.Logger) {
+	if n, err := s.prune(); err != nil {
+		log.Warn("history db prune: %v", err)
+	} else if n > 0 {
+		log.Debug("history db: удалено %d записей старше %d дн.", n, s.RetentionDays())
+	}
+	if n := s.dropped.Swap(0); n > 0 {
+		log.Warn("history db: очередь переполнена, отброшено %d записей", n)
+	}
+}
+
+func (s *Store) write(batch []record) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, r := range batch {
+		switch {
+		case r.sample != nil:
+			smp := r.sample
+			_, err = tx.Exec(`INSERT INTO samples(ts, server_id, kind, latency_ms, ok, score) VALUES(?, ?, ?, ?, ?, ?)`,
+				smp.ts, smp.serverID, string(smp.kind), smp.latencyMs, smp.ok, smp.score)
+		case r.event != nil:
+			e := r.event
+			_, err = tx.Exec(`INSERT INTO events(ts, kind, server, latency_ms, reason) VALUES(?, ?, ?, ?, ?)`,
+				e.Time.UnixMilli(), string(e.Kind), e.Server, e.LatencyMs, e.Reason)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// prune удаляет замеры и события старше срока хранения.
+func (s *Store) prune() (int64, error) {
+	cutoff := s.now().AddDate(0, 0, -s.RetentionDays()).UnixMilli()
+	var total int64
+	for _, stmt := range []string{
+		`DELETE FROM samples WHERE ts < ?`,
+		`DELETE FROM events WHERE ts < ?`,
+	} {
+		res, err := s.db.Exec(stmt, cutoff)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
+
+func (s *Store) enqueue(r record) {
+	select {
+	case s.queue <- r:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// RecordPing сохраняет замер latency.Tracker (Ms < 0 — сервер недоступен).
+// Сигнатура совпадает с latency.Tracker.Subscribe.
+func (s *Store) RecordPing(serverID string, p latency.Point) {
+	if serverID == "" {
+		return
+	}
+	ms := p.Ms
+	if ms < 0 {
+		ms = 0
+	}
+	s.enqueue(record{sample: &sample{
+		ts:        p.TS * 1000,
+		serverID:  serverID,
+		kind:      SamplePing,
+		latencyMs: ms,
+		ok:        p.Ms >= 0,
+	}})
+}
+
+// RecordHealth сохраняет проверку healthmonitor вместе со score.
+func (s *Store) RecordHealth(o healthmonitor.Observation) {
+	if o.ID == "" {
+		return
+	}
+	s.enqueue(record{sample: &sample{
+		ts:        o.Time.UnixMilli(),
+		serverID:  o.ID,
+		kind:      SampleHealth,
+		latencyMs: o.Latency.Milliseconds(),
+		ok:        o.OK,
+		score:     sql.NullFloat64{Float64: o.Score, Valid: true},
+	}})
+}
+
+// RecordEvent сохраняет событие connhistory.
+func (s *Store) RecordEvent(e connhistory.Event) {
+	if e.Time.IsZero() {
+		e.Time = s.now()
+	}
+	s.enqueue(record{event: &e})
+}
+
+// Flush ждёт, пока писатель сохранит всё, что было поставлено в очередь до вызова.
+func (s *Store) Flush(ctx context.Context) error {
+	r := record{flushed: make(chan struct{})}
+	select {
+	case s.queue <- r:
+	case <-s.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-r.flushed:
+		return nil
+	case <-s.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LatencyStat — распределение задержки сервера за период (только успешные замеры).
+type LatencyStat struct {
+	ServerID string `json:"server_id"`
+	Samples  int    `json:"samples"`
+	MinMs    int64  `json:"min_ms"`
+	AvgMs    int64  `json:"avg_ms"`
+	P50Ms    int64  `json:"p50_ms"`
+	P95Ms    int64  `json:"p95_ms"`
+	MaxMs    int64  `json:"max_ms"`
+}
+
+// LatencyStats возвращает перцентили задержки по серверам начиная с since.
+func (s *Store) LatencyStats(ctx context.Context, since time.Time) ([]LatencyStat, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT server_id, latency_ms FROM samples
+		 WHERE ts >= ? AND ok = 1 AND latency_ms > 0
+		 ORDER BY server_id, latency_ms`, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []LatencyStat{}
+	var current string
+	var values []int64
+	flush := func() {
+		if len(values) > 0 {
+			out = append(out, latencyStat(current, values))
+		}
+		values = values[:0]
+	}
+	for rows.Next() {
+		var id string
+		var ms int64
+		if err := rows.Scan(&id, &ms); err != nil {
+			return nil, err
+		}
+		if id != current {
+			flush()
+			current = id
+		}
+		values = append(values, ms)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return out, nil
+}
+
+// latencyStat считает статистику по отсортированным по возрастанию значениям.
+func latencyStat(id string, sorted []int64) LatencyStat {
+	var sum int64
+	for _, v := range sorted {
+		sum += v
+	}
+	return LatencyStat{
+		ServerID: id,
+		Samples:  len(sorted),
+		MinMs:    sorted[0],
+		AvgMs:    sum / int64(len(sorted)),
+		P50Ms:    percentile(sorted, 0.50),
+		P95Ms:    percentile(sorted, 0.95),
+		MaxMs:    sorted[len(sorted)-1],
+	}
+}
+
+// percentile — nearest-rank перцентиль отсортированного среза.
+func percentile(sorted []int64, p float64) int64 {
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// UptimeStat — доступность сервера за период по всем проверкам (ping и health).
+type UptimeStat struct {
+	ServerID  string    `json:"server_id"`
+	Checks    int       `json:"checks"`
+	Successes int       `json:"successes"`
+	UptimePct float64   `json:"uptime_pct"`
+	AvgScore  float64   `json:"avg_score"`
+	LastOK    time.Time `json:"last_ok,omitempty"`
+}
+
+// Uptime возвращает процент успешных проверок по серверам начиная с since.
+func (s *Store) Uptime(ctx context.Context, since time.Time) ([]UptimeStat, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT server_id, COUNT(*), SUM(ok), AVG(score), MAX(CASE WHEN ok = 1 THEN ts END)
+		 FROM samples WHERE ts >= ?
+		 GROUP BY server_id ORDER BY server_id`, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []UptimeStat{}
+	for rows.Next() {
+		var st UptimeStat
+		var score sql.NullFloat64
+		var lastOK sql.NullInt64
+		if err := rows.Scan(&st.ServerID, &st.Checks, &st.Successes, &score, &lastOK); err != nil {
+			return nil, err
+		}
+		if st.Checks > 0 {
+			st.UptimePct = math.Round(float64(st.Successes)*10000/float64(st.Checks)) / 100
+		}
+		st.AvgScore = score.Float64
+		if lastOK.Valid {
+			st.LastOK = time.UnixMilli(lastOK.Int64).UTC()
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+// Events возвращает события начиная с since, новые первыми. Пустой kind — все
+// типы; limit <= 0 — без ограничения.
+func (s *Store) Events(ctx context.Context, since time.Time, kind connhistory.EventKind, limit int) ([]connhistory.Event, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT ts, kind, server, latency_ms, reason FROM events
+		 WHERE ts >= ? AND (? = '' OR kind = ?)
+		 ORDER BY ts DESC, id DESC LIMIT ?`, since.UnixMilli(), string(kind), string(kind), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []connhistory.Event{}
+	for rows.Next() {
+		var e connhistory.Event
+		var ts int64
+		var k string
+		if err := rows.Scan(&ts, &k, &e.Server, &e.LatencyMs, &e.Reason); err != nil {
+			return nil, err
+		}
+		e.Time = time.UnixMilli(ts).UTC()
+		e.Kind = connhistory.EventKind(k)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
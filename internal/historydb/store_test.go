@@ -0,0 +1,127 @@
+package historydb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"proxyclient/internal/connhistory"
+	"proxyclient/internal/healthmonitor"
+	"proxyclient/internal/latency"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx, nil)
+	t.Cleanup(func() {
+		cancel()
+		<-s.done
+	})
+	return s
+}
+
+func flush(t *testing.T, s *Store) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+}
+
+func TestLatencyStatsAndUptime(t *testing.T) {
+	s := openTestStore(t)
+	now := time.Now()
+	for i := 1; i <= 20; i++ {
+		s.RecordPing("a", latency.Point{TS: now.Unix(), Ms: int64(i * 10)})
+	}
+	s.RecordPing("a", latency.Point{TS: now.Unix(), Ms: -1})
+	s.RecordHealth(healthmonitor.Observation{ID: "b", Time: now, Latency: 40 * time.Millisecond, OK: true, Score: 0.8})
+	s.RecordHealth(healthmonitor.Observation{ID: "b", Time: now, OK: false, Score: 0.4})
+	// Замер за пределами окна запроса.
+	s.RecordPing("a", latency.Point{TS: now.AddDate(0, 0, -10).Unix(), Ms: 5000})
+	flush(t, s)
+
+	since := now.AddDate(0, 0, -7)
+	stats, err := s.LatencyStats(context.Background(), since)
+	if err != nil {
+		t.Fatalf("LatencyStats: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	a := stats[0]
+	if a.ServerID != "a" || a.Samples != 20 || a.P50Ms != 100 || a.P95Ms != 190 || a.MaxMs != 200 || a.AvgMs != 105 {
+		t.Errorf("stats[a] = %+v", a)
+	}
+	if stats[1].ServerID != "b" || stats[1].Samples != 1 || stats[1].P95Ms != 40 {
+		t.Errorf("stats[b] = %+v", stats[1])
+	}
+
+	uptime, err := s.Uptime(context.Background(), since)
+	if err != nil {
+		t.Fatalf("Uptime: %v", err)
+	}
+	if len(uptime) != 2 {
+		t.Fatalf("uptime = %+v", uptime)
+	}
+	if uptime[0].Checks != 21 || uptime[0].Successes != 20 || uptime[0].UptimePct != 95.24 || uptime[0].LastOK.IsZero() {
+		t.Errorf("uptime[a] = %+v", uptime[0])
+	}
+	if uptime[1].UptimePct != 50 || uptime[1].AvgScore < 0.59 || uptime[1].AvgScore > 0.61 {
+		t.Errorf("uptime[b] = %+v", uptime[1])
+	}
+}
+
+func TestEventsAndRetention(t *testing.T) {
+	s := openTestStore(t)
+	now := time.Now()
+	s.RecordEvent(connhistory.Event{Time: now.AddDate(0, 0, -40), Kind: connhistory.EventConnect, Server: "old"})
+	s.RecordEvent(connhistory.Event{Time: now.Add(-time.Minute), Kind: connhistory.EventConnect, Server: "a"})
+	s.RecordEvent(connhistory.Event{Time: now, Kind: connhistory.EventFailover, Server: "b", Reason: "smart failover"})
+	s.RecordPing("a", latency.Point{TS: now.AddDate(0, 0, -40).Unix(), Ms: 10})
+	flush(t, s)
+
+	events, err := s.Events(context.Background(), time.Time{}, "", 0)
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+	if len(events) != 3 || events[0].Kind != connhistory.EventFailover || events[0].Reason != "smart failover" {
+		t.Fatalf("events = %+v", events)
+	}
+	connects, err := s.Events(context.Background(), time.Time{}, connhistory.EventConnect, 1)
+	if err != nil || len(connects) != 1 || connects[0].Server != "a" {
+		t.Fatalf("connect events = %+v, err = %v", connects, err)
+	}
+
+	s.SetRetentionDays(30)
+	n, err := s.prune()
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("pruned %d rows, want 2", n)
+	}
+	events, _ = s.Events(context.Background(), time.Time{}, "", 0)
+	if len(events) != 2 {
+		t.Errorf("events after prune = %+v", events)
+	}
+}
+
+func TestSetRetentionDaysClamps(t *testing.T) {
+	s := &Store{}
+	s.SetRetentionDays(0)
+	if s.RetentionDays() != 30 {
+		t.Errorf("RetentionDays() = %d, want default 30", s.RetentionDays())
+	}
+	s.SetRetentionDays(10000)
+	if s.RetentionDays() != 365 {
+		t.Errorf("RetentionDays() = %d, want 365", s.RetentionDays())
+	}
+}
@@ -15,6 +15,8 @@ type Point struct {
 type Tracker struct {
 	mu      sync.RWMutex
 	history map[string][]Point
+	subs    map[int]func(string, Point)
+	nextSub int
 }
 
 var Global = &Tracker{history: make(map[string][]Point)}
@@ -30,6 +32,27 @@ func (t *Tracker) Record(serverID string, ms int64) {
 		pts = pts[len(pts)-maxPoints:]
 	}
 	t.history[serverID] = pts
+	for _, fn := range t.subs {
+		fn(serverID, pts[len(pts)-1])
+	}
+}
+
+// Subscribe регистрирует fn для новых замеров. fn вызывается под мьютексом
+// трекера и не должна обращаться к его методам. Возвращает функцию отписки.
+func (t *Tracker) Subscribe(fn func(serverID string, p Point)) func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.subs == nil {
+		t.subs = make(map[int]func(string, Point))
+	}
+	id := t.nextSub
+	t.nextSub++
+	t.subs[id] = fn
+	return func() {
+		t.mu.Lock()
+		delete(t.subs, id)
+		t.mu.Unlock()
+	}
 }
 
 func (t *Tracker) Get(serverID string) []Point {
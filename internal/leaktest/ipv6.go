@@ -13,13 +13,60 @@ import (
 )
 
 type IPv6Report struct {
-	Available bool      `json:"available"`
-	Address   string    `json:"address,omitempty"`
+	Available bool   `json:"available"`
+	Address   string `json:"address,omitempty"`
+	// Interface is the local interface that owns Address, if any. Without NAT66
+	// the address seen by the probe service is assigned to the physical adapter.
+	Interface string    `json:"interface,omitempty"`
 	Leaked    bool      `json:"leaked"`
 	Status    string    `json:"status"`
 	CheckedAt time.Time `json:"checked_at"`
 }
 
+// interfaceAddrs lists local interfaces with their addresses; tests replace it.
+var interfaceAddrs = func() (map[string][]net.Addr, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]net.Addr, len(ifaces))
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		out[iface.Name] = addrs
+	}
+	return out, nil
+}
+
+// InterfaceFor returns the name of the local interface that owns addr.
+func InterfaceFor(addr string) (string, bool) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", false
+	}
+	ifaces, err := interfaceAddrs()
+	if err != nil {
+		return "", false
+	}
+	for name, addrs := range ifaces {
+		for _, a := range addrs {
+			var local net.IP
+			switch v := a.(type) {
+			case *net.IPNet:
+				local = v.IP
+			case *net.IPAddr:
+				local = v.IP
+			}
+			if local.Equal(ip) {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
 func RunIPv6LeakTest(ctx context.Context, client *http.Client) (*IPv6Report, error) {
 	if client == nil {
 		client = netutil.SharedHTTPClient(DefaultHTTPTimeout)
@@ -45,11 +92,30 @@ func RunIPv6LeakTest(ctx context.Context, client *http.Client) (*IPv6Report, err
 	if ip == nil || ip.To4() != nil {
 		return nil, fmt.Errorf("invalid IPv6 response %q", addr)
 	}
+	iface, _ := InterfaceFor(ip.String())
 	return &IPv6Report{
 		Available: true,
 		Address:   ip.String(),
+		Interface: iface,
 		Leaked:    true,
 		Status:    "ipv6_available",
 		CheckedAt: time.Now().UTC(),
 	}, nil
 }
+
+// RunIPv6TunnelTest checks a tunnel that is expected to carry IPv6. Reaching
+// the probe over IPv6 is fine here; it is a leak only when the request left
+// through a local interface address instead of the proxy server.
+func RunIPv6TunnelTest(ctx context.Context, client *http.Client) (*IPv6Report, error) {
+	report, err := RunIPv6LeakTest(ctx, client)
+	if err != nil || !report.Available {
+		return report, err
+	}
+	report.Leaked = report.Interface != ""
+	if report.Leaked {
+		report.Status = "ipv6_direct"
+	} else {
+		report.Status = "ipv6_tunneled"
+	}
+	return report, nil
+}
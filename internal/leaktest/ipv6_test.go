@@ -0,0 +1,59 @@
+package leaktest
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type staticTransport string
+
+func (s staticTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(string(s))),
+		Request:    req,
+	}, nil
+}
+
+func stubInterfaceAddrs(t *testing.T, addrs map[string][]net.Addr) {
+	t.Helper()
+	orig := interfaceAddrs
+	interfaceAddrs = func() (map[string][]net.Addr, error) { return addrs, nil }
+	t.Cleanup(func() { interfaceAddrs = orig })
+}
+
+func TestRunIPv6TunnelTest(t *testing.T) {
+	stubInterfaceAddrs(t, map[string][]net.Addr{
+		"Ethernet": {&net.IPNet{IP: net.ParseIP("2001:db8::10"), Mask: net.CIDRMask(64, 128)}},
+	})
+
+	direct := &http.Client{Transport: staticTransport("2001:db8::10\n")}
+	report, err := RunIPv6TunnelTest(t.Context(), direct)
+	if err != nil {
+		t.Fatalf("RunIPv6TunnelTest: %v", err)
+	}
+	if !report.Leaked || report.Interface != "Ethernet" || report.Status != "ipv6_direct" {
+		t.Errorf("direct IPv6 report = %+v", report)
+	}
+
+	tunneled := &http.Client{Transport: staticTransport("2001:db8:ffff::1")}
+	report, err = RunIPv6TunnelTest(t.Context(), tunneled)
+	if err != nil {
+		t.Fatalf("RunIPv6TunnelTest: %v", err)
+	}
+	if report.Leaked || report.Interface != "" || report.Status != "ipv6_tunneled" {
+		t.Errorf("tunneled IPv6 report = %+v", report)
+	}
+
+	// Without an IPv6 tunnel any reachable IPv6 is a leak.
+	report, err = RunIPv6LeakTest(t.Context(), direct)
+	if err != nil {
+		t.Fatalf("RunIPv6LeakTest: %v", err)
+	}
+	if !report.Leaked || report.Interface != "Ethernet" {
+		t.Errorf("leak report = %+v", report)
+	}
+}
@@ -103,7 +103,7 @@ func (l *launcher) Launch(executable string, rule *apprules.Rule, args ...string
 	if rule != nil {
 		result.RuleID = rule.ID
 		result.Action = rule.Action
-		result.ProxyAddr = rule.ProxyAddr
+		result.ProxyAddr = rule.LaunchProxyAddr()
 
 		l.logger.Info("Launched process %s (PID: %d) with rule '%s' (%s)",
 			executable, pid, rule.Name, rule.Action)
@@ -135,7 +135,7 @@ func (l *launcher) applyRuleToCommand(cmd *exec.Cmd, rule *apprules.Rule) error
 	}
 	switch rule.Action {
 	case apprules.ActionProxy:
-		return l.applyProxyEnv(cmd, rule.ProxyAddr)
+		return l.applyProxyEnv(cmd, rule.LaunchProxyAddr())
 
 	case apprules.ActionDirect:
 		return l.applyDirectEnv(cmd)
@@ -115,6 +115,27 @@ func TestApplyRuleToCommand_ProxyAction(t *testing.T) {
 	}
 }
 
+func TestApplyRuleToCommand_DedicatedInboundPort(t *testing.T) {
+	log := logger.New(logger.LevelInfo)
+	engine := apprules.NewEngine()
+	l := NewLauncher(log, engine).(*launcher)
+
+	cmd := exec.Command("test.exe")
+	rule := &apprules.Rule{
+		ID:          "test",
+		Pattern:     "test.exe",
+		Action:      apprules.ActionProxy,
+		ProxyAddr:   "127.0.0.1:8080",
+		InboundPort: 10820,
+	}
+	if err := l.applyRuleToCommand(cmd, rule); err != nil {
+		t.Fatalf("applyRuleToCommand failed: %v", err)
+	}
+	if got := envToMap(cmd.Env)["HTTPS_PROXY"]; got != "http://127.0.0.1:10820" {
+		t.Errorf("HTTPS_PROXY = %q, want the dedicated port", got)
+	}
+}
+
 func TestApplyProxyEnvReplacesExistingProxyVars(t *testing.T) {
 	log := logger.New(logger.LevelInfo)
 	engine := apprules.NewEngine()
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,6 +18,19 @@ import (
 type Config struct {
 	Address  string
 	Override string
+	// AutoConfigURL — адрес PAC-файла. Если задан, Windows получает
+	// AutoConfigURL вместо фиксированного ProxyServer; Address остаётся
+	// адресом, на который ссылается PAC.
+	AutoConfigURL string
+}
+
+// matchesSystem сравнивает ожидаемую конфигурацию с прочитанной из реестра.
+// В режиме PAC реестр хранит только AutoConfigURL.
+func (c Config) matchesSystem(system Config) bool {
+	if c.AutoConfigURL != "" {
+		return system.AutoConfigURL == c.AutoConfigURL
+	}
+	return system == c
 }
 
 type proxyBackend interface {
@@ -28,6 +42,9 @@ type proxyBackend interface {
 type systemProxyBackend struct{}
 
 func (systemProxyBackend) set(config Config) error {
+	if config.AutoConfigURL != "" {
+		return setAutoConfigURL(config.AutoConfigURL)
+	}
 	return setSystemProxy(config.Address, config.Override)
 }
 
@@ -35,7 +52,12 @@ func (systemProxyBackend) disable() error {
 	return disableSystemProxy()
 }
 
+// state: PAC считается включённым только вместе с ProxyEnable=0, иначе
+// действует фиксированный ProxyServer (см. getPACState).
 func (systemProxyBackend) state() (bool, Config) {
+	if pac := getPACState(); pac != "" {
+		return true, Config{AutoConfigURL: pac}
+	}
 	enabled, addr, override := getSystemProxyState()
 	return enabled, Config{Address: addr, Override: override}
 }
@@ -106,7 +128,7 @@ func newManagerWithBackend(log logger.Logger, backend proxyBackend) *manager {
 		backend: backend,
 		enabled: enabled,
 	}
-	if enabled && config.Address != "" {
+	if enabled && (config.Address != "" || config.AutoConfigURL != "") {
 		m.config = config
 	}
 	return m
@@ -132,7 +154,11 @@ func (m *manager) Enable(config Config) error {
 
 	m.config = normalized
 	m.enabled = true
-	m.logger.Info("Системный прокси включён: %s", normalized.Address)
+	if normalized.AutoConfigURL != "" {
+		m.logger.Info("Системный прокси включён: PAC %s", normalized.AutoConfigURL)
+	} else {
+		m.logger.Info("Системный прокси включён: %s", normalized.Address)
+	}
 
 	return nil
 }
@@ -298,7 +324,7 @@ func (m *manager) checkAndRestore() {
 	systemEnabled, systemConfig := m.currentBackend().state()
 
 	// Проверяем: соответствует ли текущее состояние ожидаемому
-	if systemEnabled && systemConfig == expectedConfig {
+	if systemEnabled && expectedConfig.matchesSystem(systemConfig) {
 		// Всё в порядке
 		return
 	}
@@ -354,6 +380,13 @@ func normalizeConfig(config Config) (Config, error) {
 	}
 
 	config.Address = net.JoinHostPort(host, portStr)
+	if config.AutoConfigURL != "" {
+		u, err := url.Parse(strings.TrimSpace(config.AutoConfigURL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, fmt.Errorf("некорректный адрес PAC: %q", config.AutoConfigURL)
+		}
+		config.AutoConfigURL = u.String()
+	}
 	return config, nil
 }
 
@@ -353,3 +353,28 @@ func TestConfig_EqualityIsValueBased(t *testing.T) {
 		t.Error("Config с разными адресами не должны быть равны")
 	}
 }
+
+// ── Режим PAC: реестр хранит только AutoConfigURL ───────────────────────────
+func TestManager_AutoConfigURL(t *testing.T) {
+	mgr, backend := newFakeManager(false, Config{})
+	if err := mgr.Enable(Config{Address: "127.0.0.1:8080", AutoConfigURL: "file:///proxy.pac"}); err == nil {
+		t.Fatal("Enable accepted a non-http PAC URL")
+	}
+	cfg := Config{Address: "127.0.0.1:8080", Override: "<local>", AutoConfigURL: "http://127.0.0.1:8080/proxy.pac"}
+	if err := mgr.Enable(cfg); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+
+	// The Windows backend reads back only the PAC URL; the guard must accept it.
+	backend.setEnabledExternally(Config{AutoConfigURL: cfg.AutoConfigURL})
+	mgr.checkAndRestore()
+	if backend.setCalls != 1 {
+		t.Fatalf("guard rewrote a matching PAC config: setCalls=%d", backend.setCalls)
+	}
+
+	backend.setEnabledExternally(Config{Address: "10.0.0.1:3128"})
+	mgr.checkAndRestore()
+	if _, stored := backend.state(); stored != cfg {
+		t.Fatalf("guard restored %+v, want %+v", stored, cfg)
+	}
+}
@@ -3,6 +3,7 @@
 package proxy
 
 import (
+	"errors"
 	"fmt"
 
 	"golang.org/x/sys/windows"
@@ -28,7 +29,7 @@ func setSystemProxy(proxyServer string, proxyOverride string) error {
 	// HTTP-соединения. При частых перезапусках TUN это создаёт заметные сбои загрузки.
 	// Источник: Clash Verge Rev system-proxy модуль.
 	if currentEnabled, currentAddr, currentOverride := getSystemProxyState(); currentEnabled &&
-		currentAddr == proxyServer && currentOverride == proxyOverride {
+		currentAddr == proxyServer && currentOverride == proxyOverride && getAutoConfigURL() == "" {
 		return nil
 	}
 
@@ -38,6 +39,11 @@ func setSystemProxy(proxyServer string, proxyOverride string) error {
 	}
 	defer key.Close()
 
+	// Переход из режима PAC: AutoConfigURL имеет приоритет над ProxyServer.
+	if err := deleteAutoConfigURL(key); err != nil {
+		return err
+	}
+
 	if err := key.SetStringValue("ProxyServer", proxyServer); err != nil {
 		return fmt.Errorf("не удалось установить ProxyServer: %w", err)
 	}
@@ -68,6 +74,9 @@ func disableSystemProxy() error {
 	if err := key.SetDWordValue("ProxyEnable", 0); err != nil {
 		return fmt.Errorf("не удалось установить ProxyEnable: %w", err)
 	}
+	if err := deleteAutoConfigURL(key); err != nil {
+		return err
+	}
 
 	if err := notifyWindows(); err != nil {
 		return fmt.Errorf("не удалось уведомить систему об изменениях: %w", err)
@@ -76,6 +85,70 @@ func disableSystemProxy() error {
 	return nil
 }
 
+// setAutoConfigURL переключает Windows на PAC-файл: пишет AutoConfigURL и
+// выключает фиксированный ProxyServer, чтобы решения принимал PAC.
+func setAutoConfigURL(pacURL string) error {
+	if getPACState() == pacURL {
+		return nil
+	}
+	key, err := registry.OpenKey(registry.CURRENT_USER, registryPath, registry.WRITE)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть ключ реестра: %w", err)
+	}
+	defer key.Close()
+
+	if err := key.SetStringValue("AutoConfigURL", pacURL); err != nil {
+		return fmt.Errorf("не удалось установить AutoConfigURL: %w", err)
+	}
+	if err := key.SetDWordValue("ProxyEnable", 0); err != nil {
+		return fmt.Errorf("не удалось установить ProxyEnable: %w", err)
+	}
+	if err := notifyWindows(); err != nil {
+		return fmt.Errorf("не удалось уведомить систему об изменениях: %w", err)
+	}
+	return nil
+}
+
+// getAutoConfigURL читает AutoConfigURL; "" — PAC не настроен.
+func getAutoConfigURL() string {
+	key, err := registry.OpenKey(registry.CURRENT_USER, registryPath, registry.READ)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	pacURL, _, err := key.GetStringValue("AutoConfigURL")
+	if err != nil {
+		return ""
+	}
+	return pacURL
+}
+
+// getPACState возвращает AutoConfigURL, только если Windows целиком в режиме
+// PAC: AutoConfigURL задан и ProxyEnable выключен. Со включённым ProxyEnable
+// рядом с PAC остаётся фиксированный ProxyServer — это не наше состояние.
+func getPACState() string {
+	key, err := registry.OpenKey(registry.CURRENT_USER, registryPath, registry.READ)
+	if err != nil {
+		return ""
+	}
+	defer key.Close()
+	pacURL, _, err := key.GetStringValue("AutoConfigURL")
+	if err != nil {
+		return ""
+	}
+	if val, _, err := key.GetIntegerValue("ProxyEnable"); err == nil && val != 0 {
+		return ""
+	}
+	return pacURL
+}
+
+func deleteAutoConfigURL(key registry.Key) error {
+	if err := key.DeleteValue("AutoConfigURL"); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return fmt.Errorf("не удалось удалить AutoConfigURL: %w", err)
+	}
+	return nil
+}
+
 // getSystemProxyState читает текущее состояние системного прокси из реестра.
 // BUG FIX #6: используется при создании Manager чтобы синхронизировать
 // in-memory состояние с реальным состоянием реестра Windows.
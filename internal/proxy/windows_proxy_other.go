@@ -3,7 +3,10 @@
 package proxy
 
 func setSystemProxy(string, string) error { return nil }
+func setAutoConfigURL(string) error       { return nil }
 func disableSystemProxy() error           { return nil }
+func getAutoConfigURL() string            { return "" }
+func getPACState() string                 { return "" }
 func getSystemProxyState() (bool, string, string) {
 	return false, "", ""
 }
@@ -1,3 +1,4 @@
 // Package routing builds routing presets and visual routing summaries for the
-// UI editor.
+// UI editor, and dry-runs synthetic connections against the generated sing-box
+// route to show which rule and outbound they would hit.
 package routing
@@ -0,0 +1,477 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/srs"
+)
+
+// DefaultInbound — inbound, через который приходит трафик приложений в режиме TUN.
+const DefaultInbound = "tun-in"
+
+// Conn — синтетическое соединение для пробного прогона маршрутизации.
+// Пустой Network означает tcp, нулевой Port — 443, пустой Inbound — DefaultInbound.
+type Conn struct {
+	Domain   string `json:"domain,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	Port     uint16 `json:"port,omitempty"`
+	Network  string `json:"network,omitempty"`
+	Process  string `json:"process,omitempty"`
+	Inbound  string `json:"inbound,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// Действия результата пробного прогона.
+const (
+	DryRunRoute     = "route"
+	DryRunReject    = "reject"
+	DryRunHijackDNS = "hijack-dns"
+)
+
+// DryRunResult — чем закончится соединение: индекс сработавшего правила
+// (-1 — final), действие, outbound и пошаговое объяснение.
+type DryRunResult struct {
+	RuleIndex   int                 `json:"rule_index"`
+	Action      string              `json:"action"`
+	Outbound    string              `json:"outbound,omitempty"`
+	Rule        *config.SBRouteRule `json:"rule,omitempty"`
+	Explanation []string            `json:"explanation"`
+}
+
+// RuleSetLoader загружает rule-set из определения route.rule_set.
+type RuleSetLoader func(def config.SBRuleSet) (*srs.RuleSet, error)
+
+// LoadLocalRuleSet читает локальный бинарный rule-set (data/geosite-*.bin).
+func LoadLocalRuleSet(def config.SBRuleSet) (*srs.RuleSet, error) {
+	if def.Type != "" && def.Type != "local" {
+		return nil, fmt.Errorf("rule-set типа %q не хранится локально", def.Type)
+	}
+	if def.Format != "" && def.Format != "binary" {
+		return nil, fmt.Errorf("формат rule-set %q не поддерживается", def.Format)
+	}
+	return srs.ReadFile(def.Path)
+}
+
+// knownRuleFields — поля правил route, которые понимает DryRun.
+// Правила с другими условиями пропускаются: без них совпадение было бы ложным.
+var knownRuleFields = map[string]bool{
+	"protocol": true, "network": true, "port": true, "port_range": true,
+	"process_name": true, "process_path": true, "process_path_regex": true,
+	"domain": true, "domain_suffix": true, "domain_keyword": true, "domain_regex": true,
+	"ip_cidr": true, "inbound": true,
+	"action": true, "outbound": true, "rule_set": true,
+}
+
+// DryRun прогоняет соединения через route-секцию sing-box в том же порядке,
+// в каком её обходит sing-box: правила сверху вниз, первое совпавшее
+// правило с финальным действием определяет судьбу соединения.
+type DryRun struct {
+	route       config.SBRoute
+	unsupported map[int][]string
+	load        RuleSetLoader
+	ruleSets    map[string]*srs.RuleSet
+	loadErrs    map[string]error
+	regexps     map[string]*regexp.Regexp
+}
+
+// NewDryRun создаёт движок для route. load == nil — LoadLocalRuleSet.
+func NewDryRun(route config.SBRoute, load RuleSetLoader) *DryRun {
+	if load == nil {
+		load = LoadLocalRuleSet
+	}
+	return &DryRun{
+		route:    route,
+		load:     load,
+		ruleSets: map[string]*srs.RuleSet{},
+		loadErrs: map[string]error{},
+		regexps:  map[string]*regexp.Regexp{},
+	}
+}
+
+// ParseDryRunConfig создаёт движок по готовому config.singbox.json: так
+// проверяется ровно то, что запущено, включая ручные правки конфига.
+func ParseDryRunConfig(data []byte, load RuleSetLoader) (*DryRun, error) {
+	var doc struct {
+		Route *json.RawMessage `json:"route"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if doc.Route == nil {
+		return nil, errors.New("config: нет секции route")
+	}
+	var route config.SBRoute
+	if err := json.Unmarshal(*doc.Route, &route); err != nil {
+		return nil, fmt.Errorf("route: %w", err)
+	}
+	var raw struct {
+		Rules []map[string]json.RawMessage `json:"rules"`
+	}
+	if err := json.Unmarshal(*doc.Route, &raw); err != nil {
+		return nil, fmt.Errorf("route.rules: %w", err)
+	}
+	d := NewDryRun(route, load)
+	for i, rule := range raw.Rules {
+		var fields []string
+		for key := range rule {
+			if !knownRuleFields[key] {
+				fields = append(fields, key)
+			}
+		}
+		if len(fields) > 0 {
+			sort.Strings(fields)
+			if d.unsupported == nil {
+				d.unsupported = map[int][]string{}
+			}
+			d.unsupported[i] = fields
+		}
+	}
+	return d, nil
+}
+
+// Unsupported возвращает правила (индекс → поля), которые пробный прогон пропускает.
+func (d *DryRun) Unsupported() map[int][]string {
+	return d.unsupported
+}
+
+type dryRunConn struct {
+	domain   string
+	ip       netip.Addr
+	port     uint16
+	network  string
+	process  string
+	inbound  string
+	protocol string
+}
+
+func normalizeDryRunConn(c Conn) (dryRunConn, error) {
+	n := dryRunConn{
+		domain:   strings.TrimSuffix(strings.ToLower(strings.TrimSpace(c.Domain)), "."),
+		port:     c.Port,
+		network:  strings.ToLower(strings.TrimSpace(c.Network)),
+		process:  strings.TrimSpace(c.Process),
+		inbound:  strings.TrimSpace(c.Inbound),
+		protocol: strings.ToLower(strings.TrimSpace(c.Protocol)),
+	}
+	if ip := strings.TrimSpace(c.IP); ip != "" {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return n, fmt.Errorf("ip: некорректный адрес %q", ip)
+		}
+		n.ip = addr.Unmap()
+	}
+	// IP-литерал в поле domain — это адрес назначения, а не домен.
+	if addr, err := netip.ParseAddr(n.domain); err == nil {
+		if !n.ip.IsValid() {
+			n.ip = addr.Unmap()
+		}
+		n.domain = ""
+	}
+	if n.domain == "" && !n.ip.IsValid() {
+		return n, errors.New("нужен domain или ip")
+	}
+	switch n.network {
+	case "":
+		n.network = "tcp"
+	case "tcp", "udp":
+	default:
+		return n, errors.New("network: tcp | udp")
+	}
+	if n.port == 0 {
+		n.port = 443
+	}
+	if n.inbound == "" {
+		n.inbound = DefaultInbound
+	}
+	// sniff распознаёт DNS по содержимому; для синтетического соединения — по порту 53.
+	if n.protocol == "" && n.port == 53 {
+		n.protocol = "dns"
+	}
+	return n, nil
+}
+
+// Evaluate находит правило, которое sing-box применит к соединению c.
+func (d *DryRun) Evaluate(c Conn) (DryRunResult, error) {
+	conn, err := normalizeDryRunConn(c)
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	var explain []string
+	for i := range d.route.Rules {
+		rule := d.route.Rules[i]
+		if fields, ok := d.unsupported[i]; ok {
+			explain = append(explain, fmt.Sprintf("#%d пропущено: условия %s не поддерживаются пробным прогоном", i, strings.Join(fields, ", ")))
+			continue
+		}
+		matched, why := d.matchRule(rule, conn)
+		if !matched {
+			explain = append(explain, fmt.Sprintf("#%d %s: не совпало — %s", i, describeRuleAction(rule), why))
+			continue
+		}
+		switch rule.Action {
+		case "sniff":
+			// sniff не финальный: он только извлекает домен и протокол.
+			explain = append(explain, fmt.Sprintf("#%d sniff: домен и протокол определяются по содержимому соединения", i))
+			continue
+		case "reject":
+			explain = append(explain, fmt.Sprintf("#%d reject: %s — соединение отклонено", i, why))
+			return DryRunResult{RuleIndex: i, Action: DryRunReject, Rule: &rule, Explanation: explain}, nil
+		case "hijack-dns":
+			explain = append(explain, fmt.Sprintf("#%d hijack-dns: %s — запрос обрабатывает DNS sing-box", i, why))
+			return DryRunResult{RuleIndex: i, Action: DryRunHijackDNS, Rule: &rule, Explanation: explain}, nil
+		case "", "route":
+			if rule.Outbound == "" {
+				explain = append(explain, fmt.Sprintf("#%d пропущено: нет outbound", i))
+				continue
+			}
+			explain = append(explain, fmt.Sprintf("#%d → %s: %s", i, rule.Outbound, why))
+			return DryRunResult{RuleIndex: i, Action: DryRunRoute, Outbound: rule.Outbound, Rule: &rule, Explanation: explain}, nil
+		default:
+			// route-options, resolve и т.п. не завершают обход.
+			explain = append(explain, fmt.Sprintf("#%d %s: не финальное действие, обход продолжается", i, rule.Action))
+		}
+	}
+	if d.route.Final == "" {
+		explain = append(explain, "ни одно правило не совпало; final не задан — sing-box использует первый outbound")
+		return DryRunResult{RuleIndex: -1, Action: DryRunRoute, Explanation: explain}, nil
+	}
+	explain = append(explain, fmt.Sprintf("ни одно правило не совпало → final: %s", d.route.Final))
+	return DryRunResult{RuleIndex: -1, Action: DryRunRoute, Outbound: d.route.Final, Explanation: explain}, nil
+}
+
+func describeRuleAction(rule config.SBRouteRule) string {
+	switch rule.Action {
+	case "", "route":
+		return "→ " + rule.Outbound
+	default:
+		return rule.Action
+	}
+}
+
+// matchRule проверяет правило как sing-box: inbound, network, protocol, порт
+// (port или port_range), process_name, process_path и process_path_regex — через И; domain,
+// domain_suffix, domain_keyword, domain_regex, ip_cidr и rule_set — через ИЛИ.
+// Возвращает причину совпадения или первое несовпавшее условие.
+func (d *DryRun) matchRule(rule config.SBRouteRule, c dryRunConn) (bool, string) {
+	var matched []string
+	if len(rule.Inbound) > 0 {
+		if !slices.Contains(rule.Inbound, c.inbound) {
+			return false, fmt.Sprintf("inbound %s ∉ %v", c.inbound, rule.Inbound)
+		}
+		matched = append(matched, "inbound "+c.inbound)
+	}
+	if rule.Network != "" {
+		if !strings.EqualFold(rule.Network, c.network) {
+			return false, fmt.Sprintf("network %s ≠ %s", c.network, rule.Network)
+		}
+		matched = append(matched, "network "+c.network)
+	}
+	if rule.Protocol != "" {
+		if !strings.EqualFold(rule.Protocol, c.protocol) {
+			return false, fmt.Sprintf("protocol %s ≠ %s", firstNonEmptyString(c.protocol, "неизвестен"), rule.Protocol)
+		}
+		matched = append(matched, "protocol "+c.protocol)
+	}
+	if len(rule.Port) > 0 || len(rule.PortRange) > 0 {
+		if !slices.Contains(rule.Port, c.port) && !slices.ContainsFunc(rule.PortRange, func(r string) bool { return portInRange(r, c.port) }) {
+			return false, fmt.Sprintf("порт %d ∉ %v", c.port, slices.Concat(portStrings(rule.Port), rule.PortRange))
+		}
+		matched = append(matched, "порт "+strconv.Itoa(int(c.port)))
+	}
+	if len(rule.ProcessName) > 0 {
+		name := filepathBase(c.process)
+		found := ""
+		for _, p := range rule.ProcessName {
+			if name != "" && strings.EqualFold(p, name) {
+				found = p
+				break
+			}
+		}
+		if found == "" {
+			return false, fmt.Sprintf("процесс %q не в process_name", firstNonEmptyString(name, "—"))
+		}
+		matched = append(matched, "process_name "+found)
+	}
+	if len(rule.ProcessPath) > 0 {
+		// Путь Windows сравнивается без учёта регистра.
+		idx := slices.IndexFunc(rule.ProcessPath, func(p string) bool { return c.process != "" && strings.EqualFold(p, c.process) })
+		if idx < 0 {
+			return false, fmt.Sprintf("путь процесса %q не в process_path", firstNonEmptyString(c.process, "—"))
+		}
+		matched = append(matched, "process_path "+rule.ProcessPath[idx])
+	}
+	if len(rule.ProcessPathRegex) > 0 {
+		idx := slices.IndexFunc(rule.ProcessPathRegex, func(expr string) bool {
+			re := d.regexp(expr)
+			return c.process != "" && re != nil && re.MatchString(c.process)
+		})
+		if idx < 0 {
+			return false, fmt.Sprintf("путь процесса %q не подходит под process_path_regex", firstNonEmptyString(c.process, "—"))
+		}
+		matched = append(matched, "process_path_regex "+rule.ProcessPathRegex[idx])
+	}
+	if hasDomainItems(rule) || len(rule.IPCIDR) > 0 || len(rule.RuleSet) > 0 {
+		why, ok := d.matchDestination(rule, c)
+		if !ok {
+			return false, why
+		}
+		matched = append(matched, why)
+	}
+	if len(matched) == 0 {
+		return true, "правило без условий"
+	}
+	return true, strings.Join(matched, ", ")
+}
+
+func (d *DryRun) matchDestination(rule config.SBRouteRule, c dryRunConn) (string, bool) {
+	if c.domain != "" {
+		for _, dom := range rule.Domain {
+			if strings.EqualFold(dom, c.domain) {
+				return "domain " + dom, true
+			}
+		}
+		for _, suffix := range rule.DomainSuffix {
+			if matchDomainSuffix(strings.ToLower(suffix), c.domain) {
+				return "domain_suffix " + suffix, true
+			}
+		}
+		for _, kw := range rule.DomainKeyword {
+			if strings.Contains(c.domain, strings.ToLower(kw)) {
+				return "domain_keyword " + kw, true
+			}
+		}
+		for _, expr := range rule.DomainRegex {
+			if re := d.regexp(expr); re != nil && re.MatchString(c.domain) {
+				return "domain_regex " + expr, true
+			}
+		}
+	}
+	if c.ip.IsValid() {
+		for _, cidr := range rule.IPCIDR {
+			if prefixContains(cidr, c.ip) {
+				return "ip_cidr " + cidr, true
+			}
+		}
+	}
+	var notes []string
+	for _, tag := range rule.RuleSet {
+		rs, err := d.ruleSet(tag)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("rule-set %s не загружен: %v", tag, err))
+			continue
+		}
+		if rs.Match(srs.Metadata{Domain: c.domain, IP: c.ip, Port: c.port, Network: c.network, ProcessPath: c.process}) {
+			return "rule_set " + tag, true
+		}
+	}
+	if len(notes) > 0 {
+		return "адрес не совпал; " + strings.Join(notes, "; "), false
+	}
+	if c.domain == "" && hasDomainItems(rule) && len(rule.IPCIDR) == 0 && len(rule.RuleSet) == 0 {
+		return "домен неизвестен", false
+	}
+	return "адрес не совпал", false
+}
+
+func hasDomainItems(rule config.SBRouteRule) bool {
+	return len(rule.Domain)+len(rule.DomainSuffix)+len(rule.DomainKeyword)+len(rule.DomainRegex) > 0
+}
+
+// regexp компилирует domain_regex и process_path_regex один раз; невалидное выражение не совпадает
+// ни с чем — sing-box с таким конфигом не запустился бы.
+func (d *DryRun) regexp(expr string) *regexp.Regexp {
+	re, ok := d.regexps[expr]
+	if !ok {
+		re, _ = regexp.Compile(expr)
+		d.regexps[expr] = re
+	}
+	return re
+}
+
+// portInRange проверяет port_range sing-box: "1000:2000", ":2000", "1000:".
+func portInRange(r string, port uint16) bool {
+	lo, hi, ok := strings.Cut(r, ":")
+	if !ok {
+		return false
+	}
+	from, to := uint64(0), uint64(65535)
+	var err error
+	if lo != "" {
+		if from, err = strconv.ParseUint(lo, 10, 16); err != nil {
+			return false
+		}
+	}
+	if hi != "" {
+		if to, err = strconv.ParseUint(hi, 10, 16); err != nil {
+			return false
+		}
+	}
+	return uint64(port) >= from && uint64(port) <= to
+}
+
+func portStrings(ports []uint16) []string {
+	out := make([]string, 0, len(ports))
+	for _, p := range ports {
+		out = append(out, strconv.Itoa(int(p)))
+	}
+	return out
+}
+
+// matchDomainSuffix повторяет domain_suffix sing-box: "example.com" — сам
+// домен и поддомены, ".example.com" — только поддомены.
+func matchDomainSuffix(suffix, domain string) bool {
+	if strings.HasPrefix(suffix, ".") {
+		return strings.HasSuffix(domain, suffix)
+	}
+	return domain == suffix || strings.HasSuffix(domain, "."+suffix)
+}
+
+func prefixContains(cidr string, ip netip.Addr) bool {
+	if p, err := netip.ParsePrefix(cidr); err == nil {
+		return p.Contains(ip)
+	}
+	if addr, err := netip.ParseAddr(cidr); err == nil {
+		return addr.Unmap() == ip
+	}
+	return false
+}
+
+func (d *DryRun) ruleSet(tag string) (*srs.RuleSet, error) {
+	if rs, ok := d.ruleSets[tag]; ok {
+		return rs, nil
+	}
+	if err, ok := d.loadErrs[tag]; ok {
+		return nil, err
+	}
+	idx := slices.IndexFunc(d.route.RuleSet, func(def config.SBRuleSet) bool { return def.Tag == tag })
+	if idx < 0 {
+		err := errors.New("нет в route.rule_set")
+		d.loadErrs[tag] = err
+		return nil, err
+	}
+	rs, err := d.load(d.route.RuleSet[idx])
+	if err != nil {
+		d.loadErrs[tag] = err
+		return nil, err
+	}
+	d.ruleSets[tag] = rs
+	return rs, nil
+}
+
+func firstNonEmptyString(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,261 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"proxyclient/internal/apprules"
+	"proxyclient/internal/config"
+	"proxyclient/internal/srs"
+)
+
+// generateRuntimeConfig собирает config.singbox.json так же, как при применении правил.
+// appRules записываются в app_rules.json.
+func generateRuntimeConfig(t *testing.T, routingCfg *config.RoutingConfig, appRules ...apprules.Rule) []byte {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.MkdirAll(config.DataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// GenerateSingBoxConfig проверяет только заголовок rule-set'а; содержимое подставляет загрузчик теста.
+	for _, name := range []string{"geosite-youtube.bin", "geoip-ru.bin"} {
+		if err := os.WriteFile(filepath.Join(config.DataDir, name), []byte("SRS\x01"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(appRules) > 0 {
+		if err := apprules.NewFileStorage(config.AppRulesFile).Save(appRules); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secret := filepath.Join(dir, "secret.key")
+	if err := os.WriteFile(secret, []byte("vless://12345678-1234-1234-1234-123456789abc@example.com:443?sni=www.google.com&pbk=testkey&sid=abc"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "config.singbox.json")
+	if err := config.GenerateSingBoxConfig(secret, out, routingCfg); err != nil {
+		t.Fatalf("GenerateSingBoxConfig: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDryRunFollowsGeneratedRouteOrder(t *testing.T) {
+	data := generateRuntimeConfig(t, &config.RoutingConfig{
+		DefaultAction: config.ActionDirect,
+		BlockQUIC:     true,
+		Rules: []config.RoutingRule{
+			{Value: "chrome.exe", Type: config.RuleTypeProcess, Action: config.ActionProxy},
+			{Value: "google.com", Type: config.RuleTypeDomain, Action: config.ActionDirect},
+			{Value: "miner.exe", Type: config.RuleTypeProcess, Action: config.ActionBlock},
+			{Value: "geosite:youtube", Type: config.RuleTypeGeosite, Action: config.ActionProxy},
+		},
+	})
+	loader := func(def config.SBRuleSet) (*srs.RuleSet, error) {
+		if def.Tag != "geosite-youtube" {
+			return nil, errors.New("unexpected rule-set")
+		}
+		return &srs.RuleSet{Rules: []srs.Rule{{DomainKeyword: []string{"youtube", "ytimg"}}}}, nil
+	}
+	engine, err := ParseDryRunConfig(data, loader)
+	if err != nil {
+		t.Fatalf("ParseDryRunConfig: %v", err)
+	}
+	if len(engine.Unsupported()) != 0 {
+		t.Fatalf("generated config has unsupported rules: %v", engine.Unsupported())
+	}
+
+	cases := []struct {
+		name     string
+		conn     Conn
+		action   string
+		outbound string
+	}{
+		{"lan", Conn{IP: "192.168.1.10", Process: "chrome.exe"}, DryRunRoute, "direct"},
+		{"telegram dc", Conn{IP: "91.108.4.5", Process: "Telegram.exe"}, DryRunRoute, "proxy-out"},
+		{"dns", Conn{IP: "1.1.1.1", Port: 53, Network: "udp"}, DryRunHijackDNS, ""},
+		{"stun", Conn{Domain: "stun.l.google.com", Port: 3478, Network: "udp"}, DryRunReject, ""},
+		{"ipv6", Conn{IP: "2a00:1450:4010::1"}, DryRunReject, ""},
+		{"quic allowed", Conn{Domain: "api.github.com", Network: "udp"}, DryRunRoute, "proxy-out"},
+		{"quic blocked", Conn{Domain: "www.google.com", Network: "udp"}, DryRunReject, ""},
+		{"blocked process", Conn{Domain: "pool.example", Process: `C:\Tools\miner.exe`}, DryRunReject, ""},
+		{"domain beats process", Conn{Domain: "mail.google.com", Process: "chrome.exe"}, DryRunRoute, "direct"},
+		{"process", Conn{Domain: "example.org", Process: `C:\Program Files\Google\Chrome\chrome.exe`}, DryRunRoute, "proxy-out"},
+		{"geosite", Conn{Domain: "i.ytimg.com", Process: "firefox.exe"}, DryRunRoute, "proxy-out"},
+		{"final", Conn{Domain: "example.net", Process: "firefox.exe"}, DryRunRoute, "direct"},
+	}
+	for _, tc := range cases {
+		res, err := engine.Evaluate(tc.conn)
+		if err != nil {
+			t.Fatalf("%s: Evaluate: %v", tc.name, err)
+		}
+		if res.Action != tc.action || res.Outbound != tc.outbound {
+			t.Errorf("%s: got %s/%s (rule %d), want %s/%s\n%v", tc.name, res.Action, res.Outbound, res.RuleIndex, tc.action, tc.outbound, res.Explanation)
+		}
+		if len(res.Explanation) == 0 {
+			t.Errorf("%s: empty explanation", tc.name)
+		}
+	}
+
+	res, _ := engine.Evaluate(Conn{Domain: "example.net"})
+	if res.RuleIndex != -1 || res.Rule != nil {
+		t.Errorf("final result = %+v", res)
+	}
+	res, _ = engine.Evaluate(Conn{Domain: "www.youtube.com"})
+	if res.Rule == nil || len(res.Rule.RuleSet) != 1 || res.Rule.RuleSet[0] != "geosite-youtube" {
+		t.Errorf("geosite result = %+v", res)
+	}
+}
+
+func TestDryRunRichRuleTypes(t *testing.T) {
+	data := generateRuntimeConfig(t, &config.RoutingConfig{
+		DefaultAction: config.ActionProxy,
+		Rules: []config.RoutingRule{
+			{Value: "keyword:tracker", Type: config.RuleTypeKeyword, Action: config.ActionBlock},
+			{Value: `regex:^cdn\d+\.example\.org$`, Type: config.RuleTypeRegex, Action: config.ActionDirect},
+			{Value: `C:\Games\Steam\steam.exe`, Type: config.RuleTypeProcessPath, Action: config.ActionDirect},
+			{Value: "port:27000-27100", Type: config.RuleTypePort, Action: config.ActionDirect},
+			{Value: "network:udp", Type: config.RuleTypeNetwork, Action: config.ActionDirect},
+			{Value: "geoip:ru", Type: config.RuleTypeGeoIP, Action: config.ActionDirect},
+		},
+	})
+	loader := func(def config.SBRuleSet) (*srs.RuleSet, error) {
+		if def.Tag != "geoip-ru" {
+			return nil, errors.New("unexpected rule-set")
+		}
+		return &srs.RuleSet{Rules: []srs.Rule{{IPCIDR: []srs.IPRange{srs.PrefixRange(netip.MustParsePrefix("95.163.0.0/16"))}}}}, nil
+	}
+	engine, err := ParseDryRunConfig(data, loader)
+	if err != nil {
+		t.Fatalf("ParseDryRunConfig: %v", err)
+	}
+	if len(engine.Unsupported()) != 0 {
+		t.Fatalf("generated config has unsupported rules: %v", engine.Unsupported())
+	}
+	cases := []struct {
+		name     string
+		conn     Conn
+		outbound string
+		field    string
+	}{
+		{"keyword", Conn{Domain: "eu.tracker.example"}, "", "domain_keyword"},
+		{"regex", Conn{Domain: "cdn7.example.org"}, "direct", "domain_regex"},
+		{"regex miss", Conn{Domain: "cdnx.example.org", IP: "8.8.8.8"}, "proxy-out", ""},
+		{"process path", Conn{Domain: "example.com", Process: `c:\games\steam\steam.exe`}, "direct", "process_path"},
+		{"port range", Conn{Domain: "example.com", Port: 27015}, "direct", "port_range"},
+		{"network", Conn{Domain: "example.com", Port: 3000, Network: "udp"}, "direct", "network"},
+		{"geoip", Conn{IP: "95.163.1.1"}, "direct", "rule_set"},
+	}
+	for _, tc := range cases {
+		res, err := engine.Evaluate(tc.conn)
+		if err != nil {
+			t.Fatalf("%s: Evaluate: %v", tc.name, err)
+		}
+		if res.Outbound != tc.outbound {
+			t.Errorf("%s: got %s/%s, want %q\n%v", tc.name, res.Action, res.Outbound, tc.outbound, res.Explanation)
+			continue
+		}
+		if tc.field == "" {
+			continue
+		}
+		rule, _ := json.Marshal(res.Rule)
+		if !strings.Contains(string(rule), `"`+tc.field+`"`) {
+			t.Errorf("%s: matched %s, want rule with %s", tc.name, rule, tc.field)
+		}
+	}
+}
+
+func TestDryRunAppRules(t *testing.T) {
+	data := generateRuntimeConfig(t, &config.RoutingConfig{
+		DefaultAction: config.ActionDirect,
+		Rules: []config.RoutingRule{
+			{Value: "google.com", Type: config.RuleTypeDomain, Action: config.ActionDirect},
+		},
+	},
+		apprules.Rule{ID: "1", Pattern: "telegram*", Action: apprules.ActionProxy, Priority: 10, Enabled: true},
+		apprules.Rule{ID: "2", Pattern: "miner*", Action: apprules.ActionBlock, Priority: 20, Enabled: true},
+		apprules.Rule{ID: "3", Pattern: "steam.exe", Action: apprules.ActionDirect, Priority: 1, Enabled: true},
+		apprules.Rule{ID: "4", Pattern: "c:/games/*", Action: apprules.ActionProxy, Enabled: true},
+		apprules.Rule{ID: "5", Pattern: "zoom.exe", Action: apprules.ActionBlock, Enabled: false},
+	)
+	engine, err := ParseDryRunConfig(data, nil)
+	if err != nil {
+		t.Fatalf("ParseDryRunConfig: %v", err)
+	}
+	if len(engine.Unsupported()) != 0 {
+		t.Fatalf("generated config has unsupported rules: %v", engine.Unsupported())
+	}
+	cases := []struct {
+		name     string
+		conn     Conn
+		action   string
+		outbound string
+	}{
+		{"wildcard name", Conn{Domain: "example.com", Process: `C:\Users\me\Telegram Desktop\Telegram.exe`}, DryRunRoute, "proxy-out"},
+		{"block beats domain", Conn{Domain: "mail.google.com", Process: `C:\Tools\miner64.exe`}, DryRunReject, ""},
+		{"domain beats app rule", Conn{Domain: "mail.google.com", Process: `C:\Apps\Telegram.exe`}, DryRunRoute, "direct"},
+		{"priority", Conn{Domain: "example.com", Process: `C:\Games\Steam\steam.exe`}, DryRunRoute, "direct"},
+		{"full path wildcard", Conn{Domain: "example.com", Process: `C:\Games\Other\game.exe`}, DryRunRoute, "proxy-out"},
+		{"disabled rule", Conn{Domain: "example.com", Process: `C:\Zoom\zoom.exe`}, DryRunRoute, "direct"},
+	}
+	for _, tc := range cases {
+		res, err := engine.Evaluate(tc.conn)
+		if err != nil {
+			t.Fatalf("%s: Evaluate: %v", tc.name, err)
+		}
+		if res.Action != tc.action || res.Outbound != tc.outbound {
+			t.Errorf("%s: got %s/%s (rule %d), want %s/%s\n%v", tc.name, res.Action, res.Outbound, res.RuleIndex, tc.action, tc.outbound, res.Explanation)
+		}
+	}
+}
+
+func TestDryRunSkipsUnsupportedAndMissingRuleSets(t *testing.T) {
+	data := []byte(`{"route": {
+		"rules": [
+			{"action": "sniff"},
+			{"source_ip_cidr": ["10.0.0.0/8"], "action": "reject"},
+			{"rule_set": ["geosite-missing"], "outbound": "direct"},
+			{"domain_suffix": [".example.com"], "outbound": "proxy-out"}
+		],
+		"rule_set": [{"type": "local", "tag": "geosite-missing", "format": "binary", "path": "data/geosite-missing.bin"}],
+		"final": "block"
+	}}`)
+	engine, err := ParseDryRunConfig(data, func(config.SBRuleSet) (*srs.RuleSet, error) {
+		return nil, os.ErrNotExist
+	})
+	if err != nil {
+		t.Fatalf("ParseDryRunConfig: %v", err)
+	}
+	if fields := engine.Unsupported()[1]; len(fields) != 1 || fields[0] != "source_ip_cidr" {
+		t.Fatalf("unsupported = %v", engine.Unsupported())
+	}
+	res, err := engine.Evaluate(Conn{Domain: "ads.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RuleIndex != 3 || res.Outbound != "proxy-out" || len(res.Explanation) != 4 {
+		t.Errorf("result = %+v", res)
+	}
+	// ".example.com" — только поддомены.
+	if res, _ := engine.Evaluate(Conn{Domain: "example.com"}); res.RuleIndex != -1 || res.Outbound != "block" {
+		t.Errorf("bare domain = %+v", res)
+	}
+
+	for _, bad := range []Conn{{}, {IP: "not-an-ip"}, {Domain: "example.com", Network: "icmp"}} {
+		if _, err := engine.Evaluate(bad); err == nil {
+			t.Errorf("Evaluate(%+v): expected error", bad)
+		}
+	}
+	if _, err := ParseDryRunConfig([]byte(`{"outbounds": []}`), nil); err == nil {
+		t.Error("config without route must be rejected")
+	}
+}
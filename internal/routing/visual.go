@@ -2,7 +2,9 @@ package routing
 
 import (
 	"net"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -110,6 +112,11 @@ func match(m RuleMatch, value string) bool {
 			if strings.Contains(value, candidate) {
 				return true
 			}
+		case "domain_regex":
+			// Выражение сверяется без приведения к нижнему регистру.
+			if re, err := regexp.Compile(strings.TrimSpace(raw)); err == nil && re.MatchString(value) {
+				return true
+			}
 		case "ip":
 			if value == candidate {
 				return true
@@ -121,6 +128,10 @@ func match(m RuleMatch, value string) bool {
 				return true
 			}
 		case "port":
+			if value == candidate || portRangeContains(candidate, value) {
+				return true
+			}
+		case "network":
 			if value == candidate {
 				return true
 			}
@@ -188,7 +199,7 @@ func valuesOverlap(typeA, a, typeB, b string) bool {
 
 func singBoxField(t string) string {
 	switch t {
-	case "domain", "domain_suffix", "domain_keyword", "ip_cidr", "geosite", "geoip":
+	case "domain", "domain_suffix", "domain_keyword", "domain_regex", "ip_cidr", "geosite", "geoip", "network":
 		return t
 	case "ip":
 		return "ip_cidr"
@@ -237,6 +248,18 @@ func normalizedValues(values []string) []string {
 	return out
 }
 
+// portRangeContains проверяет диапазон вида "8000-9000".
+func portRangeContains(r, value string) bool {
+	lo, hi, ok := strings.Cut(r, "-")
+	if !ok {
+		return false
+	}
+	from, errFrom := strconv.Atoi(lo)
+	to, errTo := strconv.Atoi(hi)
+	port, errPort := strconv.Atoi(value)
+	return errFrom == nil && errTo == nil && errPort == nil && port >= from && port <= to
+}
+
 func filepathBase(value string) string {
 	value = strings.ReplaceAll(value, "\\", "/")
 	parts := strings.Split(value, "/")
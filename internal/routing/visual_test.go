@@ -18,6 +18,9 @@ func TestMatchValueTypes(t *testing.T) {
 		{"ip_cidr", RoutingRule{Enabled: true, Match: RuleMatch{Type: "ip_cidr", Values: []string{"10.0.0.0/8"}}}, "10.1.2.3"},
 		{"process", RoutingRule{Enabled: true, Match: RuleMatch{Type: "process", Values: []string{"chrome.exe"}}}, `C:\Program Files\Chrome\chrome.exe`},
 		{"geosite", RoutingRule{Enabled: true, Match: RuleMatch{Type: "geosite", Values: []string{"ru"}}}, "geosite:ru"},
+		{"domain_regex", RoutingRule{Enabled: true, Match: RuleMatch{Type: "domain_regex", Values: []string{`^cdn\d+\.`}}}, "cdn7.example.org"},
+		{"port range", RoutingRule{Enabled: true, Match: RuleMatch{Type: "port", Values: []string{"8000-9000"}}}, "8443"},
+		{"network", RoutingRule{Enabled: true, Match: RuleMatch{Type: "network", Values: []string{"udp"}}}, "udp"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
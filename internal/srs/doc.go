@@ -0,0 +1,5 @@
+// Package srs reads and writes sing-box binary rule-set (.srs) files, such as
+// the geosite-*.bin databases in the data directory, compiles them from plain
+// text domain lists and matches connections against them without running
+// sing-box.
+package srs
@@ -0,0 +1,260 @@
+package srs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Служебные метки succinct-дерева sing-box: prefixLabel — правило ".example.com"
+// (только поддомены), rootLabel — domain_suffix "example.com" (сам домен и поддомены).
+const (
+	prefixLabel = '\r'
+	rootLabel   = '\n'
+)
+
+// DomainSet — множество domain и domain_suffix правила, упакованное в
+// succinct-дерево (LOUDS) по перевёрнутым доменам, как его хранит sing-box.
+type DomainSet struct {
+	leaves      []uint64
+	labelBitmap []uint64
+	labels      []byte
+	ranks       []int32
+}
+
+func readDomainSet(r *bufio.Reader) (*DomainSet, error) {
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 {
+		return nil, fmt.Errorf("unsupported domain set version %d", version)
+	}
+	ds := &DomainSet{}
+	if ds.leaves, err = readUint64s(r); err != nil {
+		return nil, err
+	}
+	if ds.labelBitmap, err = readUint64s(r); err != nil {
+		return nil, err
+	}
+	if ds.labels, err = readBytes(r); err != nil {
+		return nil, err
+	}
+	ds.init()
+	return ds, nil
+}
+
+func (ds *DomainSet) init() {
+	ds.ranks = make([]int32, len(ds.labelBitmap)+1)
+	for i, w := range ds.labelBitmap {
+		ds.ranks[i+1] = ds.ranks[i] + int32(bits.OnesCount64(w))
+	}
+}
+
+func getBit(bm []uint64, i int) bool {
+	if i < 0 || i>>6 >= len(bm) {
+		return false
+	}
+	return bm[i>>6]&(1<<uint(i&63)) != 0
+}
+
+// countOnes — число единиц в битах [0, i).
+func (ds *DomainSet) countOnes(i int) int {
+	w := i >> 6
+	if w >= len(ds.labelBitmap) {
+		return int(ds.ranks[len(ds.labelBitmap)])
+	}
+	return int(ds.ranks[w]) + bits.OnesCount64(ds.labelBitmap[w]&(1<<uint(i&63)-1))
+}
+
+func (ds *DomainSet) countZeros(i int) int {
+	return i - ds.countOnes(i)
+}
+
+// selectIthOne — позиция i-й (с нуля) единицы или -1.
+func (ds *DomainSet) selectIthOne(i int) int {
+	if i < 0 || i >= int(ds.ranks[len(ds.labelBitmap)]) {
+		return -1
+	}
+	w := sort.Search(len(ds.labelBitmap), func(k int) bool { return int(ds.ranks[k+1]) > i })
+	word := ds.labelBitmap[w]
+	for rest := i - int(ds.ranks[w]); rest > 0; rest-- {
+		word &= word - 1
+	}
+	return w<<6 + bits.TrailingZeros64(word)
+}
+
+// child переходит к первому потомку узла, на метку которого указывает bmIdx.
+func (ds *DomainSet) child(bmIdx int) (nodeID, next int, ok bool) {
+	nodeID = ds.countZeros(bmIdx + 1)
+	pos := ds.selectIthOne(nodeID - 1)
+	if pos < 0 {
+		return 0, 0, false
+	}
+	return nodeID, pos + 1, true
+}
+
+// Has сообщает, совпадает ли домен с одним из domain / domain_suffix множества.
+func (ds *DomainSet) Has(domain string) bool {
+	if ds == nil || len(ds.labels) == 0 {
+		return false
+	}
+	key := reverseDomain(strings.ToLower(domain))
+	nodeID, bmIdx := 0, 0
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		for ; ; bmIdx++ {
+			if getBit(ds.labelBitmap, bmIdx) || bmIdx-nodeID >= len(ds.labels) {
+				return false
+			}
+			label := ds.labels[bmIdx-nodeID]
+			if label == prefixLabel {
+				return true
+			}
+			if label == rootLabel {
+				if c == '.' && getBit(ds.leaves, ds.countZeros(bmIdx+1)) {
+					return true
+				}
+			}
+			if label == c {
+				break
+			}
+		}
+		var ok bool
+		nodeID, bmIdx, ok = ds.child(bmIdx)
+		if !ok {
+			return false
+		}
+	}
+	if getBit(ds.leaves, nodeID) {
+		return true
+	}
+	for ; ; bmIdx++ {
+		if getBit(ds.labelBitmap, bmIdx) || bmIdx-nodeID >= len(ds.labels) {
+			return false
+		}
+		if label := ds.labels[bmIdx-nodeID]; label == prefixLabel || label == rootLabel {
+			return true
+		}
+	}
+}
+
+// NewDomainSet строит множество так же, как domain.NewMatcher в sing-box для
+// rule-set'ов версии 2 и новее: domain_suffix без точки хранится с rootLabel
+// (сам домен и поддомены), с ведущей точкой — с prefixLabel (только поддомены).
+// Пустые значения и повторы отбрасываются.
+func NewDomainSet(domains, suffixes []string) *DomainSet {
+	seen := make(map[string]bool, len(domains)+len(suffixes))
+	keys := make([]string, 0, len(domains)+len(suffixes))
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, reverseDomain(key))
+		}
+	}
+	for _, s := range suffixes {
+		s = strings.ToLower(s)
+		switch {
+		case s == "" || s == ".":
+		case s[0] == '.':
+			add(string(prefixLabel) + s)
+		default:
+			add(string(rootLabel) + s)
+		}
+	}
+	for _, d := range domains {
+		if d = strings.ToLower(d); d != "" {
+			add(d)
+		}
+	}
+	sort.Strings(keys)
+
+	ds := &DomainSet{}
+	setBit := func(bm *[]uint64, i int) {
+		for i>>6 >= len(*bm) {
+			*bm = append(*bm, 0)
+		}
+		(*bm)[i>>6] |= 1 << uint(i&63)
+	}
+	// Обход в ширину: каждый узел — диапазон ключей [s, e) с общим префиксом
+	// длины col. Метки детей узла идут подряд, после них — единица в labelBitmap.
+	type elt struct{ s, e, col int }
+	queue := []elt{{0, len(keys), 0}}
+	lIdx := 0
+	for i := 0; i < len(queue); i++ {
+		q := queue[i]
+		if q.s < q.e && q.col == len(keys[q.s]) {
+			q.s++
+			setBit(&ds.leaves, i)
+		}
+		for j := q.s; j < q.e; {
+			from := j
+			for ; j < q.e && keys[j][q.col] == keys[from][q.col]; j++ {
+			}
+			queue = append(queue, elt{from, j, q.col + 1})
+			ds.labels = append(ds.labels, keys[from][q.col])
+			for lIdx>>6 >= len(ds.labelBitmap) {
+				ds.labelBitmap = append(ds.labelBitmap, 0)
+			}
+			lIdx++
+		}
+		setBit(&ds.labelBitmap, lIdx)
+		lIdx++
+	}
+	ds.init()
+	return ds
+}
+
+// Domains разворачивает множество обратно в списки domain и domain_suffix.
+// Суффиксы в legacy-кодировке версии 1 (пара "example.com" + ".example.com")
+// возвращаются как есть: точный домен и суффикс с точкой.
+func (ds *DomainSet) Domains() (domains, suffixes []string) {
+	if ds == nil {
+		return nil, nil
+	}
+	var walk func(nodeID, bmIdx int, key []byte)
+	walk = func(nodeID, bmIdx int, key []byte) {
+		if getBit(ds.leaves, nodeID) && len(key) > 0 {
+			d := reverseDomain(string(key))
+			switch d[0] {
+			case rootLabel, prefixLabel:
+				suffixes = append(suffixes, d[1:])
+			default:
+				domains = append(domains, d)
+			}
+		}
+		for ; !getBit(ds.labelBitmap, bmIdx) && bmIdx-nodeID < len(ds.labels); bmIdx++ {
+			child := ds.countZeros(bmIdx + 1)
+			pos := ds.selectIthOne(child - 1)
+			if pos < 0 {
+				return
+			}
+			walk(child, pos+1, append(key, ds.labels[bmIdx-nodeID]))
+		}
+	}
+	walk(0, 0, nil)
+	sort.Strings(domains)
+	sort.Strings(suffixes)
+	return domains, suffixes
+}
+
+// hasRootLabel сообщает, есть ли в множестве суффиксы в кодировке версии 2+.
+func (ds *DomainSet) hasRootLabel() bool {
+	return ds != nil && bytes.IndexByte(ds.labels, rootLabel) >= 0
+}
+
+// reverseDomain переворачивает домен посимвольно (по рунам), как ключи дерева.
+func reverseDomain(domain string) string {
+	l := len(domain)
+	b := make([]byte, l)
+	for i := 0; i < l; {
+		r, n := utf8.DecodeRuneInString(domain[i:])
+		i += n
+		utf8.EncodeRune(b[l-i:], r)
+	}
+	return string(b)
+}
@@ -0,0 +1,333 @@
+package srs
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+)
+
+var magic = [3]byte{'S', 'R', 'S'}
+
+// MaxVersion — последняя версия формата, которую умеет читать пакет.
+const MaxVersion = 3
+
+// Коды элементов правила в бинарном формате sing-box.
+const (
+	itemQueryType uint8 = iota
+	itemNetwork
+	itemDomain
+	itemDomainKeyword
+	itemDomainRegex
+	itemSourceIPCIDR
+	itemIPCIDR
+	itemSourcePort
+	itemSourcePortRange
+	itemPort
+	itemPortRange
+	itemProcessName
+	itemProcessPath
+	itemPackageName
+	itemWIFISSID
+	itemWIFIBSSID
+	itemAdGuardDomain
+	itemProcessPathRegex
+	itemFinal uint8 = 0xFF
+)
+
+// Защита от повреждённых файлов: ни один реальный geosite не подходит к этим пределам.
+const (
+	maxItems    = 1 << 24
+	maxItemSize = 1 << 26
+)
+
+var errTooLarge = errors.New("srs: length out of range")
+
+// ReadFile читает rule-set из файла path.
+func ReadFile(path string) (*RuleSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rs, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rs, nil
+}
+
+// Read разбирает rule-set в бинарном формате: заголовок "SRS", байт версии
+// и zlib-поток с правилами.
+func Read(r io.Reader) (*RuleSet, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("srs: read header: %w", err)
+	}
+	if [3]byte(header[:3]) != magic {
+		return nil, errors.New("srs: invalid magic")
+	}
+	version := header[3]
+	if version == 0 || version > MaxVersion {
+		return nil, fmt.Errorf("srs: unsupported version %d", version)
+	}
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("srs: %w", err)
+	}
+	defer zr.Close()
+	br := bufio.NewReader(zr)
+	count, err := readLength(br)
+	if err != nil {
+		return nil, fmt.Errorf("srs: rule count: %w", err)
+	}
+	rs := &RuleSet{Version: version, Rules: make([]Rule, 0, min(count, 1024))}
+	for i := 0; i < count; i++ {
+		rule, err := readRule(br)
+		if err != nil {
+			return nil, fmt.Errorf("srs: rule %d: %w", i, err)
+		}
+		rs.Rules = append(rs.Rules, rule)
+	}
+	// Дочитываем поток до конца: zlib проверяет контрольную сумму только на EOF,
+	// иначе обрезанный файл прочитался бы без ошибки.
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		return nil, fmt.Errorf("srs: %w", err)
+	}
+	return rs, nil
+}
+
+func readRule(r *bufio.Reader) (Rule, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return Rule{}, err
+	}
+	switch kind {
+	case 0:
+		return readDefaultRule(r)
+	case 1:
+		return readLogicalRule(r)
+	default:
+		return Rule{}, fmt.Errorf("unknown rule type %d", kind)
+	}
+}
+
+func readLogicalRule(r *bufio.Reader) (Rule, error) {
+	rule := Rule{Type: RuleLogical}
+	mode, err := r.ReadByte()
+	if err != nil {
+		return rule, err
+	}
+	switch mode {
+	case 0:
+		rule.Mode = ModeAnd
+	case 1:
+		rule.Mode = ModeOr
+	default:
+		return rule, fmt.Errorf("unknown logical mode %d", mode)
+	}
+	count, err := readLength(r)
+	if err != nil {
+		return rule, err
+	}
+	for i := 0; i < count; i++ {
+		sub, err := readRule(r)
+		if err != nil {
+			return rule, err
+		}
+		rule.Rules = append(rule.Rules, sub)
+	}
+	rule.Invert, err = readBool(r)
+	return rule, err
+}
+
+func readDefaultRule(r *bufio.Reader) (Rule, error) {
+	rule := Rule{Type: RuleDefault}
+	for {
+		code, err := r.ReadByte()
+		if err != nil {
+			return rule, err
+		}
+		switch code {
+		case itemFinal:
+			rule.Invert, err = readBool(r)
+			return rule, err
+		case itemQueryType:
+			rule.QueryType, err = readUint16s(r)
+		case itemNetwork:
+			rule.Network, err = readStrings(r)
+		case itemDomain:
+			rule.Domain, err = readDomainSet(r)
+		case itemDomainKeyword:
+			rule.DomainKeyword, err = readStrings(r)
+		case itemDomainRegex:
+			rule.DomainRegex, err = readStrings(r)
+		case itemSourceIPCIDR:
+			rule.SourceIPCIDR, err = readIPSet(r)
+		case itemIPCIDR:
+			rule.IPCIDR, err = readIPSet(r)
+		case itemSourcePort:
+			rule.SourcePort, err = readUint16s(r)
+		case itemSourcePortRange:
+			rule.SourcePortRange, err = readStrings(r)
+		case itemPort:
+			rule.Port, err = readUint16s(r)
+		case itemPortRange:
+			rule.PortRange, err = readStrings(r)
+		case itemProcessName:
+			rule.ProcessName, err = readStrings(r)
+		case itemProcessPath:
+			rule.ProcessPath, err = readStrings(r)
+		case itemPackageName:
+			rule.PackageName, err = readStrings(r)
+		case itemWIFISSID:
+			rule.WIFISSID, err = readStrings(r)
+		case itemWIFIBSSID:
+			rule.WIFIBSSID, err = readStrings(r)
+		case itemProcessPathRegex:
+			rule.ProcessPathRegex, err = readStrings(r)
+		case itemAdGuardDomain:
+			return rule, errors.New("adguard domain rules are not supported")
+		default:
+			return rule, fmt.Errorf("unknown rule item type %d", code)
+		}
+		if err != nil {
+			return rule, fmt.Errorf("item %d: %w", code, err)
+		}
+	}
+}
+
+func readBool(r *bufio.Reader) (bool, error) {
+	b, err := r.ReadByte()
+	return b != 0, err
+}
+
+func readLength(r *bufio.Reader) (int, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, err
+	}
+	if n > maxItemSize {
+		return 0, errTooLarge
+	}
+	return int(n), nil
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+func readStrings(r *bufio.Reader) ([]string, error) {
+	count, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxItems {
+		return nil, errTooLarge
+	}
+	out := make([]string, 0, min(count, 1024))
+	for i := 0; i < count; i++ {
+		b, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, string(b))
+	}
+	return out, nil
+}
+
+func readUint16s(r *bufio.Reader) ([]uint16, error) {
+	count, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxItems {
+		return nil, errTooLarge
+	}
+	out := make([]uint16, 0, min(count, 1024))
+	var b [2]byte
+	for i := 0; i < count; i++ {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		out = append(out, binary.BigEndian.Uint16(b[:]))
+	}
+	return out, nil
+}
+
+func readUint64s(r *bufio.Reader) ([]uint64, error) {
+	count, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxItems {
+		return nil, errTooLarge
+	}
+	out := make([]uint64, 0, min(count, 1024))
+	var b [8]byte
+	for i := 0; i < count; i++ {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		out = append(out, binary.BigEndian.Uint64(b[:]))
+	}
+	return out, nil
+}
+
+// readIPSet читает набор диапазонов адресов: байт версии (1), uint64 число
+// диапазонов и пары адресов from/to с префиксом длины.
+func readIPSet(r *bufio.Reader) ([]IPRange, error) {
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("unsupported ipset version %d", version)
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, err
+	}
+	count := binary.BigEndian.Uint64(b[:])
+	if count > maxItems {
+		return nil, errTooLarge
+	}
+	out := make([]IPRange, 0, min(int(count), 1024))
+	for i := uint64(0); i < count; i++ {
+		from, err := readAddr(r)
+		if err != nil {
+			return nil, err
+		}
+		to, err := readAddr(r)
+		if err != nil {
+			return nil, err
+		}
+		if from.Is4() != to.Is4() || to.Less(from) {
+			return nil, fmt.Errorf("invalid ip range %s-%s", from, to)
+		}
+		out = append(out, IPRange{From: from, To: to})
+	}
+	return out, nil
+}
+
+func readAddr(r *bufio.Reader) (netip.Addr, error) {
+	b, err := readBytes(r)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, ok := netip.AddrFromSlice(b)
+	if !ok {
+		return netip.Addr{}, fmt.Errorf("invalid address length %d", len(b))
+	}
+	return addr, nil
+}
@@ -0,0 +1,285 @@
+package srs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testRule — правило для тестового кодировщика в формате sing-box.
+type testRule struct {
+	logical  bool
+	mode     uint8
+	rules    []testRule
+	invert   bool
+	domain   []string
+	suffix   []string
+	keyword  []string
+	cidr     []netip.Prefix
+	port     []uint16
+	network  []string
+	process  []string
+	portSpan []string
+}
+
+type testWriter struct{ bytes.Buffer }
+
+func (w *testWriter) uvarint(n int) {
+	w.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (w *testWriter) bytesItem(b []byte) {
+	w.uvarint(len(b))
+	w.Write(b)
+}
+
+func (w *testWriter) strings(code uint8, list []string) {
+	if len(list) == 0 {
+		return
+	}
+	w.WriteByte(code)
+	w.uvarint(len(list))
+	for _, s := range list {
+		w.bytesItem([]byte(s))
+	}
+}
+
+func (w *testWriter) uint64s(list []uint64) {
+	w.uvarint(len(list))
+	for _, v := range list {
+		w.Write(binary.BigEndian.AppendUint64(nil, v))
+	}
+}
+
+func (w *testWriter) rule(r testRule) {
+	if r.logical {
+		w.WriteByte(1)
+		w.WriteByte(r.mode)
+		w.uvarint(len(r.rules))
+		for _, sub := range r.rules {
+			w.rule(sub)
+		}
+		w.WriteByte(boolByte(r.invert))
+		return
+	}
+	w.WriteByte(0)
+	w.strings(itemNetwork, r.network)
+	if len(r.domain) > 0 || len(r.suffix) > 0 {
+		ss := NewDomainSet(r.domain, r.suffix)
+		w.WriteByte(itemDomain)
+		w.WriteByte(0)
+		w.uint64s(ss.leaves)
+		w.uint64s(ss.labelBitmap)
+		w.bytesItem(ss.labels)
+	}
+	w.strings(itemDomainKeyword, r.keyword)
+	if len(r.cidr) > 0 {
+		w.WriteByte(itemIPCIDR)
+		w.WriteByte(1)
+		w.Write(binary.BigEndian.AppendUint64(nil, uint64(len(r.cidr))))
+		for _, p := range r.cidr {
+			from, to := p.Masked().Addr(), lastAddr(p)
+			w.bytesItem(from.AsSlice())
+			w.bytesItem(to.AsSlice())
+		}
+	}
+	if len(r.port) > 0 {
+		w.WriteByte(itemPort)
+		w.uvarint(len(r.port))
+		for _, p := range r.port {
+			w.Write(binary.BigEndian.AppendUint16(nil, p))
+		}
+	}
+	w.strings(itemPortRange, r.portSpan)
+	w.strings(itemProcessName, r.process)
+	w.WriteByte(itemFinal)
+	w.WriteByte(boolByte(r.invert))
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - uint(i%8))
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+func encodeRuleSet(t *testing.T, rules ...testRule) []byte {
+	t.Helper()
+	var body testWriter
+	body.uvarint(len(rules))
+	for _, r := range rules {
+		body.rule(r)
+	}
+	var out bytes.Buffer
+	out.WriteString("SRS")
+	out.WriteByte(1)
+	zw := zlib.NewWriter(&out)
+	if _, err := zw.Write(body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestDomainSetHas(t *testing.T) {
+	ds := NewDomainSet(
+		[]string{"exact.example.org", "пример.рф"},
+		[]string{"google.com", ".only-sub.net", "t.me"},
+	)
+	cases := map[string]bool{
+		"google.com":          true,
+		"www.google.com":      true,
+		"a.b.google.com":      true,
+		"notgoogle.com":       false,
+		"google.com.evil":     false,
+		"only-sub.net":        false,
+		"x.only-sub.net":      true,
+		"exact.example.org":   true,
+		"a.exact.example.org": false,
+		"example.org":         false,
+		"пример.рф":           true,
+		"t.me":                true,
+		"at.me":               false,
+		"":                    false,
+		"GOOGLE.COM":          true,
+	}
+	for domain, want := range cases {
+		if got := ds.Has(domain); got != want {
+			t.Errorf("Has(%q) = %v, want %v", domain, got, want)
+		}
+	}
+}
+
+func TestReadAndMatch(t *testing.T) {
+	data := encodeRuleSet(t,
+		testRule{suffix: []string{"youtube.com", "googlevideo.com"}, keyword: []string{"ytimg"}},
+		testRule{cidr: []netip.Prefix{netip.MustParsePrefix("91.108.4.0/22"), netip.MustParsePrefix("2001:b28:f23d::/48")}},
+		testRule{network: []string{"udp"}, port: []uint16{3478}, portSpan: []string{"19302:19309"}},
+		testRule{logical: true, mode: 0, rules: []testRule{
+			{process: []string{"steam.exe"}},
+			{suffix: []string{"steamcontent.com"}, invert: true},
+		}},
+	)
+	rs, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if rs.Version != 1 || len(rs.Rules) != 4 || rs.Rules[3].Type != RuleLogical || rs.Rules[3].Mode != ModeAnd {
+		t.Fatalf("rules = %+v", rs.Rules)
+	}
+	cases := []struct {
+		name string
+		m    Metadata
+		want bool
+	}{
+		{"suffix", Metadata{Domain: "rr1.googlevideo.com"}, true},
+		{"keyword", Metadata{Domain: "i.ytimg.com"}, true},
+		{"ipv4 range", Metadata{IP: netip.MustParseAddr("91.108.6.1")}, true},
+		{"ipv4 mapped", Metadata{IP: netip.MustParseAddr("::ffff:91.108.7.255")}, true},
+		{"ipv6 range", Metadata{IP: netip.MustParseAddr("2001:b28:f23d:1::1")}, true},
+		{"outside", Metadata{Domain: "example.com", IP: netip.MustParseAddr("91.108.8.1")}, false},
+		{"stun port", Metadata{Network: "udp", Port: 3478}, true},
+		{"stun range", Metadata{Network: "udp", Port: 19305}, true},
+		{"stun tcp", Metadata{Network: "tcp", Port: 3478}, false},
+		{"logical and", Metadata{Domain: "store.example", ProcessPath: `C:\Games\Steam\steam.exe`}, true},
+		{"logical and inverted", Metadata{Domain: "cdn.steamcontent.com", ProcessPath: `C:\Games\Steam\steam.exe`}, false},
+	}
+	for _, tc := range cases {
+		if got := rs.Match(tc.m); got != tc.want {
+			t.Errorf("%s: Match = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// testdata/ruleset.srs записан не этим пакетом (см. testdata/README.md).
+func TestReadFileSingBoxFixture(t *testing.T) {
+	rs, err := ReadFile(filepath.Join("testdata", "ruleset.srs"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if rs.Version != 3 || len(rs.Rules) != 3 {
+		t.Fatalf("ruleset = %+v", rs)
+	}
+	if _, suffixes := rs.Rules[0].Domain.Domains(); !slices.Equal(suffixes, []string{"example.com"}) {
+		t.Errorf("rule 0 domain_suffix = %v", suffixes)
+	}
+	wantRange := IPRange{From: netip.MustParseAddr("10.0.0.0"), To: netip.MustParseAddr("10.255.255.255")}
+	if got := rs.Rules[1].IPCIDR; len(got) != 1 || got[0] != wantRange {
+		t.Errorf("rule 1 ip_cidr = %v", got)
+	}
+	logical := rs.Rules[2]
+	if logical.Type != RuleLogical || logical.Mode != ModeAnd || len(logical.Rules) != 2 ||
+		!slices.Equal(logical.Rules[1].Port, []uint16{443}) {
+		t.Errorf("rule 2 = %+v", logical)
+	}
+
+	cases := []struct {
+		name string
+		m    Metadata
+		want bool
+	}{
+		{"suffix itself", Metadata{Domain: "example.com"}, true},
+		{"suffix subdomain", Metadata{Domain: "www.Example.com"}, true},
+		{"suffix lookalike", Metadata{Domain: "notexample.com"}, false},
+		{"ip_cidr", Metadata{IP: netip.MustParseAddr("10.1.2.3")}, true},
+		{"ip_cidr outside", Metadata{IP: netip.MustParseAddr("11.0.0.1")}, false},
+		{"logical and", Metadata{Domain: "api.example.org", Port: 443}, true},
+		{"logical and wrong port", Metadata{Domain: "api.example.org", Port: 80}, false},
+		{"logical and wrong domain", Metadata{Domain: "example.net", Port: 443}, false},
+	}
+	for _, tc := range cases {
+		if got := rs.Match(tc.m); got != tc.want {
+			t.Errorf("%s: Match = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReadRejectsInvalidInput(t *testing.T) {
+	good := encodeRuleSet(t, testRule{domain: []string{"example.com"}})
+	bad := map[string][]byte{
+		"magic":     append([]byte("SRX"), good[3:]...),
+		"version":   append([]byte("SRS\x09"), good[4:]...),
+		"truncated": good[:len(good)-4],
+		"empty":     nil,
+	}
+	for name, data := range bad {
+		if _, err := Read(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	cases := []struct {
+		in       string
+		from, to uint16
+		ok       bool
+	}{
+		{"1000:2000", 1000, 2000, true},
+		{":3000", 0, 3000, true},
+		{"4000:", 4000, 65535, true},
+		{"2000:1000", 0, 0, false},
+		{"80", 0, 0, false},
+	}
+	for _, tc := range cases {
+		from, to, ok := ParsePortRange(tc.in)
+		if ok != tc.ok || (ok && (from != tc.from || to != tc.to)) {
+			t.Errorf("ParsePortRange(%q) = %d, %d, %v", tc.in, from, to, ok)
+		}
+	}
+}
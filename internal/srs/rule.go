@@ -0,0 +1,274 @@
+package srs
+
+import (
+	"net/netip"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RuleType — вид правила: обычное (набор условий) или логическое (and/or над правилами).
+type RuleType uint8
+
+const (
+	RuleDefault RuleType = iota
+	RuleLogical
+)
+
+// Режимы логического правила.
+const (
+	ModeAnd = "and"
+	ModeOr  = "or"
+)
+
+// RuleSet — разобранный rule-set. Соединение совпадает с rule-set'ом, если
+// совпало хотя бы одно из его правил.
+type RuleSet struct {
+	Version uint8
+	Rules   []Rule
+}
+
+// IPRange — диапазон адресов [From, To] одного семейства.
+type IPRange struct {
+	From netip.Addr
+	To   netip.Addr
+}
+
+// Contains сообщает, попадает ли addr в диапазон.
+func (r IPRange) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.Is4() == r.From.Is4() && r.From.Compare(addr) <= 0 && addr.Compare(r.To) <= 0
+}
+
+// Rule — правило rule-set'а. Для RuleLogical заполнены Mode и Rules,
+// для RuleDefault — условия.
+type Rule struct {
+	Type   RuleType
+	Invert bool
+
+	Mode  string
+	Rules []Rule
+
+	QueryType        []uint16
+	Network          []string
+	Domain           *DomainSet
+	DomainKeyword    []string
+	DomainRegex      []string
+	SourceIPCIDR     []IPRange
+	IPCIDR           []IPRange
+	SourcePort       []uint16
+	SourcePortRange  []string
+	Port             []uint16
+	PortRange        []string
+	ProcessName      []string
+	ProcessPath      []string
+	ProcessPathRegex []string
+	PackageName      []string
+	WIFISSID         []string
+	WIFIBSSID        []string
+}
+
+// Metadata — соединение, которое проверяется по rule-set'у.
+// Пустые поля не совпадают ни с одним условием.
+type Metadata struct {
+	Domain      string
+	IP          netip.Addr
+	Port        uint16
+	Network     string
+	SourceIP    netip.Addr
+	SourcePort  uint16
+	ProcessPath string
+}
+
+// Match сообщает, совпадает ли соединение хотя бы с одним правилом.
+func (rs *RuleSet) Match(m Metadata) bool {
+	if rs == nil {
+		return false
+	}
+	for i := range rs.Rules {
+		if rs.Rules[i].Match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match проверяет правило так же, как sing-box проверяет headless-правила:
+// адрес назначения (domain, domain_suffix, domain_keyword, domain_regex,
+// ip_cidr) — через ИЛИ, остальные группы условий — через И.
+func (r *Rule) Match(m Metadata) bool {
+	var ok bool
+	if r.Type == RuleLogical {
+		ok = r.Mode == ModeAnd
+		for i := range r.Rules {
+			sub := r.Rules[i].Match(m)
+			if r.Mode == ModeAnd && !sub {
+				ok = false
+				break
+			}
+			if r.Mode == ModeOr && sub {
+				ok = true
+				break
+			}
+		}
+	} else {
+		ok = r.matchDefault(m)
+	}
+	return ok != r.Invert
+}
+
+func (r *Rule) hasDestinationAddress() bool {
+	return r.Domain != nil || len(r.DomainKeyword) > 0 || len(r.DomainRegex) > 0 || len(r.IPCIDR) > 0
+}
+
+func (r *Rule) matchDefault(m Metadata) bool {
+	if r.hasDestinationAddress() && !r.matchDestinationAddress(m) {
+		return false
+	}
+	if len(r.SourceIPCIDR) > 0 && !matchIP(r.SourceIPCIDR, m.SourceIP) {
+		return false
+	}
+	if (len(r.Port) > 0 || len(r.PortRange) > 0) && !matchPort(r.Port, r.PortRange, m.Port) {
+		return false
+	}
+	if (len(r.SourcePort) > 0 || len(r.SourcePortRange) > 0) && !matchPort(r.SourcePort, r.SourcePortRange, m.SourcePort) {
+		return false
+	}
+	if len(r.Network) > 0 && !containsFold(r.Network, m.Network) {
+		return false
+	}
+	if len(r.ProcessName) > 0 || len(r.ProcessPath) > 0 || len(r.ProcessPathRegex) > 0 {
+		if !r.matchProcess(m.ProcessPath) {
+			return false
+		}
+	}
+	// query_type, package_name и wifi_* не относятся к соединениям TUN на Windows.
+	if len(r.QueryType) > 0 || len(r.PackageName) > 0 || len(r.WIFISSID) > 0 || len(r.WIFIBSSID) > 0 {
+		return false
+	}
+	return true
+}
+
+func (r *Rule) matchDestinationAddress(m Metadata) bool {
+	if m.Domain != "" {
+		domain := strings.ToLower(strings.TrimSuffix(m.Domain, "."))
+		if r.Domain.Has(domain) {
+			return true
+		}
+		for _, kw := range r.DomainKeyword {
+			if strings.Contains(domain, kw) {
+				return true
+			}
+		}
+		for _, expr := range r.DomainRegex {
+			if re := compileRegexp(expr); re != nil && re.MatchString(domain) {
+				return true
+			}
+		}
+	}
+	return matchIP(r.IPCIDR, m.IP)
+}
+
+func (r *Rule) matchProcess(path string) bool {
+	if path == "" {
+		return false
+	}
+	name := filepath.Base(strings.ReplaceAll(path, `\`, "/"))
+	for _, p := range r.ProcessName {
+		if strings.EqualFold(p, name) {
+			return true
+		}
+	}
+	for _, p := range r.ProcessPath {
+		if strings.EqualFold(p, path) {
+			return true
+		}
+	}
+	for _, expr := range r.ProcessPathRegex {
+		if re := compileRegexp(expr); re != nil && re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchIP(ranges []IPRange, addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	for _, rg := range ranges {
+		if rg.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPort(ports []uint16, ranges []string, port uint16) bool {
+	if port == 0 {
+		return false
+	}
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	for _, rg := range ranges {
+		if from, to, ok := ParsePortRange(rg); ok && from <= port && port <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePortRange разбирает диапазон портов sing-box: "1000:2000", ":3000" или "4000:".
+func ParsePortRange(s string) (from, to uint16, ok bool) {
+	lo, hi, found := strings.Cut(s, ":")
+	if !found {
+		return 0, 0, false
+	}
+	from, to = 0, 65535
+	if lo != "" {
+		v, err := strconv.ParseUint(lo, 10, 16)
+		if err != nil {
+			return 0, 0, false
+		}
+		from = uint16(v)
+	}
+	if hi != "" {
+		v, err := strconv.ParseUint(hi, 10, 16)
+		if err != nil {
+			return 0, 0, false
+		}
+		to = uint16(v)
+	}
+	return from, to, from <= to
+}
+
+func containsFold(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// regexCache — скомпилированные domain_regex: geosite содержит тысячи правил,
+// а одно выражение проверяется при каждом вызове Match.
+var regexCache sync.Map // string → *regexp.Regexp (nil — некорректное выражение)
+
+func compileRegexp(expr string) *regexp.Regexp {
+	if v, ok := regexCache.Load(expr); ok {
+		re, _ := v.(*regexp.Regexp)
+		return re
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		re = nil
+	}
+	regexCache.Store(expr, re)
+	return re
+}
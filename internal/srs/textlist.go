@@ -0,0 +1,116 @@
+package srs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// ParseTextList собирает правило из текстового списка, по записи на строку:
+//
+//	example.com        домен и поддомены (domain_suffix)
+//	domain:example.com то же, синтаксис v2fly
+//	+.example.com      то же, синтаксис Clash
+//	.example.com       только поддомены
+//	full:example.com   только сам домен (domain)
+//	keyword:cdn        domain_keyword
+//	regexp:^ads?\d+\.  domain_regex
+//	10.0.0.0/8         ip_cidr (одиночный адрес — подсеть /32 или /128)
+//
+// Пустые строки и комментарии (#, //) пропускаются, атрибуты v2fly (@cn)
+// отбрасываются. Пустой список — ошибка: правило без условий в sing-box
+// совпадает с любым соединением.
+func ParseTextList(r io.Reader) (*Rule, error) {
+	var domains, suffixes, keywords, regexes []string
+	var ranges []IPRange
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		s := strings.TrimSpace(sc.Text())
+		if line == 1 {
+			s = strings.TrimPrefix(s, "\ufeff")
+		}
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = strings.TrimSpace(s[:i])
+		}
+		if s == "" || strings.HasPrefix(s, "//") {
+			continue
+		}
+		if i := strings.IndexAny(s, " \t"); i >= 0 {
+			s = s[:i] // "example.com @cn"
+		}
+		kind, value, found := strings.Cut(s, ":")
+		if !found || isAddrOrPrefix(s) {
+			kind, value = "", s
+		}
+		switch kind {
+		case "", "domain":
+			if p, ok := parseAddrOrPrefix(value); ok {
+				ranges = append(ranges, PrefixRange(p))
+				continue
+			}
+			if plus, ok := strings.CutPrefix(value, "+."); ok {
+				value = plus
+			}
+			if !validDomain(value) {
+				return nil, fmt.Errorf("line %d: invalid domain %q", line, value)
+			}
+			suffixes = append(suffixes, strings.ToLower(value))
+		case "full":
+			if !validDomain(value) || strings.HasPrefix(value, ".") {
+				return nil, fmt.Errorf("line %d: invalid domain %q", line, value)
+			}
+			domains = append(domains, strings.ToLower(value))
+		case "keyword":
+			if value == "" {
+				return nil, fmt.Errorf("line %d: empty keyword", line)
+			}
+			keywords = append(keywords, strings.ToLower(value))
+		case "regexp":
+			if _, err := regexp.Compile(value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			regexes = append(regexes, value)
+		default:
+			return nil, fmt.Errorf("line %d: unsupported entry %q", line, kind+":")
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(domains)+len(suffixes)+len(keywords)+len(regexes)+len(ranges) == 0 {
+		return nil, errors.New("list is empty")
+	}
+	rule := &Rule{Type: RuleDefault, DomainKeyword: keywords, DomainRegex: regexes, IPCIDR: MergeRanges(ranges)}
+	if len(domains)+len(suffixes) > 0 {
+		rule.Domain = NewDomainSet(domains, suffixes)
+	}
+	return rule, nil
+}
+
+func isAddrOrPrefix(s string) bool {
+	_, ok := parseAddrOrPrefix(s)
+	return ok
+}
+
+func parseAddrOrPrefix(s string) (netip.Prefix, bool) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p, true
+	}
+	if a, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(a, a.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+// validDomain отсекает строки, которые не могут быть доменом: URL, пути, порты.
+func validDomain(s string) bool {
+	t := strings.TrimPrefix(s, ".")
+	return t != "" && !strings.ContainsAny(t, "/:?*@ ") && !strings.Contains(t, "..")
+}
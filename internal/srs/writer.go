@@ -0,0 +1,235 @@
+package srs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+)
+
+// DefaultVersion — версия, с которой пишутся rule-set'ы без явной версии:
+// первая, где domain_suffix хранится компактно (sing-box 1.10+).
+const DefaultVersion = 2
+
+// Write записывает rule-set в бинарном формате sing-box. Version == 0 — DefaultVersion.
+func Write(w io.Writer, rs *RuleSet) error {
+	version := rs.Version
+	if version == 0 {
+		version = DefaultVersion
+	}
+	if version > MaxVersion {
+		return fmt.Errorf("srs: unsupported version %d", version)
+	}
+	if _, err := w.Write(append(magic[:], version)); err != nil {
+		return err
+	}
+	zw, err := zlib.NewWriterLevel(w, zlib.BestCompression)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(zw)
+	writeUvarint(bw, len(rs.Rules))
+	for i := range rs.Rules {
+		if err := writeRule(bw, &rs.Rules[i], version); err != nil {
+			return fmt.Errorf("srs: rule %d: %w", i, err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Marshal — Write в память.
+func Marshal(rs *RuleSet) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Write(&buf, rs); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeRule(w *bufio.Writer, r *Rule, version uint8) error {
+	if r.Type == RuleLogical {
+		w.WriteByte(1)
+		switch r.Mode {
+		case ModeAnd:
+			w.WriteByte(0)
+		case ModeOr:
+			w.WriteByte(1)
+		default:
+			return fmt.Errorf("unknown logical mode %q", r.Mode)
+		}
+		writeUvarint(w, len(r.Rules))
+		for i := range r.Rules {
+			if err := writeRule(w, &r.Rules[i], version); err != nil {
+				return err
+			}
+		}
+		writeBool(w, r.Invert)
+		return nil
+	}
+
+	w.WriteByte(0)
+	writeUint16sItem(w, itemQueryType, r.QueryType)
+	writeStringsItem(w, itemNetwork, r.Network)
+	if r.Domain != nil {
+		// Версия 1 не знает rootLabel: такой rule-set sing-box прочитает неверно.
+		if version < 2 && r.Domain.hasRootLabel() {
+			return errors.New("domain_suffix requires rule-set version 2")
+		}
+		w.WriteByte(itemDomain)
+		w.WriteByte(0)
+		writeUint64s(w, r.Domain.leaves)
+		writeUint64s(w, r.Domain.labelBitmap)
+		writeBytes(w, r.Domain.labels)
+	}
+	writeStringsItem(w, itemDomainKeyword, r.DomainKeyword)
+	writeStringsItem(w, itemDomainRegex, r.DomainRegex)
+	writeIPSetItem(w, itemSourceIPCIDR, r.SourceIPCIDR)
+	writeIPSetItem(w, itemIPCIDR, r.IPCIDR)
+	writeUint16sItem(w, itemSourcePort, r.SourcePort)
+	writeStringsItem(w, itemSourcePortRange, r.SourcePortRange)
+	writeUint16sItem(w, itemPort, r.Port)
+	writeStringsItem(w, itemPortRange, r.PortRange)
+	writeStringsItem(w, itemProcessName, r.ProcessName)
+	writeStringsItem(w, itemProcessPath, r.ProcessPath)
+	writeStringsItem(w, itemProcessPathRegex, r.ProcessPathRegex)
+	writeStringsItem(w, itemPackageName, r.PackageName)
+	writeStringsItem(w, itemWIFISSID, r.WIFISSID)
+	writeStringsItem(w, itemWIFIBSSID, r.WIFIBSSID)
+	w.WriteByte(itemFinal)
+	writeBool(w, r.Invert)
+	return nil
+}
+
+func writeBool(w *bufio.Writer, b bool) {
+	if b {
+		w.WriteByte(1)
+	} else {
+		w.WriteByte(0)
+	}
+}
+
+func writeUvarint(w *bufio.Writer, n int) {
+	w.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func writeBytes(w *bufio.Writer, b []byte) {
+	writeUvarint(w, len(b))
+	w.Write(b)
+}
+
+func writeUint64s(w *bufio.Writer, list []uint64) {
+	writeUvarint(w, len(list))
+	for _, v := range list {
+		w.Write(binary.BigEndian.AppendUint64(nil, v))
+	}
+}
+
+func writeStringsItem(w *bufio.Writer, code uint8, list []string) {
+	if len(list) == 0 {
+		return
+	}
+	w.WriteByte(code)
+	writeUvarint(w, len(list))
+	for _, s := range list {
+		writeBytes(w, []byte(s))
+	}
+}
+
+func writeUint16sItem(w *bufio.Writer, code uint8, list []uint16) {
+	if len(list) == 0 {
+		return
+	}
+	w.WriteByte(code)
+	writeUvarint(w, len(list))
+	for _, v := range list {
+		w.Write(binary.BigEndian.AppendUint16(nil, v))
+	}
+}
+
+// writeIPSetItem пишет диапазоны отсортированными и слитыми: sing-box
+// загружает их в IPSet без нормализации и ищет адрес двоичным поиском.
+func writeIPSetItem(w *bufio.Writer, code uint8, ranges []IPRange) {
+	if len(ranges) == 0 {
+		return
+	}
+	ranges = MergeRanges(ranges)
+	w.WriteByte(code)
+	w.WriteByte(1)
+	w.Write(binary.BigEndian.AppendUint64(nil, uint64(len(ranges))))
+	for _, r := range ranges {
+		writeBytes(w, r.From.AsSlice())
+		writeBytes(w, r.To.AsSlice())
+	}
+}
+
+// PrefixRange — диапазон адресов подсети.
+func PrefixRange(p netip.Prefix) IPRange {
+	p = p.Masked()
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - uint(i%8))
+	}
+	to, _ := netip.AddrFromSlice(b)
+	return IPRange{From: p.Addr(), To: to}
+}
+
+// MergeRanges сортирует диапазоны (IPv4 раньше IPv6) и сливает пересекающиеся
+// и соседние. Исходный срез не меняется.
+func MergeRanges(ranges []IPRange) []IPRange {
+	sorted := make([]IPRange, 0, len(ranges))
+	for _, r := range ranges {
+		r.From, r.To = r.From.Unmap(), r.To.Unmap()
+		if r.From.IsValid() && r.To.IsValid() && r.From.Is4() == r.To.Is4() && !r.To.Less(r.From) {
+			sorted = append(sorted, r)
+		}
+	}
+	slices.SortFunc(sorted, func(a, b IPRange) int { return a.From.Compare(b.From) })
+	out := sorted[:0]
+	for _, r := range sorted {
+		if n := len(out); n > 0 {
+			last := &out[n-1]
+			next := last.To.Next()
+			if last.From.Is4() == r.From.Is4() && (!next.IsValid() || !next.Less(r.From)) {
+				if last.To.Less(r.To) {
+					last.To = r.To
+				}
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// Prefixes раскладывает диапазон на минимальный набор подсетей.
+func (r IPRange) Prefixes() []netip.Prefix {
+	var out []netip.Prefix
+	from := r.From
+	for from.IsValid() && !r.To.Less(from) {
+		// Самая крупная подсеть, которая начинается с from и не выходит за To.
+		bits := from.BitLen()
+		for bits > 0 {
+			p := netip.PrefixFrom(from, bits-1)
+			if p.Masked().Addr() != from || r.To.Less(PrefixRange(p).To) {
+				break
+			}
+			bits--
+		}
+		p := netip.PrefixFrom(from, bits)
+		out = append(out, p)
+		last := PrefixRange(p).To
+		if last == r.To {
+			break
+		}
+		from = last.Next()
+	}
+	return out
+}
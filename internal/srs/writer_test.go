@@ -0,0 +1,124 @@
+package srs
+
+import (
+	"bytes"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteRoundTrip(t *testing.T) {
+	in := &RuleSet{Rules: []Rule{
+		{
+			Domain:        NewDomainSet([]string{"exact.example.org"}, []string{"youtube.com", ".only-sub.net"}),
+			DomainKeyword: []string{"ytimg"},
+			DomainRegex:   []string{`^ads?\d+\.`},
+		},
+		{IPCIDR: []IPRange{
+			PrefixRange(netip.MustParsePrefix("2001:b28:f23d::/48")),
+			PrefixRange(netip.MustParsePrefix("91.108.4.0/23")),
+			PrefixRange(netip.MustParsePrefix("91.108.6.0/23")),
+		}},
+		{Type: RuleLogical, Mode: ModeAnd, Rules: []Rule{
+			{ProcessName: []string{"steam.exe"}},
+			{Network: []string{"udp"}, Port: []uint16{27015}, Invert: true},
+		}},
+	}}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	out, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if out.Version != DefaultVersion || len(out.Rules) != 3 {
+		t.Fatalf("rule-set = %+v", out)
+	}
+	domains, suffixes := out.Rules[0].Domain.Domains()
+	if !slices.Equal(domains, []string{"exact.example.org"}) || !slices.Equal(suffixes, []string{".only-sub.net", "youtube.com"}) {
+		t.Errorf("Domains() = %v, %v", domains, suffixes)
+	}
+	if !slices.Equal(out.Rules[0].DomainRegex, in.Rules[0].DomainRegex) {
+		t.Errorf("domain_regex = %v", out.Rules[0].DomainRegex)
+	}
+	// Соседние /23 слились, IPv4 записан раньше IPv6.
+	ips := out.Rules[1].IPCIDR
+	if len(ips) != 2 || !slices.Equal(ips[0].Prefixes(), []netip.Prefix{netip.MustParsePrefix("91.108.4.0/22")}) || ips[1].From.Is4() {
+		t.Errorf("ip_cidr = %+v", ips)
+	}
+
+	cases := map[string]Metadata{
+		"suffix":  {Domain: "m.youtube.com"},
+		"keyword": {Domain: "i.ytimg.com"},
+		"regex":   {Domain: "ad7.example.com"},
+		"ip":      {IP: netip.MustParseAddr("91.108.7.1")},
+		"logical": {ProcessPath: `C:\Steam\steam.exe`, Network: "tcp", Port: 443},
+	}
+	for name, m := range cases {
+		if !out.Match(m) {
+			t.Errorf("%s: no match for %+v", name, m)
+		}
+	}
+	if out.Match(Metadata{Domain: "only-sub.net"}) {
+		t.Error(".only-sub.net must not match the domain itself")
+	}
+}
+
+func TestWriteRejectsSuffixInVersion1(t *testing.T) {
+	rs := &RuleSet{Version: 1, Rules: []Rule{{Domain: NewDomainSet(nil, []string{"example.com"})}}}
+	if _, err := Marshal(rs); err == nil {
+		t.Fatal("version 1 cannot encode domain_suffix without a leading dot")
+	}
+}
+
+func TestIPRangePrefixes(t *testing.T) {
+	r := IPRange{From: netip.MustParseAddr("10.0.0.1"), To: netip.MustParseAddr("10.0.0.8")}
+	var got []string
+	for _, p := range r.Prefixes() {
+		got = append(got, p.String())
+	}
+	want := []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/32"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Prefixes() = %v, want %v", got, want)
+	}
+	all := PrefixRange(netip.MustParsePrefix("::/0"))
+	if p := all.Prefixes(); len(p) != 1 || p[0].Bits() != 0 {
+		t.Errorf("::/0 = %v", p)
+	}
+}
+
+func TestParseTextList(t *testing.T) {
+	rule, err := ParseTextList(strings.NewReader("\ufeff# corp\n" +
+		"Example.com\n" +
+		"domain:corp.example @cn\n" +
+		"+.clash.example\n" +
+		".sub-only.example\n" +
+		"full:exact.example\n" +
+		"keyword:tracker\n" +
+		"regexp:^ads?\\d+\\.\n" +
+		"10.0.0.0/8\n" +
+		"2001:db8::1\n" +
+		"\n// trailing comment\n"))
+	if err != nil {
+		t.Fatalf("ParseTextList: %v", err)
+	}
+	domains, suffixes := rule.Domain.Domains()
+	if !slices.Equal(domains, []string{"exact.example"}) ||
+		!slices.Equal(suffixes, []string{".sub-only.example", "clash.example", "corp.example", "example.com"}) {
+		t.Errorf("domains = %v, suffixes = %v", domains, suffixes)
+	}
+	if len(rule.DomainKeyword) != 1 || len(rule.DomainRegex) != 1 || len(rule.IPCIDR) != 2 {
+		t.Errorf("rule = %+v", rule)
+	}
+	if !rule.Match(Metadata{IP: netip.MustParseAddr("2001:db8::1")}) {
+		t.Error("single IPv6 address must match")
+	}
+
+	for _, bad := range []string{"", "# only comments\n", "include:google\n", "regexp:(\n", "https://example.com/path\n"} {
+		if _, err := ParseTextList(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseTextList(%q): expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package subscription
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"proxyclient/internal/config"
+)
+
+// Clash/Mihomo YAML: прокси из proxies: переводятся в те же URI, что принимает
+// config.ParseServerContent, поэтому дальше подписка обрабатывается как обычная.
+// proxy-groups и rules сохраняются в RoutingDraft — из него API может собрать
+// черновик профиля маршрутизации.
+
+// Цели правил Clash, которые не являются прокси или группой.
+const (
+	ClashTargetDirect = "DIRECT"
+	ClashTargetReject = "REJECT"
+)
+
+// RoutingDraft — proxy-groups и rules из Clash-подписки. Ссылки на прокси и
+// группы остаются именами Clash: ID серверов известны только после импорта.
+type RoutingDraft struct {
+	Groups []DraftGroup `json:"groups,omitempty"`
+	Rules  []DraftRule  `json:"rules,omitempty"`
+	// Final — цель правила MATCH (трафик по умолчанию).
+	Final string `json:"final,omitempty"`
+}
+
+// DraftGroup — группа прокси Clash, сведённая к типу группы sing-box.
+type DraftGroup struct {
+	Name    string           `json:"name"`
+	Type    config.GroupType `json:"type"`
+	Proxies []string         `json:"proxies"`
+}
+
+// DraftRule — правило Clash. Target — DIRECT, REJECT, имя прокси или группы.
+type DraftRule struct {
+	Type   config.RuleType `json:"type"`
+	Value  string          `json:"value"`
+	Target string          `json:"target"`
+}
+
+type clashDocument struct {
+	Proxies     []map[string]any `yaml:"proxies"`
+	ProxyGroups []clashGroup     `yaml:"proxy-groups"`
+	Rules       []string         `yaml:"rules"`
+}
+
+type clashGroup struct {
+	Name    string   `yaml:"name"`
+	Type    string   `yaml:"type"`
+	Proxies []string `yaml:"proxies"`
+	Use     []string `yaml:"use"`
+}
+
+// clashWarnings собирает предупреждения без повторов: в подписке на сотню
+// серверов одно и то же неподдерживаемое поле встречается у каждого.
+type clashWarnings struct {
+	seen map[string]bool
+	list []string
+}
+
+func (w *clashWarnings) add(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if w.seen == nil {
+		w.seen = map[string]bool{}
+	}
+	if !w.seen[msg] {
+		w.seen[msg] = true
+		w.list = append(w.list, msg)
+	}
+}
+
+// Поля, которые есть у любого прокси Clash и не влияют на URI.
+var clashCommonFields = map[string]bool{
+	"name": true, "type": true, "server": true, "port": true, "udp": true,
+}
+
+// Поля, которые переносятся в URI, по типам прокси.
+var clashKnownFields = map[string]map[string]bool{
+	"ss": fieldSet("cipher", "password", "plugin", "plugin-opts"),
+	"vmess": fieldSet("uuid", "alterId", "cipher", "tls", "servername", "network",
+		"ws-opts", "grpc-opts", "h2-opts", "http-opts", "alpn", "client-fingerprint"),
+	"vless": fieldSet("uuid", "flow", "tls", "servername", "network", "reality-opts",
+		"ws-opts", "grpc-opts", "h2-opts", "http-opts", "alpn", "client-fingerprint", "skip-cert-verify"),
+	"trojan": fieldSet("password", "sni", "network", "ws-opts", "grpc-opts", "alpn",
+		"client-fingerprint", "skip-cert-verify"),
+	"hysteria2": fieldSet("password", "sni", "obfs", "obfs-password", "up", "down", "skip-cert-verify"),
+	"tuic": fieldSet("uuid", "password", "sni", "alpn", "congestion-controller",
+		"udp-relay-mode", "skip-cert-verify"),
+}
+
+func fieldSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// parseClash разбирает Clash/Mihomo YAML. ok=false — тело не похоже на
+// Clash-конфиг (нет proxies:).
+func parseClash(content string, isSupported func(string) bool) (ParseResult, bool) {
+	var doc clashDocument
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil || len(doc.Proxies) == 0 {
+		return ParseResult{}, false
+	}
+	var result ParseResult
+	var warn clashWarnings
+	names := map[string]bool{}
+	for i, p := range doc.Proxies {
+		name := firstNonEmpty(clashString(p, "name"), fmt.Sprintf("proxy-%d", i+1))
+		typ := strings.ToLower(clashString(p, "type"))
+		uri, err := clashProxyURI(p, typ, name, &warn)
+		if err != nil {
+			warn.add("clash proxy %q skipped: %v", name, err)
+			continue
+		}
+		if !isSupported(uri) {
+			warn.add("clash proxy %q skipped: unsupported server", name)
+			continue
+		}
+		names[name] = true
+		result.Servers = append(result.Servers, ServerEntry{Name: name, URI: uri})
+	}
+	if len(doc.ProxyGroups) > 0 || len(doc.Rules) > 0 {
+		result.Routing = parseClashRouting(doc, names, &warn)
+	}
+	result.Warnings = warn.list
+	return result, true
+}
+
+func clashProxyURI(p map[string]any, typ, name string, warn *clashWarnings) (string, error) {
+	known, ok := clashKnownFields[typ]
+	if !ok {
+		return "", fmt.Errorf("type %q is not supported", typ)
+	}
+	var unknown []string
+	for key := range p {
+		if !clashCommonFields[key] && !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		warn.add("clash %s: field %q ignored", typ, key)
+	}
+
+	server := clashString(p, "server")
+	port := formatPort(clashScalar(p["port"]))
+	if server == "" || port == "" {
+		return "", fmt.Errorf("server and port are required")
+	}
+	host := server
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	hostPort := host + ":" + port
+
+	switch typ {
+	case "ss":
+		return clashShadowsocksURI(p, hostPort, name)
+	case "vmess":
+		return clashVMessURI(p, server, port, name)
+	case "vless":
+		return clashVLESSURI(p, hostPort, name)
+	case "trojan":
+		return clashTrojanURI(p, hostPort, name)
+	case "hysteria2":
+		return clashHysteria2URI(p, hostPort, name)
+	case "tuic":
+		return clashTUICURI(p, hostPort, name)
+	}
+	return "", fmt.Errorf("type %q is not supported", typ)
+}
+
+func clashShadowsocksURI(p map[string]any, hostPort, name string) (string, error) {
+	cipher, password := clashString(p, "cipher"), clashString(p, "password")
+	if cipher == "" || password == "" {
+		return "", fmt.Errorf("cipher and password are required")
+	}
+	q := url.Values{}
+	if plugin := clashString(p, "plugin"); plugin != "" {
+		opts := clashMap(p, "plugin-opts")
+		switch plugin {
+		case "obfs":
+			q.Set("plugin", "obfs-local")
+			q.Set("plugin-opts", joinPluginOpts("obfs", clashString(opts, "mode"), "obfs-host", clashString(opts, "host")))
+		case "v2ray-plugin":
+			q.Set("plugin", "v2ray-plugin")
+			pluginOpts := joinPluginOpts("mode", clashString(opts, "mode"), "host", clashString(opts, "host"), "path", clashString(opts, "path"))
+			if clashBool(opts, "tls") {
+				pluginOpts = strings.TrimPrefix(pluginOpts+";tls", ";")
+			}
+			q.Set("plugin-opts", pluginOpts)
+		default:
+			return "", fmt.Errorf("shadowsocks plugin %q is not supported", plugin)
+		}
+	}
+	uri := "ss://" + base64.RawURLEncoding.EncodeToString([]byte(cipher+":"+password)) + "@" + hostPort
+	return withQueryAndName(uri, q, name), nil
+}
+
+func clashVMessURI(p map[string]any, server, port, name string) (string, error) {
+	uuid := clashString(p, "uuid")
+	if uuid == "" {
+		return "", fmt.Errorf("uuid is required")
+	}
+	network := firstNonEmpty(clashString(p, "network"), "tcp")
+	v := map[string]string{
+		"v":    "2",
+		"ps":   name,
+		"add":  server,
+		"port": port,
+		"id":   uuid,
+		"aid":  firstNonEmpty(formatInt(clashScalar(p["alterId"])), "0"),
+		"scy":  firstNonEmpty(clashString(p, "cipher"), "auto"),
+		"net":  network,
+		"sni":  clashString(p, "servername"),
+		"alpn": strings.Join(clashStrings(p, "alpn"), ","),
+		"fp":   clashString(p, "client-fingerprint"),
+	}
+	if clashBool(p, "tls") {
+		v["tls"] = "tls"
+	}
+	path, hosts, service := clashTransport(p, network)
+	v["path"] = firstNonEmpty(path, service)
+	v["host"] = strings.Join(hosts, ",")
+	if network == "http" {
+		// В vmess-ссылках net=tcp + type=http означает HTTP-маскировку TCP.
+		v["net"], v["type"] = "tcp", "http"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func clashVLESSURI(p map[string]any, hostPort, name string) (string, error) {
+	uuid := clashString(p, "uuid")
+	if uuid == "" {
+		return "", fmt.Errorf("uuid is required")
+	}
+	q := url.Values{}
+	q.Set("encryption", "none")
+	reality := clashMap(p, "reality-opts")
+	switch {
+	case clashString(reality, "public-key") != "":
+		q.Set("security", "reality")
+		q.Set("pbk", clashString(reality, "public-key"))
+		setIfNotEmpty(q, "sid", clashString(reality, "short-id"))
+	case clashBool(p, "tls"):
+		q.Set("security", "tls")
+	default:
+		q.Set("security", "none")
+	}
+	setIfNotEmpty(q, "sni", clashString(p, "servername"))
+	setIfNotEmpty(q, "fp", clashString(p, "client-fingerprint"))
+	setIfNotEmpty(q, "flow", clashString(p, "flow"))
+	setIfNotEmpty(q, "alpn", strings.Join(clashStrings(p, "alpn"), ","))
+	if clashBool(p, "skip-cert-verify") {
+		q.Set("allowInsecure", "1")
+	}
+	setTransportQuery(q, p)
+	return withQueryAndName("vless://"+url.PathEscape(uuid)+"@"+hostPort, q, name), nil
+}
+
+func clashTrojanURI(p map[string]any, hostPort, name string) (string, error) {
+	password := clashString(p, "password")
+	if password == "" {
+		return "", fmt.Errorf("password is required")
+	}
+	q := url.Values{}
+	setIfNotEmpty(q, "sni", clashString(p, "sni"))
+	setIfNotEmpty(q, "fp", clashString(p, "client-fingerprint"))
+	setIfNotEmpty(q, "alpn", strings.Join(clashStrings(p, "alpn"), ","))
+	if clashBool(p, "skip-cert-verify") {
+		q.Set("allowInsecure", "1")
+	}
+	setTransportQuery(q, p)
+	return withQueryAndName("trojan://"+url.PathEscape(password)+"@"+hostPort, q, name), nil
+}
+
+func clashHysteria2URI(p map[string]any, hostPort, name string) (string, error) {
+	password := clashString(p, "password")
+	if password == "" {
+		return "", fmt.Errorf("password is required")
+	}
+	q := url.Values{}
+	setIfNotEmpty(q, "sni", clashString(p, "sni"))
+	if obfs := clashString(p, "obfs"); obfs != "" {
+		q.Set("obfs", obfs)
+		setIfNotEmpty(q, "obfs-password", clashString(p, "obfs-password"))
+	}
+	setIfNotEmpty(q, "up", clashMbps(clashScalar(p["up"])))
+	setIfNotEmpty(q, "down", clashMbps(clashScalar(p["down"])))
+	if clashBool(p, "skip-cert-verify") {
+		q.Set("insecure", "1")
+	}
+	return withQueryAndName("hysteria2://"+url.PathEscape(password)+"@"+hostPort, q, name), nil
+}
+
+func clashTUICURI(p map[string]any, hostPort, name string) (string, error) {
+	uuid, password := clashString(p, "uuid"), clashString(p, "password")
+	if uuid == "" || password == "" {
+		return "", fmt.Errorf("uuid and password are required (tuic v4 token is not supported)")
+	}
+	q := url.Values{}
+	setIfNotEmpty(q, "sni", clashString(p, "sni"))
+	setIfNotEmpty(q, "alpn", strings.Join(clashStrings(p, "alpn"), ","))
+	setIfNotEmpty(q, "congestion_control", clashString(p, "congestion-controller"))
+	setIfNotEmpty(q, "udp_relay_mode", clashString(p, "udp-relay-mode"))
+	if clashBool(p, "skip-cert-verify") {
+		q.Set("insecure", "1")
+	}
+	userInfo := url.UserPassword(uuid, password).String()
+	return withQueryAndName("tuic://"+userInfo+"@"+hostPort, q, name), nil
+}
+
+// clashTransport достаёт path, host и gRPC service name из *-opts прокси.
+func clashTransport(p map[string]any, network string) (path string, hosts []string, service string) {
+	switch network {
+	case "ws":
+		opts := clashMap(p, "ws-opts")
+		path = clashString(opts, "path")
+		if host := clashString(clashMap(opts, "headers"), "Host"); host != "" {
+			hosts = []string{host}
+		}
+	case "grpc":
+		service = clashString(clashMap(p, "grpc-opts"), "grpc-service-name")
+	case "h2":
+		opts := clashMap(p, "h2-opts")
+		path = clashString(opts, "path")
+		hosts = clashStrings(opts, "host")
+	case "http":
+		opts := clashMap(p, "http-opts")
+		if paths := clashStrings(opts, "path"); len(paths) > 0 {
+			path = paths[0]
+		}
+		hosts = clashStrings(clashMap(opts, "headers"), "Host")
+	}
+	return path, hosts, service
+}
+
+func setTransportQuery(q url.Values, p map[string]any) {
+	network := clashString(p, "network")
+	if network == "" || network == "tcp" {
+		return
+	}
+	path, hosts, service := clashTransport(p, network)
+	switch network {
+	case "h2":
+		q.Set("type", "http")
+	case "http":
+		q.Set("type", "tcp")
+		q.Set("headerType", "http")
+	default:
+		q.Set("type", network)
+	}
+	setIfNotEmpty(q, "path", path)
+	setIfNotEmpty(q, "host", strings.Join(hosts, ","))
+	setIfNotEmpty(q, "serviceName", service)
+}
+
+func parseClashRouting(doc clashDocument, proxies map[string]bool, warn *clashWarnings) *RoutingDraft {
+	draft := &RoutingDraft{}
+	groups := map[string]bool{}
+	for _, g := range doc.ProxyGroups {
+		if g.Name != "" {
+			groups[g.Name] = true
+		}
+	}
+	for _, g := range doc.ProxyGroups {
+		if g.Name == "" {
+			continue
+		}
+		var typ config.GroupType
+		switch strings.ToLower(g.Type) {
+		case "select":
+			typ = config.GroupTypeSelector
+		case "url-test":
+			typ = config.GroupTypeURLTest
+		case "fallback", "load-balance":
+			typ = config.GroupTypeURLTest
+			warn.add("clash group %q: %s imported as urltest", g.Name, g.Type)
+		default:
+			warn.add("clash group %q skipped: type %q is not supported", g.Name, g.Type)
+			continue
+		}
+		if len(g.Use) > 0 {
+			warn.add("clash group %q: proxy-providers are not supported", g.Name)
+		}
+		out := DraftGroup{Name: g.Name, Type: typ, Proxies: []string{}}
+		for _, member := range g.Proxies {
+			switch {
+			case proxies[member]:
+				out.Proxies = append(out.Proxies, member)
+			case groups[member]:
+				warn.add("clash group %q: nested group %q is not supported", g.Name, member)
+			case strings.EqualFold(member, ClashTargetDirect), strings.EqualFold(member, ClashTargetReject):
+				// DIRECT/REJECT внутри группы — выбор «без прокси», в группу серверов не переносится.
+			default:
+				warn.add("clash group %q: unknown proxy %q", g.Name, member)
+			}
+		}
+		if len(out.Proxies) == 0 {
+			warn.add("clash group %q skipped: no imported proxies", g.Name)
+			continue
+		}
+		draft.Groups = append(draft.Groups, out)
+	}
+
+	for _, raw := range doc.Rules {
+		parts := strings.Split(raw, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		kind := strings.ToUpper(parts[0])
+		if (kind == "MATCH" || kind == "FINAL") && len(parts) >= 2 {
+			draft.Final = clashRuleTarget(parts[1])
+			continue
+		}
+		if len(parts) < 3 || parts[1] == "" {
+			warn.add("clash rule %q skipped: malformed", raw)
+			continue
+		}
+		var rule DraftRule
+		switch kind {
+		case "DOMAIN", "DOMAIN-SUFFIX":
+			// Правило domain покрывает и сам домен, и поддомены — для DOMAIN это шире,
+			// чем в Clash, но отдельного точного совпадения у нас нет.
+			rule = DraftRule{Type: config.RuleTypeDomain, Value: strings.ToLower(parts[1])}
+		case "IP-CIDR", "IP-CIDR6":
+			rule = DraftRule{Type: config.RuleTypeIP, Value: parts[1]}
+		case "GEOSITE":
+			rule = DraftRule{Type: config.RuleTypeGeosite, Value: "geosite:" + strings.ToLower(parts[1])}
+		case "PROCESS-NAME":
+			rule = DraftRule{Type: config.RuleTypeProcess, Value: parts[1]}
+		default:
+			warn.add("clash rule type %s is not supported", kind)
+			continue
+		}
+		rule.Target = clashRuleTarget(parts[2])
+		if !isClashSpecialTarget(rule.Target) && !proxies[rule.Target] && !groups[rule.Target] {
+			warn.add("clash rule %q skipped: unknown target %q", raw, parts[2])
+			continue
+		}
+		draft.Rules = append(draft.Rules, rule)
+	}
+	return draft
+}
+
+// clashRuleTarget приводит REJECT-DROP и регистр DIRECT/REJECT к единому виду.
+func clashRuleTarget(target string) string {
+	switch strings.ToUpper(target) {
+	case ClashTargetDirect:
+		return ClashTargetDirect
+	case ClashTargetReject, "REJECT-DROP":
+		return ClashTargetReject
+	}
+	return target
+}
+
+func isClashSpecialTarget(target string) bool {
+	return target == ClashTargetDirect || target == ClashTargetReject
+}
+
+func withQueryAndName(uri string, q url.Values, name string) string {
+	if len(q) > 0 {
+		uri += "?" + q.Encode()
+	}
+	if name != "" {
+		uri += "#" + url.PathEscape(name)
+	}
+	return uri
+}
+
+func setIfNotEmpty(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
+
+func joinPluginOpts(kv ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			parts = append(parts, kv[i]+"="+kv[i+1])
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// clashScalar приводит числа из YAML (int) к виду, который понимает formatPort.
+func clashScalar(v any) any {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	}
+	return v
+}
+
+func formatInt(v any) string {
+	switch n := v.(type) {
+	case float64:
+		return strconv.Itoa(int(n))
+	case string:
+		return strings.TrimSpace(n)
+	}
+	return ""
+}
+
+// clashMbps разбирает up/down: число или строку вида "100 Mbps".
+func clashMbps(v any) string {
+	s := strings.ToLower(strings.TrimSpace(formatInt(v)))
+	s = strings.TrimSpace(strings.TrimSuffix(s, "mbps"))
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return strconv.Itoa(n)
+	}
+	return ""
+}
+
+func clashString(m map[string]any, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+func clashBool(m map[string]any, key string) bool {
+	switch v := m[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true" || v == "1"
+	}
+	return false
+}
+
+func clashMap(m map[string]any, key string) map[string]any {
+	if v, ok := m[key].(map[string]any); ok {
+		return v
+	}
+	return map[string]any{}
+}
+
+// clashStrings читает список строк; одиночная строка считается списком из одного элемента.
+func clashStrings(m map[string]any, key string) []string {
+	switch v := m[key].(type) {
+	case string:
+		if s := strings.TrimSpace(v); s != "" {
+			return []string{s}
+		}
+	case []any:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+				out = append(out, strings.TrimSpace(s))
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package subscription
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FetchRoute — откуда скачивать подписку. Домены некоторых провайдеров
+// заблокированы, и без туннеля подписку не обновить.
+type FetchRoute string
+
+const (
+	// FetchDirect — напрямую, в обход системного прокси. Пустое значение — то же.
+	FetchDirect FetchRoute = "direct"
+	// FetchTunnel — через текущий туннель (HTTP inbound sing-box).
+	FetchTunnel FetchRoute = "tunnel"
+	// FetchDirectThenTunnel — сначала напрямую, при неудаче через туннель.
+	FetchDirectThenTunnel FetchRoute = "direct_then_tunnel"
+)
+
+const (
+	maxMirrors = 8
+	// maxFetchAttempts — сколько последних попыток хранить в метаданных.
+	maxFetchAttempts = 20
+)
+
+// FetchAttempt — результат одной попытки загрузки.
+type FetchAttempt struct {
+	At time.Time `json:"at"`
+	// Source — "url" для основного адреса, "mirror:N" для зеркала (с 1).
+	// Сами адреса не пишутся: в них обычно токен доступа.
+	Source      string     `json:"source"`
+	Route       FetchRoute `json:"route"`
+	Status      int        `json:"status,omitempty"`
+	NotModified bool       `json:"not_modified,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	DurationMs  int64      `json:"duration_ms"`
+}
+
+// fetchCache — валидаторы последнего полного ответа для условного запроса.
+// URLHash привязывает их к адресу, с которого пришёл ответ.
+type fetchCache struct {
+	URLHash      string `json:"url_hash,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+type fetchOutcome struct {
+	result   UpdateResult
+	cache    fetchCache
+	attempts []FetchAttempt
+}
+
+var errTunnelUnavailable = errors.New("tunnel fetch is not available")
+
+// NormalizeFetchRoute возвращает маршрут по умолчанию для пустого значения.
+func NormalizeFetchRoute(r FetchRoute) FetchRoute {
+	if r == "" {
+		return FetchDirect
+	}
+	return r
+}
+
+// ValidateFetchOptions проверяет зеркала и маршрут загрузки.
+func ValidateFetchOptions(mirrors []string, route FetchRoute) error {
+	switch NormalizeFetchRoute(route) {
+	case FetchDirect, FetchTunnel, FetchDirectThenTunnel:
+	default:
+		return fmt.Errorf("unknown fetch route %q", route)
+	}
+	if len(mirrors) > maxMirrors {
+		return fmt.Errorf("too many mirrors (max %d)", maxMirrors)
+	}
+	for i, mirror := range mirrors {
+		if err := validateHTTPSURL(strings.TrimSpace(mirror)); err != nil {
+			return fmt.Errorf("mirrors[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (r FetchRoute) steps() []FetchRoute {
+	switch NormalizeFetchRoute(r) {
+	case FetchTunnel:
+		return []FetchRoute{FetchTunnel}
+	case FetchDirectThenTunnel:
+		return []FetchRoute{FetchDirect, FetchTunnel}
+	}
+	return []FetchRoute{FetchDirect}
+}
+
+func urlHash(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:8])
+}
+
+// fetch пробует основной URL и зеркала по порядку, для каждого маршрута из
+// FetchRoute. Первый ответ 200 или 304 завершает перебор. Условный запрос
+// отправляется только на адрес, с которого пришёл прошлый ответ, и только
+// если серверы подписки сохранены — иначе 304 нечем применить.
+func (m *Manager) fetch(ctx context.Context, sub Subscription) (fetchOutcome, error) {
+	var out fetchOutcome
+	urls := append([]string{sub.URL}, sub.Mirrors...)
+	var lastErr error
+	for _, route := range sub.FetchRoute.steps() {
+		for i, raw := range urls {
+			source := "url"
+			if i > 0 {
+				source = fmt.Sprintf("mirror:%d", i)
+			}
+			attempt := FetchAttempt{At: m.now().UTC(), Source: source, Route: route}
+			start := time.Now()
+			result, cache, status, err := m.fetchOnce(ctx, sub, raw, route)
+			attempt.DurationMs = time.Since(start).Milliseconds()
+			attempt.Status = status
+			attempt.NotModified = result.NotModified
+			if err != nil {
+				attempt.Error = err.Error()
+			}
+			out.attempts = append(out.attempts, attempt)
+			if err == nil {
+				out.result, out.cache = result, cache
+				return out, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil {
+				return out, lastErr
+			}
+		}
+	}
+	return out, lastErr
+}
+
+func (m *Manager) fetchOnce(ctx context.Context, sub Subscription, raw string, route FetchRoute) (UpdateResult, fetchCache, int, error) {
+	client := m.client
+	if route == FetchTunnel {
+		if m.tunnelClient == nil {
+			return UpdateResult{}, fetchCache{}, 0, errTunnelUnavailable
+		}
+		client = m.tunnelClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, raw, nil)
+	if err != nil {
+		return UpdateResult{}, fetchCache{}, 0, fmt.Errorf("create subscription request: %w", err)
+	}
+	if sub.UserAgent != "" {
+		req.Header.Set("User-Agent", sub.UserAgent)
+	}
+	hash := urlHash(raw)
+	if sub.cache.URLHash == hash && len(sub.Servers) > 0 {
+		if sub.cache.ETag != "" {
+			req.Header.Set("If-None-Match", sub.cache.ETag)
+		}
+		if sub.cache.LastModified != "" {
+			req.Header.Set("If-Modified-Since", sub.cache.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return UpdateResult{}, fetchCache{}, 0, fmt.Errorf("download subscription: %w", err)
+	}
+	defer resp.Body.Close()
+	var quota Quota
+	if header := resp.Header.Get("subscription-userinfo"); header != "" {
+		quota = ParseUserInfoHeader(header)
+	}
+	cache := fetchCache{URLHash: hash, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if cache.ETag == "" && cache.LastModified == "" {
+			cache.ETag, cache.LastModified = sub.cache.ETag, sub.cache.LastModified
+		}
+		return UpdateResult{NotModified: true, Quota: quota}, cache, resp.StatusCode, nil
+	default:
+		return UpdateResult{}, fetchCache{}, resp.StatusCode, fmt.Errorf("subscription HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodyBytes+1))
+	if err != nil {
+		return UpdateResult{}, fetchCache{}, resp.StatusCode, fmt.Errorf("read subscription: %w", err)
+	}
+	if len(body) > MaxBodyBytes {
+		return UpdateResult{}, fetchCache{}, resp.StatusCode, fmt.Errorf("subscription response exceeds 1 MiB")
+	}
+	parsed := ParseBody(body, m.isSupported)
+	return UpdateResult{
+		Servers:  parsed.Servers,
+		Quota:    quota,
+		Warnings: parsed.Warnings,
+		Routing:  parsed.Routing,
+	}, cache, resp.StatusCode, nil
+}
+
+func appendAttempts(history, attempts []FetchAttempt) []FetchAttempt {
+	history = append(history, attempts...)
+	if len(history) > maxFetchAttempts {
+		history = append([]FetchAttempt(nil), history[len(history)-maxFetchAttempts:]...)
+	}
+	return history
+}
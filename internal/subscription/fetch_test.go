@@ -0,0 +1,157 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("blocked")
+}
+
+func TestManagerUpdateNowConditionalFetch(t *testing.T) {
+	clock := newAtomicClock(time.Unix(1000, 0))
+	var conditional atomic.Int32
+	m, _ := testManager(t, "", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.Header().Set("subscription-userinfo", "download=5; total=10")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("vless://id@example.com:443?encryption=none#A"))
+	}, clock)
+
+	applied := 0
+	m.applyServers = func(context.Context, Subscription, UpdateResult) error {
+		applied++
+		return nil
+	}
+	if _, err := m.UpdateNow(context.Background(), "sub1"); err != nil {
+		t.Fatalf("UpdateNow: %v", err)
+	}
+	clock.Add(time.Hour)
+	got, err := m.UpdateNow(context.Background(), "sub1")
+	if err != nil {
+		t.Fatalf("UpdateNow (304): %v", err)
+	}
+	if !got.NotModified || len(got.Servers) != 1 || got.Quota.Total != 10 || applied != 1 {
+		t.Fatalf("304 result = %+v, applied %d times", got, applied)
+	}
+	sub := m.List()[0]
+	if len(sub.Servers) != 1 || !sub.LastUpdated.Equal(clock.Now()) || sub.Quota.Download != 5 {
+		t.Fatalf("subscription after 304 = %+v", sub)
+	}
+	if n := len(sub.Attempts); n != 2 || !sub.Attempts[1].NotModified || sub.Attempts[1].Status != http.StatusNotModified {
+		t.Fatalf("attempts = %+v", sub.Attempts)
+	}
+
+	// New filters need the full body again.
+	if err := m.SetFilters("sub1", Filters{MaxServers: 5}); err != nil {
+		t.Fatalf("SetFilters: %v", err)
+	}
+	if got, err := m.UpdateNow(context.Background(), "sub1"); err != nil || got.NotModified {
+		t.Fatalf("UpdateNow after SetFilters = %+v, %v", got, err)
+	}
+	if n := conditional.Load(); n != 1 {
+		t.Errorf("conditional requests = %d, want 1", n)
+	}
+}
+
+func TestManagerUpdateNowApplyFailureDropsValidators(t *testing.T) {
+	clock := newAtomicClock(time.Unix(1000, 0))
+	var conditional atomic.Int32
+	m, _ := testManager(t, "", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("vless://id@example.com:443?encryption=none#A"))
+	}, clock)
+
+	applyErr := errors.New("servers.json is locked")
+	applied := 0
+	m.applyServers = func(context.Context, Subscription, UpdateResult) error {
+		applied++
+		return applyErr
+	}
+	if _, err := m.UpdateNow(context.Background(), "sub1"); !errors.Is(err, applyErr) {
+		t.Fatalf("UpdateNow = %v, want apply error", err)
+	}
+	sub := m.List()[0]
+	if sub.LastError == "" || sub.Backoff != initialBackoff || !sub.NextAttempt.Equal(clock.Now().Add(initialBackoff)) {
+		t.Fatalf("subscription after failed apply = %+v", sub)
+	}
+
+	// The next fetch is unconditional, so the servers are applied again.
+	applyErr = nil
+	clock.Add(time.Hour)
+	if got, err := m.UpdateNow(context.Background(), "sub1"); err != nil || got.NotModified {
+		t.Fatalf("UpdateNow after failed apply = %+v, %v", got, err)
+	}
+	if applied != 2 || conditional.Load() != 0 || m.List()[0].LastError != "" {
+		t.Errorf("applied %d times, %d conditional requests", applied, conditional.Load())
+	}
+}
+
+func TestManagerUpdateNowMirrorsAndRoutes(t *testing.T) {
+	clock := newAtomicClock(time.Unix(1000, 0))
+	m, _ := testManager(t, "", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}, clock)
+	mirror := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("vless://id@example.com:443?encryption=none#A"))
+	}))
+	t.Cleanup(mirror.Close)
+
+	if err := m.SetFetchOptions("sub1", []string{"http://insecure.example"}, FetchDirect); err == nil {
+		t.Fatal("SetFetchOptions accepted an http mirror")
+	}
+	if err := m.SetFetchOptions("sub1", nil, "proxy"); err == nil {
+		t.Fatal("SetFetchOptions accepted an unknown route")
+	}
+	if err := m.SetFetchOptions("sub1", []string{" " + mirror.URL + " "}, FetchDirect); err != nil {
+		t.Fatalf("SetFetchOptions: %v", err)
+	}
+	if _, err := m.UpdateNow(context.Background(), "sub1"); err != nil {
+		t.Fatalf("UpdateNow: %v", err)
+	}
+	attempts := m.List()[0].Attempts
+	if len(attempts) != 2 || attempts[0].Source != "url" || attempts[0].Status != http.StatusServiceUnavailable ||
+		attempts[1].Source != "mirror:1" || attempts[1].Error != "" || attempts[1].Route != FetchDirect {
+		t.Fatalf("attempts = %+v", attempts)
+	}
+
+	// The provider is blocked directly; the tunnel client reaches it.
+	m.tunnelClient = mirror.Client()
+	m.client = &http.Client{Transport: failingTransport{}}
+	if err := m.SetFetchOptions("sub1", nil, FetchDirectThenTunnel); err != nil {
+		t.Fatalf("SetFetchOptions: %v", err)
+	}
+	m.subs["sub1"].URL = mirror.URL
+	if _, err := m.UpdateNow(context.Background(), "sub1"); err != nil {
+		t.Fatalf("UpdateNow via tunnel: %v", err)
+	}
+	attempts = m.List()[0].Attempts[2:]
+	if len(attempts) != 2 || attempts[0].Route != FetchDirect || attempts[0].Error == "" || attempts[1].Route != FetchTunnel || attempts[1].Error != "" {
+		t.Fatalf("direct_then_tunnel attempts = %+v", attempts)
+	}
+
+	m.tunnelClient = nil
+	if err := m.SetFetchOptions("sub1", nil, FetchTunnel); err != nil {
+		t.Fatalf("SetFetchOptions: %v", err)
+	}
+	if _, err := m.UpdateNow(context.Background(), "sub1"); !errors.Is(err, errTunnelUnavailable) {
+		t.Fatalf("UpdateNow without tunnel = %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package subscription
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filters — обработка списка серверов подписки перед сохранением: отбор,
+// переименование и ограничение количества.
+type Filters struct {
+	Include FilterRules `json:"include,omitempty"`
+	Exclude FilterRules `json:"exclude,omitempty"`
+	Rename  Rename      `json:"rename,omitempty"`
+	// MaxServers — сколько серверов оставить после фильтров. 0 — без ограничения.
+	MaxServers int `json:"max_servers,omitempty"`
+}
+
+// FilterRules — регулярные выражения (без учёта регистра) по имени сервера,
+// протоколу (схема URI: vless, trojan, ss, ...) и стране (ISO-код из флага
+// в имени). Пустое выражение не проверяется.
+type FilterRules struct {
+	Name     string `json:"name,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Country  string `json:"country,omitempty"`
+}
+
+// Rename — как переименовывать серверы. Шаги выполняются по порядку:
+// StripEmoji, Replace, Template.
+type Rename struct {
+	StripEmoji bool         `json:"strip_emoji,omitempty"`
+	Replace    []RenameRule `json:"replace,omitempty"`
+	// Template — итоговое имя. Подстановки: {name}, {sub} (имя подписки),
+	// {country}, {protocol}, {index} (номер среди оставшихся, с 1).
+	Template string `json:"template,omitempty"`
+}
+
+// RenameRule — замена по регулярному выражению; в Replace доступны $1, ${name}.
+type RenameRule struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+// FilteredServer — сервер, не попавший в подписку, и причина.
+type FilteredServer struct {
+	Name string `json:"name"`
+	// Reason — include:<поле>, exclude:<поле>, duplicate, duplicate:manual,
+	// duplicate:subscription или max_servers.
+	Reason string `json:"reason"`
+	// Source — для duplicate:subscription имя подписки, где сервер уже есть.
+	Source string `json:"source,omitempty"`
+}
+
+const (
+	FilterReasonDuplicate             = "duplicate"
+	FilterReasonDuplicateManual       = "duplicate:manual"
+	FilterReasonDuplicateSubscription = "duplicate:subscription"
+	FilterReasonMaxServers            = "max_servers"
+)
+
+const maxRenameRules = 32
+
+type filterField struct {
+	name    string
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+	value   func(candidate) string
+}
+
+// candidate — сервер в обработке; name — имя для фильтров и переименования:
+// у строк без имени это #fragment URI.
+type candidate struct {
+	ServerEntry
+	name string
+}
+
+type compiledFilters struct {
+	fields  []filterField
+	replace []compiledRename
+	f       Filters
+}
+
+type compiledRename struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+// Validate проверяет регулярные выражения и ограничения.
+func (f Filters) Validate() error {
+	_, err := f.compile()
+	return err
+}
+
+func (f Filters) compile() (*compiledFilters, error) {
+	if f.MaxServers < 0 {
+		return nil, fmt.Errorf("max_servers must not be negative")
+	}
+	if len(f.Rename.Replace) > maxRenameRules {
+		return nil, fmt.Errorf("too many rename rules (max %d)", maxRenameRules)
+	}
+	c := &compiledFilters{f: f}
+	fields := []struct {
+		name             string
+		include, exclude string
+		value            func(candidate) string
+	}{
+		{"name", f.Include.Name, f.Exclude.Name, func(c candidate) string { return c.name }},
+		{"protocol", f.Include.Protocol, f.Exclude.Protocol, func(c candidate) string { return serverProtocol(c.ServerEntry) }},
+		{"country", f.Include.Country, f.Exclude.Country, func(c candidate) string { return c.Country }},
+	}
+	for _, fd := range fields {
+		field := filterField{name: fd.name, value: fd.value}
+		var err error
+		if field.include, err = compileFilterRegexp(fd.include); err != nil {
+			return nil, fmt.Errorf("include.%s: %w", fd.name, err)
+		}
+		if field.exclude, err = compileFilterRegexp(fd.exclude); err != nil {
+			return nil, fmt.Errorf("exclude.%s: %w", fd.name, err)
+		}
+		if field.include != nil || field.exclude != nil {
+			c.fields = append(c.fields, field)
+		}
+	}
+	for i, rule := range f.Rename.Replace {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("rename.replace[%d]: empty pattern", i)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rename.replace[%d]: %w", i, err)
+		}
+		c.replace = append(c.replace, compiledRename{re: re, replace: rule.Replace})
+	}
+	return c, nil
+}
+
+func compileFilterRegexp(expr string) (*regexp.Regexp, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + expr)
+}
+
+// reject возвращает причину отсева по include/exclude или "".
+func (c *compiledFilters) reject(s candidate) string {
+	for _, field := range c.fields {
+		value := field.value(s)
+		if field.include != nil && !field.include.MatchString(value) {
+			return "include:" + field.name
+		}
+		if field.exclude != nil && field.exclude.MatchString(value) {
+			return "exclude:" + field.name
+		}
+	}
+	return ""
+}
+
+// rename возвращает новое имя или "", если переименование не настроено.
+func (c *compiledFilters) rename(s candidate, subName string, index int) string {
+	r := c.f.Rename
+	if !r.StripEmoji && len(c.replace) == 0 && r.Template == "" {
+		return ""
+	}
+	name := s.name
+	if r.StripEmoji {
+		name = stripEmoji(name)
+	}
+	for _, r := range c.replace {
+		name = r.re.ReplaceAllString(name, r.replace)
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	if tmpl := c.f.Rename.Template; tmpl != "" {
+		name = strings.NewReplacer(
+			"{name}", name,
+			"{sub}", subName,
+			"{country}", s.Country,
+			"{protocol}", serverProtocol(s.ServerEntry),
+			"{index}", strconv.Itoa(index),
+		).Replace(tmpl)
+		name = strings.Join(strings.Fields(name), " ")
+	}
+	return name
+}
+
+// applyFilters прогоняет свежий список через дедупликацию, фильтры,
+// переименование и ограничение. taken — ключи serverKey, уже занятые ручными
+// серверами (значение "") или другими подписками (имя подписки).
+func applyFilters(servers []ServerEntry, f Filters, subName string, taken map[string]string) ([]ServerEntry, []FilteredServer, error) {
+	c, err := f.compile()
+	if err != nil {
+		return nil, nil, err
+	}
+	var kept []candidate
+	var filtered []FilteredServer
+	seen := map[string]bool{}
+	for _, entry := range servers {
+		s := candidate{ServerEntry: entry, name: entry.Name}
+		if s.name == "" {
+			s.name = uriName(s.URI)
+		}
+		if s.Country == "" {
+			s.Country = countryFromFlag(s.name)
+		}
+		key := serverKey(s.ServerEntry)
+		if seen[key] {
+			filtered = append(filtered, FilteredServer{Name: s.name, Reason: FilterReasonDuplicate})
+			continue
+		}
+		seen[key] = true
+		if reason := c.reject(s); reason != "" {
+			filtered = append(filtered, FilteredServer{Name: s.name, Reason: reason})
+			continue
+		}
+		if owner, ok := taken[key]; ok {
+			if owner == "" {
+				filtered = append(filtered, FilteredServer{Name: s.name, Reason: FilterReasonDuplicateManual})
+			} else {
+				filtered = append(filtered, FilteredServer{Name: s.name, Reason: FilterReasonDuplicateSubscription, Source: owner})
+			}
+			continue
+		}
+		if f.MaxServers > 0 && len(kept) >= f.MaxServers {
+			filtered = append(filtered, FilteredServer{Name: s.name, Reason: FilterReasonMaxServers})
+			continue
+		}
+		kept = append(kept, s)
+	}
+	out := make([]ServerEntry, len(kept))
+	for i, s := range kept {
+		out[i] = s.ServerEntry
+		if name := c.rename(s, subName, i+1); name != "" {
+			out[i].Name = name
+		}
+	}
+	return out, filtered, nil
+}
+
+// uriName — имя из #fragment URI: так его показывают клиенты для строк без
+// отдельного имени.
+func uriName(uri string) string {
+	_, fragment, ok := strings.Cut(uri, "#")
+	if !ok {
+		return ""
+	}
+	if name, err := url.PathUnescape(fragment); err == nil {
+		fragment = name
+	}
+	return strings.TrimSpace(fragment)
+}
+
+func serverProtocol(s ServerEntry) string {
+	scheme, _, ok := strings.Cut(s.URI, "://")
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(scheme)
+}
+
+// countryFromFlag возвращает ISO-код по первому флагу-эмодзи в имени
+// ("🇩🇪 Frankfurt" → "DE") или "".
+func countryFromFlag(name string) string {
+	runes := []rune(name)
+	for i := 0; i+1 < len(runes); i++ {
+		if isRegionalIndicator(runes[i]) && isRegionalIndicator(runes[i+1]) {
+			return string([]rune{'A' + runes[i] - 0x1F1E6, 'A' + runes[i+1] - 0x1F1E6})
+		}
+	}
+	return ""
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// stripEmoji удаляет флаги, пиктограммы и служебные символы эмодзи.
+func stripEmoji(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case isRegionalIndicator(r),
+			r >= 0x1F000 && r <= 0x1FAFF, // пиктограммы, смайлы, транспорт, символы
+			r >= 0x2600 && r <= 0x27BF,   // разные символы и dingbats
+			r >= 0x2B00 && r <= 0x2BFF,
+			r == 0x200D, r == 0x20E3, // ZWJ, keycap
+			r >= 0xFE00 && r <= 0xFE0F,   // variation selectors
+			r >= 0xE0020 && r <= 0xE007F: // tag-символы флагов регионов
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,123 @@
+package subscription
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyFilters(t *testing.T) {
+	servers := []ServerEntry{
+		{Name: "🇩🇪 Frankfurt 01", URI: "vless://id@de1.example:443?encryption=none"},
+		{Name: "🇩🇪 Frankfurt 01 (copy)", URI: "vless://id@DE1.example:443?encryption=none&sni=x"},
+		{URI: "trojan://pass@nl1.example:443#%F0%9F%87%B3%F0%9F%87%B1%20Amsterdam"},
+		{Name: "🇷🇺 Moscow", URI: "vless://id@ru1.example:443?encryption=none"},
+		{Name: "🇺🇸 Info: expires 2026-12-01", URI: "ss://YWVzOnBhc3M@info.example:8388"},
+		{Name: "🇫🇮 Helsinki", URI: "ss://YWVzOnBhc3M@fi1.example:8388"},
+		{Name: "🇸🇪 Stockholm", URI: "vless://id@se1.example:443?encryption=none"},
+		{Name: "🇵🇱 Warsaw", URI: "vless://id@pl1.example:443?encryption=none"},
+		{Name: "🇳🇴 Oslo", URI: "vless://id@no1.example:443?encryption=none"},
+	}
+	f := Filters{
+		Include: FilterRules{Protocol: "^(vless|trojan|ss)$"},
+		Exclude: FilterRules{Name: `expires|info`, Country: "^RU$"},
+		Rename: Rename{
+			StripEmoji: true,
+			Replace:    []RenameRule{{Pattern: `\s+\d+$`, Replace: ""}},
+			Template:   "{sub} {country} {name}",
+		},
+		MaxServers: 3,
+	}
+	taken := map[string]string{
+		serverKey(ServerEntry{URI: "ss://YWVzOnBhc3M@fi1.example:8388"}):                "",
+		serverKey(ServerEntry{URI: "vless://id@se1.example:443?encryption=none#other"}): "Other",
+	}
+	kept, filtered, err := applyFilters(servers, f, "Prov", taken)
+	if err != nil {
+		t.Fatalf("applyFilters: %v", err)
+	}
+	var names []string
+	for _, s := range kept {
+		names = append(names, s.Name)
+	}
+	want := []string{"Prov DE Frankfurt", "Prov NL Amsterdam", "Prov PL Warsaw"}
+	if !slices.Equal(names, want) {
+		t.Errorf("kept = %q, want %q", names, want)
+	}
+	if kept[0].Country != "DE" || kept[1].Country != "NL" {
+		t.Errorf("countries = %+v", kept)
+	}
+
+	reasons := map[string]string{}
+	for _, fs := range filtered {
+		reasons[fs.Name] = fs.Reason
+		if fs.Reason == FilterReasonDuplicateSubscription && fs.Source != "Other" {
+			t.Errorf("duplicate source = %q", fs.Source)
+		}
+	}
+	wantReasons := map[string]string{
+		"🇩🇪 Frankfurt 01 (copy)":      FilterReasonDuplicate,
+		"🇷🇺 Moscow":                   "exclude:country",
+		"🇺🇸 Info: expires 2026-12-01": "exclude:name",
+		"🇫🇮 Helsinki":                 FilterReasonDuplicateManual,
+		"🇸🇪 Stockholm":                FilterReasonDuplicateSubscription,
+		"🇳🇴 Oslo":                     FilterReasonMaxServers,
+	}
+	for name, reason := range wantReasons {
+		if reasons[name] != reason {
+			t.Errorf("%s: reason = %q, want %q", name, reasons[name], reason)
+		}
+	}
+	if len(filtered) != len(wantReasons) {
+		t.Errorf("filtered = %+v", filtered)
+	}
+
+	for _, bad := range []Filters{
+		{Include: FilterRules{Name: "("}},
+		{Rename: Rename{Replace: []RenameRule{{Pattern: ""}}}},
+		{MaxServers: -1},
+	} {
+		if bad.Validate() == nil {
+			t.Errorf("Validate(%+v) = nil", bad)
+		}
+	}
+}
+
+func TestManagerUpdateNowFiltersAndDedups(t *testing.T) {
+	clock := newAtomicClock(time.Unix(1000, 0))
+	m, _ := testManager(t, "", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Join([]string{
+			"vless://id@manual.example:443?encryption=none#Manual",
+			"vless://id@kept.example:443?encryption=none#Kept",
+			"trojan://pass@dropped.example:443#Dropped",
+		}, "\n")))
+	}, clock)
+	m.manual = func() []string { return []string{"vless://id@manual.example:443?encryption=none"} }
+
+	if err := m.SetFilters("sub1", Filters{Include: FilterRules{Name: "("}}); err == nil {
+		t.Fatal("SetFilters accepted invalid regexp")
+	}
+	if err := m.SetFilters("sub1", Filters{Exclude: FilterRules{Protocol: "trojan"}}); err != nil {
+		t.Fatalf("SetFilters: %v", err)
+	}
+	got, err := m.UpdateNow(context.Background(), "sub1")
+	if err != nil {
+		t.Fatalf("UpdateNow: %v", err)
+	}
+	if len(got.Servers) != 1 || !strings.Contains(got.Servers[0].URI, "kept.example") || got.Added != 1 || len(got.Filtered) != 2 {
+		t.Fatalf("result = %+v", got)
+	}
+
+	if err := m.SetFilters("sub1", Filters{Include: FilterRules{Country: "DE"}}); err != nil {
+		t.Fatalf("SetFilters: %v", err)
+	}
+	if _, err := m.UpdateNow(context.Background(), "sub1"); err == nil || !strings.Contains(err.Error(), "filtered out") {
+		t.Fatalf("UpdateNow with everything filtered: %v", err)
+	}
+	if sub := m.List()[0]; len(sub.Servers) != 1 || sub.Filters.Include.Country != "DE" {
+		t.Errorf("previous servers must survive an empty result: %+v", sub)
+	}
+}
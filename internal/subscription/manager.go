@@ -7,12 +7,13 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -28,20 +29,39 @@ const (
 )
 
 type Subscription struct {
-	ID          string        `json:"id"`
-	Name        string        `json:"name"`
-	URL         string        `json:"url,omitempty"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+	// Mirrors — запасные адреса, которые пробуются по порядку после URL.
+	Mirrors     []string      `json:"mirrors,omitempty"`
+	FetchRoute  FetchRoute    `json:"fetch_route,omitempty"`
 	UpdateEvery time.Duration `json:"update_every"`
 	UserAgent   string        `json:"user_agent,omitempty"`
+	// ImportRouting — собирать из proxy-groups и rules Clash-подписки черновик профиля.
+	ImportRouting bool `json:"import_routing,omitempty"`
+	// Filters — отбор, переименование и ограничение серверов при обновлении.
+	Filters     Filters       `json:"filters,omitempty"`
 	LastUpdated time.Time     `json:"last_updated,omitempty"`
 	LastAttempt time.Time     `json:"last_attempt,omitempty"`
 	NextAttempt time.Time     `json:"next_attempt,omitempty"`
 	Servers     []ServerEntry `json:"servers,omitempty"`
 	Quota       Quota         `json:"quota,omitempty"`
-	Backoff     time.Duration `json:"backoff,omitempty"`
-	LastError   string        `json:"last_error,omitempty"`
-	Empty       bool          `json:"empty,omitempty"`
-	CreatedAt   time.Time     `json:"created_at,omitempty"`
+	// Alerts — пороги уведомлений о трафике и сроке; AlertsFired — уже
+	// отправленные в текущем периоде.
+	Alerts      QuotaAlerts `json:"alerts,omitempty"`
+	AlertsFired []string    `json:"alerts_fired,omitempty"`
+	// Usage — замеры расхода трафика для прогноза исчерпания.
+	Usage []UsageSample `json:"usage,omitempty"`
+	// Paused — автообновление остановлено действием pause_updates.
+	Paused    bool          `json:"paused,omitempty"`
+	Backoff   time.Duration `json:"backoff,omitempty"`
+	LastError string        `json:"last_error,omitempty"`
+	Empty     bool          `json:"empty,omitempty"`
+	// Attempts — последние попытки загрузки по всем адресам и маршрутам.
+	Attempts  []FetchAttempt `json:"attempts,omitempty"`
+	CreatedAt time.Time      `json:"created_at,omitempty"`
+
+	cache fetchCache
 }
 
 type UpdateResult struct {
@@ -51,15 +71,33 @@ type UpdateResult struct {
 	Servers  []ServerEntry `json:"servers"`
 	Quota    Quota         `json:"quota,omitempty"`
 	Warnings []string      `json:"warnings,omitempty"`
+	Routing  *RoutingDraft `json:"routing,omitempty"`
+	// Filtered — серверы из ответа провайдера, отсеянные фильтрами,
+	// дедупликацией или max_servers.
+	Filtered []FilteredServer `json:"filtered,omitempty"`
+	// NotModified — провайдер ответил 304: серверы прежние и не применялись.
+	NotModified bool `json:"not_modified,omitempty"`
 }
 
 type ApplyFunc func(ctx context.Context, sub Subscription, result UpdateResult) error
 
 type Options struct {
-	Dir          string
-	Client       *http.Client
+	Dir    string
+	Client *http.Client
+	// TunnelClient — клиент для загрузки через туннель (FetchTunnel). Без него
+	// такие попытки завершаются ошибкой.
+	TunnelClient *http.Client
 	IsSupported  func(string) bool
+	// ValidateURL — дополнительная проверка адреса подписки и зеркал (SSRF:
+	// локальные и приватные адреса). nil — только https и непустой хост.
+	ValidateURL  func(string) error
 	ApplyServers ApplyFunc
+	// ManualServers возвращает URI серверов, добавленных вручную: такие
+	// серверы из подписок отбрасываются как дубликаты.
+	ManualServers func() []string
+	// OnAlert вызывается для каждого сработавшего порога квоты вне блокировок
+	// менеджера.
+	OnAlert      func(sub Subscription, alert Alert)
 	PollInterval time.Duration
 	Now          func() time.Time
 }
@@ -68,27 +106,41 @@ type Manager struct {
 	mu           sync.RWMutex
 	dir          string
 	client       *http.Client
+	tunnelClient *http.Client
 	isSupported  func(string) bool
+	validateURL  func(string) error
 	applyServers ApplyFunc
+	manual       func() []string
+	onAlert      func(Subscription, Alert)
 	pollInterval time.Duration
 	now          func() time.Time
 	subs         map[string]*Subscription
 }
 
 type metaFile struct {
-	ID              string    `json:"id"`
-	Name            string    `json:"name"`
-	URL             string    `json:"url"`
-	UpdateEveryNsec int64     `json:"update_every_nsec"`
-	UserAgent       string    `json:"user_agent,omitempty"`
-	LastUpdated     time.Time `json:"last_updated,omitempty"`
-	LastAttempt     time.Time `json:"last_attempt,omitempty"`
-	NextAttempt     time.Time `json:"next_attempt,omitempty"`
-	Quota           Quota     `json:"quota,omitempty"`
-	BackoffNsec     int64     `json:"backoff_nsec,omitempty"`
-	LastError       string    `json:"last_error,omitempty"`
-	Empty           bool      `json:"empty,omitempty"`
-	CreatedAt       time.Time `json:"created_at,omitempty"`
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	URL             string         `json:"url"`
+	Mirrors         []string       `json:"mirrors,omitempty"`
+	FetchRoute      FetchRoute     `json:"fetch_route,omitempty"`
+	Cache           fetchCache     `json:"cache,omitempty"`
+	UpdateEveryNsec int64          `json:"update_every_nsec"`
+	UserAgent       string         `json:"user_agent,omitempty"`
+	ImportRouting   bool           `json:"import_routing,omitempty"`
+	Filters         Filters        `json:"filters,omitempty"`
+	LastUpdated     time.Time      `json:"last_updated,omitempty"`
+	LastAttempt     time.Time      `json:"last_attempt,omitempty"`
+	NextAttempt     time.Time      `json:"next_attempt,omitempty"`
+	Quota           Quota          `json:"quota,omitempty"`
+	Alerts          QuotaAlerts    `json:"alerts,omitempty"`
+	AlertsFired     []string       `json:"alerts_fired,omitempty"`
+	Usage           []UsageSample  `json:"usage,omitempty"`
+	Paused          bool           `json:"paused,omitempty"`
+	BackoffNsec     int64          `json:"backoff_nsec,omitempty"`
+	LastError       string         `json:"last_error,omitempty"`
+	Empty           bool           `json:"empty,omitempty"`
+	Attempts        []FetchAttempt `json:"attempts,omitempty"`
+	CreatedAt       time.Time      `json:"created_at,omitempty"`
 }
 
 func NewManager(opts Options) (*Manager, error) {
@@ -110,8 +162,12 @@ func NewManager(opts Options) (*Manager, error) {
 	m := &Manager{
 		dir:          opts.Dir,
 		client:       opts.Client,
+		tunnelClient: opts.TunnelClient,
 		isSupported:  opts.IsSupported,
+		validateURL:  opts.ValidateURL,
 		applyServers: opts.ApplyServers,
+		manual:       opts.ManualServers,
+		onAlert:      opts.OnAlert,
 		pollInterval: opts.PollInterval,
 		now:          opts.Now,
 		subs:         map[string]*Subscription{},
@@ -133,6 +189,13 @@ func (m *Manager) Add(s *Subscription) error {
 	if err := validateHTTPSURL(s.URL); err != nil {
 		return err
 	}
+	s.Mirrors = trimMirrors(s.Mirrors)
+	if err := ValidateFetchOptions(s.Mirrors, s.FetchRoute); err != nil {
+		return err
+	}
+	if err := m.checkURLs(s.URL, s.Mirrors); err != nil {
+		return err
+	}
 	if s.ID == "" {
 		id, err := newID()
 		if err != nil {
@@ -143,6 +206,12 @@ func (m *Manager) Add(s *Subscription) error {
 	if s.Name = strings.TrimSpace(s.Name); s.Name == "" {
 		s.Name = "Subscription"
 	}
+	if err := s.Filters.Validate(); err != nil {
+		return fmt.Errorf("invalid filters: %w", err)
+	}
+	if err := s.Alerts.Validate(); err != nil {
+		return fmt.Errorf("invalid alerts: %w", err)
+	}
 	if s.CreatedAt.IsZero() {
 		s.CreatedAt = m.now().UTC()
 	}
@@ -173,6 +242,118 @@ func (m *Manager) Remove(id string) error {
 	return nil
 }
 
+// SetFilters заменяет фильтры подписки. Новые фильтры применяются при
+// следующем обновлении: исходный ответ провайдера не хранится.
+func (m *Manager) SetFilters(id string, f Filters) error {
+	if err := f.Validate(); err != nil {
+		return fmt.Errorf("invalid filters: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.subs[id]
+	if !ok {
+		return fmt.Errorf("subscription %s not found", id)
+	}
+	sub.Filters = f
+	// Без полного ответа провайдера новые фильтры применить не к чему.
+	sub.cache = fetchCache{}
+	return m.saveLocked(sub)
+}
+
+// SetFetchOptions заменяет зеркала и маршрут загрузки подписки.
+func (m *Manager) SetFetchOptions(id string, mirrors []string, route FetchRoute) error {
+	mirrors = trimMirrors(mirrors)
+	if err := ValidateFetchOptions(mirrors, route); err != nil {
+		return err
+	}
+	if err := m.checkURLs("", mirrors); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.subs[id]
+	if !ok {
+		return fmt.Errorf("subscription %s not found", id)
+	}
+	sub.Mirrors = mirrors
+	sub.FetchRoute = route
+	return m.saveLocked(sub)
+}
+
+// checkURLs применяет Options.ValidateURL к адресу подписки (пустой —
+// пропускается) и к зеркалам.
+func (m *Manager) checkURLs(rawURL string, mirrors []string) error {
+	if m.validateURL == nil {
+		return nil
+	}
+	if rawURL != "" {
+		if err := m.validateURL(rawURL); err != nil {
+			return err
+		}
+	}
+	for i, mirror := range mirrors {
+		if err := m.validateURL(mirror); err != nil {
+			return fmt.Errorf("mirrors[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func trimMirrors(mirrors []string) []string {
+	var out []string
+	for _, mirror := range mirrors {
+		if mirror = strings.TrimSpace(mirror); mirror != "" {
+			out = append(out, mirror)
+		}
+	}
+	return out
+}
+
+// SetAlerts заменяет пороги уведомлений и сразу сверяет с ними последнюю
+// известную квоту.
+func (m *Manager) SetAlerts(id string, a QuotaAlerts) error {
+	if err := a.Validate(); err != nil {
+		return fmt.Errorf("invalid alerts: %w", err)
+	}
+	var snapshot Subscription
+	var alerts []Alert
+	defer func() { m.dispatchAlerts(snapshot, alerts) }()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.subs[id]
+	if !ok {
+		return fmt.Errorf("subscription %s not found", id)
+	}
+	sub.Alerts = a
+	fired := evaluateAlerts(sub, m.now().UTC())
+	if err := m.saveLocked(sub); err != nil {
+		return err
+	}
+	snapshot, alerts = cloneSubscription(sub), fired
+	return nil
+}
+
+// Projection — прогноз исчерпания трафика подписки.
+func (m *Manager) Projection(id string) (QuotaProjection, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sub, ok := m.subs[id]
+	if !ok {
+		return QuotaProjection{}, fmt.Errorf("subscription %s not found", id)
+	}
+	return projectQuota(sub.Quota, sub.Usage), nil
+}
+
+func (m *Manager) dispatchAlerts(sub Subscription, alerts []Alert) {
+	if m.onAlert == nil {
+		return
+	}
+	for _, a := range alerts {
+		m.onAlert(sub, a)
+	}
+}
+
 func (m *Manager) List() []*Subscription {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -194,8 +375,16 @@ func (m *Manager) UpdateNow(ctx context.Context, id string) (*UpdateResult, erro
 	snapshot := cloneSubscription(sub)
 	m.mu.RUnlock()
 
-	result, err := m.fetch(ctx, snapshot)
+	fetched, err := m.fetch(ctx, snapshot)
+	result := fetched.result
 	now := m.now().UTC()
+	var manual []string
+	if err == nil && m.manual != nil {
+		manual = m.manual()
+	}
+	var alerted Subscription
+	var alerts []Alert
+	defer func() { m.dispatchAlerts(alerted, alerts) }()
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -204,6 +393,7 @@ func (m *Manager) UpdateNow(ctx context.Context, id string) (*UpdateResult, erro
 		return nil, fmt.Errorf("subscription %s not found", id)
 	}
 	current.LastAttempt = now
+	current.Attempts = appendAttempts(current.Attempts, fetched.attempts)
 	if err != nil {
 		current.Backoff = nextBackoff(current.Backoff)
 		current.NextAttempt = now.Add(current.Backoff)
@@ -213,19 +403,41 @@ func (m *Manager) UpdateNow(ctx context.Context, id string) (*UpdateResult, erro
 		}
 		return nil, err
 	}
+	if result.NotModified {
+		return m.keepNotModifiedLocked(current, result, fetched.cache, now, &alerted, &alerts)
+	}
+	received := len(result.Servers)
+	if received > 0 {
+		result.Servers, result.Filtered, err = applyFilters(result.Servers, current.Filters, current.Name, m.takenKeysLocked(id, manual))
+		if err != nil {
+			current.LastError = err.Error()
+			if saveErr := m.saveLocked(current); saveErr != nil {
+				return nil, saveErr
+			}
+			return nil, err
+		}
+	}
 	if len(result.Servers) == 0 {
+		msg := "subscription returned no supported servers"
+		if received > 0 {
+			msg = fmt.Sprintf("all %d servers were filtered out", received)
+		}
 		current.Empty = true
-		current.LastError = "subscription returned no supported servers"
+		current.LastError = msg
 		current.NextAttempt = now.Add(nextBackoff(current.Backoff))
 		if saveErr := m.saveLocked(current); saveErr != nil {
 			return nil, saveErr
 		}
-		return &result, fmt.Errorf("subscription returned no supported servers")
+		return &result, errors.New(msg)
 	}
 
+	prevBackoff := current.Backoff
 	result.Added, result.Removed, result.Changed = diffServers(current.Servers, result.Servers)
 	current.Servers = cloneServers(result.Servers)
+	current.cache = fetched.cache
 	current.Quota = result.Quota
+	current.Usage = recordUsage(current.Usage, result.Quota, now)
+	fired := evaluateAlerts(current, now)
 	current.LastUpdated = now
 	current.NextAttempt = nextDue(now, current.UpdateEvery)
 	current.Backoff = 0
@@ -234,14 +446,68 @@ func (m *Manager) UpdateNow(ctx context.Context, id string) (*UpdateResult, erro
 	if saveErr := m.saveLocked(current); saveErr != nil {
 		return nil, saveErr
 	}
+	alerted, alerts = cloneSubscription(current), fired
 	if m.applyServers != nil {
 		if applyErr := m.applyServers(ctx, cloneSubscription(current), result); applyErr != nil {
-			return nil, fmt.Errorf("apply subscription servers: %w", applyErr)
+			// Без ETag/Last-Modified следующая загрузка получит полный ответ и
+			// применит серверы заново: ответ 304 их не применяет.
+			err := fmt.Errorf("apply subscription servers: %w", applyErr)
+			current.cache = fetchCache{}
+			current.Backoff = nextBackoff(prevBackoff)
+			current.NextAttempt = now.Add(current.Backoff)
+			current.LastError = err.Error()
+			if saveErr := m.saveLocked(current); saveErr != nil {
+				return nil, saveErr
+			}
+			return nil, err
 		}
 	}
 	return &result, nil
 }
 
+// keepNotModifiedLocked завершает обновление с ответом 304: серверы прежние,
+// сдвигается только расписание и, если провайдер прислал заголовок, квота.
+func (m *Manager) keepNotModifiedLocked(current *Subscription, result UpdateResult, cache fetchCache, now time.Time, alerted *Subscription, alerts *[]Alert) (*UpdateResult, error) {
+	current.cache = cache
+	if result.Quota != (Quota{}) {
+		current.Quota = result.Quota
+		current.Usage = recordUsage(current.Usage, result.Quota, now)
+		*alerts = evaluateAlerts(current, now)
+	}
+	current.LastUpdated = now
+	current.NextAttempt = nextDue(now, current.UpdateEvery)
+	current.Backoff = 0
+	current.LastError = ""
+	current.Empty = false
+	if err := m.saveLocked(current); err != nil {
+		return nil, err
+	}
+	*alerted = cloneSubscription(current)
+	result.Servers = cloneServers(current.Servers)
+	result.Quota = current.Quota
+	return &result, nil
+}
+
+// takenKeysLocked собирает serverKey ручных серверов и остальных подписок:
+// сервер, который уже есть там, подписка id не добавляет.
+func (m *Manager) takenKeysLocked(id string, manual []string) map[string]string {
+	taken := map[string]string{}
+	for _, other := range m.subs {
+		if other.ID == id {
+			continue
+		}
+		for _, s := range other.Servers {
+			if _, ok := taken[serverKey(s)]; !ok {
+				taken[serverKey(s)] = other.Name
+			}
+		}
+	}
+	for _, uri := range manual {
+		taken[serverKey(ServerEntry{URI: uri})] = ""
+	}
+	return taken
+}
+
 func (m *Manager) Start(ctx context.Context) {
 	ticker := time.NewTicker(m.pollInterval)
 	defer ticker.Stop()
@@ -258,10 +524,11 @@ func (m *Manager) Start(ctx context.Context) {
 
 func (m *Manager) updateDue(ctx context.Context) {
 	now := m.now().UTC()
+	m.checkAlerts(now)
 	var ids []string
 	m.mu.RLock()
 	for id, sub := range m.subs {
-		if sub.UpdateEvery <= 0 {
+		if sub.UpdateEvery <= 0 || sub.Paused {
 			continue
 		}
 		next := sub.NextAttempt
@@ -284,35 +551,27 @@ func (m *Manager) updateDue(ctx context.Context) {
 	wg.Wait()
 }
 
-func (m *Manager) fetch(ctx context.Context, sub Subscription) (UpdateResult, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sub.URL, nil)
-	if err != nil {
-		return UpdateResult{}, fmt.Errorf("create subscription request: %w", err)
+// checkAlerts сверяет сохранённые квоты с порогами между обновлениями:
+// срок подписки истекает и без новых данных от провайдера.
+func (m *Manager) checkAlerts(now time.Time) {
+	type pending struct {
+		sub    Subscription
+		alerts []Alert
 	}
-	if sub.UserAgent != "" {
-		req.Header.Set("User-Agent", sub.UserAgent)
-	}
-	resp, err := m.client.Do(req)
-	if err != nil {
-		return UpdateResult{}, fmt.Errorf("download subscription: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return UpdateResult{}, fmt.Errorf("subscription HTTP %d", resp.StatusCode)
-	}
-	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodyBytes+1))
-	if err != nil {
-		return UpdateResult{}, fmt.Errorf("read subscription: %w", err)
+	var out []pending
+	m.mu.Lock()
+	for _, sub := range m.subs {
+		fired := evaluateAlerts(sub, now)
+		if len(fired) == 0 {
+			continue
+		}
+		_ = m.saveLocked(sub)
+		out = append(out, pending{sub: cloneSubscription(sub), alerts: fired})
 	}
-	if len(body) > MaxBodyBytes {
-		return UpdateResult{}, fmt.Errorf("subscription response exceeds 1 MiB")
+	m.mu.Unlock()
+	for _, p := range out {
+		m.dispatchAlerts(p.sub, p.alerts)
 	}
-	parsed := ParseBody(body, m.isSupported)
-	return UpdateResult{
-		Servers:  parsed.Servers,
-		Quota:    ParseUserInfoHeader(resp.Header.Get("subscription-userinfo")),
-		Warnings: parsed.Warnings,
-	}, nil
 }
 
 func (m *Manager) load() error {
@@ -336,20 +595,38 @@ func (m *Manager) load() error {
 		if err != nil {
 			return fmt.Errorf("decrypt subscription URL: %w", err)
 		}
+		mirrors := make([]string, 0, len(meta.Mirrors))
+		for _, enc := range meta.Mirrors {
+			mirror, err := decryptString(enc)
+			if err != nil {
+				return fmt.Errorf("decrypt subscription mirror: %w", err)
+			}
+			mirrors = append(mirrors, mirror)
+		}
 		sub := &Subscription{
-			ID:          meta.ID,
-			Name:        meta.Name,
-			URL:         rawURL,
-			UpdateEvery: time.Duration(meta.UpdateEveryNsec),
-			UserAgent:   meta.UserAgent,
-			LastUpdated: meta.LastUpdated,
-			LastAttempt: meta.LastAttempt,
-			NextAttempt: meta.NextAttempt,
-			Quota:       meta.Quota,
-			Backoff:     time.Duration(meta.BackoffNsec),
-			LastError:   meta.LastError,
-			Empty:       meta.Empty,
-			CreatedAt:   meta.CreatedAt,
+			ID:            meta.ID,
+			Name:          meta.Name,
+			URL:           rawURL,
+			Mirrors:       trimMirrors(mirrors),
+			FetchRoute:    meta.FetchRoute,
+			UpdateEvery:   time.Duration(meta.UpdateEveryNsec),
+			UserAgent:     meta.UserAgent,
+			ImportRouting: meta.ImportRouting,
+			Filters:       meta.Filters,
+			LastUpdated:   meta.LastUpdated,
+			LastAttempt:   meta.LastAttempt,
+			NextAttempt:   meta.NextAttempt,
+			Quota:         meta.Quota,
+			Alerts:        meta.Alerts,
+			AlertsFired:   meta.AlertsFired,
+			Usage:         meta.Usage,
+			Paused:        meta.Paused,
+			Backoff:       time.Duration(meta.BackoffNsec),
+			LastError:     meta.LastError,
+			Empty:         meta.Empty,
+			Attempts:      meta.Attempts,
+			CreatedAt:     meta.CreatedAt,
+			cache:         meta.Cache,
 		}
 		servers, err := m.loadServers(sub.ID)
 		if err != nil {
@@ -369,19 +646,37 @@ func (m *Manager) saveLocked(s *Subscription) error {
 	if err != nil {
 		return fmt.Errorf("encrypt subscription URL: %w", err)
 	}
+	var encMirrors []string
+	for _, mirror := range s.Mirrors {
+		enc, err := encryptString(mirror)
+		if err != nil {
+			return fmt.Errorf("encrypt subscription mirror: %w", err)
+		}
+		encMirrors = append(encMirrors, enc)
+	}
 	meta := metaFile{
 		ID:              s.ID,
 		Name:            s.Name,
 		URL:             encURL,
+		Mirrors:         encMirrors,
+		FetchRoute:      s.FetchRoute,
+		Cache:           s.cache,
 		UpdateEveryNsec: int64(s.UpdateEvery),
 		UserAgent:       s.UserAgent,
+		ImportRouting:   s.ImportRouting,
+		Filters:         s.Filters,
 		LastUpdated:     s.LastUpdated,
 		LastAttempt:     s.LastAttempt,
 		NextAttempt:     s.NextAttempt,
 		Quota:           s.Quota,
+		Alerts:          s.Alerts,
+		AlertsFired:     s.AlertsFired,
+		Usage:           s.Usage,
+		Paused:          s.Paused,
 		BackoffNsec:     int64(s.Backoff),
 		LastError:       s.LastError,
 		Empty:           s.Empty,
+		Attempts:        s.Attempts,
 		CreatedAt:       s.CreatedAt,
 	}
 	data, err := json.MarshalIndent(meta, "", "  ")
@@ -469,6 +764,12 @@ func newID() (string, error) {
 func cloneSubscription(s *Subscription) Subscription {
 	cp := *s
 	cp.Servers = cloneServers(s.Servers)
+	cp.Alerts.UsedPercent = slices.Clone(s.Alerts.UsedPercent)
+	cp.Alerts.ExpiryDays = slices.Clone(s.Alerts.ExpiryDays)
+	cp.AlertsFired = slices.Clone(s.AlertsFired)
+	cp.Usage = slices.Clone(s.Usage)
+	cp.Mirrors = slices.Clone(s.Mirrors)
+	cp.Attempts = slices.Clone(s.Attempts)
 	return cp
 }
 
@@ -7,6 +7,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"proxyclient/internal/config"
 )
 
 const MaxBodyBytes = 1 << 20
@@ -14,6 +16,8 @@ const MaxBodyBytes = 1 << 20
 type ServerEntry struct {
 	Name string `json:"name"`
 	URI  string `json:"uri"`
+	// Country — ISO-код страны по флагу в исходном имени, если он есть.
+	Country string `json:"country,omitempty"`
 }
 
 type Quota struct {
@@ -30,6 +34,8 @@ func (q Quota) Used() int64 {
 type ParseResult struct {
 	Servers  []ServerEntry `json:"servers"`
 	Warnings []string      `json:"warnings,omitempty"`
+	// Routing — proxy-groups и rules, если подписка в формате Clash.
+	Routing *RoutingDraft `json:"routing,omitempty"`
 }
 
 type sip008Document struct {
@@ -50,6 +56,16 @@ type sip008Server struct {
 
 func ParseBody(body []byte, isSupported func(string) bool) ParseResult {
 	content := strings.TrimSpace(strings.TrimPrefix(string(body), "\ufeff"))
+	// JSON разбираем раньше построчного режима: однострочный конфиг иначе
+	// принимается за один сервер.
+	if strings.HasPrefix(content, "{") || strings.HasPrefix(content, "[") {
+		if sb, ok := parseSingBox(content, isSupported); ok {
+			return sb
+		}
+		if sip, ok := parseSIP008(content); ok {
+			return sip
+		}
+	}
 	result := parseLines(content, isSupported)
 	if len(result.Servers) > 0 {
 		return result
@@ -62,8 +78,8 @@ func ParseBody(body []byte, isSupported func(string) bool) ParseResult {
 		}
 	}
 
-	if sip, ok := parseSIP008(content); ok {
-		return sip
+	if clash, ok := parseClash(content, isSupported); ok {
+		return clash
 	}
 
 	if content != "" {
@@ -128,6 +144,24 @@ func parseSIP008(content string) (ParseResult, bool) {
 	return result, true
 }
 
+// parseSingBox извлекает proxy outbound'ы из sing-box JSON. ok=false — JSON не
+// похож на конфиг sing-box или в нём нет ни одного outbound'а.
+func parseSingBox(content string, isSupported func(string) bool) (ParseResult, bool) {
+	servers, warnings, err := config.ParseSingBoxOutbounds([]byte(content))
+	if err != nil || len(servers)+len(warnings) == 0 {
+		return ParseResult{}, false
+	}
+	result := ParseResult{Warnings: warnings}
+	for _, s := range servers {
+		if !isSupported(s.Content) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("sing-box outbound %q skipped: unsupported server", s.Name))
+			continue
+		}
+		result.Servers = append(result.Servers, ServerEntry{Name: s.Name, URI: s.Content})
+	}
+	return result, true
+}
+
 func formatPort(v any) string {
 	switch p := v.(type) {
 	case float64:
@@ -5,6 +5,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"proxyclient/internal/config"
 )
 
 func supported(uri string) bool {
@@ -52,3 +54,145 @@ func TestParseUserInfoHeader(t *testing.T) {
 		t.Fatalf("ExpiresAt=%v, want %v", got.ExpiresAt, want)
 	}
 }
+
+const clashBody = `
+mixed-port: 7890
+proxies:
+  - name: "vless-reality"
+    type: vless
+    server: nl.example.com
+    port: 443
+    uuid: 00000000-0000-0000-0000-000000000001
+    network: tcp
+    tls: true
+    flow: xtls-rprx-vision
+    servername: www.microsoft.com
+    client-fingerprint: chrome
+    reality-opts:
+      public-key: pbkpbkpbkpbkpbkpbkpbkpbkpbkpbkpbkpbkpbkpbkp
+      short-id: abcd
+  - name: vmess-ws
+    type: vmess
+    server: de.example.com
+    port: "8443"
+    uuid: 00000000-0000-0000-0000-000000000002
+    alterId: 0
+    cipher: auto
+    tls: true
+    network: ws
+    ws-opts:
+      path: /ws
+      headers:
+        Host: cdn.example.com
+  - {name: trojan-grpc, type: trojan, server: fr.example.com, port: 443, password: secret, sni: fr.example.com, network: grpc, grpc-opts: {grpc-service-name: tunnel}}
+  - {name: ss, type: ss, server: 203.0.113.5, port: 8388, cipher: aes-256-gcm, password: pass, plugin: obfs, plugin-opts: {mode: http, host: bing.com}}
+  - {name: hy2, type: hysteria2, server: hy.example.com, port: 443, password: hypass, obfs: salamander, obfs-password: o, up: "30 Mbps", down: 100, ports: "20000-30000"}
+  - {name: tuic, type: tuic, server: tu.example.com, port: 443, uuid: 00000000-0000-0000-0000-000000000003, password: tp, congestion-controller: bbr, udp-relay-mode: native}
+  - {name: snell, type: snell, server: sn.example.com, port: 443, psk: x}
+proxy-groups:
+  - {name: Auto, type: url-test, proxies: [vless-reality, vmess-ws], url: "http://www.gstatic.com/generate_204", interval: 300}
+  - {name: Proxy, type: select, proxies: [Auto, trojan-grpc, DIRECT]}
+rules:
+  - DOMAIN-SUFFIX,google.com,Proxy
+  - DOMAIN-KEYWORD,ads,REJECT
+  - IP-CIDR,10.0.0.0/8,DIRECT,no-resolve
+  - GEOSITE,category-ads,REJECT-DROP
+  - PROCESS-NAME,telegram.exe,Auto
+  - DOMAIN,example.org,Missing
+  - MATCH,Auto
+`
+
+func TestParseBodyClashYAML(t *testing.T) {
+	got := ParseBody([]byte(clashBody), func(uri string) bool {
+		_, err := config.ParseServerContent(uri)
+		return err == nil
+	})
+	if len(got.Servers) != 6 {
+		t.Fatalf("servers=%d, want 6: %+v, warnings=%v", len(got.Servers), got.Servers, got.Warnings)
+	}
+	wantProto := []string{"vless", "vmess", "trojan", "shadowsocks", "hysteria2", "tuic"}
+	for i, entry := range got.Servers {
+		parsed, err := config.ParseServerContent(entry.URI)
+		if err != nil {
+			t.Fatalf("%s: ParseServerContent(%q): %v", entry.Name, entry.URI, err)
+		}
+		if parsed.Proto != wantProto[i] {
+			t.Errorf("%s: proto=%s, want %s", entry.Name, parsed.Proto, wantProto[i])
+		}
+	}
+
+	vless, _ := config.ParseServerContent(got.Servers[0].URI)
+	if tls := vless.Outbound.TLS; tls == nil || tls.Reality == nil || tls.ServerName != "www.microsoft.com" {
+		t.Errorf("vless reality lost: %+v", vless.Outbound.TLS)
+	}
+	vmess, _ := config.ParseServerContent(got.Servers[1].URI)
+	if tr := vmess.Outbound.Transport; tr == nil || tr.Type != "ws" || tr.Path != "/ws" {
+		t.Errorf("vmess ws transport lost: %+v", vmess.Outbound.Transport)
+	}
+	ss, _ := config.ParseServerContent(got.Servers[3].URI)
+	if ss.Outbound.Plugin != "obfs-local" || ss.Outbound.PluginOpts != "obfs=http;obfs-host=bing.com" {
+		t.Errorf("ss plugin = %q %q", ss.Outbound.Plugin, ss.Outbound.PluginOpts)
+	}
+	hy2, _ := config.ParseServerContent(got.Servers[4].URI)
+	if hy2.Outbound.UpMbps != 30 || hy2.Outbound.DownMbps != 100 {
+		t.Errorf("hysteria2 bandwidth = %d/%d", hy2.Outbound.UpMbps, hy2.Outbound.DownMbps)
+	}
+
+	warnings := strings.Join(got.Warnings, "\n")
+	for _, want := range []string{`"snell" skipped`, `field "ports" ignored`, "DOMAIN-KEYWORD", `unknown target "Missing"`, `nested group "Auto"`} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings missing %q:\n%s", want, warnings)
+		}
+	}
+
+	r := got.Routing
+	if r == nil {
+		t.Fatal("routing draft is missing")
+	}
+	if len(r.Groups) != 2 || r.Groups[0].Type != config.GroupTypeURLTest || r.Groups[1].Type != config.GroupTypeSelector {
+		t.Fatalf("groups = %+v", r.Groups)
+	}
+	if len(r.Groups[1].Proxies) != 1 || r.Groups[1].Proxies[0] != "trojan-grpc" {
+		t.Errorf("select group members = %v", r.Groups[1].Proxies)
+	}
+	wantRules := []DraftRule{
+		{Type: config.RuleTypeDomain, Value: "google.com", Target: "Proxy"},
+		{Type: config.RuleTypeIP, Value: "10.0.0.0/8", Target: ClashTargetDirect},
+		{Type: config.RuleTypeGeosite, Value: "geosite:category-ads", Target: ClashTargetReject},
+		{Type: config.RuleTypeProcess, Value: "telegram.exe", Target: "Auto"},
+	}
+	if len(r.Rules) != len(wantRules) {
+		t.Fatalf("rules = %+v", r.Rules)
+	}
+	for i, want := range wantRules {
+		if r.Rules[i] != want {
+			t.Errorf("rule %d = %+v, want %+v", i, r.Rules[i], want)
+		}
+	}
+	if r.Final != "Auto" {
+		t.Errorf("final = %q, want Auto", r.Final)
+	}
+}
+
+func TestParseBodyNotClash(t *testing.T) {
+	got := ParseBody([]byte("mixed-port: 7890\nrules:\n  - MATCH,DIRECT\n"), supported)
+	if len(got.Servers) != 0 || got.Routing != nil {
+		t.Fatalf("config without proxies must not parse: %+v", got)
+	}
+}
+
+func TestParseBodySingBoxJSON(t *testing.T) {
+	body := `{"outbounds":[{"type":"direct","tag":"direct"},` +
+		`{"type":"vless","tag":"nl","server":"nl.example.com","server_port":443,"uuid":"00000000-0000-0000-0000-000000000001"},` +
+		`{"type":"ssh","tag":"ssh","server":"ssh.example.com","server_port":22}]}`
+	got := ParseBody([]byte(body), func(uri string) bool { return config.IsSingBoxOutboundContent(uri) })
+	if len(got.Servers) != 1 || got.Servers[0].Name != "nl" {
+		t.Fatalf("servers = %+v, warnings = %v", got.Servers, got.Warnings)
+	}
+	if _, err := config.ParseServerContent(got.Servers[0].URI); err != nil {
+		t.Fatalf("ParseServerContent: %v", err)
+	}
+	if len(got.Warnings) != 1 || !strings.Contains(got.Warnings[0], `"ssh"`) {
+		t.Errorf("warnings = %v", got.Warnings)
+	}
+}
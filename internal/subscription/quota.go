@@ -0,0 +1,208 @@
+package subscription
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ExhaustedAction — что делать, когда трафик подписки исчерпан или срок истёк.
+type ExhaustedAction string
+
+const (
+	ExhaustedNone ExhaustedAction = ""
+	// ExhaustedSwitchProfile — применить профиль QuotaAlerts.Profile.
+	ExhaustedSwitchProfile ExhaustedAction = "switch_profile"
+	// ExhaustedFailover — переключиться на сервер другой подписки.
+	ExhaustedFailover ExhaustedAction = "failover"
+	// ExhaustedPauseUpdates — не обновлять подписку автоматически, пока
+	// ручное обновление не покажет, что трафик снова есть.
+	ExhaustedPauseUpdates ExhaustedAction = "pause_updates"
+)
+
+// QuotaAlerts — пороги уведомлений по трафику и сроку действия подписки.
+type QuotaAlerts struct {
+	// UsedPercent — доли израсходованного трафика, например [80, 95].
+	UsedPercent []int `json:"used_percent,omitempty"`
+	// ExpiryDays — за сколько дней до окончания предупреждать, например [3].
+	ExpiryDays  []int           `json:"expiry_days,omitempty"`
+	OnExhausted ExhaustedAction `json:"on_exhausted,omitempty"`
+	// Profile — имя профиля для ExhaustedSwitchProfile.
+	Profile string `json:"profile,omitempty"`
+}
+
+// AlertKind — вид уведомления о квоте.
+type AlertKind string
+
+const (
+	AlertUsage     AlertKind = "usage"
+	AlertExpiry    AlertKind = "expiry"
+	AlertExhausted AlertKind = "exhausted"
+	AlertExpired   AlertKind = "expired"
+)
+
+// Alert — сработавший порог. Для AlertExhausted и AlertExpired Action —
+// настроенное действие.
+type Alert struct {
+	Kind AlertKind `json:"kind"`
+	// Threshold — процент для AlertUsage, дни для AlertExpiry.
+	Threshold int             `json:"threshold,omitempty"`
+	Quota     Quota           `json:"quota"`
+	Action    ExhaustedAction `json:"action,omitempty"`
+	Profile   string          `json:"profile,omitempty"`
+}
+
+// UsageSample — израсходованный трафик на момент обновления подписки.
+type UsageSample struct {
+	At   time.Time `json:"at"`
+	Used int64     `json:"used"`
+}
+
+// QuotaProjection — прогноз исчерпания трафика по расходу между обновлениями.
+type QuotaProjection struct {
+	Quota       Quota   `json:"quota"`
+	UsedPercent float64 `json:"used_percent,omitempty"`
+	Remaining   int64   `json:"remaining,omitempty"`
+	// BytesPerDay — средний расход с последнего сброса счётчика.
+	BytesPerDay int64      `json:"bytes_per_day,omitempty"`
+	DepletesAt  *time.Time `json:"depletes_at,omitempty"`
+	// DepletesBeforeExpiry — трафик кончится раньше срока подписки.
+	DepletesBeforeExpiry bool `json:"depletes_before_expiry,omitempty"`
+	Samples              int  `json:"samples"`
+}
+
+const (
+	maxAlertThresholds = 8
+	maxUsageSamples    = 48
+	// minProjectionSpan — меньший интервал между замерами даёт случайный расход.
+	minProjectionSpan = time.Hour
+)
+
+// Validate проверяет пороги и действие.
+func (a QuotaAlerts) Validate() error {
+	if len(a.UsedPercent) > maxAlertThresholds || len(a.ExpiryDays) > maxAlertThresholds {
+		return fmt.Errorf("too many thresholds (max %d)", maxAlertThresholds)
+	}
+	for _, p := range a.UsedPercent {
+		if p < 1 || p > 100 {
+			return fmt.Errorf("used_percent %d out of range 1-100", p)
+		}
+	}
+	for _, d := range a.ExpiryDays {
+		if d < 1 || d > 365 {
+			return fmt.Errorf("expiry_days %d out of range 1-365", d)
+		}
+	}
+	switch a.OnExhausted {
+	case ExhaustedNone, ExhaustedFailover, ExhaustedPauseUpdates:
+	case ExhaustedSwitchProfile:
+		if a.Profile == "" {
+			return fmt.Errorf("profile is required for %s", ExhaustedSwitchProfile)
+		}
+	default:
+		return fmt.Errorf("unknown on_exhausted action %q", a.OnExhausted)
+	}
+	return nil
+}
+
+func (a QuotaAlerts) enabled() bool {
+	return len(a.UsedPercent) > 0 || len(a.ExpiryDays) > 0 || a.OnExhausted != ExhaustedNone
+}
+
+// evaluateAlerts сверяет квоту подписки с порогами и возвращает впервые
+// сработавшие. Сработавшие пороги запоминаются в s.AlertsFired и забываются,
+// когда условие перестаёт выполняться (продление, сброс трафика) — тогда
+// следующий период уведомит заново. Снимает паузу обновлений, если трафик
+// снова есть.
+func evaluateAlerts(s *Subscription, now time.Time) []Alert {
+	q := s.Quota
+	var active []string
+	var alerts []Alert
+	check := func(key string, cond bool, alert Alert) {
+		if !cond {
+			return
+		}
+		active = append(active, key)
+		if !slices.Contains(s.AlertsFired, key) {
+			alert.Quota = q
+			alerts = append(alerts, alert)
+		}
+	}
+	exhaustion := func(kind AlertKind) Alert {
+		return Alert{Kind: kind, Action: s.Alerts.OnExhausted, Profile: s.Alerts.Profile}
+	}
+
+	if s.Alerts.enabled() {
+		if q.Total > 0 {
+			used := q.Used()
+			for _, p := range s.Alerts.UsedPercent {
+				check(fmt.Sprintf("usage:%d", p), used*100 >= q.Total*int64(p) && used < q.Total,
+					Alert{Kind: AlertUsage, Threshold: p})
+			}
+			check(string(AlertExhausted), used >= q.Total, exhaustion(AlertExhausted))
+		}
+		if !q.ExpiresAt.IsZero() {
+			left := q.ExpiresAt.Sub(now)
+			for _, d := range s.Alerts.ExpiryDays {
+				check(fmt.Sprintf("expiry:%d", d), left > 0 && left <= time.Duration(d)*24*time.Hour,
+					Alert{Kind: AlertExpiry, Threshold: d})
+			}
+			check(string(AlertExpired), left <= 0, exhaustion(AlertExpired))
+		}
+	}
+
+	s.AlertsFired = active
+	exhausted := slices.Contains(active, string(AlertExhausted)) || slices.Contains(active, string(AlertExpired))
+	if !exhausted {
+		s.Paused = false
+	}
+	for _, a := range alerts {
+		if (a.Kind == AlertExhausted || a.Kind == AlertExpired) && a.Action == ExhaustedPauseUpdates {
+			s.Paused = true
+		}
+	}
+	return alerts
+}
+
+// recordUsage добавляет замер трафика. Уменьшение расхода означает сброс
+// счётчика у провайдера: старые замеры к новому периоду не относятся.
+func recordUsage(samples []UsageSample, q Quota, now time.Time) []UsageSample {
+	if q.Total <= 0 && q.Used() == 0 {
+		return samples
+	}
+	used := q.Used()
+	if n := len(samples); n > 0 && samples[n-1].Used > used {
+		samples = nil
+	}
+	samples = append(samples, UsageSample{At: now, Used: used})
+	if len(samples) > maxUsageSamples {
+		samples = slices.Clone(samples[len(samples)-maxUsageSamples:])
+	}
+	return samples
+}
+
+// projectQuota оценивает расход как среднюю скорость между первым и
+// последним замером текущего периода.
+func projectQuota(q Quota, samples []UsageSample) QuotaProjection {
+	p := QuotaProjection{Quota: q, Samples: len(samples)}
+	if q.Total > 0 {
+		p.UsedPercent = float64(q.Used()) * 100 / float64(q.Total)
+		p.Remaining = max(q.Total-q.Used(), 0)
+	}
+	if len(samples) < 2 {
+		return p
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	span := last.At.Sub(first.At)
+	if span < minProjectionSpan || last.Used <= first.Used {
+		return p
+	}
+	perSecond := float64(last.Used-first.Used) / span.Seconds()
+	p.BytesPerDay = int64(perSecond * 86400)
+	if q.Total > 0 {
+		at := last.At.Add(time.Duration(float64(max(q.Total-last.Used, 0)) / perSecond * float64(time.Second)))
+		p.DepletesAt = &at
+		p.DepletesBeforeExpiry = !q.ExpiresAt.IsZero() && at.Before(q.ExpiresAt)
+	}
+	return p
+}
@@ -0,0 +1,139 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEvaluateAlerts(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	sub := &Subscription{
+		Alerts: QuotaAlerts{UsedPercent: []int{80, 95}, ExpiryDays: []int{3}, OnExhausted: ExhaustedPauseUpdates},
+		Quota:  Quota{Download: 85, Total: 100, ExpiresAt: now.Add(48 * time.Hour)},
+	}
+	kinds := func(alerts []Alert) string {
+		out := ""
+		for _, a := range alerts {
+			out += fmt.Sprintf("%s:%d ", a.Kind, a.Threshold)
+		}
+		return out
+	}
+
+	if got := kinds(evaluateAlerts(sub, now)); got != "usage:80 expiry:3 " {
+		t.Fatalf("first evaluation = %q", got)
+	}
+	if got := evaluateAlerts(sub, now); len(got) != 0 {
+		t.Fatalf("alerts repeated: %q", kinds(got))
+	}
+
+	sub.Quota.Download = 100
+	got := evaluateAlerts(sub, now)
+	if kinds(got) != "exhausted:0 " || got[0].Action != ExhaustedPauseUpdates || !sub.Paused {
+		t.Fatalf("exhausted = %q paused=%v", kinds(got), sub.Paused)
+	}
+
+	// Renewal: the counter resets and the expiry moves, thresholds re-arm.
+	sub.Quota = Quota{Download: 10, Total: 100, ExpiresAt: now.Add(30 * 24 * time.Hour)}
+	if got := evaluateAlerts(sub, now); len(got) != 0 || sub.Paused || len(sub.AlertsFired) != 0 {
+		t.Fatalf("after renewal: alerts=%q paused=%v fired=%v", kinds(got), sub.Paused, sub.AlertsFired)
+	}
+	sub.Quota.Download = 96
+	if got := kinds(evaluateAlerts(sub, now)); got != "usage:80 usage:95 " {
+		t.Fatalf("next period = %q", got)
+	}
+
+	if got := kinds(evaluateAlerts(sub, now.Add(31*24*time.Hour))); got != "expired:0 " {
+		t.Fatalf("expired = %q", got)
+	}
+
+	for _, bad := range []QuotaAlerts{
+		{UsedPercent: []int{0}},
+		{ExpiryDays: []int{400}},
+		{OnExhausted: "shutdown"},
+		{OnExhausted: ExhaustedSwitchProfile},
+	} {
+		if bad.Validate() == nil {
+			t.Errorf("Validate(%+v) = nil", bad)
+		}
+	}
+}
+
+func TestProjectQuota(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	q := Quota{Download: 300, Total: 1000, ExpiresAt: start.Add(30 * 24 * time.Hour)}
+	var samples []UsageSample
+	samples = recordUsage(samples, Quota{Download: 900, Total: 1000}, start.Add(-time.Hour))
+	samples = recordUsage(samples, Quota{Download: 100, Total: 1000}, start)
+	samples = recordUsage(samples, Quota{Download: 200, Total: 1000}, start.Add(24*time.Hour))
+	samples = recordUsage(samples, q, start.Add(48*time.Hour))
+	if len(samples) != 3 {
+		t.Fatalf("samples must restart after the counter reset: %+v", samples)
+	}
+
+	p := projectQuota(q, samples)
+	if p.BytesPerDay != 100 || p.Remaining != 700 || p.UsedPercent != 30 {
+		t.Errorf("projection = %+v", p)
+	}
+	want := start.Add(9 * 24 * time.Hour)
+	if p.DepletesAt == nil || !p.DepletesAt.Equal(want) || !p.DepletesBeforeExpiry {
+		t.Errorf("depletes at %v, want %v before expiry", p.DepletesAt, want)
+	}
+
+	if p := projectQuota(q, samples[:1]); p.DepletesAt != nil || p.BytesPerDay != 0 {
+		t.Errorf("single sample must not project: %+v", p)
+	}
+}
+
+func TestManagerUpdateNowAlertsAndPauses(t *testing.T) {
+	clock := newAtomicClock(time.Unix(1000, 0))
+	var used atomic.Int64
+	var fetches atomic.Int32
+	m, _ := testManager(t, "", func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("subscription-userinfo", fmt.Sprintf("upload=0; download=%d; total=100", used.Load()))
+		_, _ = w.Write([]byte("vless://id@example.com:443?encryption=none#A"))
+	}, clock)
+	var alerts []Alert
+	m.onAlert = func(sub Subscription, a Alert) {
+		if sub.ID != "sub1" {
+			t.Errorf("alert for %q", sub.ID)
+		}
+		alerts = append(alerts, a)
+	}
+	if err := m.SetAlerts("sub1", QuotaAlerts{UsedPercent: []int{80}, OnExhausted: ExhaustedPauseUpdates}); err != nil {
+		t.Fatalf("SetAlerts: %v", err)
+	}
+
+	used.Store(50)
+	if _, err := m.UpdateNow(context.Background(), "sub1"); err != nil {
+		t.Fatalf("UpdateNow: %v", err)
+	}
+	used.Store(100)
+	clock.Add(2 * time.Hour)
+	if _, err := m.UpdateNow(context.Background(), "sub1"); err != nil {
+		t.Fatalf("UpdateNow: %v", err)
+	}
+	// Exhaustion supersedes the 80% threshold skipped between updates.
+	if len(alerts) != 1 || alerts[0].Kind != AlertExhausted {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+	if sub := m.List()[0]; !sub.Paused || len(sub.Usage) != 2 {
+		t.Fatalf("subscription = %+v", sub)
+	}
+	p, err := m.Projection("sub1")
+	if err != nil || p.BytesPerDay != 600 || p.Remaining != 0 {
+		t.Fatalf("Projection = %+v, %v", p, err)
+	}
+
+	// A paused subscription is skipped by the scheduler.
+	fetches.Store(0)
+	clock.Add(2 * time.Hour)
+	m.updateDue(context.Background())
+	if n := fetches.Load(); n != 0 {
+		t.Fatalf("paused subscription fetched %d times", n)
+	}
+}
@@ -0,0 +1,4 @@
+// Package trafficdb accumulates per-connection traffic from the sing-box Clash
+// API into a local SQLite database keyed by day, process, host and outbound,
+// for daily and monthly usage reports.
+package trafficdb
@@ -0,0 +1,353 @@
+package trafficdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/logger"
+)
+
+// DefaultFile — база учёта трафика рядом с остальными данными приложения.
+const DefaultFile = config.DataDir + "/traffic.db"
+
+// DayLayout — формат дня в ключах и параметрах запросов (локальное время).
+const DayLayout = "2006-01-02"
+
+const flushInterval = time.Minute
+
+// Conn — снимок одного соединения из Clash API /connections.
+// Upload и Download — накопленные байты соединения с момента открытия.
+type Conn struct {
+	ID       string
+	Process  string
+	Host     string
+	Outbound string
+	Upload   int64
+	Download int64
+}
+
+// Key — измерения учёта.
+type Key struct {
+	Day      string `json:"day"`
+	Process  string `json:"process"`
+	Host     string `json:"host"`
+	Outbound string `json:"outbound"`
+}
+
+// Usage — объём трафика и число новых соединений.
+type Usage struct {
+	Upload      int64 `json:"upload"`
+	Download    int64 `json:"download"`
+	Connections int64 `json:"connections"`
+}
+
+func (u *Usage) add(o Usage) {
+	u.Upload += o.Upload
+	u.Download += o.Download
+	u.Connections += o.Connections
+}
+
+// Snapshot — ответ Clash API /connections: активные соединения и общие
+// счётчики sing-box с его запуска (uploadTotal/downloadTotal).
+type Snapshot struct {
+	Conns         []Conn
+	UploadTotal   int64
+	DownloadTotal int64
+}
+
+// UnattributedProcess — процесс для трафика, который нельзя приписать
+// конкретному соединению: хвосты закрытых соединений и соединения, открытые
+// и закрытые между двумя опросами.
+const UnattributedProcess = "unknown"
+
+type connBytes struct {
+	upload   int64
+	download int64
+}
+
+// Store — учёт трафика по соединениям. Observe считает прирост байт каждого
+// соединения между опросами и относит его к дню, когда он произошёл; итоги
+// копятся в памяти и раз в минуту дописываются в SQLite. Байты, которые
+// соединение передало после последнего опроса перед закрытием, и короткие
+// соединения между опросами досчитываются по общим счётчикам снимка как
+// UnattributedProcess.
+type Store struct {
+	db        *sql.DB
+	mu        sync.Mutex
+	seen      map[string]connBytes
+	totals    *Snapshot
+	pending   map[Key]*Usage
+	now       func() time.Time
+	startOnce sync.Once
+}
+
+// Open открывает (создаёт) базу учёта трафика по пути path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("traffic db dir: %w", err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err := initSchema(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Store{
+		db:      db,
+		seen:    map[string]connBytes{},
+		pending: map[Key]*Usage{},
+		now:     time.Now,
+	}, nil
+}
+
+func initSchema(db *sql.DB) error {
+	stmts := []string{
+		`PRAGMA journal_mode=WAL`,
+		`PRAGMA busy_timeout=5000`,
+		`CREATE TABLE IF NOT EXISTS usage (
+			day TEXT NOT NULL,
+			process TEXT NOT NULL,
+			host TEXT NOT NULL,
+			outbound TEXT NOT NULL,
+			upload INTEGER NOT NULL DEFAULT 0,
+			download INTEGER NOT NULL DEFAULT 0,
+			connections INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (day, process, host, outbound)
+		)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("traffic db schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// Observe учитывает очередной снимок соединений. Прирост счётчиков
+// соединения относится к его процессу, хосту и outbound'у. Соединения,
+// которых нет в снимке, считаются закрытыми. То, на что общие счётчики
+// выросли сверх прироста видимых соединений, — хвосты закрытых и соединения
+// короче интервала опроса — не приписывается никому из них, а относится к
+// UnattributedProcess. Когда общие счётчики уменьшились (sing-box
+// перезапущен) или их нет, этот досчёт пропускается.
+func (s *Store) Observe(snap Snapshot) {
+	day := s.now().Format(DayLayout)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := make(map[string]connBytes, len(snap.Conns))
+	var counted Usage
+	for _, c := range snap.Conns {
+		if c.ID == "" {
+			continue
+		}
+		prev, known := s.seen[c.ID]
+		delta := Usage{
+			Upload:   max(c.Upload-prev.upload, 0),
+			Download: max(c.Download-prev.download, 0),
+		}
+		if !known {
+			delta.Connections = 1
+		}
+		next[c.ID] = connBytes{upload: c.Upload, download: c.Download}
+		counted.add(delta)
+		s.credit(Key{Day: day, Process: c.Process, Host: c.Host, Outbound: c.Outbound}, delta)
+	}
+	if prev := s.totals; prev != nil && snap.UploadTotal >= prev.UploadTotal && snap.DownloadTotal >= prev.DownloadTotal {
+		s.credit(Key{Day: day, Process: UnattributedProcess}, Usage{
+			Upload:   max(snap.UploadTotal-prev.UploadTotal-counted.Upload, 0),
+			Download: max(snap.DownloadTotal-prev.DownloadTotal-counted.Download, 0),
+		})
+	}
+	s.seen = next
+	s.totals = &Snapshot{UploadTotal: snap.UploadTotal, DownloadTotal: snap.DownloadTotal}
+}
+
+// credit добавляет u к накопленному по key. Вызывается под s.mu.
+func (s *Store) credit(key Key, u Usage) {
+	if u == (Usage{}) {
+		return
+	}
+	cur := s.pending[key]
+	if cur == nil {
+		cur = &Usage{}
+		s.pending[key] = cur
+	}
+	cur.add(u)
+}
+
+// Start периодически сохраняет накопленное. Когда ctx завершается, остаток
+// сохраняется и база закрывается. Повторные вызовы ничего не делают.
+func (s *Store) Start(ctx context.Context, log logger.Logger) {
+	if log == nil {
+		log = logger.NewNop()
+	}
+	s.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(flushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					if err := s.Flush(); err != nil {
+						log.Warn("traffic db flush: %v", err)
+					}
+					if err := s.db.Close(); err != nil {
+						log.Warn("traffic db close: %v", err)
+					}
+					return
+				case <-ticker.C:
+					if err := s.Flush(); err != nil {
+						log.Warn("traffic db flush: %v", err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Flush сохраняет накопленное в памяти. При ошибке данные остаются в очереди.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = map[Key]*Usage{}
+	s.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := s.write(pending); err != nil {
+		s.mu.Lock()
+		for key, u := range pending {
+			if cur := s.pending[key]; cur != nil {
+				cur.add(*u)
+			} else {
+				s.pending[key] = u
+			}
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (s *Store) write(pending map[Key]*Usage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for key, u := range pending {
+		if _, err := tx.Exec(`INSERT INTO usage(day, process, host, outbound, upload, download, connections)
+			VALUES(?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(day, process, host, outbound) DO UPDATE SET
+				upload = upload + excluded.upload,
+				download = download + excluded.download,
+				connections = connections + excluded.connections`,
+			key.Day, key.Process, key.Host, key.Outbound, u.Upload, u.Download, u.Connections); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Dimension — измерение, по которому группируется отчёт.
+type Dimension string
+
+const (
+	ByProcess  Dimension = "process"
+	ByHost     Dimension = "host"
+	ByOutbound Dimension = "outbound"
+	ByDay      Dimension = "day"
+)
+
+// ValidDimension сообщает, поддерживается ли группировка by.
+func ValidDimension(by Dimension) bool {
+	switch by {
+	case ByProcess, ByHost, ByOutbound, ByDay:
+		return true
+	}
+	return false
+}
+
+// Row — строка отчёта: значение измерения и суммарный трафик.
+type Row struct {
+	Key string `json:"key"`
+	Usage
+}
+
+// Breakdown суммирует трафик за дни [from, to] (формат DayLayout) по измерению
+// by. Строки упорядочены по объёму трафика, для ByDay — по дате. limit <= 0 —
+// без ограничения. Накопленное в памяти сохраняется перед запросом.
+func (s *Store) Breakdown(ctx context.Context, from, to string, by Dimension, limit int) ([]Row, error) {
+	if !ValidDimension(by) {
+		return nil, fmt.Errorf("unknown dimension %q", by)
+	}
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	order := "SUM(upload) + SUM(download) DESC, key"
+	if by == ByDay {
+		order = "key"
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+	// by проверен ValidDimension — имя колонки подставляется безопасно.
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+string(by)+` AS key, SUM(upload), SUM(download), SUM(connections)
+		 FROM usage WHERE day >= ? AND day <= ?
+		 GROUP BY key ORDER BY `+order+` LIMIT ?`, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Row{}
+	for rows.Next() {
+		var r Row
+		if err := rows.Scan(&r.Key, &r.Upload, &r.Download, &r.Connections); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// Record — строка таблицы учёта для экспорта.
+type Record struct {
+	Key
+	Usage
+}
+
+// Records возвращает все строки учёта за дни [from, to] в порядке дня и объёма.
+func (s *Store) Records(ctx context.Context, from, to string) ([]Record, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT day, process, host, outbound, upload, download, connections
+		 FROM usage WHERE day >= ? AND day <= ?
+		 ORDER BY day, upload + download DESC, process, host, outbound`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Record{}
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.Day, &r.Process, &r.Host, &r.Outbound, &r.Upload, &r.Download, &r.Connections); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,123 @@
+package trafficdb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "traffic.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { _ = s.db.Close() })
+	return s
+}
+
+func TestObserveAccumulatesDeltasPerDay(t *testing.T) {
+	s := openTestStore(t)
+	day1 := time.Date(2026, 10, 16, 23, 59, 0, 0, time.Local)
+	s.now = func() time.Time { return day1 }
+
+	s.Observe(Snapshot{Conns: []Conn{
+		{ID: "1", Process: "chrome.exe", Host: "video.example.com", Outbound: "proxy-out", Upload: 100, Download: 1000},
+		{ID: "2", Process: "chrome.exe", Host: "video.example.com", Outbound: "proxy-out", Upload: 10, Download: 10},
+	}})
+	s.Observe(Snapshot{Conns: []Conn{
+		{ID: "1", Process: "chrome.exe", Host: "video.example.com", Outbound: "proxy-out", Upload: 150, Download: 3000},
+	}})
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	// Соединение 1 переживает полночь: прирост относится уже к новому дню.
+	s.now = func() time.Time { return day1.Add(2 * time.Minute) }
+	s.Observe(Snapshot{Conns: []Conn{
+		{ID: "1", Process: "chrome.exe", Host: "video.example.com", Outbound: "proxy-out", Upload: 150, Download: 5000},
+		{ID: "3", Process: "telegram.exe", Host: "149.154.167.51", Outbound: "direct", Upload: 7, Download: 9},
+	}})
+
+	ctx := context.Background()
+	byDay, err := s.Breakdown(ctx, "2026-10-01", "2026-10-31", ByDay, 0)
+	if err != nil {
+		t.Fatalf("Breakdown(day): %v", err)
+	}
+	if len(byDay) != 2 {
+		t.Fatalf("byDay = %+v", byDay)
+	}
+	if byDay[0].Key != "2026-10-16" || byDay[0].Upload != 160 || byDay[0].Download != 3010 || byDay[0].Connections != 2 {
+		t.Errorf("day 16 = %+v", byDay[0])
+	}
+	if byDay[1].Key != "2026-10-17" || byDay[1].Download != 2009 || byDay[1].Connections != 1 {
+		t.Errorf("day 17 = %+v", byDay[1])
+	}
+
+	byProcess, err := s.Breakdown(ctx, "2026-10-01", "2026-10-31", ByProcess, 1)
+	if err != nil {
+		t.Fatalf("Breakdown(process): %v", err)
+	}
+	if len(byProcess) != 1 || byProcess[0].Key != "chrome.exe" || byProcess[0].Download != 5010 {
+		t.Errorf("byProcess = %+v", byProcess)
+	}
+
+	records, err := s.Records(ctx, "2026-10-17", "2026-10-17")
+	if err != nil {
+		t.Fatalf("Records: %v", err)
+	}
+	if len(records) != 2 || records[0].Process != "chrome.exe" || records[1].Outbound != "direct" {
+		t.Errorf("records = %+v", records)
+	}
+
+	if _, err := s.Breakdown(ctx, "2026-10-01", "2026-10-31", Dimension("day; DROP TABLE usage"), 0); err == nil {
+		t.Error("unknown dimension must be rejected")
+	}
+}
+
+// Хвост закрытого соединения и соединение, открытое и закрытое между опросами,
+// досчитываются по общим счётчикам Clash API как неразобранный трафик, не
+// приписываясь процессам закрытых соединений.
+func TestObserveCreditsClosedConnections(t *testing.T) {
+	s := openTestStore(t)
+	s.now = func() time.Time { return time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local) }
+
+	s.Observe(Snapshot{UploadTotal: 1000, DownloadTotal: 10000, Conns: []Conn{
+		{ID: "1", Process: "chrome.exe", Host: "video.example.com", Outbound: "proxy-out", Upload: 100, Download: 1000},
+		{ID: "2", Process: "steam.exe", Host: "cdn.example.com", Outbound: "direct", Upload: 10, Download: 500},
+	}})
+	// Соединение 2 закрылось, передав после первого опроса ещё 20/3000 байт.
+	s.Observe(Snapshot{UploadTotal: 1070, DownloadTotal: 14000, Conns: []Conn{
+		{ID: "1", Process: "chrome.exe", Host: "video.example.com", Outbound: "proxy-out", Upload: 150, Download: 2000},
+	}})
+	// Между опросами прошло невидимое соединение: ещё 5/40 байт.
+	s.Observe(Snapshot{UploadTotal: 1075, DownloadTotal: 14040, Conns: []Conn{
+		{ID: "1", Process: "chrome.exe", Host: "video.example.com", Outbound: "proxy-out", Upload: 150, Download: 2000},
+	}})
+	// Перезапуск sing-box: счётчики сбросились, досчёта нет.
+	s.Observe(Snapshot{UploadTotal: 10, DownloadTotal: 10})
+
+	ctx := context.Background()
+	rows, err := s.Breakdown(ctx, "2026-10-17", "2026-10-17", ByProcess, 0)
+	if err != nil {
+		t.Fatalf("Breakdown: %v", err)
+	}
+	got := map[string]Usage{}
+	for _, r := range rows {
+		got[r.Key] = r.Usage
+	}
+	want := map[string]Usage{
+		"chrome.exe":        {Upload: 150, Download: 2000, Connections: 1},
+		"steam.exe":         {Upload: 10, Download: 500, Connections: 1},
+		UnattributedProcess: {Upload: 25, Download: 3040},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("rows = %+v", rows)
+	}
+	for proc, u := range want {
+		if got[proc] != u {
+			t.Errorf("%s = %+v, want %+v", proc, got[proc], u)
+		}
+	}
+}
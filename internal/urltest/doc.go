@@ -0,0 +1,5 @@
+// Package urltest measures the real HTTP round-trip through individual servers.
+// Each server gets its own short-lived sing-box instance with a single outbound
+// and a mixed inbound on an ephemeral loopback port, so the result reflects the
+// tunnel itself rather than the TCP handshake or the currently active proxy.
+package urltest
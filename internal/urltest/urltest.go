@@ -0,0 +1,360 @@
+package urltest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"proxyclient/internal/config"
+	"proxyclient/internal/winexec"
+)
+
+// DefaultURL — тот же 204-эндпоинт, что и у real-ping через активный прокси.
+const DefaultURL = "https://cp.cloudflare.com/"
+
+const (
+	defaultConcurrency = 4
+	defaultTimeout     = 10 * time.Second
+	startupTimeout     = 5 * time.Second
+	maxOutputTail      = 4 << 10
+)
+
+// Target — сервер для теста. Outbounds[0] — тестируемый outbound, остальные —
+// его detour-цепочка (см. config.ServerChainOutbounds).
+type Target struct {
+	ID        string
+	Outbounds []config.SBOutbound
+}
+
+// errNotTested — контекст закончился раньше, чем до сервера дошла очередь.
+var errNotTested = errors.New("not tested")
+
+// Result — результат URL-теста одного сервера. Skipped — сервер не
+// тестировался (запрос отменён, пока он ждал очереди): это не отказ сервера.
+type Result struct {
+	ID        string `json:"id"`
+	LatencyMs int64  `json:"latency_ms"`
+	OK        bool   `json:"ok"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Instance — запущенный экземпляр sing-box.
+type Instance interface {
+	// Done закрывается, когда процесс завершился сам.
+	Done() <-chan struct{}
+	// Stop завершает процесс и возвращает хвост его вывода.
+	Stop() string
+}
+
+// Launcher запускает sing-box с конфигом configPath.
+type Launcher func(ctx context.Context, configPath string) (Instance, error)
+
+// Runner запускает URL-тесты. Одновременно работает не больше Concurrency
+// экземпляров sing-box — и для Run, и для параллельных вызовов Test.
+type Runner struct {
+	// ExecPath — путь к sing-box.exe.
+	ExecPath string
+	// URL — адрес, время ответа которого измеряется. Пусто — DefaultURL.
+	URL string
+	// Concurrency — лимит одновременно запущенных экземпляров. <= 0 — 4.
+	Concurrency int
+	// Timeout — таймаут HTTP-запроса через сервер. <= 0 — 10s.
+	Timeout time.Duration
+	// WorkDir — каталог временных конфигов. Пусто — os.TempDir().
+	WorkDir string
+	// Launch подменяет запуск процесса (тесты). nil — ExecPath run -c.
+	Launch Launcher
+
+	semOnce sync.Once
+	sem     chan struct{}
+}
+
+// Run тестирует targets параллельно с учётом лимита и возвращает результаты
+// в том же порядке.
+func (r *Runner) Run(ctx context.Context, targets []Target) []Result {
+	results := make([]Result, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			results[i] = r.Test(ctx, t)
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+// Test измеряет время HTTP-запроса к URL через отдельный экземпляр sing-box,
+// в котором есть только outbound(ы) сервера и mixed inbound на свободном порту.
+func (r *Runner) Test(ctx context.Context, t Target) Result {
+	res := Result{ID: t.ID}
+	latency, err := r.test(ctx, t)
+	if err != nil {
+		res.Skipped = errors.Is(err, errNotTested)
+		res.Error = err.Error()
+		return res
+	}
+	res.LatencyMs = max(latency.Milliseconds(), 1)
+	res.OK = true
+	return res
+}
+
+func (r *Runner) test(ctx context.Context, t Target) (time.Duration, error) {
+	if len(t.Outbounds) == 0 {
+		return 0, errors.New("no outbound")
+	}
+	r.semOnce.Do(func() {
+		n := r.Concurrency
+		if n <= 0 {
+			n = defaultConcurrency
+		}
+		r.sem = make(chan struct{}, n)
+	})
+	if ctx.Err() != nil {
+		return 0, errNotTested
+	}
+	select {
+	case r.sem <- struct{}{}:
+		defer func() { <-r.sem }()
+	case <-ctx.Done():
+		return 0, errNotTested
+	}
+	// Свой срок у каждого сервера отсчитывается с момента, когда до него
+	// дошла очередь: время ожидания в очереди на него не влияет.
+	ctx, cancel := context.WithTimeout(ctx, startupTimeout+r.timeout()+time.Second)
+	defer cancel()
+
+	port, err := freePort()
+	if err != nil {
+		return 0, err
+	}
+	data, err := BuildConfig(t.Outbounds, port)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(r.WorkDir, "urltest-*.json")
+	if err != nil {
+		return 0, fmt.Errorf("temp config: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("temp config: %w", err)
+	}
+
+	launch := r.Launch
+	if launch == nil {
+		launch = r.launchSingBox
+	}
+	inst, err := launch(ctx, path)
+	if err != nil {
+		return 0, fmt.Errorf("start sing-box: %w", err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	latency, err := r.measure(ctx, addr, inst.Done())
+	output := inst.Stop()
+	if err != nil {
+		if line := lastLine(output); line != "" {
+			err = fmt.Errorf("%w (sing-box: %s)", err, line)
+		}
+		return 0, err
+	}
+	return latency, nil
+}
+
+func (r *Runner) measure(ctx context.Context, addr string, exited <-chan struct{}) (time.Duration, error) {
+	if err := waitListening(ctx, addr, exited); err != nil {
+		return 0, err
+	}
+	timeout := r.timeout()
+	target := r.URL
+	if target == "" {
+		target = DefaultURL
+	}
+	proxyURL := &url.URL{Scheme: "http", Host: addr}
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL), DisableKeepAlives: true},
+		Timeout:   timeout,
+	}
+	defer client.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return latency, nil
+}
+
+func (r *Runner) timeout() time.Duration {
+	if r.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return r.Timeout
+}
+
+// waitListening ждёт, пока sing-box откроет inbound, или завершится.
+func waitListening(ctx context.Context, addr string, exited <-chan struct{}) error {
+	deadline := time.NewTimer(startupTimeout)
+	defer deadline.Stop()
+	for {
+		var d net.Dialer
+		dialCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		conn, err := d.DialContext(dialCtx, "tcp", addr)
+		cancel()
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-exited:
+			return errors.New("sing-box exited before listening")
+		case <-deadline.C:
+			return errors.New("sing-box did not start listening in time")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// testConfig — минимальный конфиг sing-box для URL-теста: без TUN, DNS-перехвата и Clash API.
+type testConfig struct {
+	Log       config.SBLog        `json:"log"`
+	DNS       config.SBDNS        `json:"dns"`
+	Inbounds  []config.SBInbound  `json:"inbounds"`
+	Outbounds []config.SBOutbound `json:"outbounds"`
+	Route     config.SBRoute      `json:"route"`
+}
+
+// BuildConfig собирает конфиг экземпляра: mixed inbound на 127.0.0.1:port и
+// весь трафик в outbounds[0].
+func BuildConfig(outbounds []config.SBOutbound, port int) ([]byte, error) {
+	if len(outbounds) == 0 {
+		return nil, errors.New("no outbound")
+	}
+	cfg := testConfig{
+		Log: config.SBLog{Level: "error"},
+		DNS: config.SBDNS{Servers: []config.SBDNSServer{{Tag: "local", Type: "local"}}},
+		Inbounds: []config.SBInbound{{
+			Type:       "mixed",
+			Tag:        "mixed-in",
+			Listen:     "127.0.0.1",
+			ListenPort: port,
+		}},
+		Outbounds: outbounds,
+		Route: config.SBRoute{
+			Final: outbounds[0].Tag,
+			// Соединения к серверу должны идти мимо TUN основного экземпляра —
+			// иначе тест мерил бы задержку активного сервера плюс тестируемого.
+			AutoDetectInterface:   true,
+			DefaultDomainResolver: "local",
+		},
+	}
+	return json.MarshalIndent(cfg, "", "  ")
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("free port: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(s)
+}
+
+type process struct {
+	cmd  *exec.Cmd
+	out  *tailBuffer
+	done chan struct{}
+}
+
+func (r *Runner) launchSingBox(ctx context.Context, configPath string) (Instance, error) {
+	if r.ExecPath == "" {
+		return nil, errors.New("sing-box path is not set")
+	}
+	if _, err := os.Stat(r.ExecPath); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, r.ExecPath, "run", "-c", configPath)
+	winexec.HideWindow(cmd)
+	out := &tailBuffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &process{cmd: cmd, out: out, done: make(chan struct{})}
+	go func() {
+		_ = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+func (p *process) Done() <-chan struct{} { return p.done }
+
+func (p *process) Stop() string {
+	select {
+	case <-p.done:
+	default:
+		_ = p.cmd.Process.Kill()
+		<-p.done
+	}
+	return p.out.String()
+}
+
+// tailBuffer хранит последние maxOutputTail байт вывода процесса.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Write(p)
+	if extra := b.buf.Len() - maxOutputTail; extra > 0 {
+		b.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
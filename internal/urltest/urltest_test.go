@@ -0,0 +1,177 @@
+package urltest
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxyclient/internal/config"
+)
+
+// fakeInstance изображает sing-box: HTTP-прокси на порту из конфига, который
+// отвечает 204 на любой запрос с задержкой, зависящей от тега outbound.
+type fakeInstance struct {
+	srv     *http.Server
+	done    chan struct{}
+	out     string
+	release func()
+}
+
+func (f *fakeInstance) Done() <-chan struct{} { return f.done }
+
+func (f *fakeInstance) Stop() string {
+	if f.srv != nil {
+		_ = f.srv.Close()
+		f.release()
+	}
+	return f.out
+}
+
+func fakeLauncher(active, peak *int32) Launcher {
+	return func(_ context.Context, configPath string) (Instance, error) {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		var cfg testConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, err
+		}
+		tag := cfg.Route.Final
+		if strings.HasSuffix(tag, "broken") {
+			done := make(chan struct{})
+			close(done)
+			return &fakeInstance{done: done, out: "FATAL start service: outbound/vless[server-broken]: bad key\n"}, nil
+		}
+		n := atomic.AddInt32(active, 1)
+		for {
+			p := atomic.LoadInt32(peak)
+			if n <= p || atomic.CompareAndSwapInt32(peak, p, n) {
+				break
+			}
+		}
+		delay := 20 * time.Millisecond
+		if strings.HasSuffix(tag, "slow") {
+			delay = 120 * time.Millisecond
+		}
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(cfg.Inbounds[0].ListenPort)))
+		if err != nil {
+			return nil, err
+		}
+		inst := &fakeInstance{done: make(chan struct{}), release: func() { atomic.AddInt32(active, -1) }}
+		inst.srv = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			time.Sleep(delay)
+			w.WriteHeader(http.StatusNoContent)
+		})}
+		go func() { _ = inst.srv.Serve(l) }()
+		return inst, nil
+	}
+}
+
+func TestRunnerMeasuresEachServerWithinConcurrencyLimit(t *testing.T) {
+	var active, peak int32
+	r := &Runner{
+		URL:         "http://probe.invalid/generate_204",
+		Concurrency: 2,
+		WorkDir:     t.TempDir(),
+		Launch:      fakeLauncher(&active, &peak),
+	}
+	targets := []Target{
+		{ID: "fast", Outbounds: []config.SBOutbound{{Type: "vless", Tag: "server-fast"}}},
+		{ID: "slow", Outbounds: []config.SBOutbound{{Type: "vless", Tag: "server-slow"}}},
+		{ID: "broken", Outbounds: []config.SBOutbound{{Type: "vless", Tag: "server-broken"}}},
+		{ID: "fast2", Outbounds: []config.SBOutbound{{Type: "vless", Tag: "server-fast2"}}},
+		{ID: "empty"},
+	}
+	results := r.Run(context.Background(), targets)
+	if len(results) != len(targets) {
+		t.Fatalf("results = %+v", results)
+	}
+	byID := map[string]Result{}
+	for i, res := range results {
+		if res.ID != targets[i].ID {
+			t.Fatalf("results out of order: %+v", results)
+		}
+		byID[res.ID] = res
+	}
+	if !byID["fast"].OK || !byID["slow"].OK || byID["slow"].LatencyMs <= byID["fast"].LatencyMs {
+		t.Errorf("fast = %+v, slow = %+v", byID["fast"], byID["slow"])
+	}
+	if b := byID["broken"]; b.OK || !strings.Contains(b.Error, "bad key") {
+		t.Errorf("broken = %+v, want sing-box output in error", b)
+	}
+	if byID["empty"].OK {
+		t.Errorf("target without outbounds must fail: %+v", byID["empty"])
+	}
+	if p := atomic.LoadInt32(&peak); p > 2 {
+		t.Errorf("peak concurrent instances = %d, want <= 2", p)
+	}
+	if entries, _ := os.ReadDir(r.WorkDir); len(entries) != 0 {
+		t.Errorf("temporary configs left behind: %d", len(entries))
+	}
+}
+
+func TestBuildConfig(t *testing.T) {
+	data, err := BuildConfig([]config.SBOutbound{
+		{Type: "vless", Tag: "server-a", Detour: "server-b"},
+		{Type: "vless", Tag: "server-b"},
+	}, 43210)
+	if err != nil {
+		t.Fatalf("BuildConfig: %v", err)
+	}
+	var cfg map[string]any
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	inbounds := cfg["inbounds"].([]any)
+	in := inbounds[0].(map[string]any)
+	if len(inbounds) != 1 || in["type"] != "mixed" || in["listen"] != "127.0.0.1" || in["listen_port"] != float64(43210) {
+		t.Errorf("inbounds = %v", inbounds)
+	}
+	route := cfg["route"].(map[string]any)
+	if route["final"] != "server-a" || route["auto_detect_interface"] != true {
+		t.Errorf("route = %v", route)
+	}
+	if _, ok := cfg["experimental"]; ok {
+		t.Error("test instance must not expose Clash API")
+	}
+	if _, err := BuildConfig(nil, 1); err == nil {
+		t.Error("BuildConfig without outbounds must fail")
+	}
+}
+
+func TestRunnerMarksQueuedTargetsNotTestedOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan struct{})
+	r := &Runner{
+		Concurrency: 1,
+		WorkDir:     t.TempDir(),
+		Launch: func(ctx context.Context, _ string) (Instance, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	done := make(chan Result, 1)
+	go func() { done <- r.Test(ctx, Target{ID: "first", Outbounds: []config.SBOutbound{{Type: "vless", Tag: "server-first"}}}) }()
+	<-started
+	queued := make(chan Result, 1)
+	go func() { queued <- r.Test(ctx, Target{ID: "queued", Outbounds: []config.SBOutbound{{Type: "vless", Tag: "server-queued"}}}) }()
+	cancel()
+
+	// Запущенный тест — отказ, ждавший очереди — не тестировался.
+	if res := <-done; res.OK || res.Skipped {
+		t.Errorf("first = %+v, want failure", res)
+	}
+	if res := <-queued; res.OK || !res.Skipped || res.Error != "not tested" {
+		t.Errorf("queued = %+v, want skipped", res)
+	}
+}